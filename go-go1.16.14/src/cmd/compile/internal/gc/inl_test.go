@@ -54,6 +54,7 @@ func TestIntendedInlining(t *testing.T) {
 			"getMCache",
 			"isDirectIface",
 			"itabHashFunc",
+			"MaybePreempt",
 			"noescape",
 			"pcvalueCacheKey",
 			"readUnaligned32",
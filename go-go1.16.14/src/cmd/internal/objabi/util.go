@@ -165,6 +165,7 @@ var (
 	Preemptibleloops_enabled  int
 	Staticlockranking_enabled int
 	Regabi_enabled            int
+	Gennursery_enabled        int
 )
 
 // Toolchain experiments.
@@ -179,6 +180,7 @@ var exper = []struct {
 	{"preemptibleloops", &Preemptibleloops_enabled},
 	{"staticlockranking", &Staticlockranking_enabled},
 	{"regabi", &Regabi_enabled},
+	{"gennursery", &Gennursery_enabled},
 }
 
 var defaultExpstring = Expstring()
@@ -0,0 +1,305 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Manually managed memory arenas.
+//
+// An Arena hands out objects from chunks of memory it obtains from the
+// page heap as manually managed spans (spanAllocUserArena), much like
+// stacks. Allocation bumps a pointer through the current chunk, and
+// Free returns all the chunks to the page heap at once.
+//
+// The garbage collector neither marks nor frees objects in a chunk:
+// pointers into chunks are ignored, as pointers into stacks are. But
+// arena objects may point into the GC'd heap, so until the arena is
+// sealed its chunks are scanned as roots, like the data and BSS
+// segments. Each chunk begins with a pointer mask with one bit per
+// word of the chunk, which is set as objects are allocated and which
+// markroot and bulkBarrierPreWrite use like the data and BSS masks.
+// Writes into arena objects go through the write barrier as writes
+// to globals do, so chunks need only be scanned once per cycle.
+//
+// Sealing an arena checks that no arena object points into the GC'd
+// heap and then stops scanning the arena's chunks.
+//
+// The set of chunks that are roots only shrinks while holding gcsema,
+// so it can't change under a mark phase, and root scanning never
+// races with Free. Chunks are added to an arena, and arenas to
+// userArenas, by publishing fully initialized list nodes.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"runtime/internal/math"
+	"runtime/internal/sys"
+	"unsafe"
+)
+
+// userArenaChunkBytes is the size of the chunks an Arena allocates
+// from. Larger objects get a chunk of their own.
+const userArenaChunkBytes = 64 << 10
+
+// userArenas is the list of unsealed arenas, whose chunks are GC
+// roots.
+var userArenas struct {
+	lock mutex  // protects changes to the list
+	head *Arena // published atomically
+}
+
+// An Arena allocates objects from memory that is managed manually
+// rather than by the garbage collector. Allocating from an Arena is
+// cheaper than allocating from the heap, and the garbage collector
+// does not have to find and free the objects: they are all freed at
+// once when the Arena is freed.
+//
+// Freeing an Arena is unsafe in the way freeing memory in C is: the
+// program must not use any object allocated from the Arena afterward,
+// and the garbage collector does not keep objects alive because they
+// are referenced. Memory from an Arena that is not freed is never
+// reclaimed, even once the Arena is unreachable.
+//
+// An Arena must not be used by more than one goroutine at a time, but
+// objects allocated from it may be shared like any others.
+type Arena struct {
+	next, prev *Arena // links in userArenas while unsealed
+
+	// chunks is the list of chunks, linked through mspan.next,
+	// beginning with the chunk being allocated from. It is
+	// published atomically.
+	chunks *mspan
+
+	sealed bool
+	freed  bool
+}
+
+// NewArena returns a new, empty Arena.
+func NewArena() *Arena {
+	a := new(Arena)
+	lock(&userArenas.lock)
+	a.next = userArenas.head
+	if a.next != nil {
+		a.next.prev = a
+	}
+	atomicstorep(unsafe.Pointer(&userArenas.head), unsafe.Pointer(a))
+	unlock(&userArenas.lock)
+	return a
+}
+
+// New allocates a zeroed object from the arena and returns a pointer
+// to it. typ must be a pointer of the type to return, such as
+// (*T)(nil) to allocate a T and return a *T.
+func (a *Arena) New(typ interface{}) interface{} {
+	t := efaceOf(&typ)._type
+	if t == nil || t.kind&kindMask != kindPtr {
+		panic(plainError("runtime: Arena.New: typ is not a pointer"))
+	}
+	var r interface{}
+	e := efaceOf(&r)
+	e._type = t
+	e.data = a.alloc((*ptrtype)(unsafe.Pointer(t)).elem, 1)
+	return r
+}
+
+// MakeSlice allocates a zeroed array of cap elements from the arena
+// and returns a slice of it of length len. typ must be a slice of the
+// type to return, such as []T(nil) to return a []T.
+func (a *Arena) MakeSlice(typ interface{}, len, cap int) interface{} {
+	t := efaceOf(&typ)._type
+	if t == nil || t.kind&kindMask != kindSlice {
+		panic(plainError("runtime: Arena.MakeSlice: typ is not a slice"))
+	}
+	if len < 0 {
+		panicmakeslicelen()
+	}
+	if cap < len {
+		panicmakeslicecap()
+	}
+	x := a.alloc((*slicetype)(unsafe.Pointer(t)).elem, uintptr(cap))
+	var r interface{}
+	e := efaceOf(&r)
+	e._type = t
+	e.data = unsafe.Pointer(&slice{x, len, cap})
+	return r
+}
+
+// alloc returns n consecutive zeroed objects of type typ.
+func (a *Arena) alloc(typ *_type, n uintptr) unsafe.Pointer {
+	if a.freed {
+		panic(plainError("runtime: allocation from freed Arena"))
+	}
+	if a.sealed {
+		panic(plainError("runtime: allocation from sealed Arena"))
+	}
+	size, overflow := math.MulUintptr(typ.size, n)
+	if overflow || size > maxAlloc {
+		panic(plainError("runtime: Arena allocation too large"))
+	}
+	if size == 0 {
+		return unsafe.Pointer(&zerobase)
+	}
+	align := uintptr(typ.align)
+	if align == 0 {
+		align = 1
+	}
+
+	s := a.chunks
+	var x uintptr
+	if s != nil {
+		x = alignUp(s.limit, align)
+	}
+	if s == nil || x+size > s.base()+s.npages*pageSize {
+		s = a.newChunk(size + align - 1)
+		x = alignUp(s.limit, align)
+	}
+	if typ.ptrdata != 0 {
+		userArenaSetPointers(s, x, typ, n)
+	}
+	// Make sure the GC observes the pointer mask before it scans
+	// the object.
+	publicationBarrier()
+	atomic.Storeuintptr(&s.limit, x+size)
+
+	if raceenabled {
+		racemalloc(unsafe.Pointer(x), size)
+	}
+	if msanenabled {
+		msanmalloc(unsafe.Pointer(x), size)
+	}
+	return unsafe.Pointer(x)
+}
+
+// userArenaMaskBytes returns the size of the pointer mask at the
+// start of an Arena chunk of npages pages.
+func userArenaMaskBytes(npages uintptr) uintptr {
+	return alignUp(divRoundUp(npages*pageSize, 8*sys.PtrSize), sys.PtrSize)
+}
+
+// newChunk adds a chunk to a with room for at least size bytes of
+// objects and returns it.
+func (a *Arena) newChunk(size uintptr) *mspan {
+	npages := uintptr(userArenaChunkBytes / pageSize)
+	if n := divRoundUp(size, pageSize); n > npages {
+		npages = n
+	}
+	for npages*pageSize-userArenaMaskBytes(npages) < size {
+		npages++
+	}
+
+	var s *mspan
+	systemstack(func() {
+		s = mheap_.allocManual(npages, spanAllocUserArena)
+	})
+	if s == nil {
+		throw("out of memory")
+	}
+	if s.needzero != 0 {
+		memclrNoHeapPointers(unsafe.Pointer(s.base()), npages*pageSize)
+	}
+	s.limit = s.base() + userArenaMaskBytes(npages)
+	s.userArena = 1
+
+	head := a.chunks
+	if head != nil && npages > userArenaChunkBytes/pageSize {
+		// Keep allocating small objects from the current
+		// chunk rather than from what's left of this one.
+		s.next = head.next
+		atomic.StorepNoWB(unsafe.Pointer(&head.next), unsafe.Pointer(s))
+		return s
+	}
+	s.next = head
+	atomic.StorepNoWB(unsafe.Pointer(&a.chunks), unsafe.Pointer(s))
+	return s
+}
+
+// Seal stops the garbage collector from scanning the objects in the
+// arena, which otherwise it must do in every cycle, as it does global
+// variables. After Seal, no more objects may be allocated from the
+// arena.
+//
+// Seal panics if any object in the arena holds a pointer into the
+// garbage-collected heap, since the garbage collector would no longer
+// see it. Pointers to other objects in the arena or in other arenas,
+// and to global variables, are allowed. The program must not store
+// pointers into the garbage-collected heap in the arena's objects
+// after it is sealed.
+func (a *Arena) Seal() {
+	if a.freed {
+		panic(plainError("runtime: Seal of freed Arena"))
+	}
+	if a.sealed {
+		return
+	}
+	for s := a.chunks; s != nil; s = s.next {
+		for p := s.base(); p < s.limit; p += sys.PtrSize {
+			if !userArenaIsPointer(s, p) {
+				continue
+			}
+			if v := *(*uintptr)(unsafe.Pointer(p)); v != 0 && spanOfHeap(v) != nil {
+				panic(plainError("runtime: Seal of Arena holding a pointer into the heap"))
+			}
+		}
+	}
+	semacquire(&gcsema)
+	a.unlink()
+	a.sealed = true
+	semrelease(&gcsema)
+}
+
+// Free frees all the objects allocated from the arena and returns its
+// memory to the heap. The program must not use the arena or any of
+// its objects after Free.
+func (a *Arena) Free() {
+	if a.freed {
+		panic(plainError("runtime: Arena freed twice"))
+	}
+	a.freed = true
+
+	// Hold gcsema so that no GC is scanning the chunks.
+	semacquire(&gcsema)
+	if !a.sealed {
+		a.unlink()
+	}
+	s := a.chunks
+	a.chunks = nil
+	for s != nil {
+		next := s.next
+		if raceenabled {
+			racefree(unsafe.Pointer(s.base()), s.npages*pageSize)
+		}
+		if msanenabled {
+			msanfree(unsafe.Pointer(s.base()), s.npages*pageSize)
+		}
+		s.userArena = 0
+		systemstack(func() {
+			mheap_.freeManual(s, spanAllocUserArena)
+		})
+		s = next
+	}
+	semrelease(&gcsema)
+}
+
+// unlink removes a from userArenas. The caller must hold gcsema.
+func (a *Arena) unlink() {
+	lock(&userArenas.lock)
+	if a.prev != nil {
+		a.prev.next = a.next
+	} else {
+		userArenas.head = a.next
+	}
+	if a.next != nil {
+		a.next.prev = a.prev
+	}
+	a.next, a.prev = nil, nil
+	unlock(&userArenas.lock)
+}
+
+// markrootUserArenas scans the chunks of unsealed arenas.
+func markrootUserArenas(gcw *gcWork) {
+	for a := (*Arena)(atomic.Loadp(unsafe.Pointer(&userArenas.head))); a != nil; a = a.next {
+		for s := (*mspan)(atomic.Loadp(unsafe.Pointer(&a.chunks))); s != nil; s = (*mspan)(atomic.Loadp(unsafe.Pointer(&s.next))) {
+			limit := atomic.Loaduintptr(&s.limit)
+			scanblock(s.base(), limit-s.base(), (*uint8)(unsafe.Pointer(s.base())), gcw, nil)
+		}
+	}
+}
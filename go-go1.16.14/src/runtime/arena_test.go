@@ -0,0 +1,141 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type arenaNode struct {
+	val  int
+	next *arenaNode
+	data *[]byte
+}
+
+func TestArenaNew(t *testing.T) {
+	a := runtime.NewArena()
+	defer a.Free()
+
+	var head *arenaNode
+	for i := 0; i < 10000; i++ {
+		n := a.New((*arenaNode)(nil)).(*arenaNode)
+		if n.val != 0 || n.next != nil || n.data != nil {
+			t.Fatalf("New returned non-zero object %+v", *n)
+		}
+		n.val = i
+		n.next = head
+		head = n
+	}
+	s := a.MakeSlice([]uint64(nil), 10, 100).([]uint64)
+	if len(s) != 10 || cap(s) != 100 {
+		t.Fatalf("MakeSlice returned len %d, cap %d; want 10, 100", len(s), cap(s))
+	}
+	for i, v := range s[:cap(s)] {
+		if v != 0 {
+			t.Fatalf("MakeSlice returned non-zero element %d: %d", i, v)
+		}
+	}
+	big := a.MakeSlice([]byte(nil), 1<<20, 1<<20).([]byte)
+	big[len(big)-1] = 1
+
+	for i := 9999; i >= 0; i-- {
+		if head.val != i {
+			t.Fatalf("got node %d, want %d", head.val, i)
+		}
+		head = head.next
+	}
+}
+
+func TestArenaHeapPointers(t *testing.T) {
+	a := runtime.NewArena()
+	defer a.Free()
+
+	nodes := make([]*arenaNode, 100)
+	for i := range nodes {
+		b := make([]byte, 64)
+		b[0] = byte(i)
+		nodes[i] = a.New((*arenaNode)(nil)).(*arenaNode)
+		nodes[i].data = &b
+	}
+	// The heap objects are only reachable through the arena.
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		for j := 0; j < 100; j++ {
+			_ = make([]byte, 64)
+		}
+	}
+	for i, n := range nodes {
+		if (*n.data)[0] != byte(i) {
+			t.Fatalf("node %d: heap object overwritten: %d", i, (*n.data)[0])
+		}
+	}
+
+	err := func() (err interface{}) {
+		defer func() { err = recover() }()
+		a.Seal()
+		return nil
+	}()
+	if e, ok := err.(runtime.Error); !ok || !strings.Contains(e.Error(), "pointer into the heap") {
+		t.Fatalf("Seal of arena with heap pointers: got %v, want panic", err)
+	}
+}
+
+func TestArenaSeal(t *testing.T) {
+	a := runtime.NewArena()
+	defer a.Free()
+
+	var head *arenaNode
+	for i := 0; i < 100; i++ {
+		n := a.New((*arenaNode)(nil)).(*arenaNode)
+		n.val = i
+		n.next = head
+		head = n
+	}
+	a.Seal()
+	runtime.GC()
+	for i := 99; i >= 0; i-- {
+		if head.val != i {
+			t.Fatalf("got node %d, want %d", head.val, i)
+		}
+		head = head.next
+	}
+
+	err := func() (err interface{}) {
+		defer func() { err = recover() }()
+		a.New((*arenaNode)(nil))
+		return nil
+	}()
+	if err == nil {
+		t.Fatalf("New after Seal did not panic")
+	}
+}
+
+func TestArenaFree(t *testing.T) {
+	var before, during, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	a := runtime.NewArena()
+	a.MakeSlice([]byte(nil), 4<<20, 4<<20)
+	runtime.ReadMemStats(&during)
+	a.Free()
+	runtime.ReadMemStats(&after)
+
+	if during.OtherSys < before.OtherSys+4<<20 {
+		t.Errorf("OtherSys with arena = %d, want at least %d", during.OtherSys, before.OtherSys+4<<20)
+	}
+	if after.OtherSys+4<<20 > during.OtherSys {
+		t.Errorf("OtherSys after Free = %d, want at most %d", after.OtherSys, during.OtherSys-4<<20)
+	}
+
+	err := func() (err interface{}) {
+		defer func() { err = recover() }()
+		a.Free()
+		return nil
+	}()
+	if err == nil {
+		t.Fatalf("second Free did not panic")
+	}
+}
@@ -707,6 +707,19 @@ nosave:
 TEXT ·cgocallback(SB),NOSPLIT,$12-12  // Frame size must match commented places below
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOVL	fn+0(FP), AX
+	CMPL	AX, $0
+	JNE	loadg
+	// Restore the g from frame.
+	get_tls(CX)
+	MOVL	frame+4(FP), BX
+	MOVL	BX, g(CX)
+	JMP	dropm
+
+loadg:
 	// If g is nil, Go did not create the current thread.
 	// Call needm to obtain one for temporary use.
 	// In this case, we're running on the thread stack, so there's
@@ -723,6 +736,11 @@ TEXT ·cgocallback(SB),NOSPLIT,$12-12  // Frame size must match commented places
 	JEQ	needm
 	MOVL	g_m(BP), BP
 	MOVL	BP, savedm-4(SP) // saved copy of oldm
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	CMPB	m_isExtraInC(BP), $0
+	JEQ	havem
+	MOVL	$0, savedm-4(SP)
 	JMP	havem
 needm:
 	MOVL	$runtime·needm(SB), AX
@@ -806,10 +824,12 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOVL	savedm-4(SP), DX
 	CMPL	DX, $0
-	JNE 3(PC)
+	JNE	done
+dropm:
 	MOVL	$runtime·dropm(SB), AX
 	CALL	AX
 
+done:
 	// Done!
 	RET
 
@@ -751,6 +751,19 @@ nosave:
 TEXT ·cgocallback(SB),NOSPLIT,$24-24
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOVQ	fn+0(FP), AX
+	CMPQ	AX, $0
+	JNE	loadg
+	// Restore the g from frame.
+	get_tls(CX)
+	MOVQ	frame+8(FP), BX
+	MOVQ	BX, g(CX)
+	JMP	dropm
+
+loadg:
 	// If g is nil, Go did not create the current thread.
 	// Call needm to obtain one m for temporary use.
 	// In this case, we're running on the thread stack, so there's
@@ -767,6 +780,11 @@ TEXT ·cgocallback(SB),NOSPLIT,$24-24
 	JEQ	needm
 	MOVQ	g_m(BX), BX
 	MOVQ	BX, savedm-8(SP)	// saved copy of oldm
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	CMPB	m_isExtraInC(BX), $0
+	JEQ	havem
+	MOVQ	$0, savedm-8(SP)
 	JMP	havem
 needm:
 	MOVQ    $runtime·needm(SB), AX
@@ -863,10 +881,12 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOVQ	savedm-8(SP), BX
 	CMPQ	BX, $0
-	JNE 3(PC)
+	JNE	done
+dropm:
 	MOVQ	$runtime·dropm(SB), AX
 	CALL	AX
 
+done:
 	// Done!
 	RET
 
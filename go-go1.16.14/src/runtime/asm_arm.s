@@ -648,6 +648,17 @@ nosave:
 TEXT	·cgocallback(SB),NOSPLIT,$12-12
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOVW	fn+0(FP), R1
+	CMP	$0, R1
+	B.NE	loadg
+	// Restore the g from frame.
+	MOVW	frame+4(FP), g
+	B	dropm
+
+loadg:
 	// Load m and g from thread-local storage.
 	MOVB	runtime·iscgo(SB), R0
 	CMP	$0, R0
@@ -663,6 +674,13 @@ TEXT	·cgocallback(SB),NOSPLIT,$12-12
 
 	MOVW	g_m(g), R8
 	MOVW	R8, savedm-4(SP)
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	MOVBU	m_isExtraInC(R8), R0
+	CMP	$0, R0
+	B.EQ	havem
+	MOVW	$0, R0
+	MOVW	R0, savedm-4(SP)
 	B	havem
 
 needm:
@@ -742,10 +760,12 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOVW	savedm-4(SP), R6
 	CMP	$0, R6
-	B.NE	3(PC)
+	B.NE	done
+dropm:
 	MOVW	$runtime·dropm(SB), R0
 	BL	(R0)
 
+done:
 	// Done!
 	RET
 
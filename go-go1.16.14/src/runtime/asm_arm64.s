@@ -976,6 +976,16 @@ nosave:
 TEXT ·cgocallback(SB),NOSPLIT,$24-24
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOVD	fn+0(FP), R1
+	CBNZ	R1, loadg
+	// Restore the g from frame.
+	MOVD	frame+8(FP), g
+	B	dropm
+
+loadg:
 	// Load g from thread-local storage.
 	BL	runtime·load_g(SB)
 
@@ -988,6 +998,11 @@ TEXT ·cgocallback(SB),NOSPLIT,$24-24
 
 	MOVD	g_m(g), R8
 	MOVD	R8, savedm-8(SP)
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	MOVBU	m_isExtraInC(R8), R0
+	CBZ	R0, havem
+	MOVD	ZR, savedm-8(SP)
 	B	havem
 
 needm:
@@ -1076,6 +1091,7 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOVD	savedm-8(SP), R6
 	CBNZ	R6, droppedm
+dropm:
 	MOVD	$runtime·dropm(SB), R0
 	BL	(R0)
 droppedm:
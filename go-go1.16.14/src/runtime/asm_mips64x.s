@@ -476,6 +476,16 @@ g0:
 TEXT ·cgocallback(SB),NOSPLIT,$24-24
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOVV	fn+0(FP), R5
+	BNE	R5, loadg
+	// Restore the g from frame.
+	MOVV	frame+8(FP), g
+	JMP	dropm
+
+loadg:
 	// Load m and g from thread-local storage.
 	MOVB	runtime·iscgo(SB), R1
 	BEQ	R1, nocgo
@@ -491,6 +501,11 @@ nocgo:
 
 	MOVV	g_m(g), R3
 	MOVV	R3, savedm-8(SP)
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	MOVBU	m_isExtraInC(R3), R1
+	BEQ	R1, havem
+	MOVV	R0, savedm-8(SP)
 	JMP	havem
 
 needm:
@@ -570,6 +585,7 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOVV	savedm-8(SP), R3
 	BNE	R3, droppedm
+dropm:
 	MOVV	$runtime·dropm(SB), R4
 	JAL	(R4)
 droppedm:
@@ -477,6 +477,16 @@ g0:
 TEXT ·cgocallback(SB),NOSPLIT,$12-12
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOVW	fn+0(FP), R5
+	BNE	R5, loadg
+	// Restore the g from frame.
+	MOVW	frame+4(FP), g
+	JMP	dropm
+
+loadg:
 	// Load m and g from thread-local storage.
 	MOVB	runtime·iscgo(SB), R1
 	BEQ	R1, nocgo
@@ -492,6 +502,11 @@ nocgo:
 
 	MOVW	g_m(g), R3
 	MOVW	R3, savedm-4(SP)
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	MOVBU	m_isExtraInC(R3), R1
+	BEQ	R1, havem
+	MOVW	R0, savedm-4(SP)
 	JMP	havem
 
 needm:
@@ -571,6 +586,7 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOVW	savedm-4(SP), R3
 	BNE	R3, droppedm
+dropm:
 	MOVW	$runtime·dropm(SB), R4
 	JAL	(R4)
 droppedm:
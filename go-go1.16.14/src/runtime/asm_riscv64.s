@@ -524,6 +524,16 @@ TEXT runtime·goexit(SB),NOSPLIT|NOFRAME|TOPFRAME,$0-0
 TEXT ·cgocallback(SB),NOSPLIT,$24-24
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOV	fn+0(FP), X7
+	BNE	ZERO, X7, loadg
+	// Restore the g from frame.
+	MOV	frame+8(FP), g
+	JMP	dropm
+
+loadg:
 	// Load m and g from thread-local storage.
 	MOVBU	runtime·iscgo(SB), X5
 	BEQ	ZERO, X5, nocgo
@@ -539,6 +549,11 @@ nocgo:
 
 	MOV	g_m(g), X5
 	MOV	X5, savedm-8(SP)
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	MOVBU	m_isExtraInC(X5), X6
+	BEQ	ZERO, X6, havem
+	MOV	ZERO, savedm-8(SP)
 	JMP	havem
 
 needm:
@@ -618,6 +633,7 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOV	savedm-8(SP), X5
 	BNE	ZERO, X5, droppedm
+dropm:
 	MOV	$runtime·dropm(SB), X6
 	JALR	RA, X6
 droppedm:
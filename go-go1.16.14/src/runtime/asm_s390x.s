@@ -580,6 +580,16 @@ g0:
 TEXT ·cgocallback(SB),NOSPLIT,$24-24
 	NO_LOCAL_POINTERS
 
+	// Skip cgocallbackg, just dropm when fn is nil, and frame is the
+	// saved g. It is used to release the m bound to a C thread when
+	// the thread exits; see dropm.
+	MOVD	fn+0(FP), R1
+	CMPBNE	R1, $0, loadg
+	// Restore the g from frame.
+	MOVD	frame+8(FP), g
+	BR	dropm
+
+loadg:
 	// Load m and g from thread-local storage.
 	MOVB	runtime·iscgo(SB), R3
 	CMPBEQ	R3, $0, nocgo
@@ -595,6 +605,11 @@ nocgo:
 
 	MOVD	g_m(g), R8
 	MOVD	R8, savedm-8(SP)
+	// If m is the extra m that dropm bound to this thread, the thread
+	// is calling in from C just as if g were nil, so dropm on return.
+	MOVBZ	m_isExtraInC(R8), R3
+	CMPBEQ	R3, $0, havem
+	MOVD	$0, savedm-8(SP)
 	BR	havem
 
 needm:
@@ -674,6 +689,7 @@ havem:
 	// for the duration of the call. Since the call is over, return it with dropm.
 	MOVD	savedm-8(SP), R6
 	CMPBNE	R6, $0, droppedm
+dropm:
 	MOVD	$runtime·dropm(SB), R3
 	BL	(R3)
 droppedm:
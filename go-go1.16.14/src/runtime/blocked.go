@@ -0,0 +1,237 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"runtime/internal/sys"
+	"unsafe"
+)
+
+// blockedSummaryMax is the number of channels and creation sites a
+// blockedSummary keeps count of. Goroutines blocked on other channels
+// or created elsewhere are only counted in the totals.
+const blockedSummaryMax = 32
+
+// blockedSummaryPrint is the number of channels and creation sites
+// printed by checkdead.
+const blockedSummaryPrint = 10
+
+// A blockedSummary counts blocked goroutines by wait reason, by the
+// channels they are blocked on and by the go statements that created
+// them. It doesn't allocate, so that checkdead can use it.
+type blockedSummary struct {
+	n          int32                           // number of blocked goroutines
+	reasons    [256]int32                      // blocked goroutines by waitReason
+	chans      [blockedSummaryMax]blockedCount // by *hchan
+	nchans     int32                           // entries of chans in use
+	otherChans int32                           // goroutines on channels not in chans
+	sites      [blockedSummaryMax]blockedCount // by g.gopc
+	nsites     int32                           // entries of sites in use
+	otherSites int32                           // goroutines from sites not in sites
+}
+
+type blockedCount struct {
+	key uintptr
+	n   int32
+}
+
+// blockedDeadlock is the summary printed by checkdead. It is global
+// because checkdead can't allocate and is only called once it is
+// about to throw.
+var blockedDeadlock blockedSummary
+
+// add counts a goroutine for key in the first n entries of counts,
+// adding an entry if there is room, and reports whether it did.
+func (s *blockedSummary) add(counts []blockedCount, n *int32, key uintptr) bool {
+	for i := int32(0); i < *n; i++ {
+		if counts[i].key == key {
+			counts[i].n++
+			return true
+		}
+	}
+	if int(*n) == len(counts) {
+		return false
+	}
+	counts[*n] = blockedCount{key: key, n: 1}
+	*n++
+	return true
+}
+
+// addg counts gp, which must be blocked, in s. gp must not be able to
+// change status while addg looks at it.
+func (s *blockedSummary) addg(gp *g) {
+	s.n++
+	s.reasons[gp.waitreason]++
+	// A goroutine in a select is waiting on each of its cases, which
+	// may share channels.
+	for sg := gp.waiting; sg != nil; sg = sg.waitlink {
+		if sg.c == nil {
+			continue
+		}
+		dup := false
+		for prev := gp.waiting; prev != sg; prev = prev.waitlink {
+			if prev.c == sg.c {
+				dup = true
+				break
+			}
+		}
+		if !dup && !s.add(s.chans[:], &s.nchans, uintptr(unsafe.Pointer(sg.c))) {
+			s.otherChans++
+		}
+	}
+	if gp.goid != 1 && !s.add(s.sites[:], &s.nsites, gp.gopc) {
+		s.otherSites++
+	}
+}
+
+// sort orders the channels and creation sites by decreasing count.
+func (s *blockedSummary) sort() {
+	sortBlockedCounts(s.chans[:s.nchans])
+	sortBlockedCounts(s.sites[:s.nsites])
+}
+
+func sortBlockedCounts(counts []blockedCount) {
+	for i := 1; i < len(counts); i++ {
+		for j := i; j > 0 && counts[j].n > counts[j-1].n; j-- {
+			counts[j], counts[j-1] = counts[j-1], counts[j]
+		}
+	}
+}
+
+// collect counts the blocked goroutines other than the system
+// goroutines and the caller. They must not be able to change status
+// while collect runs, because the world is stopped or, in checkdead,
+// because nothing is running.
+//
+//go:nowritebarrierrec
+func (s *blockedSummary) collect() {
+	*s = blockedSummary{}
+	curg := getg().m.curg
+	ptr, n := atomicAllG()
+	for i := uintptr(0); i < n; i++ {
+		gp := atomicAllGIndex(ptr, i)
+		if gp == curg || readgstatus(gp)&^_Gscan != _Gwaiting || isSystemGoroutine(gp, false) {
+			continue
+		}
+		s.addg(gp)
+	}
+	s.sort()
+}
+
+// print prints s for checkdead.
+func (s *blockedSummary) print() {
+	print("\nblocked goroutines: ", s.n, "\n")
+	for w, n := range s.reasons {
+		if n != 0 {
+			print("\t", n, " [", waitReason(w).String(), "]\n")
+		}
+	}
+	if s.nchans > 0 {
+		print("blocked on channels:\n")
+		other := s.otherChans
+		for i, c := range s.chans[:s.nchans] {
+			if i >= blockedSummaryPrint {
+				other += c.n
+				continue
+			}
+			print("\t", c.n, " on ", hex(c.key), "\n")
+		}
+		if other > 0 {
+			print("\t", other, " on other channels\n")
+		}
+	}
+	if s.nsites > 0 {
+		print("created by:\n")
+		other := s.otherSites
+		for i, c := range s.sites[:s.nsites] {
+			if i >= blockedSummaryPrint {
+				other += c.n
+				continue
+			}
+			print("\t", c.n, " by ")
+			printBlockedSite(c.key)
+		}
+		if other > 0 {
+			print("\t", other, " elsewhere\n")
+		}
+	}
+}
+
+// printBlockedSite prints the function and line of the go statement
+// at pc.
+func printBlockedSite(pc uintptr) {
+	f := findfunc(pc)
+	if !f.valid() {
+		print("unknown pc ", hex(pc), "\n")
+		return
+	}
+	tracepc := pc // back up to CALL instruction for funcline.
+	if pc > f.entry {
+		tracepc -= sys.PCQuantum
+	}
+	file, line := funcline(f, tracepc)
+	print(funcname(f), "\n\t\t", file, ":", line, "\n")
+}
+
+// A BlockedSummary describes the goroutines that were blocked when
+// BlockedGoroutines was called.
+type BlockedSummary struct {
+	Goroutines  int                // number of blocked goroutines
+	WaitReasons map[WaitReason]int // number of blocked goroutines for each reason
+	Chans       []BlockedChan      // channels blocked on, most goroutines first
+	CreatedBy   []BlockedSite      // go statements of blocked goroutines, most goroutines first
+
+	// OtherChans and OtherCreatedBy are the numbers of goroutines
+	// blocked on channels not in Chans and created by go statements
+	// not in CreatedBy, which hold a limited number of entries.
+	OtherChans     int
+	OtherCreatedBy int
+}
+
+// A BlockedChan is a channel that goroutines are blocked on.
+type BlockedChan struct {
+	Addr       uintptr // address of the channel, as printed by fmt's %p
+	Goroutines int     // number of goroutines blocked on it
+}
+
+// A BlockedSite is a go statement that created blocked goroutines.
+type BlockedSite struct {
+	PC         uintptr // PC of the go statement, as in GInfo.CreatedBy
+	Goroutines int     // number of blocked goroutines it created
+}
+
+// BlockedGoroutines summarizes the goroutines, other than the caller,
+// that are blocked, such as on channel operations, in select
+// statements or in the sync package. When all goroutines are blocked,
+// the runtime prints the same summary before reporting the deadlock.
+//
+// BlockedGoroutines stops the world while it looks at the goroutines.
+// It is meant for tests, for example to check that the code they test
+// leaves no goroutines blocked on its channels.
+func BlockedGoroutines() BlockedSummary {
+	s := new(blockedSummary)
+	stopTheWorld("blocked goroutines")
+	s.collect()
+	startTheWorld()
+
+	r := BlockedSummary{
+		Goroutines:     int(s.n),
+		WaitReasons:    make(map[WaitReason]int),
+		OtherChans:     int(s.otherChans),
+		OtherCreatedBy: int(s.otherSites),
+	}
+	for w, n := range s.reasons {
+		if n != 0 {
+			r.WaitReasons[WaitReason(w)] = int(n)
+		}
+	}
+	for _, c := range s.chans[:s.nchans] {
+		r.Chans = append(r.Chans, BlockedChan{Addr: c.key, Goroutines: int(c.n)})
+	}
+	for _, c := range s.sites[:s.nsites] {
+		r.CreatedBy = append(r.CreatedBy, BlockedSite{PC: c.key, Goroutines: int(c.n)})
+	}
+	return r
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlockedGoroutines(t *testing.T) {
+	c := make(chan int)
+	started := make(chan bool)
+	for i := 0; i < 3; i++ {
+		go func() {
+			started <- true
+			<-c
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	defer close(c)
+	addr := fmt.Sprintf("%p", c)
+
+	// The goroutines may not have reached the receive from c yet.
+	var s runtime.BlockedSummary
+	var found *runtime.BlockedChan
+	for i := 0; i < 100; i++ {
+		s = runtime.BlockedGoroutines()
+		found = nil
+		for j, bc := range s.Chans {
+			if fmt.Sprintf("%#x", bc.Addr) == addr {
+				found = &s.Chans[j]
+			}
+		}
+		if found != nil && found.Goroutines == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if found == nil || found.Goroutines != 3 {
+		t.Fatalf("channel %s not reported with 3 goroutines: %+v", addr, s.Chans)
+	}
+	if s.WaitReasons[runtime.WaitChanReceive] < 3 {
+		t.Errorf("%d goroutines reported in chan receive, want at least 3", s.WaitReasons[runtime.WaitChanReceive])
+	}
+	n := 0
+	for _, r := range s.WaitReasons {
+		n += r
+	}
+	if n != s.Goroutines {
+		t.Errorf("WaitReasons add up to %d goroutines, want %d", n, s.Goroutines)
+	}
+	for i := 1; i < len(s.Chans); i++ {
+		if s.Chans[i].Goroutines > s.Chans[i-1].Goroutines {
+			t.Errorf("Chans not sorted by goroutines: %+v", s.Chans)
+			break
+		}
+	}
+	site := false
+	for _, bs := range s.CreatedBy {
+		if f := runtime.FuncForPC(bs.PC); f != nil && strings.HasSuffix(f.Name(), ".TestBlockedGoroutines") && bs.Goroutines >= 3 {
+			site = true
+		}
+	}
+	if !site {
+		t.Errorf("TestBlockedGoroutines not reported as creating 3 goroutines")
+	}
+}
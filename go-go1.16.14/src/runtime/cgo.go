@@ -17,6 +17,8 @@ import "unsafe"
 //go:linkname _cgo_callers _cgo_callers
 //go:linkname _cgo_set_context_function _cgo_set_context_function
 //go:linkname _cgo_yield _cgo_yield
+//go:linkname _cgo_bindm _cgo_bindm
+//go:linkname _cgo_pthread_key_created _cgo_pthread_key_created
 
 var (
 	_cgo_init                     unsafe.Pointer
@@ -26,6 +28,8 @@ var (
 	_cgo_callers                  unsafe.Pointer
 	_cgo_set_context_function     unsafe.Pointer
 	_cgo_yield                    unsafe.Pointer
+	_cgo_bindm                    unsafe.Pointer
+	_cgo_pthread_key_created      unsafe.Pointer
 )
 
 // iscgo is set to true by the runtime/cgo package
@@ -84,6 +84,39 @@ var _cgo_sys_thread_create = &x_cgo_sys_thread_create
 var x_cgo_notify_runtime_init_done byte
 var _cgo_notify_runtime_init_done = &x_cgo_notify_runtime_init_done
 
+// Binds the m of a C thread that called into Go to the thread, so
+// that the thread keeps it until it exits. See runtime.dropm.
+
+//go:cgo_import_static x_cgo_bindm
+//go:linkname x_cgo_bindm x_cgo_bindm
+//go:linkname _cgo_bindm _cgo_bindm
+var x_cgo_bindm byte
+var _cgo_bindm = &x_cgo_bindm
+
+// Set to non-zero once the thread-specific key used to release the m
+// bound to a C thread when the thread exits has been created.
+
+//go:cgo_import_static x_cgo_pthread_key_created
+//go:linkname x_cgo_pthread_key_created x_cgo_pthread_key_created
+//go:linkname _cgo_pthread_key_created _cgo_pthread_key_created
+var x_cgo_pthread_key_created byte
+var _cgo_pthread_key_created = &x_cgo_pthread_key_created
+
+// Holds the address of crosscall2, for the destructor of the key in
+// x_cgo_pthread_key_created to call.
+
+//go:cgo_import_static x_crosscall2_ptr
+//go:linkname x_crosscall2_ptr x_crosscall2_ptr
+var x_crosscall2_ptr byte
+
+//go:linkname _crosscall2 crosscall2
+func _crosscall2()
+
+func init() {
+	f := _crosscall2
+	*(*uintptr)(unsafe.Pointer(&x_crosscall2_ptr)) = **(**uintptr)(unsafe.Pointer(&f))
+}
+
 // Sets the traceback context function. See runtime.SetCgoTraceback.
 
 //go:cgo_import_static x_cgo_set_context_function
@@ -21,6 +21,18 @@ static int runtime_init_done;
 // The context function, used when tracing back C calls into Go.
 static void (*cgo_context_function)(struct context_arg*);
 
+// pthread_g holds the g0 of the m bound to a C thread that called into
+// Go, so that the m can be released when the thread exits.
+static pthread_key_t pthread_g;
+static void pthread_key_destructor(void* g);
+
+// x_cgo_pthread_key_created is set once pthread_g has been created.
+// Until then, the runtime releases the m of a C thread as each call
+// into Go returns.
+uintptr_t x_cgo_pthread_key_created;
+
+void (*x_crosscall2_ptr)(void (*fn)(void *), void *a, int c, uintptr_t ctxt);
+
 void
 x_cgo_sys_thread_create(void* (*func)(void*), void* arg) {
 	pthread_t p;
@@ -40,6 +52,12 @@ _cgo_wait_runtime_init_done(void) {
 		pthread_cond_wait(&runtime_init_cond, &runtime_init_mu);
 	}
 
+	// The key is created once for the whole program; the value, and
+	// so the call of the destructor, is per thread.
+	if (x_cgo_pthread_key_created == 0 && pthread_key_create(&pthread_g, pthread_key_destructor) == 0) {
+		x_cgo_pthread_key_created = 1;
+	}
+
 	// TODO(iant): For the case of a new C thread calling into Go, such
 	// as when using -buildmode=c-archive, we know that Go runtime
 	// initialization is complete but we do not know that all Go init
@@ -88,6 +106,27 @@ void (*(_cgo_get_context_function(void)))(struct context_arg*) {
 	return ret;
 }
 
+// Binds the m whose g0 is g to the current thread, so that the thread
+// keeps using it for calls into Go until it exits. Called by
+// runtime.dropm when the first call into Go from a C thread returns.
+void
+x_cgo_bindm(void* g) {
+	// pthread_setspecific can only fail for lack of memory, in
+	// which case the m is never released.
+	pthread_setspecific(pthread_g, g);
+}
+
+static void
+pthread_key_destructor(void* g) {
+	// The thread is exiting with an m bound to it. Call into Go with
+	// a nil function, which makes runtime.cgocallback restore g,
+	// which may have been cleared from Go's thread-local storage by
+	// now on some platforms, and release the m with dropm.
+	if (x_crosscall2_ptr != nil) {
+		x_crosscall2_ptr(nil, g, 0, 0);
+	}
+}
+
 // _cgo_try_pthread_create retries pthread_create if it fails with
 // EAGAIN.
 int
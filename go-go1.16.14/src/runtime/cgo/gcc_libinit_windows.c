@@ -51,6 +51,19 @@ _cgo_maybe_run_preinit() {
 	 }
 }
 
+// There is no thread-specific destructor to release the m of a C
+// thread with when it exits on Windows, so m's are never bound to
+// threads, and x_cgo_pthread_key_created stays 0.
+uintptr_t x_cgo_pthread_key_created;
+
+void (*x_crosscall2_ptr)(void (*fn)(void *), void *a, int c, uintptr_t ctxt);
+
+void
+x_cgo_bindm(void* dummy) {
+	fprintf(stderr, "x_cgo_bindm called\n");
+	abort();
+}
+
 void
 x_cgo_sys_thread_create(void (*func)(void*), void* arg) {
 	uintptr_t thandle;
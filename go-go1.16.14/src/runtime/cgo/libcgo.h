@@ -63,6 +63,14 @@ void _cgo_sys_thread_start(ThreadStart *ts);
  */
 uintptr_t _cgo_wait_runtime_init_done(void);
 
+/*
+ * Points to crosscall2 (asm_*.s), which calls fn, a Go function, from
+ * C, with argument frame a. A nil fn releases the m bound to the
+ * current thread, whose g0 is a, instead. Set at init by callbacks.go,
+ * as C code in this package can't refer to crosscall2 directly.
+ */
+extern void (*x_crosscall2_ptr)(void (*fn)(void *), void *a, int c, uintptr_t ctxt);
+
 /*
  * Call fn in the 6c world.
  */
@@ -204,6 +204,22 @@ func cgocallbackg(fn, frame unsafe.Pointer, ctxt uintptr) {
 		exit(2)
 	}
 
+	if mp := gp.m; mp.isExtraInC {
+		// mp stayed bound to this C thread when an earlier call
+		// into Go returned (see dropm), with gp dead. Do what needm
+		// would have: bring gp back, and set the g0 stack bounds
+		// to match the current stack, which may not be where the
+		// thread called in from last time.
+		mp.isExtraInC = false
+		g0 := mp.g0
+		sp := g0.sched.sp // set by cgocallback
+		g0.stack.hi = sp + 1024
+		g0.stack.lo = sp - 32*1024
+		g0.stackguard0 = g0.stack.lo + _StackGuard
+		casgstatus(gp, _Gdead, _Gsyscall)
+		atomic.Xadd(&sched.ngsys, -1)
+	}
+
 	// The call from C is on gp.m's g0 stack, so we must ensure
 	// that we stay on that M. We have to do this before calling
 	// exitsyscall, since it would otherwise be free to move us to
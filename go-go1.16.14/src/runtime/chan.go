@@ -343,7 +343,7 @@ func send(c *hchan, sg *sudog, ep unsafe.Pointer, unlockf func(), skip int) {
 	if sg.releasetime != 0 {      // 注释：如果存在释放时间
 		sg.releasetime = cputicks() // 注释：设置CPU的频率（每毫秒）；blockevent阻塞监听的时间是当前值减去当时的cputicks()值
 	}
-	goready(gp, skip+1) // 注释：把读取阻塞的G拿出来，放到下一个准备执行的G位置上
+	goreadyHandoff(gp, skip+1) // 注释：把读取阻塞的G拿出来，放到下一个准备执行的G位置上
 }
 
 // Sends and receives on unbuffered or empty-buffered channels are the
@@ -701,7 +701,7 @@ func recv(c *hchan, sg *sudog, ep unsafe.Pointer, unlockf func(), skip int) {
 	if sg.releasetime != 0 {
 		sg.releasetime = cputicks()
 	}
-	goready(gp, skip+1) // 注释：(准备下一个要执行G，并且开启一个空闲M跑空闲P)把gp放到skip+1个位置上等待执行
+	goreadyHandoff(gp, skip+1) // 注释：(准备下一个要执行G，并且开启一个空闲M跑空闲P)把gp放到skip+1个位置上等待执行
 }
 
 // 注释：暂停的管道(管道读取队列（c.recvq）或写入队列（c.sendq里）)被唤醒时执行
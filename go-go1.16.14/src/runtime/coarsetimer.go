@@ -0,0 +1,347 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Coarse timers.
+//
+// AfterFuncCoarse timers are for timeouts that rarely fire and need
+// not fire on time, such as idle connection timeouts. Rather than
+// going in the Ps' timer heaps, where every start, stop and reset is
+// a heap operation under a P's timersLock and the timers are looked
+// at by checkTimers in every scheduling round, they are kept in a
+// single hashed timing wheel of coarseTimerSlots slots, each covering
+// coarseTimerTick nanoseconds. Timers due beyond the wheel wait on an
+// overflow list. Starting, stopping and resetting a coarse timer are
+// constant time list operations.
+//
+// sysmon services the wheel: when the earliest slot that holds timers
+// is due, it wakes a runtime goroutine that moves the timers in the
+// due slots to a list of expired timers and starts a goroutine for
+// each of them. timeSleepUntil reports the next due slot, so that
+// sysmon wakes up for it even when all Ps are idle.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"runtime/internal/sys"
+	"unsafe"
+)
+
+const (
+	coarseTimerTick  = 10 * 1000 * 1000 // 10ms
+	coarseTimerSlots = 1024
+
+	// Lists in coarseTimers.lists other than the wheel's slots.
+	coarseTimerOverflow = coarseTimerSlots     // timers due beyond the wheel
+	coarseTimerExpired  = coarseTimerSlots + 1 // timers waiting to be run
+)
+
+// coarseTimers holds all pending coarse timers.
+var coarseTimers coarseTimerState
+
+type coarseTimerState struct {
+	lock    mutex
+	g       *g     // goroutine that runs expired timers
+	idle    uint32 // g is parked waiting for sysmon; accessed atomically
+	started bool   // g has been started
+
+	// next is the time when sysmon must wake g, or 0 if there are
+	// no pending timers. It may be early. Accessed atomically.
+	next uint64
+
+	tick         int64                         // last tick moved to expired
+	overflowScan int64                         // tick at which to look at the overflow list, or 0
+	used         [coarseTimerSlots / 64]uint64 // bit i set if lists[i] is not empty
+	lists        [coarseTimerSlots + 2]*CoarseTimer
+}
+
+// scheduleOverflowScan makes sure that the overflow list is looked at
+// in time to move a timer due at tick to the wheel. Scans are at least
+// half the wheel apart, so that each overflow timer is looked at only
+// once for every coarseTimerSlots/2 ticks.
+// coarseTimers.lock must be held.
+func (c *coarseTimerState) scheduleOverflowScan(tick int64) {
+	scan := tick - coarseTimerSlots + 1
+	if min := c.tick + coarseTimerSlots/2; scan < min {
+		scan = min
+	}
+	if c.overflowScan == 0 || scan < c.overflowScan {
+		c.overflowScan = scan
+	}
+}
+
+// A CoarseTimer is a timer started by AfterFuncCoarse.
+type CoarseTimer struct {
+	f          func()
+	tick       int64        // tick at which the timer expires
+	list       int32        // index in coarseTimers.lists, or -1 if not pending
+	next, prev *CoarseTimer // links in coarseTimers.lists[list]
+}
+
+// AfterFuncCoarse waits for at least ns nanoseconds and then calls f
+// in its own goroutine. It returns a CoarseTimer that can be used to
+// cancel the call using its Stop method.
+//
+// AfterFuncCoarse is like the time package's AfterFunc but trades
+// precision for cost: f may be called tens of milliseconds late, or
+// later if the program is busy, but starting, stopping and resetting
+// the timer are cheaper and the timer does not add to the work the
+// scheduler does to run precise timers. This suits timeouts, such as
+// idle connection timeouts, that are reset often and rarely fire.
+func AfterFuncCoarse(ns int64, f func()) *CoarseTimer {
+	if f == nil {
+		panic(plainError("runtime: AfterFuncCoarse with nil func"))
+	}
+	t := &CoarseTimer{f: f, list: -1}
+	t.start(ns)
+	return t
+}
+
+// Stop prevents the timer from firing. It returns true if the call
+// stops the timer, false if the timer has already expired or been
+// stopped. Stop does not wait for f to complete.
+func (t *CoarseTimer) Stop() bool {
+	lock(&coarseTimers.lock)
+	pending := t.list >= 0
+	if pending {
+		t.unlink()
+	}
+	unlock(&coarseTimers.lock)
+	return pending
+}
+
+// Reset changes the timer to expire after at least ns nanoseconds,
+// starting it again if it has expired or been stopped. It returns true
+// if the timer had been pending.
+func (t *CoarseTimer) Reset(ns int64) bool {
+	if t.f == nil {
+		panic(plainError("runtime: Reset called on uninitialized CoarseTimer"))
+	}
+	return t.start(ns)
+}
+
+// start makes t expire ns nanoseconds from now, and reports whether it
+// was pending.
+func (t *CoarseTimer) start(ns int64) bool {
+	if ns < 0 {
+		ns = 0
+	}
+	when := nanotime() + ns
+	if when < 0 {
+		// Overflow.
+		when = maxWhen
+	}
+	tick := when/coarseTimerTick + 1
+	if raceenabled {
+		racerelease(unsafe.Pointer(t))
+	}
+
+	lock(&coarseTimers.lock)
+	pending := t.list >= 0
+	if pending {
+		t.unlink()
+	}
+	start := !coarseTimers.started
+	if start {
+		coarseTimers.started = true
+		coarseTimers.tick = nanotime() / coarseTimerTick
+	}
+	if tick <= coarseTimers.tick {
+		tick = coarseTimers.tick + 1
+	}
+	t.tick = tick
+	if tick-coarseTimers.tick < coarseTimerSlots {
+		t.link(int32(tick % coarseTimerSlots))
+	} else {
+		t.link(coarseTimerOverflow)
+		coarseTimers.scheduleOverflowScan(tick)
+		tick = coarseTimers.overflowScan
+	}
+	next := int64(atomic.Load64(&coarseTimers.next))
+	earlier := next == 0 || tick*coarseTimerTick < next
+	if earlier {
+		atomic.Store64(&coarseTimers.next, uint64(tick*coarseTimerTick))
+	}
+	unlock(&coarseTimers.lock)
+
+	if start {
+		go coarseTimerProc()
+	}
+	if GOARCH == "wasm" && earlier && atomic.Cas(&coarseTimers.idle, 1, 0) {
+		goready(coarseTimers.g, 0)
+	}
+	if earlier && atomic.Load(&sched.sysmonwait) != 0 {
+		// sysmon may be asleep until after the timer is due.
+		lock(&sched.lock)
+		if atomic.Load(&sched.sysmonwait) != 0 {
+			atomic.Store(&sched.sysmonwait, 0)
+			notewakeup(&sched.sysmonnote)
+		}
+		unlock(&sched.lock)
+	}
+	return pending
+}
+
+// link adds t to the list coarseTimers.lists[list].
+// coarseTimers.lock must be held.
+func (t *CoarseTimer) link(list int32) {
+	head := coarseTimers.lists[list]
+	t.list = list
+	t.prev = nil
+	t.next = head
+	if head != nil {
+		head.prev = t
+	}
+	coarseTimers.lists[list] = t
+	if list < coarseTimerSlots {
+		coarseTimers.used[list/64] |= 1 << (list % 64)
+	}
+}
+
+// unlink removes t from the list it is on.
+// coarseTimers.lock must be held.
+func (t *CoarseTimer) unlink() {
+	list := t.list
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		coarseTimers.lists[list] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.next, t.prev = nil, nil
+	t.list = -1
+	if list < coarseTimerSlots && coarseTimers.lists[list] == nil {
+		coarseTimers.used[list/64] &^= 1 << (list % 64)
+	}
+}
+
+// expireCoarseTimers moves the timers due by now to the expired list,
+// moves overflow timers to the wheel if it is time, and updates
+// coarseTimers.next.
+// coarseTimers.lock must be held.
+func expireCoarseTimers(now int64) {
+	c := &coarseTimers
+	if nowTick := now / coarseTimerTick; nowTick > c.tick {
+		// The slots in use are the ones for the ticks after
+		// c.tick, so there is no need to look further than
+		// coarseTimerSlots ticks ahead.
+		last := nowTick
+		if last-c.tick > coarseTimerSlots {
+			last = c.tick + coarseTimerSlots
+		}
+		for tick := c.tick + 1; tick <= last; tick++ {
+			i := tick % coarseTimerSlots
+			if c.used[i/64]&(1<<(i%64)) == 0 {
+				continue
+			}
+			for c.lists[i] != nil {
+				t := c.lists[i]
+				t.unlink()
+				t.link(coarseTimerExpired)
+			}
+		}
+		c.tick = nowTick
+	}
+
+	if c.overflowScan != 0 && c.overflowScan <= c.tick {
+		c.overflowScan = 0
+		min := int64(0)
+		for t := c.lists[coarseTimerOverflow]; t != nil; {
+			next := t.next
+			switch {
+			case t.tick <= c.tick:
+				t.unlink()
+				t.link(coarseTimerExpired)
+			case t.tick-c.tick < coarseTimerSlots:
+				t.unlink()
+				t.link(int32(t.tick % coarseTimerSlots))
+			default:
+				if min == 0 || t.tick < min {
+					min = t.tick
+				}
+			}
+			t = next
+		}
+		if min != 0 {
+			c.scheduleOverflowScan(min)
+		}
+	}
+
+	// Find the next slot in use, looking a word of slots at a time.
+	next := int64(0)
+	for k := int64(1); k <= coarseTimerSlots; {
+		i := (c.tick + k) % coarseTimerSlots
+		bits := c.used[i/64] >> (i % 64)
+		if bits == 0 {
+			k += 64 - i%64
+			continue
+		}
+		next = (c.tick + k + int64(sys.TrailingZeros64(bits))) * coarseTimerTick
+		break
+	}
+	if c.overflowScan != 0 {
+		if w := c.overflowScan * coarseTimerTick; next == 0 || w < next {
+			next = w
+		}
+	}
+	atomic.Store64(&c.next, uint64(next))
+}
+
+// coarseTimerProc runs expired coarse timers. sysmon wakes it when the
+// next slot of the wheel is due.
+func coarseTimerProc() {
+	coarseTimers.g = getg()
+	lock(&coarseTimers.lock)
+	for {
+		if GOARCH == "wasm" && atomic.Load64(&coarseTimers.next) != 0 {
+			// There is no sysmon on wasm, so poll while
+			// timers are pending.
+			unlock(&coarseTimers.lock)
+			timeSleep(coarseTimerTick)
+			lock(&coarseTimers.lock)
+		} else {
+			gopark(coarseTimerPark, unsafe.Pointer(&coarseTimers.lock), waitReasonCoarseTimerIdle, traceEvGoBlock, 1)
+			// This goroutine is explicitly resumed by sysmon,
+			// or on wasm by start.
+			lock(&coarseTimers.lock)
+		}
+		expireCoarseTimers(nanotime())
+		for {
+			t := coarseTimers.lists[coarseTimerExpired]
+			if t == nil {
+				break
+			}
+			t.unlink()
+			f := t.f
+			unlock(&coarseTimers.lock)
+			if raceenabled {
+				raceacquire(unsafe.Pointer(t))
+			}
+			go f()
+			lock(&coarseTimers.lock)
+		}
+	}
+}
+
+// coarseTimerPark marks coarseTimers.g idle once it is parked, so that
+// it isn't readied before then, and unlocks coarseTimers.lock.
+func coarseTimerPark(gp *g, lock unsafe.Pointer) bool {
+	atomic.Store(&coarseTimers.idle, 1)
+	unlock((*mutex)(lock))
+	return true
+}
+
+// sysmonCoarseTimers wakes coarseTimers.g if a slot of the wheel is due.
+// This is only called by sysmon.
+func sysmonCoarseTimers(now int64) {
+	next := int64(atomic.Load64(&coarseTimers.next))
+	if next == 0 || next > now || !atomic.Cas(&coarseTimers.idle, 1, 0) {
+		return
+	}
+	var list gList
+	list.push(coarseTimers.g)
+	injectglist(&list)
+}
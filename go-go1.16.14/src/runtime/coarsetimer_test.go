@@ -0,0 +1,98 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitCoarse waits for c to receive the time at which a coarse timer
+// started at start fired, and checks that it was at least d later.
+func waitCoarse(t *testing.T, c chan time.Time, start time.Time, d time.Duration) {
+	t.Helper()
+	select {
+	case fired := <-c:
+		if elapsed := fired.Sub(start); elapsed < d {
+			t.Errorf("timer fired after %v, want at least %v", elapsed, d)
+		}
+	case <-time.After(d + 10*time.Second):
+		t.Fatalf("timer did not fire")
+	}
+}
+
+func TestAfterFuncCoarse(t *testing.T) {
+	c := make(chan time.Time, 1)
+	start := time.Now()
+	runtime.AfterFuncCoarse(int64(50*time.Millisecond), func() {
+		c <- time.Now()
+	})
+	waitCoarse(t, c, start, 50*time.Millisecond)
+}
+
+func TestAfterFuncCoarseStop(t *testing.T) {
+	c := make(chan time.Time, 1)
+	tm := runtime.AfterFuncCoarse(int64(20*time.Millisecond), func() {
+		c <- time.Now()
+	})
+	if !tm.Stop() {
+		t.Fatalf("Stop of pending timer returned false")
+	}
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-c:
+		t.Fatalf("stopped timer fired")
+	default:
+	}
+	if tm.Stop() {
+		t.Errorf("second Stop returned true")
+	}
+}
+
+func TestAfterFuncCoarseReset(t *testing.T) {
+	c := make(chan time.Time, 1)
+	tm := runtime.AfterFuncCoarse(int64(time.Hour), func() {
+		c <- time.Now()
+	})
+	start := time.Now()
+	if !tm.Reset(int64(20 * time.Millisecond)) {
+		t.Errorf("Reset of pending timer returned false")
+	}
+	waitCoarse(t, c, start, 20*time.Millisecond)
+
+	// Reset starts an expired timer again.
+	start = time.Now()
+	if tm.Reset(int64(20 * time.Millisecond)) {
+		t.Errorf("Reset of expired timer returned true")
+	}
+	waitCoarse(t, c, start, 20*time.Millisecond)
+}
+
+func TestAfterFuncCoarseOverflow(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	// Long enough to start out beyond the timing wheel.
+	const d = 11 * time.Second
+	c := make(chan time.Time, 1)
+	start := time.Now()
+	runtime.AfterFuncCoarse(int64(d), func() {
+		c <- time.Now()
+	})
+	stopped := runtime.AfterFuncCoarse(int64(d), func() {
+		t.Errorf("stopped timer fired")
+	})
+	stopped.Stop()
+	waitCoarse(t, c, start, d)
+}
+
+func TestCoarseTimerOnly(t *testing.T) {
+	output := runTestProg(t, "testprog", "CoarseTimerOnly")
+	want := "OK\n"
+	if output != want {
+		t.Fatalf("want %s, got %s\n", want, output)
+	}
+}
@@ -175,6 +175,92 @@ func TestEnsureDropM(t *testing.T) {
 	}
 }
 
+func TestExtraMObserver(t *testing.T) {
+	t.Parallel()
+	switch runtime.GOOS {
+	case "windows", "plan9":
+		t.Skipf("skipping extra M test on %s", runtime.GOOS)
+	}
+	got := runTestProg(t, "testprogcgo", "ExtraMObserver")
+	want := "OK\n"
+	if got != want {
+		t.Errorf("expected %q, got %v", want, got)
+	}
+}
+
+func TestThreadNameExtraM(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping thread name test on %s", runtime.GOOS)
+	}
+	got := runTestProg(t, "testprogcgo", "ThreadNameExtraM")
+	want := "OK\n"
+	if got != want {
+		t.Errorf("expected %q, got %v", want, got)
+	}
+}
+
+func TestPreallocateExtraMs(t *testing.T) {
+	t.Parallel()
+	switch runtime.GOOS {
+	case "windows", "plan9":
+		t.Skipf("skipping extra M test on %s", runtime.GOOS)
+	}
+	for _, test := range []struct {
+		name string
+		env  []string
+	}{
+		{"PreallocateExtraMs", nil},
+		{"PreallocateExtraMsGODEBUG", []string{"GODEBUG=extram=9"}},
+	} {
+		got := runTestProg(t, "testprogcgo", test.name, test.env...)
+		want := "OK\n"
+		if got != want {
+			t.Errorf("%s: expected %q, got %v", test.name, want, got)
+		}
+	}
+}
+
+func TestBindM(t *testing.T) {
+	t.Parallel()
+	switch runtime.GOOS {
+	case "windows", "plan9":
+		t.Skipf("skipping extra M test on %s", runtime.GOOS)
+	}
+	got := runTestProg(t, "testprogcgo", "BindM")
+	want := "OK\n"
+	if got != want {
+		t.Errorf("expected %q, got %v", want, got)
+	}
+}
+
+func TestBindMSegv(t *testing.T) {
+	t.Parallel()
+	switch runtime.GOOS {
+	case "windows", "plan9":
+		t.Skipf("skipping extra M test on %s", runtime.GOOS)
+	}
+	got := runTestProg(t, "testprogcgo", "BindMSegv", "BINDM_SEGV_HANDLER=1")
+	want := "OK\n"
+	if got != want {
+		t.Errorf("expected %q, got %v", want, got)
+	}
+}
+
+func TestAllThreadsSyscallCgo(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skipf("AllThreadsSyscall is not supported on %s", runtime.GOOS)
+	}
+	for _, name := range []string{"AllThreadsSyscall", "AllThreadsSyscallSigBlocked"} {
+		got := runTestProg(t, "testprogcgo", name)
+		want := "OK\n"
+		if got != want {
+			t.Errorf("%s: expected %q, got %v", name, want, got)
+		}
+	}
+}
+
 // Test for issue 14387.
 // Test that the program that doesn't need any cgo pointer checking
 // takes about the same amount of time with it as without it.
@@ -179,6 +179,33 @@ func TestCrashHandler(t *testing.T) {
 	testCrashHandler(t, false)
 }
 
+func TestInitTrace(t *testing.T) {
+	output := runTestProg(t, "testprog", "InitTrace", "GODEBUG=inittrace=2")
+	if output != "OK\n" {
+		t.Fatalf("GODEBUG=inittrace=2: want OK, got:\n%s", output)
+	}
+	output = runTestProg(t, "testprog", "InitTrace")
+	if output != "no init records\n" {
+		t.Fatalf("without GODEBUG=inittrace: want no init records, got:\n%s", output)
+	}
+}
+
+func TestInitBudget(t *testing.T) {
+	want := "runtime: init main took "
+	output := runTestProg(t, "testprog", "InitTrace", "GODEBUG=initbudget=10", "TESTPROG_SLOW_INIT=1")
+	if !strings.Contains(output, want) || !strings.HasSuffix(output, "no init records\n") {
+		t.Fatalf("GODEBUG=initbudget=10: want warning and normal run, got:\n%s", output)
+	}
+	output = runTestProg(t, "testprog", "InitTrace", "GODEBUG=initbudget=10,initbudgetthrow=1", "TESTPROG_SLOW_INIT=1")
+	if !strings.Contains(output, want) || !strings.Contains(output, "fatal error: package initialization over budget") {
+		t.Fatalf("GODEBUG=initbudgetthrow=1: want fatal error, got:\n%s", output)
+	}
+	output = runTestProg(t, "testprog", "InitTrace", "GODEBUG=initbudget=10000", "TESTPROG_SLOW_INIT=1")
+	if strings.Contains(output, want) {
+		t.Fatalf("GODEBUG=initbudget=10000: unexpected warning:\n%s", output)
+	}
+}
+
 func testDeadlock(t *testing.T, name string) {
 	// External linking brings in cgo, causing deadlock detection not working.
 	testenv.MustInternalLink(t)
@@ -206,6 +233,29 @@ func TestLockedDeadlock2(t *testing.T) {
 	testDeadlock(t, "LockedDeadlock2")
 }
 
+func TestDeadlockSummary(t *testing.T) {
+	// External linking brings in cgo, causing deadlock detection not working.
+	testenv.MustInternalLink(t)
+
+	output := runTestProg(t, "testprog", "DeadlockSummary")
+	var addr string
+	if _, err := fmt.Sscanf(output, "chan %s\n", &addr); err != nil {
+		t.Fatalf("no channel address in output:\n%s", output)
+	}
+	for _, want := range []string{
+		"fatal error: all goroutines are asleep - deadlock!\n\nblocked goroutines: 5\n",
+		"\t4 [chan receive]\n",
+		"\t1 [semacquire]\n",
+		"blocked on channels:\n\t3 on " + addr + "\n\t1 on 0x",
+		"created by:\n\t3 by main.DeadlockSummary\n",
+		"\t1 by main.deadlockSummaryLock\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
 func TestGoexitDeadlock(t *testing.T) {
 	// External linking brings in cgo, causing deadlock detection not working.
 	testenv.MustInternalLink(t)
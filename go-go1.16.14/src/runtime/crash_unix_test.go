@@ -298,6 +298,38 @@ func TestSignalExitStatus(t *testing.T) {
 	}
 }
 
+func TestSignalPreHandler(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on %s", runtime.GOOS)
+	}
+	output := runTestProg(t, "testprog", "SignalPreHandler")
+	want := "OK\n"
+	if output != want {
+		t.Fatalf("want %s, got %s\n", want, output)
+	}
+}
+
+func TestSetCrashHandler(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("skipping on %s", runtime.GOOS)
+	}
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"CrashHandlerThrow", "crash handler: all goroutines are asleep - deadlock!\n"},
+		{"CrashHandlerPanic", "crash handler: boom (panic)\n"},
+		{"CrashHandlerSignal", "crash handler: SIGQUIT: quit (SIGQUIT)\n"},
+	} {
+		output := runTestProg(t, "testprog", test.name)
+		if !strings.Contains(output, test.want) {
+			t.Errorf("%s: output does not contain %q:\n%s", test.name, test.want, output)
+		}
+		if n := strings.Count(output, "crash handler:"); n != 1 {
+			t.Errorf("%s: crash handler called %d times, want 1", test.name, n)
+		}
+	}
+}
+
 func TestSignalIgnoreSIGTRAP(t *testing.T) {
 	if runtime.GOOS == "openbsd" {
 		if bn := testenv.Builder(); strings.HasSuffix(bn, "-62") || strings.HasSuffix(bn, "-64") {
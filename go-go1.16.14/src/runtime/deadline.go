@@ -0,0 +1,222 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Goroutine deadlines.
+//
+// SetGoroutineDeadline records a deadline in the goroutine's g and
+// arms it. Once the deadline has passed, the goroutine is made to call
+// Goexit at its next synchronous safe point, a function prologue, the
+// way a preempted goroutine is descheduled there:
+//
+// - sysmon looks at the goroutines running on the Ps and, for one past
+//   its deadline, marks the deadline exceeded and preempts it.
+//
+// - execute marks the deadline of a goroutine about to run exceeded if
+//   it has passed, which covers goroutines that were blocked or
+//   runnable, and requests synchronous preemption of a goroutine whose
+//   deadline is exceeded, since the preemption request is cleared
+//   whenever a goroutine is descheduled.
+//
+// - newstack, when it finds a goroutine with an exceeded deadline at a
+//   preemption point, points the goroutine's saved PC at goexitDeadline
+//   instead of the function whose prologue it is in. The goroutine then
+//   returns to that function's caller as if the caller had called
+//   goexitDeadline instead.
+//
+// newstack doesn't make a goroutine exit while runtime code, or code
+// of a few other packages, is on its stack. It then marks the deadline
+// deferred and lets the goroutine run on, and sysmon preempts it again
+// later, if it is still running, to try once more. execute doesn't
+// request preemption for a deferred deadline, which would only bring
+// the goroutine back to the same function prologue.
+//
+// sysmon only reads the deadline, which the goroutine may change while
+// sysmon looks at it, so newstack and execute check it again before
+// acting on it.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"unsafe"
+)
+
+// Values of g.deadlineState.
+const (
+	gDeadlineNone     = iota // no deadline
+	gDeadlineArmed           // g.deadline is set
+	gDeadlineExceeded        // g.deadline has passed; exit at the next safe point
+	gDeadlineExit            // the goroutine is exiting because of its deadline
+	gDeadlineDeferred        // g.deadline has passed, but the goroutine couldn't exit at its last safe point
+)
+
+// deadlinesUsed is set once SetGoroutineDeadline has been called, so
+// that sysmon can skip looking for goroutines past their deadlines.
+var deadlinesUsed uint32
+
+// SetGoroutineDeadline arranges for the calling goroutine to exit, as
+// if it called Goexit, once ns nanoseconds have passed, replacing any
+// deadline set before. The goroutine's deferred calls run as they do
+// for Goexit.
+//
+// The goroutine exits the next time it calls a function after the
+// deadline, or after it next wakes up if it is blocked then. It does
+// not exit while it runs code of the runtime, the sync and syscall
+// packages or internal packages, nor while it runs code called by
+// them, such as a function passed to sync.Once.Do, but it may exit in
+// the middle of any other code, leaving the data it was working on as it was. Code
+// run with a deadline should therefore release locks and other
+// resources with deferred calls. Small functions that call no others
+// don't check for preemption, so a loop that calls only such functions,
+// or none, does not end at the deadline. If the main goroutine exits,
+// the program keeps running until the other goroutines exit, as with
+// Goexit.
+//
+// Goroutines that the runtime runs user code on, such as the goroutine
+// that runs finalizers, and goroutines running a call from C to Go
+// can't be given a deadline: for them SetGoroutineDeadline does
+// nothing.
+//
+// SetGoroutineDeadline is experimental. It is meant for stopping
+// runaway work that can't check a context.Context, such as plug-ins,
+// when stopping the whole program is not an option.
+func SetGoroutineDeadline(ns int64) {
+	gp := getg()
+	if gp == fing || isSystemGoroutine(gp, false) || gp.m.isextra || gp.m.ncgo > 0 {
+		return
+	}
+	when := nanotime() + ns
+	if ns < 0 {
+		when = nanotime()
+	} else if when < 0 {
+		// Overflow.
+		when = maxWhen
+	}
+	// Disarm the deadline while it changes, since sysmon may be
+	// reading it.
+	atomic.Store(&gp.deadlineState, gDeadlineNone)
+	gp.deadline = when
+	atomic.Store(&gp.deadlineState, gDeadlineArmed)
+	if atomic.Load(&deadlinesUsed) == 0 {
+		atomic.Store(&deadlinesUsed, 1)
+	}
+}
+
+// ClearGoroutineDeadline removes the deadline set for the calling
+// goroutine by SetGoroutineDeadline, if any.
+func ClearGoroutineDeadline() {
+	gp := getg()
+	atomic.Store(&gp.deadlineState, gDeadlineNone)
+	gp.deadline = 0
+}
+
+// checkDeadline marks the deadline of gp, which is about to run,
+// exceeded if it has passed, and, if it is exceeded, requests
+// synchronous preemption of gp so that newstack can make it exit.
+func checkDeadline(gp *g) {
+	switch atomic.Load(&gp.deadlineState) {
+	case gDeadlineArmed:
+		if nanotime() < gp.deadline || !atomic.Cas(&gp.deadlineState, gDeadlineArmed, gDeadlineExceeded) {
+			return
+		}
+	case gDeadlineExceeded:
+	default:
+		return
+	}
+	gp.preempt = true
+	gp.stackguard0 = stackPreempt
+}
+
+// sysmonDeadlines preempts the goroutines running past their deadlines,
+// including ones that couldn't exit at their last safe point.
+//
+//go:nowritebarrierrec
+func sysmonDeadlines(now int64) {
+	if atomic.Load(&deadlinesUsed) == 0 {
+		return
+	}
+	lock(&allpLock)
+	for i := 0; i < len(allp); i++ {
+		pp := allp[i]
+		if pp == nil {
+			continue
+		}
+		if s := pp.status; s != _Prunning && s != _Psyscall {
+			continue
+		}
+		mp := pp.m.ptr()
+		if mp == nil {
+			continue
+		}
+		gp := mp.curg
+		if gp == nil {
+			continue
+		}
+		switch atomic.Load(&gp.deadlineState) {
+		case gDeadlineArmed:
+			if gp.deadline <= now && atomic.Cas(&gp.deadlineState, gDeadlineArmed, gDeadlineExceeded) {
+				preemptone(pp)
+			}
+		case gDeadlineDeferred:
+			if atomic.Cas(&gp.deadlineState, gDeadlineDeferred, gDeadlineExceeded) {
+				preemptone(pp)
+			}
+		}
+	}
+	unlock(&allpLock)
+}
+
+// deadlineExit reports whether gp, which is at a preemption point at the
+// start of a function, must exit because of its deadline.
+func deadlineExit(gp *g) bool {
+	if atomic.Load(&gp.deadlineState) != gDeadlineExceeded {
+		return false
+	}
+	if nanotime() < gp.deadline {
+		// sysmon read the deadline as it changed.
+		atomic.Cas(&gp.deadlineState, gDeadlineExceeded, gDeadlineArmed)
+		return false
+	}
+	// Look at every frame on the stack, not just the function whose
+	// prologue gp is in: a function called by the runtime, such as a
+	// finalizer or a cgo callback, can't exit without unwinding the
+	// runtime's frames too.
+	protected := false
+	gentraceback(^uintptr(0), ^uintptr(0), 0, gp, 0, nil, 0x7fffffff, deadlineFrame, noescape(unsafe.Pointer(&protected)), 0)
+	if protected {
+		atomic.Cas(&gp.deadlineState, gDeadlineExceeded, gDeadlineDeferred)
+		return false
+	}
+	return atomic.Cas(&gp.deadlineState, gDeadlineExceeded, gDeadlineExit)
+}
+
+// deadlineFrame is the gentraceback callback of deadlineExit. It sets
+// *protected and stops the traceback if frame is in a function that
+// must not be unwound by a deadline exit.
+func deadlineFrame(frame *stkframe, protected unsafe.Pointer) bool {
+	f := frame.fn
+	if f.funcID == funcID_goexit {
+		return true
+	}
+	// Callers of these packages' functions may be in the middle of
+	// updating shared state.
+	name := funcname(f)
+	if hasPrefix(name, "internal/") {
+		*(*bool)(protected) = true
+		return false
+	}
+	for _, pkg := range [...]string{"runtime", "sync", "syscall"} {
+		if len(name) > len(pkg) && hasPrefix(name, pkg) && (name[len(pkg)] == '.' || name[len(pkg)] == '/') {
+			*(*bool)(protected) = true
+			return false
+		}
+	}
+	return true
+}
+
+// goexitDeadline is called, in place of the function it was about to
+// call, by a goroutine whose deadline has passed. See newstack.
+func goexitDeadline() {
+	Goexit()
+}
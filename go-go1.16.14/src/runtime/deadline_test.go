@@ -0,0 +1,178 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// deadlineWork calls another function so that, unlike a small leaf
+// function, it has a preemption check in its prologue.
+//
+//go:noinline
+func deadlineWork(n *uint64) {
+	deadlineAdd(n)
+}
+
+//go:noinline
+func deadlineAdd(n *uint64) {
+	atomic.AddUint64(n, 1)
+}
+
+// deadlineExitReason waits for the exit of goroutine id to be recorded
+// and returns its reason.
+func deadlineExitReason(t *testing.T, id int64) runtime.GoroutineExitReason {
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		for _, e := range runtime.LastGoroutineExits() {
+			if e.Goid == id {
+				return e.Reason
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("exit of goroutine %d not recorded", id)
+	return 0
+}
+
+func TestGoroutineDeadlineRunning(t *testing.T) {
+	var n uint64
+	ids := make(chan int64, 1)
+	deferred := make(chan bool)
+	start := time.Now()
+	go func() {
+		defer close(deferred)
+		ids <- runtime.Goid()
+		runtime.SetGoroutineDeadline(int64(20 * time.Millisecond))
+		for {
+			deadlineWork(&n)
+		}
+	}()
+	id := <-ids
+	select {
+	case <-deferred:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("goroutine still running 10s after its deadline")
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("goroutine exited after %v, before its deadline", d)
+	}
+	if r := deadlineExitReason(t, id); r != runtime.GoroutineExitDeadline {
+		t.Errorf("goroutine exited with reason %v, want %v", r, runtime.GoroutineExitDeadline)
+	}
+	if atomic.LoadUint64(&n) == 0 {
+		t.Errorf("goroutine did no work before its deadline")
+	}
+}
+
+func TestGoroutineDeadlineBlocked(t *testing.T) {
+	var n uint64
+	ids := make(chan int64, 1)
+	c := make(chan bool)
+	deferred := make(chan bool)
+	go func() {
+		defer close(deferred)
+		ids <- runtime.Goid()
+		runtime.SetGoroutineDeadline(int64(10 * time.Millisecond))
+		<-c
+		deadlineWork(&n)
+	}()
+	id := <-ids
+	time.Sleep(50 * time.Millisecond)
+	c <- true
+	<-deferred
+	if r := deadlineExitReason(t, id); r != runtime.GoroutineExitDeadline {
+		t.Errorf("goroutine exited with reason %v, want %v", r, runtime.GoroutineExitDeadline)
+	}
+	if atomic.LoadUint64(&n) != 0 {
+		t.Errorf("goroutine kept running after it woke up past its deadline")
+	}
+}
+
+func TestClearGoroutineDeadline(t *testing.T) {
+	var n uint64
+	ids := make(chan int64, 1)
+	go func() {
+		ids <- runtime.Goid()
+		runtime.SetGoroutineDeadline(int64(10 * time.Millisecond))
+		runtime.ClearGoroutineDeadline()
+		for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+			deadlineWork(&n)
+		}
+	}()
+	id := <-ids
+	if r := deadlineExitReason(t, id); r != runtime.GoroutineExitReturn {
+		t.Errorf("goroutine exited with reason %v, want %v", r, runtime.GoroutineExitReturn)
+	}
+}
+
+type deadlineObj struct {
+	p *int
+	x [16]byte
+}
+
+func TestGoroutineDeadlineFinalizer(t *testing.T) {
+	// Finalizers run on a goroutine of the runtime, which must not
+	// exit when a finalizer sets a deadline.
+	finalize := func(f func()) {
+		done := make(chan bool, 1)
+		runtime.SetFinalizer(new(deadlineObj), func(*deadlineObj) {
+			f()
+			done <- true
+		})
+		for start := time.Now(); time.Since(start) < 10*time.Second; {
+			runtime.GC()
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		t.Fatalf("finalizer did not run")
+	}
+	var n uint64
+	finalize(func() {
+		runtime.SetGoroutineDeadline(int64(time.Millisecond))
+		for start := time.Now(); time.Since(start) < 20*time.Millisecond; {
+			deadlineWork(&n)
+		}
+	})
+	finalize(func() {})
+}
+
+func TestGoroutineDeadlineOnce(t *testing.T) {
+	var n, after uint64
+	var once sync.Once
+	deferred := make(chan bool)
+	go func() {
+		defer close(deferred)
+		runtime.SetGoroutineDeadline(int64(time.Millisecond))
+		once.Do(func() {
+			for start := time.Now(); time.Since(start) < 20*time.Millisecond; {
+				deadlineWork(&n)
+			}
+		})
+		for {
+			deadlineWork(&after)
+		}
+	}()
+	<-deferred
+	if atomic.LoadUint64(&n) == 0 {
+		t.Fatalf("function run by sync.Once.Do did no work")
+	}
+	if !testOnceDone(&once) {
+		t.Errorf("sync.Once.Do was unwound by the deadline")
+	}
+}
+
+// testOnceDone reports whether once has completed a call to Do.
+func testOnceDone(once *sync.Once) bool {
+	done := true
+	once.Do(func() { done = false })
+	return done
+}
@@ -17,6 +17,10 @@ func GOMAXPROCS(n int) int {
 	if GOARCH == "wasm" && n > 1 {
 		n = 1 // WebAssembly has no threads yet, so only one CPU is possible.
 	}
+	if n > 0 {
+		// The program manages GOMAXPROCS itself from now on.
+		atomic.Store(&autoProcs.off, 1)
+	}
 
 	lock(&sched.lock)
 	ret := int(gomaxprocs)
@@ -34,6 +38,23 @@ func GOMAXPROCS(n int) int {
 	return ret
 }
 
+// procResizeObserver, if non-nil, is called by procresize whenever the
+// number of Ps changes.
+var procResizeObserver func(old, new int32)
+
+// SetProcResizeObserver arranges for fn to be called each time the
+// number of Ps changes, for example in response to a call to GOMAXPROCS.
+// fn is passed the old and the new number of Ps.
+//
+// fn is called while the world is stopped and with scheduler locks held,
+// on a system stack. It must not allocate, block or call back into the
+// runtime; typically it should do nothing more than record the new value
+// or set a flag for an ordinary goroutine to act upon later.
+// Passing nil removes the observer.
+func SetProcResizeObserver(fn func(old, new int32)) {
+	procResizeObserver = fn
+}
+
 // NumCPU returns the number of logical CPUs usable by the current process.
 //
 // The set of available CPUs is checked by querying the operating system
@@ -57,6 +78,34 @@ func NumGoroutine() int {
 	return int(gcount())
 }
 
+// NumSpinningThreads returns the number of operating system threads
+// that are looking for goroutines to run, having found none in their
+// own processor's run queue.
+//
+// NumSpinningThreads, NumIdleProcs and NumIdleThreads read the
+// scheduler's counters without locking it, so they may not agree with
+// each other, and are out of date as soon as they return. They are
+// meant for sampling, for example by an autoscaler: processors that
+// are never idle suggest a program that needs more CPU, while idle
+// processors and threads that are often spinning suggest one that has
+// more than it can use.
+func NumSpinningThreads() int {
+	return int(atomic.Load(&sched.nmspinning))
+}
+
+// NumIdleProcs returns the number of processors, out of the
+// GOMAXPROCS that may run Go code at once, that have no goroutine to
+// run. See NumSpinningThreads.
+func NumIdleProcs() int {
+	return int(atomic.Load(&sched.npidle))
+}
+
+// NumIdleThreads returns the number of operating system threads that
+// are parked waiting for work. See NumSpinningThreads.
+func NumIdleThreads() int {
+	return int(int32(atomic.Load((*uint32)(unsafe.Pointer(&sched.nmidle)))))
+}
+
 //go:linkname debug_modinfo runtime/debug.modinfo
 func debug_modinfo() string {
 	return modinfo
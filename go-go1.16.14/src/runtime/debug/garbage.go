@@ -100,6 +100,170 @@ func FreeOSMemory() {
 	freeOSMemory()
 }
 
+// FlushMCaches empties the caches of memory each processor keeps so it
+// can allocate without locking: the spans of heap memory it allocates
+// small objects from, and the free goroutine stacks. It returns the
+// bytes of free objects in the spans and the bytes of free stacks
+// returned to the shared pools.
+//
+// Processors refill their caches as they allocate, and a garbage
+// collection empties them anyway, so FlushMCaches is only useful in
+// a program that has gone idle after a burst of work: it makes the
+// memory held for processors that are no longer allocating available
+// to the rest of the program, and free stack memory available to be
+// returned to the operating system, without a garbage collection.
+func FlushMCaches() (spanBytes, stackBytes uint64) {
+	return flushMCaches()
+}
+
+// SetMemoryLimit provides the runtime with a soft limit on the memory
+// it uses, in bytes, and returns the previous limit. A negative limit
+// leaves the limit unchanged, so SetMemoryLimit(-1) just reports it.
+// The initial setting is math.MaxInt64, meaning no limit.
+//
+// The limit counts all memory the runtime has mapped and not returned
+// to the operating system: the heap, goroutine stacks and runtime
+// metadata. It does not count memory mapped by C code, by the
+// operating system on the program's behalf, or by the program
+// itself, for example with syscall.Mmap.
+//
+// To respect the limit, the runtime triggers garbage collections
+// earlier than SetGCPercent alone would, returns free memory to the
+// operating system more eagerly, and forces a collection when the
+// limit is exceeded. The limit applies even if garbage collection is
+// otherwise disabled with SetGCPercent(-1), which makes it possible to
+// collect only when memory runs short. The limit is soft: a program
+// whose live heap does not fit will exceed it, and will spend more
+// time collecting garbage the closer it is to the limit.
+func SetMemoryLimit(limit int64) int64 {
+	return setMemoryLimit(limit)
+}
+
+// SetGCCPUFraction sets the fraction of the available CPU (GOMAXPROCS)
+// the garbage collector's background workers aim to use while marking
+// concurrently, and returns the previous setting. The initial setting
+// is 0.25. A fraction of 0 or less leaves the setting unchanged, so
+// SetGCCPUFraction(0) just reports it. SetGCCPUFraction panics if f is
+// greater than 1 or NaN. The new setting takes effect at the start of
+// the next collection.
+//
+// A larger fraction finishes marking sooner, so a batch job with no
+// latency requirements can give more CPU to the collector in exchange
+// for less heap growth during marking and fewer allocating goroutines
+// drafted into assisting it. A smaller fraction leaves more CPU to
+// goroutines during marking, though they may have to assist more if
+// the background workers fall behind. A limit set with
+// runtime.SetGCCPUFractionLimit still caps the fraction.
+func SetGCCPUFraction(f float64) float64 {
+	if f > 1 || f != f {
+		panic("runtime/debug: SetGCCPUFraction called with fraction greater than 1 or NaN")
+	}
+	return setGCCPUFraction(f)
+}
+
+// SetSweepAssistLimit caps the number of heap pages a goroutine sweeps
+// at once to pay off sweep debt when it allocates, and returns the
+// previous cap. A cap of 0, the initial setting, means no cap. A
+// negative cap leaves the cap unchanged, so SetSweepAssistLimit(-1)
+// just reports it.
+//
+// After a garbage collection, the heap is swept concurrently with the
+// program, and goroutines that allocate are charged with sweeping in
+// proportion to their allocation, so that sweeping finishes before the
+// next collection. A cap bounds the latency this adds to any single
+// allocation. Sweeping that isn't done by allocating goroutines is
+// left to the background sweeper (see SetBackgroundSweepBatch), or,
+// failing that, to the goroutine that starts the next collection.
+func SetSweepAssistLimit(pages int) int {
+	return setSweepAssistLimit(pages)
+}
+
+// SetBackgroundSweepBatch sets the number of spans the background
+// sweeper sweeps before yielding the processor to other goroutines,
+// and returns the previous setting. The initial setting is 1. Larger
+// batches let the background sweeper keep up with sweep debt that
+// SetSweepAssistLimit keeps allocating goroutines from paying, at the
+// cost of the latency of other goroutines. A batch of 0 or less leaves
+// the setting unchanged, so SetBackgroundSweepBatch(0) just reports it.
+func SetBackgroundSweepBatch(spans int) int {
+	return setBackgroundSweepBatch(spans)
+}
+
+// SetAvoidSparseSpans controls whether small object allocation prefers
+// fuller spans over sparse ones, and returns the previous setting. The
+// initial setting is false. A program whose heap has shrunk after a
+// peak can enable it so that the few objects left in sparse spans are
+// not joined by new ones; once those objects die, the garbage
+// collector frees the whole span. Use runtime.ReadFragmentation to see
+// how many spans of each size class are sparse.
+func SetAvoidSparseSpans(enable bool) bool {
+	return setAvoidSparseSpans(enable)
+}
+
+// SetPageReclaimers limits the number of goroutines that may reclaim
+// pages at once, and returns the previous limit. The initial limit is
+// 0, meaning no limit. A negative n leaves the limit unchanged, so
+// SetPageReclaimers(-1) just reports it.
+//
+// After each garbage collection, a goroutine about to allocate pages
+// for a span first frees as many pages of unreachable spans, scanning
+// the heap's page bitmaps a chunk at a time (see SetPageReclaimChunk).
+// With many goroutines allocating into a large heap, they contend for
+// the heap's lock to do so. Once the limit is reached, further
+// goroutines allocate without reclaiming, which lowers their latency
+// at the risk of growing the heap while the sweeper catches up.
+func SetPageReclaimers(n int) int {
+	return setPageReclaimers(n)
+}
+
+// SetPageReclaimChunk sets the number of pages the page reclaimer scans
+// each time it claims work, and returns the previous setting. The
+// initial setting is 512 pages. The setting is rounded down to a power
+// of two between 8 and the number of pages in a heap arena (see
+// HeapArena). A setting of 0 or less leaves it unchanged, so
+// SetPageReclaimChunk(0) just reports it.
+//
+// Larger chunks mean reclaiming goroutines claim work less often, and
+// so contend less with each other, but each scan takes longer before
+// the goroutine can allocate.
+func SetPageReclaimChunk(pages int) int {
+	return setPageReclaimChunk(pages)
+}
+
+// ReclaimStats describes the progress of the page reclaimer through the
+// current garbage collection cycle. See SetPageReclaimers.
+type ReclaimStats struct {
+	Scanned uint64 // pages scanned for unreachable spans this cycle
+	Pages   uint64 // pages to scan this cycle
+	Credit  uint64 // pages freed beyond what allocating goroutines needed
+
+	Reclaimed uint64 // pages freed by the page reclaimer since the program started
+	Active    int    // goroutines reclaiming pages now
+}
+
+// ReadReclaimStats reads the state of the page reclaimer into stats.
+// Once Scanned reaches Pages, either by the page reclaimer or because
+// sweeping finished, allocations do not reclaim pages until the next
+// garbage collection. Pages allocating goroutines freed but did not use
+// are kept as Credit for the next allocations.
+func ReadReclaimStats(stats *ReclaimStats) {
+	stats.Scanned, stats.Pages, stats.Credit, stats.Reclaimed, stats.Active = readReclaimStats()
+}
+
+// SetHeapHint asks the runtime to reserve the address space for the
+// heap's next growth at addr, rounded up to the heap's arena size. If
+// that address is unavailable, the runtime places the memory as it
+// usually would. Heap growth continues upwards from addr until the
+// runtime needs to find space elsewhere.
+//
+// SetHeapHint only affects memory the heap reserves afterwards. To
+// place the heap from program start, set the GOHEAPHINT environment
+// variable (see the runtime package documentation). Hints are
+// ignored in programs built with -race.
+func SetHeapHint(addr uintptr) {
+	setHeapHint(addr)
+}
+
 // SetMaxStack sets the maximum amount of memory that
 // can be used by a single goroutine stack.
 // If any goroutine exceeds this limit while growing its stack,
@@ -116,6 +280,25 @@ func SetMaxStack(bytes int) int {
 	return setMaxStack(bytes)
 }
 
+// ShrinkStacks shrinks the stack of every other goroutine to fit what
+// the goroutine is using, and returns the number of bytes freed. The
+// calling goroutine's stack is left alone; see runtime.ShrinkStack.
+// Goroutines whose stacks can't be moved at the moment, such as those
+// in system calls or stopped in the middle of a running function,
+// instead halve their stacks, if that leaves enough room, the next
+// time they check for preemption.
+//
+// The garbage collector shrinks stacks too, but only by half per
+// collection. ShrinkStacks lets a program that briefly needed deep
+// stacks in many goroutines, such as long-lived connection handlers,
+// return that memory promptly. The freed memory goes to the pools new
+// stacks are allocated from, which return what they don't need to the
+// heap. ShrinkStacks suspends each goroutine in turn, so it costs time
+// proportional to the number of goroutines.
+func ShrinkStacks() uint64 {
+	return shrinkStacks()
+}
+
 // SetMaxThreads sets the maximum number of operating system
 // threads that the Go program can use. If it attempts to use more than
 // this many, the program crashes.
@@ -134,6 +317,176 @@ func SetMaxThreads(threads int) int {
 	return setMaxThreads(threads)
 }
 
+// SetIdleThreadTimeout makes operating system threads that have had no
+// goroutine to run for longer than d exit, so that the number of
+// threads goes back down after a burst of work that needed many of
+// them, such as many goroutines blocked in system calls at once. A
+// duration of 0, the initial setting, keeps idle threads for reuse.
+// Threads are only made to exit while some processors (see GOMAXPROCS)
+// are idle, and the main thread never exits. SetIdleThreadTimeout
+// returns the previous setting. It has no effect on Plan 9 and
+// js/wasm.
+//
+// The runtime/metrics package reports the number of idle threads, the
+// highest number of threads so far and the number of idle threads made
+// to exit.
+func SetIdleThreadTimeout(d time.Duration) time.Duration {
+	return time.Duration(setIdleThreadTimeout(int64(d)))
+}
+
+// SetMaxGoroutines sets a limit on the number of goroutines that the
+// Go program can have. If a go statement raises the number of
+// goroutines above n, the goroutine that executed it calls onExceed
+// before it continues. If onExceed is nil, the program crashes
+// instead, as it does when it exceeds the limit set by SetMaxThreads.
+// A limit of 0, the initial setting, means no limit.
+//
+// Only one goroutine calls onExceed at a time: go statements that
+// exceed the limit while onExceed is running, including go statements
+// in onExceed itself, don't call it again. onExceed should return
+// promptly, since the goroutine that called it can't continue until it
+// does. The number of goroutines is counted approximately, so
+// onExceed may be called slightly before or after the limit is
+// reached. Goroutines that the runtime starts for itself are not
+// limited.
+//
+// SetMaxGoroutines is useful mainly as a guard against goroutine
+// leaks, reporting them or taking the program down before they
+// exhaust its memory.
+func SetMaxGoroutines(n int, onExceed func()) {
+	setMaxGoroutines(n, onExceed)
+}
+
+// SetGlobalQueueCheckInterval sets how often the scheduler takes the
+// next goroutine to run from the global run queue rather than from the
+// current processor's local run queue: once every interval scheduling
+// rounds on each processor, when both queues hold goroutines. It
+// returns the previous setting. The initial setting is 61. An interval
+// less than 1 is treated as 1, which checks the global queue first in
+// every round.
+//
+// Goroutines on the local run queues are run in preference to those
+// on the global queue, which holds, among others, goroutines that were
+// created or woken while the local queues were full and goroutines
+// returning from long system calls. A smaller interval reduces the
+// time these wait to run, at the cost of more contention on the global
+// queue's lock; a larger one favors the local queues.
+func SetGlobalQueueCheckInterval(interval int) int {
+	return setGlobalQueueCheckInterval(interval)
+}
+
+// SetSudogCacheSize sets the number of records each processor caches
+// for goroutines that block on channel operations, select statements
+// or sync primitives. It returns the previous setting. The initial
+// setting is 128. A size less than 1 restores the initial setting, and
+// a size of 1 is treated as 2.
+//
+// When a processor's cache is empty or full, it moves half of its
+// capacity's worth of records from or to a central cache shared by all
+// processors, under a lock. Programs in which many goroutines block
+// and wake at once can use a larger cache to take that lock less
+// often, at the cost of keeping more unused records; ReadSudogStats
+// reports how often it is taken.
+func SetSudogCacheSize(n int) int {
+	return setSudogCacheSize(n)
+}
+
+// SudogStats describes the records the runtime keeps for goroutines
+// blocked on channel operations, select statements and sync
+// primitives. See SetSudogCacheSize.
+type SudogStats struct {
+	Central   int    // records in the central cache
+	Allocs    uint64 // records allocated since the program started
+	Transfers uint64 // moves between a processor's cache and the central cache
+}
+
+// ReadSudogStats reads statistics about the records the runtime keeps
+// for blocked goroutines into stats. Allocs and Transfers only grow,
+// so the rates at which records are allocated and the central cache's
+// lock is taken are their differences between two calls divided by the
+// time between them. Central drops to zero at each garbage collection,
+// which frees the central cache.
+func ReadSudogStats(stats *SudogStats) {
+	stats.Central, stats.Allocs, stats.Transfers = readSudogStats()
+}
+
+// HeapArena describes one of the fixed-size, aligned regions of address
+// space the garbage-collected heap is made of. The runtime reserves
+// address space for the heap an arena at a time, 64 MB on most 64-bit
+// platforms and 4 MB elsewhere, and then adds it to the heap in smaller
+// steps as the heap grows.
+type HeapArena struct {
+	Start, End uintptr // address range of the arena
+
+	Heap   uintptr // bytes of the arena added to the heap so far
+	Zeroed uintptr // bytes from Start that have ever been allocated
+	InUse  uintptr // bytes in pages currently allocated to the heap or stacks
+
+	// LargestFree is the size in bytes of the longest run of
+	// free pages in the part of the arena added to the heap.
+	// Together with InUse, it shows how fragmented the arena is:
+	// Heap-InUse bytes are free, but only allocations of up to
+	// LargestFree bytes fit in them.
+	LargestFree uintptr
+}
+
+// HeapLayout returns the arenas making up the heap, sorted by address.
+// Adjacent arenas often form a single mapping, in which case the End of
+// one is the Start of the next.
+//
+// HeapLayout holds the heap lock while it inspects each arena's page
+// allocation bitmaps, so it is best called occasionally, not in a loop.
+func HeapLayout() []HeapArena {
+	var raw []uintptr
+	readHeapLayout(&raw)
+	const words = 6
+	arenas := make([]HeapArena, len(raw)/words)
+	for i := range arenas {
+		w := raw[i*words:]
+		arenas[i] = HeapArena{
+			Start:       w[0],
+			End:         w[1],
+			Heap:        w[2],
+			Zeroed:      w[3],
+			InUse:       w[4],
+			LargestFree: w[5],
+		}
+	}
+	sort.Slice(arenas, func(i, j int) bool {
+		return arenas[i].Start < arenas[j].Start
+	})
+	return arenas
+}
+
+// SpanAllocation describes an allocation recorded by GODEBUG=spantrace.
+type SpanAllocation struct {
+	Goroutine int64   // ID of the allocating goroutine
+	PC        uintptr // return PC into the first function outside the runtime, as from runtime.Callers
+}
+
+// SpanAllocations returns the most recent allocations into the heap span
+// containing addr, oldest first. The runtime records them only when the
+// program runs with GODEBUG=spantrace=N, and then keeps the last N, up
+// to 16; see the runtime package documentation. SpanAllocations returns
+// nil if span tracing is off or addr is not in an in-use heap span.
+//
+// A span holds either objects of a single size or one large object,
+// so the allocations show which goroutines and functions have used the
+// memory around addr, such as an object found corrupted.
+func SpanAllocations(addr uintptr) []SpanAllocation {
+	var goids [16]int64
+	var pcs [16]uintptr
+	n := readSpanAllocTrace(addr, goids[:], pcs[:])
+	if n == 0 {
+		return nil
+	}
+	allocs := make([]SpanAllocation, n)
+	for i := range allocs {
+		allocs[i] = SpanAllocation{Goroutine: goids[i], PC: pcs[i]}
+	}
+	return allocs
+}
+
 // SetPanicOnFault controls the runtime's behavior when a program faults
 // at an unexpected (non-nil) address. Such faults are typically caused by
 // bugs such as runtime memory corruption, so the default response is to crash
@@ -6,10 +6,14 @@ package debug_test
 
 import (
 	"internal/testenv"
+	"math"
 	"runtime"
 	. "runtime/debug"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func TestReadGCStats(t *testing.T) {
@@ -105,6 +109,36 @@ func TestFreeOSMemory(t *testing.T) {
 	}
 }
 
+var flushMCachesSink [][]byte
+
+func TestFlushMCaches(t *testing.T) {
+	defer SetGCPercent(SetGCPercent(-1))
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	// Leave this P's mcache holding partly used spans of several
+	// size classes.
+	flushMCachesSink = nil
+	for size := 16; size <= 1024; size *= 2 {
+		flushMCachesSink = append(flushMCachesSink, make([]byte, size))
+	}
+	spanBytes, _ := FlushMCaches()
+	if spanBytes == 0 {
+		t.Errorf("FlushMCaches released no span memory")
+	}
+	// Nothing has allocated since, so the caches are still empty.
+	if spanBytes, stackBytes := FlushMCaches(); spanBytes != 0 || stackBytes != 0 {
+		t.Errorf("FlushMCaches left %d bytes of spans and %d bytes of stacks cached", spanBytes, stackBytes)
+	}
+	flushMCachesSink = nil
+
+	// The caches refill as usual afterwards.
+	for i := 0; i < 1000; i++ {
+		flushMCachesSink = append(flushMCachesSink, make([]byte, 64))
+	}
+	flushMCachesSink = nil
+	runtime.GC()
+}
+
 var (
 	setGCPercentBallast interface{}
 	setGCPercentSink    interface{}
@@ -179,6 +213,62 @@ func abs64(a int64) int64 {
 	return a
 }
 
+func TestSetMemoryLimit(t *testing.T) {
+	const limit int64 = 1 << 40
+	old := SetMemoryLimit(limit)
+	if old != math.MaxInt64 {
+		t.Errorf("initial memory limit is %d, want math.MaxInt64", old)
+	}
+	if got := SetMemoryLimit(-1); got != limit {
+		t.Errorf("SetMemoryLimit(-1) = %d, want %d", got, limit)
+	}
+	if got := SetMemoryLimit(old); got != limit {
+		t.Errorf("SetMemoryLimit(old) = %d, want %d", got, limit)
+	}
+	if got := SetMemoryLimit(-1); got != old {
+		t.Errorf("SetMemoryLimit(-1) = %d after restoring, want %d", got, old)
+	}
+}
+
+func TestSetSweepAssistLimit(t *testing.T) {
+	old := SetSweepAssistLimit(16)
+	defer SetSweepAssistLimit(old)
+	if old != 0 {
+		t.Errorf("initial sweep assist limit is %d, want 0", old)
+	}
+	if got := SetSweepAssistLimit(-1); got != 16 {
+		t.Errorf("SetSweepAssistLimit(-1) = %d, want 16", got)
+	}
+
+	// Allocating and collecting with a small limit still sweeps
+	// the whole heap by the next collection, freeing the garbage.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 1000; j++ {
+			setSweepSink = make([]byte, 4<<10)
+		}
+		runtime.GC()
+	}
+	runtime.ReadMemStats(&after)
+	if freed := after.Frees - before.Frees; freed < 4000 {
+		t.Errorf("freed %d objects after 5000 allocations and 5 GCs, want at least 4000", freed)
+	}
+}
+
+func TestSetBackgroundSweepBatch(t *testing.T) {
+	old := SetBackgroundSweepBatch(8)
+	defer SetBackgroundSweepBatch(old)
+	if old != 1 {
+		t.Errorf("initial background sweep batch is %d, want 1", old)
+	}
+	if got := SetBackgroundSweepBatch(0); got != 8 {
+		t.Errorf("SetBackgroundSweepBatch(0) = %d, want 8", got)
+	}
+}
+
+var setSweepSink []byte
+
 func TestSetMaxThreadsOvf(t *testing.T) {
 	// Verify that a big threads count will not overflow the int32
 	// maxmcount variable, causing a panic (see Issue 16076).
@@ -191,3 +281,307 @@ func TestSetMaxThreadsOvf(t *testing.T) {
 	nt := SetMaxThreads(1 << (30 + ^uint(0)>>63))
 	SetMaxThreads(nt) // restore previous value
 }
+
+func TestSetGlobalQueueCheckInterval(t *testing.T) {
+	old := SetGlobalQueueCheckInterval(10)
+	defer SetGlobalQueueCheckInterval(old)
+	if old != 61 {
+		t.Errorf("initial interval = %d, want 61", old)
+	}
+	if got := SetGlobalQueueCheckInterval(0); got != 10 {
+		t.Errorf("SetGlobalQueueCheckInterval returned %d, want 10", got)
+	}
+	if got := SetGlobalQueueCheckInterval(1); got != 1 {
+		t.Errorf("SetGlobalQueueCheckInterval returned %d after setting 0, want 1", got)
+	}
+}
+
+func TestSetMaxGoroutines(t *testing.T) {
+	var exceeded int32
+	SetMaxGoroutines(runtime.NumGoroutine()+10, func() {
+		atomic.AddInt32(&exceeded, 1)
+	})
+	defer SetMaxGoroutines(0, nil)
+
+	done := make(chan bool)
+	defer close(done)
+	for i := 0; i < 5; i++ {
+		go func() { <-done }()
+	}
+	if n := atomic.LoadInt32(&exceeded); n != 0 {
+		t.Fatalf("onExceed called %d times below the limit", n)
+	}
+	for i := 0; i < 20; i++ {
+		go func() { <-done }()
+	}
+	if n := atomic.LoadInt32(&exceeded); n == 0 {
+		t.Fatal("onExceed not called above the limit")
+	}
+}
+
+func TestSetMaxGoroutinesRuntime(t *testing.T) {
+	// New P's get mark workers at the next collection.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(runtime.GOMAXPROCS(0) + 1))
+
+	// Without onExceed, a limited go statement would crash the
+	// program. The goroutines started by the runtime, here mark
+	// workers and the one running an AfterFunc function, must not be
+	// limited.
+	SetMaxGoroutines(runtime.NumGoroutine(), nil)
+	defer SetMaxGoroutines(0, nil)
+
+	done := make(chan bool)
+	time.AfterFunc(time.Millisecond, func() { done <- true })
+	<-done
+	runtime.GC()
+}
+
+func TestSudogCache(t *testing.T) {
+	defer SetGCPercent(SetGCPercent(-1))
+	old := SetSudogCacheSize(4)
+	defer SetSudogCacheSize(old)
+	if old != 128 {
+		t.Errorf("initial size = %d, want 128", old)
+	}
+
+	// blockAll blocks n goroutines on a channel at once, then wakes
+	// them, and reports how the sudog statistics changed.
+	blockAll := func(n int) (allocs, transfers uint64) {
+		var before, after SudogStats
+		ReadSudogStats(&before)
+		var started, done sync.WaitGroup
+		c := make(chan bool)
+		for i := 0; i < n; i++ {
+			started.Add(1)
+			done.Add(1)
+			go func() {
+				started.Done()
+				<-c
+				done.Done()
+			}()
+		}
+		started.Wait()
+		time.Sleep(10 * time.Millisecond)
+		close(c)
+		done.Wait()
+		ReadSudogStats(&after)
+		if after.Central < 0 {
+			t.Errorf("central cache holds %d sudogs", after.Central)
+		}
+		return after.Allocs - before.Allocs, after.Transfers - before.Transfers
+	}
+
+	blockAll(100)
+	allocs, small := blockAll(100)
+	t.Logf("cache size 4: %d allocations, %d transfers", allocs, small)
+	if small == 0 {
+		t.Error("no transfers to or from the central cache with a cache of 4")
+	}
+
+	if got := SetSudogCacheSize(1024); got != 4 {
+		t.Errorf("SetSudogCacheSize returned %d, want 4", got)
+	}
+	blockAll(100)
+	allocs, large := blockAll(100)
+	t.Logf("cache size 1024: %d allocations, %d transfers", allocs, large)
+	if large >= small {
+		t.Errorf("%d transfers with a cache of 1024, want fewer than the %d with a cache of 4", large, small)
+	}
+
+	if got := SetSudogCacheSize(0); got != 1024 {
+		t.Errorf("SetSudogCacheSize returned %d, want 1024", got)
+	}
+	if got := SetSudogCacheSize(old); got != 128 {
+		t.Errorf("SetSudogCacheSize returned %d after setting 0, want 128", got)
+	}
+}
+
+func TestHeapLayout(t *testing.T) {
+	big := make([]byte, 8<<20)
+	addr := uintptr(unsafe.Pointer(&big[0]))
+
+	arenas := HeapLayout()
+	if len(arenas) == 0 {
+		t.Fatal("HeapLayout returned no arenas")
+	}
+	found := false
+	var inUse uintptr
+	for i, a := range arenas {
+		if i > 0 && a.Start < arenas[i-1].End {
+			t.Errorf("arena %d [%#x, %#x) overlaps or precedes arena %d [%#x, %#x)", i, a.Start, a.End, i-1, arenas[i-1].Start, arenas[i-1].End)
+		}
+		size := a.End - a.Start
+		if a.Start >= a.End || a.Heap > size || a.Zeroed > size {
+			t.Errorf("bad arena %d: %+v", i, a)
+		}
+		if a.InUse > a.Heap || a.LargestFree > a.Heap-a.InUse {
+			t.Errorf("arena %d has %d bytes in use and %d in its largest free run, but only %d in the heap", i, a.InUse, a.LargestFree, a.Heap)
+		}
+		if a.Start <= addr && addr < a.End {
+			found = true
+		}
+		inUse += a.InUse
+	}
+	if !found {
+		t.Errorf("no arena contains the heap object at %#x", addr)
+	}
+	if inUse < uintptr(len(big)) {
+		t.Errorf("%d bytes in use, want at least %d", inUse, len(big))
+	}
+	runtime.KeepAlive(big)
+}
+
+func TestSetAvoidSparseSpans(t *testing.T) {
+	if SetAvoidSparseSpans(true) {
+		t.Fatal("sparse span avoidance enabled initially")
+	}
+	defer SetAvoidSparseSpans(false)
+	defer SetGCPercent(SetGCPercent(-1))
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	// Leave behind spans of the 576-byte size class that alternate
+	// between half full and sparse, then allocate fewer objects than
+	// the half full spans have room for. None of the sparse spans
+	// should be allocated from.
+	const size = 576
+	runtime.GC()
+	type obj [size]byte
+	objs := make([]*obj, 14*512)
+	for i := range objs {
+		objs[i] = new(obj)
+	}
+	kept := make(map[uintptr]int)
+	for i, p := range objs {
+		page := uintptr(unsafe.Pointer(p)) >> 13
+		keep := 1
+		if page%2 == 0 {
+			keep = 7
+		}
+		if kept[page] < keep {
+			kept[page]++
+		} else {
+			objs[i] = nil
+		}
+	}
+	runtime.GC()
+	before := sparseSpans(t, size)
+	var refill []*obj
+	for i := 0; i < 128*7/2; i++ {
+		refill = append(refill, new(obj))
+	}
+	after := sparseSpans(t, size)
+	runtime.KeepAlive(objs)
+	runtime.KeepAlive(refill)
+	if after+2 < before {
+		t.Errorf("sparse spans went from %d to %d while avoiding them", before, after)
+	}
+	for i, p := range refill {
+		if *p != (obj{}) {
+			t.Fatalf("object %d not zeroed", i)
+		}
+	}
+
+	if !SetAvoidSparseSpans(false) {
+		t.Error("SetAvoidSparseSpans(true) did not take effect")
+	}
+	if SetAvoidSparseSpans(false) {
+		t.Error("SetAvoidSparseSpans(false) did not take effect")
+	}
+}
+
+// sparseSpans returns the number of sparse spans in the size class
+// for objects of the given size.
+func sparseSpans(t *testing.T, size uint32) uint64 {
+	for _, f := range runtime.ReadFragmentation(nil) {
+		if f.Size == size {
+			return f.Sparse
+		}
+	}
+	t.Fatalf("no size class for %d-byte objects", size)
+	return 0
+}
+
+var reclaimSink []byte
+
+func TestSetPageReclaimers(t *testing.T) {
+	old := SetPageReclaimers(1)
+	defer SetPageReclaimers(old)
+	if got := SetPageReclaimers(-1); got != 1 {
+		t.Errorf("SetPageReclaimers(-1) = %d, want 1", got)
+	}
+
+	oldChunk := SetPageReclaimChunk(8)
+	defer SetPageReclaimChunk(oldChunk)
+	if oldChunk != 512 {
+		t.Errorf("initial reclaim chunk is %d pages, want 512", oldChunk)
+	}
+	for _, tt := range []struct{ set, want int }{
+		{100, 64},
+		{1, 8},
+		{0, 8},
+	} {
+		SetPageReclaimChunk(tt.set)
+		if got := SetPageReclaimChunk(0); got != tt.want {
+			t.Errorf("after SetPageReclaimChunk(%d), chunk is %d pages, want %d", tt.set, got, tt.want)
+		}
+	}
+	// Chunks are capped at an arena's worth of pages.
+	SetPageReclaimChunk(1 << 30)
+	if got := SetPageReclaimChunk(0); got >= 1<<30 || got&(got-1) != 0 {
+		t.Errorf("after SetPageReclaimChunk(1<<30), chunk is %d pages, want a smaller power of two", got)
+	}
+	SetPageReclaimChunk(8)
+
+	// Leave behind large garbage and allocate more large objects,
+	// which reclaims pages if the sweeper hasn't already.
+	var before, after ReclaimStats
+	ReadReclaimStats(&before)
+	for i := 0; i < 256; i++ {
+		reclaimSink = make([]byte, 256<<10)
+	}
+	ReadReclaimStats(&after)
+	for _, st := range []ReclaimStats{before, after} {
+		if st.Scanned > st.Pages {
+			t.Errorf("scanned %d of %d pages", st.Scanned, st.Pages)
+		}
+		if st.Active < 0 || st.Active > 1 {
+			t.Errorf("%d active reclaimers, want at most 1", st.Active)
+		}
+	}
+	if after.Reclaimed < before.Reclaimed {
+		t.Errorf("reclaimed pages went from %d to %d", before.Reclaimed, after.Reclaimed)
+	}
+}
+
+var gcCPUFractionSink []byte
+
+func TestSetGCCPUFraction(t *testing.T) {
+	old := SetGCCPUFraction(0.5)
+	defer SetGCCPUFraction(old)
+	if old != 0.25 {
+		t.Errorf("initial GC CPU fraction is %v, want 0.25", old)
+	}
+	if got := SetGCCPUFraction(0); got != 0.5 {
+		t.Errorf("SetGCCPUFraction(0) = %v, want 0.5", got)
+	}
+
+	// Collections must still complete at the extremes.
+	for _, f := range []float64{0.01, 1} {
+		SetGCCPUFraction(f)
+		for i := 0; i < 2; i++ {
+			gcCPUFractionSink = make([]byte, 1<<20)
+			runtime.GC()
+		}
+	}
+
+	for _, f := range []float64{1.5, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("SetGCCPUFraction(%v) did not panic", f)
+				}
+			}()
+			SetGCCPUFraction(f)
+		}()
+	}
+}
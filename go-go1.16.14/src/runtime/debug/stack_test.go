@@ -5,9 +5,12 @@
 package debug_test
 
 import (
+	"runtime"
 	. "runtime/debug"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type T int
@@ -63,3 +66,77 @@ func check(t *testing.T, line, has string) {
 		t.Errorf("expected %q in %q", has, line)
 	}
 }
+
+//go:noinline
+func shrinkStacksRecurse(n int) int {
+	var buf [1024]byte
+	if n == 0 {
+		return int(buf[0])
+	}
+	return shrinkStacksRecurse(n-1) + int(buf[n%len(buf)])
+}
+
+func TestShrinkStacks(t *testing.T) {
+	// Keep the garbage collector from shrinking the stacks first.
+	defer SetGCPercent(SetGCPercent(-1))
+	runtime.GC()
+
+	const G = 10
+	grown := make(chan bool)
+	release := make(chan bool)
+	done := make(chan bool)
+	for i := 0; i < G; i++ {
+		go func() {
+			shrinkStacksRecurse(128)
+			grown <- true
+			<-release
+			shrinkStacksRecurse(128)
+			done <- true
+		}()
+	}
+	for i := 0; i < G; i++ {
+		<-grown
+	}
+	if freed := ShrinkStacks(); freed < G*64<<10 {
+		t.Errorf("ShrinkStacks freed %d bytes, want at least %d", freed, G*64<<10)
+	}
+	close(release)
+	for i := 0; i < G; i++ {
+		<-done
+	}
+}
+
+func TestShrinkStacksRunning(t *testing.T) {
+	defer SetGCPercent(SetGCPercent(-1))
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	runtime.GC()
+
+	// A goroutine that keeps running after growing its stack has it
+	// shrunk when ShrinkStacks preempts it at a function call. If it
+	// is preempted elsewhere, its stack can't be moved until it has
+	// run again, so give it time to and try again.
+	grown := make(chan bool)
+	var stop uint32
+	done := make(chan bool)
+	go func() {
+		shrinkStacksRecurse(128)
+		grown <- true
+		for atomic.LoadUint32(&stop) == 0 {
+			shrinkStacksRecurse(1)
+		}
+		done <- true
+	}()
+	<-grown
+	var freed uint64
+	for i := 0; i < 100 && freed < 64<<10; i++ {
+		if i > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		freed += ShrinkStacks()
+	}
+	atomic.StoreUint32(&stop, 1)
+	<-done
+	if freed < 64<<10 {
+		t.Errorf("ShrinkStacks freed %d bytes of a running goroutine's stack, want at least %d", freed, 64<<10)
+	}
+}
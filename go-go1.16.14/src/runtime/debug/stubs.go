@@ -13,5 +13,23 @@ func readGCStats(*[]time.Duration)
 func freeOSMemory()
 func setMaxStack(int) int
 func setGCPercent(int32) int32
+func setMemoryLimit(int64) int64
+func setGCCPUFraction(float64) float64
+func setSweepAssistLimit(int) int
+func setBackgroundSweepBatch(int) int
+func setAvoidSparseSpans(bool) bool
+func setPageReclaimers(int) int
+func setPageReclaimChunk(int) int
+func readReclaimStats() (uint64, uint64, uint64, uint64, int)
 func setPanicOnFault(bool) bool
 func setMaxThreads(int) int
+func setIdleThreadTimeout(int64) int64
+func setGlobalQueueCheckInterval(int) int
+func setMaxGoroutines(int, func())
+func setSudogCacheSize(int) int
+func readSudogStats() (int, uint64, uint64)
+func readHeapLayout(*[]uintptr)
+func setHeapHint(uintptr)
+func readSpanAllocTrace(uintptr, []int64, []uintptr) int
+func flushMCaches() (uint64, uint64)
+func shrinkStacks() uint64
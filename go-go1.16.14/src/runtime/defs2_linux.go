@@ -57,6 +57,7 @@ const (
 	MAP_ANON    = C.MAP_ANONYMOUS
 	MAP_PRIVATE = C.MAP_PRIVATE
 	MAP_FIXED   = C.MAP_FIXED
+	MAP_HUGETLB = C.MAP_HUGETLB
 
 	MADV_DONTNEED   = C.MADV_DONTNEED
 	MADV_FREE       = C.MADV_FREE
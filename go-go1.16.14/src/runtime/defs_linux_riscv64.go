@@ -18,6 +18,7 @@ const (
 	_MAP_ANON    = 0x20
 	_MAP_PRIVATE = 0x2
 	_MAP_FIXED   = 0x10
+	_MAP_HUGETLB = 0x40000
 
 	_MADV_DONTNEED   = 0x4
 	_MADV_FREE       = 0x8
@@ -11,6 +11,55 @@ import "unsafe"
 var NewOSProc0 = newosproc0
 var Mincore = mincore
 var Add = add
+var CPUNUMANode = cpuNUMANode
+var ParseCPURange = parseCPURange
+var Mbind = mbind
+var ParseProcCgroup = parseProcCgroup
+var ParseMountInfo = parseMountInfo
+var CPULimit = cpuLimit
+
+// MNUMANode returns the NUMA node of the current M, as cached by it.
+func MNUMANode() int32 {
+	var node int32
+	systemstack(func() {
+		node = mNUMANode(getg().m)
+	})
+	return node
+}
+
+// CgroupCPULimit finds the process's cgroup and returns its CPU limit.
+func CgroupCPULimit() int32 {
+	cgroupCPUInit()
+	return cgroupCPULimit()
+}
+
+// JoinCgroupPath returns the path joinCgroupPath builds into a buffer
+// of n bytes, or "" if it doesn't fit.
+func JoinCgroupPath(n int, mount, root, cgroup, file string) string {
+	dst := make([]byte, n)
+	if !joinCgroupPath(dst, mount, root, cgroup, file) {
+		return ""
+	}
+	return gostringnocopy(&dst[0])
+}
+
+// ReadProcLines returns the lines of the file at path, as a
+// procLineReader reads them.
+func ReadProcLines(path string) []string {
+	var r procLineReader
+	if !r.open(&append([]byte(path), 0)[0]) {
+		return nil
+	}
+	defer r.close()
+	var lines []string
+	for {
+		line, ok := r.next()
+		if !ok {
+			return lines
+		}
+		lines = append(lines, string([]byte(line)))
+	}
+}
 
 type EpollEvent epollevent
 
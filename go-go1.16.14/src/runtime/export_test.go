@@ -408,6 +408,12 @@ func ReadMemStatsSlow() (base, slow MemStats) {
 	return
 }
 
+// StackSize returns the size of the calling goroutine's stack.
+func StackSize() uintptr {
+	gp := getg()
+	return gp.stack.hi - gp.stack.lo
+}
+
 // BlockOnSystemStack switches to the system stack, prints "x\n" to
 // stderr, and blocks in a stack containing
 // "runtime.blockOnSystemStackInternal".
@@ -491,6 +497,26 @@ func KeepNArenaHints(n int) {
 	hint.next = nil
 }
 
+// LargePageCacheContains reports whether the current P's large page
+// cache holds the pages at base.
+func LargePageCacheContains(base uintptr) (found bool) {
+	mp := acquirem()
+	for i := range mp.p.ptr().lcache.entries {
+		e := atomic.Loaduintptr(&mp.p.ptr().lcache.entries[i])
+		if e != 0 && e&^(pageSize-1) == base {
+			found = true
+		}
+	}
+	releasem(mp)
+	return
+}
+
+// FlushLargePageCaches returns the pages in every P's large page
+// cache to the page allocator.
+func FlushLargePageCaches() {
+	systemstack(func() { flushLargePageCaches(true) })
+}
+
 // MapNextArenaHint reserves a page at the next arena growth hint,
 // preventing the arena from growing there, and returns the range of
 // addresses that are no longer viable.
@@ -498,10 +524,10 @@ func MapNextArenaHint() (start, end uintptr) {
 	hint := mheap_.arenaHints
 	addr := hint.addr
 	if hint.down {
-		start, end = addr-heapArenaBytes, addr
+		start, end = addr-heapReserveBytes, addr
 		addr -= physPageSize
 	} else {
-		start, end = addr, addr+heapArenaBytes
+		start, end = addr, addr+heapReserveBytes
 	}
 	sysReserve(unsafe.Pointer(addr), physPageSize)
 	return
@@ -788,6 +814,37 @@ func (p *PageAlloc) AllocToCache() PageCache {
 	})
 	return c
 }
+func (p *PageAlloc) BindNode(base, size uintptr, node int32) {
+	pp := (*pageAlloc)(p)
+
+	systemstack(func() {
+		lock(pp.mheapLock)
+		pp.bindNode(base, size, node)
+		unlock(pp.mheapLock)
+	})
+}
+func (p *PageAlloc) AllocNode(node int32, npages uintptr) (uintptr, uintptr) {
+	pp := (*pageAlloc)(p)
+
+	var addr, scav uintptr
+	systemstack(func() {
+		lock(pp.mheapLock)
+		addr, scav = pp.allocNode(node, npages)
+		unlock(pp.mheapLock)
+	})
+	return addr, scav
+}
+func (p *PageAlloc) AllocToCacheNode(node int32) PageCache {
+	pp := (*pageAlloc)(p)
+
+	var c PageCache
+	systemstack(func() {
+		lock(pp.mheapLock)
+		c = PageCache(pp.allocToCacheNode(node))
+		unlock(pp.mheapLock)
+	})
+	return c
+}
 func (p *PageAlloc) Free(base, npages uintptr) {
 	pp := (*pageAlloc)(p)
 
@@ -1226,3 +1283,237 @@ func (th *TimeHistogram) Count(bucket, subBucket uint) (uint64, bool) {
 func (th *TimeHistogram) Record(duration int64) {
 	(*timeHistogram)(th).record(duration)
 }
+
+// Goid returns the ID of the calling goroutine.
+func Goid() int64 {
+	return getg().goid
+}
+
+// ProcID returns the ID of the P the calling goroutine is running on.
+func ProcID() int32 {
+	mp := acquirem()
+	id := mp.p.ptr().id
+	releasem(mp)
+	return id
+}
+
+// TimerCounts returns the number of timers in each P's heap.
+func TimerCounts() []int {
+	stopTheWorld("TimerCounts")
+	counts := make([]int, 0, len(allp))
+	for _, pp := range allp {
+		counts = append(counts, int(atomic.Load(&pp.numTimers)))
+	}
+	startTheWorld()
+	return counts
+}
+
+// DeletedTimerCounts returns the number of deleted timers each P
+// counts in its heap.
+func DeletedTimerCounts() []int32 {
+	stopTheWorld("DeletedTimerCounts")
+	counts := make([]int32, 0, len(allp))
+	for _, pp := range allp {
+		counts = append(counts, int32(atomic.Load(&pp.deletedTimers)))
+	}
+	startTheWorld()
+	return counts
+}
+
+// HeapPregrown returns the number of bytes of arena space mapped by
+// the background heap pre-grower.
+func HeapPregrown() uint64 {
+	return atomic.Load64(&heapPregrow.pregrown)
+}
+
+const HeapPregrowMaxBudget = heapPregrowMaxBudget
+
+var HeapPregrowCredit = heapPregrowCredit
+
+// Ranks of the locks acquired by LockRankNested.
+const (
+	LockRankOuter = int(lockRankRwmutexW)
+	LockRankInner = int(lockRankRwmutexR)
+)
+
+// LockRankNested acquires two ranked runtime locks in rank order and
+// releases them in reverse order.
+func LockRankNested() {
+	var a, b mutex
+	lockInit(&a, lockRankRwmutexW)
+	lockInit(&b, lockRankRwmutexR)
+	lock(&a)
+	lock(&b)
+	unlock(&b)
+	unlock(&a)
+}
+
+// SmallSpanClass returns the span class used for small objects of
+// the given size.
+func SmallSpanClass(size uintptr, noscan bool) uint8 {
+	if size > smallSizeMax-8 {
+		panic("size too large")
+	}
+	return uint8(makeSpanClass(size_to_class8[divRoundUp(size, smallSizeDiv)], noscan))
+}
+
+// RequestPreempt asks for the calling goroutine to be preempted at its
+// next synchronous safe point, the way sysmon does.
+//
+//go:nosplit
+func RequestPreempt() {
+	gp := getg()
+	gp.preempt = true
+	gp.stackguard0 = stackPreempt
+}
+
+// OnSystemStackOnG0 calls OnSystemStack on the system stack.
+func OnSystemStackOnG0() (on bool) {
+	systemstack(func() {
+		on = OnSystemStack()
+	})
+	return
+}
+
+// FindObject returns the base address of the heap object containing
+// p, or 0 if p does not point into a heap object.
+func FindObject(p uintptr) (base uintptr) {
+	systemstack(func() {
+		base, _, _ = findObject(p, 0, 0)
+	})
+	return
+}
+
+const HeapAddrBits = heapAddrBits
+
+// ArenaOutOfRangePointer returns an address just past the address
+// space the heap may use, whose arena index is out of bounds, or 0 if
+// the heap may use the whole address space.
+func ArenaOutOfRangePointer() uintptr {
+	n := uint(heapAddrBits)
+	if n >= 8*sys.PtrSize {
+		return 0
+	}
+	return uintptr(1)<<n + arenaBaseOffset
+}
+
+// SpanTailPointer returns the address of the unused tail of the span
+// holding the heap object x, or 0 if the span has no tail.
+func SpanTailPointer(x unsafe.Pointer) uintptr {
+	s := spanOf(uintptr(x))
+	if s == nil || s.limit == s.base()+s.npages*pageSize {
+		return 0
+	}
+	return s.limit
+}
+
+// GCCPUTime returns the total CPU time in nanoseconds spent by the
+// garbage collector in completed cycles.
+func GCCPUTime() (ns int64) {
+	stopTheWorld("GCCPUTime")
+	ns = work.totaltime
+	startTheWorld()
+	return
+}
+
+// SetYoungSpansEnabled turns the GOEXPERIMENT=gennursery survival
+// measurement on or off and returns the previous setting.
+func SetYoungSpansEnabled(enable bool) (old bool) {
+	stopTheWorld("SetYoungSpansEnabled")
+	old, youngSpansEnabled = youngSpansEnabled, enable
+	startTheWorld()
+	return
+}
+
+// ReadYoungSpanStats returns the young objects and emptied young spans
+// swept since gctrace last reported them.
+func ReadYoungSpanStats() (allocs, survived, emptied uint64) {
+	return atomic.Load64(&youngSpanStats.allocs), atomic.Load64(&youngSpanStats.survived), atomic.Load64(&youngSpanStats.emptied)
+}
+
+// GCAssistExemptWork returns the scan work charged to the background
+// workers on behalf of exempt goroutines in the current or last GC
+// cycle, and the cycle's limit on it.
+func GCAssistExemptWork() (work, limit int64) {
+	return atomic.Loadint64(&gcController.exemptWork), gcController.exemptLimit
+}
+
+// SetRuntimeLockProfileRate sets GODEBUG=runtimelockprofile and
+// returns the previous setting.
+func SetRuntimeLockProfileRate(rate int32) (old int32) {
+	old, debug.runtimelockprofile = debug.runtimelockprofile, rate
+	return
+}
+
+// ContendRuntimeLock makes two goroutines lock a runtime mutex n times
+// each, holding it for a while each time.
+func ContendRuntimeLock(n int) {
+	mu := new(mutex)
+	done := make(chan bool)
+	for i := 0; i < 2; i++ {
+		go func() {
+			for j := 0; j < n; j++ {
+				lock(mu)
+				usleep(100)
+				unlock(mu)
+			}
+			done <- true
+		}()
+	}
+	<-done
+	<-done
+}
+
+// MinTimeSlice returns the time slice sysmon currently paces its
+// preemption checks for, or 0 for the default.
+func MinTimeSlice() int64 {
+	return int64(atomic.Load64(&minTimeSlice))
+}
+
+// GCIdleMarkTime returns the time idle mark workers spent marking in
+// the last garbage collection cycle, in nanoseconds.
+func GCIdleMarkTime() int64 {
+	return atomic.Loadint64(&gcController.idleMarkTime)
+}
+
+const (
+	MaxSyscallReacquireSpin     = maxSyscallReacquireSpin
+	MaxSyscallReacquireSpinTime = maxSyscallReacquireSpinTime
+)
+
+// SyscallReacquireWait spins as a goroutine leaving a syscall does
+// with the maximum spin, waiting for a P that never becomes idle, and
+// returns how long it spun in nanoseconds.
+func SyscallReacquireWait() int64 {
+	var pp p
+	pp.status = _Prunning
+	t0 := nanotime()
+	syscallReacquireWait(&pp, maxSyscallReacquireSpin)
+	return nanotime() - t0
+}
+
+// SyscallReacquireSpin returns the spin set by SetSyscallReacquireSpin.
+func SyscallReacquireSpin() int {
+	return int(atomic.Load(&syscallReacquireSpin))
+}
+
+// SweepAssist runs a GC cycle without finishing its sweep, then pays
+// the sweep debt of allocating spanBytes the way an allocating
+// goroutine would. It returns the number of pages the caller swept
+// and the size in pages of the largest in-use span.
+func SweepAssist(spanBytes uintptr) (swept, maxSpan uintptr) {
+	n := atomic.Load(&work.cycles)
+	gcWaitOnMark(n)
+	gcStart(gcTrigger{kind: gcTriggerCycle, n: n + 1})
+	gcWaitOnMark(n + 1)
+
+	stopTheWorld("SweepAssist")
+	for _, s := range mheap_.allspans {
+		if s.state.get() == mSpanInUse && s.npages > maxSpan {
+			maxSpan = s.npages
+		}
+	}
+	startTheWorld()
+
+	return deductSweepCredit(spanBytes, 0), maxSpan
+}
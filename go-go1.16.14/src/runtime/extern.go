@@ -27,6 +27,17 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	allocfreetrace: setting allocfreetrace=1 causes every allocation to be
 	profiled and a stack trace printed on each object's allocation and free.
 
+	autogomaxprocs: setting autogomaxprocs=1 makes the runtime set GOMAXPROCS
+	to the number of CPUs allowed by the CPU quota of the process's cgroup,
+	rounded up, if that is less than the number of logical CPUs, and keep it
+	up to date as the quota changes, checking about once a second. It has
+	no effect if the GOMAXPROCS environment variable is set, and stops
+	having one once the program calls runtime.GOMAXPROCS. It only has an
+	effect on Linux, where it reads the cgroup v2 file cpu.max or the cgroup
+	v1 files cpu.cfs_quota_us and cpu.cfs_period_us of the process's cgroup,
+	found through /proc/self/cgroup and /proc/self/mountinfo when the
+	program starts.
+
 	clobberfree: setting clobberfree=1 causes the garbage collector to
 	clobber the memory content of an object with bad content when it frees
 	the object.
@@ -42,6 +53,11 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	where each object is allocated on a unique page and addresses are
 	never recycled.
 
+	extram: setting extram=N makes a program that uses cgo allocate N extra M's at
+	startup, as runtime.PreallocateExtraMs(N) would, for threads not created by Go
+	to run Go code on, instead of allocating them as callbacks from such threads
+	need them.
+
 	gccheckmark: setting gccheckmark=1 enables verification of the
 	garbage collector's concurrent mark phase by performing a
 	second mark pass while the world is stopped.  If the second
@@ -78,6 +94,25 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	If the line ends with "(forced)", this GC was forced by a
 	runtime.GC() call.
 
+	heappoison: setting heappoison=1 fills small heap objects with a poison
+	pattern when the garbage collector frees them, and checks that the pattern
+	is intact when their memory is allocated again. If it is not, the program
+	wrote to an object after it became unreachable, such as through a pointer
+	hidden from the garbage collector, and the runtime crashes, reporting the
+	address of the write. Objects larger than 32 kB are not checked.
+
+	hugepages: setting hugepages=N sets the huge page policy for heap memory
+	as runtime.SetHugePagePolicy(N) would, from program start: 1 keeps heap
+	memory out of transparent huge pages, 2 asks for transparent huge pages,
+	and 3 maps new heap memory with explicit (hugetlbfs) huge pages, falling
+	back to transparent ones when the kernel has none to spare. Huge page
+	policies only have an effect on Linux.
+
+	initbudget: setting initbudget=N causes the runtime to emit a warning to standard
+	error for each package whose init work takes more than N milliseconds of wall-clock
+	time. Setting initbudgetthrow=1 as well makes that a fatal error instead. Inits
+	executed as part of plugin loading are not checked.
+
 	inittrace: setting inittrace=1 causes the runtime to emit a single line to standard
 	error for each package with init work, summarizing the execution time and memory
 	allocation. No information is printed for inits executed as part of plugin loading
@@ -90,6 +125,8 @@ It is a comma-separated list of name=val pairs setting these named variables:
 		# clock     wall-clock time for package initialization work
 		# bytes     memory allocated on the heap
 		# allocs    number of heap allocations
+	Setting inittrace=2 records the same information without printing it, for
+	runtime.ReadInitTrace to return once the program has started.
 
 	madvdontneed: setting madvdontneed=0 will use MADV_FREE
 	instead of MADV_DONTNEED on Linux when returning memory to the
@@ -106,6 +143,38 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	This should only be used as a temporary workaround to diagnose buggy code.
 	The real fix is to not store integers in pointer-typed locations.
 
+	netpollshards: setting netpollshards=N, for N up to 64, splits the network
+	descriptors the runtime waits on among N epoll instances, chosen by
+	descriptor number, and makes each processor looking for work check the
+	instance matching its ID before the shared one. This spreads the kernel's
+	per-instance locking at very high connection counts. A thread blocked in
+	the network poller still wakes for events on any instance. It only has an
+	effect on Linux.
+
+	numasteal: setting numasteal=1 makes processors that run out of work
+	steal goroutines from processors last seen running on the same NUMA
+	node before they try the others. It only has an effect on Linux/amd64
+	and Linux/arm64 systems with more than one NUMA node.
+
+	numaheap: setting numaheap=1 binds the memory the heap grows by to the
+	NUMA node of the processor that grew it, and partitions the page
+	allocator per node: a processor allocates spans only from memory on
+	its own node, growing the heap there when the node has no room, and
+	takes memory from other nodes only when the heap can't grow. Swept
+	spans reused after garbage collection are handed to processors on
+	their own node first. Spans larger than 4MB, and pages a processor
+	reuses from its own recently freed large objects, may be on any
+	node. Like numasteal, it only has an effect on Linux/amd64 and
+	Linux/arm64 systems with more than one (and at most 64) NUMA nodes.
+
+	runtimelockprofile: setting runtimelockprofile=N makes the runtime record, for
+	one in N on average of the acquisitions of its internal locks that have to wait
+	for another thread to release the lock, the stack of the acquiring code and how
+	long it waited, and, for one in N on average of the releases of its internal
+	locks that other threads are waiting for, the stack of the releasing code and
+	how long it held the lock. The runtime/pprof package's "runtimelock" profile
+	reports them.
+
 	sbrk: setting sbrk=1 replaces the memory allocator and garbage collector
 	with a trivial allocator that obtains memory from the operating system and
 	never reclaims any memory.
@@ -130,15 +199,59 @@ It is a comma-separated list of name=val pairs setting these named variables:
 	detailed multiline info every X milliseconds, describing state of the scheduler,
 	processors, threads and goroutines.
 
+	schedstall: setting schedstall=X makes the system monitor report each processor
+	that has not scheduled another goroutine for X milliseconds while goroutines
+	are waiting to run, with a line on standard error followed by the detailed
+	scheduler state that scheddetail=1 prints. runtime.SetSchedStallThreshold
+	overrides X, and runtime.SetSchedStallObserver replaces the reports.
+
 	schedtrace: setting schedtrace=X causes the scheduler to emit a single line to standard
 	error every X milliseconds, summarizing the scheduler state.
 
+	schedtracejson: setting schedtracejson=1 makes schedtrace and scheddetail print
+	each report as a single line holding a JSON object, for programs to parse. The
+	object has the fields of the text format's first line, with the time in "ms",
+	and a list "p" of objects for the processors, each with its "id", "status" and
+	"runqsize". With scheddetail=1 the processor objects have all the fields of the
+	text format, and lists "m" and "g" describe the threads and goroutines, with
+	the goroutines' wait reasons in "waitreason".
+
+	spantrace: setting spantrace=N makes each heap span record the last N
+	allocations into it, up to 16, each with the allocating goroutine and the
+	first function outside the runtime on its stack. When the runtime finds the
+	heap corrupted, it prints the allocations recorded for the span involved,
+	and runtime/debug.SpanAllocations returns them for any heap address.
+
+	stackgrowtrace: setting stackgrowtrace=1 causes the runtime to emit a single
+	line to standard error each time a goroutine's stack is grown, giving the
+	goroutine, the old and new stack sizes, and the function whose call ran out
+	of stack. The format of this line is subject to change, but currently it is:
+		stackgrow: goroutine # # -> # bytes at func+0x# file:line
+
+	timerwheel: setting timerwheel=1 makes each processor keep the timers that are
+	not due within the next 67 milliseconds or so in a hierarchical timing wheel
+	rather than in its heap of timers. Adding, resetting and stopping such timers
+	then take constant time, which helps programs with very many timers that
+	rarely fire, such as network deadlines. Timers still fire at the same times.
+
 	tracebackancestors: setting tracebackancestors=N extends tracebacks with the stacks at
 	which goroutines were created, where N limits the number of ancestor goroutines to
 	report. This also extends the information returned by runtime.Stack. Ancestor's goroutine
 	IDs will refer to the ID of the goroutine at the time of creation; it's possible for this
 	ID to be reused for another goroutine. Setting N to 0 will report no ancestry information.
 
+	wakepdelay: setting wakepdelay=N makes a goroutine that wakes others
+	leave starting an idle processor to run them to the system monitor
+	thread, which does it N microseconds after the first of a burst of
+	wakeups. This trades up to N microseconds of latency for waking and
+	parking fewer threads in programs that wake many goroutines in bursts.
+
+	chanhandoff: setting chanhandoff=1 makes a goroutine that wakes another by
+	sending to or receiving from a channel switch to it directly, giving it the
+	rest of the current time slice and queuing itself to run next, instead of
+	queuing it and waking an idle processor. This lowers the latency of
+	request/response exchanges between pairs of goroutines.
+
 	asyncpreemptoff: asyncpreemptoff=1 disables signal-based
 	asynchronous goroutine preemption. This makes some loops
 	non-preemptible for long periods, which may delay GC and
@@ -155,6 +268,15 @@ that can be blocked in system calls on behalf of Go code; those do not count aga
 the GOMAXPROCS limit. This package's GOMAXPROCS function queries and changes
 the limit.
 
+The GOHEAPHINT variable asks the runtime to reserve the address space for
+the heap at the given hexadecimal address, such as 0x7f0000000000, rounded
+up to the heap's arena size. It lets programs that share a crowded address
+space, like c-shared libraries, keep the heap away from their neighbors. If
+the address is unavailable, the runtime places the heap as it usually would.
+GOHEAPHINT is only read on systems where the environment is passed after the
+program's arguments, such as Linux, and is ignored in programs built with -race.
+See also runtime/debug.SetHeapHint.
+
 The GORACE variable configures the race detector, for programs built using -race.
 See https://golang.org/doc/articles/race_detector.html for details.
 
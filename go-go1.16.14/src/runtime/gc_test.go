@@ -625,6 +625,31 @@ func TestUserForcedGC(t *testing.T) {
 	}
 }
 
+func TestSweepAssistLimit(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	const limit = 16
+	defer debug.SetSweepAssistLimit(debug.SetSweepAssistLimit(limit))
+
+	// Leave plenty of garbage spans for the next cycle to sweep.
+	garbage := make([][]byte, 4000)
+	for i := range garbage {
+		garbage[i] = make([]byte, 4<<10)
+	}
+	hugeSink = garbage
+	hugeSink = nil
+	garbage = nil
+
+	// Ask for far more sweeping than the heap holds, so only the
+	// limit stops the assist. The span that crosses the limit is
+	// swept whole.
+	swept, maxSpan := runtime.SweepAssist(1 << 30)
+	runtime.GC()
+	if swept < limit || swept >= limit+maxSpan {
+		t.Errorf("sweep assist swept %d pages, want at least %d and less than %d", swept, limit, limit+maxSpan)
+	}
+}
+
 func writeBarrierBenchmark(b *testing.B, f func()) {
 	runtime.GC()
 	var ms runtime.MemStats
@@ -800,3 +825,860 @@ func countpwg(n *int, ready *sync.WaitGroup, teardown chan bool) {
 	*n--
 	countpwg(n, ready, teardown)
 }
+
+func TestAssistObserver(t *testing.T) {
+	var allocGoid, work int64
+	runtime.SetAssistObserver(func(goid, scanWork, nanos int64) {
+		if goid == atomic.LoadInt64(&allocGoid) {
+			atomic.AddInt64(&work, scanWork)
+		}
+	})
+	defer runtime.SetAssistObserver(nil)
+
+	// Keep a reasonably large pointer-rich heap live so that each
+	// cycle has enough mark work for the allocator to be charged.
+	live := make([]*[16]byte, 1<<20)
+	for i := range live {
+		live[i] = new([16]byte)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		atomic.StoreInt64(&allocGoid, runtime.Goid())
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for i := 0; i < 1000; i++ {
+				hugeSink = make([]*int, 128)
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadInt64(&work) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+	}
+	close(stop)
+	<-done
+	runtime.KeepAlive(live)
+
+	if atomic.LoadInt64(&work) == 0 {
+		t.Fatal("assist observer reported no scan work for the allocating goroutine")
+	}
+}
+
+func TestAssistCreditObserver(t *testing.T) {
+	var flushes, credit int64
+	runtime.SetAssistCreditObserver(func(goid, creditFlushed int64) {
+		atomic.AddInt64(&flushes, 1)
+		atomic.AddInt64(&credit, creditFlushed)
+	})
+	defer runtime.SetAssistCreditObserver(nil)
+
+	// Keep a pointer-rich heap live so that each cycle's mark phase
+	// lasts long enough for goroutines to assist, and so build up
+	// credit, and exit during it.
+	live := make([]*[16]byte, 1<<20)
+	for i := range live {
+		live[i] = new([16]byte)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						hugeSink = make([]*int, 128)
+					}
+				}()
+			}
+			wg.Wait()
+		}
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadInt64(&flushes) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+	}
+	close(stop)
+	<-done
+	runtime.KeepAlive(live)
+
+	if atomic.LoadInt64(&flushes) == 0 {
+		t.Fatal("no exiting goroutine flushed assist credit")
+	}
+	if c := atomic.LoadInt64(&credit); c <= 0 {
+		t.Errorf("total assist credit flushed %d, want > 0", c)
+	}
+}
+
+func TestGCAssistExempt(t *testing.T) {
+	// Keep a pointer-rich heap live so that the exempt goroutine
+	// would otherwise be charged assists.
+	live := make([]*[16]byte, 1<<20)
+	for i := range live {
+		live[i] = new([16]byte)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runtime.SetGCAssistExempt(true)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for i := 0; i < 1000; i++ {
+				hugeSink = make([]*int, 128)
+			}
+		}
+	}()
+
+	var exempt int64
+	deadline := time.Now().Add(10 * time.Second)
+	for exempt == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		var limit int64
+		exempt, limit = runtime.GCAssistExemptWork()
+		if exempt > limit {
+			t.Errorf("exempt scan work %d exceeds cycle limit %d", exempt, limit)
+		}
+	}
+	close(stop)
+	<-done
+	runtime.KeepAlive(live)
+
+	if exempt == 0 {
+		t.Fatal("no assist debt was charged to the background workers for the exempt goroutine")
+	}
+}
+
+func TestSweepTermObserver(t *testing.T) {
+	var cycles, pending uint64
+	runtime.SetSweepTermObserver(func(pendingPages uint64, nanos int64) {
+		atomic.AddUint64(&cycles, 1)
+		atomic.AddUint64(&pending, pendingPages)
+	})
+	defer runtime.SetSweepTermObserver(nil)
+
+	// Spread garbage over many spans so that a cycle started right
+	// on the heels of another one finds them still unswept.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				garbage := make([]*[64]byte, 1<<16)
+				for j := range garbage {
+					garbage[j] = new([64]byte)
+				}
+				runtime.GC()
+			}
+		}()
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&pending) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	if atomic.LoadUint64(&cycles) == 0 {
+		t.Fatal("sweep termination observer was never called")
+	}
+	if atomic.LoadUint64(&pending) == 0 {
+		t.Fatal("sweep termination observer reported no pending pages")
+	}
+}
+
+func TestBgMarkWorkerObserver(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	// Record which Ps did mark work, as a bitmask.
+	var ps, work uint64
+	var badMode uint32
+	runtime.SetBgMarkWorkerObserver(func(pid int32, mode string, scanWork int64) {
+		switch mode {
+		case "dedicated", "fractional", "idle":
+		default:
+			atomic.StoreUint32(&badMode, 1)
+		}
+		if scanWork > 0 && pid < 64 {
+			for {
+				old := atomic.LoadUint64(&ps)
+				if atomic.CompareAndSwapUint64(&ps, old, old|1<<pid) {
+					break
+				}
+			}
+			atomic.AddUint64(&work, uint64(scanWork))
+		}
+	})
+	defer runtime.SetBgMarkWorkerObserver(nil)
+
+	live := make([]*[16]byte, 1<<20)
+	for i := range live {
+		live[i] = new([16]byte)
+	}
+	multi := func() bool {
+		v := atomic.LoadUint64(&ps)
+		return v&(v-1) != 0
+	}
+	for start := time.Now(); !multi() && time.Since(start) < 10*time.Second; {
+		runtime.GC()
+	}
+	runtime.KeepAlive(live)
+
+	if atomic.LoadUint32(&badMode) != 0 {
+		t.Error("observer reported an unknown worker mode")
+	}
+	if atomic.LoadUint64(&work) == 0 {
+		t.Fatal("observer reported no mark work")
+	}
+	if !multi() {
+		t.Errorf("mark work was reported on only one P (mask %#x)", atomic.LoadUint64(&ps))
+	}
+}
+
+func TestGCPhaseObserver(t *testing.T) {
+	// The observer runs with the world stopped, so record transitions
+	// into a fixed buffer without allocating.
+	type transition struct{ from, to int }
+	var seen [64]transition
+	var n uint32
+	runtime.SetGCPhaseObserver(func(from, to int) {
+		if i := atomic.AddUint32(&n, 1) - 1; i < uint32(len(seen)) {
+			seen[i] = transition{from, to}
+		}
+	})
+	runtime.GC()
+	runtime.SetGCPhaseObserver(nil)
+
+	got := seen[:]
+	if c := atomic.LoadUint32(&n); c < uint32(len(seen)) {
+		got = seen[:c]
+	}
+	// runtime.GC may finish a cycle that was already in progress
+	// before running its own, so look for one complete cycle.
+	want := []transition{{0, 1}, {1, 2}, {2, 0}}
+	k := 0
+	for _, tr := range got {
+		if k < len(want) && tr == want[k] {
+			k++
+		}
+	}
+	if k != len(want) {
+		t.Errorf("observed phase transitions %v, want a cycle %v", got, want)
+	}
+}
+
+var sweepSink []*[112]byte
+
+func TestSpanSweepObserver(t *testing.T) {
+	var freed [256]uint64
+	runtime.SetSpanSweepObserver(func(spanClass uint8, n uint16) {
+		atomic.AddUint64(&freed[spanClass], uint64(n))
+	})
+	defer runtime.SetSpanSweepObserver(nil)
+
+	const objects = 10000
+	sweepSink = make([]*[112]byte, objects)
+	for i := range sweepSink {
+		sweepSink[i] = new([112]byte)
+	}
+	sweepSink = nil
+	// runtime.GC finishes sweeping before it returns.
+	runtime.GC()
+
+	spc := runtime.SmallSpanClass(112, true)
+	if got := atomic.LoadUint64(&freed[spc]); got < objects/2 {
+		t.Errorf("observer reported %d objects freed for span class %d, want at least %d", got, spc, objects/2)
+	}
+}
+
+var spanFreeSink [][]byte
+
+func TestSpanFreeObserver(t *testing.T) {
+	// Large objects get a span of their own, so each one that dies
+	// should free a span of exactly the pages it needed.
+	const (
+		objects = 64
+		npages  = 9
+	)
+	var freed uint32
+	runtime.SetSpanFreeObserver(func(spanClass uint8, n uintptr) {
+		if spanClass>>1 == 0 && n == npages {
+			atomic.AddUint32(&freed, 1)
+		}
+	})
+	defer runtime.SetSpanFreeObserver(nil)
+
+	spanFreeSink = make([][]byte, objects)
+	for i := range spanFreeSink {
+		spanFreeSink[i] = make([]byte, npages*8192)
+	}
+	spanFreeSink = nil
+	// runtime.GC finishes sweeping before it returns.
+	runtime.GC()
+
+	if got := atomic.LoadUint32(&freed); got < objects {
+		t.Errorf("observer reported %d large spans of %d pages freed, want at least %d", got, npages, objects)
+	}
+}
+
+var manualGCSink []byte
+
+func TestGCModeManual(t *testing.T) {
+	defer runtime.SetGCManualHeapLimit(0)
+	defer runtime.SetGCMode(runtime.GCModeAuto)
+
+	// allocate allocates 64 MB of garbage, many times the heap goal
+	// of the test binary.
+	allocate := func() {
+		for i := 0; i < 64<<10; i++ {
+			manualGCSink = make([]byte, 1024)
+		}
+		manualGCSink = nil
+	}
+
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	runtime.SetGCManualHeapLimit(ms.HeapAlloc + 1<<30)
+	runtime.SetGCMode(runtime.GCModeManual)
+	before := ms.NumGC
+	allocate()
+	runtime.ReadMemStats(&ms)
+	if ms.NumGC != before {
+		t.Errorf("%d automatic GCs ran in manual mode", ms.NumGC-before)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	if ms.NumGC == before {
+		t.Errorf("runtime.GC did not run a GC in manual mode")
+	}
+
+	// Lower the safety limit so that the same garbage hits it.
+	runtime.SetGCManualHeapLimit(ms.HeapAlloc + 16<<20)
+	before = ms.NumGC
+	allocate()
+	runtime.ReadMemStats(&ms)
+	if ms.NumGC == before {
+		t.Errorf("no GC ran after the heap passed the manual mode safety limit")
+	}
+
+	// With the limit below the live heap, forced GCs must still
+	// leave the heap room to grow, rather than running back to
+	// back. The 64 MB of garbage leave room for at most 16 when
+	// the heap grows by at least 4 MB between them.
+	runtime.SetGCManualHeapLimit(1)
+	before = ms.NumGC
+	allocate()
+	runtime.ReadMemStats(&ms)
+	if n := ms.NumGC - before; n == 0 || n > 16+1 {
+		t.Errorf("%d GCs ran with the safety limit below the live heap, want between 1 and 17", n)
+	}
+}
+
+func TestPointerValidation(t *testing.T) {
+	// 24-byte objects leave an unused tail at the end of their
+	// spans; a pointer into it is a bad heap pointer.
+	x := new([3]uint64)
+	bad := runtime.SpanTailPointer(unsafe.Pointer(x))
+	if bad == 0 {
+		t.Skip("span has no unused tail")
+	}
+
+	var reported uintptr
+	runtime.SetPointerValidation(func(ptr uintptr) {
+		reported = ptr
+	})
+	defer runtime.SetPointerValidation(nil)
+
+	if base := runtime.FindObject(bad); base != 0 {
+		t.Errorf("bad pointer %#x resolved to object %#x", bad, base)
+	}
+	if reported != bad {
+		t.Errorf("observer reported %#x, want %#x", reported, bad)
+	}
+
+	// Good pointers are not reported.
+	reported = 0
+	if base := runtime.FindObject(uintptr(unsafe.Pointer(x))); base != uintptr(unsafe.Pointer(x)) {
+		t.Errorf("FindObject(%p) = %#x, want %p", x, base, x)
+	}
+	if reported != 0 {
+		t.Errorf("observer reported good pointer %#x", reported)
+	}
+	runtime.KeepAlive(x)
+
+	// Nor are pointers outside the heap.
+	if runtime.FindObject(uintptr(unsafe.Pointer(&pointerValidationGlobal))) != 0 || reported != 0 {
+		t.Errorf("pointer to a global resolved to a heap object or was reported")
+	}
+
+	// A pointer outside the address space of the heap is reported.
+	if out := runtime.ArenaOutOfRangePointer(); out != 0 {
+		if base := runtime.FindObject(out); base != 0 {
+			t.Errorf("out of range pointer %#x resolved to object %#x", out, base)
+		}
+		if reported != out {
+			t.Errorf("observer reported %#x, want out of range pointer %#x", reported, out)
+		}
+	}
+}
+
+var pointerValidationGlobal int
+
+type gcLimitNode struct {
+	next *gcLimitNode
+	val  int
+	pad  [6]*int
+}
+
+var gcLimitSink *gcLimitNode
+
+func TestGCCPUFractionLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	const procs = 4
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+	defer runtime.SetGCCPUFractionLimit(0)
+
+	// gcFraction runs allocating goroutines on every P, which keep
+	// a large pointerful heap live so that marking is expensive,
+	// and returns the fraction of CPU the GC used meanwhile.
+	gcFraction := func(limit float64) float64 {
+		runtime.SetGCCPUFractionLimit(limit)
+		runtime.GC()
+		startCPU := runtime.GCCPUTime()
+		start := time.Now()
+
+		var wg sync.WaitGroup
+		for g := 0; g < procs; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				var live *gcLimitNode
+				for i := 0; i < 1<<20; i++ {
+					n := &gcLimitNode{next: live, val: i}
+					if i%(1<<16) == 0 {
+						// Drop the list now and then so
+						// the heap doesn't grow without
+						// bound.
+						n.next = nil
+					}
+					live = n
+				}
+				// Check the list survived intact.
+				for n, want := live, (1<<20)-1; n != nil; n, want = n.next, want-1 {
+					if n.val != want {
+						t.Errorf("list corrupted: got %d, want %d", n.val, want)
+						return
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		runtime.GC()
+		used := runtime.GCCPUTime() - startCPU
+		wall := time.Since(start)
+		return float64(used) / (float64(wall) * procs)
+	}
+
+	unlimited := gcFraction(0)
+	limited := gcFraction(0.05)
+	t.Logf("GC CPU fraction: unlimited %.3f, limit 0.05 %.3f", unlimited, limited)
+	// The trailing runtime.GC, pauses and approximate measurement
+	// all push the fraction over the limit a little.
+	if limited > 0.10 {
+		t.Errorf("GC CPU fraction %.3f with limit 0.05", limited)
+	}
+}
+
+var spanReuseSink []*[112]byte
+
+func TestSpanReuseObserver(t *testing.T) {
+	spc := runtime.SmallSpanClass(112, true)
+	var fresh, reused, userStack uint64
+	runtime.SetSpanReuseObserver(func(spanClass uint8, r bool) {
+		if !runtime.OnSystemStack() {
+			atomic.AddUint64(&userStack, 1)
+		}
+		if spanClass != spc {
+			return
+		}
+		if r {
+			atomic.AddUint64(&reused, 1)
+		} else {
+			atomic.AddUint64(&fresh, 1)
+		}
+	})
+	defer runtime.SetSpanReuseObserver(nil)
+
+	const objects = 10000
+	alloc := func() {
+		spanReuseSink = make([]*[112]byte, objects)
+		for i := range spanReuseSink {
+			spanReuseSink[i] = new([112]byte)
+		}
+	}
+	alloc()
+	// Keep one object in ten, so that the spans are left partly
+	// free rather than returned to the heap.
+	for i := range spanReuseSink {
+		if i%10 != 0 {
+			spanReuseSink[i] = nil
+		}
+	}
+	runtime.GC()
+	atomic.StoreUint64(&fresh, 0)
+	atomic.StoreUint64(&reused, 0)
+
+	keep := spanReuseSink
+	alloc()
+	runtime.KeepAlive(keep)
+	spanReuseSink = nil
+
+	r, f := atomic.LoadUint64(&reused), atomic.LoadUint64(&fresh)
+	t.Logf("second round: %d reused spans, %d fresh spans", r, f)
+	if r == 0 {
+		t.Errorf("observer reported no reused spans on the second round")
+	}
+	if n := atomic.LoadUint64(&userStack); n != 0 {
+		t.Errorf("observer called %d times on a goroutine stack, want on the system stack", n)
+	}
+}
+
+func TestMcacheStaleObserver(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	var stale, badPid uint32
+	runtime.SetMcacheStaleObserver(func(pid int32) {
+		atomic.AddUint32(&stale, 1)
+		if pid < 0 || pid >= 4 {
+			atomic.AddUint32(&badPid, 1)
+		}
+	})
+	defer runtime.SetMcacheStaleObserver(nil)
+
+	// Keep other P's busy so that they are stopped and handed back
+	// to threads across each collection, picking up caches left over
+	// from the previous cycle.
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	if atomic.LoadUint32(&stale) == 0 {
+		t.Error("no stale mcaches observed across garbage collections")
+	}
+
+	// Now leave P's idle across collections, and have goroutines
+	// that sleep briefly pick them up again, while GOMAXPROCS
+	// changes hand P's out with the scheduler lock held.
+	stop = make(chan bool)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(100 * time.Microsecond):
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		runtime.GOMAXPROCS(2 + i%3)
+		time.Sleep(time.Millisecond)
+	}
+	runtime.GOMAXPROCS(4)
+	close(stop)
+	wg.Wait()
+
+	if n := atomic.LoadUint32(&badPid); n != 0 {
+		t.Errorf("observer was passed an invalid P ID %d times", n)
+	}
+}
+
+func TestSTWPauseWarn(t *testing.T) {
+	// The observer may not allocate or write pointers to the heap, so
+	// count the warnings by reason and record the pauses in a
+	// preallocated array.
+	reasons := []string{"GC sweep termination", "GC mark termination"}
+	var (
+		n      uint32
+		counts [3]uint32 // for each of reasons, then other reasons
+		pauses [16]int64
+	)
+	runtime.SetSTWObserver(func(reason string, nanos int64) {
+		j := 0
+		for j < len(reasons) && reasons[j] != reason {
+			j++
+		}
+		atomic.AddUint32(&counts[j], 1)
+		if i := atomic.AddUint32(&n, 1) - 1; i < uint32(len(pauses)) {
+			pauses[i] = nanos
+		}
+	})
+	defer runtime.SetSTWObserver(nil)
+	runtime.SetSTWPauseWarnThreshold(1)
+	defer runtime.SetSTWPauseWarnThreshold(0)
+
+	start := time.Now()
+	runtime.GC()
+	elapsed := time.Since(start)
+	runtime.SetSTWPauseWarnThreshold(int64(time.Hour))
+
+	got := int(atomic.LoadUint32(&n))
+	if got > len(pauses) {
+		got = len(pauses)
+	}
+	for i := 0; i < got; i++ {
+		if pauses[i] <= 0 || time.Duration(pauses[i]) > elapsed {
+			t.Errorf("pause of %v; want positive and at most the %v taken by GC", time.Duration(pauses[i]), elapsed)
+		}
+	}
+	for j, reason := range reasons {
+		if atomic.LoadUint32(&counts[j]) == 0 {
+			t.Errorf("no warning for %q", reason)
+		}
+	}
+
+	// With a high threshold nothing is reported.
+	atomic.StoreUint32(&n, 0)
+	runtime.GC()
+	runtime.SetSTWObserver(nil)
+	if got := atomic.LoadUint32(&n); got != 0 {
+		t.Errorf("got %d warnings with a one hour threshold", got)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	got := runTestProg(t, "testprog", "MemoryLimit", "GOGC=off")
+	if want := "OK\n"; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestHeapPoison(t *testing.T) {
+	got := runTestProg(t, "testprog", "HeapPoison", "GODEBUG=heappoison=1")
+	if want := "OK\n"; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	got = runTestProg(t, "testprog", "HeapPoisonWriteAfterFree", "GODEBUG=heappoison=1")
+	if want := "fatal error: heap poison overwritten"; !strings.Contains(got, want) {
+		t.Fatalf("want output containing %q, got:\n%s", want, got)
+	}
+	if want := "runtime: write at "; !strings.Contains(got, want) {
+		t.Errorf("want output containing %q, got:\n%s", want, got)
+	}
+}
+
+func TestSpanTrace(t *testing.T) {
+	got := runTestProg(t, "testprog", "SpanTrace", "GODEBUG=spantrace=4")
+	if want := "OK\n"; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	// Corruption detected in a span prints the allocations into it.
+	got = runTestProg(t, "testprog", "HeapPoisonWriteAfterFree", "GODEBUG=heappoison=1,spantrace=4")
+	if want := "allocations into span"; !strings.Contains(got, want) {
+		t.Fatalf("want output containing %q, got:\n%s", want, got)
+	}
+	if want := "main.HeapPoisonWriteAfterFree"; !strings.Contains(got, want) {
+		t.Errorf("want output containing %q, got:\n%s", want, got)
+	}
+}
+
+func TestGCNotifier(t *testing.T) {
+	reports := make(chan runtime.GCCycleReport, 1)
+	runtime.SetGCNotifier(func(r runtime.GCCycleReport) {
+		select {
+		case reports <- r:
+		default:
+		}
+	})
+	defer runtime.SetGCNotifier(nil)
+
+	var ms runtime.MemStats
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		var r runtime.GCCycleReport
+		select {
+		case r = <-reports:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no report after GC")
+		}
+		if r.NumGC != ms.NumGC {
+			// A report from before this GC; try again.
+			continue
+		}
+		if !r.Forced {
+			t.Errorf("cycle started by GC not reported as forced")
+		}
+		if r.HeapGoal == 0 || r.NextGC != ms.NextGC {
+			t.Errorf("heap goal %d, next GC %d; want nonzero goal and next GC %d", r.HeapGoal, r.NextGC, ms.NextGC)
+		}
+		if r.HeapMarked == 0 || r.HeapMarked > r.HeapMarkTerm+r.HeapStart {
+			t.Errorf("marked %d bytes of a heap of %d->%d bytes", r.HeapMarked, r.HeapStart, r.HeapMarkTerm)
+		}
+		if r.SweepTermNs < 0 || r.MarkNs < 0 || r.MarkTermNs < 0 || r.AssistCPUNs < 0 || r.BackgroundCPUNs < 0 || r.IdleCPUNs < 0 {
+			t.Errorf("negative time in report %+v", r)
+		}
+		if r.GOMAXPROCS != runtime.GOMAXPROCS(0) {
+			t.Errorf("GOMAXPROCS %d, want %d", r.GOMAXPROCS, runtime.GOMAXPROCS(0))
+		}
+		return
+	}
+	t.Fatalf("no report for the latest cycle")
+}
+
+func TestSTWObserver(t *testing.T) {
+	// The observer may not write pointers to the heap, so count the
+	// pauses by reason rather than record the reasons.
+	reasons := []string{"GC sweep termination", "GC mark termination", "GOMAXPROCS"}
+	var (
+		counts [4]uint32 // for each of reasons, then other reasons
+		bad    uint32    // pauses of non-positive length
+	)
+	runtime.SetSTWObserver(func(reason string, nanos int64) {
+		i := 0
+		for i < len(reasons) && reasons[i] != reason {
+			i++
+		}
+		atomic.AddUint32(&counts[i], 1)
+		if nanos <= 0 {
+			atomic.AddUint32(&bad, 1)
+		}
+	})
+	defer runtime.SetSTWObserver(nil)
+
+	runtime.GC()
+	procs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(procs + 1)
+	runtime.GOMAXPROCS(procs)
+	runtime.SetSTWObserver(nil)
+
+	for i, reason := range reasons {
+		if atomic.LoadUint32(&counts[i]) == 0 {
+			t.Errorf("no %q pause observed", reason)
+		}
+	}
+	if n := atomic.LoadUint32(&bad); n != 0 {
+		t.Errorf("%d pauses of non-positive length", n)
+	}
+}
+
+func TestReadWriteBarrierStats(t *testing.T) {
+	var before, after runtime.WriteBarrierStats
+	runtime.ReadWriteBarrierStats(&before)
+
+	// Write pointers into a heap object while collections run, so
+	// that the write barrier queues them.
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		x := make([]*int, 1024)
+		hugeSink = x
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for i := range x {
+				x[i] = new(int)
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		runtime.GC()
+		runtime.ReadWriteBarrierStats(&after)
+		if after.Pointers > before.Pointers || time.Now().After(deadline) {
+			break
+		}
+	}
+	close(stop)
+	<-done
+	hugeSink = nil
+
+	if after.Pointers == before.Pointers {
+		t.Fatal("no write barrier pointers were flushed")
+	}
+	if after.Flushes <= before.Flushes {
+		t.Errorf("flushes went from %d to %d, want an increase", before.Flushes, after.Flushes)
+	}
+	if n := runtime.GOMAXPROCS(0); len(after.Procs) != n {
+		t.Fatalf("got stats for %d P's, want %d", len(after.Procs), n)
+	}
+	var sum runtime.WriteBarrierPStats
+	for _, p := range after.Procs {
+		sum.Flushes += p.Flushes
+		sum.Pointers += p.Pointers
+		sum.Greyed += p.Greyed
+	}
+	if sum.Flushes > after.Flushes || sum.Pointers > after.Pointers || sum.Greyed > after.Greyed {
+		t.Errorf("per-P counts %+v exceed totals %+v", sum, after)
+	}
+	if after.Greyed > after.Pointers {
+		t.Errorf("greyed %d objects from only %d pointers", after.Greyed, after.Pointers)
+	}
+}
@@ -464,6 +464,17 @@ func dumproots() {
 
 	// Finalizer queue
 	iterate_finq(finq_callback)
+
+	// Unsealed Arena chunks
+	for a := userArenas.head; a != nil; a = a.next {
+		for s := a.chunks; s != nil; s = s.next {
+			for p := s.base(); p < s.limit; p += sys.PtrSize {
+				if userArenaIsPointer(s, p) {
+					dumpotherroot("Arena", *(*unsafe.Pointer)(unsafe.Pointer(p)))
+				}
+			}
+		}
+	}
 }
 
 // Bit vector of free marks.
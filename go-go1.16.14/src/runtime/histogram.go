@@ -114,6 +114,51 @@ func (h *timeHistogram) record(duration int64) {
 	atomic.Xadd64(&h.counts[superBucket*timeHistNumSubBuckets+subBucket], 1)
 }
 
+// reset clears h. It is not atomic with respect to concurrent calls
+// to record.
+func (h *timeHistogram) reset() {
+	for i := range h.counts {
+		atomic.Store64(&h.counts[i], 0)
+	}
+	atomic.Store64(&h.underflow, 0)
+}
+
+// quantile returns an upper bound, in nanoseconds, on the q'th
+// quantile (0 < q <= 1) of the durations recorded in h, or 0 if h is
+// empty. Negative durations count as 0.
+func (h *timeHistogram) quantile(q float64) int64 {
+	var counts [len(h.counts)]uint64
+	total := atomic.Load64(&h.underflow)
+	for i := range h.counts {
+		counts[i] = atomic.Load64(&h.counts[i])
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(total))
+	if rank == 0 {
+		rank = 1
+	}
+	seen := atomic.Load64(&h.underflow)
+	if seen >= rank {
+		return 0
+	}
+	buckets := timeHistogramMetricsBuckets()
+	for i, c := range counts {
+		seen += c
+		if seen >= rank {
+			// counts[i] is the bucket [buckets[i+1], buckets[i+2]).
+			upper := buckets[i+2]
+			if upper == float64Inf() {
+				upper = buckets[i+1]
+			}
+			return int64(upper * 1e9)
+		}
+	}
+	return int64(buckets[len(buckets)-2] * 1e9)
+}
+
 const (
 	fInf    = 0x7FF0000000000000
 	fNegInf = 0xFFF0000000000000
@@ -60,6 +60,9 @@ func lock2(l *mutex) {
 	// Speculative grab for lock.
 	v := atomic.Xchg(key32(&l.key), mutex_locked)
 	if v == mutex_unlocked {
+		if debug.runtimelockprofile > 0 {
+			runtimeLockAcquired(l, 0)
+		}
 		return
 	}
 
@@ -71,6 +74,7 @@ func lock2(l *mutex) {
 	// returning, to ensure that the sleeping thread gets
 	// its wakeup call.
 	wait := v
+	t0 := runtimeLockProfileStart()
 
 	// On uniprocessors, no point spinning.
 	// On multiprocessors, spin for ACTIVE_SPIN attempts.
@@ -83,6 +87,9 @@ func lock2(l *mutex) {
 		for i := 0; i < spin; i++ {
 			for l.key == mutex_unlocked {
 				if atomic.Cas(key32(&l.key), mutex_unlocked, wait) {
+					if debug.runtimelockprofile > 0 {
+						runtimeLockAcquired(l, t0)
+					}
 					return
 				}
 			}
@@ -93,6 +100,9 @@ func lock2(l *mutex) {
 		for i := 0; i < passive_spin; i++ {
 			for l.key == mutex_unlocked {
 				if atomic.Cas(key32(&l.key), mutex_unlocked, wait) {
+					if debug.runtimelockprofile > 0 {
+						runtimeLockAcquired(l, t0)
+					}
 					return
 				}
 			}
@@ -102,6 +112,9 @@ func lock2(l *mutex) {
 		// Sleep.
 		v = atomic.Xchg(key32(&l.key), mutex_sleeping)
 		if v == mutex_unlocked {
+			if debug.runtimelockprofile > 0 {
+				runtimeLockAcquired(l, t0)
+			}
 			return
 		}
 		wait = mutex_sleeping
@@ -123,6 +136,9 @@ func unlock2(l *mutex) {
 	}
 
 	gp := getg()
+	if gp.m.lockProfHeldLen > 0 {
+		runtimeLockReleased(l, v == mutex_sleeping)
+	}
 	gp.m.locks--
 	if gp.m.locks < 0 {
 		throw("runtime·unlock: lock count")
@@ -46,9 +46,13 @@ func lock2(l *mutex) {
 
 	// Speculative grab for lock.
 	if atomic.Casuintptr(&l.key, 0, locked) {
+		if debug.runtimelockprofile > 0 {
+			runtimeLockAcquired(l, 0)
+		}
 		return
 	}
 	semacreate(gp.m)
+	t0 := runtimeLockProfileStart()
 
 	// On uniprocessor's, no point spinning.
 	// On multiprocessors, spin for ACTIVE_SPIN attempts.
@@ -62,6 +66,9 @@ Loop:
 		if v&locked == 0 {
 			// Unlocked. Try to lock.
 			if atomic.Casuintptr(&l.key, v, v|locked) {
+				if debug.runtimelockprofile > 0 {
+					runtimeLockAcquired(l, t0)
+				}
 				return
 			}
 			i = 0
@@ -120,6 +127,9 @@ func unlock2(l *mutex) {
 			}
 		}
 	}
+	if gp.m.lockProfHeldLen > 0 {
+		runtimeLockReleased(l, mp != nil)
+	}
 	gp.m.locks--
 	if gp.m.locks < 0 {
 		throw("runtime·unlock: lock count")
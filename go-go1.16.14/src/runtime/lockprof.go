@@ -0,0 +1,251 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Runtime lock contention profile.
+//
+// With GODEBUG=runtimelockprofile=N, lock2 samples one in N of the
+// acquisitions of runtime mutexes that find the mutex held, on average,
+// measuring how long they wait, and unlock2 samples one in N of the
+// releases of runtime mutexes that other threads are sleeping on,
+// measuring how long the mutex was held. For that, lock2 notes in the
+// M when it acquired each mutex, for up to a few mutexes held at once.
+// Waits are added up by the stack of the caller of lock, and holds by
+// the stack of the caller of unlock, in a fixed-size hash table that
+// is updated with atomic operations only: lock2 and unlock2 can't
+// allocate, and taking another lock there could recurse into lock2 or
+// deadlock. Samples for which the table has no room left are dropped.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"unsafe"
+)
+
+const (
+	runtimeLockProfSize  = 1024 // entries in runtimeLockProf
+	runtimeLockProfProbe = 16   // entries looked at for a stack
+	runtimeLockProfDepth = 16   // frames recorded for a stack
+)
+
+// runtimeLockProf holds the contended acquisitions of runtime locks,
+// by stack.
+var runtimeLockProf [runtimeLockProfSize]runtimeLockRecord
+
+type runtimeLockRecord struct {
+	count  uint64 // accessed atomically
+	cycles uint64 // accessed atomically
+	hash   uintptr
+	nstk   uint32 // 0 until stk is set; accessed atomically
+	stk    [runtimeLockProfDepth]uintptr
+}
+
+// runtimeLockHeld is a lock held by an M, with the time it was
+// acquired, for unlock2 to measure how long it was held.
+type runtimeLockHeld struct {
+	l  uintptr // *mutex
+	t0 int64
+}
+
+// runtimeLockProfileSample reports whether to record an event, one in
+// GODEBUG=runtimelockprofile=N on average.
+//go:nosplit
+func runtimeLockProfileSample() bool {
+	rate := debug.runtimelockprofile
+	return rate > 0 && (rate == 1 || fastrand()%uint32(rate) == 0)
+}
+
+// runtimeLockProfileStart returns the time at which lock2 started
+// waiting for a lock if it is to record the wait, or 0.
+//go:nosplit
+func runtimeLockProfileStart() int64 {
+	if !runtimeLockProfileSample() {
+		return 0
+	}
+	return cputicks()
+}
+
+// runtimeLockAcquired is called by lock2, while runtime lock profiling
+// is enabled, when it acquires l. t0 is the time at which lock2 started
+// waiting for l if it is to record the wait, or 0.
+//go:nosplit
+func runtimeLockAcquired(l *mutex, t0 int64) {
+	now := cputicks()
+	if t0 != 0 {
+		recordRuntimeLock(now - t0)
+	}
+	mp := getg().m
+	if n := mp.lockProfHeldLen; n < int32(len(mp.lockProfHeld)) {
+		mp.lockProfHeld[n] = runtimeLockHeld{uintptr(unsafe.Pointer(l)), now}
+		mp.lockProfHeldLen++
+	}
+}
+
+// runtimeLockReleased is called by unlock2 when it releases l while the
+// M holds locks noted by runtimeLockAcquired. contended says whether
+// other threads were sleeping on l, in which case the time l was held
+// is sampled.
+//go:nosplit
+func runtimeLockReleased(l *mutex, contended bool) {
+	mp := getg().m
+	for i := int32(0); i < mp.lockProfHeldLen; i++ {
+		h := &mp.lockProfHeld[i]
+		if h.l != uintptr(unsafe.Pointer(l)) {
+			continue
+		}
+		t0 := h.t0
+		mp.lockProfHeldLen--
+		*h = mp.lockProfHeld[mp.lockProfHeldLen]
+		if contended && runtimeLockProfileSample() {
+			recordRuntimeLock(cputicks() - t0)
+		}
+		return
+	}
+}
+
+// recordRuntimeLock records a wait for a lock, or a hold of a lock, of
+// the given duration, by the stack of the code that called lock or
+// unlock. It must be called, directly or through runtimeLockAcquired
+// or runtimeLockReleased, by lock2 or unlock2.
+//go:nosplit
+func recordRuntimeLock(cycles int64) {
+	if cycles < 0 {
+		cycles = 0
+	}
+	gp := getg()
+	pc := getcallerpc()
+	sp := getcallersp()
+	// Look at the stack, and do the rest, on the system stack, so that
+	// the stack doesn't grow while the lock is held.
+	systemstack(func() {
+		// Skip the frames of the lock implementation, which vary
+		// with inlining and with lock ranking: lockWithRank calls
+		// lock2 on the system stack when it checks lock ranks.
+		var stk [runtimeLockProfDepth + 8]uintptr
+		n := gentraceback(pc, sp, 0, gp, 0, &stk[0], len(stk), nil, nil, _TraceJumpStack)
+		skip := 0
+		for skip < n && isRuntimeLockFrame(stk[skip]) {
+			skip++
+		}
+		if n-skip > runtimeLockProfDepth {
+			n = skip + runtimeLockProfDepth
+		}
+		if n > skip {
+			addRuntimeLockSample(stk[skip:n], cycles)
+		}
+	})
+}
+
+// isRuntimeLockFrame reports whether pc, a PC recorded by gentraceback,
+// is in one of the functions that implement lock and unlock.
+func isRuntimeLockFrame(pc uintptr) bool {
+	f := findfunc(pc)
+	if !f.valid() {
+		return false
+	}
+	name := funcname(f)
+	if inldata := funcdata(f, _FUNCDATA_InlTree); inldata != nil {
+		// gentraceback records inlined calls as PCs one past
+		// their call site in the function they are inlined into.
+		if ix := pcdatavalue(f, _PCDATA_InlTreeIndex, pc-1, nil); ix >= 0 {
+			inltree := (*[1 << 20]inlinedCall)(inldata)
+			name = funcnameFromNameoff(f, inltree[ix].func_)
+		}
+	}
+	switch name {
+	case "runtime.lock", "runtime.lock2", "runtime.lockWithRank", "runtime.lockWithRank.func1",
+		"runtime.unlock", "runtime.unlock2", "runtime.unlockWithRank", "runtime.unlockWithRank.func1",
+		"runtime.runtimeLockAcquired", "runtime.runtimeLockReleased", "runtime.recordRuntimeLock",
+		"runtime.systemstack":
+		return true
+	}
+	return false
+}
+
+// addRuntimeLockSample adds a sample with stack stk and delay cycles to
+// runtimeLockProf.
+func addRuntimeLockSample(stk []uintptr, cycles int64) {
+	rate := uint64(debug.runtimelockprofile)
+	h := uintptr(0)
+	for _, pc := range stk {
+		h += pc
+		h += h << 10
+		h ^= h >> 6
+	}
+	h |= 1 // 0 marks unused entries
+	for i := uintptr(0); i < runtimeLockProfProbe; i++ {
+		r := &runtimeLockProf[(h+i)%runtimeLockProfSize]
+		switch atomic.Loaduintptr(&r.hash) {
+		case 0:
+			if !atomic.Casuintptr(&r.hash, 0, h) {
+				// Taken meanwhile; look at it again.
+				i--
+				continue
+			}
+			atomic.Store(&r.nstk, uint32(copy(r.stk[:], stk)))
+		case h:
+			// An entry still being filled in can't be compared,
+			// so stacks may be recorded twice.
+			n := atomic.Load(&r.nstk)
+			if n == 0 || !eqslice(r.stk[:n], stk) {
+				continue
+			}
+		default:
+			continue
+		}
+		atomic.Xadd64(&r.count, int64(rate))
+		atomic.Xadd64(&r.cycles, int64(uint64(cycles)*rate))
+		return
+	}
+}
+
+// RuntimeLockProfile returns n, the number of records in the profile of
+// contention on the runtime's internal locks that GODEBUG=runtimelockprofile
+// enables. If len(p) >= n, RuntimeLockProfile copies the profile into p
+// and returns n, true. Otherwise, RuntimeLockProfile does not change p,
+// and returns n, false.
+//
+// Each record is either for acquisitions of locks from one stack that
+// had to wait for the lock, with the number of such acquisitions and
+// the time spent waiting, or for releases from one stack of locks that
+// other threads were waiting for, with the number of such releases and
+// the time the locks were held. Both are scaled up to account for
+// sampling. A wait record's stack starts at the caller of the runtime's
+// internal lock function, and a hold record's at the caller of its
+// unlock function.
+//
+// Most clients should use the runtime/pprof package's "runtimelock"
+// profile instead of calling RuntimeLockProfile directly.
+func RuntimeLockProfile(p []BlockProfileRecord) (n int, ok bool) {
+	for i := range runtimeLockProf {
+		if atomic.Load(&runtimeLockProf[i].nstk) != 0 {
+			n++
+		}
+	}
+	if n > len(p) {
+		return n, false
+	}
+	j := 0
+	for i := range runtimeLockProf {
+		r := &runtimeLockProf[i]
+		nstk := atomic.Load(&r.nstk)
+		if nstk == 0 {
+			continue
+		}
+		if j == n {
+			// Entries filled in since they were counted aren't
+			// copied.
+			break
+		}
+		br := &p[j]
+		br.Count = int64(atomic.Load64(&r.count))
+		br.Cycles = int64(atomic.Load64(&r.cycles))
+		k := copy(br.Stack0[:], r.stk[:nstk])
+		for ; k < len(br.Stack0); k++ {
+			br.Stack0[k] = 0
+		}
+		j++
+	}
+	return n, true
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeLockProfile(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	defer runtime.SetRuntimeLockProfileRate(runtime.SetRuntimeLockProfileRate(1))
+
+	// ContendRuntimeLock's goroutines wait at their call to lock and
+	// hold the lock, while the other waits, until their call to unlock,
+	// so there must be records starting at both calls.
+	found := make(map[uintptr]*runtime.BlockProfileRecord)
+	for i := 0; i < 10 && len(found) < 2; i++ {
+		runtime.ContendRuntimeLock(100)
+		n, _ := runtime.RuntimeLockProfile(nil)
+		p := make([]runtime.BlockProfileRecord, n+50)
+		n, ok := runtime.RuntimeLockProfile(p)
+		if !ok {
+			t.Fatalf("RuntimeLockProfile didn't fit in %d records", len(p))
+		}
+		for j := range p[:n] {
+			r := &p[j]
+			stk := r.Stack()
+			if len(stk) == 0 {
+				t.Fatalf("record with an empty stack")
+			}
+			// The stack starts at the caller of lock or unlock.
+			f := runtime.FuncForPC(stk[0] - 1)
+			if f != nil && strings.HasPrefix(f.Name(), "runtime.ContendRuntimeLock.") {
+				found[stk[0]] = r
+			}
+		}
+	}
+	if len(found) < 2 {
+		t.Fatalf("found records at %d calls in ContendRuntimeLock, want 2 (lock and unlock)", len(found))
+	}
+	for pc, r := range found {
+		if r.Count <= 0 || r.Cycles <= 0 {
+			file, line := runtime.FuncForPC(pc - 1).FileLine(pc - 1)
+			t.Errorf("record at %s:%d has count %d and cycles %d, want both > 0", file, line, r.Count, r.Cycles)
+		}
+	}
+}
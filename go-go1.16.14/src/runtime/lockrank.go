@@ -36,6 +36,7 @@ const (
 	lockRankSysmon
 	lockRankScavenge
 	lockRankForcegc
+	lockRankCoarseTimers
 	lockRankSweepWaiters
 	lockRankAssistQueue
 	lockRankCpuprof
@@ -84,6 +85,7 @@ const (
 
 	// Other leaf locks
 	lockRankGFree
+	lockRankTimeSlices
 	// Generally, hchan must be acquired before gscan. But in one specific
 	// case (in syncadjustsudogs from markroot after the g has been suspended
 	// by suspendG), we allow gscan to be acquired, and then an hchan lock. To
@@ -115,6 +117,7 @@ var lockNames = []string{
 	lockRankSysmon:       "sysmon",
 	lockRankScavenge:     "scavenge",
 	lockRankForcegc:      "forcegc",
+	lockRankCoarseTimers: "coarseTimers",
 	lockRankSweepWaiters: "sweepWaiters",
 	lockRankAssistQueue:  "assistQueue",
 	lockRankCpuprof:      "cpuprof",
@@ -160,8 +163,9 @@ var lockNames = []string{
 
 	lockRankGlobalAlloc: "globalAlloc.mutex",
 
-	lockRankGFree:     "gFree",
-	lockRankHchanLeaf: "hchanLeaf",
+	lockRankGFree:      "gFree",
+	lockRankTimeSlices: "timeSlices",
+	lockRankHchanLeaf:  "hchanLeaf",
 
 	lockRankNewmHandoff:   "newmHandoff.lock",
 	lockRankDebugPtrmask:  "debugPtrmask.lock",
@@ -195,6 +199,7 @@ var lockPartialOrder [][]lockRank = [][]lockRank{
 	lockRankSysmon:        {},
 	lockRankScavenge:      {lockRankSysmon},
 	lockRankForcegc:       {lockRankSysmon},
+	lockRankCoarseTimers:  {},
 	lockRankSweepWaiters:  {},
 	lockRankAssistQueue:   {},
 	lockRankCpuprof:       {},
@@ -225,7 +230,7 @@ var lockPartialOrder [][]lockRank = [][]lockRank{
 	lockRankRwmutexR: {lockRankSysmon, lockRankRwmutexW},
 
 	lockRankSpanSetSpine: {lockRankSysmon, lockRankScavenge, lockRankForcegc, lockRankAssistQueue, lockRankCpuprof, lockRankSweep, lockRankPollDesc, lockRankSched, lockRankAllg, lockRankAllp, lockRankTimers, lockRankItab, lockRankReflectOffs, lockRankNotifyList, lockRankTraceBuf, lockRankTraceStrings, lockRankHchan},
-	lockRankGscan:        {lockRankSysmon, lockRankScavenge, lockRankForcegc, lockRankSweepWaiters, lockRankAssistQueue, lockRankCpuprof, lockRankSweep, lockRankSched, lockRankTimers, lockRankItab, lockRankReflectOffs, lockRankHchan, lockRankFin, lockRankTraceBuf, lockRankTraceStrings, lockRankRoot, lockRankNotifyList, lockRankProf, lockRankGcBitsArenas, lockRankTrace, lockRankTraceStackTab, lockRankNetpollInit, lockRankSpanSetSpine},
+	lockRankGscan:        {lockRankSysmon, lockRankScavenge, lockRankForcegc, lockRankCoarseTimers, lockRankSweepWaiters, lockRankAssistQueue, lockRankCpuprof, lockRankSweep, lockRankSched, lockRankTimers, lockRankItab, lockRankReflectOffs, lockRankHchan, lockRankFin, lockRankTraceBuf, lockRankTraceStrings, lockRankRoot, lockRankNotifyList, lockRankProf, lockRankGcBitsArenas, lockRankTrace, lockRankTraceStackTab, lockRankNetpollInit, lockRankSpanSetSpine},
 	lockRankStackpool:    {lockRankSysmon, lockRankScavenge, lockRankSweepWaiters, lockRankAssistQueue, lockRankCpuprof, lockRankSweep, lockRankSched, lockRankPollDesc, lockRankTimers, lockRankItab, lockRankReflectOffs, lockRankHchan, lockRankFin, lockRankNotifyList, lockRankTraceBuf, lockRankTraceStrings, lockRankProf, lockRankGcBitsArenas, lockRankRoot, lockRankTrace, lockRankTraceStackTab, lockRankNetpollInit, lockRankRwmutexR, lockRankSpanSetSpine, lockRankGscan},
 	lockRankStackLarge:   {lockRankSysmon, lockRankAssistQueue, lockRankSched, lockRankItab, lockRankHchan, lockRankProf, lockRankGcBitsArenas, lockRankRoot, lockRankSpanSetSpine, lockRankGscan},
 	lockRankDefer:        {},
@@ -235,8 +240,9 @@ var lockPartialOrder [][]lockRank = [][]lockRank{
 	lockRankMheapSpecial: {lockRankSysmon, lockRankScavenge, lockRankAssistQueue, lockRankCpuprof, lockRankSweep, lockRankSched, lockRankAllg, lockRankAllp, lockRankTimers, lockRankItab, lockRankReflectOffs, lockRankNotifyList, lockRankTraceBuf, lockRankTraceStrings, lockRankHchan},
 	lockRankGlobalAlloc:  {lockRankProf, lockRankSpanSetSpine, lockRankMheap, lockRankMheapSpecial},
 
-	lockRankGFree:     {lockRankSched},
-	lockRankHchanLeaf: {lockRankGscan, lockRankHchanLeaf},
+	lockRankGFree:      {lockRankSched},
+	lockRankTimeSlices: {},
+	lockRankHchanLeaf:  {lockRankGscan, lockRankHchanLeaf},
 
 	lockRankNewmHandoff:   {},
 	lockRankDebugPtrmask:  {},
@@ -246,3 +252,27 @@ var lockPartialOrder [][]lockRank = [][]lockRank{
 	lockRankPollCache:     {},
 	lockRankDebug:         {},
 }
+
+// lockRankObserver, if non-nil, is called by the lock rank tracking code
+// each time a ranked lock is acquired or released. It is only called
+// when the runtime is built with the staticlockranking experiment.
+var lockRankObserver func(rank int, acquire bool)
+
+// SetLockRankObserver arranges for fn to be called each time the runtime
+// acquires or releases one of its internal locks, reporting the lock's
+// static rank (see the lockRank constants in lockrank.go) and whether
+// the lock was acquired or released. It is a debugging aid for work on
+// the runtime itself.
+//
+// Lock ranks are only tracked when the runtime is built with the
+// staticlockranking experiment (for example with
+// -tags goexperiment.staticlockranking); otherwise fn is never called
+// and lock operations pay nothing for it.
+//
+// fn is called on the system stack of the thread that owns the lock,
+// while runtime locks are held. It must not allocate, block, acquire
+// any lock (including by printing) or otherwise call into the runtime.
+// Passing nil removes the observer.
+func SetLockRankObserver(fn func(rank int, acquire bool)) {
+	lockRankObserver = fn
+}
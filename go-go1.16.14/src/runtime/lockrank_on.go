@@ -92,6 +92,9 @@ func lockWithRank(l *mutex, rank lockRank) {
 			checkRanks(gp, gp.m.locksHeld[i-1].rank, rank)
 		}
 		lock2(l)
+		if fn := lockRankObserver; fn != nil {
+			fn(int(rank), true)
+		}
 	})
 }
 
@@ -128,6 +131,9 @@ func acquireLockRank(rank lockRank) {
 		if i > 0 {
 			checkRanks(gp, gp.m.locksHeld[i-1].rank, rank)
 		}
+		if fn := lockRankObserver; fn != nil {
+			fn(int(rank), true)
+		}
 	})
 }
 
@@ -188,6 +194,9 @@ func unlockWithRank(l *mutex) {
 			println(gp.m.procid, ":", l.rank.String(), l.rank, l)
 			throw("unlock without matching lock acquire")
 		}
+		if fn := lockRankObserver; fn != nil {
+			fn(int(l.rank), false)
+		}
 		unlock2(l)
 	})
 }
@@ -212,6 +221,9 @@ func releaseLockRank(rank lockRank) {
 			println(gp.m.procid, ":", rank.String(), rank)
 			throw("lockRank release without matching lockRank acquire")
 		}
+		if fn := lockRankObserver; fn != nil {
+			fn(int(rank), false)
+		}
 	})
 }
 
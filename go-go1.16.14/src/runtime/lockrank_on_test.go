@@ -0,0 +1,54 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build goexperiment.staticlockranking
+
+package runtime_test
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLockRankObserver(t *testing.T) {
+	// The observer runs with runtime locks held, so record events
+	// into a fixed buffer without allocating or locking.
+	type event struct {
+		rank    int
+		acquire bool
+	}
+	var events [64]event
+	var n uint32
+	runtime.SetLockRankObserver(func(rank int, acquire bool) {
+		if rank != runtime.LockRankOuter && rank != runtime.LockRankInner {
+			return
+		}
+		if i := atomic.AddUint32(&n, 1) - 1; i < uint32(len(events)) {
+			events[i] = event{rank, acquire}
+		}
+	})
+	runtime.LockRankNested()
+	runtime.SetLockRankObserver(nil)
+
+	got := events[:]
+	if c := atomic.LoadUint32(&n); c < uint32(len(events)) {
+		got = events[:c]
+	}
+	want := []event{
+		{runtime.LockRankOuter, true},
+		{runtime.LockRankInner, true},
+		{runtime.LockRankInner, false},
+		{runtime.LockRankOuter, false},
+	}
+	k := 0
+	for _, e := range got {
+		if k < len(want) && e == want[k] {
+			k++
+		}
+	}
+	if k != len(want) {
+		t.Errorf("observed lock rank events %v, want subsequence %v", got, want)
+	}
+}
@@ -431,6 +431,8 @@ func mallocinit() {
 
 	testdefersizes()
 
+	youngSpansEnabled = haveexperiment("gennursery")
+
 	if heapArenaBitmapBytes&(heapArenaBitmapBytes-1) != 0 {
 		// heapBits expects modular arithmetic on bitmap
 		// addresses to work.
@@ -626,10 +628,205 @@ func mallocinit() {
 	}
 }
 
+// heapReserveMB, if set by the linker with
+//
+//	-ldflags=-X=runtime.heapReserveMB=N
+//
+// makes the heap reserve address space N MB at a time instead of a
+// whole heap arena at a time. N must be a power of two multiple of
+// pallocChunkBytes no larger than heapArenaBytes (a multiple of 4
+// between 4 and 64 on 64-bit non-Windows platforms). Arena metadata
+// still covers whole arenas, but small processes no longer reserve,
+// and on systems that charge for it commit, 64MB of address space for
+// their first few MB of heap.
+//
+// It is a linker-set string rather than a GODEBUG setting because the
+// heap's first reservation happens before the environment is read.
+var heapReserveMB string
+
+// heapReserveBytes is the granularity in which sysAlloc reserves heap
+// address space. It is set by heapReserveInit and not changed after.
+var heapReserveBytes uintptr = heapArenaBytes
+
+// heapReserveInit validates heapReserveMB and sets heapReserveBytes.
+// It must run before mallocinit.
+func heapReserveInit() {
+	if heapReserveMB == "" {
+		return
+	}
+	n, ok := atoi(heapReserveMB)
+	b := uintptr(n) << 20
+	if !ok || n <= 0 || b > heapArenaBytes || b%pallocChunkBytes != 0 || b&(b-1) != 0 {
+		print("runtime: ignoring heapReserveMB=", heapReserveMB, ": want a power of two multiple of ", pallocChunkBytes>>20, " no larger than ", heapArenaBytes>>20, "\n")
+		return
+	}
+	heapReserveBytes = b
+}
+
+// heapHintInit applies the GOHEAPHINT environment variable. It must
+// run after mallocinit and before the heap first grows, which is
+// before goenvs.
+func heapHintInit() {
+	s := earlyenv("GOHEAPHINT")
+	if s == "" {
+		return
+	}
+	addr, ok := uintptr(0), len(s) > 2 && s[:2] == "0x" && len(s) <= 2+2*sys.PtrSize
+	for i := 2; ok && i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9':
+			addr = addr<<4 | uintptr(c-'0')
+		case 'a' <= c && c <= 'f':
+			addr = addr<<4 | uintptr(c-'a'+10)
+		case 'A' <= c && c <= 'F':
+			addr = addr<<4 | uintptr(c-'A'+10)
+		default:
+			ok = false
+		}
+	}
+	if !ok {
+		print("runtime: ignoring GOHEAPHINT=", s, ": want a hexadecimal address such as 0x7f0000000000\n")
+		return
+	}
+	lock(&mheap_.lock)
+	mheap_.addArenaHint(addr)
+	unlock(&mheap_.lock)
+}
+
+//go:linkname setHeapHint runtime/debug.setHeapHint
+func setHeapHint(addr uintptr) {
+	// Run on the system stack since we grab the heap lock.
+	systemstack(func() {
+		lock(&mheap_.lock)
+		mheap_.addArenaHint(addr)
+		unlock(&mheap_.lock)
+	})
+}
+
+// addArenaHint makes addr, rounded up to a heap arena boundary, the
+// first place sysAlloc tries to reserve heap address space. If that
+// fails, sysAlloc discards the hint and falls back to the others as
+// usual. Hints are ignored in race mode, where the heap must stay in
+// the range the race detector expects.
+//
+// h.lock must be held.
+func (h *mheap) addArenaHint(addr uintptr) {
+	assertLockHeld(&h.lock)
+	if raceenabled {
+		return
+	}
+	hint := (*arenaHint)(h.arenaHintAlloc.alloc())
+	hint.addr = alignUp(addr, heapArenaBytes)
+	hint.next, h.arenaHints = h.arenaHints, hint
+}
+
+// Huge page policies for heap memory, for use with SetHugePagePolicy.
+const (
+	// HugePagesDefault leaves the use of huge pages for the heap
+	// to the operating system's transparent huge page settings.
+	HugePagesDefault = iota
+
+	// HugePagesNever keeps heap memory out of transparent huge
+	// pages.
+	HugePagesNever
+
+	// HugePagesTransparent asks for transparent huge pages to back
+	// heap memory, even if the system only uses them on request.
+	HugePagesTransparent
+
+	// HugePagesExplicit maps heap memory with explicit huge pages,
+	// such as Linux's hugetlbfs pages, which must be set aside by
+	// the system administrator. Heap memory is mapped as with
+	// HugePagesTransparent when there are none to spare. Free
+	// explicit huge pages can only be returned to the operating
+	// system whole, and on Linux only by kernels since 5.18, so the
+	// runtime only returns those that are entirely free, and keeps
+	// them all on older kernels.
+	HugePagesExplicit
+)
+
+// hugePagePolicy is the huge page policy for heap memory mapped from
+// now on. Accessed atomically.
+var hugePagePolicy uint32
+
+// SetHugePagePolicy sets the huge page policy for the heap memory the
+// runtime maps from now on to one of the HugePages constants. Memory
+// the heap already uses keeps its policy. It panics if policy is not
+// a valid policy.
+//
+// The policy can also be set for the whole life of the process with
+// the GODEBUG setting hugepages. Huge page policies only have an
+// effect on Linux.
+func SetHugePagePolicy(policy int) {
+	if policy < HugePagesDefault || policy > HugePagesExplicit {
+		panic("runtime: invalid huge page policy")
+	}
+	atomic.Store(&hugePagePolicy, uint32(policy))
+}
+
+// HugePagePolicy returns the huge page policy for newly mapped heap
+// memory set by SetHugePagePolicy or GODEBUG=hugepages.
+func HugePagePolicy() int {
+	return int(atomic.Load(&hugePagePolicy))
+}
+
+// hugePagesInit applies GODEBUG=hugepages. The heap has already mapped
+// memory by the time GODEBUG is read, so the policy is applied to that
+// memory too, as far as it can be: memory that is already in use can
+// only be advised to use transparent huge pages.
+func hugePagesInit() {
+	policy := debug.hugepages
+	if policy <= HugePagesDefault || policy > HugePagesExplicit {
+		return
+	}
+	atomic.Store(&hugePagePolicy, uint32(policy))
+	lock(&mheap_.lock)
+	for _, ri := range mheap_.allArenas {
+		base := unsafe.Pointer(arenaBase(ri))
+		if policy == HugePagesNever {
+			sysNoHugePage(base, heapArenaBytes)
+		} else {
+			sysHugePage(base, heapArenaBytes)
+		}
+	}
+	unlock(&mheap_.lock)
+}
+
+// sysMapHeap transitions the heap memory at [v, v+n) from Reserved to
+// Prepared following the huge page policy, and reports whether it was
+// mapped with explicit huge pages.
+func sysMapHeap(v unsafe.Pointer, n uintptr) bool {
+	switch atomic.Load(&hugePagePolicy) {
+	case HugePagesNever:
+		sysMap(v, n, &memstats.heap_sys)
+		sysNoHugePage(v, n)
+	case HugePagesTransparent:
+		sysMap(v, n, &memstats.heap_sys)
+		sysHugePage(v, n)
+	case HugePagesExplicit:
+		if sysMapHuge(v, n, &memstats.heap_sys) {
+			return true
+		}
+		sysMap(v, n, &memstats.heap_sys)
+		sysHugePage(v, n)
+	default:
+		sysMap(v, n, &memstats.heap_sys)
+	}
+	return false
+}
+
+// chunkHugeTLB reports whether the heap memory at p is backed by
+// explicit huge pages.
+func chunkHugeTLB(p uintptr) bool {
+	ai := arenaIndex(p)
+	return mheap_.arenas[ai.l1()][ai.l2()].hugeTLB[p%heapArenaBytes/pallocChunkBytes]
+}
+
 // sysAlloc allocates heap arena space for at least n bytes. The
-// returned pointer is always heapArenaBytes-aligned and backed by
+// returned pointer is always heapReserveBytes-aligned and backed by
 // h.arenas metadata. The returned size is always a multiple of
-// heapArenaBytes. sysAlloc returns nil on failure.
+// heapReserveBytes. sysAlloc returns nil on failure.
 // There is no corresponding free function.
 //
 // sysAlloc returns a memory region in the Prepared state. This region must
@@ -639,10 +836,11 @@ func mallocinit() {
 func (h *mheap) sysAlloc(n uintptr) (v unsafe.Pointer, size uintptr) {
 	assertLockHeld(&h.lock)
 
-	n = alignUp(n, heapArenaBytes)
+	n = alignUp(n, heapReserveBytes)
+	hugeTLB := false
 
 	// First, try the arena pre-reservation.
-	v = h.arena.alloc(n, heapArenaBytes, &memstats.heap_sys)
+	v = h.arena.alloc(n, heapReserveBytes, &memstats.heap_sys)
 	if v != nil {
 		size = n
 		goto mapped
@@ -731,12 +929,12 @@ func (h *mheap) sysAlloc(n uintptr) (v unsafe.Pointer, size uintptr) {
 		}
 	}
 
-	if uintptr(v)&(heapArenaBytes-1) != 0 {
+	if uintptr(v)&(heapReserveBytes-1) != 0 {
 		throw("misrounded allocation in sysAlloc")
 	}
 
 	// Transition from Reserved to Prepared.
-	sysMap(v, size, &memstats.heap_sys)
+	hugeTLB = sysMapHeap(v, size)
 
 mapped:
 	// Create arena metadata.
@@ -752,7 +950,12 @@ mapped:
 		}
 
 		if l2[ri.l2()] != nil {
-			throw("arena already initialized")
+			if heapReserveBytes == heapArenaBytes {
+				throw("arena already initialized")
+			}
+			// The region extends an arena reserved in
+			// part earlier.
+			continue
 		}
 		var r *heapArena
 		r = (*heapArena)(h.heapArenaAlloc.alloc(unsafe.Sizeof(*r), sys.PtrSize, &memstats.gcMiscSys))
@@ -791,6 +994,15 @@ mapped:
 		atomic.StorepNoWB(unsafe.Pointer(&l2[ri.l2()]), unsafe.Pointer(r))
 	}
 
+	// Record which chunks are backed by explicit huge pages for
+	// sysUnused.
+	if hugeTLB {
+		for p := uintptr(v); p < uintptr(v)+size; p += pallocChunkBytes {
+			ai := arenaIndex(p)
+			h.arenas[ai.l1()][ai.l2()].hugeTLB[p%heapArenaBytes/pallocChunkBytes] = true
+		}
+	}
+
 	// Tell the race detector about the new heap memory.
 	if raceenabled {
 		racemapshadow(v, size)
@@ -1110,6 +1322,9 @@ func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer {
 				v, span, shouldhelpgc = c.nextFree(tinySpanClass) // 注释：必须在不可抢占的上下文中运行，否则c的所有者可能会更改。
 			}
 			x = unsafe.Pointer(v)
+			if debug.malloc && span.poisoned != 0 {
+				checkPoison(uintptr(v), maxTinySize)
+			}
 			(*[2]uint64)(x)[0] = 0 // 注释：清理地址对应的元素内存
 			(*[2]uint64)(x)[1] = 0 // 注释：清理地址对应的元素内存
 			// See if we need to replace the existing tiny block with the new one
@@ -1134,6 +1349,9 @@ func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer {
 				v, span, shouldhelpgc = c.nextFree(spc) // 注释：从mspan.allocBits中拿出64个放到快速缓存mspan.allocCache中并且踢出一个空块，返回空块、span地址、是否申请新span
 			}
 			x = unsafe.Pointer(v)
+			if debug.malloc && span.poisoned != 0 {
+				checkPoison(uintptr(v), size)
+			}
 			if needzero && span.needzero != 0 { // 注释：需要在分配前归零(零填充)，1是0否
 				memclrNoHeapPointers(unsafe.Pointer(v), size) // 注释：0填充ptr指针向后n个字节，初始化内存（清空内存，用于申请后的0填充动作，汇编实现）
 			}
@@ -1202,6 +1420,10 @@ func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer {
 		msanmalloc(x, size)
 	}
 
+	if debug.malloc && span.allocTrace != nil {
+		span.allocTrace.record()
+	}
+
 	mp.mallocing = 0
 	releasem(mp) // 注释：释放线程锁
 
@@ -1234,13 +1456,33 @@ func mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer {
 
 	if shouldhelpgc { // 注释：是否有新的span申请
 		if t := (gcTrigger{kind: gcTriggerHeap}); t.test() { // 注释：判断是否需要起开GC
-			gcStart(t) // 注释：开启GC
+			if gcStart(t) { // 注释：开启GC
+				if fn := gcTriggerAllocObserver; fn != nil {
+					fn(getg().goid, dataSize)
+				}
+			}
 		}
 	}
 
 	return x
 }
 
+// gcTriggerAllocObserver, if non-nil, is called by mallocgc when an
+// allocation starts a GC cycle.
+var gcTriggerAllocObserver func(goid int64, size uintptr)
+
+// SetGCTriggeringAllocObserver arranges for fn to be called each time an
+// allocation pushes the heap over the GC trigger and starts a garbage
+// collection cycle. fn is passed the ID of the allocating goroutine and
+// the size in bytes of the allocation.
+//
+// fn is called on the allocating goroutine, from within the allocator,
+// after the cycle has started. It must be short and must not allocate.
+// Passing nil removes the observer.
+func SetGCTriggeringAllocObserver(fn func(goid int64, size uintptr)) {
+	gcTriggerAllocObserver = fn
+}
+
 // implementation of new builtin
 // compiler (both frontend and SSA backend) knows the signature
 // of this function
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"internal/race"
 	"internal/testenv"
+	"math"
 	"os"
 	"os/exec"
 	"reflect"
@@ -70,7 +71,9 @@ func TestMemStats(t *testing.T) {
 		"HeapAlloc": {nz, le(1e10)}, "HeapSys": {nz, le(1e10)}, "HeapIdle": {le(1e10)},
 		"HeapInuse": {nz, le(1e10)}, "HeapReleased": {le(1e10)}, "HeapObjects": {nz, le(1e10)},
 		"StackInuse": {nz, le(1e10)}, "StackSys": {nz, le(1e10)},
-		"MSpanInuse": {nz, le(1e10)}, "MSpanSys": {nz, le(1e10)},
+		"StackLarge": {le(1e10)}, "StackGrows": {nz, le(1e10)}, "StackShrinks": {le(1e10)},
+		"StackBySize": nil,
+		"MSpanInuse":  {nz, le(1e10)}, "MSpanSys": {nz, le(1e10)},
 		"MCacheInuse": {nz, le(1e10)}, "MCacheSys": {nz, le(1e10)},
 		"BuckHashSys": {nz, le(1e10)}, "GCSys": {nz, le(1e10)}, "OtherSys": {nz, le(1e10)},
 		"NextGC": {nz, le(1e10)}, "LastGC": {nz},
@@ -241,6 +244,234 @@ func TestPhysicalMemoryUtilization(t *testing.T) {
 	}
 }
 
+func TestHeapReserve(t *testing.T) {
+	testenv.MustHaveGoRun(t)
+
+	exe, err := buildTestProg(t, "testprog", "-ldflags=-X=runtime.heapReserveMB=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := testenv.CleanCmdEnv(exec.Command(exe, "HeapReserve")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if want := "OK\n"; string(out) != want {
+		t.Fatalf("want %q, got %q", want, out)
+	}
+}
+
+func TestScavengeBytes(t *testing.T) {
+	// Free a large allocation so there is plenty of unscavenged
+	// memory, then release part of it.
+	mallocSinkBytes = make([]byte, 64<<20)
+	mallocSinkBytes = nil
+	GC()
+
+	var before, after MemStats
+	ReadMemStats(&before)
+	const n = 16 << 20
+	released := ScavengeBytes(n)
+	ReadMemStats(&after)
+
+	if released == 0 {
+		t.Fatal("no memory was released")
+	}
+	// The scavenger works a chunk at a time, so it may overshoot
+	// by up to one chunk.
+	if released > n+PallocChunkPages*PageSize {
+		t.Errorf("released %d bytes, want at most about %d", released, n)
+	}
+	if after.HeapReleased <= before.HeapReleased {
+		t.Errorf("HeapReleased did not grow: before %d, after %d", before.HeapReleased, after.HeapReleased)
+	}
+	if after.NumGC != before.NumGC {
+		t.Errorf("ScavengeBytes ran a GC")
+	}
+}
+
+func TestReadSizeClassStats(t *testing.T) {
+	const n = 10000
+	keep := make([]*[64]byte, n)
+	for i := range keep {
+		keep[i] = new([64]byte)
+	}
+
+	stats := ReadSizeClassStats(nil)
+	var found bool
+	for i, st := range stats {
+		if i > 0 && st.Size <= stats[i-1].Size {
+			t.Errorf("size classes out of order: %d after %d", st.Size, stats[i-1].Size)
+		}
+		if st.Unswept > st.Spans {
+			t.Errorf("size %d: %d unswept spans of %d", st.Size, st.Unswept, st.Spans)
+		}
+		if st.Size != 64 {
+			continue
+		}
+		found = true
+		if st.LiveObjects < n {
+			t.Errorf("size 64: %d live objects, want at least %d", st.LiveObjects, n)
+		}
+		if st.TotalAlloc < n*64 {
+			t.Errorf("size 64: %d bytes allocated, want at least %d", st.TotalAlloc, n*64)
+		}
+		if min := uint64(n * 64 / 8192); st.Spans < min {
+			t.Errorf("size 64: %d spans, want at least %d", st.Spans, min)
+		}
+	}
+	if !found {
+		t.Fatal("no size class of 64 bytes")
+	}
+	KeepAlive(keep)
+
+	// The result reuses the caller's slice.
+	if again := ReadSizeClassStats(stats); &again[0] != &stats[0] {
+		t.Error("ReadSizeClassStats did not reuse its argument")
+	}
+}
+
+func TestReadFragmentation(t *testing.T) {
+	// Allocate enough objects to fill many spans, then free all but
+	// every sixteenth, which leaves those spans sparse.
+	const n = 16 << 10
+	objs := make([]*[80]byte, n)
+	for i := range objs {
+		objs[i] = new([80]byte)
+	}
+	for i := range objs {
+		if i%16 != 0 {
+			objs[i] = nil
+		}
+	}
+	GC()
+
+	frag := ReadFragmentation(nil)
+	var found bool
+	for i, f := range frag {
+		if i > 0 && f.Size <= frag[i-1].Size {
+			t.Errorf("size classes out of order: %d after %d", f.Size, frag[i-1].Size)
+		}
+		if f.Sparse > f.Spans {
+			t.Errorf("size %d: %d sparse spans of %d", f.Size, f.Sparse, f.Spans)
+		}
+		if f.Score < 0 || f.Score >= 1 || (f.Spans == 0 && f.Score != 0) {
+			t.Errorf("size %d: bad score %v for %d spans", f.Size, f.Score, f.Spans)
+		}
+		if f.Spans == 0 && f.Objects+f.FreeSlots != 0 {
+			t.Errorf("size %d: %d objects and %d free slots in no spans", f.Size, f.Objects, f.FreeSlots)
+		}
+		if f.Size != 80 {
+			continue
+		}
+		found = true
+		if f.Objects < n/16 {
+			t.Errorf("size 80: %d objects, want at least %d", f.Objects, n/16)
+		}
+		if f.Sparse == 0 || f.Score == 0 {
+			t.Errorf("size 80: %d sparse spans and score %v, want fragmentation", f.Sparse, f.Score)
+		}
+	}
+	if !found {
+		t.Fatal("no size class of 80 bytes")
+	}
+	KeepAlive(objs)
+
+	// The result reuses the caller's slice.
+	if again := ReadFragmentation(frag); &again[0] != &frag[0] {
+		t.Error("ReadFragmentation did not reuse its argument")
+	}
+}
+
+func TestYoungSpanSurvival(t *testing.T) {
+	// Sweep any spans allocated before the measurement was on.
+	GC()
+	defer SetYoungSpansEnabled(SetYoungSpansEnabled(true))
+
+	const n = 20000
+	allocs0, survived0, _ := ReadYoungSpanStats()
+	objs := make([]*[4]int64, n)
+	for i := range objs {
+		objs[i] = new([4]int64)
+	}
+	for i := range objs {
+		if i%10 != 0 {
+			objs[i] = nil
+		}
+	}
+	// The first GC finishes sweeping, which counts the survivors in
+	// the young spans.
+	GC()
+	allocs, survived, _ := ReadYoungSpanStats()
+	allocs -= allocs0
+	survived -= survived0
+	// Some of the objects went into spans with free slots left
+	// from before, which aren't young, but most need fresh spans.
+	if allocs < n/2 {
+		t.Errorf("%d young objects, want at least %d", allocs, n/2)
+	}
+	if survived*20 < allocs || survived*2 > allocs {
+		t.Errorf("%d of %d young objects survived, want at least a twentieth and at most half", survived, allocs)
+	}
+	KeepAlive(objs)
+}
+
+func TestLargePageCache(t *testing.T) {
+	// With one P, the sweep in GC and the allocations below all use
+	// the same P's cache.
+	defer GOMAXPROCS(GOMAXPROCS(1))
+	FlushLargePageCaches()
+
+	const size = 64 << 10
+	mallocSinkBytes = make([]byte, size)
+	base := uintptr(unsafe.Pointer(&mallocSinkBytes[0]))
+	mallocSinkBytes = nil
+	GC()
+	if !LargePageCacheContains(base) {
+		t.Fatalf("freed large object at %#x is not cached", base)
+	}
+
+	mallocSinkBytes = make([]byte, size)
+	if got := uintptr(unsafe.Pointer(&mallocSinkBytes[0])); got != base {
+		t.Errorf("large object allocated at %#x, want cached %#x", got, base)
+	}
+	if LargePageCacheContains(base) {
+		t.Errorf("reused pages at %#x are still cached", base)
+	}
+	for i := range mallocSinkBytes {
+		if mallocSinkBytes[i] != 0 {
+			t.Fatalf("reused large object not zeroed at offset %d", i)
+		}
+	}
+
+	// Flushing returns the pages to the heap.
+	mallocSinkBytes[0] = 1
+	mallocSinkBytes = nil
+	GC()
+	FlushLargePageCaches()
+	if LargePageCacheContains(base) {
+		t.Errorf("pages at %#x are cached after a flush", base)
+	}
+}
+
+func TestSetHugePagePolicy(t *testing.T) {
+	old := HugePagePolicy()
+	defer SetHugePagePolicy(old)
+
+	for _, policy := range []int{HugePagesNever, HugePagesTransparent, HugePagesExplicit, HugePagesDefault} {
+		SetHugePagePolicy(policy)
+		if got := HugePagePolicy(); got != policy {
+			t.Errorf("HugePagePolicy() = %d after setting %d", got, policy)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SetHugePagePolicy did not panic on an invalid policy")
+		}
+	}()
+	SetHugePagePolicy(HugePagesExplicit + 1)
+}
+
 func TestScavengedBitsCleared(t *testing.T) {
 	var mismatches [128]BitsMismatch
 	if n, ok := CheckScavengedBitsCleared(mismatches[:]); !ok {
@@ -453,3 +684,102 @@ func BenchmarkGoroutineIdle(b *testing.B) {
 	close(quit)
 	time.Sleep(10 * time.Millisecond)
 }
+
+func TestHeapGrowthRateLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large heap growth in short mode")
+	}
+	SetHeapGrowthRateLimit(8 << 30)
+	defer SetHeapGrowthRateLimit(0)
+
+	// Grow the heap steadily until the pre-grower notices and maps
+	// arena space ahead of us.
+	var stats MemStats
+	ReadMemStats(&stats)
+	sysBefore := stats.HeapSys
+	before := HeapPregrown()
+	var keep [][]byte
+	for total := 0; total < 512<<20 && HeapPregrown() == before; total += 4 << 20 {
+		keep = append(keep, make([]byte, 4<<20))
+		time.Sleep(time.Millisecond)
+	}
+	KeepAlive(keep)
+
+	pregrown := HeapPregrown() - before
+	if pregrown == 0 {
+		t.Fatal("heap address space was not grown ahead of allocation")
+	}
+	// The pre-grower maps whole arenas, which count in HeapSys.
+	if pregrown%(HeapPregrowMaxBudget/2) != 0 {
+		t.Errorf("pre-grew %d bytes, want a multiple of the arena size %d", pregrown, HeapPregrowMaxBudget/2)
+	}
+	ReadMemStats(&stats)
+	if stats.HeapSys < sysBefore+pregrown {
+		t.Errorf("HeapSys grew from %d to %d, want at least the %d bytes pre-grown", sysBefore, stats.HeapSys, pregrown)
+	}
+}
+
+func TestHeapPregrowCredit(t *testing.T) {
+	const max = HeapPregrowMaxBudget
+	for _, tt := range []struct {
+		budget, rate uint64
+		dt           int64
+		want         uint64
+	}{
+		{0, 1 << 20, 1e9, 1 << 20},
+		{1 << 20, 1 << 20, 5e8, 1<<20 + 1<<19},
+		{0, 1 << 20, -1, 0},
+		{max - 1, 1 << 20, 1e9, max},
+		// Long idle periods and huge rates saturate rather than
+		// overflow.
+		{0, 1 << 20, 1 << 62, 1 << 20},
+		{0, math.MaxUint64, 1e7, max},
+		{max, math.MaxUint64, math.MaxInt64, max},
+	} {
+		if got := HeapPregrowCredit(tt.budget, tt.rate, tt.dt); got != tt.want {
+			t.Errorf("HeapPregrowCredit(%d, %d, %d) = %d, want %d", tt.budget, tt.rate, tt.dt, got, tt.want)
+		}
+	}
+}
+
+func TestGCTriggeringAllocObserver(t *testing.T) {
+	if os.Getenv("GOGC") == "off" {
+		t.Skip("skipping test; GOGC=off in environment")
+	}
+	const size = 64 << 10
+	var triggers, wrongSize, allocGoid, ours int64
+	SetGCTriggeringAllocObserver(func(goid int64, n uintptr) {
+		atomic.AddInt64(&triggers, 1)
+		if goid == atomic.LoadInt64(&allocGoid) {
+			atomic.AddInt64(&ours, 1)
+			if n != size {
+				atomic.AddInt64(&wrongSize, 1)
+			}
+		}
+	})
+	defer SetGCTriggeringAllocObserver(nil)
+
+	done := make(chan bool)
+	go func() {
+		atomic.StoreInt64(&allocGoid, Goid())
+		var ms MemStats
+		ReadMemStats(&ms)
+		// Allocate until a few cycles have been triggered by
+		// this goroutine, or give up after allocating 64 times
+		// the current heap goal.
+		for limit := 64 * ms.NextGC; atomic.LoadInt64(&ours) < 3 && limit > 0; limit -= size {
+			mallocSinkBytes = make([]byte, size)
+		}
+		done <- true
+	}()
+	<-done
+
+	if atomic.LoadInt64(&ours) == 0 {
+		t.Fatalf("no GC cycle was attributed to the allocating goroutine (%d triggers total)", atomic.LoadInt64(&triggers))
+	}
+	if n := atomic.LoadInt64(&wrongSize); n != 0 {
+		t.Errorf("%d triggering allocations reported with the wrong size", n)
+	}
+}
+
+var mallocSinkBytes []byte
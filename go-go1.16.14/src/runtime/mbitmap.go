@@ -392,10 +392,42 @@ func badPointer(s *mspan, p, refBase, refOff uintptr) {
 		print("runtime: found in object at *(", hex(refBase), "+", hex(refOff), ")\n")
 		gcDumpObject("object", refBase, refOff)
 	}
+	printSpanAllocTrace(s)
 	getg().m.traceback = 2
 	throw("found bad pointer in Go heap (incorrect use of unsafe or cgo?)")
 }
 
+// pointerValidation is the function set by SetPointerValidation, or
+// nil if pointer validation is disabled.
+var pointerValidation func(ptr uintptr)
+
+// SetPointerValidation enables validation of the pointers the garbage
+// collector and the write barrier classify, reporting each bad pointer
+// found to fn. Passing nil disables validation, which is the default.
+//
+// The garbage collector and the write barrier look up the heap object
+// that each pointer they see refers to. A pointer into the heap's
+// address range that does not refer to an allocated object, typically
+// the result of incorrect use of unsafe or cgo, normally makes the
+// program crash with "found bad pointer in Go heap" (unless
+// GODEBUG=invalidptr=0 is set, in which case it is silently ignored).
+// Pointers outside the heap are normally ignored, even when they
+// cannot be valid. With validation enabled, the lookup also checks
+// that a pointer outside the heap lies within the address space the
+// heap may use and, if it points into a heap arena, that its page
+// belongs to a span. Bad pointers are reported to fn and then ignored,
+// so that a program can log them, or shut down in an orderly way.
+// Validation adds a check to every lookup of a pointer outside the
+// heap.
+//
+// fn may be called by the garbage collector or the write barrier,
+// possibly on the system stack and with runtime locks held. It must
+// not allocate, block or otherwise call into the runtime, and should
+// do as little as possible, such as recording the pointer for later.
+func SetPointerValidation(fn func(ptr uintptr)) {
+	pointerValidation = fn
+}
+
 // findObject returns the base address for the heap object containing
 // the address p, the object's span, and the index of the object in s.
 // If p does not point into a heap object, it returns base == 0.
@@ -415,6 +447,10 @@ func findObject(p, refBase, refOff uintptr) (base uintptr, s *mspan, objIndex ui
 	// If s is nil, the virtual address has never been part of the heap.
 	// This pointer may be to some mmap'd region, so we allow it.
 	if s == nil {
+		// With pointer validation, report it if it can't be.
+		if fn := pointerValidation; fn != nil && badArenaPointer(p) {
+			fn(p)
+		}
 		return
 	}
 	// If p is a bad pointer, it may not be in s's bounds.
@@ -426,6 +462,12 @@ func findObject(p, refBase, refOff uintptr) (base uintptr, s *mspan, objIndex ui
 		if state == mSpanManual {
 			return
 		}
+		// With pointer validation, report the bad pointer and
+		// treat it as not pointing into the heap.
+		if fn := pointerValidation; fn != nil {
+			fn(p)
+			return
+		}
 		// The following ensures that we are rigorous about what data
 		// structures hold valid pointers.
 		if debug.invalidptr != 0 {
@@ -618,6 +660,11 @@ func bulkBarrierPreWrite(dst, src, size uintptr) {
 			}
 		}
 		return
+	} else if s.userArena != 0 {
+		// dst is in an Arena chunk, whose pointer mask
+		// precedes its objects.
+		bulkBarrierBitmap(dst, src, size, dst-s.base(), (*uint8)(unsafe.Pointer(s.base())))
+		return
 	} else if s.state.get() != mSpanInUse || dst < s.base() || s.limit <= dst {
 		// dst was heap memory at some point, but isn't now.
 		// It can't be a global. It must be either our stack,
@@ -1935,6 +1982,45 @@ func dematerializeGCProg(s *mspan) {
 	mheap_.freeManual(s, spanAllocPtrScalarBits)
 }
 
+// userArenaSetPointers records in the pointer mask of Arena chunk s
+// that the n consecutive objects of type typ starting at x hold
+// pointers where typ does. The mask has one bit per word of the chunk,
+// starting at s.base(). Bits are only ever set, so the GC may read the
+// mask concurrently.
+func userArenaSetPointers(s *mspan, x uintptr, typ *_type, n uintptr) {
+	ptrmask := typ.gcdata
+	var progSpan *mspan
+	if typ.kind&kindGCProg != 0 {
+		systemstack(func() {
+			progSpan = materializeGCProg(typ.ptrdata, typ.gcdata)
+		})
+		ptrmask = (*byte)(unsafe.Pointer(progSpan.startAddr))
+	}
+	mask := (*byte)(unsafe.Pointer(s.base()))
+	nptr := typ.ptrdata / sys.PtrSize
+	w := (x - s.base()) / sys.PtrSize
+	for i := uintptr(0); i < n; i++ {
+		for j := uintptr(0); j < nptr; j++ {
+			if *addb(ptrmask, j/8)>>(j%8)&1 != 0 {
+				*addb(mask, (w+j)/8) |= 1 << ((w + j) % 8)
+			}
+		}
+		w += typ.size / sys.PtrSize
+	}
+	if progSpan != nil {
+		systemstack(func() {
+			dematerializeGCProg(progSpan)
+		})
+	}
+}
+
+// userArenaIsPointer reports whether the word at p in Arena chunk s
+// holds a pointer, according to the chunk's pointer mask.
+func userArenaIsPointer(s *mspan, p uintptr) bool {
+	w := (p - s.base()) / sys.PtrSize
+	return *addb((*byte)(unsafe.Pointer(s.base())), w/8)>>(w%8)&1 != 0
+}
+
 func dumpGCProg(p *byte) {
 	nptr := 0
 	for {
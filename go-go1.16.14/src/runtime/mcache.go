@@ -324,8 +324,9 @@ func (c *mcache) releaseAll() {
 
 // prepareForSweep flushes c if the system has entered a new sweep phase
 // since c was populated. This must happen between the sweep phase
-// starting and the first allocation from c.
-func (c *mcache) prepareForSweep() {
+// starting and the first allocation from c. It reports whether c was
+// stale and had to be flushed.
+func (c *mcache) prepareForSweep() bool {
 	// Alternatively, instead of making sure we do this on every P
 	// between starting the world and allocating on that P, we
 	// could leave allocate-black on, allow allocation to continue
@@ -335,7 +336,7 @@ func (c *mcache) prepareForSweep() {
 	// to avoid spilling mark bits into the *next* GC cycle.
 	sg := mheap_.sweepgen
 	if c.flushGen == sg {
-		return
+		return false
 	} else if c.flushGen != sg-2 {
 		println("bad flushGen", c.flushGen, "in prepareForSweep; sweepgen", sg)
 		throw("bad flushGen")
@@ -343,4 +344,70 @@ func (c *mcache) prepareForSweep() {
 	c.releaseAll()
 	stackcache_clear(c)
 	atomic.Store(&c.flushGen, mheap_.sweepgen) // Synchronizes with gcStart
+	return true
+}
+
+// mcacheStaleObserver, if non-nil, is called by acquirep when the
+// acquired P's mcache had to be flushed.
+var mcacheStaleObserver func(pid int32)
+
+// SetMcacheStaleObserver arranges for fn to be called each time a P is
+// picked up by a thread and finds its allocation cache stale, left
+// over from before the most recent garbage collection, so that the
+// cache has to be flushed before the P can allocate. fn is passed the
+// ID of the P. That happens to P's that the collector restarts the
+// world with and hands to other threads, and to idle P's picked up
+// before the collector gets to flush their caches itself, so frequent
+// calls mean the flushes are done on the allocation path.
+//
+// fn is called while the scheduler is handing the P to a thread,
+// possibly on the system stack, and possibly with the scheduler's
+// lock held, as when the world restarts or GOMAXPROCS changes. It
+// must not allocate, block or otherwise call into the runtime, and
+// should do as little as possible. Passing nil removes the observer.
+func SetMcacheStaleObserver(fn func(pid int32)) {
+	mcacheStaleObserver = fn
+}
+
+// mcacheFlushed totals what flushMCaches released. It is protected by
+// worldsema, though the forEachP callbacks add to it concurrently.
+var mcacheFlushed struct {
+	spans, stacks uintptr
+}
+
+//go:linkname flushMCaches runtime/debug.flushMCaches
+func flushMCaches() (spanBytes, stackBytes uint64) {
+	semacquire(&worldsema)
+	mcacheFlushed.spans, mcacheFlushed.stacks = 0, 0
+	systemstack(func() {
+		forEachP(func(_p_ *p) {
+			if c := _p_.mcache; c != nil {
+				s, st := c.flush()
+				atomic.Xadduintptr(&mcacheFlushed.spans, s)
+				atomic.Xadduintptr(&mcacheFlushed.stacks, st)
+			}
+		})
+	})
+	spanBytes, stackBytes = uint64(mcacheFlushed.spans), uint64(mcacheFlushed.stacks)
+	semrelease(&worldsema)
+	return
+}
+
+// flush returns c's cached spans to the mcentrals and its cached
+// stacks to the stack pool. It returns the bytes of free objects in
+// the spans and the bytes of stacks it released.
+//
+// The caller must own c, as forEachP's callbacks do.
+func (c *mcache) flush() (spanBytes, stackBytes uintptr) {
+	for _, s := range c.alloc {
+		if s != &emptymspan {
+			spanBytes += (uintptr(s.nelems) - uintptr(s.allocCount)) * s.elemsize
+		}
+	}
+	for order := range c.stackcache {
+		stackBytes += c.stackcache[order].size
+	}
+	c.releaseAll()
+	stackcache_clear(c)
+	return
 }
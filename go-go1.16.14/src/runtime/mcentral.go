@@ -12,7 +12,10 @@
 
 package runtime
 
-import "runtime/internal/atomic"
+import (
+	"runtime/internal/atomic"
+	_ "unsafe" // for go:linkname
+)
 
 // Central list of free objects of a given size.
 //
@@ -61,6 +64,70 @@ func (c *mcentral) init(spc spanClass) {
 	lockInit(&c.full[1].spineLock, lockRankSpanSetSpine)
 }
 
+// avoidSparseSpans is non-zero if cacheSpan should prefer fuller
+// partial spans over sparse ones. Set by runtime/debug.SetAvoidSparseSpans.
+var avoidSparseSpans uint32
+
+// sparseSpanTries is the number of swept partial spans cacheSpan
+// looks at for one that isn't sparse when avoidSparseSpans is set.
+const sparseSpanTries = 4
+
+// isSparse reports whether a span with n allocated objects is sparse:
+// at most a quarter full, and so a good candidate to be left alone
+// until its remaining objects die and the sweeper frees it.
+func (s *mspan) isSparse(n uint64) bool {
+	return n*4 <= uint64(s.nelems)
+}
+
+// skipSparse returns a swept partial span to allocate from in place
+// of s, preferring one that isn't sparse. Sparse spans that are passed
+// over go back on the end of the swept partial set, so they are only
+// allocated from when there is nothing fuller to use.
+func (c *mcentral) skipSparse(s *mspan, sg uint32) *mspan {
+	for i := 0; i < sparseSpanTries && s.isSparse(uint64(s.allocCount)); i++ {
+		next := c.partialSwept(sg).pop()
+		if next == nil {
+			break
+		}
+		c.partialSwept(sg).push(s)
+		s = next
+	}
+	return s
+}
+
+// remoteSpanTries is the number of swept partial spans cacheSpan
+// looks at for one on the P's NUMA node under GODEBUG=numaheap.
+const remoteSpanTries = 4
+
+// skipRemote returns a swept partial span to allocate from in place
+// of s, preferring one on the NUMA node of the current P. Spans on
+// other nodes that are passed over go back on the end of the swept
+// partial set, for the Ps on their nodes to pick up.
+func (c *mcentral) skipRemote(s *mspan, sg uint32) *mspan {
+	pp := getg().m.p.ptr()
+	if pp == nil || pp.numaNode < 0 {
+		return s
+	}
+	for i := 0; i < remoteSpanTries && spanNUMANode(s) != pp.numaNode; i++ {
+		next := c.partialSwept(sg).pop()
+		if next == nil {
+			break
+		}
+		c.partialSwept(sg).push(s)
+		s = next
+	}
+	return s
+}
+
+//go:linkname setAvoidSparseSpans runtime/debug.setAvoidSparseSpans
+func setAvoidSparseSpans(enable bool) bool {
+	var v uint32
+	if enable {
+		v = 1
+	}
+	return atomic.Xchg(&avoidSparseSpans, v) != 0
+}
+
 // partialUnswept returns the spanSet which holds partially-filled
 // unswept spans for this sweepgen.
 // 注释：每两个为一组（舍去一位然后取模）
@@ -137,10 +204,17 @@ func (c *mcentral) cacheSpan() *mspan {
 	spanBudget := 100 // 注释：考虑性能设置一个边界值，只在【未清理】中查找100次
 
 	var s *mspan
+	reused := true
 
 	// Try partial swept spans first.
 	// 注释：译：先尝试部分清扫跨度。
 	if s = c.partialSwept(sg).pop(); s != nil { // 注释：从部分清扫【有空闲、已清理】链表出栈span，如果有则直接返回
+		if atomic.Load(&avoidSparseSpans) != 0 {
+			s = c.skipSparse(s, sg)
+		}
+		if numaHeap.enabled {
+			s = c.skipRemote(s, sg)
+		}
 		goto havespan
 	}
 
@@ -195,6 +269,11 @@ func (c *mcentral) cacheSpan() *mspan {
 	if s == nil {
 		return nil
 	}
+	reused = false
+	if youngSpansEnabled {
+		// Everything allocated in a fresh span is young.
+		s.young = 1
+	}
 
 	// At this point s is a span that should have free slots.
 	// 注释：译：此时，s是一个应具有空闲插槽的跨度。
@@ -216,9 +295,35 @@ havespan:
 	// s.allocCache.
 	s.allocCache >>= s.freeindex % 64 // 注释：移除要被只用的空块，(s.freeindex是下一个空块的下标)
 
+	if fn := spanReuseObserver; fn != nil {
+		spc := uint8(c.spanclass)
+		systemstack(func() {
+			fn(spc, reused)
+		})
+	}
 	return s // 注释：返回mspan
 }
 
+// spanReuseObserver, if non-nil, is called by cacheSpan for each span
+// it hands to an mcache.
+var spanReuseObserver func(spanClass uint8, reused bool)
+
+// SetSpanReuseObserver arranges for fn to be called each time a span
+// is handed to a P's allocation cache to allocate small objects from,
+// reporting the span's class and whether it is a reused span, one that
+// already held objects and had free slots, rather than a fresh span
+// taken from the page heap. A high proportion of reused spans means
+// the allocator is filling in memory freed by the garbage collector
+// rather than spreading allocations over new memory. See
+// SetSpanSweepObserver for the encoding of span classes.
+//
+// fn is called on the allocation path, on the system stack. It must
+// not allocate, block or otherwise call into the runtime, and should do
+// as little as possible. Passing nil removes the observer.
+func SetSpanReuseObserver(fn func(spanClass uint8, reused bool)) {
+	spanReuseObserver = fn
+}
+
 // Return span from an mcache.
 //
 // s must have a span class corresponding to this
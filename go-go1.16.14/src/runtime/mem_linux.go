@@ -37,6 +37,18 @@ func sysAlloc(n uintptr, sysStat *sysMemStat) unsafe.Pointer {
 var adviseUnused = uint32(_MADV_FREE)
 
 func sysUnused(v unsafe.Pointer, n uintptr) {
+	if chunkHugeTLB(uintptr(v)) {
+		// Explicit huge pages can only be released whole.
+		// Kernels before 5.18 don't release them at all, in
+		// which case they stay resident.
+		beg := alignUp(uintptr(v), physHugePageSize)
+		end := alignDown(uintptr(v)+n, physHugePageSize)
+		if beg < end {
+			madvise(unsafe.Pointer(beg), end-beg, _MADV_DONTNEED)
+		}
+		return
+	}
+
 	// By default, Linux's "transparent huge page" support will
 	// merge pages into a huge page if there's even a single
 	// present regular page, undoing the effects of madvise(adviseUnused)
@@ -125,7 +137,26 @@ func sysUsed(v unsafe.Pointer, n uintptr) {
 	// the end points as well, but it's probably not worth
 	// the cost because when neighboring allocations are
 	// freed sysUnused will just set NOHUGEPAGE again.
-	sysHugePage(v, n)
+	if atomic.Load(&hugePagePolicy) != HugePagesNever {
+		sysHugePage(v, n)
+	}
+}
+
+// _MPOL_PREFERRED is the mbind mode that prefers one node but falls
+// back to others when it is out of memory.
+const _MPOL_PREFERRED = 1
+
+// sysNUMABind asks the kernel to place the pages of [v, v+n) on NUMA
+// node node, or on another node if that one is out of memory. It only
+// affects pages faulted in afterwards. Failures are ignored: the
+// placement is a preference, and mbind may be unimplemented or
+// forbidden by a seccomp policy.
+func sysNUMABind(v unsafe.Pointer, n uintptr, node int32) {
+	if node < 0 || node >= 64 {
+		return
+	}
+	mask := uint64(1) << uint(node)
+	mbind(v, n, _MPOL_PREFERRED, &mask, 64+1, 0)
 }
 
 func sysHugePage(v unsafe.Pointer, n uintptr) {
@@ -141,6 +172,23 @@ func sysHugePage(v unsafe.Pointer, n uintptr) {
 	}
 }
 
+// sysUnusedHugeTLB releases [v, v+n), which must be made of whole
+// explicit huge pages, and reports whether it could. Kernels before
+// 5.18 can't release explicit huge pages.
+func sysUnusedHugeTLB(v unsafe.Pointer, n uintptr) bool {
+	return madvise(v, n, _MADV_DONTNEED) == 0
+}
+
+func sysNoHugePage(v unsafe.Pointer, n uintptr) {
+	if physHugePageSize != 0 {
+		// Round v down and v+n up to huge page boundaries, so
+		// that no huge page overlapping the region is used.
+		beg := alignDown(uintptr(v), physHugePageSize)
+		end := alignUp(uintptr(v)+n, physHugePageSize)
+		madvise(unsafe.Pointer(beg), end-beg, _MADV_NOHUGEPAGE)
+	}
+}
+
 // Don't split the stack as this function may be invoked without a valid G,
 // which prevents us from allocating more stack.
 //go:nosplit
@@ -172,3 +220,22 @@ func sysMap(v unsafe.Pointer, n uintptr, sysStat *sysMemStat) {
 		throw("runtime: cannot map pages in arena address space")
 	}
 }
+
+// sysMapHuge is like sysMap, but backs [v, v+n) with explicit huge
+// pages. It reports whether it could, which it can't if v or n isn't
+// a multiple of the huge page size or the kernel has no huge pages to
+// spare.
+func sysMapHuge(v unsafe.Pointer, n uintptr, sysStat *sysMemStat) bool {
+	if physHugePageSize == 0 || uintptr(v)&(physHugePageSize-1) != 0 || n&(physHugePageSize-1) != 0 {
+		return false
+	}
+	p, err := mmap(v, n, _PROT_READ|_PROT_WRITE, _MAP_ANON|_MAP_FIXED|_MAP_PRIVATE|_MAP_HUGETLB, -1, 0)
+	if err != 0 || p != v {
+		// The kernel may have unmapped the reservation before
+		// failing. The caller maps [v, v+n) again with
+		// MAP_FIXED, which replaces whatever is left.
+		return false
+	}
+	sysStat.add(int64(n))
+	return true
+}
@@ -20,6 +20,8 @@ var (
 	metrics     map[string]metricData
 
 	sizeClassBuckets []float64
+	stackSizeBuckets []float64
+	netpollBuckets   []float64
 	timeHistBuckets  []float64
 )
 
@@ -63,6 +65,23 @@ func initMetrics() {
 	}
 	sizeClassBuckets = append(sizeClassBuckets, float64Inf())
 
+	// Stack sizes are powers of two, so each bucket holds one size,
+	// except the last, which holds all the larger ones.
+	stackSizeBuckets = make([]float64, numStackSizes, numStackSizes+1)
+	for i := range stackSizeBuckets {
+		stackSizeBuckets[i] = float64(uint64(_FixedStack) << i)
+	}
+	stackSizeBuckets = append(stackSizeBuckets, float64Inf())
+
+	// Bucket 0 counts polls that found no goroutines, bucket i polls
+	// that found [2^(i-1), 2^i) goroutines, and the last bucket all
+	// larger polls.
+	netpollBuckets = make([]float64, netpollReadyBuckets, netpollReadyBuckets+1)
+	for i := 1; i < len(netpollBuckets); i++ {
+		netpollBuckets[i] = float64(uint64(1) << (i - 1))
+	}
+	netpollBuckets = append(netpollBuckets, float64Inf())
+
 	timeHistBuckets = timeHistogramMetricsBuckets()
 	metrics = map[string]metricData{
 		"/gc/cycles/automatic:gc-cycles": {
@@ -142,7 +161,7 @@ func initMetrics() {
 				out.kind = metricKindUint64
 				out.scalar = uint64(in.heapStats.committed - in.heapStats.inHeap -
 					in.heapStats.inStacks - in.heapStats.inWorkBufs -
-					in.heapStats.inPtrScalarBits)
+					in.heapStats.inPtrScalarBits - in.heapStats.inUserArenas)
 			},
 		},
 		"/memory/classes/heap/objects:bytes": {
@@ -216,10 +235,10 @@ func initMetrics() {
 			},
 		},
 		"/memory/classes/other:bytes": {
-			deps: makeStatDepSet(sysStatsDep),
+			deps: makeStatDepSet(heapStatsDep, sysStatsDep),
 			compute: func(in *statAggregate, out *metricValue) {
 				out.kind = metricKindUint64
-				out.scalar = in.sysStats.otherSys
+				out.scalar = uint64(in.heapStats.inUserArenas) + in.sysStats.otherSys
 			},
 		},
 		"/memory/classes/profiling/buckets:bytes": {
@@ -245,6 +264,125 @@ func initMetrics() {
 				out.scalar = uint64(gcount())
 			},
 		},
+		"/sched/netpoll/blocking-polls:events": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&netpollStats.blocking)
+			},
+		},
+		"/sched/netpoll/breaks:events": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&netpollStats.breaks)
+			},
+		},
+		"/sched/netpoll/nonblocking-polls:events": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&netpollStats.nonblocking)
+			},
+		},
+		"/sched/netpoll/ready-by-poll:goroutines": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				hist := out.float64HistOrInit(netpollBuckets)
+				for i := range netpollStats.readyDist {
+					hist.counts[i] = atomic.Load64(&netpollStats.readyDist[i])
+				}
+			},
+		},
+		"/sched/netpoll/ready:goroutines": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&netpollStats.ready)
+			},
+		},
+		"/sched/stacks/grows:events": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(in.heapStats.stackGrows)
+			},
+		},
+		"/sched/stacks/inuse-by-size:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				hist := out.float64HistOrInit(stackSizeBuckets)
+				for i, count := range in.heapStats.stacksInUse {
+					hist.counts[i] = uint64(count)
+				}
+			},
+		},
+		"/sched/stacks/large:bytes": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(in.heapStats.largeStacks)
+			},
+		},
+		"/sched/stacks/shrinks:events": {
+			deps: makeStatDepSet(heapStatsDep),
+			compute: func(in *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(in.heapStats.stackShrinks)
+			},
+		},
+		"/sched/syscalls/retaken-same-p:events": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&syscallRetakenSameP)
+			},
+		},
+		"/sched/syscalls/retaken:events": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&syscallRetaken)
+			},
+		},
+		"/sched/threads/exited-idle:threads": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(atomic.Load(&sched.nmidleexit))
+			},
+		},
+		"/sched/threads/extra-hits:calls": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&extraMHits)
+			},
+		},
+		"/sched/threads/extra-misses:calls": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&extraMMisses)
+			},
+		},
+		"/sched/threads/idle:threads": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(atomic.Load((*uint32)(unsafe.Pointer(&sched.nmidle))))
+			},
+		},
+		"/sched/threads/peak:threads": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = uint64(atomic.Load((*uint32)(unsafe.Pointer(&sched.mpeak))))
+			},
+		},
+		"/sched/timers/adjust-latencies:seconds": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				hist := out.float64HistOrInit(timeHistBuckets)
+				hist.counts[0] = atomic.Load64(&adjustTimersDist.underflow)
+				for i := range adjustTimersDist.counts {
+					hist.counts[i+1] = atomic.Load64(&adjustTimersDist.counts[i])
+				}
+			},
+		},
+		"/sched/timers/stolen:events": {
+			compute: func(_ *statAggregate, out *metricValue) {
+				out.kind = metricKindUint64
+				out.scalar = atomic.Load64(&timersStolen)
+			},
+		},
 	}
 	metricsInit = true
 }
@@ -158,7 +158,7 @@ var allDesc = []Description{
 	},
 	{
 		Name:        "/memory/classes/other:bytes",
-		Description: "Memory used by execution trace buffers, structures for debugging the runtime, finalizer and profiler specials, and more.",
+		Description: "Memory used by execution trace buffers, structures for debugging the runtime, finalizer and profiler specials, Arena chunks, and more.",
 		Kind:        KindUint64,
 	},
 	{
@@ -176,6 +176,110 @@ var allDesc = []Description{
 		Description: "Count of live goroutines.",
 		Kind:        KindUint64,
 	},
+	{
+		Name:        "/sched/netpoll/blocking-polls:events",
+		Description: "Count of calls to the network poller by threads that had no other work and waited for network events or timers.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/netpoll/breaks:events",
+		Description: "Count of requests to wake a thread waiting in the network poller, for example because a timer was added that expires before the thread would wake.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/netpoll/nonblocking-polls:events",
+		Description: "Count of calls to the network poller that only check for network events without waiting, made by the scheduler and the system monitor.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/netpoll/ready-by-poll:goroutines",
+		Description: "Distribution of the number of goroutines made runnable by each call to the network poller.",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/netpoll/ready:goroutines",
+		Description: "Count of goroutines made runnable by the network poller.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/stacks/grows:events",
+		Description: "Count of goroutine stacks copied to a larger stack because they ran out of space.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/stacks/inuse-by-size:bytes",
+		Description: "Distribution of the sizes of goroutine stacks in use. Stacks of the smallest few sizes are allocated from per-size pools, and larger ones are counted by /sched/stacks/large:bytes.",
+		Kind:        KindFloat64Histogram,
+	},
+	{
+		Name:        "/sched/stacks/large:bytes",
+		Description: "Memory occupied by goroutine stacks in use that are too large for the per-size stack pools and have memory of their own.",
+		Kind:        KindUint64,
+	},
+	{
+		Name:        "/sched/stacks/shrinks:events",
+		Description: "Count of goroutine stacks copied to a smaller stack by the garbage collector because the goroutine used less than a quarter of the stack.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/syscalls/retaken-same-p:events",
+		Description: "Count of system calls during which the processor of the calling goroutine was handed to another thread, and after which the goroutine still continued on that processor. See runtime.SetSyscallReacquireSpin.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/syscalls/retaken:events",
+		Description: "Count of system calls during which the processor of the calling goroutine was handed to another thread.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/threads/exited-idle:threads",
+		Description: "Count of operating system threads made to exit because they were idle for longer than the duration set by runtime/debug.SetIdleThreadTimeout.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/threads/extra-hits:calls",
+		Description: "Count of calls into Go from threads not created by Go, such as cgo callbacks from C threads, that found an extra M ready to run on and left a spare one.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/threads/extra-misses:calls",
+		Description: "Count of calls into Go from threads not created by Go that took the last spare extra M, so that a new one had to be allocated. See runtime.PreallocateExtraMs.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/threads/idle:threads",
+		Description: "Count of operating system threads waiting for goroutines to run.",
+		Kind:        KindUint64,
+	},
+	{
+		Name:        "/sched/threads/peak:threads",
+		Description: "Highest count of operating system threads created by the runtime and alive at once.",
+		Kind:        KindUint64,
+	},
+	{
+		Name:        "/sched/timers/adjust-latencies:seconds",
+		Description: "Distribution of the time spent looking through a processor's timers for ones that were modified to run earlier or were stopped.",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/timers/stolen:events",
+		Description: "Count of timers run by a processor other than the one they were started on.",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
 }
 
 // All returns a slice of containing metric descriptions for all supported metrics.
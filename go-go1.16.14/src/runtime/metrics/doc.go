@@ -124,8 +124,8 @@ Below is the full list of supported metrics, ordered lexicographically.
 
 	/memory/classes/other:bytes
 		Memory used by execution trace buffers, structures for
-		debugging the runtime, finalizer and profiler specials, and
-		more.
+		debugging the runtime, finalizer and profiler specials, Arena
+		chunks, and more.
 
 	/memory/classes/profiling/buckets:bytes
 		Memory that is used by the stack trace hash map used for
@@ -139,5 +139,87 @@ Below is the full list of supported metrics, ordered lexicographically.
 
 	/sched/goroutines:goroutines
 		Count of live goroutines.
+
+	/sched/netpoll/blocking-polls:events
+		Count of calls to the network poller by threads that had no
+		other work and waited for network events or timers.
+
+	/sched/netpoll/breaks:events
+		Count of requests to wake a thread waiting in the network
+		poller, for example because a timer was added that expires
+		before the thread would wake.
+
+	/sched/netpoll/nonblocking-polls:events
+		Count of calls to the network poller that only check for
+		network events without waiting, made by the scheduler and
+		the system monitor.
+
+	/sched/netpoll/ready-by-poll:goroutines
+		Distribution of the number of goroutines made runnable by
+		each call to the network poller.
+
+	/sched/netpoll/ready:goroutines
+		Count of goroutines made runnable by the network poller.
+
+	/sched/stacks/grows:events
+		Count of goroutine stacks copied to a larger stack because
+		they ran out of space.
+
+	/sched/stacks/inuse-by-size:bytes
+		Distribution of the sizes of goroutine stacks in use. Stacks
+		of the smallest few sizes are allocated from per-size pools,
+		and larger ones are counted by /sched/stacks/large:bytes.
+
+	/sched/stacks/large:bytes
+		Memory occupied by goroutine stacks in use that are too
+		large for the per-size stack pools and have memory of their
+		own.
+
+	/sched/stacks/shrinks:events
+		Count of goroutine stacks copied to a smaller stack by the
+		garbage collector because the goroutine used less than a
+		quarter of the stack.
+
+	/sched/syscalls/retaken-same-p:events
+		Count of system calls during which the processor of the
+		calling goroutine was handed to another thread, and after which
+		the goroutine still continued on that processor. See
+		runtime.SetSyscallReacquireSpin.
+
+	/sched/syscalls/retaken:events
+		Count of system calls during which the processor of the
+		calling goroutine was handed to another thread.
+
+	/sched/threads/exited-idle:threads
+		Count of operating system threads made to exit because they
+		were idle for longer than the duration set by
+		runtime/debug.SetIdleThreadTimeout.
+
+	/sched/threads/extra-hits:calls
+		Count of calls into Go from threads not created by Go, such as
+		cgo callbacks from C threads, that found an extra M ready to
+		run on and left a spare one.
+
+	/sched/threads/extra-misses:calls
+		Count of calls into Go from threads not created by Go that took
+		the last spare extra M, so that a new one had to be allocated.
+		See runtime.PreallocateExtraMs.
+
+	/sched/threads/idle:threads
+		Count of operating system threads waiting for goroutines to
+		run.
+
+	/sched/threads/peak:threads
+		Highest count of operating system threads created by the
+		runtime and alive at once.
+
+	/sched/timers/adjust-latencies:seconds
+		Distribution of the time spent looking through a
+		processor's timers for ones that were modified to run
+		earlier or were stopped.
+
+	/sched/timers/stolen:events
+		Count of timers run by a processor other than the one they
+		were started on.
 */
 package metrics
@@ -5,10 +5,13 @@
 package runtime_test
 
 import (
+	"os"
 	"runtime"
+	"runtime/debug"
 	"runtime/metrics"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 	"unsafe"
@@ -102,6 +105,27 @@ func TestReadMetrics(t *testing.T) {
 			checkUint64(t, name, samples[i].Value.Uint64(), mstats.HeapObjects)
 		case "/gc/heap/goal:bytes":
 			checkUint64(t, name, samples[i].Value.Uint64(), mstats.NextGC)
+		case "/sched/stacks/grows:events":
+			checkUint64(t, name, samples[i].Value.Uint64(), mstats.StackGrows)
+		case "/sched/stacks/shrinks:events":
+			checkUint64(t, name, samples[i].Value.Uint64(), mstats.StackShrinks)
+		case "/sched/stacks/large:bytes":
+			checkUint64(t, name, samples[i].Value.Uint64(), mstats.StackLarge)
+		case "/sched/stacks/inuse-by-size:bytes":
+			hist := samples[i].Value.Float64Histogram()
+			if len(hist.Counts) != len(mstats.StackBySize) {
+				t.Errorf("%d stack size buckets, want %d", len(hist.Counts), len(mstats.StackBySize))
+				continue
+			}
+			for i, ss := range mstats.StackBySize {
+				if b, s := hist.Buckets[i], float64(ss.Size); b != s {
+					t.Errorf("bucket does not match stack size: got %f, want %f", b, s)
+					continue
+				}
+				if c, n := hist.Counts[i], ss.Count; c != n {
+					t.Errorf("histogram counts do not match StackBySize for size %d: got %d, want %d", ss.Size, c, n)
+				}
+			}
 		case "/gc/cycles/automatic:gc-cycles":
 			checkUint64(t, name, samples[i].Value.Uint64(), uint64(mstats.NumGC-mstats.NumForcedGC))
 		case "/gc/cycles/forced:gc-cycles":
@@ -221,6 +245,217 @@ func TestReadMetricsConsistency(t *testing.T) {
 	}
 }
 
+//go:noinline
+func metricsStackGrow(n int) int {
+	var buf [1024]byte
+	if n == 0 {
+		return int(buf[0])
+	}
+	return metricsStackGrow(n-1) + int(buf[n%len(buf)])
+}
+
+func TestReadMetricsStacks(t *testing.T) {
+	samples := []metrics.Sample{
+		{Name: "/sched/stacks/grows:events"},
+		{Name: "/sched/stacks/inuse-by-size:bytes"},
+		{Name: "/sched/stacks/large:bytes"},
+		{Name: "/sched/stacks/shrinks:events"},
+	}
+	read := func() (grows, stacks, large, shrinks uint64) {
+		metrics.Read(samples)
+		h := samples[1].Value.Float64Histogram()
+		if b, c := len(h.Buckets), len(h.Counts); b != c+1 {
+			t.Fatalf("inuse-by-size has wrong bucket or counts length: %d buckets, %d counts", b, c)
+		}
+		for _, c := range h.Counts {
+			stacks += c
+		}
+		return samples[0].Value.Uint64(), stacks, samples[2].Value.Uint64(), samples[3].Value.Uint64()
+	}
+
+	grows0, _, large0, shrinks0 := read()
+
+	// Grow a goroutine's stack well past the pooled sizes and leave
+	// it parked with most of its stack unused.
+	grown := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		metricsStackGrow(256)
+		grown <- true
+		<-done
+	}()
+	<-grown
+
+	grows1, stacks1, large1, _ := read()
+	if grows1 <= grows0 {
+		t.Errorf("stack grows went from %d to %d, want increase", grows0, grows1)
+	}
+	if large1 < large0+256<<10 {
+		t.Errorf("large stacks went from %d to %d bytes, want at least 256 KiB more", large0, large1)
+	}
+	if n := uint64(runtime.NumGoroutine()); stacks1 < n {
+		t.Errorf("%d stacks in use, want at least one per goroutine (%d)", stacks1, n)
+	}
+
+	// The GC shrinks the parked goroutine's stack.
+	runtime.GC()
+	if _, _, _, shrinks2 := read(); shrinks2 <= shrinks0 {
+		t.Errorf("stack shrinks went from %d to %d, want increase", shrinks0, shrinks2)
+	}
+	close(done)
+}
+
+func TestReadMetricsNetpoll(t *testing.T) {
+	switch runtime.GOOS {
+	case "js", "plan9", "windows":
+		t.Skipf("pipes don't use the network poller on %s", runtime.GOOS)
+	}
+	samples := []metrics.Sample{
+		{Name: "/sched/netpoll/blocking-polls:events"},
+		{Name: "/sched/netpoll/nonblocking-polls:events"},
+		{Name: "/sched/netpoll/ready-by-poll:goroutines"},
+		{Name: "/sched/netpoll/ready:goroutines"},
+	}
+	read := func() (polls, ready, readyByPoll uint64) {
+		metrics.Read(samples)
+		h := samples[2].Value.Float64Histogram()
+		if b, c := len(h.Buckets), len(h.Counts); b != c+1 {
+			t.Fatalf("ready-by-poll has wrong bucket or counts length: %d buckets, %d counts", b, c)
+		}
+		for i, c := range h.Counts[1:] {
+			readyByPoll += c * uint64(h.Buckets[i+1])
+		}
+		polls = samples[0].Value.Uint64() + samples[1].Value.Uint64()
+		return polls, samples[3].Value.Uint64(), readyByPoll
+	}
+
+	polls0, ready0, _ := read()
+
+	// Wake goroutines blocked reading pipes through the network poller.
+	for i := 0; i < 10; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan bool)
+		go func() {
+			var b [1]byte
+			r.Read(b[:])
+			done <- true
+		}()
+		time.Sleep(time.Millisecond)
+		w.Write([]byte{0})
+		<-done
+		r.Close()
+		w.Close()
+	}
+
+	polls1, ready1, readyByPoll1 := read()
+	if polls1 <= polls0 {
+		t.Errorf("network polls went from %d to %d, want increase", polls0, polls1)
+	}
+	if ready1 <= ready0 {
+		t.Errorf("goroutines readied by the network poller went from %d to %d, want increase", ready0, ready1)
+	}
+	// The histogram is read before the total, so the total includes
+	// every poll in it.
+	if readyByPoll1 > ready1 {
+		t.Errorf("ready-by-poll lower bounds add up to %d goroutines, more than the %d readied", readyByPoll1, ready1)
+	}
+}
+
+func TestReadMetricsTimers(t *testing.T) {
+	samples := []metrics.Sample{
+		{Name: "/sched/timers/adjust-latencies:seconds"},
+		{Name: "/sched/timers/stolen:events"},
+	}
+	read := func() (adjusts, stolen uint64) {
+		metrics.Read(samples)
+		for _, c := range samples[0].Value.Float64Histogram().Counts {
+			adjusts += c
+		}
+		return adjusts, samples[1].Value.Uint64()
+	}
+
+	adjusts0, stolen0 := read()
+
+	// Resetting a timer to run earlier makes the runtime look
+	// through the timers once the new time comes.
+	for i := 0; i < 10; i++ {
+		tm := time.NewTimer(time.Hour)
+		tm.Reset(time.Millisecond)
+		<-tm.C
+	}
+
+	adjusts1, stolen1 := read()
+	if adjusts1 <= adjusts0 {
+		t.Errorf("timer adjustments went from %d to %d, want increase", adjusts0, adjusts1)
+	}
+	if stolen1 < stolen0 {
+		t.Errorf("stolen timers went from %d to %d", stolen0, stolen1)
+	}
+}
+
+func TestReadMetricsThreads(t *testing.T) {
+	if runtime.GOOS == "plan9" || runtime.GOOS == "js" {
+		t.Skipf("idle threads don't exit on %s", runtime.GOOS)
+	}
+	samples := []metrics.Sample{
+		{Name: "/sched/threads/exited-idle:threads"},
+		{Name: "/sched/threads/idle:threads"},
+		{Name: "/sched/threads/peak:threads"},
+	}
+	read := func() (exited, idle, peak uint64) {
+		metrics.Read(samples)
+		return samples[0].Value.Uint64(), samples[1].Value.Uint64(), samples[2].Value.Uint64()
+	}
+
+	// Goroutines blocked while locked to their threads make the
+	// runtime start more threads, which go idle once the goroutines
+	// unlock and exit.
+	const n = 4
+	var wg sync.WaitGroup
+	ready := make(chan bool)
+	release := make(chan bool)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			ready <- true
+			<-release
+			runtime.UnlockOSThread()
+		}()
+		<-ready
+	}
+	close(release)
+	wg.Wait()
+
+	exited0, idle0, peak0 := read()
+	if peak0 < n {
+		t.Errorf("peak threads = %d, want at least %d", peak0, n)
+	}
+	if idle0 == 0 {
+		t.Errorf("idle threads = 0, want some")
+	}
+
+	old := debug.SetIdleThreadTimeout(time.Millisecond)
+	defer debug.SetIdleThreadTimeout(old)
+	for i := 0; ; i++ {
+		exited, idle, peak := read()
+		if exited > exited0 && idle < idle0 {
+			if peak < peak0 {
+				t.Errorf("peak threads went from %d to %d", peak0, peak)
+			}
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("idle threads went from %d to %d and exited idle threads from %d to %d, want idle threads to exit", idle0, idle, exited0, exited)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func BenchmarkReadMetricsLatency(b *testing.B) {
 	stop := applyGCLoad(b)
 
@@ -37,6 +37,13 @@ var fingwait bool
 var fingwake bool
 var allfin *finblock // list of all blocks
 
+// finregistered is the number of objects with a finalizer set, that
+// is, of specialfinalizer records on span specials lists, and
+// finqueued is the number of finalizers queued or running. Both are
+// updated atomically.
+var finregistered uint64
+var finqueued uint32
+
 // NOTE: Layout known to queuefinalizer.
 type finalizer struct {
 	fn   *funcval       // function to call (may be a heap pointer)
@@ -120,6 +127,10 @@ func queuefinalizer(p unsafe.Pointer, fn *funcval, nret uintptr, fint *_type, ot
 	f.ot = ot
 	f.arg = p
 	fingwake = true
+	if n := atomic.Xadd(&finqueued, +1); finAlarm.fn != nil && n > atomic.Load(&finAlarm.threshold) && atomic.Cas(&finAlarm.armed, 1, 0) {
+		finAlarm.queued = n
+		finAlarm.wake = true
+	}
 	unlock(&finlock)
 }
 
@@ -145,6 +156,20 @@ func wakefing() *g {
 	return res
 }
 
+// wakeFinalizerAlarm returns the finalizer alarm goroutine if it is
+// waiting and the backlog threshold has been crossed.
+func wakeFinalizerAlarm() *g {
+	var res *g
+	lock(&finlock)
+	if finAlarm.wait && finAlarm.wake {
+		finAlarm.wait = false
+		finAlarm.wake = false
+		res = finAlarm.g
+	}
+	unlock(&finlock)
+	return res
+}
+
 var (
 	fingCreate  uint32
 	fingRunning bool
@@ -180,6 +205,12 @@ func runfinq() {
 		if raceenabled {
 			racefingo()
 		}
+		observer := finalizerRunObserver
+		var start int64
+		if observer != nil {
+			start = nanotime()
+		}
+		count := 0
 		for fb != nil {
 			for i := fb.cnt; i > 0; i-- {
 				f := &fb.fin[i-1]
@@ -231,6 +262,10 @@ func runfinq() {
 				f.arg = nil
 				f.ot = nil
 				atomic.Store(&fb.cnt, i-1)
+				count++
+				if atomic.Xadd(&finqueued, -1) <= atomic.Load(&finAlarm.threshold) {
+					atomic.Store(&finAlarm.armed, 1)
+				}
 			}
 			next := fb.next
 			lock(&finlock)
@@ -239,6 +274,108 @@ func runfinq() {
 			unlock(&finlock)
 			fb = next
 		}
+		if observer != nil {
+			observer(nanotime()-start, count)
+		}
+	}
+}
+
+// finalizerRunObserver, if non-nil, is called by runfinq after each
+// batch of finalizers it runs.
+var finalizerRunObserver func(nanos int64, count int)
+
+// SetFinalizerRunObserver arranges for fn to be called each time the
+// finalizer goroutine finishes running a batch of finalizers, that is,
+// all the finalizers queued since it last ran. fn is passed the time
+// in nanoseconds it took to run the batch and the number of finalizers
+// in it. A long batch delays every finalizer queued behind it, and the
+// memory they keep alive.
+//
+// fn is called on the finalizer goroutine, so it may do a little work,
+// but while it runs no other finalizers can. Passing nil removes the
+// observer.
+func SetFinalizerRunObserver(fn func(nanos int64, count int)) {
+	finalizerRunObserver = fn
+}
+
+// FinalizerStats describes the finalizers of the program, as reported
+// by ReadFinalizerStats.
+type FinalizerStats struct {
+	// Registered is the number of objects with a finalizer set that
+	// the garbage collector has not yet found unreachable.
+	Registered uint64
+
+	// Queued is the number of finalizers of unreachable objects
+	// waiting to run on the finalizer goroutine, including any
+	// that is running.
+	Queued uint64
+}
+
+// ReadFinalizerStats populates s with statistics about finalizers.
+// The counts are maintained as finalizers are set, queued and run, so
+// reading them is cheap.
+func ReadFinalizerStats(s *FinalizerStats) {
+	s.Registered = atomic.Load64(&finregistered)
+	s.Queued = uint64(atomic.Load(&finqueued))
+}
+
+// finAlarm is the state of the finalizer backlog alarm. The fields
+// other than threshold and armed are protected by finlock.
+var finAlarm struct {
+	fn        func(queued int)
+	threshold uint32 // accessed atomically
+	armed     uint32 // fn may be called when threshold is crossed; accessed atomically
+	started   uint32 // g has been started; accessed atomically
+	queued    uint32 // length of the queue when the threshold was crossed
+	wait      bool   // g is parked waiting for wake
+	wake      bool   // the threshold was crossed
+	g         *g
+}
+
+// SetFinalizerBacklogAlarm arranges for fn to be called when the number
+// of finalizers queued to run exceeds threshold. Finalizers run one at
+// a time on a single goroutine, so a finalizer that blocks or runs slowly
+// delays all of those queued behind it, along with the resources they
+// would release. fn is passed the length of the queue when it crossed
+// threshold.
+//
+// fn is called on a dedicated goroutine, so it may block or allocate,
+// and it is not delayed by the finalizers themselves. It is called once
+// each time the queue grows past threshold: after a call, fn is not
+// called again until the queue has drained to threshold or fewer.
+// Passing a nil fn removes the alarm.
+func SetFinalizerBacklogAlarm(threshold int, fn func(queued int)) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	n := uint32(threshold)
+	if uint64(threshold) > 1<<32-1 {
+		n = 1<<32 - 1
+	}
+	lock(&finlock)
+	finAlarm.fn = fn
+	atomic.Store(&finAlarm.threshold, n)
+	atomic.Store(&finAlarm.armed, 1)
+	unlock(&finlock)
+	if fn != nil && atomic.Cas(&finAlarm.started, 0, 1) {
+		go finalizerAlarm()
+	}
+}
+
+// finalizerAlarm is the goroutine that calls the finalizer backlog
+// alarm. It is readied by findrunnable, like the finalizer goroutine.
+func finalizerAlarm() {
+	for {
+		lock(&finlock)
+		finAlarm.g = getg()
+		finAlarm.wait = true
+		goparkunlock(&finlock, waitReasonFinalizerAlarmIdle, traceEvGoBlock, 1)
+		lock(&finlock)
+		fn, queued := finAlarm.fn, finAlarm.queued
+		unlock(&finlock)
+		if fn != nil {
+			fn(int(queued))
+		}
 	}
 }
 
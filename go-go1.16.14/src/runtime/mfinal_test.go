@@ -262,3 +262,109 @@ func TestDeferKeepAlive(t *testing.T) {
 		t.Errorf("finalizer ran prematurely")
 	}
 }
+
+func TestFinalizerRunObserver(t *testing.T) {
+	type batch struct {
+		nanos int64
+		count int
+	}
+	batches := make(chan batch, 100)
+	runtime.SetFinalizerRunObserver(func(nanos int64, count int) {
+		select {
+		case batches <- batch{nanos, count}:
+		default:
+		}
+	})
+	defer runtime.SetFinalizerRunObserver(nil)
+
+	const (
+		n     = 5
+		delay = 2 * time.Millisecond
+	)
+	for i := 0; i < n; i++ {
+		// Use objects too big for the tiny allocator, whose
+		// finalizers may not run.
+		v := new([32]byte)
+		runtime.SetFinalizer(v, func(*[32]byte) {
+			time.Sleep(delay)
+		})
+	}
+	runtime.GC()
+
+	var count int
+	var nanos int64
+	timeout := time.After(5 * time.Second)
+	for count < n {
+		select {
+		case b := <-batches:
+			if b.count <= 0 {
+				t.Errorf("observer reported batch of %d finalizers", b.count)
+			}
+			count += b.count
+			nanos += b.nanos
+		case <-timeout:
+			t.Fatalf("observer reported %d finalizers run, want at least %d", count, n)
+		}
+	}
+	if min := int64(n * delay); nanos < min {
+		t.Errorf("observer reported %v for %d finalizers, want at least %v", time.Duration(nanos), count, time.Duration(min))
+	}
+}
+
+func TestReadFinalizerStats(t *testing.T) {
+	var before, set, cleared runtime.FinalizerStats
+	runtime.ReadFinalizerStats(&before)
+	const n = 10
+	vs := make([]*[32]byte, n)
+	for i := range vs {
+		vs[i] = new([32]byte)
+		runtime.SetFinalizer(vs[i], func(*[32]byte) {})
+	}
+	runtime.ReadFinalizerStats(&set)
+	for _, v := range vs {
+		runtime.SetFinalizer(v, nil)
+	}
+	runtime.ReadFinalizerStats(&cleared)
+
+	if got := set.Registered - before.Registered; got != n {
+		t.Errorf("setting %d finalizers registered %d", n, got)
+	}
+	if got := set.Registered - cleared.Registered; got != n {
+		t.Errorf("clearing %d finalizers unregistered %d", n, got)
+	}
+}
+
+func TestFinalizerBacklogAlarm(t *testing.T) {
+	alarms := make(chan int, 10)
+	runtime.SetFinalizerBacklogAlarm(20, func(queued int) {
+		select {
+		case alarms <- queued:
+		default:
+		}
+	})
+	defer runtime.SetFinalizerBacklogAlarm(0, nil)
+
+	// Stall the finalizer goroutine in the first finalizer so the
+	// rest back up behind it.
+	release := make(chan struct{})
+	defer close(release)
+	const n = 50
+	for i := 0; i < n; i++ {
+		v := new([32]byte)
+		runtime.SetFinalizer(v, func(*[32]byte) {
+			<-release
+		})
+	}
+	runtime.GC()
+
+	select {
+	case queued := <-alarms:
+		if queued <= 20 {
+			t.Errorf("alarm called with %d finalizers queued, want more than 20", queued)
+		}
+	case <-time.After(5 * time.Second):
+		var s runtime.FinalizerStats
+		runtime.ReadFinalizerStats(&s)
+		t.Fatalf("alarm not called with %d finalizers queued", s.Queued)
+	}
+}
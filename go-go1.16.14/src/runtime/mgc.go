@@ -246,6 +246,93 @@ func setGCPercent(in int32) (out int32) {
 	return out
 }
 
+// memoryLimit is the soft limit on the memory the runtime maps, set
+// by runtime/debug.SetMemoryLimit, or 1<<63-1 for no limit. Accessed
+// atomically.
+var memoryLimit uint64 = 1<<63 - 1
+
+// manualInUse is the bytes in manually-managed spans, that is,
+// goroutine stacks and GC metadata, which heap_sys does not count.
+// Accessed atomically.
+var manualInUse uint64
+
+const (
+	// memoryLimitHeadroomDivisor leaves 1/memoryLimitHeadroomDivisor
+	// of the memory limit as headroom for fragmentation and
+	// the memory allocated while a GC cycle runs.
+	memoryLimitHeadroomDivisor = 32
+
+	// memoryLimitGCPeriod is the minimum time in nanoseconds
+	// between GCs sysmon forces because the limit is exceeded.
+	memoryLimitGCPeriod = 10 * 1000 * 1000
+)
+
+//go:linkname setMemoryLimit runtime/debug.setMemoryLimit
+func setMemoryLimit(in int64) (out int64) {
+	// Run on the system stack since we grab the heap lock.
+	systemstack(func() {
+		lock(&mheap_.lock)
+		out = int64(atomic.Load64(&memoryLimit))
+		if in >= 0 {
+			atomic.Store64(&memoryLimit, uint64(in))
+			// Update pacing in response to the limit change,
+			// and have sysmon wake the scavenger in case
+			// it now has work to do.
+			gcSetTriggerRatio(memstats.triggerRatio)
+			readyForScavenger()
+		}
+		unlock(&mheap_.lock)
+	})
+	return out
+}
+
+// memoryMapped returns the memory the runtime has mapped and not
+// released to the OS, as counted against the memory limit.
+func memoryMapped() uint64 {
+	return heapRetained() + atomic.Load64(&manualInUse) +
+		memstats.stacks_sys.load() + memstats.mspan_sys.load() +
+		memstats.mcache_sys.load() + memstats.buckhash_sys.load() +
+		memstats.gcMiscSys.load() + memstats.other_sys.load()
+}
+
+// memoryLimitHeapGoal returns the heap goal that keeps memoryMapped
+// under the memory limit, or ^uint64(0) if there is no limit. It
+// assumes the scavenger returns free heap memory to the OS, so that
+// the heap's share of the limit is what the rest of the runtime's
+// memory leaves over.
+func memoryLimitHeapGoal() uint64 {
+	limit := atomic.Load64(&memoryLimit)
+	if limit == 1<<63-1 {
+		return ^uint64(0)
+	}
+	overhead := memoryMapped() - heapRetained() + limit/memoryLimitHeadroomDivisor
+	var goal uint64
+	if limit > overhead {
+		goal = limit - overhead
+	}
+	// Don't aim below the live heap. If the limit can't be met,
+	// GC frequently rather than continuously.
+	if min := memstats.heap_marked + memstats.heap_marked/16; goal < min {
+		goal = min
+	}
+	return goal
+}
+
+// memoryLimitRetainedGoal returns the heapRetained that keeps
+// memoryMapped under the memory limit, or ^uint64(0) if there is no
+// limit.
+func memoryLimitRetainedGoal() uint64 {
+	limit := atomic.Load64(&memoryLimit)
+	if limit == 1<<63-1 {
+		return ^uint64(0)
+	}
+	overhead := memoryMapped() - heapRetained()
+	if limit <= overhead {
+		return 0
+	}
+	return limit - overhead
+}
+
 // Garbage collector phase.
 // Indicates to write barrier and synchronization task to perform.
 var gcphase uint32 // 注释：GC的阶段变量，用来看当前GC处于什么阶段
@@ -278,9 +365,33 @@ const (
 // 注释：设置GC阶段标记
 //go:nosplit
 func setGCPhase(x uint32) {
+	old := gcphase
 	atomic.Store(&gcphase, x)                                                 // 注释：设置GC阶段标记
 	writeBarrier.needed = gcphase == _GCmark || gcphase == _GCmarktermination // 注释：设置是否需要写屏障
 	writeBarrier.enabled = writeBarrier.needed || writeBarrier.cgo            // 注释：是否开启写屏障
+	if fn := gcPhaseObserver; fn != nil {
+		fn(int(old), int(x))
+	}
+}
+
+// gcPhaseObserver, if non-nil, is called by setGCPhase after each
+// change of gcphase.
+var gcPhaseObserver func(from, to int)
+
+// SetGCPhaseObserver arranges for fn to be called at each garbage
+// collector phase transition, after the write barrier has been switched
+// to match the new phase. Phases are reported as 0 (off: not collecting,
+// sweeping in the background), 1 (mark: concurrent marking, write
+// barrier enabled) and 2 (mark termination). A complete cycle is
+// reported as the transitions 0->1, 1->2 and 2->0.
+//
+// fn is called while the world is stopped by the goroutine driving the
+// collection, possibly on the system stack. It must not allocate, block
+// or otherwise call into the runtime, and should do as little as
+// possible.
+// Passing nil removes the observer.
+func SetGCPhaseObserver(fn func(from, to int)) {
+	gcPhaseObserver = fn
 }
 
 // gcMarkWorkerMode represents the mode that a concurrent mark worker
@@ -326,6 +437,33 @@ var gcMarkWorkerModeStrings = [...]string{
 	"GC (idle)",
 }
 
+// gcMarkWorkerModeNames are the names of gcMarkWorkerModes reported
+// to the background mark worker observer.
+var gcMarkWorkerModeNames = [...]string{
+	gcMarkWorkerNotWorker:      "",
+	gcMarkWorkerDedicatedMode:  "dedicated",
+	gcMarkWorkerFractionalMode: "fractional",
+	gcMarkWorkerIdleMode:       "idle",
+}
+
+// bgMarkWorkerObserver, if non-nil, is called by gcBgMarkWorker at the
+// end of each stint of background mark work.
+var bgMarkWorkerObserver func(pid int32, mode string, scanWork int64)
+
+// SetBgMarkWorkerObserver arranges for fn to be called each time a
+// garbage collector background mark worker finishes a stint of work on a
+// P (logical processor). fn is passed the ID of the P, the mode the
+// worker ran in and the amount of scan work it performed. The mode is
+// one of "dedicated" (the P is dedicated to marking for the cycle),
+// "fractional" (the P runs a share of marking alongside goroutines) or
+// "idle" (the P had nothing else to do).
+//
+// fn is called by the mark worker with preemption disabled, so it must
+// be short and must not block. Passing nil removes the observer.
+func SetBgMarkWorkerObserver(fn func(pid int32, mode string, scanWork int64)) {
+	bgMarkWorkerObserver = fn
+}
+
 // gcController implements the GC pacing controller that determines
 // when to trigger concurrent garbage collection and how much marking
 // work to do in mutator assists and background marking.
@@ -360,6 +498,14 @@ type gcControllerState struct {
 	// it is both written and read throughout the cycle.
 	bgScanCredit int64
 
+	// exemptWork is the scan work charged to bgScanCredit this
+	// cycle on behalf of goroutines exempt from assists (see
+	// SetGCAssistExempt), and exemptLimit is the most that may be
+	// charged before exempt goroutines must assist like any other.
+	// exemptWork is updated atomically.
+	exemptWork  int64
+	exemptLimit int64
+
 	// assistTime is the nanoseconds spent in mutator assists
 	// during this cycle. This is updated atomically. Updates
 	// occur in bounded batches, since it is both written and read
@@ -427,6 +573,23 @@ type gcControllerState struct {
 	// If this is zero, no fractional workers are needed.
 	fractionalUtilizationGoal float64
 
+	// bgUtilization is the background mark utilization goal for
+	// this cycle: the fraction set by SetGCCPUFraction or
+	// gcBackgroundUtilization, lowered to any limit set by
+	// SetGCCPUFractionLimit.
+	bgUtilization float64
+
+	// cpuFraction is the background mark utilization set by
+	// runtime/debug.SetGCCPUFraction, or 0 for the default of
+	// gcBackgroundUtilization. Unlike the fields above, it
+	// persists across cycles.
+	//
+	// Stored as a uint64, but it's actually a float64. Use
+	// float64frombits to get the value.
+	//
+	// Read and written atomically.
+	cpuFraction uint64
+
 	_ cpu.CacheLinePad
 }
 
@@ -436,6 +599,8 @@ type gcControllerState struct {
 func (c *gcControllerState) startCycle() {
 	c.scanWork = 0
 	c.bgScanCredit = 0
+	c.exemptWork = 0
+	c.exemptLimit = int64(float64(memstats.heap_scan) * gcAssistExemptFraction)
 	c.assistTime = 0
 	c.dedicatedMarkTime = 0
 	c.fractionalMarkTime = 0
@@ -455,9 +620,18 @@ func (c *gcControllerState) startCycle() {
 	// Compute the background mark utilization goal. In general,
 	// this may not come out exactly. We round the number of
 	// dedicated workers so that the utilization is closest to
-	// 25%. For small GOMAXPROCS, this would introduce too much
-	// error, so we add fractional workers in that case.
-	totalUtilizationGoal := float64(gomaxprocs) * gcBackgroundUtilization
+	// 25% (or the fraction set by SetGCCPUFraction). For small
+	// GOMAXPROCS, this would introduce too much error, so we add
+	// fractional workers in that case.
+	utilization := gcBackgroundUtilization
+	if f := float64frombits(atomic.Load64(&c.cpuFraction)); f != 0 {
+		utilization = f
+	}
+	if limit := float64frombits(atomic.Load64(&gcCPUFractionLimit)); limit != 0 && limit < utilization {
+		utilization = limit
+	}
+	c.bgUtilization = utilization
+	totalUtilizationGoal := float64(gomaxprocs) * utilization
 	c.dedicatedMarkWorkersNeeded = int64(totalUtilizationGoal + 0.5)
 	utilError := float64(c.dedicatedMarkWorkersNeeded)/totalUtilizationGoal - 1
 	const maxUtilError = 0.3
@@ -633,13 +807,19 @@ func (c *gcControllerState) endCycle() float64 {
 	assistDuration := nanotime() - c.markStartTime
 
 	// Assume background mark hit its utilization goal.
-	utilization := gcBackgroundUtilization
+	utilization := c.bgUtilization
 	// Add assist utilization; avoid divide by zero.
 	if assistDuration > 0 {
 		utilization += float64(c.assistTime) / float64(assistDuration*int64(gomaxprocs))
 	}
 
-	triggerError := goalGrowthRatio - memstats.triggerRatio - utilization/gcGoalUtilization*(actualGrowthRatio-memstats.triggerRatio)
+	// Keep the goal as far above the background utilization as
+	// gcGoalUtilization is above gcBackgroundUtilization, so
+	// assists make up the same share when the background goal is
+	// set differently.
+	goalUtilization := c.bgUtilization + (gcGoalUtilization - gcBackgroundUtilization)
+
+	triggerError := goalGrowthRatio - memstats.triggerRatio - utilization/goalUtilization*(actualGrowthRatio-memstats.triggerRatio)
 
 	// Finally, we adjust the trigger for next time by this error,
 	// damped by the proportional gain.
@@ -656,7 +836,7 @@ func (c *gcControllerState) endCycle() float64 {
 		h_g := goalGrowthRatio
 		H_g := int64(float64(H_m_prev) * (1 + h_g))
 		u_a := utilization
-		u_g := gcGoalUtilization
+		u_g := goalUtilization
 		W_a := c.scanWork
 		print("pacer: H_m_prev=", H_m_prev,
 			" h_t=", h_t, " H_T=", H_T,
@@ -731,6 +911,13 @@ func (c *gcControllerState) findRunnableGCWorker(_p_ *p) *g {
 		return nil
 	}
 
+	if gcOverCPULimit() {
+		// The GC has used up the CPU allowed by
+		// SetGCCPUFractionLimit for now. Leave the P to the
+		// mutator.
+		return nil
+	}
+
 	// Grab a worker before we commit to running below.
 	node := (*gcBgMarkWorkerNode)(gcBgMarkWorkerPool.pop())
 	if node == nil {
@@ -906,6 +1093,23 @@ func gcSetTriggerRatio(triggerRatio float64) {
 		}
 	}
 
+	// Aim for the memory limit's goal if it's lower, triggering
+	// as far into the heap growth as the trigger ratio would.
+	if limitGoal := memoryLimitHeapGoal(); limitGoal < goal {
+		goal = limitGoal
+		frac := 0.6
+		if gcpercent > 0 {
+			frac = triggerRatio * 100 / float64(gcpercent)
+		}
+		limitTrigger := memstats.heap_marked
+		if goal > limitTrigger {
+			limitTrigger += uint64(float64(goal-limitTrigger) * frac)
+		}
+		if limitTrigger < trigger {
+			trigger = limitTrigger
+		}
+	}
+
 	// Commit to the trigger and goal.
 	memstats.gc_trigger = trigger
 	atomic.Store64(&memstats.next_gc, goal)
@@ -979,8 +1183,9 @@ func gcEffectiveGrowthRatio() float64 {
 // marking as a fraction of GOMAXPROCS.
 const gcGoalUtilization = 0.30
 
-// gcBackgroundUtilization is the fixed CPU utilization for background
-// marking. It must be <= gcGoalUtilization. The difference between
+// gcBackgroundUtilization is the default CPU utilization for background
+// marking, which runtime/debug.SetGCCPUFraction can change. It must be
+// <= gcGoalUtilization. The difference between
 // gcGoalUtilization and gcBackgroundUtilization will be made up by
 // mark assists. The scheduler will aim to use within 50% of this
 // goal.
@@ -992,6 +1197,65 @@ const gcGoalUtilization = 0.30
 // mutator latency.
 const gcBackgroundUtilization = 0.25
 
+// gcCPUFractionLimit is the float64 bits of the limit set by
+// SetGCCPUFractionLimit, or 0 for no limit. Accessed atomically.
+var gcCPUFractionLimit uint64
+
+// SetGCCPUFractionLimit sets a hard limit on the fraction of the
+// available CPU (GOMAXPROCS) that the garbage collector may use while
+// marking, counting dedicated and fractional background mark workers
+// and mutator assists. Marking on otherwise idle processors is not
+// counted.
+//
+// The limit lowers the background mark utilization goal if it is
+// below the default of 25%, and whenever the collector's measured CPU
+// use in the current cycle reaches the limit, background workers stop
+// being scheduled and allocating goroutines stop assisting until it
+// falls below the limit again. Marking takes longer as a result, so
+// the heap may grow past its goal: the limit trades memory for
+// mutator CPU. The measurement is approximate, so the limit may be
+// exceeded briefly.
+//
+// A limit of 0 or less, or of 1 or more, removes the limit, which is
+// the default.
+func SetGCCPUFractionLimit(f float64) {
+	if f <= 0 || f >= 1 {
+		f = 0
+	}
+	atomic.Store64(&gcCPUFractionLimit, float64bits(f))
+}
+
+//go:linkname setGCCPUFraction runtime/debug.setGCCPUFraction
+func setGCCPUFraction(f float64) float64 {
+	var old uint64
+	if f > 0 {
+		old = atomic.Xchg64(&gcController.cpuFraction, float64bits(f))
+	} else {
+		old = atomic.Load64(&gcController.cpuFraction)
+	}
+	if old == 0 {
+		return gcBackgroundUtilization
+	}
+	return float64frombits(old)
+}
+
+// gcOverCPULimit reports whether the GC has used at least the CPU
+// fraction allowed by SetGCCPUFractionLimit in the current mark phase.
+func gcOverCPULimit() bool {
+	limit := float64frombits(atomic.Load64(&gcCPUFractionLimit))
+	if limit == 0 {
+		return false
+	}
+	elapsed := nanotime() - gcController.markStartTime
+	if elapsed <= 0 {
+		return false
+	}
+	used := atomic.Loadint64(&gcController.assistTime) +
+		atomic.Loadint64(&gcController.dedicatedMarkTime) +
+		atomic.Loadint64(&gcController.fractionalMarkTime)
+	return float64(used) >= limit*float64(elapsed)*float64(gomaxprocs)
+}
+
 // gcCreditSlack is the amount of scan work credit that can
 // accumulate locally before updating gcController.scanWork and,
 // optionally, gcController.bgScanCredit. Lower values give a more
@@ -1236,7 +1500,7 @@ const (
 // it is an exit condition for the _GCoff phase.
 type gcTrigger struct {
 	kind gcTriggerKind
-	now  int64  // gcTriggerTime: current time
+	now  int64  // gcTriggerTime, gcTriggerMemoryLimit: current time
 	n    uint32 // gcTriggerCycle: cycle number to start
 }
 
@@ -1260,6 +1524,13 @@ const (
 	// to work.cycles).
 	// 注释：译：gcTriggerCycle表示，如果我们还没有启动周期编号gcTrigger.n（相对于work.cycles），则应该启动一个周期。
 	gcTriggerCycle // 注释：手动触发GC
+
+	// gcTriggerMemoryLimit indicates that a cycle should be
+	// started because the runtime's memory exceeds the limit set
+	// by runtime/debug.SetMemoryLimit, it's been more than
+	// memoryLimitGCPeriod nanoseconds since the previous cycle,
+	// and the heap has grown since then.
+	gcTriggerMemoryLimit
 )
 
 // test reports whether the trigger condition is satisfied, meaning
@@ -1279,9 +1550,14 @@ func (t gcTrigger) test() bool {
 		// atomically wrote heap_live anyway and we'll see our
 		// own write.
 		// 注释：译：非原子访问heap_live以提高性能。如果我们要对此进行触发，那么这个线程只是原子地编写了heap_live，我们将看到自己的编写。
+		if atomic.Load(&gcManual.enabled) != 0 {
+			// Only the safety limit triggers a GC in
+			// manual mode.
+			return memstats.heap_live >= gcManualTrigger()
+		}
 		return memstats.heap_live >= memstats.gc_trigger
 	case gcTriggerTime: // 注释：系统协成触发GC(约每2分钟触发一次)
-		if gcpercent < 0 {
+		if gcpercent < 0 || atomic.Load(&gcManual.enabled) != 0 {
 			return false
 		}
 		lastgc := int64(atomic.Load64(&memstats.last_gc_nanotime))
@@ -1289,17 +1565,128 @@ func (t gcTrigger) test() bool {
 	case gcTriggerCycle: // 注释：手动触发GC
 		// t.n > work.cycles, but accounting for wraparound.
 		return int32(t.n-work.cycles) > 0
+	case gcTriggerMemoryLimit:
+		limit := atomic.Load64(&memoryLimit)
+		if limit == 1<<63-1 {
+			return false
+		}
+		lastgc := int64(atomic.Load64(&memstats.last_gc_nanotime))
+		return lastgc != 0 && t.now-lastgc > memoryLimitGCPeriod &&
+			atomic.Load64(&memstats.heap_live) > memstats.heap_marked &&
+			memoryMapped() > limit
 	}
 	return true
 }
 
+// A GCMode is a garbage collection mode, for use with SetGCMode.
+type GCMode int
+
+const (
+	// GCModeAuto is the default mode, in which the garbage
+	// collector runs automatically as the heap grows and
+	// periodically, as controlled by GOGC.
+	GCModeAuto GCMode = iota
+
+	// GCModeManual disables automatic garbage collection. The
+	// collector only runs when explicitly asked to by GC (or
+	// debug.FreeOSMemory), or when the heap reaches the safety
+	// limit set by SetGCManualHeapLimit.
+	GCModeManual
+)
+
+// gcManual is the state of manual garbage collection mode.
+var gcManual struct {
+	limit uint64 // heap_live at which a GC is forced in manual mode; accessed atomically
+
+	// userLimit is the limit set by SetGCManualHeapLimit, or 0
+	// for the default. Accessed atomically.
+	userLimit uint64
+
+	enabled uint32 // GCModeManual is in effect; accessed atomically
+}
+
+// SetGCMode sets the garbage collection mode to GCModeAuto or
+// GCModeManual. It panics if mode is neither.
+//
+// Unlike disabling the collector with GOGC=off, manual mode keeps the
+// pacing for the collections that do run, and still bounds the heap:
+// entering manual mode arms a safety limit, set by
+// SetGCManualHeapLimit, at which a collection is started anyway to
+// avoid running out of memory. If the heap left live by a collection
+// is at or near the limit, the next forced collection waits until the
+// heap has grown past the live heap by a quarter, and by at least
+// 4 MB, so that the collector doesn't run back to back.
+func SetGCMode(mode GCMode) {
+	switch mode {
+	case GCModeAuto:
+		atomic.Store(&gcManual.enabled, 0)
+	case GCModeManual:
+		gcManualUpdateLimit()
+		atomic.Store(&gcManual.enabled, 1)
+	default:
+		panic("runtime: invalid GC mode")
+	}
+}
+
+// gcManualDefaultLimitFactor is the default safety limit for manual
+// GC mode, as a multiple of the heap goal when manual mode is entered.
+const gcManualDefaultLimitFactor = 4
+
+// SetGCManualHeapLimit sets the safety limit for manual garbage
+// collection mode: the heap size, in bytes, at which a collection is
+// forced even though automatic collection is disabled. A limit of 0,
+// the default, means 4 times the heap goal in effect when manual mode
+// is entered (or when the limit is set, if manual mode is already in
+// effect).
+func SetGCManualHeapLimit(bytes uint64) {
+	atomic.Store64(&gcManual.userLimit, bytes)
+	gcManualUpdateLimit()
+}
+
+// gcManualMinGrowth is the least the heap grows past the heap marked
+// by the last cycle before manual mode forces another: a quarter of
+// the marked heap, and at least gcManualMinGrowthBytes.
+const (
+	gcManualMinGrowthDiv   = 4
+	gcManualMinGrowthBytes = 4 << 20
+)
+
+// gcManualTrigger returns the heap_live at which manual GC mode forces
+// a GC: the safety limit, or, if that is too close to what the last
+// cycle left live, gcManualMinGrowth past it.
+//
+// Like the test of heap_live against gc_trigger, this reads
+// heap_marked non-atomically; it only changes during mark
+// termination.
+func gcManualTrigger() uint64 {
+	trigger := atomic.Load64(&gcManual.limit)
+	growth := memstats.heap_marked / gcManualMinGrowthDiv
+	if growth < gcManualMinGrowthBytes {
+		growth = gcManualMinGrowthBytes
+	}
+	if floor := memstats.heap_marked + growth; trigger < floor {
+		trigger = floor
+	}
+	return trigger
+}
+
+// gcManualUpdateLimit computes the safety limit for manual GC mode.
+func gcManualUpdateLimit() {
+	limit := atomic.Load64(&gcManual.userLimit)
+	if limit == 0 {
+		limit = gcManualDefaultLimitFactor * atomic.Load64(&memstats.next_gc)
+	}
+	atomic.Store64(&gcManual.limit, limit)
+}
+
 // gcStart starts the GC. It transitions from _GCoff to _GCmark (if
 // debug.gcstoptheworld == 0) or performs all of GC (if
 // debug.gcstoptheworld != 0).
 //
 // This may return without performing this transition in some cases,
-// such as when called on a system stack or with locks held.
-func gcStart(trigger gcTrigger) {
+// such as when called on a system stack or with locks held. gcStart
+// reports whether it started a cycle.
+func gcStart(trigger gcTrigger) (started bool) {
 	// Since this is called from malloc and malloc is called in
 	// the guts of a number of libraries that might be holding
 	// locks, don't attempt to start GC in non-preemptible or
@@ -1322,6 +1709,13 @@ func gcStart(trigger gcTrigger) {
 	//
 	// We check the transition condition continuously here in case
 	// this G gets delayed in to the next GC cycle.
+	observer := sweepTermObserver
+	var sweepTermStart int64
+	var sweptBefore uint64
+	if observer != nil {
+		sweepTermStart = nanotime()
+		sweptBefore = atomic.Load64(&mheap_.pagesSwept)
+	}
 	for trigger.test() && sweepone() != ^uintptr(0) {
 		sweep.nbgsweep++
 	}
@@ -1385,11 +1779,27 @@ func gcStart(trigger gcTrigger) {
 	if trace.enabled {
 		traceGCSTWStart(1)
 	}
+	stwPause.reason = "GC sweep termination"
 	systemstack(stopTheWorldWithSema)
 	// Finish sweep before we start concurrent scan.
 	systemstack(func() {
 		finishsweep_m()
 	})
+	var sweepTermPages uint64
+	var sweepTermNanos int64
+	if observer != nil {
+		// Everything swept since we started waiting was still
+		// pending when this cycle was triggered.
+		sweptAfter := atomic.Load64(&mheap_.pagesSwept)
+		if sweptAfter >= sweptBefore {
+			sweepTermPages = sweptAfter - sweptBefore
+		} else {
+			// A new sweep cycle began while we were
+			// waiting, resetting the count.
+			sweepTermPages = sweptAfter
+		}
+		sweepTermNanos = nanotime() - sweepTermStart
+	}
 
 	// clearpools before we start the GC. If we wait they memory will not be
 	// reclaimed until the next GC cycle.
@@ -1470,6 +1880,150 @@ func gcStart(trigger gcTrigger) {
 	}
 
 	semrelease(&work.startSema)
+
+	if observer != nil {
+		observer(sweepTermPages, sweepTermNanos)
+	}
+	return true
+}
+
+// sweepTermObserver, if non-nil, is called by gcStart after each sweep
+// termination.
+var sweepTermObserver func(pendingPages uint64, nanos int64)
+
+// SetSweepTermObserver arranges for fn to be called each time a garbage
+// collection cycle starts, once the previous cycle's sweeping has been
+// finished. fn is passed the number of pages that were still unswept
+// when the new cycle was triggered and had to be swept before it could
+// begin, and the time in nanoseconds that this sweep termination took.
+// A nonzero page count means sweeping fell behind allocation and the
+// goroutine that triggered the cycle was stalled finishing it.
+//
+// fn is called on the goroutine that started the cycle, just after
+// concurrent marking has begun, so it should be short. Passing nil
+// removes the observer.
+func SetSweepTermObserver(fn func(pendingPages uint64, nanos int64)) {
+	sweepTermObserver = fn
+}
+
+// GCCycleReport describes a completed garbage collection cycle. See
+// SetGCNotifier.
+type GCCycleReport struct {
+	NumGC  uint32 // number of the cycle, as in MemStats.NumGC
+	Forced bool   // the cycle was forced by the application calling GC
+
+	// Missed is the number of cycles since the previous report
+	// that were not reported because the notifier function was
+	// still running.
+	Missed uint32
+
+	// Heap sizes in bytes, as reported by GODEBUG=gctrace=1.
+	HeapStart    uint64 // heap size when the cycle started
+	HeapMarkTerm uint64 // heap size when mark termination started
+	HeapMarked   uint64 // heap marked live by the cycle
+	HeapGoal     uint64 // heap goal of the cycle
+	NextGC       uint64 // heap goal of the next cycle, as in MemStats.NextGC
+
+	// Wall-clock times in nanoseconds.
+	SweepTermNs int64 // stop-the-world sweep termination pause
+	MarkNs      int64 // concurrent mark phase
+	MarkTermNs  int64 // stop-the-world mark termination pause
+
+	// CPU times in nanoseconds.
+	SweepTermCPUNs  int64 // stop-the-world sweep termination
+	AssistCPUNs     int64 // mutator assists during concurrent mark
+	BackgroundCPUNs int64 // dedicated and fractional background marking
+	IdleCPUNs       int64 // marking on otherwise idle Ps
+	MarkTermCPUNs   int64 // stop-the-world mark termination
+
+	// Scavenger state at the end of the cycle, in bytes.
+	HeapReleased uint64 // heap memory returned to the OS, as in MemStats.HeapReleased
+	ScavengeGoal uint64 // retained heap memory the scavenger aims for
+
+	GOMAXPROCS int // GOMAXPROCS during the cycle
+}
+
+// gcNotify is the state of the GC notifier goroutine, which calls fn
+// with a report of each cycle. gcMarkTermination only writes report
+// while g is idle, so the two never access it at the same time.
+var gcNotify struct {
+	fn      func(GCCycleReport)
+	started uint32 // g has been started
+	idle    uint32 // g is parked waiting for a report
+	missed  uint32 // cycles not reported since the last report
+	g       *g
+	report  GCCycleReport
+}
+
+// SetGCNotifier arranges for fn to be called with a report of each
+// garbage collection cycle once it ends, as a structured alternative
+// to parsing GODEBUG=gctrace=1 output. Passing nil removes the
+// notifier.
+//
+// fn is called on a dedicated goroutine, one report at a time, so it
+// may block or allocate. However, the collector does not wait for it:
+// if fn is still running when a cycle ends, that cycle is not reported,
+// and the next report's Missed field counts it. Because fn is called
+// after the cycle ends, another cycle may have started by the time it
+// runs.
+func SetGCNotifier(fn func(GCCycleReport)) {
+	gcNotify.fn = fn
+	if fn != nil && atomic.Cas(&gcNotify.started, 0, 1) {
+		go gcNotifyHelper()
+	}
+}
+
+func gcNotifyHelper() {
+	gcNotify.g = getg()
+	for {
+		gopark(gcNotifyPark, nil, waitReasonGCNotifierIdle, traceEvGoBlock, 1)
+		// this goroutine is explicitly resumed by gcMarkTermination
+		r := gcNotify.report
+		if fn := gcNotify.fn; fn != nil {
+			fn(r)
+		}
+	}
+}
+
+// gcNotifyPark marks gcNotify.g idle once it is parked, so that
+// gcMarkTermination doesn't ready it before then.
+func gcNotifyPark(gp *g, _ unsafe.Pointer) bool {
+	atomic.Store(&gcNotify.idle, 1)
+	return true
+}
+
+// gcNotifyCycle wakes the GC notifier goroutine with a report of the
+// cycle that just ended, or counts the cycle as missed if the notifier
+// is still busy with an earlier report. The caller must hold worldsema.
+func gcNotifyCycle(sweepTermCpu, markTermCpu int64) {
+	if !atomic.Cas(&gcNotify.idle, 1, 0) {
+		atomic.Xadd(&gcNotify.missed, 1)
+		return
+	}
+	gcNotify.report = GCCycleReport{
+		NumGC:           memstats.numgc,
+		Forced:          work.userForced,
+		Missed:          atomic.Xchg(&gcNotify.missed, 0),
+		HeapStart:       work.heap0,
+		HeapMarkTerm:    work.heap1,
+		HeapMarked:      work.heap2,
+		HeapGoal:        work.heapGoal,
+		NextGC:          memstats.next_gc,
+		SweepTermNs:     work.tMark - work.tSweepTerm,
+		MarkNs:          work.tMarkTerm - work.tMark,
+		MarkTermNs:      work.tEnd - work.tMarkTerm,
+		SweepTermCPUNs:  sweepTermCpu,
+		AssistCPUNs:     gcController.assistTime,
+		BackgroundCPUNs: gcController.dedicatedMarkTime + gcController.fractionalMarkTime,
+		IdleCPUNs:       gcController.idleMarkTime,
+		MarkTermCPUNs:   markTermCpu,
+		HeapReleased:    atomic.Load64(&memstats.heap_released),
+		ScavengeGoal:    atomic.Load64(&mheap_.scavengeGoal),
+		GOMAXPROCS:      int(work.maxprocs),
+	}
+	var list gList
+	list.push(gcNotify.g)
+	injectglist(&list)
 }
 
 // gcMarkDoneFlushed counts the number of P's with flushed work.
@@ -1572,6 +2126,7 @@ top:
 	if trace.enabled {
 		traceGCSTWStart(0)
 	}
+	stwPause.reason = "GC mark termination"
 	systemstack(stopTheWorldWithSema)
 	// The gcphase is _GCmark, it will transition to _GCmarktermination
 	// below. The important thing is that the wb remains active until
@@ -1778,6 +2333,12 @@ func gcMarkTermination(nextTriggerRatio float64) {
 		})
 	})
 
+	// Hand the cycle's report to the notifier goroutine before
+	// dropping worldsema, for the same reason as gctrace below.
+	if gcNotify.fn != nil {
+		gcNotifyCycle(sweepTermCpu, markTermCpu)
+	}
+
 	// Print gctrace before dropping worldsema. As soon as we drop
 	// worldsema another cycle could start and smash the stats
 	// we're trying to print.
@@ -1815,6 +2376,9 @@ func gcMarkTermination(nextTriggerRatio float64) {
 			print(" (forced)")
 		}
 		print("\n")
+		if youngSpansEnabled {
+			printYoungSpanStats()
+		}
 		printunlock()
 	}
 
@@ -1988,7 +2552,7 @@ func gcBgMarkWorker() {
 			default:
 				throw("gcBgMarkWorker: unexpected gcMarkWorkerMode")
 			case gcMarkWorkerDedicatedMode:
-				gcDrain(&pp.gcw, gcDrainUntilPreempt|gcDrainFlushBgCredit)
+				pp.gcMarkWorkerScanWork = gcDrain(&pp.gcw, gcDrainUntilPreempt|gcDrainFlushBgCredit)
 				if gp.preempt {
 					// We were preempted. This is
 					// a useful signal to kick
@@ -2007,11 +2571,11 @@ func gcBgMarkWorker() {
 				}
 				// Go back to draining, this time
 				// without preemption.
-				gcDrain(&pp.gcw, gcDrainFlushBgCredit)
+				pp.gcMarkWorkerScanWork += gcDrain(&pp.gcw, gcDrainFlushBgCredit)
 			case gcMarkWorkerFractionalMode:
-				gcDrain(&pp.gcw, gcDrainFractional|gcDrainUntilPreempt|gcDrainFlushBgCredit)
+				pp.gcMarkWorkerScanWork = gcDrain(&pp.gcw, gcDrainFractional|gcDrainUntilPreempt|gcDrainFlushBgCredit)
 			case gcMarkWorkerIdleMode:
-				gcDrain(&pp.gcw, gcDrainIdle|gcDrainUntilPreempt|gcDrainFlushBgCredit)
+				pp.gcMarkWorkerScanWork = gcDrain(&pp.gcw, gcDrainIdle|gcDrainUntilPreempt|gcDrainFlushBgCredit)
 			}
 			casgstatus(gp, _Gwaiting, _Grunning)
 		})
@@ -2028,6 +2592,9 @@ func gcBgMarkWorker() {
 		case gcMarkWorkerIdleMode:
 			atomic.Xaddint64(&gcController.idleMarkTime, duration)
 		}
+		if fn := bgMarkWorkerObserver; fn != nil {
+			fn(pp.id, gcMarkWorkerModeNames[pp.gcMarkWorkerMode], pp.gcMarkWorkerScanWork)
+		}
 
 		// Was this the last worker and did we run out
 		// of work?
@@ -2289,6 +2856,7 @@ func clearpools() {
 		sg.next = nil
 	}
 	sched.sudogcache = nil
+	atomic.Store(&sudogStats.central, 0)
 	unlock(&sched.sudoglock)
 
 	// Clear central defer pools.
@@ -15,6 +15,7 @@ import (
 const (
 	fixedRootFinalizers = iota
 	fixedRootFreeGStacks
+	fixedRootUserArenas
 	fixedRootCount
 
 	// rootBlockBytes is the number of bytes to scan per data or
@@ -181,6 +182,9 @@ func markroot(gcw *gcWork, i uint32) {
 		// stackfree.
 		systemstack(markrootFreeGStacks)
 
+	case i == fixedRootUserArenas:
+		markrootUserArenas(gcw)
+
 	case baseSpans <= i && i < baseStacks:
 		// mark mspan.specials
 		markrootSpans(gcw, int(i-baseSpans))
@@ -398,6 +402,14 @@ func gcAssistAlloc(gp *g) {
 	}
 
 	traced := false
+	// Reset the per-assist scan work counter and, if someone is
+	// watching, note when this assist began.
+	gp.gcAssistWork = 0
+	observer := assistObserver
+	var startTime int64
+	if observer != nil {
+		startTime = nanotime()
+	}
 retry:
 	// Compute the amount of scan work we need to do to make the
 	// balance positive. When the required amount of work is low,
@@ -443,6 +455,29 @@ retry:
 		}
 	}
 
+	if gp.gcAssistExempt && gcController.exemptAssist(scanWork) {
+		// This goroutine doesn't assist. Charge the rest of
+		// its debt to the background credit, which may go
+		// negative; the background workers pay it off and
+		// other goroutines can't steal credit until they do.
+		gp.gcAssistBytes += 1 + int64(assistBytesPerWork*float64(scanWork))
+		if traced {
+			traceGCMarkAssistDone()
+		}
+		return
+	}
+
+	if gcOverCPULimit() {
+		// The GC has used up the CPU allowed by
+		// SetGCCPUFractionLimit for now. Let the mutator run
+		// into debt rather than assist; the heap may overshoot
+		// its goal.
+		if traced {
+			traceGCMarkAssistDone()
+		}
+		return
+	}
+
 	if trace.enabled && !traced {
 		traced = true
 		traceGCMarkAssistStart()
@@ -493,6 +528,86 @@ retry:
 	if traced {
 		traceGCMarkAssistDone()
 	}
+	if observer != nil {
+		observer(gp.goid, gp.gcAssistWork, nanotime()-startTime)
+	}
+}
+
+// gcAssistExemptFraction is the fraction of a cycle's expected scan
+// work, estimated by heap_scan at the start of the cycle, that may be
+// charged to the background workers on behalf of exempt goroutines.
+// Beyond it, exempt goroutines assist like any other so that they
+// can't outrun the collector.
+const gcAssistExemptFraction = 0.1
+
+// exemptAssist charges scanWork to the background scan credit on
+// behalf of an exempt goroutine and reports whether it did so. It
+// returns false once the cycle's exemption budget is spent.
+func (c *gcControllerState) exemptAssist(scanWork int64) bool {
+	if atomic.Xaddint64(&c.exemptWork, scanWork) > c.exemptLimit {
+		atomic.Xaddint64(&c.exemptWork, -scanWork)
+		return false
+	}
+	atomic.Xaddint64(&c.bgScanCredit, -scanWork)
+	return true
+}
+
+// SetGCAssistExempt sets whether the calling goroutine is exempt from
+// GC assists. Normally a goroutine that allocates while the garbage
+// collector is marking must do mark work in proportion to its
+// allocation, which adds latency to the allocation. The debt of an
+// exempt goroutine is instead transferred to the background mark
+// workers, and other goroutines that allocate may have to assist more
+// while the workers catch up.
+//
+// This is meant for a few latency-sensitive goroutines. To keep
+// exempt goroutines from outrunning the collector, the debt
+// transferred in each cycle is limited to a fraction of the cycle's
+// expected mark work; once the limit is reached, exempt goroutines
+// assist like any other for the rest of the cycle.
+func SetGCAssistExempt(enabled bool) {
+	getg().m.curg.gcAssistExempt = enabled
+}
+
+// assistObserver, if non-nil, is called by gcAssistAlloc each time a
+// goroutine finishes an assist that performed scan work.
+var assistObserver func(goid int64, scanWork int64, nanos int64)
+
+// SetAssistObserver arranges for fn to be called each time a goroutine
+// finishes a GC assist, that is, each time an allocating goroutine is
+// made to perform mark work to pay off its allocation debt. fn is
+// passed the ID of the assisting goroutine, the amount of scan work it
+// performed and the wall time in nanoseconds the assist took, including
+// any time spent waiting for background credit. Assists that are paid
+// for entirely with stolen background credit are not reported.
+//
+// fn is called on the allocating goroutine from within the allocator,
+// so it must be short and must not allocate. Passing nil removes the
+// observer.
+func SetAssistObserver(fn func(goid int64, scanWork int64, nanos int64)) {
+	assistObserver = fn
+}
+
+// assistCreditObserver, if non-nil, is called by goexit0 when an
+// exiting goroutine's assist credit is flushed to the background
+// credit pool.
+var assistCreditObserver func(goid int64, creditFlushed int64)
+
+// SetAssistCreditObserver arranges for fn to be called each time a
+// goroutine exits during the mark phase of a garbage collection with
+// assist credit left over, that is, having assisted or stolen credit
+// for more allocation than it went on to do. The remaining credit is
+// returned to the pool from which other goroutines' assists are paid,
+// and fn is passed the ID of the exiting goroutine and the credit
+// returned, in units of scan work as reported by SetAssistObserver.
+// Goroutines that exit owing assist work are not reported.
+//
+// fn is called on the system stack while the goroutine is being torn
+// down. It must not allocate, block or otherwise call into the runtime,
+// and should do as little as possible. Passing nil removes the
+// observer.
+func SetAssistCreditObserver(fn func(goid int64, creditFlushed int64)) {
+	assistCreditObserver = fn
 }
 
 // gcAssistAlloc1 is the part of gcAssistAlloc that runs on the system
@@ -540,6 +655,7 @@ func gcAssistAlloc1(gp *g, scanWork int64) {
 	// will be more cache friendly.
 	gcw := &getg().m.p.ptr().gcw
 	workDone := gcDrainN(gcw, scanWork)
+	gp.gcAssistWork += workDone
 
 	casgstatus(gp, _Gwaiting, _Grunning)
 
@@ -981,8 +1097,10 @@ const (
 //
 // gcDrain will always return if there is a pending STW.
 //
+// gcDrain returns the amount of scan work it performed.
+//
 //go:nowritebarrier
-func gcDrain(gcw *gcWork, flags gcDrainFlags) {
+func gcDrain(gcw *gcWork, flags gcDrainFlags) (workDone int64) {
 	if !writeBarrier.needed {
 		throw("gcDrain phase incorrect")
 	}
@@ -1056,6 +1174,7 @@ func gcDrain(gcw *gcWork, flags gcDrainFlags) {
 		// mutator assists can draw on it.
 		if gcw.scanWork >= gcCreditSlack {
 			atomic.Xaddint64(&gcController.scanWork, gcw.scanWork)
+			workDone += gcw.scanWork
 			if flushBgCredit {
 				gcFlushBgCredit(gcw.scanWork - initScanWork)
 				initScanWork = 0
@@ -1076,11 +1195,13 @@ done:
 	// Flush remaining scan work credit.
 	if gcw.scanWork > 0 {
 		atomic.Xaddint64(&gcController.scanWork, gcw.scanWork)
+		workDone += gcw.scanWork
 		if flushBgCredit {
 			gcFlushBgCredit(gcw.scanWork - initScanWork)
 		}
 		gcw.scanWork = 0
 	}
+	return workDone
 }
 
 // gcDrainN blackens grey objects until it has performed roughly
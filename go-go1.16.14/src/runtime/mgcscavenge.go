@@ -114,12 +114,18 @@ func heapRetained() uint64 {
 //
 // mheap_.lock must be held or the world must be stopped.
 func gcPaceScavenger() {
+	// The memory limit caps the goal, even before the first GC.
+	limitGoal := memoryLimitRetainedGoal()
+
 	// If we're called before the first GC completed, disable scavenging.
 	// We never scavenge before the 2nd GC cycle anyway (we don't have enough
 	// information about the heap yet) so this is fine, and avoids a fault
 	// or garbage data later.
 	if memstats.last_next_gc == 0 {
 		mheap_.scavengeGoal = ^uint64(0)
+		if limitGoal < heapRetained() {
+			mheap_.scavengeGoal = limitGoal
+		}
 		return
 	}
 	// Compute our scavenging goal.
@@ -130,6 +136,9 @@ func gcPaceScavenger() {
 	// (e.g. if retainExtraPercent = 12.5, then we get a divisor of 8)
 	// that also avoids the overflow from a multiplication.
 	retainedGoal += retainedGoal / (1.0 / (retainExtraPercent / 100.0))
+	if limitGoal < retainedGoal {
+		retainedGoal = limitGoal
+	}
 	// Align it to a physical page boundary to make the following calculations
 	// a bit more exact.
 	retainedGoal = (retainedGoal + uint64(physPageSize) - 1) &^ (uint64(physPageSize) - 1)
@@ -612,7 +621,16 @@ func (p *pageAlloc) scavengeOne(work addrRange, max uintptr, mayUnlock bool) (ui
 	// by subtracting 1.
 	maxAddr := work.limit.addr() - 1
 	maxChunk := chunkIndex(maxAddr)
-	if p.summary[len(p.summary)-1][maxChunk].max() >= uint(minPages) {
+	if p.hugeTLB(maxChunk) {
+		// Memory backed by explicit huge pages is scavenged a
+		// whole huge page at a time, or not at all.
+		if addr, npages := p.scavengeHugeTLBLocked(maxChunk, maxAddr+1); npages != 0 {
+			work.limit = offAddr{addr}
+
+			assertLockHeld(p.mheapLock) // Must be locked on return.
+			return uintptr(npages) * pageSize, work
+		}
+	} else if p.summary[len(p.summary)-1][maxChunk].max() >= uint(minPages) {
 		// We only bother looking for a candidate if there at least
 		// minPages free pages at all.
 		base, npages := p.chunkOf(maxChunk).findScavengeCandidate(chunkPageIndex(maxAddr), minPages, maxPages)
@@ -682,6 +700,17 @@ func (p *pageAlloc) scavengeOne(work addrRange, max uintptr, mayUnlock bool) (ui
 		}
 
 		// Find, verify, and scavenge if we can.
+		if p.hugeTLB(candidateChunkIdx) {
+			addr, npages := p.scavengeHugeTLBLocked(candidateChunkIdx, chunkBase(candidateChunkIdx+1))
+			if npages > 0 {
+				work.limit = offAddr{addr}
+
+				assertLockHeld(p.mheapLock) // Must be locked on return.
+				return uintptr(npages) * pageSize, work
+			}
+			work.limit = offAddr{chunkBase(candidateChunkIdx)}
+			continue
+		}
 		chunk := p.chunkOf(candidateChunkIdx)
 		base, npages := chunk.findScavengeCandidate(pallocChunkPages-1, minPages, maxPages)
 		if npages > 0 {
@@ -729,7 +758,75 @@ func (p *pageAlloc) scavengeRangeLocked(ci chunkIdx, base, npages uint) uintptr
 
 	// Update global accounting only when not in test, otherwise
 	// the runtime's accounting will be wrong.
-	nbytes := int64(npages) * pageSize
+	scavengeAccount(int64(npages) * pageSize)
+	return addr
+}
+
+// hugeTLB reports whether chunk ci is backed by explicit huge pages.
+func (p *pageAlloc) hugeTLB(ci chunkIdx) bool {
+	return !p.test && chunkHugeTLB(chunkBase(ci))
+}
+
+// hugeTLBNoRelease is set once the kernel has refused to release
+// explicit huge pages, after which the scavenger leaves them alone.
+// Protected by the heap lock.
+var hugeTLBNoRelease bool
+
+// scavengeHugeTLBLocked scavenges the highest huge page in chunk ci,
+// which must be backed by explicit huge pages, that ends at or below
+// limit, is entirely free, and is not yet entirely scavenged. Such
+// memory can only be released a whole huge page at a time, so no
+// smaller range is scavenged, and only the pages that weren't
+// scavenged already count as released. It returns the base address
+// of the huge page and the number of pages newly scavenged, or 0, 0
+// if there is no such huge page or the kernel can't release it.
+//
+// p.mheapLock must be held.
+func (p *pageAlloc) scavengeHugeTLBLocked(ci chunkIdx, limit uintptr) (uintptr, uint) {
+	assertLockHeld(p.mheapLock)
+
+	hugePages := uint(physHugePageSize / pageSize)
+	if hugeTLBNoRelease || hugePages < 64 || hugePages > pallocChunkPages || pallocChunkPages%hugePages != 0 {
+		return 0, 0
+	}
+	chunk := p.chunkOf(ci)
+	for end := uint(pallocChunkPages); end >= hugePages; end -= hugePages {
+		base := end - hugePages
+		addr := chunkBase(ci) + uintptr(base)*pageSize
+		if addr+uintptr(hugePages)*pageSize > limit {
+			continue
+		}
+		free := true
+		for i := base; i < end; i += 64 {
+			if chunk.pages64(i) != 0 {
+				free = false
+				break
+			}
+		}
+		if !free {
+			continue
+		}
+		npages := hugePages - chunk.scavenged.popcntRange(base, hugePages)
+		if npages == 0 {
+			continue
+		}
+		if !sysUnusedHugeTLB(unsafe.Pointer(addr), uintptr(hugePages)*pageSize) {
+			hugeTLBNoRelease = true
+			return 0, 0
+		}
+		chunk.scavenged.setRange(base, hugePages)
+		if oAddr := (offAddr{addr}); oAddr.lessThan(p.scav.scavLWM) {
+			p.scav.scavLWM = oAddr
+		}
+		scavengeAccount(int64(npages) * pageSize)
+		return addr, npages
+	}
+	return 0, 0
+}
+
+// scavengeAccount updates the memory statistics for nbytes of heap
+// memory that was just scavenged.
+func scavengeAccount(nbytes int64) {
 	atomic.Xadd64(&memstats.heap_released, nbytes)
 
 	// Update consistent accounting too.
@@ -737,8 +834,6 @@ func (p *pageAlloc) scavengeRangeLocked(ci chunkIdx, base, npages uint) uintptr
 	atomic.Xaddint64(&stats.committed, -nbytes)
 	atomic.Xaddint64(&stats.released, nbytes)
 	memstats.heapStats.release()
-
-	return addr
 }
 
 // fillAligned returns x but with all zeroes in m-aligned
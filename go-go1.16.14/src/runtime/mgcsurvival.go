@@ -0,0 +1,59 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Young object survival measurement.
+//
+// GOEXPERIMENT=gennursery measures how many young objects survive a
+// garbage collection, to bound what a generational collector could
+// save. It is not a nursery: there is no separate allocator for young
+// objects and no minor collection, and the collector neither evacuates
+// nor discards them early.
+//
+// Instead, the spans that the mcentrals allocate fresh from the heap,
+// when they have no spans with free slots to hand out, are marked
+// young, since everything allocated in them is young: allocated since
+// the previous collection. The experiment doesn't change which spans
+// are allocated from. When a young span is next swept, the sweep
+// counts how many of its objects survived and turns it into an
+// ordinary span. Spans in which nothing survived are freed by the
+// sweep as usual. GODEBUG=gctrace=1 reports the counts each cycle.
+
+package runtime
+
+import "runtime/internal/atomic"
+
+// youngSpansEnabled is set by mallocinit under GOEXPERIMENT=gennursery.
+var youngSpansEnabled bool
+
+// youngSpanStats counts the objects in young spans swept since gctrace
+// last reported them. Accessed atomically.
+var youngSpanStats struct {
+	allocs   uint64 // objects allocated in young spans
+	survived uint64 // of those, objects that survived
+	emptied  uint64 // young spans in which no objects survived
+}
+
+// youngSpanSwept records the sweep of young span s, which holds
+// allocCount objects of which nalloc survived, and makes s an ordinary
+// span.
+func youngSpanSwept(s *mspan, allocCount, nalloc uint16) {
+	s.young = 0
+	atomic.Xadd64(&youngSpanStats.allocs, int64(allocCount))
+	atomic.Xadd64(&youngSpanStats.survived, int64(nalloc))
+	if nalloc == 0 {
+		atomic.Xadd64(&youngSpanStats.emptied, 1)
+	}
+}
+
+// printYoungSpanStats prints and resets the young span counts for gctrace.
+func printYoungSpanStats() {
+	allocs := atomic.Xchg64(&youngSpanStats.allocs, 0)
+	survived := atomic.Xchg64(&youngSpanStats.survived, 0)
+	emptied := atomic.Xchg64(&youngSpanStats.emptied, 0)
+	var pct uint64
+	if allocs != 0 {
+		pct = survived * 100 / allocs
+	}
+	print("young spans: ", allocs, " objects, ", survived, " survived (", pct, "%), ", emptied, " spans emptied\n")
+}
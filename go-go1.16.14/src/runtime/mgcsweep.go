@@ -26,6 +26,7 @@ package runtime
 
 import (
 	"runtime/internal/atomic"
+	"runtime/internal/sys"
 	"unsafe"
 )
 
@@ -53,6 +54,15 @@ type sweepdata struct {
 	// 注释：在标记终止时重置。由 mheap.nextSpanForSweep 使用。
 	//
 	centralIndex sweepClass // 注释：(当前未清理)需要清扫mcentral中的span对象ID
+
+	// assistLimit is the most pages an allocating goroutine
+	// sweeps in one go to pay off sweep debt, or 0 for no limit.
+	// Accessed atomically.
+	assistLimit uint32
+
+	// bgBatch is the number of spans the background sweeper sweeps
+	// before it yields, where 0 means 1. Accessed atomically.
+	bgBatch uint32
 }
 
 // sweepClass is a spanClass and one bit to represent whether we're currently
@@ -174,9 +184,13 @@ func bgsweep(c chan int) {
 	goparkunlock(&sweep.lock, waitReasonGCSweepWait, traceEvGoBlock, 1)
 
 	for {
+		batch := uint32(0)
 		for sweepone() != ^uintptr(0) {
 			sweep.nbgsweep++
-			Gosched()
+			if batch++; batch >= atomic.Load(&sweep.bgBatch) {
+				batch = 0
+				Gosched()
+			}
 		}
 		for freeSomeWbufs(true) {
 			Gosched()
@@ -199,6 +213,13 @@ func bgsweep(c chan int) {
 // 注释：是清理（sweep）未清理的堆跨度（heap span），并返回归还给堆的页面数量。如果没有需要清理的内容，则返回^uintptr(0)。
 // 注释：清理一个
 func sweepone() uintptr {
+	npages, _ := sweeponeSwept()
+	return npages
+}
+
+// sweeponeSwept is like sweepone, but also returns the number of
+// pages in the span it swept, whether or not they were freed.
+func sweeponeSwept() (npages, swept uintptr) {
 	_g_ := getg()
 	sweepRatio := mheap_.sweepPagesPerByte // For debugging
 
@@ -207,7 +228,7 @@ func sweepone() uintptr {
 	_g_.m.locks++                            // 注释：加锁
 	if atomic.Load(&mheap_.sweepdone) != 0 { // 注释：如果所有的span都被扫描过了则解锁并返回没有需要清理标识
 		_g_.m.locks--
-		return ^uintptr(0)
+		return ^uintptr(0), 0
 	}
 	atomic.Xadd(&mheap_.sweepers, +1) // 注释：标记活动数加一
 
@@ -238,9 +259,10 @@ func sweepone() uintptr {
 
 	// Sweep the span we found.
 	// 注释：清扫找到的span
-	npages := ^uintptr(0)
+	npages = ^uintptr(0)
 	if s != nil {
 		npages = s.npages
+		swept = s.npages
 		if s.sweep(false) { // 注释：执行清理
 			// Whole span was freed. Count it toward the
 			// page reclaimer credit since these pages can
@@ -284,7 +306,7 @@ func sweepone() uintptr {
 		}
 	}
 	_g_.m.locks--
-	return npages
+	return npages, swept
 }
 
 // isSweepDone reports whether all spans are swept or currently being swept.
@@ -437,7 +459,7 @@ func (s *mspan) sweep(preserve bool) bool {
 		spanHasNoSpecials(s)
 	}
 
-	if debug.allocfreetrace != 0 || debug.clobberfree != 0 || raceenabled || msanenabled {
+	if debug.allocfreetrace != 0 || debug.clobberfree != 0 || s.poisoned != 0 || raceenabled || msanenabled {
 		// Find all newly freed objects. This doesn't have to
 		// efficient; allocfreetrace has massive overhead.
 		mbits := s.markBitsForBase()
@@ -451,6 +473,9 @@ func (s *mspan) sweep(preserve bool) bool {
 				if debug.clobberfree != 0 {
 					clobberfree(unsafe.Pointer(x), size)
 				}
+				if s.poisoned != 0 {
+					poisonObject(x, size)
+				}
 				if raceenabled {
 					racefree(unsafe.Pointer(x), size)
 				}
@@ -489,9 +514,13 @@ func (s *mspan) sweep(preserve bool) bool {
 		// The zombie check above should have caught this in
 		// more detail.
 		print("runtime: nelems=", s.nelems, " nalloc=", nalloc, " previous allocCount=", s.allocCount, " nfreed=", nfreed, "\n")
+		printSpanAllocTrace(s)
 		throw("sweep increased allocation count")
 	}
 
+	if s.young != 0 {
+		youngSpanSwept(s, s.allocCount, nalloc)
+	}
 	s.allocCount = nalloc
 	s.freeindex = 0 // reset allocation index to start of span.
 	if trace.enabled {
@@ -506,6 +535,21 @@ func (s *mspan) sweep(preserve bool) bool {
 	// Initialize alloc bits cache.
 	s.refillAllocCache(0)
 
+	// The first time a small object span is swept with heappoison,
+	// poison all of its free slots. From then on, the loop above
+	// poisons the objects each sweep frees.
+	if debug.heappoison != 0 && spc.sizeclass() != 0 && s.poisoned == 0 && nalloc != 0 {
+		abits := s.allocBitsForIndex(0)
+		for i := uintptr(0); i < s.nelems; i++ {
+			if !abits.isMarked() {
+				poisonObject(s.base()+i*s.elemsize, size)
+			}
+			abits.advance()
+		}
+		s.poisoned = 1
+		s.needzero = 1
+	}
+
 	// The span must be in our exclusive ownership until we update sweepgen,
 	// check for potential races.
 	if state := s.state.get(); state != mSpanInUse || s.sweepgen != sweepgen-1 {
@@ -528,6 +572,10 @@ func (s *mspan) sweep(preserve bool) bool {
 	// to go so release the span.
 	atomic.Store(&s.sweepgen, sweepgen)
 
+	if fn := spanSweepObserver; fn != nil {
+		fn(uint8(spc), nfreed)
+	}
+
 	if spc.sizeclass() != 0 {
 		// Handle spans for small objects.
 		if nfreed > 0 {
@@ -596,6 +644,26 @@ func (s *mspan) sweep(preserve bool) bool {
 	return false
 }
 
+// spanSweepObserver, if non-nil, is called by mspan.sweep each time
+// a span finishes sweeping.
+var spanSweepObserver func(spanClass uint8, freed uint16)
+
+// SetSpanSweepObserver arranges for fn to be called each time the
+// garbage collector finishes sweeping a span, reporting the span's
+// class and the number of objects that sweeping freed in it. A span
+// class encodes the object size class in its upper bits and whether
+// the objects contain no pointers in its lowest bit; large objects
+// have size class 0.
+//
+// fn is called on the sweep path, which may be a background sweeper,
+// an allocating goroutine or the collector itself, with preemption
+// disabled and possibly on the system stack. It must not allocate,
+// block or otherwise call into the runtime, and should do as little as
+// possible. Passing nil removes the observer.
+func SetSpanSweepObserver(fn func(spanClass uint8, freed uint16)) {
+	spanSweepObserver = fn
+}
+
 // reportZombies reports any marked but free objects in s and throws.
 //
 // This generally means one of the following:
@@ -644,6 +712,7 @@ func (s *mspan) reportZombies() {
 		mbits.advance()
 		abits.advance()
 	}
+	printSpanAllocTrace(s)
 	throw("found pointer to free object")
 }
 
@@ -667,19 +736,27 @@ func (s *mspan) reportZombies() {
 // sweep phase between GC cycles.
 // 注释：reduceSweepCredit是“比例扫描”系统的核心。它使用垃圾收集器收集的统计信息来执行足够的扫描，以便在GC周期之间的并发扫描阶段扫描所有页面。
 //
+// deductSweepCredit returns the number of pages it swept itself.
+//
 // mheap_ must NOT be locked.
 //
 // 注释：减低清理积分spanBytes是一个span的大小【ing】
-func deductSweepCredit(spanBytes uintptr, callerSweepPages uintptr) {
+func deductSweepCredit(spanBytes uintptr, callerSweepPages uintptr) (swept uintptr) {
 	if mheap_.sweepPagesPerByte == 0 {
 		// Proportional sweep is done or disabled.
-		return
+		return 0
 	}
 
 	if trace.enabled { // 注释：是否开启链路追踪
 		traceGCSweepStart() // 注释：GC链路追踪
 	}
 
+	// With an assist limit, stop once this caller has swept that
+	// many pages and leave the rest of the debt to the background
+	// sweeper and later allocations. Pages swept concurrently by
+	// other sweepers don't count against the limit.
+	limit := uintptr(atomic.Load(&sweep.assistLimit))
+
 retry:
 	sweptBasis := atomic.Load64(&mheap_.pagesSweptBasis) // 注释：清扫扫描的起始位置
 
@@ -687,10 +764,15 @@ retry:
 	newHeapLive := uintptr(atomic.Load64(&memstats.heap_live)-mheap_.sweepHeapLiveBasis) + spanBytes
 	pagesTarget := int64(mheap_.sweepPagesPerByte*float64(newHeapLive)) - int64(callerSweepPages)
 	for pagesTarget > int64(atomic.Load64(&mheap_.pagesSwept)-sweptBasis) {
-		if sweepone() == ^uintptr(0) {
+		if limit != 0 && swept >= limit {
+			break
+		}
+		npages, n := sweeponeSwept()
+		if npages == ^uintptr(0) {
 			mheap_.sweepPagesPerByte = 0
 			break
 		}
+		swept += n
 		if atomic.Load64(&mheap_.pagesSweptBasis) != sweptBasis {
 			// Sweep pacing changed. Recompute debt.
 			goto retry
@@ -700,6 +782,61 @@ retry:
 	if trace.enabled {
 		traceGCSweepDone()
 	}
+	return swept
+}
+
+//go:linkname setSweepAssistLimit runtime/debug.setSweepAssistLimit
+func setSweepAssistLimit(pages int) int {
+	if pages < 0 {
+		return int(atomic.Load(&sweep.assistLimit))
+	}
+	n := uint32(pages)
+	if uint64(pages) > 1<<32-1 {
+		n = 1<<32 - 1
+	}
+	return int(atomic.Xchg(&sweep.assistLimit, n))
+}
+
+//go:linkname setBackgroundSweepBatch runtime/debug.setBackgroundSweepBatch
+func setBackgroundSweepBatch(spans int) int {
+	var old uint32
+	if spans <= 0 {
+		old = atomic.Load(&sweep.bgBatch)
+	} else {
+		n := uint32(spans)
+		if uint64(spans) > 1<<32-1 {
+			n = 1<<32 - 1
+		}
+		old = atomic.Xchg(&sweep.bgBatch, n)
+	}
+	if old == 0 {
+		old = 1
+	}
+	return int(old)
+}
+
+// heapPoison is the pattern GODEBUG=heappoison fills free heap
+// objects with, repeated in every word.
+const heapPoison = ^uintptr(0) / 0xff * 0xf5
+
+// poisonObject fills the free small object at x of the given size,
+// which is a multiple of the word size, with heapPoison.
+func poisonObject(x, size uintptr) {
+	for p := x; p < x+size; p += sys.PtrSize {
+		*(*uintptr)(unsafe.Pointer(p)) = heapPoison
+	}
+}
+
+// checkPoison throws if the free small object at x, about to be
+// allocated, has been written to since poisonObject filled it.
+func checkPoison(x, size uintptr) {
+	for p := x; p < x+size; p += sys.PtrSize {
+		if *(*uintptr)(unsafe.Pointer(p)) != heapPoison {
+			print("runtime: write at ", hex(p), " to freed object ", hex(x), " of size ", size, "\n")
+			printSpanAllocTrace(spanOf(x))
+			throw("heap poison overwritten")
+		}
+	}
 }
 
 // clobberfree sets the memory content at x to bad content, for debugging
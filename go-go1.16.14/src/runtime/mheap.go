@@ -133,6 +133,11 @@ type mheap struct {
 	// 注释：译：reclainIndex是下一个要回收的页面的allArenas中的页面索引。具体来说，它是指arena(竞技场)allArenas[i/pagesPerArena]的页面（i%pagesPerArena）。
 	//		如果这是>=1<<63，则页面回收器将完成对页面标记的扫描。这是以原子方式访问的。
 	reclaimIndex uint64 // 注释：回收的下标
+
+	// reclaimed is the total number of pages the page reclaimer
+	// has freed. This is accessed atomically.
+	reclaimed uint64
+
 	// reclaimCredit is spare credit for extra pages swept. Since
 	// the page reclaimer works in large chunks, it may reclaim
 	// more than requested. Any spare pages released go to this
@@ -142,6 +147,12 @@ type mheap struct {
 	// This is accessed atomically.
 	reclaimCredit uintptr // 注释：回收信用，类似受保护缓冲区，如果回收的页数大于这个值时，超出的页数则进行回收，(可用的页的数量)
 
+	// reclaimers is the number of goroutines claiming chunks of
+	// work in reclaim. It is at most reclaimerLimit, if that is set.
+	// This is accessed atomically.
+	reclaimers uint32
+	_          uint32 // ensure 64-bit alignment of central on 32-bit
+
 	// arenas is the heap arena map. It points to the metadata for
 	// the heap for every arena frame of the entire usable virtual
 	// address space.
@@ -238,6 +249,7 @@ type mheap struct {
 	specialprofilealloc   fixalloc // allocator for specialprofile*
 	speciallock           mutex    // lock for special record allocators.
 	arenaHintAlloc        fixalloc // allocator for arenaHints
+	spanTraceAlloc        fixalloc // allocator for spanAllocTrace*
 
 	unused *specialfinalizer // never set, just here to force the specialfinalizer type into DWARF
 }
@@ -330,6 +342,11 @@ type heapArena struct {
 	//
 	// Read atomically and written with an atomic CAS.
 	zeroedBase uintptr
+
+	// hugeTLB records, for each palloc chunk of the arena, whether
+	// it is backed by explicit huge pages. Written once, with the
+	// heap lock held, when the chunk is mapped.
+	hugeTLB [heapArenaBytes / pallocChunkBytes]bool
 }
 
 // arenaHint is a hint for where to grow the heap arenas. See
@@ -531,12 +548,19 @@ type mspan struct {
 	spanclass   spanClass     // 注释：span的ID(也叫做对象ID，对应【class】字段，位置：/src/runtime/sizeclasses.go) // size class and noscan (uint8)
 	state       mSpanStateBox // 注释：span的状态 // mSpanInUse etc; accessed atomically (get/set methods)
 	needzero    uint8         // 注释：需要在分配前归零(零填充)，1是0否 // needs to be zeroed before allocation
+	poisoned    uint8         // free slots hold the heap poison pattern (GODEBUG=heappoison)
+	young       uint8         // span holds only objects allocated since it was last swept (GOEXPERIMENT=gennursery)
+	userArena   uint8         // span is a manually managed chunk of an Arena
 	divShift    uint8         // for divide by elemsize - divMagic.shift
 	divShift2   uint8         // for divide by elemsize - divMagic.shift2
 	elemsize    uintptr       // 注释：(块大小)存储的单个对象大小；(对应class表中的【bytes/obj】字段,地址:/src/runtime/sizeclasses.go) // computed from sizeclass or from npages
 	limit       uintptr       // 注释：内存尾部地址(s.base() + sapn的对象大小*页数量) // end of data in span
 	speciallock mutex         // guards specials list
 	specials    *special      // 注释：译：按偏移量排序的特殊记录的链接列表。 // linked list of special records sorted by offset.
+
+	// allocTrace records recent allocations into a heap span
+	// (GODEBUG=spantrace). It is nil if span tracing is off.
+	allocTrace *spanAllocTrace
 }
 
 // 注释：获取span的基地址
@@ -553,6 +577,25 @@ func (s *mspan) layout() (size, n, total uintptr) {
 	return
 }
 
+// forEachInUseSpan calls f for every in-use span in h.allspans.
+//
+// The world must be stopped, so that the set of spans and their
+// allocation state form a consistent snapshot for the walk. f must
+// not allocate or free spans.
+//
+//go:systemstack
+func (h *mheap) forEachInUseSpan(f func(s *mspan)) {
+	assertWorldStopped()
+
+	lock(&h.lock)
+	for _, s := range h.allspans {
+		if s.state.get() == mSpanInUse {
+			f(s)
+		}
+	}
+	unlock(&h.lock)
+}
+
 // recordspan adds a newly allocated span to h.allspans.
 //
 // This only happens the first time a span is allocated from
@@ -746,6 +789,33 @@ func spanOf(p uintptr) *mspan {
 	return ha.spans[(p/pageSize)%pagesPerArena]
 }
 
+// badArenaPointer reports whether p, for which spanOf returned nil, is
+// certainly not a valid pointer: its arena index is out of bounds, so
+// it lies outside the address space the heap may use, or it points
+// into a heap arena at a page that no span has ever contained. Other
+// pointers spanOf finds no span for point outside the heap, for
+// instance to globals or memory allocated by C, and are fine.
+//
+//go:nosplit
+func badArenaPointer(p uintptr) bool {
+	ri := arenaIndex(p)
+	if arenaL1Bits == 0 {
+		if ri.l2() >= uint(len(mheap_.arenas[0])) {
+			return true
+		}
+	} else {
+		if ri.l1() >= uint(len(mheap_.arenas)) {
+			return true
+		}
+	}
+	l2 := mheap_.arenas[ri.l1()]
+	if arenaL1Bits != 0 && l2 == nil {
+		return false
+	}
+	ha := l2[ri.l2()]
+	return ha != nil && ha.spans[(p/pageSize)%pagesPerArena] == nil
+}
+
 // spanOfUnchecked is equivalent to spanOf, but the caller must ensure
 // that p points into an allocated heap arena.
 //
@@ -796,6 +866,7 @@ func (h *mheap) init() {
 	h.cachealloc.init(unsafe.Sizeof(mcache{}), nil, nil, &memstats.mcache_sys)
 	h.specialfinalizeralloc.init(unsafe.Sizeof(specialfinalizer{}), nil, nil, &memstats.other_sys)
 	h.specialprofilealloc.init(unsafe.Sizeof(specialprofile{}), nil, nil, &memstats.other_sys)
+	h.spanTraceAlloc.init(unsafe.Sizeof(spanAllocTrace{}), nil, nil, &memstats.other_sys)
 	h.arenaHintAlloc.init(unsafe.Sizeof(arenaHint{}), nil, nil, &memstats.other_sys)
 
 	// Don't zero mspan allocations. Background sweeping can
@@ -858,6 +929,7 @@ func (h *mheap) reclaim(npage uintptr) {
 
 	arenas := h.sweepArenas // 注释：获取需要回收的arena
 	locked := false
+	claiming := false
 	for npage > 0 { // 注释：遍历页数量，逐个执行
 		// Pull from accumulated credit first.
 		// 注释：译：先从累积的信贷中提取
@@ -874,15 +946,32 @@ func (h *mheap) reclaim(npage uintptr) {
 			continue
 		}
 
+		if !claiming {
+			if !h.enterReclaim() {
+				// Enough goroutines are reclaiming already.
+				// Leave the rest to them and the sweeper
+				// rather than contend for the heap lock.
+				break
+			}
+			claiming = true
+		}
+
 		// Claim a chunk of work.
 		// 注释：译：索赔一大块工作。
 		// 注释：(idx是&h.reclaimIndex的旧值)idx = &h.reclaimIndex; &h.reclaimIndex += pagesPerReclaimerChunk
-		idx := uintptr(atomic.Xadd64(&h.reclaimIndex, pagesPerReclaimerChunk) - pagesPerReclaimerChunk) // 注释：获取回收下标后，重置下标，原子操作
+		chunk := reclaimChunkPages()
+		idx := uintptr(atomic.Xadd64(&h.reclaimIndex, int64(chunk)) - uint64(chunk)) // 注释：获取回收下标后，重置下标，原子操作
 		if idx/pagesPerArena >= uintptr(len(arenas)) {
 			// Page reclaiming is done.
 			atomic.Store64(&h.reclaimIndex, 1<<63)
 			break
 		}
+		// The chunk size may have changed since earlier chunks
+		// were claimed, so idx is not necessarily chunk-aligned.
+		// Don't scan past the last arena.
+		if end := uintptr(len(arenas)) * pagesPerArena; idx+chunk > end {
+			chunk = end - idx
+		}
 
 		if !locked {
 			// Lock the heap for reclaimChunk.
@@ -891,7 +980,8 @@ func (h *mheap) reclaim(npage uintptr) {
 		}
 
 		// Scan this chunk.
-		nfound := h.reclaimChunk(arenas, idx, pagesPerReclaimerChunk)
+		nfound := h.reclaimChunk(arenas, idx, chunk)
+		atomic.Xadd64(&h.reclaimed, int64(nfound))
 		if nfound <= npage {
 			npage -= nfound
 		} else {
@@ -903,6 +993,9 @@ func (h *mheap) reclaim(npage uintptr) {
 	if locked {
 		unlock(&h.lock)
 	}
+	if claiming {
+		atomic.Xadd(&h.reclaimers, -1)
+	}
 
 	if trace.enabled {
 		traceGCSweepDone()
@@ -910,6 +1003,83 @@ func (h *mheap) reclaim(npage uintptr) {
 	releasem(mp)
 }
 
+// reclaimerLimit is the maximum number of goroutines that may claim
+// page reclaimer work at once, or 0 for no limit.
+// Set by runtime/debug.SetPageReclaimers.
+var reclaimerLimit uint32
+
+// reclaimChunkSize is the number of pages the page reclaimer claims at a
+// time, or 0 for pagesPerReclaimerChunk.
+// Set by runtime/debug.SetPageReclaimChunk.
+var reclaimChunkSize uint32
+
+// reclaimChunkPages returns the number of pages to claim at a time in
+// reclaim. It is a power of two between 8, the pageInUse bitmap element
+// size, and pagesPerArena.
+func reclaimChunkPages() uintptr {
+	if n := atomic.Load(&reclaimChunkSize); n != 0 {
+		return uintptr(n)
+	}
+	return pagesPerReclaimerChunk
+}
+
+// enterReclaim counts the calling goroutine as a page reclaimer. It
+// reports false if that would exceed reclaimerLimit.
+func (h *mheap) enterReclaim() bool {
+	for {
+		n := atomic.Load(&h.reclaimers)
+		if limit := atomic.Load(&reclaimerLimit); limit != 0 && n >= limit {
+			return false
+		}
+		if atomic.Cas(&h.reclaimers, n, n+1) {
+			return true
+		}
+	}
+}
+
+//go:linkname setPageReclaimers runtime/debug.setPageReclaimers
+func setPageReclaimers(n int) int {
+	if n < 0 {
+		return int(atomic.Load(&reclaimerLimit))
+	}
+	limit := uint32(n)
+	if uint64(n) > 1<<32-1 {
+		limit = 1<<32 - 1
+	}
+	return int(atomic.Xchg(&reclaimerLimit, limit))
+}
+
+//go:linkname setPageReclaimChunk runtime/debug.setPageReclaimChunk
+func setPageReclaimChunk(pages int) int {
+	old := reclaimChunkPages()
+	if pages <= 0 {
+		return int(old)
+	}
+	n := uintptr(8)
+	for n < pagesPerArena && uint64(n*2) <= uint64(pages) {
+		n *= 2
+	}
+	atomic.Store(&reclaimChunkSize, uint32(n))
+	return int(old)
+}
+
+//go:linkname readReclaimStats runtime/debug.readReclaimStats
+func readReclaimStats() (scanned, pages, credit, reclaimed uint64, active int) {
+	h := &mheap_
+	// sweepArenas only changes while the world is stopped.
+	pages = uint64(len(h.sweepArenas)) * pagesPerArena
+	scanned = atomic.Load64(&h.reclaimIndex)
+	if scanned > pages || atomic.Load(&h.sweepdone) != 0 {
+		// Either the reclaimer finished scanning or the
+		// sweeper finished for it.
+		scanned = pages
+	}
+	credit = uint64(atomic.Loaduintptr(&h.reclaimCredit))
+	reclaimed = atomic.Load64(&h.reclaimed)
+	active = int(atomic.Load(&h.reclaimers))
+	return
+}
+
 // reclaimChunk sweeps unmarked spans that start at page indexes [pageIdx, pageIdx+n).
 // It returns the number of pages returned to the heap.
 //
@@ -992,6 +1162,7 @@ const (
 	spanAllocStack                              // stack span
 	spanAllocPtrScalarBits                      // unrolled GC prog bitmap span
 	spanAllocWorkBuf                            // work buf span
+	spanAllocUserArena                          // Arena chunk span
 )
 
 // manual returns true if the span allocation is manually managed.
@@ -1260,14 +1431,28 @@ func (h *mheap) allocSpan(npages uintptr, typ spanAllocType, spanclass spanClass
 	// The page cache does not support aligned allocations, so we cannot use
 	// it if we need to provide a physical page aligned stack allocation.
 	pp := gp.m.p.ptr() // 注释：获取P
+
+	// Large objects first try to reuse the pages of a recently
+	// freed span of the same size.
+	if typ == spanAllocHeap && spanclass.sizeclass() == 0 && pp != nil {
+		if base = pp.lcache.take(npages); base != 0 {
+			s = h.tryAllocMSpan()
+			if s != nil {
+				goto HaveSpan
+			}
+			// We have a base but no mspan, so we need
+			// to lock the heap.
+		}
+	}
+
 	// 注释：尝试从p的缓存中获取内存
-	if !needPhysPageAlign && pp != nil && npages < pageCachePages/4 {
+	if base == 0 && !needPhysPageAlign && pp != nil && npages < pageCachePages/4 {
 		c := &pp.pcache
 
 		// If the cache is empty, refill it.
 		if c.empty() { // 注释：如果缓存为空则从新装填(装填是从全局的mheap里的获取，所以需要加锁)
 			lock(&h.lock)               // 注释：加锁
-			*c = h.pages.allocToCache() // 注释：装填缓存（从全局的mheap里的获取装填到p.pcache里）
+			*c = h.allocToCacheNUMA(pp) // 注释：装填缓存（从全局的mheap里的获取装填到p.pcache里）
 			unlock(&h.lock)             // 注释：解锁
 		}
 
@@ -1296,6 +1481,10 @@ func (h *mheap) allocSpan(npages uintptr, typ spanAllocType, spanclass spanClass
 
 	// 注释：从全局的mheap里获取基地址的偏移量
 	// 注释：在mheap里的定位要获取的内存对应的地址
+	if base == 0 && numaHeap.enabled && pp != nil && !needPhysPageAlign {
+		// Try the P's own node first.
+		base, scav = h.allocNUMA(pp, npages)
+	}
 	if base == 0 {
 		// Try to acquire a base address.
 		base, scav = h.pages.alloc(npages) // 注释：尝试从mheap里获取基地址的偏移量，和已经清理的地址
@@ -1378,6 +1567,7 @@ HaveSpan:
 		s.allocCache = ^uint64(0) // all 1s indicating all free.
 		s.gcmarkBits = newMarkBits(s.nelems)
 		s.allocBits = newAllocBits(s.nelems)
+		s.allocTrace = h.newSpanAllocTrace()
 
 		// It's safe to access h.sweepgen without the heap lock because it's
 		// only ever updated with the world stopped and we run on the
@@ -1411,6 +1601,7 @@ HaveSpan:
 	if typ.manual() {
 		// Manually managed memory doesn't count toward heap_sys.
 		memstats.heap_sys.add(-int64(nbytes))
+		atomic.Xadd64(&manualInUse, int64(nbytes))
 	}
 	// Update consistent stats.
 	stats := memstats.heapStats.acquire()
@@ -1425,6 +1616,8 @@ HaveSpan:
 		atomic.Xaddint64(&stats.inPtrScalarBits, int64(nbytes))
 	case spanAllocWorkBuf:
 		atomic.Xaddint64(&stats.inWorkBufs, int64(nbytes))
+	case spanAllocUserArena:
+		atomic.Xaddint64(&stats.inUserArenas, int64(nbytes))
 	}
 	memstats.heapStats.release()
 
@@ -1476,39 +1669,12 @@ func (h *mheap) grow(npage uintptr) bool {
 		// Not enough room in the current arena. Allocate more
 		// arena space. This may not be contiguous with the
 		// current arena, so we have to request the full ask.
-		av, asize := h.sysAlloc(ask)
-		if av == nil {
+		growth, ok := h.extendCurArena(ask)
+		if !ok {
 			print("runtime: out of memory: cannot allocate ", ask, "-byte block (", memstats.heap_sys, " in use)\n")
 			return false
 		}
-
-		if uintptr(av) == h.curArena.end {
-			// The new space is contiguous with the old
-			// space, so just extend the current space.
-			h.curArena.end = uintptr(av) + asize
-		} else {
-			// The new space is discontiguous. Track what
-			// remains of the current space and switch to
-			// the new space. This should be rare.
-			if size := h.curArena.end - h.curArena.base; size != 0 {
-				h.pages.grow(h.curArena.base, size)
-				totalGrowth += size
-			}
-			// Switch to the new space.
-			h.curArena.base = uintptr(av)
-			h.curArena.end = uintptr(av) + asize
-		}
-
-		// The memory just allocated counts as both released
-		// and idle, even though it's not yet backed by spans.
-		//
-		// The allocation is always aligned to the heap arena
-		// size which is always > physPageSize, so its safe to
-		// just add directly to heap_released.
-		atomic.Xadd64(&memstats.heap_released, int64(asize))
-		stats := memstats.heapStats.acquire()
-		atomic.Xaddint64(&stats.released, int64(asize))
-		memstats.heapStats.release()
+		totalGrowth += growth
 
 		// Recalculate nBase.
 		// We know this won't overflow, because sysAlloc returned
@@ -1522,6 +1688,9 @@ func (h *mheap) grow(npage uintptr) bool {
 	h.curArena.base = nBase
 	h.pages.grow(v, nBase-v)
 	totalGrowth += nBase - v
+	if numaHeap.enabled {
+		h.bindNUMA(v, nBase-v)
+	}
 
 	// We just caused a heap growth, so scavenge down what will soon be used.
 	// By scavenging inline we deal with the failure to allocate out of
@@ -1534,9 +1703,225 @@ func (h *mheap) grow(npage uintptr) bool {
 		}
 		h.pages.scavenge(todo, false)
 	}
+
+	// Fault in the new memory only now, so that the scavenge above,
+	// which already assumes it will soon be used, doesn't release it
+	// again.
+	if atomic.Load(&arenaPrefault) != 0 {
+		h.prefault(v, nBase-v)
+	}
 	return true
 }
 
+// arenaPrefault is 1 if grow should fault in new heap memory as it is
+// added to the page heap. Accessed atomically.
+var arenaPrefault uint32
+
+// SetArenaPrefault controls whether the runtime faults in the pages of
+// newly mapped heap memory as soon as the heap grows into it. Normally
+// fresh heap memory is only backed by physical pages when it is first
+// written, so a program that is growing its heap takes page faults
+// spread across the allocations that use the new memory. With prefault
+// enabled, those faults are taken up front, in one go, when the heap
+// grows, which trades a longer stall on growth for fewer faults later.
+//
+// Prefaulted memory is backed by physical pages, and is accounted for
+// as such, even before it is used. It is subject to the usual
+// scavenging policy, so it may be returned to the operating system
+// again if the heap is over its scavenging goal. Prefault is disabled
+// by default.
+func SetArenaPrefault(enabled bool) {
+	var v uint32
+	if enabled {
+		v = 1
+	}
+	atomic.Store(&arenaPrefault, v)
+}
+
+// prefault faults in the pages of [base, base+size), which must be
+// whole palloc chunks that were just added to the page heap by
+// h.pages.grow, and marks them as no longer scavenged.
+//
+// h.lock must be held.
+func (h *mheap) prefault(base, size uintptr) {
+	assertLockHeld(&h.lock)
+
+	// Nothing else can be using this memory yet, so a plain write
+	// is safe and, since the memory is still zeroed, harmless.
+	sysUsed(unsafe.Pointer(base), size)
+	for p := base; p < base+size; p += physPageSize {
+		*(*uint8)(unsafe.Pointer(p)) = 0
+	}
+	for c := chunkIndex(base); c < chunkIndex(base+size); c++ {
+		h.pages.chunkOf(c).scavenged.clearAll()
+	}
+	atomic.Xadd64(&memstats.heap_released, -int64(size))
+	stats := memstats.heapStats.acquire()
+	atomic.Xaddint64(&stats.committed, int64(size))
+	atomic.Xaddint64(&stats.released, -int64(size))
+	memstats.heapStats.release()
+}
+
+// extendCurArena maps at least ask more bytes of arena space and makes
+// it available to h.curArena. It returns the number of bytes the page
+// heap grew by as a result, which is nonzero only if the new space is
+// not contiguous with the current arena.
+//
+// h.lock must be held.
+func (h *mheap) extendCurArena(ask uintptr) (totalGrowth uintptr, ok bool) {
+	assertLockHeld(&h.lock)
+
+	av, asize := h.sysAlloc(ask)
+	if av == nil {
+		return 0, false
+	}
+
+	if uintptr(av) == h.curArena.end {
+		// The new space is contiguous with the old
+		// space, so just extend the current space.
+		h.curArena.end = uintptr(av) + asize
+	} else {
+		// The new space is discontiguous. Track what
+		// remains of the current space and switch to
+		// the new space. This should be rare.
+		if size := h.curArena.end - h.curArena.base; size != 0 {
+			h.pages.grow(h.curArena.base, size)
+			totalGrowth += size
+		}
+		// Switch to the new space.
+		h.curArena.base = uintptr(av)
+		h.curArena.end = uintptr(av) + asize
+	}
+
+	// The memory just allocated counts as both released
+	// and idle, even though it's not yet backed by spans.
+	//
+	// The allocation is always aligned to heapReserveBytes,
+	// which is always > physPageSize, so its safe to
+	// just add directly to heap_released.
+	atomic.Xadd64(&memstats.heap_released, int64(asize))
+	stats := memstats.heapStats.acquire()
+	atomic.Xaddint64(&stats.released, int64(asize))
+	memstats.heapStats.release()
+	return totalGrowth, true
+}
+
+// heapPregrow is the state of the background heap pre-grower, which
+// maps new arena space ahead of demand while the heap is growing, so
+// that allocations find it already mapped.
+var heapPregrow struct {
+	rate uint64 // bytes per second the pre-grower may map; 0 disables it; accessed atomically
+
+	// pregrown is the total number of bytes mapped by the
+	// pre-grower. Accessed atomically.
+	pregrown uint64
+
+	running uint32 // whether bgheappregrow is running; accessed atomically
+}
+
+const (
+	// heapPregrowPeriod is how often the pre-grower checks the heap.
+	heapPregrowPeriod = 10 * 1000 * 1000 // 10ms
+
+	// heapPregrowLookahead is how far ahead the pre-grower tries
+	// to stay, at the rate the heap grew in the last period.
+	heapPregrowLookahead = 100 * 1000 * 1000 // 100ms
+)
+
+// SetHeapGrowthRateLimit enables pre-growing of the heap's address space
+// and limits it to bytesPerSec bytes per second.
+//
+// Normally the heap maps more address space only when an allocation
+// finds the mapped space exhausted, so a fast-growing program maps new
+// heap arenas in bursts, each on the path of some allocation. With a
+// nonzero limit, a background goroutine watches the heap while it grows
+// and maps arena space ahead of the allocations that will need it, no
+// faster than bytesPerSec. Allocations are never delayed by the limit:
+// if the pre-grown space runs out, they grow the heap themselves as
+// usual.
+//
+// Pre-grown space is counted in MemStats.HeapSys and HeapReleased but is
+// not backed by physical memory until it is used. A limit of 0, the
+// default, disables pre-growing.
+func SetHeapGrowthRateLimit(bytesPerSec uint64) {
+	atomic.Store64(&heapPregrow.rate, bytesPerSec)
+	if bytesPerSec != 0 && atomic.Cas(&heapPregrow.running, 0, 1) {
+		go bgheappregrow()
+	}
+}
+
+// heapPregrowMaxBudget bounds the pre-grower's budget, so that an idle
+// period doesn't save up for a burst.
+const heapPregrowMaxBudget = 2 * heapArenaBytes
+
+// heapPregrowCredit returns budget plus what the pre-grower earns at
+// rate bytes per second over dt nanoseconds, saturating at
+// heapPregrowMaxBudget.
+func heapPregrowCredit(budget, rate uint64, dt int64) uint64 {
+	if dt <= 0 {
+		return budget
+	}
+	// Anything more than a second's worth is over the maximum
+	// anyway for any rate that can pre-grow at all.
+	if dt > 1e9 {
+		dt = 1e9
+	}
+	if rate > heapPregrowMaxBudget*1e9/uint64(dt) {
+		return heapPregrowMaxBudget
+	}
+	budget += rate * uint64(dt) / 1e9
+	if budget > heapPregrowMaxBudget {
+		budget = heapPregrowMaxBudget
+	}
+	return budget
+}
+
+// bgheappregrow is the background heap pre-grower. It exits when
+// pre-growing is disabled.
+func bgheappregrow() {
+	var budget uint64
+	var lastBase uintptr
+	last := nanotime()
+	for {
+		timeSleep(heapPregrowPeriod)
+
+		rate := atomic.Load64(&heapPregrow.rate)
+		if rate == 0 {
+			atomic.Store(&heapPregrow.running, 0)
+			// Recheck in case the limit was set again before
+			// we gave up.
+			if atomic.Load64(&heapPregrow.rate) == 0 || !atomic.Cas(&heapPregrow.running, 0, 1) {
+				return
+			}
+			continue
+		}
+		now := nanotime()
+		budget = heapPregrowCredit(budget, rate, now-last)
+		last = now
+
+		systemstack(func() {
+			h := &mheap_
+			lock(&h.lock)
+			// Estimate how much the heap will grow by over the
+			// lookahead from how much it just grew.
+			var grown uintptr
+			if h.curArena.base > lastBase && lastBase != 0 {
+				grown = h.curArena.base - lastBase
+			}
+			want := uint64(grown) * (heapPregrowLookahead / heapPregrowPeriod)
+			for uint64(h.curArena.end-h.curArena.base) < want && budget >= heapArenaBytes {
+				if _, ok := h.extendCurArena(heapArenaBytes); !ok {
+					break
+				}
+				budget -= heapArenaBytes
+				atomic.Xadd64(&heapPregrow.pregrown, heapArenaBytes)
+			}
+			lastBase = h.curArena.base
+			unlock(&h.lock)
+		})
+	}
+}
+
 // Free the span back into the heap.
 func (h *mheap) freeSpan(s *mspan) {
 	systemstack(func() {
@@ -1547,11 +1932,34 @@ func (h *mheap) freeSpan(s *mspan) {
 			bytes := s.npages << _PageShift
 			msanfree(base, bytes)
 		}
+		spc, npages := s.spanclass, s.npages
 		h.freeSpanLocked(s, spanAllocHeap)
 		unlock(&h.lock)
+		if fn := spanFreeObserver; fn != nil {
+			fn(uint8(spc), npages)
+		}
 	})
 }
 
+// spanFreeObserver, if non-nil, is called by freeSpan each time a heap
+// span is freed back to the page allocator.
+var spanFreeObserver func(spanClass uint8, npages uintptr)
+
+// SetSpanFreeObserver arranges for fn to be called each time a span of
+// heap memory is freed back to the page heap, reporting the span's
+// class and its size in pages. A span class encodes the object size
+// class in its upper bits and whether the objects contain no pointers
+// in its lowest bit; large objects have size class 0. Spans of stack
+// and other manually-managed memory are not reported.
+//
+// fn is called on the system stack just after the heap lock is
+// released, usually by the sweeper. It must not allocate, block or
+// otherwise call into the runtime, and should do as little as
+// possible. Passing nil removes the observer.
+func SetSpanFreeObserver(fn func(spanClass uint8, npages uintptr)) {
+	spanFreeObserver = fn
+}
+
 // freeManual frees a manually-managed span returned by allocManual.
 // typ must be the same as the spanAllocType passed to the allocManual that
 // allocated s.
@@ -1602,6 +2010,7 @@ func (h *mheap) freeSpanLocked(s *mspan, typ spanAllocType) {
 	if typ.manual() {
 		// Manually managed memory doesn't count toward heap_sys, so add it back.
 		memstats.heap_sys.add(int64(nbytes))
+		atomic.Xadd64(&manualInUse, -int64(nbytes))
 	}
 	// Update consistent stats.
 	stats := memstats.heapStats.acquire()
@@ -1614,14 +2023,21 @@ func (h *mheap) freeSpanLocked(s *mspan, typ spanAllocType) {
 		atomic.Xaddint64(&stats.inPtrScalarBits, -int64(nbytes))
 	case spanAllocWorkBuf:
 		atomic.Xaddint64(&stats.inWorkBufs, -int64(nbytes))
+	case spanAllocUserArena:
+		atomic.Xaddint64(&stats.inUserArenas, -int64(nbytes))
 	}
 	memstats.heapStats.release()
 
-	// Mark the space as free.
-	h.pages.free(s.base(), s.npages)
+	// Mark the space as free, unless it's a large object span the P
+	// can keep for reuse.
+	if pp := getg().m.p.ptr(); typ != spanAllocHeap || s.spanclass.sizeclass() != 0 ||
+		pp == nil || !pp.lcache.put(s.base(), s.npages) {
+		h.pages.free(s.base(), s.npages)
+	}
 
 	// Free the span structure. We no longer have a use for it.
 	s.state.set(mSpanDead)
+	h.freeSpanAllocTrace(s)
 	h.freeMSpanLocked(s)
 }
 
@@ -1634,6 +2050,8 @@ func (h *mheap) scavengeAll() {
 	// the mheap API.
 	gp := getg()
 	gp.m.mallocing++
+	// Pages in the P's large page caches can't be scavenged.
+	flushLargePageCaches(true)
 	lock(&h.lock)
 	// Start a new scavenge generation so we have a chance to walk
 	// over the whole heap.
@@ -1654,6 +2072,39 @@ func runtime_debug_freeOSMemory() {
 	systemstack(func() { mheap_.scavengeAll() })
 }
 
+// ScavengeBytes returns approximately n bytes of free heap memory to
+// the operating system and reports how many bytes were actually
+// released. Unlike debug.FreeOSMemory it does not run a garbage
+// collection, so only memory that is already free is affected; it is
+// intended for releasing memory after a transient spike in usage.
+func ScavengeBytes(n uintptr) uintptr {
+	var released uintptr
+	systemstack(func() { released = mheap_.scavengeBytes(n) })
+	return released
+}
+
+// scavengeBytes is like scavengeAll, but stops after releasing
+// nbytes worth of free pages.
+func (h *mheap) scavengeBytes(nbytes uintptr) uintptr {
+	gp := getg()
+	gp.m.mallocing++
+	// Pages in the P's large page caches can't be scavenged.
+	flushLargePageCaches(true)
+	lock(&h.lock)
+	// Start a new generation so pages the background scavenger
+	// has already walked past are eligible too.
+	h.pages.scavengeStartGen()
+	released := h.pages.scavenge(nbytes, false)
+	gen := h.pages.scav.gen
+	unlock(&h.lock)
+	gp.m.mallocing--
+
+	if debug.scavtrace > 0 {
+		printScavTrace(gen, released, true)
+	}
+	return released
+}
+
 // Initialize a new span with the given start and npages.
 func (span *mspan) init(base uintptr, npages uintptr) {
 	// span is *not* zeroed.
@@ -1667,7 +2118,11 @@ func (span *mspan) init(base uintptr, npages uintptr) {
 	span.elemsize = 0
 	span.speciallock.key = 0
 	span.specials = nil
+	span.allocTrace = nil
 	span.needzero = 0
+	span.poisoned = 0
+	span.young = 0
+	span.userArena = 0
 	span.freeindex = 0
 	span.allocBits = nil
 	span.gcmarkBits = nil
@@ -1940,6 +2395,7 @@ func addfinalizer(p unsafe.Pointer, f *funcval, nret uintptr, fint *_type, ot *p
 			scanblock(uintptr(unsafe.Pointer(&s.fn)), sys.PtrSize, &oneptrmask[0], gcw, nil)
 			releasem(mp)
 		}
+		atomic.Xadd64(&finregistered, +1)
 		return true
 	}
 
@@ -1956,6 +2412,7 @@ func removefinalizer(p unsafe.Pointer) {
 	if s == nil {
 		return // there wasn't a finalizer to remove
 	}
+	atomic.Xadd64(&finregistered, -1)
 	lock(&mheap_.speciallock)
 	mheap_.specialfinalizeralloc.free(unsafe.Pointer(s))
 	unlock(&mheap_.speciallock)
@@ -1990,6 +2447,7 @@ func freespecial(s *special, p unsafe.Pointer, size uintptr) {
 	case _KindSpecialFinalizer:
 		sf := (*specialfinalizer)(unsafe.Pointer(s))
 		queuefinalizer(p, sf.fn, sf.nret, sf.fint, sf.ot)
+		atomic.Xadd64(&finregistered, -1)
 		lock(&mheap_.speciallock)
 		mheap_.specialfinalizeralloc.free(unsafe.Pointer(sf))
 		unlock(&mheap_.speciallock)
@@ -2189,3 +2647,158 @@ func newArenaMayUnlock() *gcBitsArena {
 	}
 	return result
 }
+
+// heapLayoutWords is the number of words readHeapLayout reports for
+// each arena.
+const heapLayoutWords = 6
+
+// readHeapLayout sets *layout to heapLayoutWords words for each heap
+// arena, in the order the arenas were mapped: the arena's start and end
+// addresses, how much of it has been added to the heap, how much of it
+// from the start has ever been allocated, the bytes in pages in use,
+// and the bytes in its largest run of free pages.
+//go:linkname readHeapLayout runtime/debug.readHeapLayout
+func readHeapLayout(layout *[]uintptr) {
+	var n int
+	systemstack(func() {
+		lock(&mheap_.lock)
+		n = len(mheap_.allArenas)
+		unlock(&mheap_.lock)
+	})
+	// Arenas mapped while the slice is allocated are left out.
+	p := make([]uintptr, n*heapLayoutWords)
+	systemstack(func() {
+		readHeapLayout_m(p)
+	})
+	*layout = p
+}
+
+// readHeapLayout_m must be called on the system stack because it
+// acquires the heap lock. See mheap for details.
+//go:systemstack
+func readHeapLayout_m(p []uintptr) {
+	lock(&mheap_.lock)
+	for i, ai := range mheap_.allArenas[:len(p)/heapLayoutWords] {
+		base := arenaBase(ai)
+		limit := base + heapArenaBytes
+
+		// Only the chunks of the arena in the page allocator
+		// are part of the heap. The rest hasn't been grown
+		// into yet or, with heapReserveMB, may not be ours.
+		var heap, inUse, largest, run uintptr
+		for a := base; a < limit; a += pallocChunkBytes {
+			chunk := mheap_.pages.tryChunkOf(chunkIndex(a))
+			if chunk == nil || !mheap_.pages.inUse.contains(a) {
+				run = 0
+				continue
+			}
+			heap += pallocChunkBytes
+			inUse += uintptr((*pageBits)(&chunk.pallocBits).popcntRange(0, pallocChunkPages))
+			start, max, end := chunk.summarize().unpack()
+			if run+uintptr(start) > largest {
+				largest = run + uintptr(start)
+			}
+			if uintptr(max) > largest {
+				largest = uintptr(max)
+			}
+			if start == pallocChunkPages {
+				run += pallocChunkPages
+			} else {
+				run = uintptr(end)
+			}
+		}
+
+		ha := mheap_.arenas[ai.l1()][ai.l2()]
+		w := p[i*heapLayoutWords : (i+1)*heapLayoutWords]
+		w[0] = base
+		w[1] = limit
+		w[2] = heap
+		w[3] = atomic.Loaduintptr(&ha.zeroedBase)
+		w[4] = inUse * pageSize
+		w[5] = largest * pageSize
+	}
+	unlock(&mheap_.lock)
+}
+
+// numaHeap is the state of GODEBUG=numaheap. The heap grows in memory
+// bound to the NUMA node of the P that grows it, and the page
+// allocator keeps the chunks of each node apart (see mpagenuma.go). A
+// P with a known node allocates spans, and refills its page cache,
+// only from its node's chunks, growing the heap on its node when they
+// have no room, and only takes pages from other nodes if the heap
+// can't grow. The mcentrals hand a P swept spans on its node first.
+// Spans larger than a chunk, spans allocated without a P, and large
+// object pages reused from a P's lcache may be on any node.
+var numaHeap struct {
+	enabled bool // set by schedinit and not changed after
+}
+
+// allocToCacheNUMA returns a new page cache for pp. Under
+// GODEBUG=numaheap, it takes the pages from a chunk bound to pp's NUMA
+// node, growing the heap if the node has none free.
+//
+// h.lock must be held.
+//
+// Must run on the system stack because h.lock must be held.
+//
+//go:systemstack
+func (h *mheap) allocToCacheNUMA(pp *p) pageCache {
+	assertLockHeld(&h.lock)
+
+	var c pageCache
+	if node := pp.numaNode; numaHeap.enabled && node >= 0 && node < maxPageNodes {
+		c = h.pages.allocToCacheNode(node)
+		if c.empty() && h.grow(1) {
+			c = h.pages.allocToCacheNode(node)
+		}
+	}
+	if c.empty() {
+		c = h.pages.allocToCache()
+	}
+	return c
+}
+
+// allocNUMA allocates npages pages from a chunk bound to pp's NUMA
+// node, growing the heap if the node has no room. It returns 0, 0 if
+// pp's node isn't known, npages is more than a chunk, or the heap
+// can't grow.
+//
+// h.lock must be held.
+//
+// Must run on the system stack because h.lock must be held.
+//
+//go:systemstack
+func (h *mheap) allocNUMA(pp *p, npages uintptr) (base, scav uintptr) {
+	assertLockHeld(&h.lock)
+
+	node := pp.numaNode
+	if node < 0 || node >= maxPageNodes || npages > pallocChunkPages {
+		return 0, 0
+	}
+	base, scav = h.pages.allocNode(node, npages)
+	if base == 0 && h.grow(npages) {
+		base, scav = h.pages.allocNode(node, npages)
+	}
+	return base, scav
+}
+
+// bindNUMA binds the chunks in [base, base+size), which the heap just
+// grew into, to the NUMA node of the current P, if it knows it.
+//
+// h.lock must be held.
+func (h *mheap) bindNUMA(base, size uintptr) {
+	assertLockHeld(&h.lock)
+
+	pp := getg().m.p.ptr()
+	if pp == nil || pp.numaNode < 0 || pp.numaNode >= maxPageNodes {
+		return
+	}
+	sysNUMABind(unsafe.Pointer(base), size, pp.numaNode)
+	h.pages.bindNode(base, size, pp.numaNode)
+}
+
+// spanNUMANode returns the NUMA node GODEBUG=numaheap bound the pages
+// of s to, or -1.
+func spanNUMANode(s *mspan) int32 {
+	return mheap_.pages.chunkNode(chunkIndex(s.base()))
+}
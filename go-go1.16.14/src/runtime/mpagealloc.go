@@ -218,14 +218,14 @@ type pageAlloc struct {
 	//
 	// heapAddrBits | L1 Bits | L2 Bits | L2 Entry Size
 	// ------------------------------------------------
-	// 32           | 0       | 10      | 128 KiB
-	// 33 (iOS)     | 0       | 11      | 256 KiB
-	// 48           | 13      | 13      | 1 MiB
+	// 32           | 0       | 10      | 136 KiB
+	// 33 (iOS)     | 0       | 11      | 272 KiB
+	// 48           | 13      | 13      | 1088 KiB
 	//
 	// There's no reason to use the L1 part of chunks on 32-bit, the
 	// address space is small so the L2 is small. For platforms with a
-	// 48-bit address space, we pick the L1 such that the L2 is 1 MiB
-	// in size, which is a good balance between low granularity without
+	// 48-bit address space, we pick the L1 such that the L2 is about
+	// 1 MiB in size, which is a good balance between low granularity without
 	// making the impact on BSS too high (note the L1 is stored directly
 	// in pageAlloc).
 	//
@@ -294,6 +294,10 @@ type pageAlloc struct {
 		freeHWM offAddr
 	}
 
+	// nodes partitions the chunks among NUMA nodes under
+	// GODEBUG=numaheap. Protected by mheapLock.
+	nodes pageNodes
+
 	// mheap_.lock. This level of indirection makes it possible
 	// to test pageAlloc indepedently of the runtime allocator.
 	mheapLock *mutex
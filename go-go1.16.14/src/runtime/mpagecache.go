@@ -5,6 +5,7 @@
 package runtime
 
 import (
+	"runtime/internal/atomic"
 	"runtime/internal/sys"
 	"unsafe"
 )
@@ -181,3 +182,116 @@ func (p *pageAlloc) allocToCache() pageCache {
 	p.searchAddr = offAddr{c.base + pageSize*(pageCachePages-1)}
 	return c
 }
+
+const (
+	// largePageCacheEntries is the number of freed large object
+	// spans a P keeps for reuse.
+	largePageCacheEntries = 4
+
+	// largePageCacheMaxPages is the size in pages of the largest
+	// span a P keeps, which bounds how much memory the cache holds.
+	largePageCacheMaxPages = 128
+
+	// largePageCacheStale marks an entry that has been in the
+	// cache since the last flush. It and the page count are packed
+	// into the low bits of the page-aligned base address.
+	largePageCacheStale  = 1 << 12
+	largePageCacheNPages = largePageCacheStale - 1
+
+	// largePageCacheFlushPeriod is how often in nanoseconds sysmon
+	// flushes stale entries, so an entry is held between one and
+	// two periods.
+	largePageCacheFlushPeriod = 100 * 1000 * 1000
+)
+
+// largePageCache is a per-P cache of the pages of recently freed
+// large object spans. allocSpan reuses them for large objects of the
+// same page count without acquiring the heap lock. The pages stay
+// allocated in the page allocator while they're cached, so the
+// scavenger can't release them; sysmon flushes entries that go
+// unused.
+//
+// Entries are accessed atomically. Only the owning P adds entries,
+// but any thread may remove them.
+type largePageCache struct {
+	entries [largePageCacheEntries]uintptr
+}
+
+// put adds npages pages at base to the cache. It returns false if the
+// span is too large or the cache is full, in which case the caller
+// must free the pages.
+//
+// Must be called by the P that owns c.
+func (c *largePageCache) put(base, npages uintptr) bool {
+	if npages > largePageCacheMaxPages {
+		return false
+	}
+	for i := range c.entries {
+		if atomic.Casuintptr(&c.entries[i], 0, base|npages) {
+			return true
+		}
+	}
+	return false
+}
+
+// take removes an entry of exactly npages pages from the cache and
+// returns its base address, or 0 if there is none.
+//
+// Must be called by the P that owns c.
+func (c *largePageCache) take(npages uintptr) uintptr {
+	if npages > largePageCacheMaxPages {
+		return 0
+	}
+	for i := range c.entries {
+		e := atomic.Loaduintptr(&c.entries[i])
+		if e != 0 && e&largePageCacheNPages == npages && atomic.Casuintptr(&c.entries[i], e, 0) {
+			return e &^ (pageSize - 1)
+		}
+	}
+	return 0
+}
+
+// flush frees the pages of c's entries to h's page allocator. If all
+// is false, only stale entries are freed and the rest are marked
+// stale.
+//
+// h.lock must not be held. Must run on the system stack because it
+// acquires h.lock.
+//
+//go:systemstack
+func (c *largePageCache) flush(h *mheap, all bool) {
+	for i := range c.entries {
+		for {
+			e := atomic.Loaduintptr(&c.entries[i])
+			if e == 0 {
+				break
+			}
+			if !all && e&largePageCacheStale == 0 {
+				if atomic.Casuintptr(&c.entries[i], e, e|largePageCacheStale) {
+					break
+				}
+				continue
+			}
+			if atomic.Casuintptr(&c.entries[i], e, 0) {
+				lock(&h.lock)
+				h.pages.free(e&^(pageSize-1), e&largePageCacheNPages)
+				unlock(&h.lock)
+				break
+			}
+		}
+	}
+}
+
+// flushLargePageCaches flushes the large page cache of every P. See
+// largePageCache.flush.
+//
+// Must run on the system stack.
+//
+//go:systemstack
+func flushLargePageCaches(all bool) {
+	lock(&allpLock)
+	for _, pp := range allp {
+		pp.lcache.flush(&mheap_, all)
+	}
+	unlock(&allpLock)
+}
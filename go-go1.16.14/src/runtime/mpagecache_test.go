@@ -400,3 +400,60 @@ func TestPageAllocAllocToCache(t *testing.T) {
 		})
 	}
 }
+
+func TestPageAllocNodes(t *testing.T) {
+	if GOOS == "openbsd" && testing.Short() {
+		t.Skip("skipping because virtual memory is limited; see #36210")
+	}
+	b := NewPageAlloc(map[ChunkIdx][]BitRange{
+		BaseChunkIdx:     {{0, 64}},
+		BaseChunkIdx + 1: {},
+		BaseChunkIdx + 2: {},
+		BaseChunkIdx + 3: {{0, PallocChunkPages}},
+	}, nil)
+	defer FreePageAlloc(b)
+
+	chunkBytes := uintptr(PallocChunkPages * PageSize)
+	b.BindNode(PageBase(BaseChunkIdx+1, 0), chunkBytes, 1)
+	b.BindNode(PageBase(BaseChunkIdx, 0), chunkBytes, 0)
+	// Chunks keep the node they were first bound to.
+	b.BindNode(PageBase(BaseChunkIdx+1, 0), 3*chunkBytes, 0)
+	b.BindNode(PageBase(BaseChunkIdx+3, 0), chunkBytes, 1)
+
+	// Page caches only come from the node's chunks.
+	checkPageCache(t, b.AllocToCacheNode(1), NewPageCache(PageBase(BaseChunkIdx+1, 0), ^uint64(0), 0))
+	checkPageCache(t, b.AllocToCacheNode(0), NewPageCache(PageBase(BaseChunkIdx, 64), ^uint64(0), 0))
+	checkPageCache(t, b.AllocToCacheNode(2), NewPageCache(0, 0, 0))
+
+	type hit struct {
+		node   int32
+		npages uintptr
+		base   uintptr
+	}
+	for i, h := range []hit{
+		// Node 1 has no run this long, though node 0 has.
+		{1, PallocChunkPages, 0},
+		{1, PallocChunkPages - 64, PageBase(BaseChunkIdx+1, 64)},
+		// Searches go down the node's list of chunks, which
+		// are in the order they were bound in.
+		{0, PallocChunkPages - 64, PageBase(BaseChunkIdx+2, 0)},
+		// They start where the last search on the node ended,
+		// and wrap around.
+		{0, 64, PageBase(BaseChunkIdx+2, PallocChunkPages-64)},
+		{0, 65, PageBase(BaseChunkIdx, 128)},
+		{2, 1, 0},
+	} {
+		if base, _ := b.AllocNode(h.node, h.npages); base != h.base {
+			t.Errorf("allocation %d: got base %#x, want %#x", i, base, h.base)
+		}
+	}
+
+	want := NewPageAlloc(map[ChunkIdx][]BitRange{
+		BaseChunkIdx:     {{0, 193}},
+		BaseChunkIdx + 1: {{0, PallocChunkPages}},
+		BaseChunkIdx + 2: {{0, PallocChunkPages}},
+		BaseChunkIdx + 3: {{0, PallocChunkPages}},
+	}, nil)
+	defer FreePageAlloc(want)
+	checkPageAlloc(t, want, b)
+}
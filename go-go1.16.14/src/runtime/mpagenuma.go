@@ -0,0 +1,157 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// NUMA node partitions of the page allocator.
+//
+// Under GODEBUG=numaheap, each chunk the heap grows by is bound to the
+// NUMA node of the P that grew it (see mheap.bindNUMA), and the page
+// allocator keeps, for each node, the list of the chunks bound to it,
+// in the order they were bound. allocNode and allocToCacheNode only
+// take pages from the chunks of one node, so that the chunks of the
+// heap are partitioned among the nodes. They search a node's list next
+// fit, starting at the chunk where the last search for the node ended,
+// so that they don't look at the full chunks at the start of the list
+// again and again. Other allocations, and all frees, work on the whole
+// heap as before.
+
+package runtime
+
+// maxPageNodes is the most NUMA nodes the page allocator keeps
+// partitions for.
+const maxPageNodes = 64
+
+// pageNodes holds the partitions of the chunks of a pageAlloc among
+// NUMA nodes.
+type pageNodes struct {
+	// head and tail are the first and last chunks bound to each
+	// node, and cursor is the chunk where the next search for free
+	// pages on the node starts, all plus one, or 0 if the node has
+	// no chunks. The chunks of a node are linked through their
+	// pallocData.nodeNext.
+	head, tail, cursor [maxPageNodes]chunkIdx
+}
+
+// bindNode binds the chunks that overlap [base, base+size) to node,
+// which must be in [0, maxPageNodes). Chunks that are already bound to
+// a node are left alone.
+//
+// p.mheapLock must be held.
+func (p *pageAlloc) bindNode(base, size uintptr, node int32) {
+	assertLockHeld(p.mheapLock)
+
+	n := &p.nodes
+	for ci := chunkIndex(base); ci <= chunkIndex(base+size-1); ci++ {
+		chunk := p.chunkOf(ci)
+		if chunk.node != 0 {
+			continue
+		}
+		chunk.node = uint8(node + 1)
+		if t := n.tail[node]; t != 0 {
+			p.chunkOf(t - 1).nodeNext = uint32(ci + 1)
+		} else {
+			n.head[node] = ci + 1
+			n.cursor[node] = ci + 1
+		}
+		n.tail[node] = ci + 1
+	}
+}
+
+// chunkNode returns the NUMA node chunk ci is bound to, or -1.
+func (p *pageAlloc) chunkNode(ci chunkIdx) int32 {
+	return int32(p.chunkOf(ci).node) - 1
+}
+
+// findNode returns the first chunk bound to node, searching its list
+// from the cursor and wrapping around at the end, that has a run of at
+// least npages free pages, and moves the cursor there. It returns
+// false if there is no such chunk.
+//
+// p.mheapLock must be held.
+func (p *pageAlloc) findNode(node int32, npages uintptr) (chunkIdx, bool) {
+	assertLockHeld(p.mheapLock)
+
+	n := &p.nodes
+	start := n.cursor[node]
+	if start == 0 {
+		return 0, false
+	}
+	summary := p.summary[len(p.summary)-1]
+	for ci := start; ; {
+		if summary[ci-1].max() >= uint(npages) {
+			n.cursor[node] = ci
+			return ci - 1, true
+		}
+		ci = chunkIdx(p.chunkOf(ci - 1).nodeNext)
+		if ci == 0 {
+			ci = n.head[node]
+		}
+		if ci == start {
+			return 0, false
+		}
+	}
+}
+
+// allocNode allocates npages pages, which must be at most a chunk,
+// from a chunk bound to node. It returns the address of the pages and
+// how many of their bytes were scavenged, like alloc, or 0, 0 if no
+// chunk of the node has a run of npages free pages.
+//
+// p.mheapLock must be held.
+//
+// Must run on the system stack because p.mheapLock must be held.
+//
+//go:systemstack
+func (p *pageAlloc) allocNode(node int32, npages uintptr) (addr uintptr, scav uintptr) {
+	assertLockHeld(p.mheapLock)
+
+	if npages > pallocChunkPages {
+		return 0, 0
+	}
+	ci, ok := p.findNode(node, npages)
+	if !ok {
+		return 0, 0
+	}
+	j, _ := p.chunkOf(ci).find(npages, 0)
+	if j == ^uint(0) {
+		throw("bad summary data")
+	}
+	addr = chunkBase(ci) + uintptr(j)*pageSize
+	// The pages may be above searchAddr, which remains a lower bound
+	// on the free pages.
+	scav = p.allocRange(addr, npages)
+	return addr, scav
+}
+
+// allocToCacheNode is like allocToCache, but only takes pages from a
+// chunk bound to node. It returns an empty pageCache if no chunk of
+// the node has free pages.
+//
+// p.mheapLock must be held.
+//
+// Must run on the system stack because p.mheapLock must be held.
+//
+//go:systemstack
+func (p *pageAlloc) allocToCacheNode(node int32) pageCache {
+	assertLockHeld(p.mheapLock)
+
+	ci, ok := p.findNode(node, 1)
+	if !ok {
+		return pageCache{}
+	}
+	chunk := p.chunkOf(ci)
+	j, _ := chunk.find(1, 0)
+	if j == ^uint(0) {
+		throw("bad summary data")
+	}
+	c := pageCache{
+		base:  chunkBase(ci) + alignDown(uintptr(j), 64)*pageSize,
+		cache: ^chunk.pages64(j),
+		scav:  chunk.scavenged.block64(j),
+	}
+	// Allocate the block as allocToCache does, leaving searchAddr
+	// alone as allocNode does.
+	p.allocRange(c.base, pageCachePages)
+	p.update(c.base, pageCachePages, false, true)
+	return c
+}
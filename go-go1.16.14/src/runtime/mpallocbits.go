@@ -410,6 +410,12 @@ func findBitRange64(c uint64, n uint) uint {
 type pallocData struct {
 	pallocBits
 	scavenged pageBits
+
+	// node is the NUMA node plus one that GODEBUG=numaheap bound
+	// the chunk to, or 0, and nodeNext is the next chunk plus one
+	// bound to the same node, or 0. See mpagenuma.go.
+	node     uint8
+	nodeNext uint32
 }
 
 // allocRange sets bits [i, i+n) in the bitmap to 1 and
@@ -29,6 +29,10 @@ const (
 
 	// max depth of stack to record in bucket
 	maxStack = 32
+
+	// max depth of stack to record in memProfile buckets,
+	// see SetHeapProfileStackDepth
+	maxHeapProfStack = 128
 )
 
 type bucketType int
@@ -179,7 +183,7 @@ func newBucket(typ bucketType, nstk int) *bucket {
 
 // stk returns the slice in b holding the stack.
 func (b *bucket) stk() []uintptr {
-	stk := (*[maxStack]uintptr)(add(unsafe.Pointer(b), unsafe.Sizeof(*b)))
+	stk := (*[maxHeapProfStack]uintptr)(add(unsafe.Pointer(b), unsafe.Sizeof(*b)))
 	return stk[:b.nstk:b.nstk]
 }
 
@@ -338,8 +342,8 @@ func mProf_PostSweep() {
 
 // Called by malloc to record a profiled block.
 func mProf_Malloc(p unsafe.Pointer, size uintptr) {
-	var stk [maxStack]uintptr
-	nstk := callers(4, stk[:])
+	var stk [maxHeapProfStack]uintptr
+	nstk := callers(4, stk[:atomic.Load(&heapProfStackDepth)])
 	lock(&proflock)
 	b := stkbucket(memProfile, size, stk[:nstk], true)
 	c := mProf.cycle
@@ -498,6 +502,32 @@ func (r *StackRecord) Stack() []uintptr {
 // at the beginning of main).
 var MemProfileRate int = 512 * 1024
 
+// heapProfStackDepth is the number of frames mProf_Malloc records.
+// Accessed atomically.
+var heapProfStackDepth uint32 = maxStack
+
+// SetHeapProfileStackDepth sets the maximum number of stack frames
+// recorded for each sampled allocation in the memory profile. The
+// default is 32, which can truncate the stacks of deeply nested
+// allocation sites, attributing their allocations only to the
+// innermost frames. A greater depth gives better attribution at the
+// cost of more work per sampled allocation and more memory for the
+// profile. n is clamped to [1, 128]; n <= 0 restores the default.
+//
+// The depth applies to allocations sampled after the call. Allocation
+// sites already in the profile keep the stacks they were recorded
+// with. Records of the memory profile hold at most 32 frames of each
+// stack; use MemProfileStacks to get deeper stacks in full.
+func SetHeapProfileStackDepth(n int) {
+	switch {
+	case n <= 0:
+		n = maxStack
+	case n > maxHeapProfStack:
+		n = maxHeapProfStack
+	}
+	atomic.Store(&heapProfStackDepth, uint32(n))
+}
+
 // A MemProfileRecord describes the live objects allocated
 // by a particular call sequence (stack trace).
 type MemProfileRecord struct {
@@ -547,6 +577,33 @@ func (r *MemProfileRecord) Stack() []uintptr {
 // the testing package's -test.memprofile flag instead
 // of calling MemProfile directly.
 func MemProfile(p []MemProfileRecord, inuseZero bool) (n int, ok bool) {
+	return memProfileBuckets(p, nil, inuseZero)
+}
+
+// MemProfileStacks is like MemProfile, but when it copies the profile
+// into p, it also sets stks[i] to the whole stack trace of p[i]. That is
+// p[i].Stack(), unless the stack is deeper than p[i].Stack0, as it may
+// be after a call to SetHeapProfileStackDepth. stks must be at least as
+// long as p; MemProfileStacks reuses the slices it holds when they have
+// enough capacity.
+func MemProfileStacks(p []MemProfileRecord, stks [][]uintptr, inuseZero bool) (n int, ok bool) {
+	stks = stks[:len(p)]
+	// Collect the buckets while holding proflock, and copy their
+	// stacks, which never change, only after releasing it, as
+	// allocating may need proflock.
+	bs := make([]*bucket, len(p))
+	n, ok = memProfileBuckets(p, bs, inuseZero)
+	if ok {
+		for i, b := range bs[:n] {
+			stks[i] = append(stks[i][:0], b.stk()...)
+		}
+	}
+	return
+}
+
+// memProfileBuckets implements MemProfile. If bs is not nil, it also stores
+// in bs[i] the bucket p[i] was copied from.
+func memProfileBuckets(p []MemProfileRecord, bs []*bucket, inuseZero bool) (n int, ok bool) {
 	lock(&proflock)
 	// If we're between mProf_NextCycle and mProf_Flush, take care
 	// of flushing to the active profile so we only have to look
@@ -586,6 +643,9 @@ func MemProfile(p []MemProfileRecord, inuseZero bool) (n int, ok bool) {
 			mp := b.mp()
 			if inuseZero || mp.active.alloc_bytes != mp.active.free_bytes {
 				record(&p[idx], b)
+				if bs != nil {
+					bs[idx] = b
+				}
 				idx++
 			}
 		}
@@ -840,6 +900,104 @@ func Stack(buf []byte, all bool) int {
 	return n
 }
 
+// GInfo describes a goroutine, as reported by ForEachGoroutine.
+type GInfo struct {
+	ID         int64      // goroutine ID, as printed in tracebacks
+	Status     string     // such as "running", "runnable", "syscall" or "waiting"
+	WaitReason WaitReason // why the goroutine is waiting, if it is
+	StartPC    uintptr    // entry PC of the function the goroutine was started with
+	CreatedBy  uintptr    // return PC of the go statement that started the goroutine
+
+	// Stack holds the return PCs of the goroutine's stack, innermost
+	// first, as Callers would return them, up to 64 frames. It is nil
+	// if the goroutine was running, since the stack of a running
+	// goroutine can't be read. Its array is reused for the next
+	// goroutine once the callback returns.
+	Stack []uintptr
+}
+
+// ForEachGoroutine calls fn for each goroutine, other than the calling
+// goroutine and those internal to the runtime, until fn returns false.
+//
+// Unlike Stack with all set and the goroutine profile, ForEachGoroutine
+// does not stop the world. It keeps each goroutine from running only
+// while it reads that goroutine's state and stack, so it can dump
+// programs with very many goroutines, incrementally, without stalling
+// them. The price is that the goroutines are not seen at the same
+// moment: they may change state while ForEachGoroutine runs, and
+// goroutines started during the call may be missed.
+func ForEachGoroutine(fn func(GInfo) bool) {
+	s := new(gInfoState)
+	ptr, n := atomicAllG()
+	for i := uintptr(0); i < n; i++ {
+		s.gp = atomicAllGIndex(ptr, i)
+		systemstack(func() {
+			readGInfo(s)
+		})
+		if s.ok && !fn(s.info) {
+			return
+		}
+	}
+}
+
+// gInfoState passes a goroutine to readGInfo and its GInfo back.
+type gInfoState struct {
+	gp    *g
+	ok    bool // info describes gp
+	info  GInfo
+	stack [64]uintptr
+}
+
+// readGInfo fills in s.info for s.gp and sets s.ok, unless s.gp is the
+// calling goroutine, is dead or is a system goroutine.
+//
+// To read the stack, readGInfo claims the goroutine by setting its scan
+// bit, as suspendG does. Unlike suspendG, it does not wait for a
+// running goroutine to stop, which could deadlock with a goroutine
+// that is stopping the world, but leaves out its stack.
+//
+//go:systemstack
+func readGInfo(s *gInfoState) {
+	gp := s.gp
+	s.ok = false
+	s.info = GInfo{}
+	status := readgstatus(gp) &^ _Gscan
+	if gp == getg().m.curg || status == _Gidle || status == _Gdead || isSystemGoroutine(gp, false) {
+		return
+	}
+	claimed := false
+	for {
+		switch status {
+		case _Grunnable, _Gsyscall, _Gwaiting:
+			if !castogscanstatus(gp, status, status|_Gscan) {
+				// gp changed status. Look again.
+				status = readgstatus(gp) &^ _Gscan
+				continue
+			}
+			claimed = true
+			n := gentraceback(^uintptr(0), ^uintptr(0), 0, gp, 0, &s.stack[0], len(s.stack), nil, nil, 0)
+			s.info.Stack = s.stack[:n]
+		case _Gdead:
+			return
+		}
+		break
+	}
+	s.info.ID = gp.goid
+	s.info.Status = "???"
+	if status < uint32(len(gStatusStrings)) {
+		s.info.Status = gStatusStrings[status]
+	}
+	if status == _Gwaiting {
+		s.info.WaitReason = WaitReason(gp.waitreason)
+	}
+	s.info.StartPC = gp.startpc
+	s.info.CreatedBy = gp.gopc
+	if claimed {
+		casfrom_Gscanstatus(gp, status|_Gscan, status)
+	}
+	s.ok = true
+}
+
 // Tracing of alloc/free/gc.
 
 var tracelock mutex
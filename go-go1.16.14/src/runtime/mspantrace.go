@@ -0,0 +1,143 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Span allocation tracing.
+//
+// With GODEBUG=spantrace=N, each heap span keeps a ring of the last N
+// allocations into it, recording the allocating goroutine and the
+// first caller outside the runtime. When the runtime detects heap
+// corruption in a span, it prints the ring, which often points at the
+// goroutine that last used memory another goroutine then corrupted.
+
+package runtime
+
+import "unsafe"
+
+// maxSpanAllocTrace is the most allocations a span's trace records.
+const maxSpanAllocTrace = 16
+
+// spanAllocTrace is a ring of the most recent allocations into a span.
+// It is allocated from mheap_.spanTraceAlloc, under the heap lock.
+//
+//go:notinheap
+type spanAllocTrace struct {
+	n    uint32 // number of allocations ever recorded
+	size uint32 // number of records kept, at most maxSpanAllocTrace
+	recs [maxSpanAllocTrace]spanAllocRecord
+}
+
+type spanAllocRecord struct {
+	goid int64
+	pc   uintptr
+}
+
+// newSpanAllocTrace returns a trace for a newly allocated heap span, or
+// nil if span tracing is off.
+func (h *mheap) newSpanAllocTrace() *spanAllocTrace {
+	size := debug.spantrace
+	if size <= 0 {
+		return nil
+	}
+	if size > maxSpanAllocTrace {
+		size = maxSpanAllocTrace
+	}
+	lock(&h.lock)
+	t := (*spanAllocTrace)(h.spanTraceAlloc.alloc())
+	unlock(&h.lock)
+	t.size = uint32(size)
+	return t
+}
+
+// freeSpanAllocTrace frees s's trace, if it has one.
+//
+// h.lock must be held.
+func (h *mheap) freeSpanAllocTrace(s *mspan) {
+	assertLockHeld(&h.lock)
+
+	if s.allocTrace != nil {
+		h.spanTraceAlloc.free(unsafe.Pointer(s.allocTrace))
+		s.allocTrace = nil
+	}
+}
+
+// record adds an allocation by the current goroutine to t.
+//
+// The caller must own the span, as mallocgc does.
+func (t *spanAllocTrace) record() {
+	gp := getg().m.curg
+	if gp == nil {
+		gp = getg()
+	}
+	r := &t.recs[t.n%t.size]
+	r.goid = gp.goid
+	r.pc = allocCallerPC()
+	t.n++
+}
+
+// allocCallerPC returns the return PC of the first caller of mallocgc
+// outside the runtime, or of mallocgc's caller if there is none.
+func allocCallerPC() uintptr {
+	var pcs [8]uintptr
+	// Skip callers, allocCallerPC, spanAllocTrace.record and mallocgc.
+	n := callers(4, pcs[:])
+	for _, pc := range pcs[:n] {
+		if f := findfunc(pc); f.valid() && !hasPrefix(funcname(f), "runtime.") {
+			return pc
+		}
+	}
+	if n > 0 {
+		return pcs[0]
+	}
+	return 0
+}
+
+// copy copies the records in t into goids and pcs, oldest first, and
+// returns the number copied.
+func (t *spanAllocTrace) copy(goids []int64, pcs []uintptr) int {
+	first, n := uint32(0), t.n
+	if n > t.size {
+		first, n = t.n-t.size, t.size
+	}
+	i := 0
+	for ; i < int(n) && i < len(goids) && i < len(pcs); i++ {
+		r := &t.recs[(first+uint32(i))%t.size]
+		goids[i], pcs[i] = r.goid, r.pc
+	}
+	return i
+}
+
+// printSpanAllocTrace prints the allocations recorded for s, if any,
+// before the runtime throws for corruption in s.
+func printSpanAllocTrace(s *mspan) {
+	if s == nil || s.allocTrace == nil {
+		return
+	}
+	var goids [maxSpanAllocTrace]int64
+	var pcs [maxSpanAllocTrace]uintptr
+	n := s.allocTrace.copy(goids[:], pcs[:])
+	print("runtime: last ", n, " allocations into span ", hex(s.base()), ", oldest first:\n")
+	for i := 0; i < n; i++ {
+		print("\tgoroutine ", goids[i], " at ")
+		if f := findfunc(pcs[i]); f.valid() {
+			file, line := funcline(f, pcs[i]-1)
+			print(funcname(f), " ", file, ":", line, "\n")
+		} else {
+			print(hex(pcs[i]), "\n")
+		}
+	}
+}
+
+//go:linkname readSpanAllocTrace runtime/debug.readSpanAllocTrace
+func readSpanAllocTrace(addr uintptr, goids []int64, pcs []uintptr) (n int) {
+	systemstack(func() {
+		// Hold the heap lock so the span and its trace can't be
+		// freed while we copy it.
+		lock(&mheap_.lock)
+		if s := spanOfHeap(addr); s != nil && s.allocTrace != nil {
+			n = s.allocTrace.copy(goids, pcs)
+		}
+		unlock(&mheap_.lock)
+	})
+	return
+}
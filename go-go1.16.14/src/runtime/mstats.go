@@ -59,7 +59,8 @@ type mstats struct {
 	gcMiscSys                sysMemStat // updated atomically or during STW
 
 	// Miscellaneous statistics.
-	other_sys sysMemStat // updated atomically or during STW
+	other_sys      sysMemStat // updated atomically or during STW
+	userArenaInUse uint64     // bytes in manually-managed Arena chunks; computed by updatememstats
 
 	// Statistics about the garbage collector.
 
@@ -327,6 +328,31 @@ type MemStats struct {
 	// from the OS for OS thread stacks (which should be minimal).
 	StackSys uint64
 
+	// StackLarge is bytes of goroutine stacks in use that were
+	// allocated from spans of their own rather than from the
+	// per-size pools of small stacks. It is part of StackInuse.
+	StackLarge uint64
+
+	// StackGrows is the cumulative count of goroutine stacks
+	// copied to a larger stack because they ran out of room.
+	StackGrows uint64
+
+	// StackShrinks is the cumulative count of goroutine stacks
+	// copied to a smaller stack, by the garbage collector or by
+	// ShrinkStack.
+	StackShrinks uint64
+
+	// StackBySize reports the number of goroutine stacks in use
+	// of each size. Stack sizes are powers of two starting at the
+	// smallest stack; the last entry also counts any larger stacks.
+	StackBySize [21]struct {
+		// Size is the byte size of the stacks.
+		Size uint64
+
+		// Count is the number of stacks of the size in use.
+		Count uint64
+	}
+
 	// Off-heap memory statistics.
 	//
 	// The following statistics measure runtime-internal
@@ -359,7 +385,7 @@ type MemStats struct {
 	GCSys uint64
 
 	// OtherSys is bytes of memory in miscellaneous off-heap
-	// runtime allocations.
+	// runtime allocations, including the memory of Arenas.
 	OtherSys uint64
 
 	// Garbage collector statistics.
@@ -523,6 +549,17 @@ func readmemstats_m(stats *MemStats) {
 	// memstats.stacks_sys is only memory mapped directly for OS stacks.
 	// Add in heap-allocated stack memory for user consumption.
 	stats.StackSys = memstats.stacks_inuse + memstats.stacks_sys.load()
+	var consStats heapStatsDelta
+	memstats.heapStats.unsafeRead(&consStats)
+	stats.StackLarge = uint64(consStats.largeStacks)
+	stats.StackGrows = uint64(consStats.stackGrows)
+	stats.StackShrinks = uint64(consStats.stackShrinks)
+	for i := range stats.StackBySize {
+		stats.StackBySize[i].Size = uint64(_FixedStack) << i
+		if i < len(consStats.stacksInUse) {
+			stats.StackBySize[i].Count = uint64(consStats.stacksInUse[i])
+		}
+	}
 	stats.MSpanInuse = memstats.mspan_inuse
 	stats.MSpanSys = memstats.mspan_sys.load()
 	stats.MCacheInuse = memstats.mcache_inuse
@@ -532,7 +569,7 @@ func readmemstats_m(stats *MemStats) {
 	// to the memory management system, but we track this memory
 	// at a more granular level in the runtime.
 	stats.GCSys = memstats.gcMiscSys.load() + memstats.gcWorkBufInUse + memstats.gcProgPtrScalarBitsInUse
-	stats.OtherSys = memstats.other_sys.load()
+	stats.OtherSys = memstats.other_sys.load() + memstats.userArenaInUse
 	stats.NextGC = memstats.next_gc
 	stats.LastGC = memstats.last_gc_unix
 	stats.PauseTotalNs = memstats.pause_total_ns
@@ -562,6 +599,162 @@ func readmemstats_m(stats *MemStats) {
 	}
 }
 
+// SizeClassStats describes the small-object allocations of a single
+// size class, as reported by ReadSizeClassStats.
+type SizeClassStats struct {
+	Size        uint32 // maximum byte size of an object in the class
+	LiveObjects uint64 // number of objects allocated and not yet freed
+	TotalAlloc  uint64 // cumulative bytes allocated for objects in the class
+	Spans       uint64 // number of spans in use holding objects of the class
+	Unswept     uint64 // number of in-use spans not yet swept this cycle
+}
+
+// ReadSizeClassStats returns allocation statistics for each small
+// object size class, in increasing order of size. The result reuses
+// stats if it has enough capacity.
+//
+// As with MemStats, objects in spans cached by a P count as allocated.
+// Unlike ReadMemStats, ReadSizeClassStats does not stop the world, but
+// it holds the heap lock while it walks every span in the heap, which
+// takes time proportional to the size of the heap and holds up
+// allocations that need the lock in the meantime. Programs with large
+// heaps should call it sparingly.
+func ReadSizeClassStats(stats []SizeClassStats) []SizeClassStats {
+	if cap(stats) < _NumSizeClasses-1 {
+		stats = make([]SizeClassStats, _NumSizeClasses-1)
+	}
+	stats = stats[:_NumSizeClasses-1]
+
+	// Acquire the metricsSema to serialize with other readers
+	// of the consistent heap stats.
+	var consStats heapStatsDelta
+	semacquire(&metricsSema)
+	memstats.heapStats.read(&consStats)
+	semrelease(&metricsSema)
+
+	for i := range stats {
+		class := i + 1
+		a := uint64(consStats.smallAllocCount[class])
+		f := uint64(consStats.smallFreeCount[class])
+		stats[i] = SizeClassStats{
+			Size:       uint32(class_to_size[class]),
+			TotalAlloc: a * uint64(class_to_size[class]),
+		}
+		if a > f {
+			stats[i].LiveObjects = a - f
+		}
+	}
+	systemstack(func() {
+		readSizeClassSpans_m(stats)
+	})
+	return stats
+}
+
+// readSizeClassSpans_m fills in the span counts of stats, which is
+// indexed by size class minus one.
+//
+// readSizeClassSpans_m must be called on the system stack because it
+// acquires the heap lock.
+//go:systemstack
+func readSizeClassSpans_m(stats []SizeClassStats) {
+	lock(&mheap_.lock)
+	sg := mheap_.sweepgen
+	for _, s := range mheap_.allspans {
+		if s.state.get() != mSpanInUse {
+			continue
+		}
+		class := s.spanclass.sizeclass()
+		if class == 0 {
+			continue
+		}
+		st := &stats[class-1]
+		st.Spans++
+		// Spans at sg-2 have not been swept, and spans at sg+1
+		// were cached before sweeping began and must be swept too.
+		if ssg := atomic.Load(&s.sweepgen); ssg == sg-2 || ssg == sg+1 {
+			st.Unswept++
+		}
+	}
+	unlock(&mheap_.lock)
+}
+
+// SizeClassFragmentation describes how densely the in-use spans of a
+// single size class are packed, as reported by ReadFragmentation.
+type SizeClassFragmentation struct {
+	Size      uint32 // maximum byte size of an object in the class
+	Spans     uint64 // number of spans in use holding objects of the class
+	Objects   uint64 // number of allocated object slots in those spans
+	FreeSlots uint64 // number of free object slots in those spans
+	Sparse    uint64 // number of spans at most a quarter allocated
+
+	// Score is the fraction of Spans that would no longer be needed
+	// if Objects were packed as densely as possible, from 0 for a
+	// class with no wasted spans toward 1 for a badly fragmented one.
+	Score float64
+}
+
+// ReadFragmentation reports the fragmentation of each small object
+// size class, in increasing order of size. The result reuses frag if
+// it has enough capacity.
+//
+// ReadFragmentation stops the world and inspects the allocation
+// bitmap of every in-use span, so it is considerably more expensive
+// than ReadSizeClassStats. Objects in spans not yet swept since the
+// last garbage collection count as allocated, even if they are
+// unreachable. See runtime/debug.SetAvoidSparseSpans for a way to let
+// sparse spans drain so they can be freed.
+func ReadFragmentation(frag []SizeClassFragmentation) []SizeClassFragmentation {
+	if cap(frag) < _NumSizeClasses-1 {
+		frag = make([]SizeClassFragmentation, _NumSizeClasses-1)
+	}
+	frag = frag[:_NumSizeClasses-1]
+
+	stopTheWorld("read fragmentation")
+	systemstack(func() {
+		readFragmentation_m(frag)
+	})
+	startTheWorld()
+	return frag
+}
+
+// readFragmentation_m fills in frag, which is indexed by size class
+// minus one. The world must be stopped.
+//
+//go:systemstack
+func readFragmentation_m(frag []SizeClassFragmentation) {
+	for i := range frag {
+		frag[i] = SizeClassFragmentation{Size: uint32(class_to_size[i+1])}
+	}
+	mheap_.forEachInUseSpan(func(s *mspan) {
+		class := s.spanclass.sizeclass()
+		if class == 0 {
+			return
+		}
+		var n uint64
+		for i := uintptr(0); i < s.nelems; i++ {
+			if !s.isFree(i) {
+				n++
+			}
+		}
+		f := &frag[class-1]
+		f.Spans++
+		f.Objects += n
+		f.FreeSlots += uint64(s.nelems) - n
+		if s.isSparse(n) {
+			f.Sparse++
+		}
+	})
+	for i := range frag {
+		f := &frag[i]
+		if f.Spans == 0 {
+			continue
+		}
+		perSpan := uint64(class_to_allocnpages[i+1]) * _PageSize / uint64(f.Size)
+		need := (f.Objects + perSpan - 1) / perSpan
+		f.Score = float64(f.Spans-need) / float64(f.Spans)
+	}
+}
+
 //go:linkname readGCStats runtime/debug.readGCStats
 func readGCStats(pauses *[]uint64) {
 	systemstack(func() {
@@ -677,16 +870,19 @@ func updatememstats() {
 	memstats.stacks_inuse = uint64(consStats.inStacks)
 	memstats.gcWorkBufInUse = uint64(consStats.inWorkBufs)
 	memstats.gcProgPtrScalarBitsInUse = uint64(consStats.inPtrScalarBits)
+	memstats.userArenaInUse = uint64(consStats.inUserArenas)
 
-	// We also count stacks_inuse, gcWorkBufInUse, and gcProgPtrScalarBitsInUse as sys memory.
-	memstats.sys += memstats.stacks_inuse + memstats.gcWorkBufInUse + memstats.gcProgPtrScalarBitsInUse
+	// We also count stacks_inuse, gcWorkBufInUse, gcProgPtrScalarBitsInUse
+	// and userArenaInUse as sys memory.
+	memstats.sys += memstats.stacks_inuse + memstats.gcWorkBufInUse + memstats.gcProgPtrScalarBitsInUse +
+		memstats.userArenaInUse
 
 	// The world is stopped, so the consistent stats (after aggregation)
 	// should be identical to some combination of memstats. In particular:
 	//
 	// * heap_inuse == inHeap
 	// * heap_released == released
-	// * heap_sys - heap_released == committed - inStacks - inWorkBufs - inPtrScalarBits
+	// * heap_sys - heap_released == committed - inStacks - inWorkBufs - inPtrScalarBits - inUserArenas
 	//
 	// Check if that's actually true.
 	//
@@ -704,7 +900,7 @@ func updatememstats() {
 		throw("heap_released and consistent stats are not equal")
 	}
 	globalRetained := memstats.heap_sys.load() - memstats.heap_released
-	consRetained := uint64(consStats.committed - consStats.inStacks - consStats.inWorkBufs - consStats.inPtrScalarBits)
+	consRetained := uint64(consStats.committed - consStats.inStacks - consStats.inWorkBufs - consStats.inPtrScalarBits - consStats.inUserArenas)
 	if globalRetained != consRetained {
 		print("runtime: global value=", globalRetained, "\n")
 		print("runtime: consistent value=", consRetained, "\n")
@@ -781,6 +977,7 @@ type heapStatsDelta struct {
 	inStacks        int64 // byte delta of memory reserved for stacks
 	inWorkBufs      int64 // byte delta of memory reserved for work bufs
 	inPtrScalarBits int64 // byte delta of memory reserved for unrolled GC prog bits
+	inUserArenas    int64 // byte delta of memory reserved for Arena chunks
 
 	// Allocator stats.
 	largeAlloc      uintptr                  // bytes allocated for large objects
@@ -790,6 +987,12 @@ type heapStatsDelta struct {
 	largeFreeCount  uintptr                  // number of frees for large objects (>maxSmallSize)
 	smallFreeCount  [_NumSizeClasses]uintptr // number of frees for small objects (<=maxSmallSize)
 
+	// Stack stats.
+	stacksInUse  [numStackSizes]uintptr // number of stacks in use, by stackSizeIndex
+	largeStacks  uintptr                // bytes of stacks in use allocated from dedicated spans
+	stackGrows   uintptr                // number of stacks copied to grow them
+	stackShrinks uintptr                // number of stacks copied to shrink them
+
 	// Add a uint32 to ensure this struct is a multiple of 8 bytes in size.
 	// Only necessary on 32-bit platforms.
 	// _ [(sys.PtrSize / 4) % 2]uint32
@@ -803,6 +1006,7 @@ func (a *heapStatsDelta) merge(b *heapStatsDelta) {
 	a.inStacks += b.inStacks
 	a.inWorkBufs += b.inWorkBufs
 	a.inPtrScalarBits += b.inPtrScalarBits
+	a.inUserArenas += b.inUserArenas
 
 	a.largeAlloc += b.largeAlloc
 	a.largeAllocCount += b.largeAllocCount
@@ -814,6 +1018,13 @@ func (a *heapStatsDelta) merge(b *heapStatsDelta) {
 	for i := range b.smallFreeCount {
 		a.smallFreeCount[i] += b.smallFreeCount[i]
 	}
+
+	for i := range b.stacksInUse {
+		a.stacksInUse[i] += b.stacksInUse[i]
+	}
+	a.largeStacks += b.largeStacks
+	a.stackGrows += b.stackGrows
+	a.stackShrinks += b.stackShrinks
 }
 
 // consistentHeapStats represents a set of various memory statistics
@@ -59,6 +59,23 @@ type wbBuf struct {
 	buf [wbBufEntryPointers * wbBufEntries]uintptr
 }
 
+// wbBufStats counts the work done by flushing write barrier buffers.
+type wbBufStats struct {
+	flushes  uint64 // calls to wbBufFlush1
+	pointers uint64 // pointers taken from the buffer
+	greyed   uint64 // objects marked by flushing
+}
+
+func (s *wbBufStats) add(o *wbBufStats) {
+	s.flushes += o.flushes
+	s.pointers += o.pointers
+	s.greyed += o.greyed
+}
+
+// wbBufRetired holds the write barrier statistics of destroyed P's.
+// It is updated and read with the world stopped.
+var wbBufRetired wbBufStats
+
 const (
 	// wbBufEntries is the number of write barriers between
 	// flushes of the write barrier buffer.
@@ -217,6 +234,8 @@ func wbBufFlush1(_p_ *p) {
 	start := uintptr(unsafe.Pointer(&_p_.wbBuf.buf[0]))
 	n := (_p_.wbBuf.next - start) / unsafe.Sizeof(_p_.wbBuf.buf[0])
 	ptrs := _p_.wbBuf.buf[:n]
+	_p_.wbStats.flushes++
+	_p_.wbStats.pointers += uint64(n)
 
 	// Poison the buffer to make extra sure nothing is enqueued
 	// while we're processing the buffer.
@@ -268,6 +287,7 @@ func wbBufFlush1(_p_ *p) {
 			continue
 		}
 		mbits.setMarked()
+		_p_.wbStats.greyed++
 
 		// Mark span.
 		arena, pageIdx, pageMask := pageIndexOf(span.base())
@@ -288,3 +308,58 @@ func wbBufFlush1(_p_ *p) {
 
 	_p_.wbBuf.reset()
 }
+
+// WriteBarrierStats describes the work done by the garbage collector's
+// write barrier buffers, as reported by ReadWriteBarrierStats. All
+// counts are cumulative since the program started.
+//
+// While the collector is marking, each pointer write queues the old
+// and new pointer values in a per-P buffer. The buffer is flushed when
+// it fills up and at transitions of the GC cycle, and flushing marks
+// the objects the pointers refer to. These counts grow with the rate
+// of pointer writes during marking.
+type WriteBarrierStats struct {
+	Flushes  uint64 // number of write barrier buffer flushes
+	Pointers uint64 // number of pointers queued by write barriers and flushed
+	Greyed   uint64 // number of objects marked by flushes
+
+	// Procs breaks the counts down by P, in order of ID. Its length
+	// is GOMAXPROCS. Counts from P's removed by lowering GOMAXPROCS
+	// appear only in the totals.
+	Procs []WriteBarrierPStats
+}
+
+// WriteBarrierPStats describes the write barrier buffer of a single P,
+// as reported in WriteBarrierStats.
+type WriteBarrierPStats struct {
+	Flushes  uint64 // number of flushes of the P's buffer
+	Pointers uint64 // number of pointers flushed from the P's buffer
+	Greyed   uint64 // number of objects marked by flushes of the P's buffer
+}
+
+// ReadWriteBarrierStats populates s with write barrier statistics.
+// s.Procs is reused if it has enough capacity.
+//
+// ReadWriteBarrierStats stops the world to read the counts.
+func ReadWriteBarrierStats(s *WriteBarrierStats) {
+	stopTheWorld("read write barrier stats")
+	procs := s.Procs[:0]
+	if cap(procs) < len(allp) {
+		procs = make([]WriteBarrierPStats, 0, len(allp))
+	}
+	total := wbBufRetired
+	for _, pp := range allp {
+		total.add(&pp.wbStats)
+		procs = append(procs, WriteBarrierPStats{
+			Flushes:  pp.wbStats.flushes,
+			Pointers: pp.wbStats.pointers,
+			Greyed:   pp.wbStats.greyed,
+		})
+	}
+	startTheWorld()
+
+	s.Flushes = total.flushes
+	s.Pointers = total.pointers
+	s.Greyed = total.greyed
+	s.Procs = procs
+}
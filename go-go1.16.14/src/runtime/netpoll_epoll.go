@@ -21,9 +21,21 @@ func epollctl(epfd, op, fd int32, ev *epollevent) int32
 func epollwait(epfd int32, ev *epollevent, nev, timeout int32) int32
 func closeonexec(fd int32)
 
+// maxNetpollShards is the most epoll instances GODEBUG=netpollshards
+// splits descriptors among.
+const maxNetpollShards = 64
+
 var (
 	epfd int32 = -1 // epoll descriptor
 
+	// epshards are the epoll descriptors that descriptors are
+	// registered with, chosen by descriptor number. epshards[0] is
+	// epfd. The others are registered with epfd, so that a poll of
+	// epfd reports which of them have events. nepshards is 1 unless
+	// GODEBUG=netpollshards is set.
+	epshards  [maxNetpollShards]int32
+	nepshards uintptr
+
 	netpollBreakRd, netpollBreakWr uintptr // for netpollBreak
 
 	netpollWakeSig uint32 // used to avoid duplicate calls of netpollBreak
@@ -55,22 +67,64 @@ func netpollinit() {
 	}
 	netpollBreakRd = uintptr(r)
 	netpollBreakWr = uintptr(w)
+
+	epshards[0] = epfd
+	n := uintptr(1)
+	if debug.netpollshards > 1 {
+		n = uintptr(debug.netpollshards)
+		if n > maxNetpollShards {
+			n = maxNetpollShards
+		}
+	}
+	for i := uintptr(1); i < n; i++ {
+		fd := epollcreate1(_EPOLL_CLOEXEC)
+		if fd < 0 {
+			println("runtime: epollcreate failed with", -fd)
+			throw("runtime: netpollinit failed")
+		}
+		// Level-triggered, so epfd keeps reporting the shard
+		// until a poll drains it.
+		ev := epollevent{
+			events: _EPOLLIN,
+		}
+		*(**int32)(unsafe.Pointer(&ev.data)) = &epshards[i]
+		errno = epollctl(epfd, _EPOLL_CTL_ADD, fd, &ev)
+		if errno != 0 {
+			println("runtime: epollctl failed with", -errno)
+			throw("runtime: epollctl failed")
+		}
+		epshards[i] = fd
+	}
+	nepshards = n
 }
 
 func netpollIsPollDescriptor(fd uintptr) bool {
-	return fd == uintptr(epfd) || fd == netpollBreakRd || fd == netpollBreakWr
+	if fd == uintptr(epfd) || fd == netpollBreakRd || fd == netpollBreakWr {
+		return true
+	}
+	for i := uintptr(1); i < nepshards; i++ {
+		if fd == uintptr(epshards[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// netpollShardFd returns the epoll descriptor fd is registered with.
+func netpollShardFd(fd uintptr) int32 {
+	return epshards[fd%nepshards]
 }
 
 func netpollopen(fd uintptr, pd *pollDesc) int32 {
 	var ev epollevent
 	ev.events = _EPOLLIN | _EPOLLOUT | _EPOLLRDHUP | _EPOLLET
 	*(**pollDesc)(unsafe.Pointer(&ev.data)) = pd
-	return -epollctl(epfd, _EPOLL_CTL_ADD, int32(fd), &ev)
+	return -epollctl(netpollShardFd(fd), _EPOLL_CTL_ADD, int32(fd), &ev)
 }
 
 func netpollclose(fd uintptr) int32 {
 	var ev epollevent
-	return -epollctl(epfd, _EPOLL_CTL_DEL, int32(fd), &ev)
+	return -epollctl(netpollShardFd(fd), _EPOLL_CTL_DEL, int32(fd), &ev)
 }
 
 func netpollarm(pd *pollDesc, mode int) {
@@ -138,12 +192,18 @@ retry:
 		goto retry
 	}
 	var toRun gList
+	var shards uint64 // shards with events, as a bitmap
 	for i := int32(0); i < n; i++ {
 		ev := &events[i]
 		if ev.events == 0 {
 			continue
 		}
 
+		if p := *(*uintptr)(unsafe.Pointer(&ev.data)); p >= uintptr(unsafe.Pointer(&epshards[1])) && p <= uintptr(unsafe.Pointer(&epshards[maxNetpollShards-1])) {
+			shards |= 1 << ((p - uintptr(unsafe.Pointer(&epshards[0]))) / unsafe.Sizeof(epshards[0]))
+			continue
+		}
+
 		if *(**uintptr)(unsafe.Pointer(&ev.data)) == &netpollBreakRd {
 			if ev.events != _EPOLLIN {
 				println("runtime: netpoll: break fd ready for", ev.events)
@@ -160,21 +220,72 @@ retry:
 			continue
 		}
 
-		var mode int32
-		if ev.events&(_EPOLLIN|_EPOLLRDHUP|_EPOLLHUP|_EPOLLERR) != 0 {
-			mode += 'r'
+		netpollevent(&toRun, ev)
+	}
+	for i := uintptr(1); shards != 0; i++ {
+		if shards&(1<<i) != 0 {
+			netpollshard(&toRun, epshards[i])
+			shards &^= 1 << i
 		}
-		if ev.events&(_EPOLLOUT|_EPOLLHUP|_EPOLLERR) != 0 {
-			mode += 'w'
+	}
+	return toRun
+}
+
+// netpollevent adds the goroutines made ready by ev, an event for a
+// registered descriptor, to toRun.
+func netpollevent(toRun *gList, ev *epollevent) {
+	var mode int32
+	if ev.events&(_EPOLLIN|_EPOLLRDHUP|_EPOLLHUP|_EPOLLERR) != 0 {
+		mode += 'r'
+	}
+	if ev.events&(_EPOLLOUT|_EPOLLHUP|_EPOLLERR) != 0 {
+		mode += 'w'
+	}
+	if mode != 0 {
+		pd := *(**pollDesc)(unsafe.Pointer(&ev.data))
+		pd.everr = false
+		if ev.events == _EPOLLERR {
+			pd.everr = true
 		}
-		if mode != 0 {
-			pd := *(**pollDesc)(unsafe.Pointer(&ev.data))
-			pd.everr = false
-			if ev.events == _EPOLLERR {
-				pd.everr = true
-			}
-			netpollready(&toRun, pd, mode)
+		netpollready(toRun, pd, mode)
+	}
+}
+
+// netpollshard polls the shard epoll descriptor fd without blocking
+// and adds the goroutines made ready to toRun. Events it leaves
+// behind keep fd ready in epfd, so they are picked up by the next
+// poll.
+func netpollshard(toRun *gList, fd int32) {
+	var events [128]epollevent
+retry:
+	n := epollwait(fd, &events[0], int32(len(events)), 0)
+	if n < 0 {
+		if n == -_EINTR {
+			goto retry
 		}
+		println("runtime: epollwait on fd", fd, "failed with", -n)
+		throw("runtime: netpoll failed")
 	}
-	return toRun
+	for i := int32(0); i < n; i++ {
+		if events[i].events != 0 {
+			netpollevent(toRun, &events[i])
+		}
+	}
+}
+
+// netpollShard polls, without blocking, the shard of the network
+// poller belonging to pp, so that P's with their own shards don't all
+// contend on epfd. It reports false if the network poller isn't
+// sharded or pp's shard is epfd, which netpoll polls.
+func netpollShard(pp *p) (gList, bool) {
+	if nepshards <= 1 {
+		return gList{}, false
+	}
+	i := uintptr(pp.id) % nepshards
+	if i == 0 {
+		return gList{}, false
+	}
+	var toRun gList
+	netpollshard(&toRun, epshards[i])
+	return toRun, true
 }
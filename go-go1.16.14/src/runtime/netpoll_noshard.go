@@ -0,0 +1,13 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package runtime
+
+// netpollShard polls the shard of the network poller belonging to pp.
+// Only the Linux network poller is sharded (GODEBUG=netpollshards).
+func netpollShard(pp *p) (gList, bool) {
+	return gList{}, false
+}
@@ -125,6 +125,7 @@ func sighandler(_ureg *ureg, note *byte, gp *g) int {
 Throw:
 	_g_.m.throwing = 1
 	_g_.m.caughtsig.set(gp)
+	callCrashHandler(gp, notestr, false, 0)
 	startpanic_m()
 	print(notestr, "\n")
 	print("PC=", hex(c.pc()), "\n")
@@ -314,6 +314,18 @@ func minit() {
 	}
 	minitSignalMask()
 	getg().m.procid = uint64(pthread_self())
+	osSetThreadName(getg().m)
+}
+
+// osSetThreadName gives mp's thread the name recorded in mp.name, if
+// any. Darwin only lets a thread name itself, so mp must be the
+// current M for it to have any effect. Extra Ms are left alone, as
+// their threads belong to C.
+func osSetThreadName(mp *m) {
+	if mp.name[0] == 0 || mp != getg().m || mp.isextra {
+		return
+	}
+	pthread_setname_np(&mp.name[0])
 }
 
 // Called from dropm to undo the effect of an minit.
@@ -153,3 +153,9 @@ const preemptMSupported = false
 func preemptM(mp *m) {
 	// No threads, so nothing to do.
 }
+
+// signalFixupM is not needed, as syscall_runtime_doAllThreadsSyscall
+// is only used on Linux.
+func signalFixupM(mp *m) {
+	throw("signalFixupM not implemented")
+}
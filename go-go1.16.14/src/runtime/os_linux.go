@@ -5,6 +5,7 @@
 package runtime
 
 import (
+	"internal/bytealg"
 	"runtime/internal/sys"
 	"unsafe"
 )
@@ -282,6 +283,451 @@ func sysauxv(auxv []uintptr) int {
 
 var sysTHPSizePath = []byte("/sys/kernel/mm/transparent_hugepage/hpage_pmd_size\x00")
 
+var sysNUMANodesPath = []byte("/sys/devices/system/node/possible\x00")
+
+// getNUMANodeCount returns the number of NUMA nodes, or 0 if it can't
+// be determined. The kernel lists the possible nodes as ranges, as in
+// "0-3", so the highest one ends the list.
+func getNUMANodeCount() int32 {
+	var buf [64]byte
+	fd := open(&sysNUMANodesPath[0], 0 /* O_RDONLY */, 0)
+	if fd < 0 {
+		return 0
+	}
+	ptr := noescape(unsafe.Pointer(&buf[0]))
+	n := read(fd, ptr, int32(len(buf)))
+	closefd(fd)
+	if n <= 0 || n == int32(len(buf)) {
+		return 0
+	}
+	n-- // remove trailing newline
+	b := (*[len(buf)]byte)(ptr)
+	i := n
+	for i > 0 && b[i-1] >= '0' && b[i-1] <= '9' {
+		i--
+	}
+	v, ok := atoi32(slicebytetostringtmp(&b[i], int(n-i)))
+	if !ok || v < 0 {
+		return 0
+	}
+	return v + 1
+}
+
+var (
+	procSelfCgroupPath    = []byte("/proc/self/cgroup\x00")
+	procSelfMountinfoPath = []byte("/proc/self/mountinfo\x00")
+)
+
+// cgroupCPU holds the paths of the files with the CPU quota of the
+// process's cgroup. cgroupCPUInit sets it once, before sysmon starts.
+var cgroupCPU struct {
+	ok     bool
+	v2     bool
+	quota  [256]byte // cpu.max in v2, cpu.cfs_quota_us in v1
+	period [256]byte // cpu.cfs_period_us in v1
+}
+
+// cgroupCPUInit finds the directory of the process's cgroup for the
+// CPU controller. /proc/self/cgroup gives the cgroup's path within
+// its hierarchy, and the matching cgroup or cgroup2 entry of
+// /proc/self/mountinfo where that hierarchy is mounted. On hybrid
+// systems, a v1 hierarchy with the cpu controller wins over the
+// v2 one, which then has no cpu controller.
+func cgroupCPUInit() {
+	var r procLineReader
+	var path [256]byte
+	var pathLen int
+	found, v2 := false, false
+	if !r.open(&procSelfCgroupPath[0]) {
+		return
+	}
+	for {
+		line, ok := r.next()
+		if !ok {
+			break
+		}
+		p, isV2, ok := parseProcCgroup(line)
+		if !ok || len(p) > len(path) || (found && isV2) {
+			continue
+		}
+		pathLen = copy(path[:], p)
+		found, v2 = true, isV2
+		if !v2 {
+			break
+		}
+	}
+	r.close()
+	if !found || !r.open(&procSelfMountinfoPath[0]) {
+		return
+	}
+	cg := slicebytetostringtmp((*byte)(noescape(unsafe.Pointer(&path[0]))), pathLen)
+	for {
+		line, ok := r.next()
+		if !ok {
+			break
+		}
+		root, mount, isV2, ok := parseMountInfo(line)
+		if !ok || isV2 != v2 {
+			continue
+		}
+		if v2 {
+			cgroupCPU.ok = joinCgroupPath(cgroupCPU.quota[:], mount, root, cg, "cpu.max")
+		} else {
+			cgroupCPU.ok = joinCgroupPath(cgroupCPU.quota[:], mount, root, cg, "cpu.cfs_quota_us") &&
+				joinCgroupPath(cgroupCPU.period[:], mount, root, cg, "cpu.cfs_period_us")
+		}
+		cgroupCPU.v2 = v2
+		break
+	}
+	r.close()
+}
+
+// parseProcCgroup parses a line of /proc/self/cgroup, which has the
+// form "hierarchy-ID:controller-list:cgroup-path". It returns the path
+// of the cgroup and whether it is in the v2 hierarchy, which has ID 0
+// and no controllers listed, if the line is for the v2 hierarchy or a
+// v1 one with the cpu controller.
+func parseProcCgroup(line string) (path string, v2, ok bool) {
+	i := bytealg.IndexByteString(line, ':')
+	if i < 0 {
+		return "", false, false
+	}
+	id, rest := line[:i], line[i+1:]
+	i = bytealg.IndexByteString(rest, ':')
+	if i < 0 {
+		return "", false, false
+	}
+	controllers, path := rest[:i], rest[i+1:]
+	if id == "0" && controllers == "" {
+		return path, true, true
+	}
+	if hasListItem(controllers, "cpu") {
+		return path, false, true
+	}
+	return "", false, false
+}
+
+// parseMountInfo parses a line of /proc/self/mountinfo, which has the
+// form "ID parent-ID major:minor root mount-point options
+// [optional-fields...] - fstype source super-options". It returns the
+// root of the mount within its file system and where it is mounted,
+// if the mount is of a cgroup v2 hierarchy, or of a v1 one with the
+// cpu controller.
+func parseMountInfo(line string) (root, mount string, v2, ok bool) {
+	_, line = nextField(line) // ID
+	_, line = nextField(line) // parent ID
+	_, line = nextField(line) // major:minor
+	root, line = nextField(line)
+	mount, line = nextField(line)
+	for {
+		var f string
+		f, line = nextField(line)
+		if f == "-" {
+			break
+		}
+		if f == "" {
+			return "", "", false, false
+		}
+	}
+	fstype, line := nextField(line)
+	_, line = nextField(line) // source
+	options, _ := nextField(line)
+	switch {
+	case fstype == "cgroup2":
+		return root, mount, true, true
+	case fstype == "cgroup" && hasListItem(options, "cpu"):
+		return root, mount, false, true
+	}
+	return "", "", false, false
+}
+
+// nextField returns the first space-separated field of s and the rest
+// of s after it.
+func nextField(s string) (field, rest string) {
+	i := bytealg.IndexByteString(s, ' ')
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
+
+// hasListItem reports whether the comma-separated list contains item.
+func hasListItem(list, item string) bool {
+	for list != "" {
+		var f string
+		if i := bytealg.IndexByteString(list, ','); i >= 0 {
+			f, list = list[:i], list[i+1:]
+		} else {
+			f, list = list, ""
+		}
+		if f == item {
+			return true
+		}
+	}
+	return false
+}
+
+// joinCgroupPath writes the NUL-terminated path of file in the
+// directory of cgroup, whose hierarchy has its root mounted at mount,
+// into dst. It reports whether the path fits. If cgroup isn't under
+// root, as happens when the process is in a cgroup namespace, the
+// mount itself is the cgroup's directory.
+func joinCgroupPath(dst []byte, mount, root, cgroup, file string) bool {
+	rel := cgroup
+	if root != "/" {
+		if hasPrefix(cgroup, root) {
+			rel = cgroup[len(root):]
+		} else {
+			rel = ""
+		}
+	}
+	dir := len(mount) + len(rel)
+	slash := 0
+	if dir == 0 || (rel != "" && rel[len(rel)-1] != '/') || (rel == "" && mount[len(mount)-1] != '/') {
+		slash = 1
+	}
+	if dir+slash+len(file)+1 > len(dst) {
+		return false
+	}
+	n := copy(dst, mount)
+	n += copy(dst[n:], rel)
+	if slash != 0 {
+		dst[n] = '/'
+		n++
+	}
+	n += copy(dst[n:], file)
+	dst[n] = 0
+	return true
+}
+
+// procLineReader reads a file in /proc a line at a time through a
+// fixed buffer, skipping lines that don't fit in it.
+type procLineReader struct {
+	fd         int32
+	buf        [512]byte
+	start, end int
+	skip       bool // dropping the rest of an overlong line
+}
+
+func (r *procLineReader) open(path *byte) bool {
+	r.fd = open(path, 0 /* O_RDONLY */, 0)
+	r.start, r.end, r.skip = 0, 0, false
+	return r.fd >= 0
+}
+
+func (r *procLineReader) close() {
+	closefd(r.fd)
+}
+
+// next returns the next line without its newline. The line is only
+// valid until the next call. ok is false at the end of the file.
+func (r *procLineReader) next() (line string, ok bool) {
+	b := (*[len(r.buf)]byte)(noescape(unsafe.Pointer(&r.buf)))
+	for {
+		if i := bytealg.IndexByte(r.buf[r.start:r.end], '\n'); i >= 0 {
+			line = slicebytetostringtmp(&b[r.start], i)
+			r.start += i + 1
+			if r.skip {
+				r.skip = false
+				continue
+			}
+			return line, true
+		}
+		if r.skip || (r.start == 0 && r.end == len(r.buf)) {
+			r.skip = true
+			r.end = 0
+		} else {
+			r.end = copy(r.buf[:], r.buf[r.start:r.end])
+		}
+		r.start = 0
+		n := read(r.fd, unsafe.Pointer(&b[r.end]), int32(len(r.buf)-r.end))
+		if n <= 0 {
+			if r.end == 0 || r.skip {
+				return "", false
+			}
+			// A last line without a newline.
+			line = slicebytetostringtmp(&b[0], r.end)
+			r.end = 0
+			return line, true
+		}
+		r.end += int(n)
+	}
+}
+
+// cgroupCPULimit returns the number of CPUs that the CPU quota of the
+// process's cgroup allows it to use, rounded up, or -1 if there is no
+// quota or it can't be determined. In cgroup v2 it reads cpu.max,
+// whose contents are "$QUOTA $PERIOD" or "max $PERIOD", and in v1
+// cpu.cfs_quota_us, which holds -1 for no quota, and cpu.cfs_period_us.
+func cgroupCPULimit() int32 {
+	if !cgroupCPU.ok {
+		return -1
+	}
+	var buf [64]byte
+	ptr := noescape(unsafe.Pointer(&buf[0]))
+	if cgroupCPU.v2 {
+		s := readCgroupFile(&cgroupCPU.quota[0], ptr, len(buf))
+		i := bytealg.IndexByteString(s, ' ')
+		if i < 0 {
+			return -1
+		}
+		return cpuLimit(s[:i], s[i+1:])
+	}
+	var buf2 [32]byte
+	ptr2 := noescape(unsafe.Pointer(&buf2[0]))
+	quota := readCgroupFile(&cgroupCPU.quota[0], ptr, len(buf))
+	period := readCgroupFile(&cgroupCPU.period[0], ptr2, len(buf2))
+	return cpuLimit(quota, period)
+}
+
+// readCgroupFile reads the file at path into the n bytes at buf and
+// returns its contents without the trailing newline, or "" if it can't
+// be read or doesn't fit.
+func readCgroupFile(path *byte, buf unsafe.Pointer, n int) string {
+	fd := open(path, 0 /* O_RDONLY */, 0)
+	if fd < 0 {
+		return ""
+	}
+	r := read(fd, buf, int32(n))
+	closefd(fd)
+	if r <= 0 || r == int32(n) {
+		return ""
+	}
+	if *(*byte)(add(buf, uintptr(r-1))) == '\n' {
+		r--
+	}
+	return slicebytetostringtmp((*byte)(buf), int(r))
+}
+
+// cpuLimit returns the number of CPUs, rounded up, that a cgroup CPU
+// quota of quota microseconds every period microseconds amounts to, or
+// -1 if the quota is "max" or negative, meaning there is no limit, or
+// either is not a number.
+func cpuLimit(quota, period string) int32 {
+	q, ok := atoi(quota)
+	if !ok || q < 0 {
+		return -1
+	}
+	p, ok := atoi(period)
+	if !ok || p <= 0 {
+		return -1
+	}
+	n := (q + p - 1) / p
+	if n < 1 {
+		n = 1
+	} else if n > 0x7fffffff { // MaxInt32
+		n = 0x7fffffff
+	}
+	return int32(n)
+}
+
+// osSetThreadName gives mp's thread the name recorded in mp.name, if
+// any, by writing it to the thread's comm file in /proc. Extra Ms are
+// left alone, as their threads belong to C.
+func osSetThreadName(mp *m) {
+	if mp.name[0] == 0 || mp.procid == 0 || mp.isextra {
+		return
+	}
+	var path [48]byte
+	var tid [20]byte
+	n := copy(path[:], "/proc/self/task/")
+	n += copy(path[n:], itoa(tid[:], mp.procid))
+	copy(path[n:], "/comm\x00")
+	fd := open(&path[0], 1 /* O_WRONLY */, 0)
+	if fd < 0 {
+		return
+	}
+	write1(uintptr(fd), unsafe.Pointer(&mp.name[0]), int32(findnull(&mp.name[0])))
+	closefd(fd)
+}
+
+// numaMaxCPUs is the most CPUs numaCPUNodes maps to NUMA nodes.
+const numaMaxCPUs = 1024
+
+// numaCPUNodes maps each CPU to its NUMA node plus one, or 0 if it is
+// unknown. osinit builds it once, when there are several nodes.
+var numaCPUNodes [numaMaxCPUs]uint8
+
+// initNUMACPUNodes fills in numaCPUNodes from the list of CPUs of each
+// node, which the kernel gives as ranges, as in "0-3,8-11".
+func initNUMACPUNodes() {
+	var path [64]byte
+	var num [20]byte
+	var buf [512]byte
+	for node := int32(0); node < numaNodes && node < 255; node++ {
+		n := copy(path[:], "/sys/devices/system/node/node")
+		n += copy(path[n:], itoa(num[:], uint64(node)))
+		copy(path[n:], "/cpulist\x00")
+		fd := open(&path[0], 0 /* O_RDONLY */, 0)
+		if fd < 0 {
+			continue
+		}
+		ptr := noescape(unsafe.Pointer(&buf[0]))
+		r := read(fd, ptr, int32(len(buf)))
+		closefd(fd)
+		if r <= 0 || r == int32(len(buf)) {
+			continue
+		}
+		b := (*[len(buf)]byte)(ptr)[:r]
+		for len(b) > 0 {
+			i := 0
+			for i < len(b) && b[i] != ',' && b[i] != '\n' {
+				i++
+			}
+			lo, hi := parseCPURange(b[:i])
+			for cpu := lo; cpu >= 0 && cpu <= hi && cpu < numaMaxCPUs; cpu++ {
+				numaCPUNodes[cpu] = uint8(node + 1)
+			}
+			if i < len(b) {
+				i++
+			}
+			b = b[i:]
+		}
+	}
+}
+
+// parseCPURange parses a CPU number or range, as in "3" or "0-3". It
+// returns -1, -1 if s is neither.
+func parseCPURange(s []byte) (lo, hi int32) {
+	i := 0
+	for i < len(s) && s[i] != '-' {
+		i++
+	}
+	if i == 0 || i+1 == len(s) {
+		return -1, -1
+	}
+	lo, ok := atoi32(slicebytetostringtmp(&s[0], i))
+	if !ok {
+		return -1, -1
+	}
+	if i == len(s) {
+		return lo, lo
+	}
+	hi, ok = atoi32(slicebytetostringtmp(&s[i+1], len(s)-i-1))
+	if !ok || hi < lo {
+		return -1, -1
+	}
+	return lo, hi
+}
+
+// cpuNUMANode returns the NUMA node of the CPU that the calling thread
+// is running on, or -1 if it is unknown. It takes the node from
+// numaCPUNodes, falling back to the one the kernel reports for CPUs
+// it doesn't map. Callers on hot paths use mNUMANode, which caches
+// the result.
+//
+//go:nosplit
+func cpuNUMANode() int32 {
+	var cpu, node uint32
+	if getcpu(&cpu, &node) < 0 {
+		return -1
+	}
+	if cpu < numaMaxCPUs && numaCPUNodes[cpu] != 0 {
+		return int32(numaCPUNodes[cpu]) - 1
+	}
+	return int32(node)
+}
+
 // 注释：获取系统中大页（Huge Pages）的大小。大页是操作系统内存管理的一种技术，通过使用较大的页尺寸来减少页表项的数量，从而提高内存访问的效率。
 // 注释：大页的使用可以显著提高某些应用程序的性能，尤其是那些大量使用内存的应用程序。
 // 注释：该函数就是返回Linux系统sysTHPSizePath[0]命令对应的值
@@ -313,6 +759,10 @@ func getHugePageSize() uintptr {
 func osinit() {
 	ncpu = getproccount()                // 注释：获取cpu的数量
 	physHugePageSize = getHugePageSize() // 注释：操作系统的大页(Huge Pages)
+	numaNodes = getNUMANodeCount()
+	if numaNodes > 1 {
+		initNUMACPUNodes()
+	}
 	if iscgo {
 		// #42494 glibc and musl reserve some signals for
 		// internal use and require they not be blocked by
@@ -380,6 +830,7 @@ func minit() {
 	// procid. We need this for asynchronous preemption and it's
 	// useful in debuggers.
 	getg().m.procid = uint64(gettid()) // 注释：获取进程的父ID赋值
+	osSetThreadName(getg().m)
 }
 
 // Called from dropm to undo the effect of an minit.
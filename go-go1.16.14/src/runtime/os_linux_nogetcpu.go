@@ -0,0 +1,18 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+// +build !amd64,!arm64
+
+package runtime
+
+import "unsafe"
+
+func getcpu(cpu, node *uint32) int32 {
+	return -_ENOSYS
+}
+
+func mbind(addr unsafe.Pointer, n uintptr, mode int32, nodemask *uint64, maxnode uintptr, flags uint32) int32 {
+	return -_ENOSYS
+}
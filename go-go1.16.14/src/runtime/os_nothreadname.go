@@ -0,0 +1,11 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!linux
+
+package runtime
+
+// osSetThreadName would give mp's thread the name recorded in mp.name,
+// but this system has no way to name threads that the runtime uses.
+func osSetThreadName(mp *m) {}
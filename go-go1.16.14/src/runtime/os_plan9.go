@@ -512,3 +512,9 @@ func preemptM(mp *m) {
 	//
 	// TODO: Use a note like we use signals on POSIX OSes
 }
+
+// signalFixupM is not needed, as syscall_runtime_doAllThreadsSyscall
+// is only used on Linux.
+func signalFixupM(mp *m) {
+	throw("signalFixupM not implemented")
+}
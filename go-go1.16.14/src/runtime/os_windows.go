@@ -1316,6 +1316,12 @@ func preemptM(mp *m) {
 	stdcall1(_CloseHandle, thread)
 }
 
+// signalFixupM is not needed, as syscall_runtime_doAllThreadsSyscall
+// is only used on Linux.
+func signalFixupM(mp *m) {
+	throw("signalFixupM not implemented")
+}
+
 // osPreemptExtEnter is called before entering external code that may
 // call ExitProcess.
 //
@@ -1151,7 +1151,7 @@ func throw(s string) {
 	if gp.m.throwing == 0 {
 		gp.m.throwing = 1
 	}
-	fatalthrow()
+	fatalthrow(s)
 	*(*int)(nil) = 0 // not reached // 注释：未到达
 }
 
@@ -1198,17 +1198,19 @@ func recovery(gp *g) {
 
 // fatalthrow implements an unrecoverable runtime throw. It freezes the
 // system, prints stack traces starting from its caller, and terminates the
-// process.
+// process. msg is the error message, which the caller has printed.
 // 注释：fatalthrow实现了一个不可恢复的运行时抛出。它冻结系统，从调用程序开始打印堆栈跟踪，并终止进程。
 //
 //go:nosplit
-func fatalthrow() {
+func fatalthrow(msg string) {
 	pc := getcallerpc()
 	sp := getcallersp()
 	gp := getg()
 	// Switch to the system stack to avoid any stack growth, which
 	// may make things worse if the runtime is in a bad state.
 	systemstack(func() {
+		callCrashHandler(gp, msg, false, 0)
+
 		startpanic_m()
 
 		if dopanic_m(gp, pc, sp) {
@@ -1234,10 +1236,19 @@ func fatalpanic(msgs *_panic) {
 	pc := getcallerpc()
 	sp := getcallersp()
 	gp := getg()
+	recordGoroutineExit(gp.goid, GoroutineExitPanic)
 	var docrash bool
 	// Switch to the system stack to avoid any stack growth, which
 	// may make things worse if the runtime is in a bad state.
 	systemstack(func() {
+		var msg string
+		if msgs != nil {
+			// preprintpanics has turned errors and Stringers
+			// into strings.
+			msg, _ = msgs.arg.(string)
+		}
+		callCrashHandler(gp, msg, true, 0)
+
 		if startpanic_m() && msgs != nil {
 			// There were panic messages and startpanic_m
 			// says it's okay to try to print them.
@@ -1267,6 +1278,65 @@ func fatalpanic(msgs *_panic) {
 	*(*int)(nil) = 0 // not reached
 }
 
+// CrashInfo describes a fatal error of the program, passed to a
+// handler installed with SetCrashHandler.
+type CrashInfo struct {
+	Message string // error message, or panic value if a string, error or Stringer
+	Panic   bool   // whether the error is an unrecovered panic
+	Signal  int    // signal number, if the error is a fatal signal
+	Goid    int64  // ID of the goroutine that failed, or 0 for a system goroutine
+	StackLo uintptr
+	StackHi uintptr // bounds of the stack of the goroutine that failed
+}
+
+// crashHandler is the handler installed with SetCrashHandler.
+var crashHandler func(*CrashInfo)
+
+// crashHandlerCalled is set once crashHandler has been called.
+var crashHandlerCalled uint32
+
+// SetCrashHandler arranges for fn to be called when the program is
+// about to die of a fatal error, an unrecovered panic or a fatal
+// signal, before the runtime prints the goroutine stacks and exits.
+// This lets a program, or a supervisor of it, leave a note about the
+// crash, such as a file recording its message, where it can find it
+// after the process is gone.
+//
+// fn is called at most once, by the first thread to die, on that
+// thread's system stack and while other goroutines may still run.
+// As the runtime may be in a bad state, fn must not allocate, block,
+// take locks, use much stack or otherwise call into the runtime, and
+// should return promptly. It may make raw system calls with
+// syscall.RawSyscall, for example to write a file. The *CrashInfo is
+// only valid for the duration of the call. If fn itself fails, the
+// program dies as it would have without it. Passing nil removes the
+// handler.
+func SetCrashHandler(fn func(info *CrashInfo)) {
+	crashHandler = fn
+}
+
+// callCrashHandler calls the handler installed with SetCrashHandler,
+// unless it has been called already, for a fatal error of gp.
+//
+//go:nowritebarrierrec
+func callCrashHandler(gp *g, msg string, panicking bool, sig uint32) {
+	fn := crashHandler
+	if fn == nil || !atomic.Cas(&crashHandlerCalled, 0, 1) {
+		return
+	}
+	info := CrashInfo{
+		Message: msg,
+		Panic:   panicking,
+		Signal:  int(sig),
+	}
+	if gp != nil {
+		info.Goid = gp.goid
+		info.StackLo = gp.stack.lo
+		info.StackHi = gp.stack.hi
+	}
+	fn((*CrashInfo)(noescape(unsafe.Pointer(&info))))
+}
+
 // startpanic_m prepares for an unrecoverable panic.
 //
 // It returns true if panic messages should be printed, or false if
@@ -174,3 +174,72 @@ func TestMemoryProfiler(t *testing.T) {
 		}
 	})
 }
+
+//go:noinline
+func allocateDeep(depth int) {
+	if depth > 0 {
+		allocateDeep(depth - 1)
+		return
+	}
+	memSink = make([]byte, 1024)
+}
+
+func TestHeapProfileStackDepth(t *testing.T) {
+	oldRate := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() {
+		runtime.MemProfileRate = oldRate
+	}()
+	defer runtime.SetHeapProfileStackDepth(0)
+
+	// deepest returns the most allocateDeep frames in a stack of
+	// the heap profile that also reaches this test, and whether any
+	// stack made of allocateDeep frames stops short of it.
+	deepest := func() (n int, truncated bool) {
+		runtime.GC() // materialize stats
+		var buf bytes.Buffer
+		if err := Lookup("heap").WriteTo(&buf, 0); err != nil {
+			t.Fatalf("failed to write heap profile: %v", err)
+		}
+		p, err := profile.Parse(&buf)
+		if err != nil {
+			t.Fatalf("failed to parse heap profile: %v", err)
+		}
+		for _, sample := range p.Sample {
+			var deep int
+			var reached bool
+			for _, loc := range sample.Location {
+				for _, line := range loc.Line {
+					switch line.Function.Name {
+					case "runtime/pprof.allocateDeep":
+						deep++
+					case "runtime/pprof.TestHeapProfileStackDepth":
+						reached = true
+					}
+				}
+			}
+			if deep == 0 {
+				continue
+			}
+			if !reached {
+				truncated = true
+			} else if deep > n {
+				n = deep
+			}
+		}
+		return n, truncated
+	}
+
+	const depth = 60
+	allocateDeep(depth)
+	if _, truncated := deepest(); !truncated {
+		t.Fatal("allocation site deeper than the default stack depth was not truncated")
+	}
+
+	runtime.SetHeapProfileStackDepth(100)
+	allocateDeep(depth)
+	memSink = nil
+	if n, _ := deepest(); n != depth+1 {
+		t.Errorf("deepest complete stack has %d allocateDeep frames, want %d", n, depth+1)
+	}
+}
@@ -105,6 +105,7 @@ import (
 //	threadcreate - stack traces that led to the creation of new OS threads
 //	block        - stack traces that led to blocking on synchronization primitives
 //	mutex        - stack traces of holders of contended mutexes
+//	runtimelock  - stack traces of waiters for, and holders of, contended runtime-internal locks
 //
 // These predefined profiles maintain themselves and panic on an explicit
 // Add or Remove method call.
@@ -180,6 +181,12 @@ var mutexProfile = &Profile{
 	write: writeMutex,
 }
 
+var runtimeLockProfile = &Profile{
+	name:  "runtimelock",
+	count: countRuntimeLock,
+	write: writeRuntimeLock,
+}
+
 func lockProfiles() {
 	profiles.mu.Lock()
 	if profiles.m == nil {
@@ -191,6 +198,7 @@ func lockProfiles() {
 			"allocs":       allocsProfile,
 			"block":        blockProfile,
 			"mutex":        mutexProfile,
+			"runtimelock":  runtimeLockProfile,
 		}
 	}
 }
@@ -531,6 +539,20 @@ func countHeap() int {
 	return n
 }
 
+// memProfileByInUse sorts memory profile records, with their stacks,
+// by decreasing InUseBytes.
+type memProfileByInUse struct {
+	p    []runtime.MemProfileRecord
+	stks [][]uintptr
+}
+
+func (x *memProfileByInUse) Len() int { return len(x.p) }
+func (x *memProfileByInUse) Swap(i, j int) {
+	x.p[i], x.p[j] = x.p[j], x.p[i]
+	x.stks[i], x.stks[j] = x.stks[j], x.stks[i]
+}
+func (x *memProfileByInUse) Less(i, j int) bool { return x.p[i].InUseBytes() > x.p[j].InUseBytes() }
+
 // writeHeap writes the current runtime heap profile to w.
 func writeHeap(w io.Writer, debug int) error {
 	return writeHeapInternal(w, debug, "")
@@ -557,26 +579,31 @@ func writeHeapInternal(w io.Writer, debug int, defaultSampleType string) error {
 	// the two calls—so allocate a few extra records for safety
 	// and also try again if we're very unlucky.
 	// The loop should only execute one iteration in the common case.
+	// Use MemProfileStacks rather than MemProfile, so that stacks
+	// deeper than MemProfileRecord.Stack0 are written in full.
 	var p []runtime.MemProfileRecord
+	var stks [][]uintptr
 	n, ok := runtime.MemProfile(nil, true)
 	for {
 		// Allocate room for a slightly bigger profile,
 		// in case a few more entries have been added
 		// since the call to MemProfile.
 		p = make([]runtime.MemProfileRecord, n+50)
-		n, ok = runtime.MemProfile(p, true)
+		stks = make([][]uintptr, n+50)
+		n, ok = runtime.MemProfileStacks(p, stks, true)
 		if ok {
 			p = p[0:n]
+			stks = stks[0:n]
 			break
 		}
 		// Profile grew; try again.
 	}
 
 	if debug == 0 {
-		return writeHeapProto(w, p, int64(runtime.MemProfileRate), defaultSampleType)
+		return writeHeapProto(w, p, stks, int64(runtime.MemProfileRate), defaultSampleType)
 	}
 
-	sort.Slice(p, func(i, j int) bool { return p[i].InUseBytes() > p[j].InUseBytes() })
+	sort.Sort(&memProfileByInUse{p, stks})
 
 	b := bufio.NewWriter(w)
 	tw := tabwriter.NewWriter(b, 1, 8, 1, '\t', 0)
@@ -604,11 +631,11 @@ func writeHeapInternal(w io.Writer, debug int, defaultSampleType string) error {
 		fmt.Fprintf(w, "%d: %d [%d: %d] @",
 			r.InUseObjects(), r.InUseBytes(),
 			r.AllocObjects, r.AllocBytes)
-		for _, pc := range r.Stack() {
+		for _, pc := range stks[i] {
 			fmt.Fprintf(w, " %#x", pc)
 		}
 		fmt.Fprintf(w, "\n")
-		printStackRecord(w, r.Stack(), false)
+		printStackRecord(w, stks[i], false)
 	}
 
 	// Print memstats information too.
@@ -841,6 +868,13 @@ func countMutex() int {
 	return n
 }
 
+// countRuntimeLock returns the number of records in the runtime lock
+// profile.
+func countRuntimeLock() int {
+	n, _ := runtime.RuntimeLockProfile(nil)
+	return n
+}
+
 // writeBlock writes the current blocking profile to w.
 func writeBlock(w io.Writer, debug int) error {
 	var p []runtime.BlockProfileRecord
@@ -942,4 +976,46 @@ func scaleMutexProfile(cnt int64, ns float64) (int64, float64) {
 	return cnt * int64(period), ns * float64(period)
 }
 
+// writeRuntimeLock writes the current runtime lock profile to w.
+func writeRuntimeLock(w io.Writer, debug int) error {
+	var p []runtime.BlockProfileRecord
+	n, ok := runtime.RuntimeLockProfile(nil)
+	for {
+		p = make([]runtime.BlockProfileRecord, n+50)
+		n, ok = runtime.RuntimeLockProfile(p)
+		if ok {
+			p = p[:n]
+			break
+		}
+	}
+
+	sort.Slice(p, func(i, j int) bool { return p[i].Cycles > p[j].Cycles })
+
+	if debug <= 0 {
+		// The runtime scales the records for sampling.
+		return printCountCycleProfile(w, "contentions", "delay", scaleBlockProfile, p)
+	}
+
+	b := bufio.NewWriter(w)
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+	w = tw
+
+	fmt.Fprintf(w, "--- runtimelock:\n")
+	fmt.Fprintf(w, "cycles/second=%v\n", runtime_cyclesPerSecond())
+	for i := range p {
+		r := &p[i]
+		fmt.Fprintf(w, "%v %v @", r.Cycles, r.Count)
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(w, " %#x", pc)
+		}
+		fmt.Fprint(w, "\n")
+		printStackRecord(w, r.Stack(), true)
+	}
+
+	if tw != nil {
+		tw.Flush()
+	}
+	return b.Flush()
+}
+
 func runtime_cyclesPerSecond() int64
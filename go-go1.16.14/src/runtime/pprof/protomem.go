@@ -12,7 +12,8 @@ import (
 )
 
 // writeHeapProto writes the current heap profile in protobuf format to w.
-func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, rate int64, defaultSampleType string) error {
+// If stks is not nil, stks[i] is the stack of p[i].
+func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, stks [][]uintptr, rate int64, defaultSampleType string) error {
 	b := newProfileBuilder(w)
 	b.pbValueType(tagProfile_PeriodType, "space", "bytes")
 	b.pb.int64Opt(tagProfile_Period, rate)
@@ -26,10 +27,13 @@ func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, rate int64, defau
 
 	values := []int64{0, 0, 0, 0}
 	var locs []uint64
-	for _, r := range p {
+	for i, r := range p {
 		hideRuntime := true
 		for tries := 0; tries < 2; tries++ {
 			stk := r.Stack()
+			if stks != nil {
+				stk = stks[i]
+			}
 			// For heap profiles, all stack
 			// addresses are return PCs, which is
 			// what appendLocsForStack expects.
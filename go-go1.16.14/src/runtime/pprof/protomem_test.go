@@ -69,7 +69,7 @@ func TestConvertMemProfile(t *testing.T) {
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			if err := writeHeapProto(&buf, rec, rate, tc.defaultSampleType); err != nil {
+			if err := writeHeapProto(&buf, rec, nil, rate, tc.defaultSampleType); err != nil {
 				t.Fatalf("writing profile: %v", err)
 			}
 
@@ -288,6 +288,71 @@ func canPreemptM(mp *m) bool {
 	return mp.locks == 0 && mp.mallocing == 0 && mp.preemptoff == "" && mp.p.ptr().status == _Prunning
 }
 
+// CheckPreempt is an explicit preemption point. If the scheduler has
+// asked for the calling goroutine to be preempted, for example because
+// it has been running for too long or because the garbage collector
+// needs to scan its stack, CheckPreempt yields the processor as if by
+// Gosched (or suspends the goroutine until the collector is done with
+// it); otherwise it returns immediately.
+//
+// Goroutines are normally preempted at function calls or, on most
+// platforms, asynchronously. Long-running loops that make no calls can
+// call CheckPreempt to make sure they honor preemption requests
+// promptly on every platform, at the cost of a few loads per call.
+// MaybePreempt is a cheaper preemption point for hot loops.
+//
+// CheckPreempt is nosplit so that the check is its own rather than the
+// stack check in its prologue.
+//
+//go:nosplit
+func CheckPreempt() {
+	gp := getg()
+	if gp.stackguard0 != stackPreempt || !canPreemptM(gp.m) {
+		return
+	}
+	if gp.preemptStop {
+		mcall(preemptPark)
+	} else {
+		mcall(gopreempt_m)
+	}
+}
+
+// MaybePreempt is a cheaper explicit preemption point than
+// CheckPreempt, meant for code generators to put in hot loops. It
+// differs from CheckPreempt in two ways. Calls to MaybePreempt are
+// inlined, so when no preemption has been requested it costs one load
+// and one branch, where CheckPreempt costs a call. And when preemption
+// has been requested, MaybePreempt keeps the goroutine on the
+// processor's local run queue, so that it resumes on the same
+// processor after the goroutines already queued there, where
+// CheckPreempt, like Gosched, puts it on the global run queue, from
+// which any processor may take it.
+//
+//go:nosplit
+func MaybePreempt() {
+	if getg().preempt {
+		maybePreempt()
+	}
+}
+
+// maybePreempt is the slow path of MaybePreempt.
+//
+// It is nosplit because its stack check would preempt gp through
+// newstack instead.
+//
+//go:nosplit
+func maybePreempt() {
+	gp := getg()
+	if !gp.preempt || !canPreemptM(gp.m) {
+		return
+	}
+	if gp.preemptStop {
+		mcall(preemptPark)
+	} else {
+		mcall(goyield_m)
+	}
+}
+
 //go:generate go run mkpreempt.go
 
 // asyncPreempt saves all user registers and calls asyncPreempt2.
@@ -167,7 +167,7 @@ func main() {
 		throw("nanotime returning zero")
 	}
 
-	if debug.inittrace != 0 {
+	if debug.inittrace != 0 || debug.initbudget > 0 {
 		inittrace.id = getg().goid
 		inittrace.active = true
 	}
@@ -279,11 +279,84 @@ func forcegchelper() {
 		if debug.gctrace > 0 {
 			println("GC forced")
 		}
-		// Time-triggered, fully concurrent.
-		gcStart(gcTrigger{kind: gcTriggerTime, now: nanotime()})
+		// Time- or memory-limit-triggered, fully concurrent.
+		gcStart(gcTrigger{kind: forcegc.kind, now: nanotime()})
 	}
 }
 
+// autoProcsPeriod is the time in nanoseconds between sysmon's checks of
+// the cgroup CPU limit under GODEBUG=autogomaxprocs=1.
+const autoProcsPeriod = 1e9
+
+// autoProcs is the state of GODEBUG=autogomaxprocs=1. sysmon checks the
+// cgroup CPU limit every autoProcsPeriod, and if GOMAXPROCS no longer
+// matches it, wakes g to change GOMAXPROCS, which sysmon can't do
+// itself as it can't stop the world.
+var autoProcs struct {
+	enabled uint32 // set by schedinit
+	off     uint32 // set once the program calls GOMAXPROCS itself
+	idle    uint32 // g is parked waiting for sysmon
+	procs   uint32 // the GOMAXPROCS sysmon last woke g to set
+	last    int64  // nanotime of sysmon's last check; only used by sysmon
+	g       *g
+}
+
+// start the GOMAXPROCS updater goroutine
+func init() {
+	if atomic.Load(&autoProcs.enabled) != 0 {
+		go autoProcsHelper()
+	}
+}
+
+func autoProcsHelper() {
+	autoProcs.g = getg()
+	for {
+		gopark(autoProcsPark, nil, waitReasonAutoProcsIdle, traceEvGoBlock, 1)
+		// this goroutine is explicitly resumed by sysmon
+		stopTheWorldGC("GOMAXPROCS")
+		if n := int32(atomic.Load(&autoProcs.procs)); atomic.Load(&autoProcs.off) == 0 && n != gomaxprocs {
+			// newprocs will be processed by startTheWorld
+			newprocs = n
+		}
+		startTheWorldGC()
+	}
+}
+
+// autoProcsPark marks autoProcs.g idle once it is parked, so that
+// sysmon doesn't ready it before then.
+func autoProcsPark(gp *g, _ unsafe.Pointer) bool {
+	atomic.Store(&autoProcs.idle, 1)
+	return true
+}
+
+// autoProcsTarget returns the GOMAXPROCS that GODEBUG=autogomaxprocs=1
+// calls for: the cgroup CPU limit, if there is one below the number of
+// CPUs, or else the number of CPUs.
+func autoProcsTarget() int32 {
+	if n := cgroupCPULimit(); n > 0 && n < ncpu {
+		return n
+	}
+	return ncpu
+}
+
+// sysmonUpdateProcs wakes autoProcs.g if GOMAXPROCS doesn't match the
+// cgroup CPU limit.
+//
+//go:nowritebarrierrec
+func sysmonUpdateProcs() {
+	if atomic.Load(&autoProcs.off) != 0 {
+		return
+	}
+	n := autoProcsTarget()
+	if n == gomaxprocs || !atomic.Cas(&autoProcs.idle, 1, 0) {
+		return
+	}
+	atomic.Store(&autoProcs.procs, uint32(n))
+	var list gList
+	list.push(autoProcs.g)
+	injectglist(&list)
+}
+
 //go:nosplit
 
 // Gosched yields the processor, allowing other goroutines to run. It does not
@@ -294,6 +367,19 @@ func Gosched() {
 	mcall(gosched_m)
 }
 
+// YieldLocalQueue yields the processor like Gosched, but first moves
+// all goroutines waiting to run on the current processor to the queue
+// shared by all processors, behind any goroutines already there,
+// followed by the calling goroutine. Goroutines started or woken by a
+// goroutine are normally queued on its processor and run there ahead
+// of the shared queue, so a goroutine that produces many of them can
+// delay other work; YieldLocalQueue lets it hand them over to be run
+// in turn with that work, and by any processor.
+func YieldLocalQueue() {
+	checkTimeouts()
+	mcall(yieldLocalQueue_m)
+}
+
 // goschedguarded yields the processor like gosched, but also checks
 // for forbidden states and opts out of the yield in those cases.
 //go:nosplit
@@ -341,7 +427,10 @@ func gopark(unlockf func(*g, unsafe.Pointer) bool, lock unsafe.Pointer, reason w
 	gp.waitreason = reason       // 注释：设置锁的原因
 	mp.waittraceev = traceEv     // 注释：设置等待追踪事件类型
 	mp.waittraceskip = traceskip // 注释：跳过几级事件追踪结果
-	releasem(mp)                 // 注释：释放掉m
+	if gp.userWaitReason != 0 && reason.isUser() {
+		gp.waitreason = gp.userWaitReason
+	}
+	releasem(mp) // 注释：释放掉m
 	// can't do anything that might move the G between Ms here.
 	mcall(park_m) // 注释：保存现场，并且变更G的状态	casgstatus(gp, _Grunning, _Gwaiting)
 }
@@ -361,6 +450,130 @@ func goready(gp *g, traceskip int) {
 	})
 }
 
+// goreadyHandoff is goready for a goroutine woken by a channel
+// operation. Under GODEBUG=chanhandoff=1, the calling goroutine hands its
+// P directly to gp, as if gp had been put in runnext and the caller had
+// yielded, and is itself queued to run next. This saves a trip through
+// the run queue and a wakep for each message in request/response
+// exchanges. If the switch is not possible, it behaves like goready.
+func goreadyHandoff(gp *g, traceskip int) {
+	_g_ := getg()
+	mp := _g_.m
+	if debug.chanhandoff == 0 || trace.enabled || _g_ != mp.curg ||
+		mp.locks != 0 || mp.preemptoff != "" || mp.lockedg != 0 ||
+		gp.lockedm != 0 || mp.p.ptr().runSafePointFn != 0 ||
+		atomic.Load(&sched.gcwaiting) != 0 {
+		goready(gp, traceskip+1)
+		return
+	}
+	mp.handoffg.set(gp)
+	mcall(chanHandoff_m)
+}
+
+// chanHandoff_m switches from curg to mp.handoffg on g0.
+func chanHandoff_m(curg *g) {
+	_g_ := getg()
+	gp := _g_.m.handoffg.ptr()
+	_g_.m.handoffg = 0
+
+	if trace.enabled || atomic.Load(&sched.gcwaiting) != 0 {
+		// Tracing or a stop-the-world started since
+		// goreadyHandoff checked. Ready gp normally and
+		// carry on with curg.
+		ready(gp, 0, true)
+		gogo(&curg.sched)
+	}
+
+	if status := readgstatus(gp); status&^_Gscan != _Gwaiting {
+		dumpgstatus(gp)
+		throw("bad g->status in chanHandoff_m")
+	}
+	if fn := readyObserver; fn != nil {
+		fn(gp.goid, curg.goid)
+	}
+	if atomic.Load(&schedLatencyEnabled) != 0 {
+		gp.readyTime = nanotime()
+	}
+
+	casgstatus(curg, _Grunning, _Grunnable)
+	dropg()
+	runqput(_g_.m.p.ptr(), curg, true)
+	casgstatus(gp, _Gwaiting, _Grunnable)
+	execute(gp, true)
+}
+
+// sudogCacheSize is the capacity of each P's sudog cache. Accessed
+// atomically.
+var sudogCacheSize uint32 = uint32(len(p{}.sudogbuf))
+
+// sudogStats counts sudog allocations and the transfers between the
+// per-P sudog caches and the central one. Accessed atomically.
+var sudogStats struct {
+	allocs    uint64
+	transfers uint64
+	central   uint32 // sudogs on sched.sudogcache
+}
+
+//go:linkname setSudogCacheSize runtime/debug.setSudogCacheSize
+func setSudogCacheSize(in int) (out int) {
+	if in < 1 {
+		in = len(p{}.sudogbuf)
+	} else if in < 2 {
+		in = 2
+	} else if in > 1<<16 {
+		in = 1 << 16
+	}
+	return int(atomic.Xchg(&sudogCacheSize, uint32(in)))
+}
+
+//go:linkname readSudogStats runtime/debug.readSudogStats
+func readSudogStats() (central int, allocs, transfers uint64) {
+	return int(atomic.Load(&sudogStats.central)), atomic.Load64(&sudogStats.allocs), atomic.Load64(&sudogStats.transfers)
+}
+
+// resizeSudogCache gives pp's sudog cache the capacity set by
+// setSudogCacheSize, moving the sudogs that don't fit, and those
+// above half of the new capacity, to the central cache.
+func (pp *p) resizeSudogCache() {
+	n := int(atomic.Load(&sudogCacheSize))
+	old := pp.sudogcache
+	keep := len(old)
+	if keep > n/2 {
+		keep = n / 2
+	}
+	if keep < len(old) {
+		var first, last *sudog
+		for _, s := range old[keep:] {
+			if first == nil {
+				first = s
+			} else {
+				last.next = s
+			}
+			last = s
+		}
+		lock(&sched.sudoglock)
+		last.next = sched.sudogcache
+		sched.sudogcache = first
+		unlock(&sched.sudoglock)
+		atomic.Xadd(&sudogStats.central, int32(len(old)-keep))
+		atomic.Xadd64(&sudogStats.transfers, 1)
+	}
+	var cache []*sudog
+	inbuf := 0
+	if n <= len(pp.sudogbuf) {
+		cache = pp.sudogbuf[:0:n]
+		inbuf = keep
+	} else {
+		cache = make([]*sudog, 0, n)
+	}
+	cache = append(cache, old[:keep]...)
+	// Don't let the unused part of sudogbuf keep sudogs alive.
+	for i := inbuf; i < len(pp.sudogbuf); i++ {
+		pp.sudogbuf[i] = nil
+	}
+	pp.sudogcache = cache
+}
+
 // 注释：获取空闲带阻塞G
 // 注释：如果当前P中空闲G列表存在，并且全局空闲G有数据时。(去全局空闲G链表中拿出P中的空闲G总数的一半)
 // 注释：步骤：
@@ -386,6 +599,9 @@ func acquireSudog() *sudog {
 	//		通过围绕新事物（sudog）进行获取/发布来打破循环。acquirem/releasem在new（sudog）过程中增加m.locks，从而防止垃圾收集器被调用。
 	mp := acquirem() // 注释：获得当前的M（当前G对应的M）对象
 	pp := mp.p.ptr() // 注释：当前M对应的P指针
+	if cap(pp.sudogcache) != int(atomic.Load(&sudogCacheSize)) {
+		pp.resizeSudogCache()
+	}
 
 	// 注释：
 	// 注释：如果当前P没有空闲的G时
@@ -400,10 +616,13 @@ func acquireSudog() *sudog {
 			s.next = nil                             // 注释：取出的空闲G断开链表（形成单独的空闲G）
 			pp.sudogcache = append(pp.sudogcache, s) // 注释：把从全局空闲G链表取出的单个空闲G放到当前P的列表中
 		}
+		atomic.Xadd(&sudogStats.central, -int32(len(pp.sudogcache)))
+		atomic.Xadd64(&sudogStats.transfers, 1)
 		unlock(&sched.sudoglock) // 注释：释放全局空闲G链表的锁
 		// If the central cache is empty, allocate a new one.
 		// 注释：如果当前P中依然没有空闲G，则实例化新的空闲G指针放在P中(后面会取出一个)
 		if len(pp.sudogcache) == 0 {
+			atomic.Xadd64(&sudogStats.allocs, 1)
 			pp.sudogcache = append(pp.sudogcache, new(sudog))
 		}
 	}
@@ -445,6 +664,9 @@ func releaseSudog(s *sudog) {
 	}
 	mp := acquirem() // 注释：获取当前对应的M(避免重新安排到另一个P) // avoid rescheduling to another P
 	pp := mp.p.ptr() // 注释：获取当前对应P
+	if cap(pp.sudogcache) != int(atomic.Load(&sudogCacheSize)) {
+		pp.resizeSudogCache()
+	}
 	// 注释：如果空前G缓存区已经满了，将一半的本地缓存传输到中央缓存（全局空闲G链表）。
 	if len(pp.sudogcache) == cap(pp.sudogcache) {
 		// Transfer half of local cache to the central cache.
@@ -463,6 +685,8 @@ func releaseSudog(s *sudog) {
 			}
 			last = p // 注释：重新赋值链表尾部
 		}
+		atomic.Xadd(&sudogStats.central, int32(cap(pp.sudogcache)-len(pp.sudogcache)))
+		atomic.Xadd64(&sudogStats.transfers, 1)
 		lock(&sched.sudoglock)       // 注释：中央缓存（全局空闲G单向链表）上锁
 		last.next = sched.sudogcache // 注释：把中央缓存（全局空闲G单向链表）接到临时链表链的尾部
 		sched.sudogcache = first     // 注释：重置中央缓存（全局空闲G单向链表）的头指针
@@ -662,6 +886,8 @@ func schedinit() {
 	lockInit(&trace.lock, lockRankTrace)
 	lockInit(&cpuprof.lock, lockRankCpuprof)
 	lockInit(&trace.stackTab.lock, lockRankTraceStackTab)
+	lockInit(&timeSlices.lock, lockRankTimeSlices)
+	lockInit(&coarseTimers.lock, lockRankCoarseTimers)
 	// Enforce that this lock is always a leaf lock.
 	// All of this lock's critical sections should be
 	// extremely short.
@@ -681,7 +907,9 @@ func schedinit() {
 
 	moduledataverify()
 	stackinit()
-	mallocinit()   // 注释：内存分配初始化
+	heapReserveInit()
+	mallocinit() // 注释：内存分配初始化
+	heapHintInit()
 	fastrandinit() // must run before mcommoninit
 	mcommoninit(_g_.m, -1)
 	cpuinit()       // must run before alginit
@@ -697,13 +925,25 @@ func schedinit() {
 	goenvs()
 	parsedebugvars()
 	gcinit()
+	numaSteal = debug.numasteal > 0 && numaNodes > 1
+	numaHeap.enabled = debug.numaheap > 0 && numaNodes > 1 && numaNodes <= maxPageNodes
+	hugePagesInit()
+	if debug.wakepdelay > 0 {
+		wakepDelay = int64(debug.wakepdelay) * 1000
+	}
 
 	lock(&sched.lock)
 	sched.lastpoll = uint64(nanotime())
+	sched.busySince = sched.lastpoll
 	procs := ncpu // 注释：确认P的个数,默认等于cpu个数，可以通过GOMAXPROCS环境变量更改
 	if n, ok := atoi32(gogetenv("GOMAXPROCS")); ok && n > 0 {
 		procs = n
 	}
+	if debug.autogomaxprocs > 0 && gogetenv("GOMAXPROCS") == "" {
+		atomic.Store(&autoProcs.enabled, 1)
+		cgroupCPUInit()
+		procs = autoProcsTarget()
+	}
 	// 注释：调整P的个数，这里是新分配procs个P
 	// 注释：函数procresize很重要，所有的P都是从这里分配的，以后也不用担心没有P了
 	if procresize(procs) != nil {
@@ -768,6 +1008,9 @@ func mReserveID() int64 {
 	id := sched.mnext
 	sched.mnext++
 	checkmcount()
+	if n := mcount(); n > sched.mpeak {
+		sched.mpeak = n
+	}
 	return id
 }
 
@@ -787,6 +1030,7 @@ func mcommoninit(mp *m, id int64) {
 	} else {
 		mp.id = mReserveID()
 	}
+	mSetName(mp)
 
 	mp.fastrand[0] = uint32(int64Hash(uint64(mp.id), fastrandseed))       // 注释：计算第一个随机数(利用M的ID和随机种子做的哈希)
 	mp.fastrand[1] = uint32(int64Hash(uint64(cputicks()), ^fastrandseed)) // 注释：计算第二个随机数(利用CPU时钟周期计数器和随机种子的按位取反做的哈希)
@@ -821,6 +1065,63 @@ func fastrandinit() {
 	getRandomData(s)
 }
 
+// threadNamePrefix is the prefix of thread names set by SetThreadName.
+// Protected by sched.lock.
+var threadNamePrefix string
+
+// SetThreadName names the operating system threads that run the Go
+// program, other than the main thread, prefix followed by the ID the
+// runtime gives the thread, as in "worker-3", so that they can be told
+// apart in tools such as top, debuggers and profilers. The names are
+// also shown in GODEBUG=schedtrace=X,scheddetail=1 output and in the
+// headers of running goroutines in tracebacks. The operating system
+// may limit the length of the names: Linux truncates the prefix to
+// leave room for the ID within 15 bytes. An empty prefix stops naming
+// new threads, but doesn't change existing threads' names. Threads
+// created outside Go that call into Go through cgo keep their names.
+//
+// On Linux, SetThreadName renames existing threads as well as naming
+// threads created later. On Darwin, threads can only name themselves,
+// so it names the calling thread and threads created later. On other
+// systems, the names are only recorded for the runtime's own output.
+func SetThreadName(prefix string) {
+	lock(&sched.lock)
+	threadNamePrefix = prefix
+	for mp := allm; mp != nil; mp = mp.alllink {
+		mSetName(mp)
+	}
+	unlock(&sched.lock)
+	if prefix == "" {
+		return
+	}
+	for mp := (*m)(atomic.Loadp(unsafe.Pointer(&allm))); mp != nil; mp = mp.alllink {
+		osSetThreadName(mp)
+	}
+}
+
+// mSetName records the name of mp from threadNamePrefix and mp's ID,
+// for osSetThreadName to give to its thread. The main thread keeps the
+// program's name, and so do the non-Go threads extra Ms run on.
+//
+// sched.lock must be held.
+func mSetName(mp *m) {
+	assertLockHeld(&sched.lock)
+
+	if threadNamePrefix == "" || mp == &m0 || mp.isextra {
+		mp.name[0] = 0
+		return
+	}
+	var buf [20]byte
+	id := itoa(buf[:], uint64(mp.id))
+	n := len(mp.name) - 1 - len(id)
+	if n > len(threadNamePrefix) {
+		n = len(threadNamePrefix)
+	}
+	copy(mp.name[:], threadNamePrefix[:n])
+	copy(mp.name[n:], id)
+	mp.name[n+len(id)] = 0
+}
+
 // Mark gp ready to run.
 // 注释：译：标记gp准备运行。
 // 注释：准备下一个要执行G，并且开启一个空闲M跑空闲P
@@ -846,15 +1147,82 @@ func ready(gp *g, traceskip int, next bool) {
 		dumpgstatus(gp)                 // 注释：打印日志
 		throw("bad g->status in ready") // 注释：报错
 	}
+	if fn := readyObserver; fn != nil {
+		var by int64
+		if curg := _g_.m.curg; curg != nil {
+			by = curg.goid
+		}
+		fn(gp.goid, by)
+	}
+	if atomic.Load(&schedLatencyEnabled) != 0 {
+		gp.readyTime = nanotime()
+	}
 
 	// status is Gwaiting or Gscanwaiting, make Grunnable and put on runq
 	// 注释：译：状态为Gwaiting或Gscanwaiting，使Grunable变为runq
 	casgstatus(gp, _Gwaiting, _Grunnable) // 注释：如果gp状态是_Gwaiting时并更状态为_Grunnable
 	runqput(_g_.m.p.ptr(), gp, next)      // 注释：把G放到本地P队列里，如果next是true则下一个就执行gp
-	wakep()                               // 注释：拿个空闲M线程运行空闲P，并且自旋，开始抢别的G了
+	readyWakep()                          // 注释：拿个空闲M线程运行空闲P，并且自旋，开始抢别的G了
 	releasem(mp)                          // 注释：释放禁止抢占(典型的自己不让抢，启动一个空闲P去抢别人的哈)
 }
 
+// wakepDelay is GODEBUG=wakepdelay in nanoseconds.
+var wakepDelay int64
+
+// wakepPending is the nanotime() at which readyWakep left a call to
+// wakep to sysmon, or 0 if there is none. Accessed atomically.
+var wakepPending uint64
+
+// readyWakep is ready's call to wakep. Under GODEBUG=wakepdelay=N, it
+// leaves the call to sysmon, which makes it N microseconds after the
+// first of a burst of ready calls, so that the burst wakes one M
+// instead of waking and parking M's for each call.
+func readyWakep() {
+	if wakepDelay == 0 || atomic.Load(&sched.sysmonwait) != 0 {
+		// sysmon is asleep and won't make the call in time.
+		wakep()
+		return
+	}
+	if atomic.Load(&sched.npidle) == 0 || atomic.Load(&sched.nmspinning) != 0 {
+		return
+	}
+	if atomic.Load64(&wakepPending) == 0 {
+		atomic.Cas64(&wakepPending, 0, uint64(nanotime()))
+	}
+}
+
+// sysmonWakep makes the call to wakep left by readyWakep, once it is
+// wakepDelay old.
+//
+//go:nowritebarrierrec
+func sysmonWakep(now int64) {
+	t := atomic.Load64(&wakepPending)
+	if t != 0 && now-int64(t) >= wakepDelay && atomic.Cas64(&wakepPending, t, 0) {
+		wakep()
+	}
+}
+
+// readyObserver, if non-nil, is called by ready for each goroutine it
+// makes runnable.
+var readyObserver func(goid, byGoid int64)
+
+// SetReadyObserver arranges for fn to be called each time a blocked
+// goroutine is made runnable again, for example by a channel operation,
+// a mutex unlock or a timer, reporting the ID of the goroutine woken
+// and of the goroutine that woke it. byGoid is 0 if the wakeup did not
+// come from a goroutine, for instance when the scheduler itself readies
+// a goroutine whose network I/O completed. Together the calls describe
+// which goroutines wake which, for tracing causality in concurrent
+// code.
+//
+// fn is called on a hot path of the scheduler, on the system stack
+// with preemption disabled. It must not allocate, block or otherwise
+// call into the runtime, and should do as little as possible. Passing
+// nil removes the observer.
+func SetReadyObserver(fn func(goid, byGoid int64)) {
+	readyObserver = fn
+}
+
 // freezeStopWait is a large value that freezetheworld sets
 // sched.stopwait to in order to request that all Gs permanently stop.
 // 注释：freezetheworld是一个很大的值，freezetheworld将sched.stopwait设置为，以请求永久停止所有G。
@@ -1051,6 +1419,7 @@ func stopTheWorld(reason string) {
 	semacquire(&worldsema)
 	gp := getg()
 	gp.m.preemptoff = reason
+	stwPause.reason = reason
 	systemstack(func() {
 		// Mark the goroutine which called stopTheWorld preemptible so its
 		// stack may be scanned.
@@ -1149,17 +1518,20 @@ func stopTheWorldWithSema() {
 		throw("stopTheWorld: holding locks")
 	}
 
+	stwPause.start = nanotime()
 	lock(&sched.lock)
 	sched.stopwait = gomaxprocs
 	atomic.Store(&sched.gcwaiting, 1)
 	preemptall()
 	// stop current P
 	_g_.m.p.ptr().status = _Pgcstop // Pgcstop is only diagnostic.
+	pStatusChanged(_g_.m.p.ptr(), _Prunning, _Pgcstop)
 	sched.stopwait--
 	// try to retake all P's in Psyscall status
 	for _, p := range allp {
 		s := p.status
 		if s == _Psyscall && atomic.Cas(&p.status, s, _Pgcstop) {
+			pStatusChanged(p, _Psyscall, _Pgcstop)
 			if trace.enabled {
 				traceGoSysBlock(p)
 				traceProcStop(p)
@@ -1175,6 +1547,7 @@ func stopTheWorldWithSema() {
 			break
 		}
 		p.status = _Pgcstop
+		pStatusChanged(p, _Pidle, _Pgcstop)
 		sched.stopwait--
 	}
 	wait := sched.stopwait > 0
@@ -1223,7 +1596,7 @@ func startTheWorldWithSema(emitTraceEvent bool) int64 {
 
 	mp := acquirem() // disable preemption because it can be holding p in a local var
 	if netpollinited() {
-		list := netpoll(0) // non-blocking
+		list := netpollCounted(0) // non-blocking
 		injectglist(&list)
 	}
 	lock(&sched.lock)
@@ -1273,9 +1646,60 @@ func startTheWorldWithSema(emitTraceEvent bool) int64 {
 
 	releasem(mp)
 
+	if fn := stwObserver; fn != nil {
+		if pause := startTime - stwPause.start; pause > int64(atomic.Load64(&stwPauseWarnThreshold)) {
+			fn(stwPause.reason, pause)
+		}
+	}
+
 	return startTime
 }
 
+// stwPause describes the most recent stop-the-world pause. It is
+// protected by worldsema.
+var stwPause struct {
+	reason string // why the world was stopped
+	start  int64  // nanotime() when stopTheWorldWithSema began
+}
+
+// stwPauseWarnThreshold is the pause length, in nanoseconds, a
+// stop-the-world pause must exceed to be reported to stwObserver.
+var stwPauseWarnThreshold uint64
+
+// stwObserver, if non-nil, is called by startTheWorldWithSema for
+// pauses longer than stwPauseWarnThreshold.
+var stwObserver func(reason string, nanos int64)
+
+// SetSTWPauseWarnThreshold sets the length, in nanoseconds, a
+// stop-the-world pause must exceed to be reported to the observer
+// installed by SetSTWObserver, so that it is only told about
+// pathologically long pauses. ns <= 0 reports every pause, which is
+// the default.
+func SetSTWPauseWarnThreshold(ns int64) {
+	if ns < 0 {
+		ns = 0
+	}
+	atomic.Store64(&stwPauseWarnThreshold, uint64(ns))
+}
+
+// SetSTWObserver arranges for fn to be called each time the world is
+// restarted after a stop-the-world pause longer than the threshold set
+// by SetSTWPauseWarnThreshold. fn is passed the reason the world was
+// stopped, such as "GC sweep termination" or "GOMAXPROCS", and the
+// length of the pause in nanoseconds. The pause is measured from the
+// moment the runtime starts stopping the world, so it includes the
+// time taken to bring every P (logical processor) to a halt.
+//
+// fn is called after the world has been restarted, so it does not
+// lengthen the pause, but it runs on the system stack of the thread
+// that restarted the world, possibly while the garbage collector has
+// write barriers disabled. It must not allocate, write pointers to the
+// heap, block or otherwise call into the runtime. Passing nil removes
+// the observer.
+func SetSTWObserver(fn func(reason string, nanos int64)) {
+	stwObserver = fn
+}
+
 // usesLibcall indicates whether this runtime performs system calls
 // via libcall.
 func usesLibcall() bool {
@@ -1404,6 +1828,9 @@ func mstartm0() {
 	if (iscgo || GOOS == "windows") && !cgoHasExtraM {
 		cgoHasExtraM = true
 		newextram()
+		if debug.extram > 0 {
+			growExtraM(uint32(debug.extram))
+		}
 	}
 	initsig(false) // 注释：初始化信号
 }
@@ -1484,19 +1911,18 @@ func mexit(osStack bool) {
 	}
 	throw("m not found in allm")
 found:
-	if !osStack {
-		// Delay reaping m until it's done with the stack.
-		//
-		// If this is using an OS stack, the OS will free it
-		// so there's no need for reaping.
-		atomic.Store(&m.freeWait, 1)
-		// Put m on the free list, though it will not be reaped until
-		// freeWait is 0. Note that the free list must not be linked
-		// through alllink because some functions walk allm without
-		// locking, so may be using alllink.
-		m.freelink = sched.freem
-		sched.freem = m
-	}
+	// Delay reaping m until it's done with the stack.
+	//
+	// Put m on the free list, though it will not be reaped while
+	// freeWait is freeMWait. m is no longer reachable via allm, so
+	// even if it is on an OS stack, we must keep a reference to m
+	// alive so that the GC doesn't free m while we are still using
+	// it. Note that the free list must not be linked through alllink
+	// because some functions walk allm without locking, so may be
+	// using alllink.
+	atomic.Store(&m.freeWait, freeMWait)
+	m.freelink = sched.freem
+	sched.freem = m
 	unlock(&sched.lock)
 
 	// Release the P.
@@ -1524,15 +1950,18 @@ found:
 	mdestroy(m)
 
 	if osStack {
+		// No more uses of m, so it is OK to drop the reference.
+		atomic.Store(&m.freeWait, freeMRef)
+
 		// Return from mstart and let the system thread
 		// library free the g0 stack and terminate the thread.
 		return
 	}
 
 	// mstart is the thread's entry point, so there's nothing to
-	// return to. Exit the thread directly. exitThread will clear
-	// m.freeWait when it's done with the stack and the m can be
-	// reaped.
+	// return to. Exit the thread directly. exitThread will set
+	// m.freeWait to freeMStack when it's done with the stack and
+	// the m can be reaped.
 	exitThread(&m.freeWait)
 }
 
@@ -1590,6 +2019,7 @@ func forEachP(fn func(*p)) {
 	for _, p := range allp {
 		s := p.status
 		if s == _Psyscall && p.runSafePointFn == 1 && atomic.Cas(&p.status, s, _Pidle) {
+			pStatusChanged(p, _Psyscall, _Pidle)
 			if trace.enabled {
 				traceGoSysBlock(p)
 				traceProcStop(p)
@@ -1641,17 +2071,32 @@ func forEachP(fn func(*p)) {
 // single, coordinating, m, and only if it returns true does it go on
 // to invoke fn(false) on all of the other m's known to the process.
 //
+// With cgo, that is only best effort. The threads of extra m's, and
+// of m's running C code, may not come back to the runtime to park
+// while the world is stopped, so they are signaled to invoke fn(false)
+// from the signal handler instead. Before invoking fn anywhere, it
+// waits for all of them to hold in their signal handlers. If some have
+// not done so within allThreadsSignalTimeout, for instance because they
+// block signals, it invokes fn on no thread at all, not even the
+// coordinating one, and returns false. That way the threads never end
+// up in different states, such as with different credentials.
+// A thread created by C is covered only while it has an extra m: while
+// it runs a call into Go, or, if dropm bound the m to it, until it
+// exits. Others are not known to the runtime at all.
+//
 //go:linkname syscall_runtime_doAllThreadsSyscall syscall.runtime_doAllThreadsSyscall
-func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
-	if iscgo {
-		panic("doAllThreadsSyscall not supported with cgo enabled")
-	}
+func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) bool {
 	if fn == nil {
-		return
+		return true
 	}
 	for atomic.Load(&sched.sysmonStarting) != 0 {
 		osyield()
 	}
+	observer := allThreadsSyscallObserver
+	var start int64
+	if observer != nil {
+		start = nanotime()
+	}
 
 	// We don't want this thread to handle signals for the
 	// duration of this critical section. The underlying issue
@@ -1681,7 +2126,7 @@ func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
 		unlock(&newmHandoff.lock)
 	}
 	if netpollinited() {
-		netpollBreak()
+		netpollBreakCounted()
 	}
 	sigRecvPrepareForFixup()
 	_g_ := getg()
@@ -1692,8 +2137,20 @@ func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
 		mFixupRace.ctx = _g_.racectx
 		unlock(&mFixupRace.lock)
 	}
-	if ok := fn(true); ok {
-		tid := _g_.m.procid
+	tid := _g_.m.procid
+	threads, held := 1, true
+	var extraHead *m
+	if iscgo {
+		// Keep C threads from taking extra m's, or giving them
+		// back, until we are done, so that the threads we hold
+		// below are all the threads with m's.
+		extraHead = lockextra(true)
+		held = holdAllThreads(tid)
+		if !held {
+			threads = 0
+		}
+	}
+	if held && fn(true) {
 		for mp := allm; mp != nil; mp = mp.alllink {
 			if mp.procid == tid {
 				// This m has already completed fn()
@@ -1708,10 +2165,14 @@ func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
 			// them with the need to execute the fn when
 			// they acquire a procid to run it.
 			if mp.procid == 0 && !mp.doesPark {
-				// Reaching here, we are either
-				// running Windows, or cgo linked
-				// code. Neither of which are
-				// currently supported by this API.
+				if mp.isextra {
+					// mp is on the extra list, and
+					// has no thread.
+					continue
+				}
+				// Reaching here, we are running
+				// Windows, which is not currently
+				// supported by this API.
 				throw("unsupported runtime environment")
 			}
 			// stopTheWorldGC() doesn't guarantee stopping
@@ -1720,7 +2181,8 @@ func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
 			lock(&mp.mFixup.lock)
 			mp.mFixup.fn = fn
 			atomic.Store(&mp.mFixup.used, 1)
-			if mp.doesPark {
+			threads++
+			if !mp.mFixup.signal && mp.doesPark {
 				// For non-service threads this will
 				// cause the wakeup to be short lived
 				// (once the mutex is unlocked). The
@@ -1730,13 +2192,23 @@ func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
 			}
 			unlock(&mp.mFixup.lock)
 		}
+		// Let the threads holding in their signal handlers run fn.
+		atomic.Store(&allThreadsRelease, allThreadsApply)
 		for {
 			done := true
-			for mp := allm; done && mp != nil; mp = mp.alllink {
+			for mp := allm; mp != nil; mp = mp.alllink {
 				if mp.procid == tid {
 					continue
 				}
-				done = atomic.Load(&mp.mFixup.used) == 0
+				if mp.isextra && mp.procid == 0 {
+					// dropm has released mp, after
+					// running fn if it was set by then.
+					continue
+				}
+				if atomic.Load(&mp.mFixup.used) != 0 {
+					done = false
+					break
+				}
 			}
 			if done {
 				break
@@ -1757,6 +2229,10 @@ func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
 			osyield()
 		}
 	}
+	if iscgo {
+		releaseAllThreads()
+		unlockextra(extraHead)
+	}
 	if raceenabled {
 		lock(&mFixupRace.lock)
 		mFixupRace.ctx = 0
@@ -1765,6 +2241,165 @@ func syscall_runtime_doAllThreadsSyscall(fn func(bool) bool) {
 	startTheWorldGC()
 	msigrestore(sigmask)
 	unlockOSThread()
+	if observer != nil {
+		observer(threads, nanotime()-start)
+	}
+	return held
+}
+
+// allThreadsSignalTimeout is how long, in nanoseconds,
+// syscall_runtime_doAllThreadsSyscall waits for the threads it
+// signals to hold in their signal handlers, with the world stopped,
+// before giving up.
+const allThreadsSignalTimeout = 100 * 1000 * 1000 // 100ms
+
+// allThreadsRelease tells the threads holding in their signal handlers
+// for syscall_runtime_doAllThreadsSyscall whether to run their fixup.
+// Accessed atomically.
+var allThreadsRelease uint32
+
+const (
+	allThreadsHold  = iota // keep holding
+	allThreadsApply        // run the fixup, if any, and return
+	allThreadsAbort        // return without running anything
+)
+
+// Values of m.mFixup.hold.
+const (
+	mHoldNone      = iota // not asked to hold
+	mHoldRequested        // signaled to hold
+	mHoldHeld             // holding in its signal handler
+	mHoldDone             // released, and no longer looking at allThreadsRelease
+)
+
+// holdAllThreads signals the threads of extra m's, and of m's running
+// C code, other than the thread with ID tid, and waits for all of them
+// to hold in their signal handlers, in mHoldFixup. Those threads don't
+// come back to the runtime while the world is stopped, unlike the
+// others, so fn could not otherwise be run on them. It reports false,
+// without waiting further, if some of the threads have not done so
+// within allThreadsSignalTimeout, for instance because they block
+// signals. releaseAllThreads must be called after it either way.
+//
+// The world must be stopped and the extra m list locked.
+func holdAllThreads(tid uint64) bool {
+	atomic.Store(&allThreadsRelease, allThreadsHold)
+	for mp := allm; mp != nil; mp = mp.alllink {
+		if mp.procid == tid || mp.procid == 0 || !(mp.isextra || mp.incgo) {
+			continue
+		}
+		lock(&mp.mFixup.lock)
+		mp.mFixup.signal = true
+		atomic.Store(&mp.mFixup.hold, mHoldRequested)
+		unlock(&mp.mFixup.lock)
+		signalFixupM(mp)
+	}
+	firstSignal := nanotime()
+	lastSignal := firstSignal
+	for {
+		done := true
+		for mp := allm; mp != nil; mp = mp.alllink {
+			if mp.isextra && mp.procid == 0 {
+				// dropm has released mp.
+				continue
+			}
+			if atomic.Load(&mp.mFixup.hold) == mHoldRequested {
+				done = false
+				break
+			}
+		}
+		if done {
+			return true
+		}
+		now := nanotime()
+		if now-firstSignal > allThreadsSignalTimeout {
+			return false
+		}
+		// Signals may be blocked, so send them again every so
+		// often.
+		if now-lastSignal > 1e6 {
+			lastSignal = now
+			for mp := allm; mp != nil; mp = mp.alllink {
+				if mp.procid != 0 && atomic.Load(&mp.mFixup.hold) == mHoldRequested {
+					signalFixupM(mp)
+				}
+			}
+		}
+		osyield()
+	}
+}
+
+// releaseAllThreads lets go of the threads holdAllThreads signaled,
+// telling those still holding to return without running anything,
+// unless allThreadsRelease says otherwise, and clears their state,
+// so that later signals to them do nothing.
+//
+// The world must be stopped and the extra m list locked.
+func releaseAllThreads() {
+	atomic.Cas(&allThreadsRelease, allThreadsHold, allThreadsAbort)
+	for mp := allm; mp != nil; mp = mp.alllink {
+		if !atomic.Cas(&mp.mFixup.hold, mHoldRequested, mHoldNone) {
+			// Wait for mp to stop looking at
+			// allThreadsRelease.
+			for atomic.Load(&mp.mFixup.hold) == mHoldHeld {
+				osyield()
+			}
+		}
+		lock(&mp.mFixup.lock)
+		// Drop the fn left on extra m's released before they
+		// ran it, so that threads acquiring them later don't.
+		mp.mFixup.fn = nil
+		atomic.Store(&mp.mFixup.used, 0)
+		mp.mFixup.signal = false
+		atomic.Store(&mp.mFixup.hold, mHoldNone)
+		unlock(&mp.mFixup.lock)
+	}
+}
+
+// mHoldFixup is called by the signal handler of a thread signaled by
+// holdAllThreads. It holds the thread there until
+// syscall_runtime_doAllThreadsSyscall either lets it run its fixup or
+// gives up.
+//
+//go:nosplit
+//go:nowritebarrierrec
+func mHoldFixup() {
+	mp := getg().m
+	if !atomic.Cas(&mp.mFixup.hold, mHoldRequested, mHoldHeld) {
+		// Not asked to, or already did.
+		return
+	}
+	for {
+		switch atomic.Load(&allThreadsRelease) {
+		case allThreadsHold:
+			osyield()
+			continue
+		case allThreadsApply:
+			mDoFixup()
+		}
+		break
+	}
+	atomic.Store(&mp.mFixup.hold, mHoldDone)
+}
+
+// allThreadsSyscallObserver, if non-nil, is called at the end of each
+// syscall_runtime_doAllThreadsSyscall.
+var allThreadsSyscallObserver func(threadCount int, nanos int64)
+
+// SetAllThreadsSyscallObserver arranges for fn to be called each time
+// the runtime finishes running a system call on every thread, as done
+// by syscall.AllThreadsSyscall. fn is passed the number of threads the
+// call was run on, including the coordinating thread, and the total
+// time in nanoseconds the operation took, most of it with the world
+// stopped. If the call failed on the coordinating thread, it is not run
+// on the other threads and the count is 1. If some threads of a cgo
+// binary did not respond in time, it is not run at all and the count
+// is 0.
+//
+// fn is called on the goroutine that made the call, after the world
+// has been restarted. Passing nil removes the observer.
+func SetAllThreadsSyscallObserver(fn func(threadCount int, nanos int64)) {
+	allThreadsSyscallObserver = fn
 }
 
 // runSafePointFn runs the safe point function, if any, for this P.
@@ -1831,19 +2466,25 @@ func allocm(_p_ *p, fn func(), id int64) *m {
 		lock(&sched.lock)
 		var newList *m
 		for freem := sched.freem; freem != nil; {
-			if freem.freeWait != 0 {
+			wait := atomic.Load(&freem.freeWait)
+			if wait == freeMWait {
 				next := freem.freelink
 				freem.freelink = newList
 				newList = freem
 				freem = next
 				continue
 			}
-			// stackfree must be on the system stack, but allocm is
-			// reachable off the system stack transitively from
-			// startm.
-			systemstack(func() {
-				stackfree(freem.g0.stack)
-			})
+			// Free the stack if needed. For freeMRef, there is
+			// nothing to do except drop freem from the sched.freem
+			// list.
+			if wait == freeMStack {
+				// stackfree must be on the system stack, but allocm is
+				// reachable off the system stack transitively from
+				// startm.
+				systemstack(func() {
+					stackfree(freem.g0.stack)
+				})
+			}
 			freem = freem.freelink
 		}
 		sched.freem = newList
@@ -1943,7 +2584,13 @@ func needm() {
 	// running at all (that is, there's no garbage collection
 	// running right now).
 	mp.needextram = mp.schedlink == 0
+	if mp.needextram {
+		atomic.Xadd64(&extraMMisses, 1)
+	} else {
+		atomic.Xadd64(&extraMHits, 1)
+	}
 	extraMCount--
+	extra := int32(extraMCount)
 	unlockextra(mp.schedlink.ptr())
 
 	// Store the original signal mask for use by minit.
@@ -1967,6 +2614,31 @@ func needm() {
 	// mp.curg is now a real goroutine.
 	casgstatus(mp.curg, _Gdead, _Gsyscall)
 	atomic.Xadd(&sched.ngsys, -1)
+
+	if fn := extraMObserver; fn != nil {
+		fn(true, extra)
+	}
+}
+
+// extraMObserver, if non-nil, is called by needm and dropm each time
+// an extra M is taken from or returned to the extra list.
+var extraMObserver func(acquire bool, extraCount int32)
+
+// SetExtraMObserver arranges for fn to be called each time a thread
+// not created by Go, such as a C thread calling into Go through cgo,
+// acquires an extra M to run Go code, and again when it releases the
+// M on return, reporting which of the two happened and the number of
+// extra M's left on the runtime's free list afterwards. Where the
+// runtime keeps the M of a C thread from one call into Go to the next,
+// the M is only released, and reported, when the thread exits.
+//
+// fn is called on the system stack of the borrowed M: on acquire once
+// the M is set up to run Go code, and on release with signals blocked
+// and the extra M list locked. It must not allocate, block or otherwise
+// call into the runtime, and should do as little as possible. Passing
+// nil removes the observer.
+func SetExtraMObserver(fn func(acquire bool, extraCount int32)) {
+	extraMObserver = fn
 }
 
 var earlycgocallback = []byte("fatal error: cgo callback before cgo call\n")
@@ -1990,6 +2662,41 @@ func newextram() {
 	}
 }
 
+// growExtraM allocates m's and puts them on the extra list until it
+// holds at least n of them.
+func growExtraM(n uint32) {
+	for {
+		mp := lockextra(true)
+		c := extraMCount
+		unlockextra(mp)
+		if c >= n {
+			return
+		}
+		oneNewExtraM()
+	}
+}
+
+// PreallocateExtraMs makes sure that at least n extra M's are ready
+// for threads not created by Go, such as C threads calling into Go
+// through cgo, to run Go code on. Each such thread takes an extra M,
+// with its goroutine and signal stack, for the duration of the call.
+// The runtime otherwise keeps a single spare one and allocates more
+// only once it is taken, so that a burst of calls from new threads,
+// or the first call from each of several at once, has to wait for
+// them. GODEBUG=extram=N preallocates N extra M's at program start.
+//
+// PreallocateExtraMs does nothing in programs that don't use cgo,
+// except on Windows, where syscall.NewCallback callbacks also run on
+// extra M's.
+func PreallocateExtraMs(n int) {
+	if !cgoHasExtraM || n <= 0 {
+		return
+	}
+	systemstack(func() {
+		growExtraM(uint32(n))
+	})
+}
+
 // oneNewExtraM allocates an m and puts it on the extra list.
 func oneNewExtraM() {
 	// Create extra goroutine locked to extra m.
@@ -1998,6 +2705,10 @@ func oneNewExtraM() {
 	// goexit makes clear to the traceback routines where
 	// the goroutine stack ends.
 	mp := allocm(nil, nil, -1)
+	lock(&sched.lock)
+	mp.isextra = true
+	mSetName(mp)
+	unlock(&sched.lock)
 	gp := malg(4096)
 	gp.sched.pc = funcPC(goexit) + sys.PCQuantum
 	gp.sched.sp = gp.stack.hi
@@ -2043,33 +2754,45 @@ func oneNewExtraM() {
 //
 // The main expense here is the call to signalstack to release the
 // m's signal stack, and then the call to needm on the next callback
-// from this thread. It is tempting to try to save the m for next time,
-// which would eliminate both these costs, but there might not be
-// a next time: the current thread (which Go does not control) might exit.
-// If we saved the m for that thread, there would be an m leak each time
-// such a thread exited. Instead, we acquire and release an m on each
-// call. These should typically not be scheduling operations, just a few
-// atomics, so the cost should be small.
-//
-// TODO(rsc): An alternative would be to allocate a dummy pthread per-thread
-// variable using pthread_key_create. Unlike the pthread keys we already use
-// on OS X, this dummy key would never be read by Go code. It would exist
-// only so that we could register at thread-exit-time destructor.
-// That destructor would put the m back onto the extra list.
-// This is purely a performance optimization. The current version,
-// in which dropm happens on each cgo call, is still correct too.
-// We may have to keep the current version on systems with cgo
-// but without pthreads, like Windows.
+// from this thread. To save both for the next time, when runtime/cgo
+// has created a pthread per-thread key, dropm instead binds the m to
+// the thread, with the key holding its g0, and returns leaving g set.
+// The thread then keeps the m, and its signal stack and signal mask,
+// while it runs C code. Later callbacks from it find the m in g and
+// skip needm, and the dropm after each of them only returns mp.curg
+// to dead state, as cgocallbackg brings it back. The key's destructor
+// puts the m back onto the extra list when the thread exits, by
+// calling cgocallback with a nil function, which calls dropm again.
+// There is no such destructor on systems with cgo but without
+// pthreads, like Windows, so there dropm happens on each cgo call.
+// An m acquired by a signal handler on a non-Go thread is never bound.
 func dropm() {
 	// Clear m and g, and return m to the extra list.
 	// After the call to setg we can only call nosplit functions
 	// with no pointer manipulation.
 	mp := getg().m
 
-	// Return mp.curg to dead state.
-	casgstatus(mp.curg, _Gsyscall, _Gdead)
-	mp.curg.preemptStop = false
-	atomic.Xadd(&sched.ngsys, +1)
+	if mp.isExtraInC {
+		// The thread mp is bound to is exiting. mp.curg is already
+		// dead.
+		mp.isExtraInC = false
+		mp.isExtraBound = false
+	} else {
+		// Return mp.curg to dead state.
+		casgstatus(mp.curg, _Gsyscall, _Gdead)
+		mp.curg.preemptStop = false
+		atomic.Xadd(&sched.ngsys, +1)
+
+		if !mp.isExtraBound && !mp.isExtraInSig && _cgo_pthread_key_created != nil && *(*uintptr)(_cgo_pthread_key_created) != 0 {
+			asmcgocall(_cgo_bindm, unsafe.Pointer(mp.g0))
+			mp.isExtraBound = true
+		}
+		if mp.isExtraBound {
+			mp.isExtraInC = true
+			return
+		}
+	}
+	mp.isExtraInSig = false
 
 	// Block signals before unminit.
 	// Unminit unregisters the signal handling stack (but needs g on some systems).
@@ -2079,10 +2802,19 @@ func dropm() {
 	sigblock(false)
 	unminit()
 
+	// Run any fixup pending for this thread now, as from here on
+	// syscall_runtime_doAllThreadsSyscall does not know of it.
+	mDoFixup()
+	mp.procid = 0
+
 	mnext := lockextra(true)
 	extraMCount++
 	mp.schedlink.set(mnext)
 
+	if fn := extraMObserver; fn != nil {
+		fn(false, int32(extraMCount))
+	}
+
 	setg(nil)
 
 	// Commit the release of mp.
@@ -2100,6 +2832,12 @@ var extram uintptr
 var extraMCount uint32 // Protected by lockextra
 var extraMWaiters uint32
 
+// extraMHits and extraMMisses count the calls to needm that left an
+// extra M on the list and those that took the last one, so that the
+// callback had to allocate a new one. Accessed atomically.
+var extraMHits uint64
+var extraMMisses uint64
+
 // lockextra locks the extra list and returns the list head.
 // The caller must unlock the list by storing a new list head
 // to extram. If nilokay is true, then lockextra will
@@ -2385,6 +3123,12 @@ func stopm() {
 	mPark()
 	acquirep(_g_.m.nextp.ptr()) // 注释：(获得P)当前线程m和p相互绑定，并且把p的状态从_Pidle设置成_Prunning
 	_g_.m.nextp = 0
+	if _g_.m.idleExit {
+		// sysmon woke this M, with an idle P to release, for it
+		// to exit. Unwind to mstart, which calls mexit.
+		_g_.m.idleExit = false
+		gogo(&_g_.m.g0.sched)
+	}
 }
 
 func mspinning() {
@@ -2536,6 +3280,7 @@ func handoffp(_p_ *p) {
 	lock(&sched.lock) // 注释：上锁，准备对sched结构体进行修改
 	if sched.gcwaiting != 0 {
 		_p_.status = _Pgcstop
+		pStatusChanged(_p_, _Pidle, _Pgcstop)
 		sched.stopwait--
 		if sched.stopwait == 0 {
 			notewakeup(&sched.stopnote)
@@ -2574,15 +3319,60 @@ func handoffp(_p_ *p) {
 	}
 }
 
-// Tries to add one more P to execute G's.
-// Called when a G is made runnable (newproc, ready).
-// 注释：译：尝试再添加一个P以执行G。当G可以运行时调用（newproc，ready）。
-// 注释：拿个空闲M线程运行空闲P，并且自旋，开始抢别的G了
-func wakep() {
-	if atomic.Load(&sched.npidle) == 0 {
-		return
+// minIdleP is the number of idle P's that background work should
+// leave idle, as set by SetMinIdleP. Accessed atomically.
+var minIdleP uint32
+
+// SetMinIdleP asks the scheduler to keep at least k P's (logical
+// processors) idle rather than hand them to idle-priority garbage
+// collector mark workers, so that goroutines that become runnable in a
+// burst find a P right away instead of first waiting for a mark worker
+// to be preempted.
+//
+// The reserve is advisory and never prevents progress: ordinary
+// goroutines are never held back by it, marking still proceeds on
+// dedicated and fractional workers and through assists, and it does
+// not apply when no other P is running, so that idle mark workers
+// still finish a cycle that nothing else is driving.
+//
+// k <= 0 disables the reserve, which is the default.
+func SetMinIdleP(k int) {
+	if k < 0 {
+		k = 0
 	}
-	// be conservative about spinning threads
+	if k > maxMinIdleP {
+		k = maxMinIdleP
+	}
+	atomic.Store(&minIdleP, uint32(k))
+}
+
+// maxMinIdleP bounds minIdleP; it is far larger than any realistic
+// GOMAXPROCS.
+const maxMinIdleP = 1 << 16
+
+// idlePReserved reports whether running an idle mark worker on one
+// more P would eat into the reserve set by SetMinIdleP. n is 1 if that
+// P has to be taken off the idle list, and 0 if the caller already
+// owns it. The reserve is ignored if no other P is running, since then
+// no other worker is left to finish the mark phase.
+func idlePReserved(n uint32) bool {
+	min := atomic.Load(&minIdleP)
+	if min == 0 {
+		return false
+	}
+	npidle := atomic.Load(&sched.npidle)
+	return npidle < min+n && npidle+1 < uint32(gomaxprocs)+n
+}
+
+// Tries to add one more P to execute G's.
+// Called when a G is made runnable (newproc, ready).
+// 注释：译：尝试再添加一个P以执行G。当G可以运行时调用（newproc，ready）。
+// 注释：拿个空闲M线程运行空闲P，并且自旋，开始抢别的G了
+func wakep() {
+	if atomic.Load(&sched.npidle) == 0 {
+		return
+	}
+	// be conservative about spinning threads
 	if atomic.Load(&sched.nmspinning) != 0 || !atomic.Cas(&sched.nmspinning, 0, 1) {
 		return
 	}
@@ -2658,7 +3448,8 @@ func gcstopm() {
 	}
 	_p_ := releasep() // 注释：释放P,解除P和M的绑定
 	lock(&sched.lock)
-	_p_.status = _Pgcstop    // 注释：设置P的状态为GCstop，GC停止世界（STW）时把当前的P也停止了，并设置这个状态
+	_p_.status = _Pgcstop // 注释：设置P的状态为GCstop，GC停止世界（STW）时把当前的P也停止了，并设置这个状态
+	pStatusChanged(_p_, _Pidle, _Pgcstop)
 	sched.stopwait--         // 注释：停止等待，默认值是cup核数，冻结时值为一个很大的值，STW时减1
 	if sched.stopwait == 0 { // 注释：如果没有需要停止等待的调度
 		notewakeup(&sched.stopnote)
@@ -2689,8 +3480,29 @@ func execute(gp *g, inheritTime bool) {
 	gp.m = _g_.m                          // 注释：把要执行的G对应的M绑定到当前已经存在的G对应的M上
 	casgstatus(gp, _Grunnable, _Grunning) // 注释：更新G的状态为运行中
 	gp.waitsince = 0
+	if gp.spawnTime != 0 {
+		spawnToRunDist.record(nanotime() - gp.spawnTime)
+		gp.spawnTime = 0
+	}
+	if gp.readyTime != 0 {
+		schedLatencyDist.record(nanotime() - gp.readyTime)
+		gp.readyTime = 0
+	}
+	pid := _g_.m.p.ptr().id
+	if last := gp.lastpid; last != 0 && last-1 != pid {
+		if fn := migrationObserver; fn != nil {
+			fn(gp.goid, last-1, pid)
+		}
+	}
+	gp.lastpid = pid + 1
+	if pp := _g_.m.p.ptr(); pp.timeSlice != uint64(gp.timeSlice) {
+		atomic.Store64(&pp.timeSlice, uint64(gp.timeSlice))
+	}
 	gp.preempt = false                         // 注释：禁止抢占
 	gp.stackguard0 = gp.stack.lo + _StackGuard // 注释：设置爆栈警告
+	if atomic.Load(&gp.deadlineState) != gDeadlineNone {
+		checkDeadline(gp)
+	}
 	if !inheritTime {
 		_g_.m.p.ptr().schedtick++ // 注释：调度计数器递增
 	}
@@ -2714,10 +3526,30 @@ func execute(gp *g, inheritTime bool) {
 	gogo(&gp.sched) // 注释：(执行)真正执行G里的指令(在G休眠的时候会保存现场，保存现场就是保存到&gp.sched里，所以唤醒后执行这里的指令)
 }
 
+// migrationObserver, if non-nil, is called by execute when a goroutine
+// runs on a different P than it last ran on.
+var migrationObserver func(goid int64, fromPid, toPid int32)
+
+// SetGoroutineMigrationObserver arranges for fn to be called each time
+// a goroutine is scheduled on a different P (logical processor) than
+// the one it last ran on, for example because it was stolen by an idle
+// P or taken from the global run queue, reporting the goroutine's ID
+// and the IDs of the old and new P's. Each such migration typically
+// costs the goroutine its warm CPU caches, and more so across NUMA
+// nodes.
+//
+// fn is called on the scheduler's hot path, on the system stack, just
+// before the goroutine starts running. It must not allocate, block or
+// otherwise call into the runtime, and should do as little as possible.
+// Passing nil removes the observer.
+func SetGoroutineMigrationObserver(fn func(goid int64, fromPid, toPid int32)) {
+	migrationObserver = fn
+}
+
 // Finds a runnable goroutine to execute.
 // Tries to steal from other P's, get g from local or global queue, poll network.
 // 注释：获取可以运行的G；获取顺序是：先从本地P中获取-》全局队列中获取-》网络轮询，已经就绪的网络连接中获取（优化方案）-》去其他线程的本地队列里窃取（偷）
-func findrunnable() (gp *g, inheritTime bool) {
+func findrunnable() (gp *g, inheritTime bool, source schedSource) {
 	_g_ := getg()
 
 	// The conditions here and in handoffp must agree: if
@@ -2741,6 +3573,11 @@ top:
 			ready(gp, 0, true)
 		}
 	}
+	if finAlarm.wait && finAlarm.wake {
+		if gp := wakeFinalizerAlarm(); gp != nil {
+			ready(gp, 0, true)
+		}
+	}
 	if *cgo_yield != nil {
 		asmcgocall(*cgo_yield, nil)
 	}
@@ -2748,7 +3585,7 @@ top:
 	// local runq
 	// 注释：在本地P队列中获取G
 	if gp, inheritTime := runqget(_p_); gp != nil {
-		return gp, inheritTime
+		return gp, inheritTime, schedSourceLocal
 	}
 
 	// global runq
@@ -2758,7 +3595,7 @@ top:
 		gp := globrunqget(_p_, 0) // 注释：从全局队列中获取G
 		unlock(&sched.lock)
 		if gp != nil {
-			return gp, false
+			return gp, false, schedSourceGlobal
 		}
 	}
 
@@ -2771,17 +3608,27 @@ top:
 	// blocked thread (e.g. it has already returned from netpoll, but does
 	// not set lastpoll yet), this thread will do blocking netpoll below
 	// anyway.
+	// With a sharded network poller, first poll this P's own shard,
+	// even if a thread is blocked in netpoll, to spread the polling
+	// among P's.
 	// 注释：网络轮询，是个优化方案
-	if netpollinited() && atomic.Load(&netpollWaiters) > 0 && atomic.Load64(&sched.lastpoll) != 0 {
-		// 注释：netpoll检查就绪的网络连接,返回可运行的goroutine列表
-		if list := netpoll(0); !list.empty() { // non-blocking
+	if netpollinited() && atomic.Load(&netpollWaiters) > 0 {
+		list, ok := netpollShard(_p_)
+		if ok {
+			netpollCount(false, &list)
+		}
+		if list.empty() && atomic.Load64(&sched.lastpoll) != 0 {
+			// 注释：netpoll检查就绪的网络连接,返回可运行的goroutine列表
+			list = netpollCounted(0) // non-blocking
+		}
+		if !list.empty() {
 			gp := list.pop()
 			injectglist(&list)
 			casgstatus(gp, _Gwaiting, _Grunnable) // 注释：修改G的状态如果等于_Gwaiting时则修改为_Grunnable
 			if trace.enabled {
 				traceGoUnpark(gp, 0)
 			}
-			return gp, false
+			return gp, false, schedSourceNetpoll
 		}
 	}
 
@@ -2800,12 +3647,16 @@ top:
 		_g_.m.spinning = true             // 注释：设置为自旋，变更状态为true，说明自己已经空闲了打算去窃取（偷）其他的线程M本地的G了
 		atomic.Xadd(&sched.nmspinning, 1) // 注释：自旋（空闲）数加1
 	}
+	if numaSteal || numaHeap.enabled {
+		_p_.numaNode = mNUMANode(_g_.m)
+	}
+
 	const stealTries = 4 // 注释：尝试窃取（偷）的数量
 	for i := 0; i < stealTries; i++ {
 		stealTimersOrRunNextG := i == stealTries-1 // 注释：最后一次循环（true时false否）
 
 		// 注释：随机拿出一个P，通过stealOrder.reset(P的总数)初始化
-		for enum := stealOrder.start(fastrand()); !enum.done(); enum.next() {
+		for enum := startSteal(_p_); !enum.done(); enum.next() {
 			if sched.gcwaiting != 0 {
 				goto top
 			}
@@ -2830,6 +3681,9 @@ top:
 			if stealTimersOrRunNextG && timerpMask.read(enum.position()) {
 				tnow, w, ran := checkTimers(p2, now)
 				now = tnow
+				if fn := timerStealObserver; fn != nil {
+					fn(_p_.id, p2.id, ran)
+				}
 				if w != 0 && (pollUntil == 0 || w < pollUntil) {
 					pollUntil = w
 				}
@@ -2843,7 +3697,7 @@ top:
 					// stolen G's. So check now if there
 					// is a local G to run.
 					if gp, inheritTime := runqget(_p_); gp != nil {
-						return gp, inheritTime
+						return gp, inheritTime, schedSourceLocal
 					}
 					ranTimer = true
 				}
@@ -2852,7 +3706,7 @@ top:
 			// Don't bother to attempt to steal if p2 is idle. // 注释： 如果p2空闲，不要费心去偷。
 			if !idlepMask.read(enum.position()) {
 				if gp := runqsteal(_p_, p2, stealTimersOrRunNextG); gp != nil { // 注释：向P2中窃取（偷）一些G
-					return gp, false
+					return gp, false, schedSourceSteal
 				}
 			}
 		}
@@ -2868,7 +3722,9 @@ stop:
 	// We have nothing to do. If we're in the GC mark phase, can
 	// safely scan and blacken objects, and have work to do, run
 	// idle-time marking rather than give up the P.
-	if gcBlackenEnabled != 0 && gcMarkWorkAvailable(_p_) {
+	// Leave the P idle instead if it is part of the reserve kept by
+	// SetMinIdleP.
+	if gcBlackenEnabled != 0 && gcMarkWorkAvailable(_p_) && !idlePReserved(0) {
 		node := (*gcBgMarkWorkerNode)(gcBgMarkWorkerPool.pop())
 		if node != nil {
 			_p_.gcMarkWorkerMode = gcMarkWorkerIdleMode
@@ -2877,7 +3733,7 @@ stop:
 			if trace.enabled {
 				traceGoUnpark(gp, 0)
 			}
-			return gp, false
+			return gp, false, schedSourceGCWorker
 		}
 	}
 
@@ -2897,7 +3753,7 @@ stop:
 		if trace.enabled {
 			traceGoUnpark(gp, 0)
 		}
-		return gp, false
+		return gp, false, schedSourceEvent
 	}
 	if otherReady {
 		goto top
@@ -2922,7 +3778,7 @@ stop:
 	if sched.runqsize != 0 {
 		gp := globrunqget(_p_, 0)
 		unlock(&sched.lock)
-		return gp, false
+		return gp, false, schedSourceGlobal
 	}
 	if releasep() != _p_ {
 		throw("findrunnable: wrong p")
@@ -3006,7 +3862,10 @@ stop:
 		// less likely to find a P, check for that first.
 		lock(&sched.lock)
 		var node *gcBgMarkWorkerNode
-		_p_ = pidleget()
+		_p_ = nil
+		if !idlePReserved(1) {
+			_p_ = pidleget()
+		}
 		if _p_ != nil {
 			// Now that we own a P, gcBlackenEnabled can't change
 			// (as it requires STW).
@@ -3036,7 +3895,7 @@ stop:
 			if trace.enabled {
 				traceGoUnpark(gp, 0)
 			}
-			return gp, false
+			return gp, false, schedSourceGCWorker
 		}
 	}
 
@@ -3053,7 +3912,7 @@ stop:
 			// When using fake time, just poll.
 			delta = 0
 		}
-		list := netpoll(delta) // block until new work is available
+		list := netpollCounted(delta) // block until new work is available
 		atomic.Store64(&sched.pollUntil, 0)
 		atomic.Store64(&sched.lastpoll, uint64(nanotime()))
 		if faketime != 0 && list.empty() {
@@ -3076,7 +3935,7 @@ stop:
 				if trace.enabled {
 					traceGoUnpark(gp, 0)
 				}
-				return gp, false
+				return gp, false, schedSourceNetpoll
 			}
 			if wasSpinning {
 				_g_.m.spinning = true
@@ -3087,7 +3946,7 @@ stop:
 	} else if pollUntil != 0 && netpollinited() {
 		pollerPollUntil := int64(atomic.Load64(&sched.pollUntil))
 		if pollerPollUntil == 0 || pollerPollUntil > pollUntil {
-			netpollBreak()
+			netpollBreakCounted()
 		}
 	}
 	stopm() // 注释：进入休眠
@@ -3107,7 +3966,7 @@ func pollWork() bool {
 		return true
 	}
 	if netpollinited() && atomic.Load(&netpollWaiters) > 0 && sched.lastpoll != 0 {
-		if list := netpoll(0); !list.empty() {
+		if list := netpollCounted(0); !list.empty() {
 			injectglist(&list)
 			return true
 		}
@@ -3126,7 +3985,7 @@ func wakeNetPoller(when int64) {
 		// but should never miss a wakeup.
 		pollerPollUntil := int64(atomic.Load64(&sched.pollUntil))
 		if pollerPollUntil == 0 || pollerPollUntil > when {
-			netpollBreak()
+			netpollBreakCounted()
 		}
 	} else {
 		// There are no threads in the network poller, try to get
@@ -3137,6 +3996,55 @@ func wakeNetPoller(when int64) {
 	}
 }
 
+// netpollReadyBuckets is the number of buckets in
+// netpollStats.readyDist: one for polls that found no goroutines, one
+// for each power of two up to 512, and one for 1024 or more.
+const netpollReadyBuckets = 12
+
+// netpollStats counts calls to the network poller and the goroutines
+// it made runnable, for runtime/metrics.
+var netpollStats struct {
+	blocking    uint64 // calls to netpoll that may block
+	nonblocking uint64 // calls to netpoll that don't block
+	breaks      uint64 // calls to netpollBreak
+	ready       uint64 // goroutines made runnable by netpoll
+	readyDist   [netpollReadyBuckets]uint64
+}
+
+// netpollCounted calls netpoll and records the call in netpollStats.
+func netpollCounted(delay int64) gList {
+	list := netpoll(delay)
+	netpollCount(delay != 0, &list)
+	return list
+}
+
+// netpollCount records in netpollStats a poll of the network poller
+// that found the goroutines in list.
+func netpollCount(blocking bool, list *gList) {
+	if blocking {
+		atomic.Xadd64(&netpollStats.blocking, 1)
+	} else {
+		atomic.Xadd64(&netpollStats.nonblocking, 1)
+	}
+	n := 0
+	for gp := list.head.ptr(); gp != nil; gp = gp.schedlink.ptr() {
+		n++
+	}
+	i := sys.Len64(uint64(n))
+	if i >= netpollReadyBuckets {
+		i = netpollReadyBuckets - 1
+	}
+	atomic.Xadd64(&netpollStats.ready, int64(n))
+	atomic.Xadd64(&netpollStats.readyDist[i], 1)
+}
+
+// netpollBreakCounted calls netpollBreak and records the call in
+// netpollStats.
+func netpollBreakCounted() {
+	atomic.Xadd64(&netpollStats.breaks, 1)
+	netpollBreak()
+}
+
 func resetspinning() {
 	_g_ := getg()
 	if !_g_.m.spinning {
@@ -3275,6 +4183,7 @@ top:
 
 	var gp *g
 	var inheritTime bool
+	var source schedSource
 
 	// Normal goroutines will check for need to wakeP in ready,
 	// but GCworkers and tracereaders will not, so the check must
@@ -3286,11 +4195,15 @@ top:
 			casgstatus(gp, _Gwaiting, _Grunnable)
 			traceGoUnpark(gp, 0)
 			tryWakeP = true
+			source = schedSourceTrace
 		}
 	}
 	if gp == nil && gcBlackenEnabled != 0 {
 		gp = gcController.findRunnableGCWorker(_g_.m.p.ptr())
-		tryWakeP = tryWakeP || gp != nil
+		if gp != nil {
+			tryWakeP = true
+			source = schedSourceGCWorker
+		}
 	}
 	// 注释：每隔61次调度尝试去全局队列中获取一个G
 	if gp == nil {
@@ -3298,16 +4211,18 @@ top:
 		// Otherwise two goroutines can completely occupy the local runqueue
 		// by constantly respawning each other.
 		// 注释：每隔61次调度，尝试从全局队列种获取G，避免全局队列中的g被饿死
-		if _g_.m.p.ptr().schedtick%61 == 0 && sched.runqsize > 0 {
+		if _g_.m.p.ptr().schedtick%atomic.Load(&globrunqCheckInterval) == 0 && sched.runqsize > 0 {
 			lock(&sched.lock)
 			gp = globrunqget(_g_.m.p.ptr(), 1) // 注释：从全局队列中获取一个g
 			unlock(&sched.lock)
+			source = schedSourceGlobal
 		}
 	}
 	// 注释：从p的本地队列里获取G
 	if gp == nil {
 		// 注释：从p的本地队列中获取g(从p.runnext获取g)
 		gp, inheritTime = runqget(_g_.m.p.ptr())
+		source = schedSourceLocal
 		// We can see gp != nil here even if the M is spinning,
 		// if checkTimers added a local goroutine via goready.
 	}
@@ -3315,7 +4230,7 @@ top:
 	if gp == nil {
 		// 注释：想尽办法找到可运行的G，找不到就不用返回了(调用 findrunnable找g，找不到的话就将m休眠，等待唤醒)
 		// 注释：获取G；获取顺序是：先从本地P中获取-》全局队列中获取-》网络轮询，已经就绪的网络连接中获取（优化方案）-》去其他线程的本地队列里窃取（偷）
-		gp, inheritTime = findrunnable() // 注释：各种找G，如果找不到就自旋 // blocks until work is available
+		gp, inheritTime, source = findrunnable() // 注释：各种找G，如果找不到就自旋 // blocks until work is available
 	}
 
 	// This thread is going to run a goroutine and is not spinning anymore,
@@ -3355,9 +4270,80 @@ top:
 		goto top
 	}
 
+	if fn := scheduleObserver; fn != nil {
+		fn(gp.goid, schedSourceNames[source])
+	}
 	execute(gp, inheritTime) // 注释：找到了g，那就执行g上的任务函数
 }
 
+// A schedSource records where schedule found the goroutine it runs.
+type schedSource uint8
+
+const (
+	schedSourceLocal    schedSource = iota // the P's local run queue
+	schedSourceGlobal                      // the global run queue
+	schedSourceSteal                       // another P's local run queue
+	schedSourceNetpoll                     // the network poller
+	schedSourceGCWorker                    // a GC background mark worker
+	schedSourceTrace                       // the execution trace reader
+	schedSourceEvent                       // the js/wasm event handler
+)
+
+var schedSourceNames = [...]string{
+	schedSourceLocal:    "local",
+	schedSourceGlobal:   "global",
+	schedSourceSteal:    "steal",
+	schedSourceNetpoll:  "netpoll",
+	schedSourceGCWorker: "gcworker",
+	schedSourceTrace:    "trace",
+	schedSourceEvent:    "event",
+}
+
+// timerStealObserver, if non-nil, is called by findrunnable each time
+// it checks another P's timers.
+var timerStealObserver func(thiefPid, victimPid int32, ran bool)
+
+// SetTimerStealObserver arranges for fn to be called each time a P
+// (logical processor) that has run out of work checks another P's
+// timers, as a last resort before stealing the goroutine that P is
+// about to run. fn is passed the IDs of the checking P and of the P
+// whose timers were checked, and whether any of those timers were due
+// and so were run by the checking P, which then usually runs the
+// goroutines they make ready. This shows how timer work moves between
+// P's when some are busy and others idle.
+//
+// fn is called on the scheduler's hot path, on the system stack. It
+// must not allocate, block or otherwise call into the runtime, and
+// should do as little as possible. Passing nil removes the observer.
+func SetTimerStealObserver(fn func(thiefPid, victimPid int32, ran bool)) {
+	timerStealObserver = fn
+}
+
+// scheduleObserver, if non-nil, is called by schedule for every
+// goroutine it is about to run.
+var scheduleObserver func(goid int64, source string)
+
+// SetScheduleObserver arranges for fn to be called each time the
+// scheduler picks a goroutine to run. fn is passed the ID of the
+// goroutine and a string naming where the scheduler found it:
+//
+//	"local"     the current P's run queue
+//	"global"    the global run queue
+//	"steal"     another P's run queue
+//	"netpoll"   the network poller
+//	"gcworker"  a garbage collector background worker
+//	"trace"     the execution trace reader
+//	"event"     the js/wasm event handler
+//
+// fn is called by the scheduler itself, on the system stack, on every
+// goroutine switch. It must be very short, must not allocate, block or
+// grow its stack significantly, and should do little more than update
+// counters. Passing nil removes the observer; while no observer is set
+// the scheduler pays only for a nil check.
+func SetScheduleObserver(fn func(goid int64, source string)) {
+	scheduleObserver = fn
+}
+
 // dropg removes the association between m and the current goroutine m->curg (gp for short).
 // Typically a caller sets gp's status away from Grunning and then
 // immediately calls dropg to finish the job. The caller is also responsible
@@ -3391,6 +4377,13 @@ func dropg() {
 // We pass now in and out to avoid extra calls of nanotime.
 //go:yeswritebarrierrec
 func checkTimers(pp *p, now int64) (rnow, pollUntil int64, ran bool) {
+	// If sysmon asked this P to hand timers to another P, do so now.
+	// checkTimers also runs for pp on Ps stealing from it, so claim
+	// the migration first, to make sure only one of them does it.
+	if atomic.Load(&timerBalance.src) == uint32(pp.id)+1 && atomic.Cas(&timerBalance.src, uint32(pp.id)+1, 0) {
+		balanceTimers(pp)
+	}
+
 	// If it's not yet time for the first timer, or the first adjusted
 	// timer, then there is nothing to do.
 	next := int64(atomic.Load64(&pp.timer0When))
@@ -3419,7 +4412,8 @@ func checkTimers(pp *p, now int64) (rnow, pollUntil int64, ran bool) {
 
 	lock(&pp.timersLock)
 
-	if len(pp.timers) > 0 {
+	advancetimers(pp, now)
+	if atomic.Load(&pp.numTimers) > 0 {
 		adjusttimers(pp, now)
 		for len(pp.timers) > 0 {
 			// Note that runtimer may temporarily unlock
@@ -3431,13 +4425,22 @@ func checkTimers(pp *p, now int64) (rnow, pollUntil int64, ran bool) {
 				break
 			}
 			ran = true
+			if pp != getg().m.p.ptr() {
+				atomic.Xadd64(&timersStolen, 1)
+			}
+		}
+		if pp.timerWheel != nil {
+			// Also wake up for the next slot of the timing wheel.
+			if w := int64(atomic.Load64(&pp.timer0When)); w != 0 && (pollUntil == 0 || w < pollUntil) {
+				pollUntil = w
+			}
 		}
 	}
 
 	// If this is the local P, and there are a lot of deleted timers,
 	// clear them out. We only do this for the local P to reduce
 	// lock contention on timersLock.
-	if pp == getg().m.p.ptr() && int(atomic.Load(&pp.deletedTimers)) > len(pp.timers)/4 {
+	if pp == getg().m.p.ptr() && atomic.Load(&pp.deletedTimers) > atomic.Load(&pp.numTimers)/4 {
 		clearDeletedTimers(pp)
 	}
 
@@ -3503,6 +4506,42 @@ func gosched_m(gp *g) {
 	goschedImpl(gp)
 }
 
+// YieldLocalQueue continuation on g0.
+func yieldLocalQueue_m(gp *g) {
+	if trace.enabled {
+		traceGoSched()
+	}
+	status := readgstatus(gp)
+	if status&^_Gscan != _Grunning {
+		dumpgstatus(gp)
+		throw("bad g status")
+	}
+	casgstatus(gp, _Grunning, _Grunnable)
+	_p_ := gp.m.p.ptr()
+	dropg()
+
+	var q gQueue
+	n := int32(0)
+	for {
+		gp1, _ := runqget(_p_)
+		if gp1 == nil {
+			break
+		}
+		q.pushBack(gp1)
+		n++
+	}
+	q.pushBack(gp)
+	n++
+	lock(&sched.lock)
+	globrunqputbatch(&q, n)
+	unlock(&sched.lock)
+	if n > 1 && atomic.Load(&sched.npidle) != 0 {
+		wakep()
+	}
+
+	schedule()
+}
+
 // goschedguarded is a forbidden-states-avoided version of gosched_m
 func goschedguarded_m(gp *g) {
 
@@ -3548,6 +4587,25 @@ func preemptPark(gp *g) {
 	schedule()
 }
 
+// goyieldObserver, if non-nil, is called by goyield_m for each
+// goroutine that yields through goyield.
+var goyieldObserver func(goid int64)
+
+// SetGoyieldObserver arranges for fn to be called each time a goroutine
+// yields its P through the runtime's internal goyield, reporting the
+// goroutine's ID. Unlike Gosched, goyield keeps the goroutine on its
+// P's local run queue and is recorded as a preemption in execution
+// traces; it is used, for example, when a starving sync.Mutex hands
+// itself directly to a waiter.
+//
+// fn is called on the system stack of the yielding goroutine's M,
+// before it schedules another goroutine. It must not allocate, block
+// or otherwise call into the runtime, and should do as little as
+// possible. Passing nil removes the observer.
+func SetGoyieldObserver(fn func(goid int64)) {
+	goyieldObserver = fn
+}
+
 // goyield is like Gosched, but it:
 // - emits a GoPreempt trace event instead of a GoSched trace event
 // - puts the current G on the runq of the current P instead of the globrunq
@@ -3560,6 +4618,9 @@ func goyield_m(gp *g) {
 	if trace.enabled {
 		traceGoPreempt()
 	}
+	if fn := goyieldObserver; fn != nil {
+		fn(gp.goid)
+	}
 	pp := gp.m.p.ptr()
 	casgstatus(gp, _Grunning, _Grunnable)
 	dropg()
@@ -3600,6 +4661,14 @@ func goexit0(gp *g) {
 	if isSystemGoroutine(gp, false) { // 注释：是否是系统函数调用（runtime包里的函数）
 		atomic.Xadd(&sched.ngsys, -1) // 注释：标记系统函数调用的次数减1
 	}
+	recordGoroutineExit(gp.goid, goroutineExitReason(gp))
+	if gp.timeSlice != 0 {
+		lock(&timeSlices.lock)
+		timeSliceRemove(gp)
+		gp.timeSlice = 0
+		atomic.Store(&timeSlices.stale, 1)
+		unlock(&timeSlices.lock)
+	}
 	// 注释：清空业务G里的数据
 	gp.m = nil
 	locked := gp.lockedm != 0
@@ -3611,9 +4680,13 @@ func goexit0(gp *g) {
 	gp._panic = nil // non-nil for Goexit during panic. points at stack-allocated data.
 	gp.writebuf = nil
 	gp.waitreason = 0
+	gp.userWaitReason = 0
+	gp.deadline = 0
+	gp.deadlineState = gDeadlineNone
 	gp.param = nil
 	gp.labels = nil
 	gp.timer = nil
+	gp.gcAssistExempt = false
 
 	if gcBlackenEnabled != 0 && gp.gcAssistBytes > 0 {
 		// Flush assist credit to the global pool. This gives
@@ -3623,6 +4696,9 @@ func goexit0(gp *g) {
 		scanCredit := int64(assistWorkPerByte * float64(gp.gcAssistBytes))
 		atomic.Xaddint64(&gcController.bgScanCredit, scanCredit)
 		gp.gcAssistBytes = 0
+		if fn := assistCreditObserver; fn != nil {
+			fn(gp.goid, scanCredit)
+		}
 	}
 
 	dropg() // 注释：(断开G和M的相互绑定关系)删除当前G
@@ -3655,6 +4731,116 @@ func goexit0(gp *g) {
 	schedule() // 注释：执行下一次系统调度
 }
 
+// A GoroutineExitReason describes how a goroutine ended.
+type GoroutineExitReason uint8
+
+const (
+	// GoroutineExitReturn means the goroutine's function returned.
+	GoroutineExitReturn GoroutineExitReason = iota
+
+	// GoroutineExitGoexit means the goroutine called Goexit.
+	GoroutineExitGoexit
+
+	// GoroutineExitPanic means the goroutine was panicking and the
+	// panic was never recovered. This is the case when Goexit is
+	// called by a deferred function during a panic. An unrecovered
+	// panic that crashes the program is recorded as well, but can
+	// only be seen by a debugger or in a core dump.
+	GoroutineExitPanic
+
+	// GoroutineExitDeadline means the goroutine was made to exit
+	// because its deadline, set by SetGoroutineDeadline, had passed.
+	GoroutineExitDeadline
+)
+
+func (r GoroutineExitReason) String() string {
+	switch r {
+	case GoroutineExitReturn:
+		return "return"
+	case GoroutineExitGoexit:
+		return "Goexit"
+	case GoroutineExitPanic:
+		return "panic"
+	case GoroutineExitDeadline:
+		return "deadline"
+	}
+	return "unknown"
+}
+
+// A GoroutineExit records the exit of a single goroutine.
+type GoroutineExit struct {
+	Goid   int64               // ID of the goroutine
+	Reason GoroutineExitReason // how the goroutine ended
+}
+
+// goroutineExitsLen is the number of exits kept in goroutineExits.
+const goroutineExitsLen = 128
+
+// goroutineExits is a ring buffer of the most recent goroutine exits.
+// It is written by goexit0 without locks: each writer claims a slot by
+// incrementing next, and readers use the slot's seq to discard records
+// that are being overwritten.
+var goroutineExits struct {
+	next uint64 // number of exits ever recorded; accessed atomically
+	buf  [goroutineExitsLen]struct {
+		seq    uint64 // number of the exit stored here plus one, or 0 while it is written; accessed atomically
+		goid   int64
+		reason GoroutineExitReason
+		_      [7]byte // keep seq 8-byte aligned on 32-bit systems
+	}
+}
+
+// goroutineExitReason determines how gp, which is exiting, ended.
+// gp._panic is non-nil only for a Goexit, possibly during a panic.
+func goroutineExitReason(gp *g) GoroutineExitReason {
+	if gp.deadlineState == gDeadlineExit {
+		return GoroutineExitDeadline
+	}
+	if gp._panic == nil {
+		return GoroutineExitReturn
+	}
+	for p := gp._panic; p != nil; p = p.link {
+		if !p.goexit {
+			return GoroutineExitPanic
+		}
+	}
+	return GoroutineExitGoexit
+}
+
+//go:nosplit
+func recordGoroutineExit(goid int64, reason GoroutineExitReason) {
+	i := atomic.Xadd64(&goroutineExits.next, 1) - 1
+	r := &goroutineExits.buf[i%goroutineExitsLen]
+	atomic.Store64(&r.seq, 0)
+	r.goid = goid
+	r.reason = reason
+	atomic.Store64(&r.seq, i+1)
+}
+
+// LastGoroutineExits returns the most recent goroutine exits, oldest
+// first. Only a limited number of exits is kept, and exits that happen
+// while LastGoroutineExits runs may be left out.
+func LastGoroutineExits() []GoroutineExit {
+	n := atomic.Load64(&goroutineExits.next)
+	start := uint64(0)
+	if n > goroutineExitsLen {
+		start = n - goroutineExitsLen
+	}
+	exits := make([]GoroutineExit, 0, n-start)
+	for i := start; i < n; i++ {
+		r := &goroutineExits.buf[i%goroutineExitsLen]
+		if atomic.Load64(&r.seq) != i+1 {
+			continue
+		}
+		e := GoroutineExit{Goid: r.goid, Reason: r.reason}
+		if atomic.Load64(&r.seq) != i+1 {
+			continue
+		}
+		exits = append(exits, e)
+	}
+	return exits
+}
+
 // save updates getg().sched to refer to pc and sp so that a following
 // gogo will restore pc and sp.
 //
@@ -3741,6 +4927,8 @@ func reentersyscall(pc, sp uintptr) {
 	_g_.stackguard0 = stackPreempt // 注释：标记栈抢占请求
 	_g_.throwsplit = true          // 注释：禁止栈拆分
 
+	syscallStarted(_g_.m)
+
 	// Leave SP around for GC and traceback. // 注释：保留SP以进行GC和回溯。
 	save(pc, sp)                                                      // 注释：保存现场
 	_g_.syscallsp = sp                                                // 注释：设置系统调用时的SP值
@@ -3773,6 +4961,13 @@ func reentersyscall(pc, sp uintptr) {
 		save(pc, sp)                // 注释：再次保存现场
 	}
 
+	if pStatusObserver != nil {
+		// Report the transition before making it, so that it is
+		// ordered before any transition out of _Psyscall.
+		pStatusChanged(_g_.m.p.ptr(), _Prunning, _Psyscall)
+		save(pc, sp)
+	}
+
 	_g_.m.syscalltick = _g_.m.p.ptr().syscalltick // 注释：保存P里的系统调度计数器，P每一次系统调用加1
 	_g_.sysblocktraced = true                     // 设置系统调用的，系统追踪
 	pp := _g_.m.p.ptr()                           // 注释：获取当前G对应的P
@@ -3788,6 +4983,21 @@ func reentersyscall(pc, sp uintptr) {
 	_g_.m.locks--
 }
 
+// syscallStarted records the start of a syscall on mp, which must be
+// the current M, for sysmonLongSyscalls. It must be called before the
+// G's status changes to _Gsyscall.
+//
+//go:nosplit
+func syscallStarted(mp *m) {
+	if atomic.Load64(&longSyscallThreshold) != 0 {
+		mp.syscallwhen = nanotime()
+		atomic.Xadd(&mp.syscallseq, 1)
+	} else if mp.syscallwhen != 0 {
+		mp.syscallwhen = 0
+		atomic.Xadd(&mp.syscallseq, 1)
+	}
+}
+
 // Standard syscall entry used by the go syscall library and normal cgo calls.
 //
 // This is exported via linkname to assembly in the syscall package.
@@ -3816,6 +5026,7 @@ func entersyscall_gcwait() {
 
 	lock(&sched.lock)                                                       // 注释：全局调度锁，加锁
 	if sched.stopwait > 0 && atomic.Cas(&_p_.status, _Psyscall, _Pgcstop) { // 注释：把系统调用状态更改成功停止状态（GC导致的停止）
+		pStatusChanged(_p_, _Psyscall, _Pgcstop)
 		if trace.enabled { //注释：如果开启栈追踪
 			traceGoSysBlock(_p_) // 注释：系统调用停止时的栈追踪
 			traceProcStop(_p_)   // 注释：(栈追踪)线程停止事件
@@ -3840,6 +5051,8 @@ func entersyscallblock() {
 	_g_.sysblocktraced = true
 	_g_.m.p.ptr().syscalltick++
 
+	syscallStarted(_g_.m)
+
 	// Leave SP around for GC and traceback.
 	pc := getcallerpc()
 	sp := getcallersp()
@@ -3963,6 +5176,9 @@ func exitsyscall() {
 	// we don't know for sure that the garbage collector
 	// is not running.
 	_g_.syscallsp = 0
+	if oldp != nil && _g_.m.p.ptr() == oldp {
+		atomic.Xadd64(&syscallRetakenSameP, 1)
+	}
 	_g_.m.p.ptr().syscalltick++
 	_g_.throwsplit = false
 }
@@ -3980,16 +5196,23 @@ func exitsyscallfast(oldp *p) bool {
 	// Try to re-acquire the last P. // 注释：尝试重新获取最后一个P。
 	if oldp != nil && oldp.status == _Psyscall && atomic.Cas(&oldp.status, _Psyscall, _Pidle) { // 注释：如果成功把系统调用前的P的状态从系统调用更改为空闲状态
 		// There's a cpu for us, so we can run.
+		pStatusChanged(oldp, _Psyscall, _Pidle)
 		wirep(oldp) // 注释：当前线程m和p相互绑定，并且把p的状态从_Pidle设置成_Prunning
 		exitsyscallfast_reacquired()
 		return true
 	}
 
-	// Try to get any other idle P.
-	if sched.pidle != 0 {
+	if oldp != nil {
+		// oldp was handed to another M during the syscall.
+		atomic.Xadd64(&syscallRetaken, 1)
+	}
+
+	// Try to get any other idle P, or wait briefly for the old one
+	// if the user asked us to favor locality.
+	if sched.pidle != 0 || (oldp != nil && atomic.Load(&syscallReacquireSpin) != 0) {
 		var ok bool
 		systemstack(func() {
-			ok = exitsyscallfast_pidle()
+			ok = exitsyscallfast_pidle(oldp)
 			if ok && trace.enabled {
 				if oldp != nil {
 					// Wait till traceGoSysBlock event is emitted.
@@ -4032,15 +5255,89 @@ func exitsyscallfast_reacquired() {
 	}
 }
 
-func exitsyscallfast_pidle() bool {
+// syscallReacquireSpin is the number of spin iterations
+// exitsyscallfast_pidle spends waiting for the P a goroutine was running
+// on before a syscall to become idle, when it was retaken during the
+// syscall. Zero disables the spin. Accessed atomically.
+var syscallReacquireSpin uint32
+
+// syscallRetaken counts the syscalls during which the P of the calling
+// goroutine was handed to another M, and syscallRetakenSameP those of
+// them after which the goroutine still continued on that P. Accessed
+// atomically.
+var syscallRetaken uint64
+var syscallRetakenSameP uint64
+
+// maxSyscallReacquireSpin bounds syscallReacquireSpin, and
+// maxSyscallReacquireSpinTime bounds the time in nanoseconds the spin
+// takes, so that a goroutine leaving a syscall never spins for more
+// than a few tens of microseconds.
+const (
+	maxSyscallReacquireSpin     = 1000
+	maxSyscallReacquireSpinTime = 20 * 1000
+)
+
+// SetSyscallReacquireSpin sets how hard a goroutine returning from a
+// system call tries to continue on the same P (logical processor) it
+// was running on before the call, when that P was handed to another
+// thread during the call. n is the number of short spin iterations to
+// spend waiting for the old P to become idle before settling for any
+// other idle P. Favoring the old P improves cache and timer locality
+// for workloads that make frequent short system calls, at the cost of
+// a little CPU time on each syscall exit. The runtime/metrics
+// /sched/syscalls/retaken:events and
+// /sched/syscalls/retaken-same-p:events show how often that happens.
+//
+// n is clamped to a small upper bound, and the spin stops after a few
+// tens of microseconds however large n is; n <= 0 disables the spin,
+// which is the default.
+func SetSyscallReacquireSpin(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n > maxSyscallReacquireSpin {
+		n = maxSyscallReacquireSpin
+	}
+	atomic.Store(&syscallReacquireSpin, uint32(n))
+}
+
+// syscallReacquireWait spins for up to spin iterations, and no longer
+// than maxSyscallReacquireSpinTime, waiting for oldp to become idle.
+func syscallReacquireWait(oldp *p, spin uint32) {
+	end := nanotime() + maxSyscallReacquireSpinTime
+	for i := uint32(0); i < spin && atomic.Load(&oldp.status) != _Pidle; i++ {
+		procyield(active_spin_cnt)
+		if nanotime() >= end {
+			break
+		}
+	}
+}
+
+func exitsyscallfast_pidle(oldp *p) bool {
+	spin := atomic.Load(&syscallReacquireSpin)
+	if oldp == nil {
+		spin = 0
+	}
+	if spin != 0 {
+		syscallReacquireWait(oldp, spin)
+	}
 	lock(&sched.lock)
-	_p_ := pidleget()
+	var _p_ *p
+	if spin != 0 && oldp.status == _Pidle {
+		_p_ = pidlegetp(oldp)
+	}
+	if _p_ == nil {
+		_p_ = pidleget()
+	}
 	if _p_ != nil && atomic.Load(&sched.sysmonwait) != 0 {
 		atomic.Store(&sched.sysmonwait, 0)
 		notewakeup(&sched.sysmonnote)
 	}
 	unlock(&sched.lock)
 	if _p_ != nil {
+		if _p_ == oldp {
+			atomic.Xadd64(&syscallRetakenSameP, 1)
+		}
 		acquirep(_p_)
 		return true
 	}
@@ -4249,6 +5546,61 @@ func newproc(siz int32, fn *funcval) {
 			wakep() // 注释：[newproc]（启动线程）唤醒P，就是拿个M运行P里的G，如果没有则自旋
 		}
 	})
+
+	// fn's arguments have been copied to the new goroutine, so from
+	// here on the stack may move.
+	if max := atomic.Load(&goroutineLimit.max); max != 0 && gcount() > int32(max) && !goroutineLimitExempt(gp, fn, pc) {
+		goroutineLimitExceeded(max)
+	}
+}
+
+// goroutineLimitExempt reports whether the go statement at callerpc,
+// run by gp to start fn, is exempt from the limit set by
+// SetMaxGoroutines. Goroutines started by the runtime, such as the
+// mark workers started by gcStart with worldsema held, and system
+// goroutines are exempt, as is any go statement run with runtime
+// locks held or on the system stack, such as by timer functions:
+// neither onExceed nor the crash without one is safe there.
+//
+//go:nosplit
+func goroutineLimitExempt(gp *g, fn *funcval, callerpc uintptr) bool {
+	if gp.m.locks > 0 || gp != gp.m.curg {
+		return true
+	}
+	if f := findfunc(fn.fn); f.valid() && hasPrefix(funcname(f), "runtime.") {
+		return true
+	}
+	f := findfunc(callerpc)
+	return f.valid() && hasPrefix(funcname(f), "runtime.")
+}
+
+// goroutineLimit is the limit on the number of goroutines set by
+// runtime/debug.SetMaxGoroutines.
+var goroutineLimit struct {
+	max      uint32 // maximum number of goroutines, or 0 for no limit; accessed atomically
+	onExceed func() // called when a go statement exceeds max; protected by sched.lock
+	running  uint32 // 1 while a goroutine is calling onExceed; accessed atomically
+}
+
+// goroutineLimitExceeded is called by a goroutine whose go statement
+// raised the number of goroutines above max. It calls the onExceed
+// function set by SetMaxGoroutines, unless another goroutine is
+// already doing so, which also keeps go statements in onExceed from
+// calling it again. Without an onExceed function it crashes the
+// program, as exceeding the thread limit does.
+func goroutineLimitExceeded(max uint32) {
+	lock(&sched.lock)
+	fn := goroutineLimit.onExceed
+	unlock(&sched.lock)
+	if fn == nil {
+		print("runtime: program exceeds ", max, "-goroutine limit\n")
+		throw("goroutine exhaustion")
+	}
+	if !atomic.Cas(&goroutineLimit.running, 0, 1) {
+		return
+	}
+	defer atomic.Store(&goroutineLimit.running, 0)
+	fn()
 }
 
 // Create a new g in state _Grunnable, starting at fn, with narg bytes
@@ -4371,6 +5723,12 @@ func newproc1(fn *funcval, argp unsafe.Pointer, narg int32, callergp *g, callerp
 	if _g_.m.curg != nil {                         // 注释：如果线程M正在运行G存在时
 		newg.labels = _g_.m.curg.labels // 注释：如果线程M正在运行G存在时，同步探测器标签
 	}
+	newg.lastpid = 0
+	newg.timeSlice = 0
+	newg.spawnTime = 0
+	if atomic.Load(&spawnToRunEnabled) != 0 {
+		newg.spawnTime = nanotime()
+	}
 	if isSystemGoroutine(newg, false) { // 注释：是否是系统函数调用（runtime包里的函数）
 		atomic.Xadd(&sched.ngsys, +1) // 注释：标记系统函数调用的次数
 	}
@@ -4400,6 +5758,82 @@ func newproc1(fn *funcval, argp unsafe.Pointer, narg int32, callergp *g, callerp
 	return newg // 注释：返回新的G
 }
 
+// spawnToRunEnabled is 1 if newproc1 should timestamp new goroutines
+// so that execute can record their spawn-to-run latency in
+// spawnToRunDist. Accessed atomically.
+var spawnToRunEnabled uint32
+
+// spawnToRunDist is the distribution of the time between the creation
+// of a goroutine and the first time it runs.
+var spawnToRunDist timeHistogram
+
+// SetSpawnToRunTracking enables or disables measurement of how long
+// newly created goroutines wait between their go statement and the
+// first time they run, as reported by SpawnToRunHistogram. It is
+// disabled by default; when enabled, each go statement and first
+// execution of a goroutine read the clock.
+func SetSpawnToRunTracking(enabled bool) {
+	var v uint32
+	if enabled {
+		v = 1
+	}
+	atomic.Store(&spawnToRunEnabled, v)
+}
+
+// SpawnToRunHistogram returns the distribution of spawn-to-run latency
+// for goroutines created while tracking was enabled by
+// SetSpawnToRunTracking. The result uses the same layout as the
+// runtime/metrics Float64Histogram type: buckets holds the bucket
+// boundaries in seconds in increasing order, and counts[i] is the
+// number of goroutines whose latency fell in [buckets[i], buckets[i+1]).
+// The first bucket starts at -Inf to catch negative clock readings, and
+// the last one extends to +Inf.
+func SpawnToRunHistogram() (counts []uint64, buckets []float64) {
+	buckets = timeHistogramMetricsBuckets()
+	counts = make([]uint64, len(buckets)-1)
+	counts[0] = atomic.Load64(&spawnToRunDist.underflow)
+	for i := range spawnToRunDist.counts {
+		counts[i+1] = atomic.Load64(&spawnToRunDist.counts[i])
+	}
+	return counts, buckets
+}
+
+// schedLatencyEnabled is 1 if ready should timestamp the goroutines it
+// makes runnable so that execute can record their scheduling latency
+// in schedLatencyDist. Accessed atomically.
+var schedLatencyEnabled uint32
+
+// schedLatencyDist is the distribution of the time between a goroutine
+// being made runnable by ready and it running.
+var schedLatencyDist timeHistogram
+
+// SetSchedLatencyTracking enables or disables measurement of the
+// scheduling latency of goroutines, the time between a blocked
+// goroutine being woken, for example by a channel operation, a mutex
+// unlock or a timer, and it running again, as reported by
+// SchedLatencyHistogram. It is disabled by default; when enabled, each
+// wakeup and the following execution of the goroutine read the clock.
+func SetSchedLatencyTracking(enabled bool) {
+	var v uint32
+	if enabled {
+		v = 1
+	}
+	atomic.Store(&schedLatencyEnabled, v)
+}
+
+// SchedLatencyHistogram returns the distribution of the scheduling
+// latency of goroutines woken while tracking was enabled by
+// SetSchedLatencyTracking, in the same layout as SpawnToRunHistogram.
+func SchedLatencyHistogram() (counts []uint64, buckets []float64) {
+	buckets = timeHistogramMetricsBuckets()
+	counts = make([]uint64, len(buckets)-1)
+	counts[0] = atomic.Load64(&schedLatencyDist.underflow)
+	for i := range schedLatencyDist.counts {
+		counts[i+1] = atomic.Load64(&schedLatencyDist.counts[i])
+	}
+	return counts, buckets
+}
+
 // saveAncestors copies previous ancestors of the given caller g and
 // includes infor for the current caller into a new set of tracebacks for
 // a g being created.
@@ -4434,6 +5868,41 @@ func saveAncestors(callergp *g) *[]ancestorInfo {
 	return ancestorsp
 }
 
+// An AncestorRecord describes a goroutine in the chain of goroutines
+// that created another one, as reported by GoroutineAncestry.
+type AncestorRecord struct {
+	Goid int64     // ID of the goroutine, which may have exited since
+	GoPC uintptr   // PC of the go statement that created the goroutine
+	PCs  []uintptr // return PCs of the goroutine's stack when it created its child
+}
+
+// GoroutineAncestry fills buf with the goroutines that created the
+// calling goroutine, starting with its parent, then the parent's
+// parent and so on, and returns the number of records written. It
+// returns fewer records than len(buf) only if the chain ends sooner.
+//
+// The runtime only records a goroutine's ancestors, up to N of them,
+// when the program runs with GODEBUG=tracebackancestors=N; otherwise
+// GoroutineAncestry returns 0. The main goroutine and goroutines
+// started by the runtime have no recorded ancestors.
+func GoroutineAncestry(buf []AncestorRecord) int {
+	gp := getg()
+	if gp.ancestors == nil {
+		return 0
+	}
+	n := 0
+	for _, a := range *gp.ancestors {
+		if n == len(buf) {
+			break
+		}
+		pcs := make([]uintptr, len(a.pcs))
+		copy(pcs, a.pcs)
+		buf[n] = AncestorRecord{Goid: a.goid, GoPC: a.gopc, PCs: pcs}
+		n++
+	}
+	return n
+}
+
 // Put on gfree list.
 // If local list is too long, transfer a batch to the global list.
 // 注释：译：列入gfree list里。如果本地列表太长，请将一个批转移到全局列表。
@@ -4680,6 +6149,28 @@ func badunlockosthread() {
 	throw("runtime: internal error: misuse of lockOSThread/unlockOSThread")
 }
 
+// IsLockedToThread reports whether the calling goroutine is wired to
+// its current operating system thread, by LockOSThread or because the
+// runtime requires it, as it does for the main goroutine while init
+// functions run. On platforms without threads, such as js/wasm, it
+// reports false.
+//go:nosplit
+func IsLockedToThread() bool {
+	return getg().lockedm != 0
+}
+
+// OnSystemStack reports whether the caller is running on one of the
+// current thread's system stacks, the scheduler stack or the signal
+// handling stack, rather than on a goroutine stack. Go code normally
+// runs on goroutine stacks; this is for code that may also be called
+// from runtime hooks, such as the observer set by SetGoyieldObserver,
+// to check which case it is in.
+//go:nosplit
+func OnSystemStack() bool {
+	gp := getg()
+	return gp == gp.m.g0 || gp == gp.m.gsignal
+}
+
 // 注释：统计已使用G的个数
 // 注释：步骤：
 //		1.全局业务G个数(已使用的) = 获取全部G点个数 - 全局空闲G个数 - 系统G个数
@@ -4998,7 +6489,9 @@ func setcpuprofilerate(hz int32) {
 // previously destroyed p, and transitions it to status _Pgcstop.
 func (pp *p) init(id int32) {
 	pp.id = id
+	pp.numaNode = -1
 	pp.status = _Pgcstop
+	pStatusChanged(pp, _Pdead, _Pgcstop)
 	pp.sudogcache = pp.sudogbuf[:0]
 	for i := range pp.deferpool {
 		pp.deferpool[i] = pp.deferpoolbuf[i][:0]
@@ -5055,7 +6548,9 @@ func (pp *p) destroy() {
 		globrunqputhead(pp.runnext.ptr())
 		pp.runnext = 0
 	}
-	if len(pp.timers) > 0 {
+	// Forget any timer migration sysmon had planned for pp.
+	atomic.Cas(&timerBalance.src, uint32(pp.id)+1, 0)
+	if len(pp.timers) > 0 || pp.timerWheel != nil && pp.timerWheel.n > 0 {
 		plocal := getg().m.p.ptr()
 		// The world is stopped, but we acquire timersLock to
 		// protect against sysmon calling timeSleepUntil.
@@ -5064,6 +6559,9 @@ func (pp *p) destroy() {
 		lock(&plocal.timersLock)
 		lock(&pp.timersLock)
 		moveTimers(plocal, pp.timers)
+		if pp.timerWheel != nil {
+			moveTimers(plocal, pp.timerWheel.all())
+		}
 		pp.timers = nil
 		pp.numTimers = 0
 		pp.deletedTimers = 0
@@ -5076,6 +6574,8 @@ func (pp *p) destroy() {
 		wbBufFlush1(pp)
 		pp.gcw.dispose()
 	}
+	wbBufRetired.add(&pp.wbStats)
+	pp.wbStats = wbBufStats{}
 	for i := range pp.sudogbuf {
 		pp.sudogbuf[i] = nil
 	}
@@ -5092,6 +6592,7 @@ func (pp *p) destroy() {
 			mheap_.spanalloc.free(unsafe.Pointer(pp.mspancache.buf[i]))
 		}
 		pp.mspancache.len = 0
+		pp.lcache.flush(&mheap_, true)
 		lock(&mheap_.lock)
 		pp.pcache.flush(&mheap_.pages)
 		unlock(&mheap_.lock)
@@ -5120,7 +6621,9 @@ func (pp *p) destroy() {
 		pp.raceprocctx = 0
 	}
 	pp.gcAssistTime = 0
+	old := pp.status
 	pp.status = _Pdead
+	pStatusChanged(pp, old, _Pdead)
 }
 
 // Change number of processors.
@@ -5203,6 +6706,7 @@ func procresize(nprocs int32) *p {
 	if _g_.m.p != 0 && _g_.m.p.ptr().id < nprocs {
 		// continue to use the current P
 		_g_.m.p.ptr().status = _Prunning
+		pStatusChanged(_g_.m.p.ptr(), _Pgcstop, _Prunning)
 		_g_.m.p.ptr().mcache.prepareForSweep()
 	} else {
 		// release the current P and acquire allp[0].
@@ -5224,6 +6728,7 @@ func procresize(nprocs int32) *p {
 		p := allp[0]
 		p.m = 0
 		p.status = _Pidle
+		pStatusChanged(p, _Pgcstop, _Pidle)
 		acquirep(p) // 注释：绑定m和p
 		if trace.enabled {
 			traceGoStart()
@@ -5256,6 +6761,7 @@ func procresize(nprocs int32) *p {
 			continue
 		}
 		p.status = _Pidle
+		pStatusChanged(p, _Pgcstop, _Pidle)
 		if runqempty(p) {
 			pidleput(p)
 		} else {
@@ -5267,6 +6773,9 @@ func procresize(nprocs int32) *p {
 	stealOrder.reset(uint32(nprocs))
 	var int32p *int32 = &gomaxprocs // make compiler check that gomaxprocs is an int32
 	atomic.Store((*uint32)(unsafe.Pointer(int32p)), uint32(nprocs))
+	if fn := procResizeObserver; fn != nil && old != nprocs {
+		fn(old, nprocs)
+	}
 	return runnablePs
 }
 
@@ -5285,7 +6794,11 @@ func acquirep(_p_ *p) {
 
 	// Perform deferred mcache flush before this P can allocate
 	// from a potentially stale mcache.
-	_p_.mcache.prepareForSweep()
+	if _p_.mcache.prepareForSweep() {
+		if fn := mcacheStaleObserver; fn != nil {
+			fn(_p_.id)
+		}
+	}
 
 	if trace.enabled {
 		traceProcStart()
@@ -5319,6 +6832,10 @@ func wirep(_p_ *p) {
 	_g_.m.p.set(_p_)       // 注释：m绑定p
 	_p_.m.set(_g_.m)       // 注释：p绑定m
 	_p_.status = _Prunning // 注释：修改p的状态为运行中
+	pStatusChanged(_p_, _Pidle, _Prunning)
+	if numaSteal || numaHeap.enabled {
+		_p_.numaNode = mNUMANode(_g_.m)
+	}
 }
 
 // Disassociate p and the current m.
@@ -5340,6 +6857,7 @@ func releasep() *p {
 	if trace.enabled {
 		traceProcStop(_g_.m.p.ptr())
 	}
+	pStatusChanged(_p_, _Prunning, _Pidle)
 	// 注释：g和m相互解除绑定
 	_g_.m.p = 0         // 注释：解除m和p的绑定
 	_p_.m = 0           // 注释：解除p和m的绑定
@@ -5347,6 +6865,42 @@ func releasep() *p {
 	return _p_          // 注释：返回解除绑定后的p
 }
 
+// pStatusObserver, if non-nil, is called by pStatusChanged.
+var pStatusObserver func(pid int32, from, to uint8)
+
+// pStatusChanged reports the transition of pp's status from from to to
+// to pStatusObserver, if any. It runs the observer on the system stack,
+// so it may be called wherever pp's status changes, even where the
+// stack must not split.
+//
+//go:nosplit
+func pStatusChanged(pp *p, from, to uint32) {
+	if fn := pStatusObserver; fn != nil {
+		id := pp.id
+		systemstack(func() {
+			fn(id, uint8(from), uint8(to))
+		})
+	}
+}
+
+// SetPTransitionObserver arranges for fn to be called each time a P
+// (logical processor) changes status, passing the ID of the P and its
+// old and new status. Statuses are reported as 0 (idle: not running
+// user code, for instance waiting for work), 1 (running: owned by a
+// thread running user or scheduler code), 2 (syscall: its thread is in
+// a system call), 3 (stopped: halted to stop the world) and 4 (dead: no
+// longer used after a reduction of GOMAXPROCS). P's created when
+// GOMAXPROCS grows are reported as going from dead to stopped.
+// Together the calls give a complete timeline of each P's state.
+//
+// fn is called on the scheduler's most critical paths, on the system
+// stack and often with scheduler locks held. It must not allocate,
+// block or otherwise call into the runtime, and should do as little as
+// possible. Passing nil removes the observer.
+func SetPTransitionObserver(fn func(pid int32, from, to uint8)) {
+	pStatusObserver = fn
+}
+
 func incidlelocked(v int32) {
 	lock(&sched.lock)
 	sched.nmidlelocked += v
@@ -5450,14 +7004,25 @@ func checkdead() {
 
 	// There are no goroutines running, so we can look at the P's.
 	for _, _p_ := range allp {
-		if len(_p_.timers) > 0 {
+		if len(_p_.timers) > 0 || _p_.timerWheel != nil && _p_.timerWheel.n > 0 {
 			return
 		}
 	}
+	if atomic.Load64(&coarseTimers.next) != 0 {
+		// sysmon will wake the goroutine that runs coarse timers.
+		return
+	}
 
+	// Print what the goroutines are blocked on after the error, which
+	// throw would print first.
+	blockedDeadlock.collect()
 	getg().m.throwing = -1 // do not dump full stacks
 	unlock(&sched.lock)    // unlock so that GODEBUG=scheddetail=1 doesn't hang
-	throw("all goroutines are asleep - deadlock!")
+	systemstack(func() {
+		print("fatal error: all goroutines are asleep - deadlock!\n")
+		blockedDeadlock.print()
+	})
+	fatalthrow("all goroutines are asleep - deadlock!")
 }
 
 // forcegcperiod is the maximum time in nanoseconds between garbage
@@ -5467,6 +7032,27 @@ func checkdead() {
 // This is a variable for testing purposes. It normally doesn't change.
 var forcegcperiod int64 = 2 * 60 * 1e9
 
+// sysmonNetpollObserver, if non-nil, is called by sysmon after each of
+// its network polls.
+var sysmonNetpollObserver func(readied int, nanos int64)
+
+// SetSysmonNetpollObserver arranges for fn to be called each time the
+// runtime's background monitor thread polls the network because no
+// other thread has done so for a while. fn is passed the number of
+// goroutines whose I/O the poll found ready and the time the poll took
+// in nanoseconds. Polls that frequently ready goroutines mean network
+// I/O is being picked up late, by this fallback rather than by the
+// scheduler itself.
+//
+// fn is called on the monitor thread, which runs without a P (logical
+// processor), before the goroutines are made runnable. It must not
+// allocate, write pointers into the heap, block or otherwise call into
+// the runtime, and should do as little as possible. Passing nil removes
+// the observer.
+func SetSysmonNetpollObserver(fn func(readied int, nanos int64)) {
+	sysmonNetpollObserver = fn
+}
+
 // Always runs without a P, so write barriers are not allowed.
 // 注释：译：总是在没有P的情况下运行，因此不允许出现写障碍。
 //
@@ -5483,6 +7069,7 @@ func sysmon() {
 	atomic.Store(&sched.sysmonStarting, 0)
 
 	lasttrace := int64(0)
+	lastlcflush := int64(0)
 	idle := 0 // how many cycles in succession we had not wokeup somebody
 	delay := uint32(0)
 
@@ -5495,6 +7082,23 @@ func sysmon() {
 		if delay > 10*1000 { // up to 10ms
 			delay = 10 * 1000
 		}
+		if atomic.Load(&timeSlices.stale) != 0 {
+			updateMinTimeSlice()
+		}
+		if min := atomic.Load64(&minTimeSlice); min != 0 && uint64(delay) > min/2000 {
+			// Check on goroutines with short time slices in time.
+			delay = uint32(min / 2000)
+			if delay < 20 {
+				delay = 20
+			}
+		}
+		if wakepDelay != 0 && int64(delay) > wakepDelay/1000 {
+			// Make the calls to wakep left by readyWakep in time.
+			delay = uint32(wakepDelay / 1000)
+			if delay < 20 {
+				delay = 20
+			}
+		}
 		usleep(delay)
 		mDoFixup()
 
@@ -5528,6 +7132,10 @@ func sysmon() {
 					if next-now < sleep {
 						sleep = next - now
 					}
+					if t := int64(atomic.Load64(&longSyscallThreshold)); t != 0 && t < sleep {
+						// Keep checking for long syscalls.
+						sleep = t
+					}
 					shouldRelax := sleep >= osRelaxMinNS
 					if shouldRelax {
 						osRelax(true)
@@ -5562,7 +7170,20 @@ func sysmon() {
 		lastpoll := int64(atomic.Load64(&sched.lastpoll))
 		if netpollinited() && lastpoll != 0 && lastpoll+10*1000*1000 < now {
 			atomic.Cas64(&sched.lastpoll, uint64(lastpoll), uint64(now))
-			list := netpoll(0) // non-blocking - returns list of goroutines
+			observer := sysmonNetpollObserver
+			var start int64
+			if observer != nil {
+				start = nanotime()
+			}
+			list := netpollCounted(0) // non-blocking - returns list of goroutines
+			if observer != nil {
+				cost := nanotime() - start
+				readied := 0
+				for gp := list.head.ptr(); gp != nil; gp = gp.schedlink.ptr() {
+					readied++
+				}
+				observer(readied, cost)
+			}
 			if !list.empty() {
 				// Need to decrement number of idle locked M's
 				// (pretending that one more is running) before injectglist.
@@ -5601,6 +7222,22 @@ func sysmon() {
 			// Kick the scavenger awake if someone requested it.
 			wakeScavenger()
 		}
+		if now-lastlcflush > largePageCacheFlushPeriod {
+			// Return large object pages the P's haven't reused.
+			flushLargePageCaches(false)
+			lastlcflush = now
+		}
+		if atomic.Load(&timerBalance.enabled) != 0 {
+			sysmonBalanceTimers(now)
+		}
+		sysmonCoarseTimers(now)
+		sysmonLongSyscalls(now)
+		sysmonDeadlines(now)
+		sysmonSchedStalls(now)
+		sysmonIdleMs(now)
+		if wakepDelay != 0 {
+			sysmonWakep(now)
+		}
 		// retake P's blocked in syscalls
 		// and preempt long running G's
 		if retake(now) != 0 {
@@ -5609,14 +7246,23 @@ func sysmon() {
 			idle++
 		}
 		// check if we need to force a GC
-		if t := (gcTrigger{kind: gcTriggerTime, now: now}); t.test() && atomic.Load(&forcegc.idle) != 0 {
+		t := gcTrigger{kind: gcTriggerTime, now: now}
+		if !t.test() {
+			t.kind = gcTriggerMemoryLimit
+		}
+		if t.test() && atomic.Load(&forcegc.idle) != 0 {
 			lock(&forcegc.lock)
 			forcegc.idle = 0
+			forcegc.kind = t.kind
 			var list gList
 			list.push(forcegc.g)
 			injectglist(&list)
 			unlock(&forcegc.lock)
 		}
+		if atomic.Load(&autoProcs.enabled) != 0 && now-autoProcs.last >= autoProcsPeriod {
+			autoProcs.last = now
+			sysmonUpdateProcs()
+		}
 		if debug.schedtrace > 0 && lasttrace+int64(debug.schedtrace)*1000000 <= now {
 			lasttrace = now
 			schedtrace(debug.scheddetail > 0)
@@ -5631,12 +7277,345 @@ type sysmontick struct {
 	schedwhen   int64  // 注释：处理器P上次调度时间
 	syscalltick uint32 // 注释：系统调度次数
 	syscallwhen int64  // 注释：系统调度时间
+	stallwhen   int64  // schedwhen of the last stall reported by sysmonSchedStalls
 }
 
 // forcePreemptNS is the time slice given to a G before it is
 // preempted.
 const forcePreemptNS = 10 * 1000 * 1000 // 10ms
 
+// pTimeSlice returns the time slice of the G running on _p_.
+func pTimeSlice(_p_ *p) int64 {
+	if t := atomic.Load64(&_p_.timeSlice); t != 0 {
+		return int64(t)
+	}
+	return forcePreemptNS
+}
+
+// minTimeSlice is the shortest time slice of any goroutine set with
+// SetGoroutineTimeSlice, or 0 if there is none. sysmon checks for
+// goroutines to preempt at least twice as often. Accessed atomically.
+//
+// minTimeSlice may be too short for a while after a goroutine with a
+// short time slice exits or lengthens its time slice, until sysmon
+// recomputes it.
+var minTimeSlice uint64
+
+var timeSlices struct {
+	// lock protects changes to minTimeSlice, to the time slices
+	// of goroutines and to head.
+	lock mutex
+
+	// head is the list, linked through g.timeSliceNext, of the
+	// goroutines with a time slice set.
+	head guintptr
+
+	// stale is set when minTimeSlice may be shorter than the time
+	// slice of every goroutine. Accessed atomically.
+	stale uint32
+}
+
+// timeSliceRemove removes gp from timeSlices.head.
+// timeSlices.lock must be held.
+func timeSliceRemove(gp *g) {
+	for pp := &timeSlices.head; pp.ptr() != nil; pp = &pp.ptr().timeSliceNext {
+		if pp.ptr() == gp {
+			*pp = gp.timeSliceNext
+			gp.timeSliceNext = 0
+			return
+		}
+	}
+}
+
+// updateMinTimeSlice recomputes minTimeSlice from the time slices of
+// the goroutines on timeSlices.head. It is called by sysmon after
+// minTimeSlice went stale.
+func updateMinTimeSlice() {
+	lock(&timeSlices.lock)
+	atomic.Store(&timeSlices.stale, 0)
+	min := int64(0)
+	for gp := timeSlices.head.ptr(); gp != nil; gp = gp.timeSliceNext.ptr() {
+		if t := gp.timeSlice; min == 0 || t < min {
+			min = t
+		}
+	}
+	atomic.Store64(&minTimeSlice, uint64(min))
+	unlock(&timeSlices.lock)
+}
+
+// SetGoroutineTimeSlice sets the time slice of the calling goroutine,
+// the time it may run without blocking or yielding before the
+// scheduler preempts it in favor of other goroutines, to ns
+// nanoseconds. The default time slice is 10ms; ns <= 0 restores it.
+// Goroutines started by the calling goroutine get the default time
+// slice.
+//
+// A shorter time slice can reduce the scheduling latency of other
+// goroutines, such as ones with soft real-time deadlines, while the
+// calling goroutine runs long computations. The scheduler notices that
+// a time slice is over only at intervals, which become shorter, at some
+// CPU cost, while any goroutine has a short time slice, so the goroutine
+// can run for somewhat longer than ns, and time slices below about 50µs
+// have little more effect. Setting a time slice longer than the default makes the
+// goroutine less likely to be preempted.
+func SetGoroutineTimeSlice(ns int64) {
+	if ns < 0 {
+		ns = 0
+	}
+	mp := acquirem()
+	lock(&timeSlices.lock)
+	gp := mp.curg
+	old := gp.timeSlice
+	if old == 0 && ns != 0 {
+		gp.timeSliceNext = timeSlices.head
+		timeSlices.head.set(gp)
+	} else if old != 0 && ns == 0 {
+		timeSliceRemove(gp)
+	}
+	gp.timeSlice = ns
+	min := atomic.Load64(&minTimeSlice)
+	if ns != 0 && (min == 0 || uint64(ns) < min) {
+		atomic.Store64(&minTimeSlice, uint64(ns))
+	} else if old != 0 && uint64(old) == min && ns != old {
+		atomic.Store(&timeSlices.stale, 1)
+	}
+	unlock(&timeSlices.lock)
+	atomic.Store64(&mp.p.ptr().timeSlice, uint64(ns))
+	releasem(mp)
+}
+
+// longSyscallThreshold is the time, in nanoseconds, a syscall must
+// run for sysmon to report it to longSyscallObserver. Zero disables
+// the reports. Accessed atomically.
+var longSyscallThreshold uint64
+
+// longSyscallObserver, if non-nil, is called by sysmonLongSyscalls
+// for syscalls that run longer than longSyscallThreshold.
+var longSyscallObserver func(goid int64, pc uintptr, nanos int64)
+
+// SetLongSyscallThreshold sets the time, in nanoseconds, after which a
+// system call, or a call to C through cgo, is reported to the observer
+// installed by SetLongSyscallObserver. Only calls that start after the
+// threshold is set are reported. ns <= 0 disables the reports, which is
+// the default.
+func SetLongSyscallThreshold(ns int64) {
+	if ns < 0 {
+		ns = 0
+	}
+	atomic.Store64(&longSyscallThreshold, uint64(ns))
+}
+
+// SetLongSyscallObserver arranges for fn to be called once for each
+// system call or cgo call that runs longer than the threshold set by
+// SetLongSyscallThreshold, while the call is still running. fn is
+// passed the ID of the goroutine making the call, the PC from which it
+// was made, and how long it has been running, in nanoseconds. Calls
+// are checked periodically, so they are reported some time after they
+// exceed the threshold: up to 10ms while the program is busy, and up
+// to the threshold itself while it is idle.
+//
+// fn runs on the system monitor thread, which runs without a P and
+// watches over the scheduler. It must not allocate, write pointers to
+// the heap, block or otherwise call into the runtime, and should
+// return quickly. Passing nil removes the observer.
+func SetLongSyscallObserver(fn func(goid int64, pc uintptr, nanos int64)) {
+	longSyscallObserver = fn
+}
+
+// sysmonLongSyscalls reports the syscalls that have run for longer than
+// longSyscallThreshold to longSyscallObserver.
+//
+//go:nowritebarrierrec
+func sysmonLongSyscalls(now int64) {
+	fn := longSyscallObserver
+	threshold := int64(atomic.Load64(&longSyscallThreshold))
+	if fn == nil || threshold == 0 {
+		return
+	}
+	for mp := (*m)(atomic.Loadp(unsafe.Pointer(&allm))); mp != nil; mp = mp.alllink {
+		seq := atomic.Load(&mp.syscallseq)
+		if seq == mp.syscallseen {
+			continue
+		}
+		when := mp.syscallwhen
+		gp := mp.curg
+		if when == 0 || now-when < threshold || gp == nil || readgstatus(gp)&^_Gscan != _Gsyscall {
+			continue
+		}
+		goid, pc := gp.goid, gp.syscallpc
+		if atomic.Load(&mp.syscallseq) != seq {
+			// The M entered another syscall meanwhile.
+			continue
+		}
+		mp.syscallseen = seq
+		fn(goid, pc, now-when)
+	}
+}
+
+// idleMTimeout is the time, in nanoseconds, after which sysmonIdleMs
+// makes an idle M exit, or 0 to keep idle Ms. Accessed atomically.
+var idleMTimeout uint64
+
+//go:linkname setIdleThreadTimeout runtime/debug.setIdleThreadTimeout
+func setIdleThreadTimeout(ns int64) int64 {
+	if ns < 0 {
+		ns = 0
+	}
+	if GOOS == "plan9" || GOOS == "js" {
+		// Threads can't exit (plan9), or there is no sysmon (js).
+		return 0
+	}
+	return int64(atomic.Xchg64(&idleMTimeout, uint64(ns)))
+}
+
+// sysmonIdleMs makes the Ms that have been idle for longer than
+// idleMTimeout exit. Each of them is given an idle P, which mexit
+// hands off again, so that it exits the way an M whose locked
+// goroutine exits does; Ms are only made to exit while there are idle
+// Ps. m0, which can't exit, is kept.
+//
+//go:nowritebarrierrec
+func sysmonIdleMs(now int64) {
+	timeout := int64(atomic.Load64(&idleMTimeout))
+	if timeout == 0 || atomic.Load(&sched.npidle) == 0 {
+		return
+	}
+	lock(&sched.lock)
+	for link := &sched.midle; *link != 0; {
+		mp := link.ptr()
+		if mp == &m0 || now-mp.idleWhen < timeout {
+			link = &mp.schedlink
+			continue
+		}
+		pp := pidleget()
+		if pp == nil {
+			break
+		}
+		*link = mp.schedlink
+		sched.nmidle--
+		atomic.Xadd(&sched.nmidleexit, 1)
+		mp.idleExit = true
+		mp.nextp.set(pp)
+		notewakeup(&mp.park)
+	}
+	unlock(&sched.lock)
+}
+
+// schedStallThreshold is the time, in nanoseconds, for which a P may
+// not schedule a goroutine while others are runnable before
+// sysmonSchedStalls reports it, or 0 to use GODEBUG=schedstall.
+// Accessed atomically.
+var schedStallThreshold uint64
+
+// schedStallObserver, if non-nil, is called by sysmonSchedStalls for
+// each stalled P instead of printing a report.
+var schedStallObserver func(pid int32, runnable int32, nanos int64)
+
+// SetSchedStallThreshold sets the time, in nanoseconds, after which a
+// processor that has not scheduled another goroutine while goroutines
+// are waiting to run is reported as stalled, to the observer installed
+// by SetSchedStallObserver or, without one, on standard error with a
+// detailed dump of the scheduler state. ns <= 0 restores the threshold
+// set by GODEBUG=schedstall, which is to make no reports by default.
+//
+// A processor stalls when the goroutine running on it can't be
+// preempted, for example because it spins in a loop without function
+// calls while asynchronous preemption is disabled, or because it holds
+// the processor while it waits for a runtime lock.
+func SetSchedStallThreshold(ns int64) {
+	if ns < 0 {
+		ns = 0
+	}
+	atomic.Store64(&schedStallThreshold, uint64(ns))
+}
+
+// SetSchedStallObserver arranges for fn to be called once for each
+// stall of a processor reported according to SetSchedStallThreshold.
+// fn is passed the ID of the processor, the number of goroutines
+// waiting in its run queue and the scheduler's global run queue, and
+// how long it has been since the processor last scheduled a goroutine,
+// in nanoseconds. Processors are checked periodically, so stalls are
+// reported up to 10ms after they exceed the threshold.
+//
+// fn runs on the system monitor thread, which runs without a P and
+// watches over the scheduler, but holds no runtime locks while fn
+// runs. It must not allocate, write pointers to the heap, block or
+// otherwise call into the runtime, and should return quickly. Passing
+// nil removes the observer.
+func SetSchedStallObserver(fn func(pid int32, runnable int32, nanos int64)) {
+	schedStallObserver = fn
+}
+
+// schedStalls holds the stalls sysmonSchedStalls found, so that it can
+// report them to the observer after dropping allpLock. Only sysmon
+// uses it.
+var schedStalls [32]struct {
+	pid, runnable int32
+	nanos         int64
+}
+
+// sysmonSchedStalls reports the Ps that have not scheduled a goroutine
+// for longer than the stall threshold while goroutines are runnable.
+// It relies on retake having updated the Ps' sysmontick.
+//
+//go:nowritebarrierrec
+func sysmonSchedStalls(now int64) {
+	threshold := int64(atomic.Load64(&schedStallThreshold))
+	if threshold == 0 {
+		threshold = int64(debug.schedstall) * 1000 * 1000
+		if threshold == 0 {
+			return
+		}
+	}
+	fn := schedStallObserver
+	dump := false
+	for i := 0; ; {
+		// Collect up to len(schedStalls) stalls under allpLock,
+		// then call the observer without it, and repeat for the
+		// rest of allp.
+		n := 0
+		lock(&allpLock)
+		for ; i < len(allp) && n < len(schedStalls); i++ {
+			pp := allp[i]
+			if pp == nil {
+				continue
+			}
+			pd := &pp.sysmontick
+			if s := pp.status; s != _Prunning && s != _Psyscall || pd.stallwhen == pd.schedwhen || pd.schedtick != pp.schedtick || pd.schedwhen == 0 || now-pd.schedwhen < threshold {
+				continue
+			}
+			runnable := atomic.Load(&pp.runqtail) - atomic.Load(&pp.runqhead) + uint32(sched.runqsize)
+			if pp.runnext != 0 {
+				runnable++
+			}
+			if runnable == 0 {
+				continue
+			}
+			pd.stallwhen = pd.schedwhen
+			if fn != nil {
+				st := &schedStalls[n]
+				st.pid, st.runnable, st.nanos = pp.id, int32(runnable), now-pd.schedwhen
+				n++
+				continue
+			}
+			print("runtime: P ", pp.id, " has not scheduled a goroutine for ", (now-pd.schedwhen)/1000/1000, "ms with ", runnable, " runnable\n")
+			dump = true
+		}
+		more := i < len(allp)
+		unlock(&allpLock)
+		for j := 0; j < n; j++ {
+			st := &schedStalls[j]
+			fn(st.pid, st.runnable, st.nanos)
+		}
+		if !more {
+			break
+		}
+	}
+	if dump {
+		schedtrace(true)
+	}
+}
+
 func retake(now int64) uint32 {
 	n := 0
 	// Prevent allp slice changes. This lock will be completely
@@ -5661,7 +7640,7 @@ func retake(now int64) uint32 {
 			if int64(pd.schedtick) != t {
 				pd.schedtick = uint32(t)
 				pd.schedwhen = now
-			} else if pd.schedwhen+forcePreemptNS <= now {
+			} else if pd.schedwhen+pTimeSlice(_p_) <= now {
 				preemptone(_p_)
 				// In case of syscall, preemptone() doesn't
 				// work, because there is no M wired to P.
@@ -5690,6 +7669,7 @@ func retake(now int64) uint32 {
 			// increment nmidle and report deadlock.
 			incidlelocked(-1)
 			if atomic.Cas(&_p_.status, s, _Pidle) {
+				pStatusChanged(_p_, _Psyscall, _Pidle)
 				if trace.enabled {
 					traceGoSysBlock(_p_)
 					traceProcStop(_p_)
@@ -5769,30 +7749,175 @@ func preemptone(_p_ *p) bool {
 
 var starttime int64
 
+// SchedStats describes the state of the scheduler, as reported by
+// ReadSchedStats. It carries the information printed by
+// GODEBUG=schedtrace=X.
+type SchedStats struct {
+	IdleProcs       int // number of idle P's
+	Threads         int // number of M's
+	SpinningThreads int // number of M's spinning looking for work
+	IdleThreads     int // number of M's idle waiting for work
+	GlobalRunqueue  int // number of goroutines on the global run queue
+
+	// Procs describes each P, in order of ID. Its length is
+	// GOMAXPROCS.
+	Procs []PStats
+}
+
+// PStats describes the state of a single P, as reported in SchedStats.
+//
+// The tick and steal counters start at zero when the P is created and
+// wrap around; callers should compute the differences between two reads.
+type PStats struct {
+	ID          int32  // P's ID, which is also its index in SchedStats.Procs
+	Runqueue    int    // number of goroutines on the P's local run queue
+	Schedtick   uint32 // number of scheduler calls on the P
+	Syscalltick uint32 // number of system calls made from the P
+	Stolen      uint32 // number of goroutines the P stole from other P's
+}
+
+// ReadSchedStats populates s with statistics about the scheduler.
+// s.Procs is reused if it has enough capacity.
+//
+// The statistics are read while the scheduler keeps running, so they
+// are not a consistent snapshot.
+func ReadSchedStats(s *SchedStats) {
+	// Disable preemption so that allp can't change size under us.
+	mp := acquirem()
+	procs := s.Procs[:0]
+	if cap(procs) < len(allp) {
+		procs = make([]PStats, 0, len(allp))
+	}
+
+	lock(&sched.lock)
+	s.IdleProcs = int(sched.npidle)
+	s.Threads = int(mcount())
+	s.SpinningThreads = int(atomic.Load(&sched.nmspinning))
+	s.IdleThreads = int(sched.nmidle)
+	s.GlobalRunqueue = int(sched.runqsize)
+	for _, pp := range allp {
+		h := atomic.Load(&pp.runqhead)
+		t := atomic.Load(&pp.runqtail)
+		n := t - h
+		if n > uint32(len(pp.runq)) {
+			// Inconsistent read of a queue in flux.
+			n = 0
+		}
+		if pp.runnext != 0 {
+			n++
+		}
+		procs = append(procs, PStats{
+			ID:          pp.id,
+			Runqueue:    int(n),
+			Schedtick:   atomic.Load(&pp.schedtick),
+			Syscalltick: atomic.Load(&pp.syscalltick),
+			Stolen:      atomic.Load(&pp.stolen),
+		})
+	}
+	unlock(&sched.lock)
+	releasem(mp)
+	s.Procs = procs
+}
+
+// SchedPressure summarizes how far the scheduler is behind, as
+// reported by SchedulerPressure.
+type SchedPressure struct {
+	LocalRunnable    int   // goroutines waiting on the P's local run queues
+	MaxLocalRunnable int   // goroutines waiting on the longest local run queue
+	GlobalRunnable   int   // goroutines waiting on the global run queue
+	IdleProcs        int   // number of idle P's
+	BusyNanos        int64 // nanoseconds since a P was last idle, 0 if one is idle now
+}
+
+// SchedulerPressure reports how many goroutines are ready to run but
+// waiting for a P (logical processor), and for how long every P has
+// been busy. Servers can use it to shed load when the scheduler falls
+// behind: goroutines piling up on the run queues while no P has been
+// idle for a while mean that more work arrives than the program's
+// GOMAXPROCS can keep up with.
+//
+// SchedulerPressure doesn't stop or lock the scheduler, so it is cheap
+// enough to call for each request, but the numbers it reports are not
+// a consistent snapshot.
+func SchedulerPressure() SchedPressure {
+	var s SchedPressure
+	// Disable preemption so that allp can't change size under us.
+	mp := acquirem()
+	for _, pp := range allp {
+		h := atomic.Load(&pp.runqhead)
+		t := atomic.Load(&pp.runqtail)
+		n := int(t - h)
+		if n < 0 || n > len(pp.runq) {
+			// Inconsistent read of a queue in flux.
+			n = 0
+		}
+		if pp.runnext != 0 {
+			n++
+		}
+		s.LocalRunnable += n
+		if n > s.MaxLocalRunnable {
+			s.MaxLocalRunnable = n
+		}
+	}
+	releasem(mp)
+	s.GlobalRunnable = int(atomic.Load((*uint32)(unsafe.Pointer(&sched.runqsize))))
+	s.IdleProcs = int(atomic.Load(&sched.npidle))
+	if s.IdleProcs == 0 {
+		if busy := nanotime() - int64(atomic.Load64(&sched.busySince)); busy > 0 {
+			s.BusyNanos = busy
+		}
+	}
+	return s
+}
+
 func schedtrace(detailed bool) {
 	now := nanotime()
 	if starttime == 0 {
 		starttime = now
 	}
 
+	e := schedtraceEncoder{json: debug.schedtracejson > 0}
 	lock(&sched.lock)
-	print("SCHED ", (now-starttime)/1e6, "ms: gomaxprocs=", gomaxprocs, " idleprocs=", sched.npidle, " threads=", mcount(), " spinningthreads=", sched.nmspinning, " idlethreads=", sched.nmidle, " runqueue=", sched.runqsize)
+	e.begin((now - starttime) / 1e6)
+	e.int("gomaxprocs", int64(gomaxprocs))
+	e.int("idleprocs", int64(sched.npidle))
+	e.int("threads", int64(mcount()))
+	e.int("spinningthreads", int64(sched.nmspinning))
+	e.int("idlethreads", int64(sched.nmidle))
+	e.int("runqueue", int64(sched.runqsize))
 	if detailed {
-		print(" gcwaiting=", sched.gcwaiting, " nmidlelocked=", sched.nmidlelocked, " stopwait=", sched.stopwait, " sysmonwait=", sched.sysmonwait, "\n")
+		e.int("gcwaiting", int64(sched.gcwaiting))
+		e.int("nmidlelocked", int64(sched.nmidlelocked))
+		e.int("stopwait", int64(sched.stopwait))
+		e.int("sysmonwait", int64(sched.sysmonwait))
+		e.endLine()
 	}
 	// We must be careful while reading data from P's, M's and G's.
 	// Even if we hold schedlock, most data can be changed concurrently.
 	// E.g. (p->m ? p->m->id : -1) can crash if p->m changes from non-nil to nil.
+	e.beginList("p")
 	for i, _p_ := range allp {
 		mp := _p_.m.ptr()
 		h := atomic.Load(&_p_.runqhead)
 		t := atomic.Load(&_p_.runqtail)
-		if detailed {
-			id := int64(-1)
-			if mp != nil {
-				id = mp.id
+		if detailed || e.json {
+			e.beginObject("P", int64(i))
+			e.int("status", int64(_p_.status))
+			if detailed {
+				id := int64(-1)
+				if mp != nil {
+					id = mp.id
+				}
+				e.int("schedtick", int64(_p_.schedtick))
+				e.int("syscalltick", int64(_p_.syscalltick))
+				e.int("m", id)
+			}
+			e.int("runqsize", int64(t-h))
+			if detailed {
+				e.int("gfreecnt", int64(_p_.gFree.n))
+				e.int("timerslen", int64(len(_p_.timers)))
 			}
-			print("  P", i, ": status=", _p_.status, " schedtick=", _p_.schedtick, " syscalltick=", _p_.syscalltick, " m=", id, " runqsize=", t-h, " gfreecnt=", _p_.gFree.n, " timerslen=", len(_p_.timers), "\n")
+			e.endObject()
 		} else {
 			// In non-detailed mode format lengths of per-P run queues as:
 			// [len1 len2 len3 len4]
@@ -5806,12 +7931,15 @@ func schedtrace(detailed bool) {
 			}
 		}
 	}
+	e.endList()
 
 	if !detailed {
 		unlock(&sched.lock)
+		e.end()
 		return
 	}
 
+	e.beginList("m")
 	for mp := allm; mp != nil; mp = mp.alllink {
 		_p_ := mp.p.ptr()
 		gp := mp.curg
@@ -5828,9 +7956,25 @@ func schedtrace(detailed bool) {
 		if lockedg != nil {
 			id3 = lockedg.goid
 		}
-		print("  M", mp.id, ": p=", id1, " curg=", id2, " mallocing=", mp.mallocing, " throwing=", mp.throwing, " preemptoff=", mp.preemptoff, ""+" locks=", mp.locks, " dying=", mp.dying, " spinning=", mp.spinning, " blocked=", mp.blocked, " lockedg=", id3, "\n")
-	}
-
+		e.beginObject("M", mp.id)
+		e.int("p", int64(id1))
+		e.int("curg", id2)
+		e.int("mallocing", int64(mp.mallocing))
+		e.int("throwing", int64(mp.throwing))
+		e.string("preemptoff", mp.preemptoff)
+		e.int("locks", int64(mp.locks))
+		e.int("dying", int64(mp.dying))
+		e.bool("spinning", mp.spinning)
+		e.bool("blocked", mp.blocked)
+		e.int("lockedg", id3)
+		if mp.name[0] != 0 {
+			e.string("name", gostringnocopy(&mp.name[0]))
+		}
+		e.endObject()
+	}
+	e.endList()
+
+	e.beginList("g")
 	lock(&allglock)
 	for gi := 0; gi < len(allgs); gi++ {
 		gp := allgs[gi]
@@ -5844,10 +7988,141 @@ func schedtrace(detailed bool) {
 		if lockedm != nil {
 			id2 = lockedm.id
 		}
-		print("  G", gp.goid, ": status=", readgstatus(gp), "(", gp.waitreason.String(), ") m=", id1, " lockedm=", id2, "\n")
+		e.beginObject("G", gp.goid)
+		e.int("status", int64(readgstatus(gp)))
+		e.waitreason(gp.waitreason.String())
+		e.int("m", id1)
+		e.int("lockedm", id2)
+		e.endObject()
 	}
 	unlock(&allglock)
+	e.endList()
 	unlock(&sched.lock)
+	e.end()
+}
+
+// A schedtraceEncoder prints the state collected by schedtrace, either
+// in the text format or, with GODEBUG=schedtracejson=1, as a JSON
+// object on a single line. In the text format lists are not marked and
+// each object is printed on a line of its own. The encoder prints each
+// value as it goes, so it does not allocate.
+type schedtraceEncoder struct {
+	json  bool
+	first bool // next object is the first in its list
+}
+
+// begin starts the record for the time ms milliseconds after the first.
+func (e *schedtraceEncoder) begin(ms int64) {
+	if e.json {
+		print(`{"ms":`, ms)
+	} else {
+		print("SCHED ", ms, "ms:")
+	}
+}
+
+// end ends the record.
+func (e *schedtraceEncoder) end() {
+	if e.json {
+		print("}\n")
+	}
+}
+
+// endLine ends the line of the record's own fields in the text format.
+func (e *schedtraceEncoder) endLine() {
+	if !e.json {
+		print("\n")
+	}
+}
+
+func (e *schedtraceEncoder) beginList(name string) {
+	if e.json {
+		print(`,"`, name, `":[`)
+	}
+	e.first = true
+}
+
+func (e *schedtraceEncoder) endList() {
+	if e.json {
+		print("]")
+	}
+}
+
+// beginObject starts the object describing the P, M or G with the given
+// id. kind is "P", "M" or "G".
+func (e *schedtraceEncoder) beginObject(kind string, id int64) {
+	if e.json {
+		if !e.first {
+			print(",")
+		}
+		print(`{"id":`, id)
+	} else {
+		print("  ", kind, id, ":")
+	}
+	e.first = false
+}
+
+func (e *schedtraceEncoder) endObject() {
+	if e.json {
+		print("}")
+	} else {
+		print("\n")
+	}
+}
+
+func (e *schedtraceEncoder) int(name string, v int64) {
+	if e.json {
+		print(`,"`, name, `":`, v)
+	} else {
+		print(" ", name, "=", v)
+	}
+}
+
+func (e *schedtraceEncoder) bool(name string, v bool) {
+	if e.json {
+		print(`,"`, name, `":`, v)
+	} else {
+		print(" ", name, "=", v)
+	}
+}
+
+func (e *schedtraceEncoder) string(name, v string) {
+	if e.json {
+		print(`,"`, name, `":`)
+		e.quote(v)
+	} else {
+		print(" ", name, "=", v)
+	}
+}
+
+// waitreason prints a goroutine's wait reason, which the text format
+// puts in parentheses after its status.
+func (e *schedtraceEncoder) waitreason(v string) {
+	if e.json {
+		e.string("waitreason", v)
+	} else {
+		print("(", v, ")")
+	}
+}
+
+// quote prints s as a JSON string.
+func (e *schedtraceEncoder) quote(s string) {
+	const hex = "0123456789abcdef"
+	print(`"`)
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && c != '"' && c != '\\' {
+			continue
+		}
+		print(s[start:i], `\`)
+		if c == '"' || c == '\\' {
+			print(s[i : i+1])
+		} else {
+			print("u00", hex[c>>4:c>>4+1], hex[c&0xf:c&0xf+1])
+		}
+		start = i + 1
+	}
+	print(s[start:], `"`)
 }
 
 // schedEnableUser enables or disables the scheduling of user
@@ -5897,6 +8172,7 @@ func mput(mp *m) {
 	assertLockHeld(&sched.lock)
 
 	// 注释：把M加入空闲链表中
+	mp.idleWhen = nanotime()
 	mp.schedlink = sched.midle // 注释：把M加入空闲链表中,把旧链表的头放在mp.schedlink中,形成新的链表头(此时未和链表建立连接)
 	sched.midle.set(mp)        // 注释：把M加入空闲链表中,把新的链表头放在链表头位置
 	sched.nmidle++             // 注释：空闲M的数量加一
@@ -5926,6 +8202,9 @@ func mget() *m {
 func globrunqput(gp *g) {
 	assertLockHeld(&sched.lock)
 
+	if atomic.Load(&globrunqLatencyEnabled) != 0 {
+		gp.globrunqTime = nanotime()
+	}
 	sched.runq.pushBack(gp)
 	sched.runqsize++
 }
@@ -5937,6 +8216,9 @@ func globrunqput(gp *g) {
 func globrunqputhead(gp *g) {
 	assertLockHeld(&sched.lock)
 
+	if atomic.Load(&globrunqLatencyEnabled) != 0 {
+		gp.globrunqTime = nanotime()
+	}
 	sched.runq.push(gp)
 	sched.runqsize++
 }
@@ -5948,6 +8230,12 @@ func globrunqputhead(gp *g) {
 func globrunqputbatch(batch *gQueue, n int32) {
 	assertLockHeld(&sched.lock)
 
+	if atomic.Load(&globrunqLatencyEnabled) != 0 {
+		now := nanotime()
+		for gp := batch.head.ptr(); gp != nil; gp = gp.schedlink.ptr() {
+			gp.globrunqTime = now
+		}
+	}
 	sched.runq.pushBackAll(*batch) // 注释：把新链表加入到全局链表中
 	sched.runqsize += n            // 注释：把新链表的数量加到全局链表的数量里
 	*batch = gQueue{}              // 注释：清空新的链表
@@ -5978,16 +8266,75 @@ func globrunqget(_p_ *p, max int32) *g {
 
 	sched.runqsize -= n // 注释：(设置全局P队列数量为拿走之后的数据)全局队列个数减少n
 
+	var now int64
+	if atomic.Load(&globrunqLatencyEnabled) != 0 {
+		now = nanotime()
+	}
 	gp := sched.runq.pop() // 注释：全局G队列出栈1个(取出第一个G，后面有返回该数据)（准备执行，其余的放到本地队列里面）
+	globrunqDwell(gp, now)
 	n--
 	for ; n > 0; n-- { // 注释：剩下的放到本地P队列里
 		gp1 := sched.runq.pop()  // 注释：全局G队列循环出栈
 		runqput(_p_, gp1, false) // 注释：把其余的G放到本地P队列中
+		// gp1's globrunqTime is only used under sched.lock, so it's
+		// fine to clear it after gp1 becomes stealable.
+		globrunqDwell(gp1, now)
 	}
 	// 注释：拿走第一个G，其余的G放到本地P队列中
 	return gp
 }
 
+// globrunqLatencyEnabled is 1 if goroutines put on the global run
+// queue are timestamped so that globrunqget can record how long they
+// waited there in globrunqLatency. Accessed atomically.
+var globrunqLatencyEnabled uint32
+
+// globrunqLatency is the distribution of the time goroutines spent on
+// the global run queue.
+var globrunqLatency timeHistogram
+
+// globrunqDwell records the time gp spent on the global run queue, if
+// it was timestamped when it was put there. now is the current time,
+// or 0 if tracking is disabled.
+//go:nowritebarrierrec
+func globrunqDwell(gp *g, now int64) {
+	if gp.globrunqTime != 0 {
+		if now != 0 {
+			globrunqLatency.record(now - gp.globrunqTime)
+		}
+		gp.globrunqTime = 0
+	}
+}
+
+// SetGlobalQueueLatencyTracking enables or disables measurement of how
+// long runnable goroutines wait on the scheduler's global run queue
+// before a P takes them, as reported by GlobalQueueLatency. Goroutines
+// land on the global queue when a P's local run queue overflows, when
+// they come back from a system call without a P, and in a few other
+// cases, and generally wait longer there than on a local queue.
+// Tracking is disabled by default, since it reads the clock on every
+// global queue operation. Enabling tracking discards the latencies
+// recorded while it was last enabled.
+func SetGlobalQueueLatencyTracking(enabled bool) {
+	if !enabled {
+		atomic.Store(&globrunqLatencyEnabled, 0)
+		return
+	}
+	if atomic.Load(&globrunqLatencyEnabled) == 0 {
+		globrunqLatency.reset()
+	}
+	atomic.Store(&globrunqLatencyEnabled, 1)
+}
+
+// GlobalQueueLatency returns the 50th, 90th and 99th percentiles of the
+// time, in nanoseconds, that goroutines waited on the global run queue
+// while tracking was enabled by SetGlobalQueueLatencyTracking. The
+// percentiles are upper bounds, accurate to within about 6%. All three
+// are 0 if nothing has been recorded.
+func GlobalQueueLatency() (p50, p90, p99 int64) {
+	return globrunqLatency.quantile(0.50), globrunqLatency.quantile(0.90), globrunqLatency.quantile(0.99)
+}
+
 // pMask is an atomic bitstring with one bit per P.
 type pMask []uint32
 
@@ -6093,10 +8440,40 @@ func pidleget() *p {
 		idlepMask.clear(_p_.id)        // 注释：相当于索引，空闲的标记。设置移除启用的p的自增ID
 		sched.pidle = _p_.link         // 注释：链表移除一个，设置链表的头
 		atomic.Xadd(&sched.npidle, -1) // TODO: fast atomic // 注释：原子操作，加法（空闲p减1）
+		if sched.npidle == 0 {
+			atomic.Store64(&sched.busySince, uint64(nanotime()))
+		}
 	}
 	return _p_
 }
 
+// pidlegetp is like pidleget, but takes the specific P _p_ off the
+// _Pidle list. It returns nil if _p_ is not on the list.
+//
+// sched.lock must be held.
+//
+// May run during STW, so write barriers are not allowed.
+//go:nowritebarrierrec
+func pidlegetp(_p_ *p) *p {
+	assertLockHeld(&sched.lock)
+
+	prev := &sched.pidle
+	for pp := sched.pidle.ptr(); pp != nil; pp = pp.link.ptr() {
+		if pp == _p_ {
+			timerpMask.set(_p_.id)
+			idlepMask.clear(_p_.id)
+			*prev = _p_.link
+			atomic.Xadd(&sched.npidle, -1)
+			if sched.npidle == 0 {
+				atomic.Store64(&sched.busySince, uint64(nanotime()))
+			}
+			return _p_
+		}
+		prev = &pp.link
+	}
+	return nil
+}
+
 // runqempty reports whether _p_ has no Gs on its local run queue.
 // It never returns true spuriously.
 // 注释：本地的g运行队列为空时返回true，否则返回false
@@ -6223,9 +8600,31 @@ func runqputslow(_p_ *p, gp *g, h, t uint32) bool {
 	lock(&sched.lock)                // 注释：加锁(全局调度器)
 	globrunqputbatch(&q, int32(n+1)) // 注释：把链表加入到全局链表中(全局调度器)，并设置全局链表的数量
 	unlock(&sched.lock)              // 注释：解锁(全局调度器)
+
+	if fn := runqOverflowObserver; fn != nil {
+		fn(_p_.id, int(n+1))
+	}
 	return true
 }
 
+// runqOverflowObserver, if non-nil, is called by runqputslow each time
+// a P's local run queue overflows onto the global run queue.
+var runqOverflowObserver func(pid int32, spilled int)
+
+// SetRunqOverflowObserver arranges for fn to be called each time a P's
+// local run queue is full when a goroutine is added to it, reporting
+// the P's ID and the number of goroutines moved to the global run
+// queue as a result: half of the local queue plus the goroutine being
+// added.
+//
+// fn is called with the P held, on whatever goroutine made another
+// runnable, possibly on the system stack. It must not allocate, block
+// or otherwise call into the runtime, and should do as little as
+// possible. Passing nil removes the observer.
+func SetRunqOverflowObserver(fn func(pid int32, spilled int)) {
+	runqOverflowObserver = fn
+}
+
 // runqputbatch tries to put all the G's on q on the local runnable queue.
 // If the queue is full, they are put on the global queue; in that case
 // this will temporarily acquire the scheduler lock.
@@ -6364,6 +8763,7 @@ func runqsteal(_p_, p2 *p, stealRunNextG bool) *g {
 	if n == 0 {
 		return nil
 	}
+	_p_.stolen += n
 	n--
 	gp := _p_.runq[(t+n)%uint32(len(_p_.runq))].ptr() // 注释：取出最后一个（这时候已经窃取（偷）完并且已经放在本地队列里了）
 	if n == 0 {
@@ -6498,6 +8898,34 @@ func setMaxThreads(in int) (out int) {
 	return
 }
 
+// globrunqCheckInterval is the number of scheduling rounds on a P
+// after which schedule checks the global run queue before the P's
+// local one. Accessed atomically.
+var globrunqCheckInterval uint32 = 61
+
+//go:linkname setGlobalQueueCheckInterval runtime/debug.setGlobalQueueCheckInterval
+func setGlobalQueueCheckInterval(in int) (out int) {
+	if in < 1 {
+		in = 1
+	} else if in > 0x7fffffff { // MaxInt32
+		in = 0x7fffffff
+	}
+	return int(atomic.Xchg(&globrunqCheckInterval, uint32(in)))
+}
+
+//go:linkname setMaxGoroutines runtime/debug.setMaxGoroutines
+func setMaxGoroutines(n int, onExceed func()) {
+	if n < 0 {
+		n = 0
+	} else if n > 0x7fffffff { // MaxInt32
+		n = 0x7fffffff
+	}
+	lock(&sched.lock)
+	goroutineLimit.onExceed = onExceed
+	atomic.Store(&goroutineLimit.max, uint32(n))
+	unlock(&sched.lock)
+}
+
 func haveexperiment(name string) bool {
 	x := sys.Goexperiment
 	for x != "" {
@@ -6638,6 +9066,98 @@ func (enum *randomEnum) position() uint32 {
 	return enum.pos
 }
 
+// numaNodes is the number of NUMA nodes, as found by osinit, or 0 if
+// it is unknown.
+var numaNodes int32
+
+// numaNodeRefresh is how often in nanoseconds an M asks the kernel
+// again which NUMA node it is running on. Threads rarely move between
+// nodes, so the node an M saw a little while ago is good enough.
+const numaNodeRefresh = 10 * 1000 * 1000 // 10ms
+
+// mNUMANode returns the NUMA node of the CPU that mp, which must be
+// the current M, runs on, or -1 if it is unknown. It only looks the
+// node up every numaNodeRefresh, and otherwise returns the node it
+// found last.
+//
+//go:nosplit
+func mNUMANode(mp *m) int32 {
+	now := nanotime()
+	if mp.numaNodeWhen == 0 || now-mp.numaNodeWhen >= numaNodeRefresh {
+		mp.numaNode = cpuNUMANode()
+		mp.numaNodeWhen = now
+	}
+	return mp.numaNode
+}
+
+// numaSteal is set if GODEBUG=numasteal=1 and there are several NUMA
+// nodes. Then each P keeps track of the NUMA node of the CPU its M last
+// ran on, and P's looking for work steal from P's on their own node
+// first, whose run queues are more likely to be in their cache.
+var numaSteal bool
+
+// startSteal starts an enumeration of the P's that _p_ may steal from.
+func startSteal(_p_ *p) stealEnum {
+	node := int32(-1)
+	if numaSteal {
+		node = _p_.numaNode
+	}
+	return stealOrder.startNUMA(fastrand(), node, pNUMANode)
+}
+
+func pNUMANode(i uint32) int32 {
+	return allp[i].numaNode
+}
+
+// stealEnum enumerates all Ps like randomEnum, except that when node
+// is not -1, it first visits the Ps for which nodeOf returns node, then
+// in a second pass over the same order the others.
+type stealEnum struct {
+	randomEnum
+	first  randomEnum // the enumeration as started, to restart it for the second pass
+	node   int32
+	nodeOf func(pos uint32) int32
+	second bool
+}
+
+func (ord *randomOrder) startNUMA(i uint32, node int32, nodeOf func(pos uint32) int32) stealEnum {
+	enum := stealEnum{
+		randomEnum: ord.start(i),
+		node:       node,
+		nodeOf:     nodeOf,
+	}
+	enum.first = enum.randomEnum
+	enum.skip()
+	return enum
+}
+
+func (enum *stealEnum) next() {
+	enum.randomEnum.next()
+	enum.skip()
+}
+
+// skip advances enum to the next P to visit in the current pass, and
+// on to the second pass at the end of the first.
+func (enum *stealEnum) skip() {
+	if enum.node < 0 {
+		return
+	}
+	for {
+		if enum.randomEnum.done() {
+			if enum.second {
+				return
+			}
+			enum.second = true
+			enum.randomEnum = enum.first
+			continue
+		}
+		if onNode := enum.nodeOf(enum.position()) == enum.node; onNode != enum.second {
+			return
+		}
+		enum.randomEnum.next()
+	}
+}
+
 func gcd(a, b uint32) uint32 {
 	for b != 0 {
 		a, b = b, a%b
@@ -6667,6 +9187,32 @@ type tracestat struct {
 	bytes  uint64 // heap allocated bytes
 }
 
+// initRecords holds the records of the package inits run while
+// inittrace is active, if GODEBUG=inittrace is set.
+var initRecords []InitRecord
+
+// An InitRecord describes the initialization of a package, as recorded
+// when GODEBUG=inittrace is set.
+type InitRecord struct {
+	Package string // package path
+	Start   int64  // time the init started, in nanoseconds since program start
+	Clock   int64  // wall-clock time of the init work, in nanoseconds
+	Bytes   uint64 // memory allocated on the heap
+	Allocs  uint64 // number of heap allocations
+}
+
+// ReadInitTrace returns a record of the initialization of each package
+// with init work, in the order the packages were initialized, if the
+// program runs with GODEBUG=inittrace set to a non-zero value. It
+// returns nil otherwise. Setting inittrace=2 records the inits without
+// printing them. Inits executed as part of plugin loading are not recorded.
+func ReadInitTrace() []InitRecord {
+	if len(initRecords) == 0 {
+		return nil
+	}
+	return append([]InitRecord(nil), initRecords...)
+}
+
 func doInit(t *initTask) {
 	switch t.state {
 	case 2: // fully initialized
@@ -6713,12 +9259,29 @@ func doInit(t *initTask) {
 			pkg := funcpkgpath(findfunc(funcPC(firstFunc)))
 
 			var sbuf [24]byte
-			print("init ", pkg, " @")
-			print(string(fmtNSAsMS(sbuf[:], uint64(start-runtimeInitTime))), " ms, ")
-			print(string(fmtNSAsMS(sbuf[:], uint64(end-start))), " ms clock, ")
-			print(string(itoa(sbuf[:], after.bytes-before.bytes)), " bytes, ")
-			print(string(itoa(sbuf[:], after.allocs-before.allocs)), " allocs")
-			print("\n")
+			if debug.inittrace != 0 && debug.inittrace != 2 {
+				print("init ", pkg, " @")
+				print(string(fmtNSAsMS(sbuf[:], uint64(start-runtimeInitTime))), " ms, ")
+				print(string(fmtNSAsMS(sbuf[:], uint64(end-start))), " ms clock, ")
+				print(string(itoa(sbuf[:], after.bytes-before.bytes)), " bytes, ")
+				print(string(itoa(sbuf[:], after.allocs-before.allocs)), " allocs")
+				print("\n")
+			}
+			if debug.inittrace != 0 {
+				initRecords = append(initRecords, InitRecord{
+					Package: pkg,
+					Start:   start - runtimeInitTime,
+					Clock:   end - start,
+					Bytes:   after.bytes - before.bytes,
+					Allocs:  after.allocs - before.allocs,
+				})
+			}
+			if debug.initbudget > 0 && end-start > int64(debug.initbudget)*1e6 {
+				print("runtime: init ", pkg, " took ", string(fmtNSAsMS(sbuf[:], uint64(end-start))), " ms, over initbudget=", debug.initbudget, " ms\n")
+				if debug.initbudgetthrow != 0 {
+					throw("package initialization over budget")
+				}
+			}
 		}
 
 		t.state = 2 // initialization done
@@ -31,3 +31,38 @@ func RunStealOrderTest() {
 		}
 	}
 }
+
+func RunNUMAStealOrderTest() {
+	var ord randomOrder
+	nodes := []int32{0, 1, 1, 0, 2, 1, 0, 1, 2}
+	nodeOf := func(pos uint32) int32 { return nodes[pos] }
+	ord.reset(uint32(len(nodes)))
+	for _, node := range []int32{-1, 0, 1, 2, 3} {
+		for i := uint32(0); i < 16; i++ {
+			checked := make([]bool, len(nodes))
+			onNode := true
+			n := 0
+			for enum := ord.startNUMA(i, node, nodeOf); !enum.done(); enum.next() {
+				x := enum.position()
+				if checked[x] {
+					println("node:", node, "start:", i)
+					panic("duplicate during enumeration")
+				}
+				checked[x] = true
+				n++
+				if node < 0 {
+					continue
+				}
+				if nodes[x] == node && !onNode {
+					println("node:", node, "start:", i)
+					panic("P on node enumerated after P on another node")
+				}
+				onNode = nodes[x] == node
+			}
+			if n != len(nodes) {
+				println("node:", node, "start:", i, "enumerated:", n)
+				panic("not all Ps enumerated")
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package runtime_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"internal/race"
 	"internal/testenv"
@@ -12,6 +13,8 @@ import (
 	"net"
 	"runtime"
 	"runtime/debug"
+	"runtime/metrics"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -882,6 +885,10 @@ func TestStealOrder(t *testing.T) {
 	runtime.RunStealOrderTest()
 }
 
+func TestNUMAStealOrder(t *testing.T) {
+	runtime.RunNUMAStealOrderTest()
+}
+
 func TestLockOSThreadNesting(t *testing.T) {
 	if runtime.GOARCH == "wasm" {
 		t.Skip("no threads on wasm yet")
@@ -1088,3 +1095,1451 @@ func TestBigGOMAXPROCS(t *testing.T) {
 		t.Errorf("output:\n%s\nwanted:\nunknown function: NonexistentTest", output)
 	}
 }
+
+func TestProcResizeObserver(t *testing.T) {
+	var calls, oldProcs, newProcs int32
+	runtime.SetProcResizeObserver(func(old, new int32) {
+		atomic.StoreInt32(&oldProcs, old)
+		atomic.StoreInt32(&newProcs, new)
+		atomic.AddInt32(&calls, 1)
+	})
+	defer runtime.SetProcResizeObserver(nil)
+
+	prev := runtime.GOMAXPROCS(0)
+	want := int32(prev + 1)
+	runtime.GOMAXPROCS(int(want))
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("observer called %d times, want 1", n)
+	}
+	if o, n := atomic.LoadInt32(&oldProcs), atomic.LoadInt32(&newProcs); o != int32(prev) || n != want {
+		t.Errorf("observer reported %d -> %d, want %d -> %d", o, n, prev, want)
+	}
+
+	// Restoring the old value is also a transition; setting the
+	// current value again is not.
+	runtime.GOMAXPROCS(prev)
+	runtime.GOMAXPROCS(prev)
+	runtime.GC()
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("observer called %d times, want 2", n)
+	}
+	if o, n := atomic.LoadInt32(&oldProcs), atomic.LoadInt32(&newProcs); o != want || n != int32(prev) {
+		t.Errorf("observer reported %d -> %d, want %d -> %d", o, n, want, prev)
+	}
+}
+
+func TestSyscallReacquireSpin(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	defer runtime.SetSyscallReacquireSpin(0)
+
+	runtime.SetSyscallReacquireSpin(-1)
+	if got := runtime.SyscallReacquireSpin(); got != 0 {
+		t.Errorf("SetSyscallReacquireSpin(-1) set the spin to %d, want 0", got)
+	}
+	runtime.SetSyscallReacquireSpin(1 << 30)
+	if got, max := runtime.SyscallReacquireSpin(), runtime.MaxSyscallReacquireSpin; got != max {
+		t.Errorf("SetSyscallReacquireSpin(1<<30) set the spin to %d, want %d", got, max)
+	}
+
+	// Keep every P busy, so that the old P of the syscalling goroutine
+	// never becomes idle while it spins. Its syscalls must still
+	// return, on whatever P it gets.
+	var stop uint32
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadUint32(&stop) == 0 {
+				runtime.Gosched()
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		fakeSyscall(30 * time.Microsecond)
+	}
+	atomic.StoreUint32(&stop, 1)
+	wg.Wait()
+
+	// However many iterations it is allowed, the spin stops after
+	// a bounded time. The thread may be descheduled while it spins,
+	// so only the shortest of several spins is checked.
+	min := int64(math.MaxInt64)
+	for i := 0; i < 10; i++ {
+		if d := runtime.SyscallReacquireWait(); d < min {
+			min = d
+		}
+	}
+	if max := int64(runtime.MaxSyscallReacquireSpinTime); min > 2*max {
+		t.Errorf("spin took %v, want at most about %v", time.Duration(min), time.Duration(max))
+	}
+}
+
+func TestSyscallReacquireLocality(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	defer runtime.SetSyscallReacquireSpin(0)
+
+	samples := []metrics.Sample{
+		{Name: "/sched/syscalls/retaken:events"},
+		{Name: "/sched/syscalls/retaken-same-p:events"},
+	}
+	// sameP runs short fake syscalls alongside a goroutine that
+	// keeps readying and parking, so that sysmon regularly retakes
+	// the syscalling goroutine's P, and reports the number of
+	// syscalls during which the P was retaken and the fraction of
+	// those after which the goroutine continued on the same P.
+	sameP := func(spin int) (uint64, float64) {
+		runtime.SetSyscallReacquireSpin(spin)
+		stop := make(chan bool)
+		done := make(chan bool)
+		go func() {
+			ping := make(chan bool)
+			go func() {
+				for range ping {
+				}
+			}()
+			for {
+				select {
+				case <-stop:
+					close(ping)
+					done <- true
+					return
+				case ping <- true:
+					runtime.Gosched()
+				}
+			}
+		}()
+
+		metrics.Read(samples)
+		retaken, same := samples[0].Value.Uint64(), samples[1].Value.Uint64()
+		for i := 0; i < 2000; i++ {
+			fakeSyscall(30 * time.Microsecond)
+		}
+		metrics.Read(samples)
+		retaken = samples[0].Value.Uint64() - retaken
+		same = samples[1].Value.Uint64() - same
+		close(stop)
+		<-done
+		if retaken == 0 {
+			return 0, 0
+		}
+		return retaken, float64(same) / float64(retaken)
+	}
+
+	nOff, off := sameP(0)
+	nOn, on := sameP(runtime.MaxSyscallReacquireSpin)
+	t.Logf("same-P continuation after a retake: spin=0 %.2f of %d, spin=%d %.2f of %d", off, nOff, runtime.MaxSyscallReacquireSpin, on, nOn)
+	if nOff < 20 || nOn < 20 {
+		t.Skipf("too few syscalls had their P retaken")
+	}
+	// Locality depends on machine load, so allow for some noise.
+	const tolerance = 0.1
+	if on < off-tolerance {
+		t.Errorf("same-P continuation after a retake is %.2f with spinning, want no worse than %.2f without", on, off)
+	}
+}
+
+func TestTimerRebalancing(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	runtime.SetTimerRebalancing(true)
+	defer runtime.SetTimerRebalancing(false)
+
+	// Keep a P busy so that sysmon stays awake.
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	// Arm all timers in a quick burst from one goroutine, so that
+	// they start out on the same P. Arm every other one for much
+	// later and then reset it, so that some of the timers that move
+	// are still modified to run earlier.
+	const N = 1000
+	const delay = time.Second
+	var wg sync.WaitGroup
+	var early int32
+	wg.Add(N)
+	start := time.Now()
+	for i := 0; i < N; i++ {
+		d := delay + time.Duration(i)*time.Microsecond
+		arm := d
+		if i%2 == 0 {
+			arm = time.Minute
+		}
+		tm := time.AfterFunc(arm, func() {
+			if time.Since(start) < d {
+				atomic.AddInt32(&early, 1)
+			}
+			wg.Done()
+		})
+		if arm != d {
+			tm.Reset(d - time.Since(start))
+		}
+	}
+
+	spread := false
+	for !spread && time.Since(start) < delay/2 {
+		time.Sleep(5 * time.Millisecond)
+		loaded := 0
+		for _, n := range runtime.TimerCounts() {
+			if n >= N/8 {
+				loaded++
+			}
+		}
+		spread = loaded >= 2
+	}
+	if !spread {
+		t.Errorf("timers were not spread across Ps: %v", runtime.TimerCounts())
+	}
+
+	done := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("not all timers fired")
+	}
+	if n := atomic.LoadInt32(&early); n != 0 {
+		t.Errorf("%d timers fired early", n)
+	}
+}
+
+func TestTimerRebalancingDeleted(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	runtime.SetTimerRebalancing(true)
+	defer runtime.SetTimerRebalancing(false)
+
+	// Stop timers from several goroutines while they are spread
+	// across Ps, so that some are deleted while being moved. No P
+	// may count fewer than zero deleted timers.
+	stop := make(chan bool)
+	var negative int32
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			for _, n := range runtime.DeletedTimerCounts() {
+				if n < 0 {
+					atomic.StoreInt32(&negative, n)
+				}
+			}
+			select {
+			case <-stop:
+				return
+			default:
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	const N = 1000
+	for round := 0; round < 10; round++ {
+		timers := make([]*time.Timer, N)
+		for i := range timers {
+			timers[i] = time.AfterFunc(time.Hour, func() {})
+		}
+		time.Sleep(20 * time.Millisecond)
+		var swg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			swg.Add(1)
+			go func(g int) {
+				defer swg.Done()
+				for i := g; i < N; i += 4 {
+					timers[i].Stop()
+				}
+			}(g)
+		}
+		swg.Wait()
+	}
+	close(stop)
+	wg.Wait()
+	if n := atomic.LoadInt32(&negative); n != 0 {
+		t.Errorf("a P counted %d deleted timers", n)
+	}
+	for i, n := range runtime.DeletedTimerCounts() {
+		if n < 0 {
+			t.Errorf("P %d counts %d deleted timers", i, n)
+		}
+	}
+}
+
+func TestTimerWheel(t *testing.T) {
+	output := runTestProg(t, "testprog", "TimerWheel", "GODEBUG=timerwheel=1")
+	want := "OK\n"
+	if output != want {
+		t.Fatalf("want %s, got %s\n", want, output)
+	}
+}
+
+func TestSchedTraceJSON(t *testing.T) {
+	output := runTestProg(t, "testprog", "SchedTrace", "GODEBUG=schedtrace=10,scheddetail=1,schedtracejson=1")
+	type object struct {
+		ID         int64
+		Status     int
+		Runqsize   int
+		Waitreason string
+	}
+	var records int
+	blocked := false
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var r struct {
+			Ms         int64
+			Gomaxprocs int
+			P, M, G    []object
+		}
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("bad record %q: %v", line, err)
+		}
+		if len(r.P) != r.Gomaxprocs {
+			t.Errorf("record has %d P's, want gomaxprocs=%d: %s", len(r.P), r.Gomaxprocs, line)
+		}
+		if len(r.M) == 0 || len(r.G) == 0 {
+			t.Errorf("record has no M's or G's: %s", line)
+		}
+		for _, g := range r.G {
+			if g.Waitreason == "chan receive" {
+				blocked = true
+			}
+		}
+		records++
+	}
+	if records == 0 {
+		t.Fatalf("no JSON records in output:\n%s", output)
+	}
+	if !blocked {
+		t.Errorf("no G blocked in chan receive in output:\n%s", output)
+	}
+	if !strings.HasSuffix(output, "OK\n") {
+		t.Fatalf("want output ending in OK, got:\n%s", output)
+	}
+}
+
+func TestSchedStall(t *testing.T) {
+	output := runTestProg(t, "testprog", "SchedStall", "GODEBUG=asyncpreemptoff=1,schedstall=20")
+	if !strings.Contains(output, "runtime: P 0 has not scheduled a goroutine for ") {
+		t.Errorf("stall not reported in output:\n%s", output)
+	}
+	if !strings.Contains(output, "SCHED ") || !strings.Contains(output, "  G") {
+		t.Errorf("no scheduler dump in output:\n%s", output)
+	}
+	if !strings.HasSuffix(output, "OK\n") {
+		t.Fatalf("want output ending in OK, got:\n%s", output)
+	}
+}
+
+func TestSchedStallObserver(t *testing.T) {
+	output := runTestProg(t, "testprog", "SchedStallObserver", "GODEBUG=asyncpreemptoff=1")
+	if output != "OK\n" {
+		t.Fatalf("want OK, got:\n%s", output)
+	}
+}
+
+func forEachGoroutineBlocked(c chan bool) {
+	<-c
+}
+
+func TestForEachGoroutine(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	const N = 10
+	c := make(chan bool)
+	for i := 0; i < N; i++ {
+		go forEachGoroutineBlocked(c)
+	}
+	defer close(c)
+	// ForEachGoroutine must not wait for a running goroutine.
+	var spin uint32
+	go func() {
+		for atomic.LoadUint32(&spin) == 0 {
+		}
+	}()
+	defer atomic.StoreUint32(&spin, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	blocked, all := 0, 0
+	runtime.ForEachGoroutine(func(info runtime.GInfo) bool {
+		all++
+		if info.ID == runtime.Goid() {
+			t.Errorf("ForEachGoroutine reported the calling goroutine")
+		}
+		if !strings.HasSuffix(runtime.FuncForPC(info.StartPC).Name(), ".forEachGoroutineBlocked") {
+			return true
+		}
+		blocked++
+		if info.Status != "waiting" || info.WaitReason != runtime.WaitChanReceive {
+			t.Errorf("goroutine %d: status %q (%v), want waiting (chan receive)", info.ID, info.Status, info.WaitReason)
+		}
+		frames := runtime.CallersFrames([]uintptr{info.CreatedBy})
+		if f, _ := frames.Next(); !strings.HasSuffix(f.Function, ".TestForEachGoroutine") {
+			t.Errorf("goroutine %d: created by %s, want TestForEachGoroutine", info.ID, f.Function)
+		}
+		found := false
+		frames = runtime.CallersFrames(info.Stack)
+		for {
+			f, more := frames.Next()
+			if strings.HasSuffix(f.Function, ".forEachGoroutineBlocked") {
+				found = true
+			}
+			if !more {
+				break
+			}
+		}
+		if !found {
+			t.Errorf("goroutine %d: forEachGoroutineBlocked not on stack %v", info.ID, info.Stack)
+		}
+		return true
+	})
+	if blocked != N {
+		t.Errorf("ForEachGoroutine reported %d blocked goroutines, want %d", blocked, N)
+	}
+	if all < N+1 {
+		t.Errorf("ForEachGoroutine reported %d goroutines, want at least %d", all, N+1)
+	}
+
+	calls := 0
+	runtime.ForEachGoroutine(func(info runtime.GInfo) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("ForEachGoroutine called fn %d times after it returned false, want 1", calls)
+	}
+}
+
+func TestGoroutineExitReason(t *testing.T) {
+	exit := func(f func()) int64 {
+		id := make(chan int64)
+		go func() {
+			id <- runtime.Goid()
+			f()
+		}()
+		return <-id
+	}
+	want := map[int64]runtime.GoroutineExitReason{
+		exit(func() {}): runtime.GoroutineExitReturn,
+		exit(func() {
+			runtime.Goexit()
+		}): runtime.GoroutineExitGoexit,
+		exit(func() {
+			defer runtime.Goexit()
+			panic("unrecovered")
+		}): runtime.GoroutineExitPanic,
+		exit(func() {
+			defer func() {
+				recover()
+			}()
+			panic("recovered")
+		}): runtime.GoroutineExitReturn,
+	}
+
+	got := make(map[int64]runtime.GoroutineExitReason)
+	for start := time.Now(); len(got) < len(want) && time.Since(start) < 5*time.Second; {
+		time.Sleep(time.Millisecond)
+		for _, e := range runtime.LastGoroutineExits() {
+			if _, ok := want[e.Goid]; ok {
+				got[e.Goid] = e.Reason
+			}
+		}
+	}
+	for id, reason := range want {
+		if r, ok := got[id]; !ok {
+			t.Errorf("exit of goroutine %d not recorded", id)
+		} else if r != reason {
+			t.Errorf("goroutine %d exited with reason %v, want %v", id, r, reason)
+		}
+	}
+}
+
+func TestScheduleObserver(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	sources := []string{"local", "global", "steal", "netpoll", "gcworker"}
+	var seen [5]uint32
+	var yielder int64
+	var yielderGlobal uint32
+	runtime.SetScheduleObserver(func(goid int64, source string) {
+		for i, s := range sources {
+			if s == source {
+				atomic.StoreUint32(&seen[i], 1)
+			}
+		}
+		if goid == atomic.LoadInt64(&yielder) && source == "global" {
+			atomic.StoreUint32(&yielderGlobal, 1)
+		}
+	})
+	defer runtime.SetScheduleObserver(nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var b [1]byte
+		for {
+			if _, err := c.Read(b[:]); err != nil {
+				return
+			}
+			if _, err := c.Write(b[:]); err != nil {
+				return
+			}
+		}
+	}()
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	done := func() bool {
+		for i := range seen {
+			if atomic.LoadUint32(&seen[i]) == 0 {
+				return false
+			}
+		}
+		return atomic.LoadUint32(&yielderGlobal) != 0
+	}
+	for start := time.Now(); !done() && time.Since(start) < 10*time.Second; {
+		// A goroutine that yields is put on the global run queue.
+		yielded := make(chan bool)
+		go func() {
+			atomic.StoreInt64(&yielder, runtime.Goid())
+			runtime.Gosched()
+			yielded <- true
+		}()
+		<-yielded
+
+		// A burst of goroutines started on one P gets spread out
+		// by idle Ps stealing them.
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				for start := time.Now(); time.Since(start) < 10*time.Microsecond; {
+				}
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+
+		// A goroutine blocked on the network is woken by the poller.
+		if _, err := c.Write([]byte{1}); err != nil {
+			t.Fatal(err)
+		}
+		var b [1]byte
+		if _, err := c.Read(b[:]); err != nil {
+			t.Fatal(err)
+		}
+
+		// Forced collections run the background mark workers.
+		runtime.GC()
+	}
+
+	for i, s := range sources {
+		if atomic.LoadUint32(&seen[i]) == 0 {
+			t.Errorf("no goroutine was scheduled from %q", s)
+		}
+	}
+	if atomic.LoadUint32(&yielderGlobal) == 0 {
+		t.Errorf("yielding goroutine was never scheduled from the global run queue")
+	}
+}
+
+var minIdlePSink []*[8]*int
+
+func TestMinIdleP(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	defer runtime.SetMinIdleP(0)
+
+	// A heap of many small pointerful objects keeps the collector
+	// marking for a while, with P's left idle for idle mark workers.
+	minIdlePSink = make([]*[8]*int, 1<<18)
+	for i := range minIdlePSink {
+		minIdlePSink[i] = new([8]*int)
+	}
+	defer func() { minIdlePSink = nil }()
+
+	// With all P's reserved, no idle mark worker may run.
+	runtime.SetMinIdleP(4)
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		if ns := runtime.GCIdleMarkTime(); ns != 0 {
+			t.Fatalf("idle mark workers ran for %dns with every P reserved", ns)
+		}
+	}
+
+	// Without a reserve, they get to run on the idle P's.
+	runtime.SetMinIdleP(0)
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		if runtime.GCIdleMarkTime() != 0 {
+			return
+		}
+	}
+	t.Errorf("idle mark workers never ran without a reserve")
+}
+
+func TestMinIdlePSingleP(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	defer runtime.SetMinIdleP(0)
+
+	minIdlePSink = make([]*[8]*int, 1<<18)
+	for i := range minIdlePSink {
+		minIdlePSink[i] = new([8]*int)
+	}
+	defer func() { minIdlePSink = nil }()
+
+	// With one P and a reserve of one, the only P is idle while this
+	// goroutine waits for the cycle to end, and only an idle mark
+	// worker can finish it.
+	runtime.SetMinIdleP(1)
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+	}
+}
+
+func TestMinIdlePBurstLatency(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	if runtime.NumCPU() < 4 {
+		t.Skip("skipping on a machine with fewer than 4 CPUs")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	defer runtime.SetMinIdleP(0)
+
+	minIdlePSink = make([]*[8]*int, 1<<18)
+	for i := range minIdlePSink {
+		minIdlePSink[i] = new([8]*int)
+	}
+	defer func() { minIdlePSink = nil }()
+
+	// burstLatency keeps the collector marking in the background, as
+	// filler work, and returns the median time it takes a burst of
+	// goroutines, started by a goroutine that keeps its own P busy,
+	// to all start running.
+	burstLatency := func(k int) time.Duration {
+		runtime.SetMinIdleP(k)
+		defer runtime.SetMinIdleP(0)
+		var stop uint32
+		done := make(chan bool)
+		go func() {
+			for atomic.LoadUint32(&stop) == 0 {
+				runtime.GC()
+			}
+			done <- true
+		}()
+
+		const bursts, width = 100, 2
+		lat := make([]time.Duration, 0, bursts)
+		for i := 0; i < bursts; i++ {
+			var started int32
+			start := time.Now()
+			for j := 0; j < width; j++ {
+				go func() {
+					atomic.AddInt32(&started, 1)
+				}()
+			}
+			for atomic.LoadInt32(&started) < width {
+				if time.Since(start) > time.Second {
+					// Let them run on this P.
+					runtime.Gosched()
+				}
+			}
+			lat = append(lat, time.Since(start))
+			time.Sleep(200 * time.Microsecond)
+		}
+		atomic.StoreUint32(&stop, 1)
+		<-done
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		return lat[len(lat)/2]
+	}
+
+	// Bursts go on the local run queue of a busy P, so other P's have
+	// to take them. Without a reserve, the idle P's are running idle
+	// mark workers, which don't look for goroutines to run until they
+	// are preempted. With one, a thread woken for the burst takes an
+	// idle P and runs them right away.
+	off := burstLatency(0)
+	on := burstLatency(2)
+	t.Logf("median burst start latency: reserve=0 %v, reserve=2 %v", off, on)
+	if on > off+off/2+100*time.Microsecond {
+		t.Errorf("median burst start latency with a reserve of 2 P's is %v, want no worse than %v without", on, off)
+	}
+}
+
+func TestSpawnToRunHistogram(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	runtime.SetSpawnToRunTracking(true)
+	defer runtime.SetSpawnToRunTracking(false)
+
+	// meanLatency spawns bursts of goroutines while busy goroutines
+	// occupy the P's and returns the approximate mean spawn-to-run
+	// latency of the bursts and the number of samples recorded.
+	meanLatency := func(busy int) (float64, uint64) {
+		stop := make(chan bool)
+		var wg sync.WaitGroup
+		for i := 0; i < busy; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+				}
+			}()
+		}
+
+		before, _ := runtime.SpawnToRunHistogram()
+		const bursts, width = 10, 10
+		done := make(chan bool, width)
+		for i := 0; i < bursts; i++ {
+			for j := 0; j < width; j++ {
+				go func() {
+					done <- true
+				}()
+			}
+			for j := 0; j < width; j++ {
+				<-done
+			}
+		}
+		after, buckets := runtime.SpawnToRunHistogram()
+		close(stop)
+		wg.Wait()
+
+		var n uint64
+		var sum float64
+		for i := range after {
+			c := after[i] - before[i]
+			if c == 0 {
+				continue
+			}
+			// Use the lower bound of each bucket, clamped to 0.
+			lo := buckets[i]
+			if lo < 0 {
+				lo = 0
+			}
+			n += c
+			sum += float64(c) * lo
+		}
+		if n == 0 {
+			return 0, 0
+		}
+		return sum / float64(n), n
+	}
+
+	idle, n := meanLatency(0)
+	if n < 100 {
+		t.Fatalf("recorded %d spawn-to-run samples, want at least 100", n)
+	}
+	loaded, n := meanLatency(8)
+	if n < 100 {
+		t.Fatalf("recorded %d spawn-to-run samples under load, want at least 100", n)
+	}
+	t.Logf("mean spawn-to-run latency: idle %.2fµs, oversubscribed %.2fµs", idle*1e6, loaded*1e6)
+	if loaded <= idle {
+		t.Errorf("spawn-to-run latency did not rise with oversubscription: idle %v, oversubscribed %v", idle, loaded)
+	}
+}
+
+func TestSchedLatencyHistogram(t *testing.T) {
+	total := func() (n uint64) {
+		counts, buckets := runtime.SchedLatencyHistogram()
+		if len(buckets) != len(counts)+1 {
+			t.Fatalf("%d buckets for %d counts", len(buckets), len(counts))
+		}
+		for _, c := range counts {
+			n += c
+		}
+		return n
+	}
+	// pingPong wakes a goroutine blocked on a channel n times.
+	pingPong := func(n int) {
+		ping, pong := make(chan bool), make(chan bool)
+		go func() {
+			for range ping {
+				pong <- true
+			}
+		}()
+		for i := 0; i < n; i++ {
+			ping <- true
+			<-pong
+		}
+		close(ping)
+	}
+
+	before := total()
+	pingPong(100)
+	if n := total() - before; n != 0 {
+		t.Errorf("recorded %d samples with tracking disabled", n)
+	}
+
+	runtime.SetSchedLatencyTracking(true)
+	defer runtime.SetSchedLatencyTracking(false)
+	before = total()
+	pingPong(100)
+	if n := total() - before; n < 100 {
+		t.Errorf("recorded %d samples for 100 wakeups, want at least 100", n)
+	}
+}
+
+func TestReadyObserver(t *testing.T) {
+	var consumer, waker int64
+	var woken uint32
+	runtime.SetReadyObserver(func(goid, byGoid int64) {
+		if goid == atomic.LoadInt64(&consumer) {
+			atomic.StoreInt64(&waker, byGoid)
+			atomic.AddUint32(&woken, 1)
+		}
+	})
+	defer runtime.SetReadyObserver(nil)
+
+	c := make(chan int)
+	started := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		atomic.StoreInt64(&consumer, runtime.Goid())
+		started <- true
+		<-c
+		done <- true
+	}()
+	<-started
+	// Give the consumer time to block in the receive, so that the
+	// send below has to wake it.
+	time.Sleep(10 * time.Millisecond)
+
+	var producer int64
+	go func() {
+		producer = runtime.Goid()
+		c <- 1
+	}()
+	<-done
+
+	if atomic.LoadUint32(&woken) == 0 {
+		t.Fatal("observer did not report the consumer being woken")
+	}
+	if got := atomic.LoadInt64(&waker); got != producer {
+		t.Errorf("consumer woken by goroutine %d, want producer %d", got, producer)
+	}
+}
+
+func TestCheckPreempt(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	// With no preemption requested, CheckPreempt must not yield to
+	// a newly started goroutine. An asynchronous preemption could
+	// sneak in and run it anyway, so try a few times.
+	var ran uint32
+	for i := 0; ; i++ {
+		atomic.StoreUint32(&ran, 0)
+		go func() {
+			atomic.StoreUint32(&ran, 1)
+		}()
+		runtime.CheckPreempt()
+		if atomic.LoadUint32(&ran) == 0 {
+			break
+		}
+		if i == 10 {
+			t.Fatal("goroutine always ran before preemption was requested")
+		}
+	}
+	// The preempted goroutine goes on the global run queue, which the
+	// scheduler now and then runs ahead of the local one, so try a few
+	// times.
+	for i := 0; i < 10 && atomic.LoadUint32(&ran) == 0; i++ {
+		runtime.RequestPreempt()
+		runtime.CheckPreempt()
+	}
+	if atomic.LoadUint32(&ran) == 0 {
+		t.Fatal("CheckPreempt did not yield when preemption was requested")
+	}
+}
+
+func TestOnSystemStack(t *testing.T) {
+	if runtime.OnSystemStack() {
+		t.Errorf("OnSystemStack on a goroutine stack = true, want false")
+	}
+	if !runtime.OnSystemStackOnG0() {
+		t.Errorf("OnSystemStack on the system stack = false, want true")
+	}
+}
+
+func TestIsLockedToThread(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		if runtime.IsLockedToThread() {
+			t.Errorf("new goroutine is locked to its thread")
+		}
+		runtime.LockOSThread()
+		runtime.LockOSThread()
+		runtime.UnlockOSThread()
+		if !runtime.IsLockedToThread() {
+			t.Errorf("goroutine is not locked to its thread after LockOSThread")
+		}
+		runtime.UnlockOSThread()
+		if runtime.IsLockedToThread() {
+			t.Errorf("goroutine is locked to its thread after UnlockOSThread")
+		}
+	}()
+	<-done
+}
+
+func TestMaybePreempt(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	// With no preemption requested, MaybePreempt must not yield to
+	// a newly started goroutine. An asynchronous preemption could
+	// sneak in and run it anyway, so try a few times.
+	var ran uint32
+	for i := 0; ; i++ {
+		atomic.StoreUint32(&ran, 0)
+		go func() {
+			atomic.StoreUint32(&ran, 1)
+		}()
+		runtime.MaybePreempt()
+		if atomic.LoadUint32(&ran) == 0 {
+			break
+		}
+		if i == 10 {
+			t.Fatal("goroutine always ran before preemption was requested")
+		}
+	}
+	// MaybePreempt puts the goroutine on the local run queue, so it
+	// resumes only after all the goroutines queued there have run.
+	// A GC worker could run first and be preempted in turn, so try
+	// a few times.
+	const n = 3
+	var ran2 uint32
+	for i := 0; ; i++ {
+		atomic.StoreUint32(&ran2, 0)
+		for j := 0; j < n; j++ {
+			go func() {
+				atomic.AddUint32(&ran2, 1)
+			}()
+		}
+		runtime.RequestPreempt()
+		runtime.MaybePreempt()
+		if atomic.LoadUint32(&ran) == 1 && atomic.LoadUint32(&ran2) == n {
+			break
+		}
+		if i == 10 {
+			t.Fatalf("MaybePreempt resumed after %d of %d queued goroutines ran", atomic.LoadUint32(&ran2), n)
+		}
+		for atomic.LoadUint32(&ran2) != n {
+			runtime.Gosched()
+		}
+	}
+}
+
+func BenchmarkMaybePreempt(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		runtime.MaybePreempt()
+	}
+}
+
+func TestGlobalQueueLatency(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	runtime.SetGlobalQueueLatencyTracking(true)
+	defer runtime.SetGlobalQueueLatencyTracking(false)
+
+	// spill spawns more goroutines at once than fit in a local run
+	// queue, so that some of them spill onto the global queue,
+	// while busy goroutines compete for the P's.
+	spill := func(busy int) {
+		stop := make(chan bool)
+		var wg sync.WaitGroup
+		for i := 0; i < busy; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+				}
+			}()
+		}
+		var done sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			for j := 0; j < 1000; j++ {
+				done.Add(1)
+				go done.Done()
+			}
+			done.Wait()
+		}
+		close(stop)
+		wg.Wait()
+	}
+
+	spill(0)
+	p50, p90, p99 := runtime.GlobalQueueLatency()
+	if p50 <= 0 || p90 < p50 || p99 < p90 {
+		t.Fatalf("global queue latency percentiles %d, %d, %d; want positive and increasing", p50, p90, p99)
+	}
+	spill(8)
+	_, _, loadedP99 := runtime.GlobalQueueLatency()
+	if loadedP99 <= p99 {
+		t.Errorf("global queue p99 latency did not rise with contention: %v then %v", time.Duration(p99), time.Duration(loadedP99))
+	}
+
+	// Nothing is recorded while tracking is disabled.
+	runtime.SetGlobalQueueLatencyTracking(false)
+	p50, p90, p99 = runtime.GlobalQueueLatency()
+	spill(8)
+	if q50, q90, q99 := runtime.GlobalQueueLatency(); q50 != p50 || q90 != p90 || q99 != p99 {
+		t.Errorf("global queue latency percentiles changed from %d, %d, %d to %d, %d, %d with tracking disabled", p50, p90, p99, q50, q90, q99)
+	}
+}
+
+func TestGoroutineMigrationObserver(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	const procs = 4
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+	var migrations, bad uint32
+	runtime.SetGoroutineMigrationObserver(func(goid int64, fromPid, toPid int32) {
+		if fromPid == toPid || fromPid < 0 || fromPid >= procs || toPid < 0 || toPid >= procs {
+			atomic.AddUint32(&bad, 1)
+		}
+		atomic.AddUint32(&migrations, 1)
+	})
+	defer runtime.SetGoroutineMigrationObserver(nil)
+
+	// Start all the work from one goroutine, and so on one P, and
+	// leave the other P's to steal it.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for k := 0; k < 1000; k++ {
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadUint32(&migrations) == 0 {
+		t.Error("no goroutine migrations observed")
+	}
+	if n := atomic.LoadUint32(&bad); n != 0 {
+		t.Errorf("%d migrations reported with bad P IDs", n)
+	}
+}
+
+func TestTimerStealObserver(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no threads on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	var stolen, bad uint32
+	runtime.SetTimerStealObserver(func(thiefPid, victimPid int32, ran bool) {
+		if thiefPid == victimPid {
+			atomic.AddUint32(&bad, 1)
+		}
+		if ran {
+			atomic.AddUint32(&stolen, 1)
+		}
+	})
+	defer runtime.SetTimerStealObserver(nil)
+
+	// Arm timers from a goroutine that then keeps its P busy, so that
+	// the timers fall due while the other P is idle and looking for
+	// work.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint32(&stolen) == 0 && time.Now().Before(deadline) {
+		done := make(chan bool)
+		go func() {
+			var fired uint32
+			for i := 0; i < 100; i++ {
+				time.AfterFunc(time.Duration(i)*100*time.Microsecond, func() {
+					atomic.AddUint32(&fired, 1)
+				})
+			}
+			for atomic.LoadUint32(&fired) < 100 && time.Now().Before(deadline) {
+			}
+			done <- true
+		}()
+		<-done
+	}
+	if atomic.LoadUint32(&stolen) == 0 {
+		t.Error("no P ran another P's timers")
+	}
+	if n := atomic.LoadUint32(&bad); n != 0 {
+		t.Errorf("%d timer steals reported with the same thief and victim", n)
+	}
+}
+
+func TestRunqOverflowObserver(t *testing.T) {
+	var spills, spilled, pid uint32
+	runtime.SetRunqOverflowObserver(func(id int32, n int) {
+		if atomic.AddUint32(&spills, 1) == 1 {
+			atomic.StoreUint32(&pid, uint32(id))
+			atomic.StoreUint32(&spilled, uint32(n))
+		}
+	})
+	defer runtime.SetRunqOverflowObserver(nil)
+
+	// With a single P, starting more goroutines than its local run
+	// queue holds without yielding overflows the queue. Being
+	// preempted in between lets the queue drain, so try a few times.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	const runqSize = 256
+	for i := 0; i < 10 && atomic.LoadUint32(&spills) == 0; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < runqSize+2; j++ {
+			wg.Add(1)
+			go wg.Done()
+		}
+		wg.Wait()
+	}
+	runtime.SetRunqOverflowObserver(nil)
+
+	if atomic.LoadUint32(&spills) == 0 {
+		t.Fatal("observer not called for run queue overflow")
+	}
+	if got := atomic.LoadUint32(&pid); got != 0 {
+		t.Errorf("observer reported overflow of P %d, want 0", got)
+	}
+	if got, want := atomic.LoadUint32(&spilled), uint32(runqSize/2+1); got != want {
+		t.Errorf("observer reported %d goroutines spilled, want %d", got, want)
+	}
+}
+
+func TestReadSchedStats(t *testing.T) {
+	var s runtime.SchedStats
+	runtime.ReadSchedStats(&s)
+	procs := runtime.GOMAXPROCS(-1)
+	if len(s.Procs) != procs {
+		t.Fatalf("got stats for %d P's, want %d", len(s.Procs), procs)
+	}
+	for i, p := range s.Procs {
+		if p.ID != int32(i) {
+			t.Errorf("Procs[%d].ID = %d", i, p.ID)
+		}
+	}
+	if s.Threads < 1 {
+		t.Errorf("Threads = %d, want at least 1", s.Threads)
+	}
+	if s.IdleProcs < 0 || s.IdleProcs >= procs {
+		t.Errorf("IdleProcs = %d with GOMAXPROCS %d; the running P can't be idle", s.IdleProcs, procs)
+	}
+
+	ticks := func(s *runtime.SchedStats) (n uint32) {
+		for _, p := range s.Procs {
+			n += p.Schedtick
+		}
+		return n
+	}
+	before := ticks(&s)
+	for i := 0; i < 10; i++ {
+		runtime.Gosched()
+	}
+	runtime.ReadSchedStats(&s)
+	if after := ticks(&s); after-before < 10 {
+		t.Errorf("schedticks went from %d to %d after 10 calls to Gosched", before, after)
+	}
+
+	// Reading into the same stats reuses Procs.
+	if n := testing.AllocsPerRun(10, func() { runtime.ReadSchedStats(&s) }); n != 0 {
+		t.Errorf("ReadSchedStats allocated %v times when reusing Procs", n)
+	}
+}
+
+func TestWakepDelay(t *testing.T) {
+	output := runTestProg(t, "testprog", "WakepDelay", "GODEBUG=wakepdelay=100,asyncpreemptoff=1")
+	if want := "OK\n"; output != want {
+		t.Fatalf("want %q, got %q", want, output)
+	}
+}
+
+func TestChanHandoff(t *testing.T) {
+	output := runTestProg(t, "testprog", "ChanHandoff", "GODEBUG=chanhandoff=1")
+	if want := "OK\n"; output != want {
+		t.Fatalf("want %q, got %q", want, output)
+	}
+}
+
+func TestLongSyscallObserver(t *testing.T) {
+	if sysNanosleep == nil {
+		t.Skipf("skipping on %v; sysNanosleep not defined", runtime.GOOS)
+	}
+	var calls, goid, pc, nanos int64
+	runtime.SetLongSyscallObserver(func(id int64, syscallpc uintptr, ns int64) {
+		atomic.AddInt64(&calls, 1)
+		atomic.StoreInt64(&goid, id)
+		atomic.StoreInt64(&pc, int64(syscallpc))
+		atomic.StoreInt64(&nanos, ns)
+	})
+	defer runtime.SetLongSyscallObserver(nil)
+	const threshold = 20 * time.Millisecond
+	runtime.SetLongSyscallThreshold(int64(threshold))
+	defer runtime.SetLongSyscallThreshold(0)
+
+	for i := 0; i < 5; i++ {
+		sysNanosleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&calls); n != 0 {
+		t.Fatalf("%d syscalls reported, all shorter than the threshold", n)
+	}
+
+	start := time.Now()
+	sysNanosleep(5 * threshold)
+	elapsed := time.Since(start)
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Fatalf("%d syscalls reported, want 1", n)
+	}
+	if id := atomic.LoadInt64(&goid); id != runtime.Goid() {
+		t.Errorf("reported goroutine %d, want %d", id, runtime.Goid())
+	}
+	if atomic.LoadInt64(&pc) == 0 {
+		t.Error("reported syscall PC 0")
+	}
+	if ns := time.Duration(atomic.LoadInt64(&nanos)); ns < threshold || ns > elapsed {
+		t.Errorf("reported syscall running for %v, want between %v and %v", ns, threshold, elapsed)
+	}
+}
+
+func TestSchedulerPressure(t *testing.T) {
+	// With a single P, goroutines started here wait on its local run
+	// queue until this one yields.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	var ran uint32
+	const n = 20
+	for i := 0; i < n; i++ {
+		go atomic.AddUint32(&ran, 1)
+	}
+	s := runtime.SchedulerPressure()
+	if s.LocalRunnable+s.GlobalRunnable < n-int(atomic.LoadUint32(&ran)) {
+		t.Errorf("%d local and %d global runnable goroutines, want at least %d", s.LocalRunnable, s.GlobalRunnable, n-int(atomic.LoadUint32(&ran)))
+	}
+	if s.MaxLocalRunnable > s.LocalRunnable {
+		t.Errorf("MaxLocalRunnable = %d, more than LocalRunnable = %d", s.MaxLocalRunnable, s.LocalRunnable)
+	}
+	if s.IdleProcs != 0 || s.BusyNanos <= 0 {
+		t.Errorf("IdleProcs = %d, BusyNanos = %d with the only P running; want 0 and positive", s.IdleProcs, s.BusyNanos)
+	}
+
+	for atomic.LoadUint32(&ran) < n {
+		runtime.Gosched()
+	}
+	runtime.GOMAXPROCS(2)
+	time.Sleep(time.Millisecond)
+	if s := runtime.SchedulerPressure(); s.IdleProcs > 0 && s.BusyNanos != 0 {
+		t.Errorf("BusyNanos = %d with %d idle P's, want 0", s.BusyNanos, s.IdleProcs)
+	}
+}
+
+func TestSchedIdleCounts(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	check := func() (idle int) {
+		idle = runtime.NumIdleProcs()
+		if idle < 0 || idle >= 4 {
+			t.Errorf("NumIdleProcs() = %d with GOMAXPROCS 4; the running P can't be idle", idle)
+		}
+		if n := runtime.NumSpinningThreads(); n < 0 || n > 4 {
+			t.Errorf("NumSpinningThreads() = %d with GOMAXPROCS 4", n)
+		}
+		if n := runtime.NumIdleThreads(); n < 0 {
+			t.Errorf("NumIdleThreads() = %d", n)
+		}
+		return idle
+	}
+	check()
+
+	// Keep the other P's busy with goroutines that yield rather than
+	// rely on being preempted, which may be disabled.
+	var stop uint32
+	defer atomic.StoreUint32(&stop, 1)
+	for i := 0; i < 3; i++ {
+		go func() {
+			for atomic.LoadUint32(&stop) == 0 {
+				runtime.Gosched()
+			}
+		}()
+	}
+	for i := 0; check() != 0; i++ {
+		if i == 100 {
+			t.Fatalf("%d P's idle with every P busy", runtime.NumIdleProcs())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestYieldLocalQueue(t *testing.T) {
+	self := runtime.Goid()
+	var others uint32
+	runtime.SetScheduleObserver(func(goid int64, source string) {
+		if source == "global" && goid != self {
+			atomic.AddUint32(&others, 1)
+		}
+	})
+	defer runtime.SetScheduleObserver(nil)
+
+	// With a single P, the goroutines started here wait on its local
+	// run queue until YieldLocalQueue moves them to the global one,
+	// ahead of the yielding goroutine. Taking them from there moves
+	// them back to the local queue in bulk, except for the first one.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	const n = 10
+	for i := 0; i < 10; i++ {
+		atomic.StoreUint32(&others, 0)
+		var ran uint32
+		for j := 0; j < n; j++ {
+			go atomic.AddUint32(&ran, 1)
+		}
+		runtime.YieldLocalQueue()
+		if got := atomic.LoadUint32(&ran); got != n {
+			t.Fatalf("%d of %d goroutines ran before YieldLocalQueue returned", got, n)
+		}
+		if atomic.LoadUint32(&others) != 0 {
+			return
+		}
+	}
+	t.Errorf("goroutines were not run from the global run queue")
+}
+
+// timeSliceWork calls itself, so that it isn't a leaf function without
+// a stack check, where the scheduler can't preempt it.
+//
+//go:noinline
+func timeSliceWork(x uint) uint {
+	if x == 0 {
+		return timeSliceWork(1)
+	}
+	return x*3 + 1
+}
+
+func TestGoroutineTimeSlice(t *testing.T) {
+	if runtime.GOARCH == "wasm" {
+		t.Skip("no preemption on wasm yet")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	// yieldTime returns the median time a call to Gosched takes to
+	// return while a goroutine with the given time slice keeps the
+	// only P busy. The busy goroutine makes calls, so that it can be
+	// preempted even without asynchronous preemption.
+	yieldTime := func(ns int64) time.Duration {
+		var stop uint32
+		done := make(chan bool)
+		go func() {
+			runtime.SetGoroutineTimeSlice(ns)
+			x := uint(1)
+			for atomic.LoadUint32(&stop) == 0 {
+				x = timeSliceWork(x)
+			}
+			done <- true
+		}()
+		times := make([]time.Duration, 21)
+		for i := range times {
+			start := time.Now()
+			runtime.Gosched()
+			times[i] = time.Since(start)
+		}
+		atomic.StoreUint32(&stop, 1)
+		<-done
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		return times[len(times)/2]
+	}
+
+	def := yieldTime(0)
+	short := yieldTime(int64(time.Millisecond))
+	t.Logf("Gosched took %v with the default time slice, %v with a 1ms time slice", def, short)
+	if short >= def/2 {
+		t.Errorf("a 1ms time slice did not shorten the wait for the busy goroutine to be preempted")
+	}
+}
+
+func TestGoroutineTimeSliceReset(t *testing.T) {
+	// waitMin waits for sysmon to recompute the shortest time slice.
+	// It keeps its P busy, so that sysmon doesn't sleep for long.
+	waitMin := func(want int64) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < time.Second && runtime.MinTimeSlice() != want; {
+		}
+		if got := runtime.MinTimeSlice(); got != want {
+			t.Fatalf("shortest time slice is %v, want %v", time.Duration(got), time.Duration(want))
+		}
+	}
+
+	// A goroutine that exits no longer keeps its time slice.
+	done := make(chan bool)
+	go func() {
+		runtime.SetGoroutineTimeSlice(int64(50 * time.Microsecond))
+		done <- true
+	}()
+	<-done
+	waitMin(0)
+
+	// Nor does a goroutine that restores the default.
+	runtime.SetGoroutineTimeSlice(int64(100 * time.Microsecond))
+	if got := runtime.MinTimeSlice(); got != int64(100*time.Microsecond) {
+		t.Fatalf("shortest time slice is %v, want 100µs", time.Duration(got))
+	}
+	runtime.SetGoroutineTimeSlice(int64(time.Millisecond))
+	waitMin(int64(time.Millisecond))
+	runtime.SetGoroutineTimeSlice(0)
+	waitMin(0)
+}
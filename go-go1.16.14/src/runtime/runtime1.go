@@ -93,6 +93,22 @@ func goenvs_unix() {
 	}
 }
 
+// earlyenv returns the value of the environment variable key, or "",
+// before goenvs has copied the environment. It only finds variables
+// on systems where the environment follows the arguments.
+func earlyenv(key string) string {
+	if GOOS == "windows" || GOOS == "plan9" || argv == nil {
+		return ""
+	}
+	for i := argc + 1; argv_index(argv, i) != nil; i++ {
+		s := gostringnocopy(argv_index(argv, i))
+		if len(s) > len(key) && s[len(key)] == '=' && s[:len(key)] == key {
+			return s[len(key)+1:]
+		}
+	}
+	return ""
+}
+
 func environ() []string {
 	return envs
 }
@@ -320,6 +336,21 @@ var debug struct {
 	schedtrace         int32
 	tracebackancestors int32
 	asyncpreemptoff    int32
+	numasteal          int32
+	autogomaxprocs     int32
+	wakepdelay         int32
+	chanhandoff        int32
+	numaheap           int32
+	hugepages          int32
+	stackgrowtrace     int32
+	netpollshards      int32
+	timerwheel         int32
+	schedtracejson     int32
+	schedstall         int32
+	runtimelockprofile int32
+	extram             int32
+	initbudget         int32
+	initbudgetthrow    int32
 
 	// debug.malloc is used as a combined debug check
 	// in the malloc function and should be set
@@ -328,6 +359,8 @@ var debug struct {
 	allocfreetrace int32
 	inittrace      int32
 	sbrk           int32
+	heappoison     int32
+	spantrace      int32
 }
 
 var dbgvars = []dbgVar{
@@ -350,6 +383,23 @@ var dbgvars = []dbgVar{
 	{"tracebackancestors", &debug.tracebackancestors},
 	{"asyncpreemptoff", &debug.asyncpreemptoff},
 	{"inittrace", &debug.inittrace},
+	{"numasteal", &debug.numasteal},
+	{"autogomaxprocs", &debug.autogomaxprocs},
+	{"wakepdelay", &debug.wakepdelay},
+	{"chanhandoff", &debug.chanhandoff},
+	{"numaheap", &debug.numaheap},
+	{"hugepages", &debug.hugepages},
+	{"stackgrowtrace", &debug.stackgrowtrace},
+	{"netpollshards", &debug.netpollshards},
+	{"timerwheel", &debug.timerwheel},
+	{"schedtracejson", &debug.schedtracejson},
+	{"schedstall", &debug.schedstall},
+	{"runtimelockprofile", &debug.runtimelockprofile},
+	{"extram", &debug.extram},
+	{"initbudget", &debug.initbudget},
+	{"initbudgetthrow", &debug.initbudgetthrow},
+	{"heappoison", &debug.heappoison},
+	{"spantrace", &debug.spantrace},
 }
 
 func parsedebugvars() {
@@ -400,7 +450,7 @@ func parsedebugvars() {
 		}
 	}
 
-	debug.malloc = (debug.allocfreetrace | debug.inittrace | debug.sbrk) != 0
+	debug.malloc = (debug.allocfreetrace | debug.inittrace | debug.sbrk | debug.heappoison | debug.spantrace) != 0
 
 	setTraceback(gogetenv("GOTRACEBACK"))
 	traceback_env = traceback_cache
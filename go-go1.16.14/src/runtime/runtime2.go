@@ -511,12 +511,18 @@ type g struct {
 	gopc           uintptr         // 注释：(go关键词的父级PC)创建当前G的PC(调用者的PC(rip)) 例如：A调用B然后执行go指令，此时gopc是A的PC值 // pc of go statement that created this goroutine
 	ancestors      *[]ancestorInfo // 注释：(调用链信息,用于debug追溯时使用)创建此g的祖先信息g仅在debug.traceback祖先时使用 // ancestor information goroutine(s) that created this goroutine (only used if debug.tracebackancestors)
 	startpc        uintptr         // 注释：任务函数(go fn()中fn指令对应的pc值) // pc of goroutine function
+	spawnTime      int64           // nanotime at creation if spawn-to-run tracking is enabled; cleared when first run
+	globrunqTime   int64           // nanotime when put on the global run queue if latency tracking is enabled
+	timeSlice      int64           // time slice set by SetGoroutineTimeSlice in nanoseconds, or 0 for forcePreemptNS
+	timeSliceNext  guintptr        // next g on timeSlices.head; protected by timeSlices.lock
+	readyTime      int64           // nanotime when made runnable by ready if scheduling latency tracking is enabled; cleared when run
 	racectx        uintptr
 	waiting        *sudog         // 注释：等待的sudog链表头指针  // sudog structures this g is waiting on (that have a valid elem ptr); in lock order
 	cgoCtxt        []uintptr      // cgo traceback context
 	labels         unsafe.Pointer // 注释：探测器标签，用于pprof使用 // profiler labels
 	timer          *timer         // 注释：通过time.Sleep缓存timer // cached timer for time.Sleep
 	selectDone     uint32         // are we participating in a select and did someone win the race?
+	lastpid        int32          // id+1 of the P this g last ran on, or 0 if it has not run yet
 
 	// Per-G GC state
 
@@ -530,8 +536,35 @@ type g struct {
 	// 注释：gcAssistBytes是根据分配的字节数计算的G的GC辅助信用。如果这是肯定的，那么G可以在没有辅助的情况下分配gcAssistBytes字节。 如果结果为阴性，则G必须通过执行扫描工作来纠正此问题。
 	//		我们以字节为单位跟踪它，以便在malloc热路径中快速更新和检查债务。协助比率决定了这与扫描工作债务的对应程度。
 	gcAssistBytes int64 // 注释：与GC相关
+
+	// gcAssistWork is the scan work performed by this G's current
+	// assist. It is written on the system stack by gcAssistAlloc1
+	// and reported to the assist observer by gcAssistAlloc.
+	gcAssistWork int64
+
+	// gcAssistExempt is set by SetGCAssistExempt. If set, this G's
+	// assist debt is charged to the background scan credit rather
+	// than paid off by assisting, within gcController.exemptLimit.
+	gcAssistExempt bool
+
+	// userWaitReason, if set by SetWaitReason, replaces waitreason
+	// when the goroutine blocks on behalf of user code.
+	userWaitReason waitReason
+
+	// deadline is the nanotime at which the goroutine must exit,
+	// set by SetGoroutineDeadline. deadlineState says whether it
+	// is in effect; see deadline.go.
+	deadlineState uint32
+	deadline      int64
 }
 
+// Values for m.freeWait.
+const (
+	freeMStack = 0 // M done, free stack and reference.
+	freeMRef   = 1 // M done, free reference.
+	freeMWait  = 2 // M still in use.
+)
+
 // 注释：m结构体用来代表工作线程，它保存了m自身使用的栈信息，当前正在运行的goroutine以及与m绑定的p等信息
 // 注释：m有3个链表分别是alllink,schedlink,freelink
 type m struct {
@@ -565,9 +598,13 @@ type m struct {
 	newSigstack   bool // minit on C thread called sigaltstack
 	printlock     int8
 	incgo         bool      // 注释： m在执行cgo吗 // m is executing a cgo call
-	freeWait      uint32    // if == 0, safe to free g0 and delete m (atomic)
+	freeWait      uint32    // Whether it is safe to free g0 and delete m (one of freeMRef, freeMStack, freeMWait) (atomic)
 	fastrand      [2]uint32 // 注释：(快速随机数时使用)快速随机数的基础数，程序初始化（schedinit）或创建M（allocm）时设置，随机数是基于这两个数计算出来的，计算完成后重新回填到这两个数里
 	needextram    bool
+	isextra       bool                          // m allocated by oneNewExtraM, for calls into Go from non-Go threads
+	isExtraBound  bool                          // extra m bound to the C thread that acquired it until the thread exits
+	isExtraInC    bool                          // bound extra m whose thread is running C code, with curg dead
+	isExtraInSig  bool                          // extra m acquired by a signal handler
 	traceback     uint8                         // 注释：堆栈追踪级别（用于栈追踪时使用）
 	ncgocall      uint64                        // 注释：cgo调用的总数 // number of cgo calls in total
 	ncgo          int32                         // 注释：当前cgo调用的数目 // number of cgo calls currently in progress
@@ -590,14 +627,36 @@ type m struct {
 	syscalltick   uint32                        // 注释：保存P里的系统调度计数器，P每一次系统调用加1
 	freelink      *m                            // on sched.freem // 注释：对应freem的链表(freelink->sched.freem)
 
+	// syscallseq and syscallwhen identify the syscall the M is in, so
+	// that sysmon can report long syscalls. See SetLongSyscallObserver.
+	syscallseq  uint32 // incremented on entering a syscall; accessed atomically
+	syscallwhen int64  // nanotime() on entering it, 0 if unknown
+	syscallseen uint32 // syscallseq of the last syscall reported; owned by sysmon
+
+	name [16]byte // NUL-terminated thread name set by SetThreadName; protected by sched.lock
+
+	// numaNode is the NUMA node the M last found itself running on,
+	// at numaNodeWhen, or -1. See mNUMANode.
+	numaNode     int32
+	numaNodeWhen int64
+
+	handoffg guintptr // goroutine goreadyHandoff is switching to
+
+	// idleWhen and idleExit are for exiting Ms that stay idle too
+	// long. See sysmonIdleMs. Protected by sched.lock.
+	idleWhen int64 // nanotime() when the M was put on sched.midle
+	idleExit bool  // sysmon took the M off sched.midle for it to exit
+
 	// mFixup is used to synchronize OS related m state
 	// (credentials etc) use mutex to access. To avoid deadlocks
 	// an atomic.Load() of used being zero in mDoFixupFn()
 	// guarantees fn is nil.
 	mFixup struct {
-		lock mutex
-		used uint32
-		fn   func(bool) bool
+		lock   mutex
+		used   uint32
+		fn     func(bool) bool
+		signal bool   // deliver with sigPreempt, as the thread may be running C code
+		hold   uint32 // mHold* state of a thread signaled by holdAllThreads; accessed atomically
 	}
 
 	// these are here because they are too large to be on the stack
@@ -627,6 +686,11 @@ type m struct {
 	// Up to 10 locks held by this m, maintained by the lock ranking code.
 	locksHeldLen int
 	locksHeld    [10]heldLockInfo
+
+	// Up to 4 locks acquired by this m while GODEBUG=runtimelockprofile
+	// is set, maintained by lock2 and unlock2.
+	lockProfHeldLen int32
+	lockProfHeld    [4]runtimeLockHeld
 }
 
 // 注释：P(处理器)结构体用于保存工作线程m执行go代码时所必需的资源，比如goroutine的运行队列，内存分配用到的缓存等等
@@ -636,12 +700,17 @@ type p struct {
 	link        puintptr   // 注释：空闲p链表的下一个p指针
 	schedtick   uint32     // 注释：用户调度计数器，每次调度的时候加1 // incremented on every scheduler call
 	syscalltick uint32     // 注释：系统调度计数器，每一次系统调用加1 // incremented on every system call
+	stolen      uint32     // goroutines stolen from other P's; written only by the owner
+	numaNode    int32      // NUMA node the P was last seen running on, or -1; only kept with numasteal or numaheap
 	sysmontick  sysmontick // 注释：系统监控 // last tick observed by sysmon
 	m           muintptr   // 回链到关联的m // back-link to associated m (nil if idle)
 	mcache      *mcache    // 注释：本地虚拟内存span(跨度类，小对象)的缓存，由于G同时只能在一个逻辑处理器P上运行，所已这个不需要锁
 	pcache      pageCache  // 注释：页的缓存,当到mheap里申请内存时，首先会到P的pageCache里看看是否有页的缓存
 	raceprocctx uintptr
 
+	// lcache holds the pages of recently freed large object spans.
+	lcache largePageCache
+
 	deferpool    [5][]*_defer // pool of available defer structs of different sizes (see panic.go)
 	deferpoolbuf [5][32]*_defer
 
@@ -721,6 +790,10 @@ type p struct {
 	// This is 0 if there are no timerModifiedEarlier timers.
 	timerModifiedEarliest uint64
 
+	// The time slice of the G running on this P in nanoseconds,
+	// or 0 for forcePreemptNS. Accessed atomically.
+	timeSlice uint64
+
 	// Per-P GC state
 	gcAssistTime         int64 // Nanoseconds in assistAlloc
 	gcFractionalMarkTime int64 // Nanoseconds in fractional mark worker (atomic)
@@ -734,6 +807,9 @@ type p struct {
 	// gcMarkWorkerStartTime is the nanotime() at which the most recent
 	// mark worker started.
 	gcMarkWorkerStartTime int64
+	// gcMarkWorkerScanWork is the scan work performed by the most
+	// recent mark worker stint on this P.
+	gcMarkWorkerScanWork int64
 
 	// gcw is this P's GC work buffer cache. The work buffer is
 	// filled by write barriers, drained by mutator assists, and
@@ -746,6 +822,11 @@ type p struct {
 	// TODO: Consider caching this in the running G.
 	wbBuf wbBuf
 
+	// wbStats counts this P's write barrier buffer flushes. It is
+	// written by the P, or with the world stopped, and read with
+	// the world stopped.
+	wbStats wbBufStats
+
 	runSafePointFn uint32 // 注释：(以避免发生竞争)是否有安全节点检查函数0否1是，如果是1则执行安全节点函数 // if 1, run sched.safePointFn at next safe point // 注释：如果为1，则在下一个安全点运行sched.safePointFn
 
 	// statsSeq is a counter indicating whether this P is currently
@@ -770,6 +851,11 @@ type p struct {
 	// Modified using atomic instructions.
 	deletedTimers uint32
 
+	// Timing wheel of timers that are not due soon, used instead
+	// of the heap for them if GODEBUG=timerwheel=1.
+	// Must hold timersLock to access.
+	timerWheel *timerWheel
+
 	// Race context used while executing timer functions.
 	timerRaceCtx uintptr
 
@@ -788,6 +874,7 @@ type schedt struct {
 	goidgen   uint64 // 注释：全局G协成ID的分配计数器（小于等于这个值表示已经分配给G作为ID，或者已经把ID给了P准备给G分配）(每次给P分配16个ID)(第一个协成main的ID是1，因为当时这个字段是0)
 	lastpoll  uint64 // time of last network poll, 0 if currently polling
 	pollUntil uint64 // time to which current poll is sleeping
+	busySince uint64 // time the last idle P was taken, if none is idle now
 
 	lock mutex // 注释：锁（把局部P加入全局P队列会用到，修改的字段是"runq和runqsize"）(系统调用时也会用到)
 
@@ -801,6 +888,8 @@ type schedt struct {
 	maxmcount    int32    // maximum number of m's allowed (or die)  // 注释：最多只能创建maxmcount个工作线程m
 	nmsys        int32    // 注释：译：不计入死锁的系统m数 // number of system m's not counted for deadlock
 	nmfreed      int64    // 注释：释放的m的累积数 // cumulative number of freed m's
+	mpeak        int32    // highest number of m's alive at once
+	nmidleexit   uint32   // cumulative number of idle m's made to exit by sysmon; updated atomically
 
 	ngsys uint32 // 注释：译：系统goroutine的数量；以原子方式更新 // number of system goroutines; updated atomically
 
@@ -954,6 +1043,7 @@ type forcegcstate struct {
 	lock mutex
 	g    *g
 	idle uint32
+	kind gcTriggerKind // trigger to start the GC with; protected by lock
 }
 
 // extendRandom extends the random numbers in r[:n] to the whole slice r.
@@ -1074,66 +1164,88 @@ type waitReason uint8
 
 // 注释：等待锁的原因
 const (
-	waitReasonZero                  waitReason = iota // ""
-	waitReasonGCAssistMarking                         // "GC assist marking"
-	waitReasonIOWait                                  // "IO wait"
-	waitReasonChanReceiveNilChan                      // "chan receive (nil chan)"
-	waitReasonChanSendNilChan                         // "chan send (nil chan)"
-	waitReasonDumpingHeap                             // "dumping heap"
-	waitReasonGarbageCollection                       // "garbage collection"
-	waitReasonGarbageCollectionScan                   // "garbage collection scan"
-	waitReasonPanicWait                               // "panicwait"
-	waitReasonSelect                                  // "select"
-	waitReasonSelectNoCases                           // "select (no cases)"
-	waitReasonGCAssistWait                            // "GC assist wait"
-	waitReasonGCSweepWait                             // "GC sweep wait"
-	waitReasonGCScavengeWait                          // "GC scavenge wait"
-	waitReasonChanReceive                             // "chan receive"
-	waitReasonChanSend                                // "chan send"
-	waitReasonFinalizerWait                           // "finalizer wait"
-	waitReasonForceGCIdle                             // "force gc (idle)"
-	waitReasonSemacquire                              // "semacquire"
-	waitReasonSleep                                   // "sleep"
-	waitReasonSyncCondWait                            // "sync.Cond.Wait"
-	waitReasonTimerGoroutineIdle                      // "timer goroutine (idle)"
-	waitReasonTraceReaderBlocked                      // "trace reader (blocked)"
-	waitReasonWaitForGCCycle                          // "wait for GC cycle"
-	waitReasonGCWorkerIdle                            // "GC worker (idle)"
-	waitReasonPreempted                               // "preempted"
-	waitReasonDebugCall                               // "debug call"
+	waitReasonZero waitReason = iota // ""
+
+	// The reasons for which goroutines block on behalf of user code come
+	// first, in a fixed order, since runtime.WaitReason exports their
+	// values. Don't reorder them.
+	waitReasonChanReceive        // "chan receive"
+	waitReasonChanReceiveNilChan // "chan receive (nil chan)"
+	waitReasonChanSend           // "chan send"
+	waitReasonChanSendNilChan    // "chan send (nil chan)"
+	waitReasonIOWait             // "IO wait"
+	waitReasonSelect             // "select"
+	waitReasonSelectNoCases      // "select (no cases)"
+	waitReasonSemacquire         // "semacquire"
+	waitReasonSleep              // "sleep"
+	waitReasonSyncCondWait       // "sync.Cond.Wait"
+
+	waitReasonGCAssistMarking       // "GC assist marking"
+	waitReasonDumpingHeap           // "dumping heap"
+	waitReasonGarbageCollection     // "garbage collection"
+	waitReasonGarbageCollectionScan // "garbage collection scan"
+	waitReasonPanicWait             // "panicwait"
+	waitReasonGCAssistWait          // "GC assist wait"
+	waitReasonGCSweepWait           // "GC sweep wait"
+	waitReasonGCScavengeWait        // "GC scavenge wait"
+	waitReasonFinalizerWait         // "finalizer wait"
+	waitReasonForceGCIdle           // "force gc (idle)"
+	waitReasonTimerGoroutineIdle    // "timer goroutine (idle)"
+	waitReasonTraceReaderBlocked    // "trace reader (blocked)"
+	waitReasonWaitForGCCycle        // "wait for GC cycle"
+	waitReasonGCWorkerIdle          // "GC worker (idle)"
+	waitReasonPreempted             // "preempted"
+	waitReasonDebugCall             // "debug call"
+	waitReasonAutoProcsIdle         // "GOMAXPROCS updater (idle)"
+	waitReasonGCNotifierIdle        // "GC notifier (idle)"
+	waitReasonFinalizerAlarmIdle    // "finalizer alarm (idle)"
+	waitReasonShrinkStacks          // "shrinking stacks"
+	waitReasonCoarseTimerIdle       // "coarse timer runner (idle)"
+
+	// waitReasonFirstUser is the first of the reasons registered
+	// with NewWaitReason. Add new reasons above it.
+	waitReasonFirstUser
 )
 
 var waitReasonStrings = [...]string{
 	waitReasonZero:                  "",
-	waitReasonGCAssistMarking:       "GC assist marking",
-	waitReasonIOWait:                "IO wait",
+	waitReasonChanReceive:           "chan receive",
 	waitReasonChanReceiveNilChan:    "chan receive (nil chan)",
+	waitReasonChanSend:              "chan send",
 	waitReasonChanSendNilChan:       "chan send (nil chan)",
+	waitReasonIOWait:                "IO wait",
+	waitReasonSelect:                "select",
+	waitReasonSelectNoCases:         "select (no cases)",
+	waitReasonSemacquire:            "semacquire",
+	waitReasonSleep:                 "sleep",
+	waitReasonSyncCondWait:          "sync.Cond.Wait",
+	waitReasonGCAssistMarking:       "GC assist marking",
 	waitReasonDumpingHeap:           "dumping heap",
 	waitReasonGarbageCollection:     "garbage collection",
 	waitReasonGarbageCollectionScan: "garbage collection scan",
 	waitReasonPanicWait:             "panicwait",
-	waitReasonSelect:                "select",
-	waitReasonSelectNoCases:         "select (no cases)",
 	waitReasonGCAssistWait:          "GC assist wait",
 	waitReasonGCSweepWait:           "GC sweep wait",
 	waitReasonGCScavengeWait:        "GC scavenge wait",
-	waitReasonChanReceive:           "chan receive",
-	waitReasonChanSend:              "chan send",
 	waitReasonFinalizerWait:         "finalizer wait",
 	waitReasonForceGCIdle:           "force gc (idle)",
-	waitReasonSemacquire:            "semacquire",
-	waitReasonSleep:                 "sleep",
-	waitReasonSyncCondWait:          "sync.Cond.Wait",
 	waitReasonTimerGoroutineIdle:    "timer goroutine (idle)",
 	waitReasonTraceReaderBlocked:    "trace reader (blocked)",
 	waitReasonWaitForGCCycle:        "wait for GC cycle",
 	waitReasonGCWorkerIdle:          "GC worker (idle)",
 	waitReasonPreempted:             "preempted",
 	waitReasonDebugCall:             "debug call",
+	waitReasonAutoProcsIdle:         "GOMAXPROCS updater (idle)",
+	waitReasonGCNotifierIdle:        "GC notifier (idle)",
+	waitReasonFinalizerAlarmIdle:    "finalizer alarm (idle)",
+	waitReasonShrinkStacks:          "shrinking stacks",
+	waitReasonCoarseTimerIdle:       "coarse timer runner (idle)",
 }
 
 func (w waitReason) String() string {
+	if w >= waitReasonFirstUser {
+		return userWaitReasonString(w)
+	}
 	if w < 0 || w >= waitReason(len(waitReasonStrings)) {
 		return "unknown wait reason"
 	}
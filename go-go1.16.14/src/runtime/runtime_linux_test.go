@@ -5,7 +5,17 @@
 package runtime_test
 
 import (
+	"fmt"
+	"internal/race"
+	"internal/testenv"
+	"os"
+	"os/exec"
+	"reflect"
 	. "runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -61,3 +71,555 @@ func TestEpollctlErrorSign(t *testing.T) {
 		t.Errorf("epollctl = %v, want %v", v, -EBADF)
 	}
 }
+
+func TestAllThreadsSyscallObserver(t *testing.T) {
+	var calls, threads int
+	var nanos int64
+	SetAllThreadsSyscallObserver(func(threadCount int, ns int64) {
+		calls++
+		threads = threadCount
+		nanos = ns
+	})
+	defer SetAllThreadsSyscallObserver(nil)
+
+	if _, _, err := syscall.AllThreadsSyscall(syscall.SYS_GETPID, 0, 0, 0); err == syscall.ENOTSUP {
+		t.Skip("AllThreadsSyscall not supported with cgo")
+	} else if err != 0 {
+		t.Fatalf("AllThreadsSyscall failed: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("observer called %d times, want 1", calls)
+	}
+	// There is always at least the calling thread and sysmon.
+	if threads < 2 {
+		t.Errorf("observer reported %d threads, want at least 2", threads)
+	}
+	if nanos <= 0 {
+		t.Errorf("observer reported duration %d, want > 0", nanos)
+	}
+}
+
+var prefaultSink [][]byte
+
+func TestArenaPrefault(t *testing.T) {
+	// Memory freed by other tests can satisfy the allocations below
+	// without growing the heap, so run the test in a new process.
+	// Keep the heap out of transparent huge pages there, so that
+	// each page written takes a fault of its own.
+	if os.Getenv("TEST_ARENA_PREFAULT") != "1" {
+		testenv.MustHaveExec(t)
+		cmd := testenv.CleanCmdEnv(exec.Command(os.Args[0], "-test.run=TestArenaPrefault", "-test.v"))
+		cmd.Env = append(cmd.Env, "TEST_ARENA_PREFAULT=1", "GODEBUG=hugepages=1")
+		out, err := cmd.CombinedOutput()
+		t.Logf("%s", out)
+		if err != nil || !strings.Contains(string(out), "PASS\n") {
+			t.Fatalf("exit status %v", err)
+		}
+		if strings.Contains(string(out), "--- SKIP") {
+			t.Skip("skipped in child process")
+		}
+		return
+	}
+
+	defer SetArenaPrefault(false)
+	defer func() { prefaultSink = nil }()
+
+	// Keep the collector, and the memory it touches, out of the way.
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	// Count only the page faults taken by this thread, which
+	// allocates the blocks and writes to them.
+	LockOSThread()
+	defer UnlockOSThread()
+
+	// faults allocates a block large enough to grow the heap, then
+	// writes to each of its pages, and reports the number of page
+	// faults taken by the allocation and by the writes, and whether
+	// the heap grew by at least half the size of the block.
+	faults := func(prefault bool) (alloc, touch int64, grew bool) {
+		SetArenaPrefault(prefault)
+		var ms0, ms1 MemStats
+		var r0, r1, r2 syscall.Rusage
+		ReadMemStats(&ms0)
+		syscall.Getrusage(syscall.RUSAGE_THREAD, &r0)
+		b := make([]byte, 64<<20)
+		syscall.Getrusage(syscall.RUSAGE_THREAD, &r1)
+		for i := 0; i < len(b); i += 4096 {
+			b[i] = 1
+		}
+		syscall.Getrusage(syscall.RUSAGE_THREAD, &r2)
+		ReadMemStats(&ms1)
+		// Keep b live so the next call has to grow the heap too.
+		prefaultSink = append(prefaultSink, b)
+		return int64(r1.Minflt - r0.Minflt), int64(r2.Minflt - r1.Minflt), ms1.HeapSys-ms0.HeapSys >= uint64(len(b))/2
+	}
+
+	offAlloc, offTouch, offGrew := faults(false)
+	onAlloc, onTouch, onGrew := faults(true)
+	t.Logf("page faults allocating/touching new heap memory: prefault off %d/%d, on %d/%d", offAlloc, offTouch, onAlloc, onTouch)
+	if !offGrew || !onGrew {
+		// The block reused memory already in the heap, possibly
+		// released to the OS, which prefault doesn't apply to.
+		t.Skip("heap did not grow by half the size of the block")
+	}
+	if offTouch < 16 {
+		// Transparent huge pages, or memory faulted in by the
+		// allocation itself, left too few faults to compare.
+		t.Skipf("only %d page faults writing to new memory without prefault", offTouch)
+	}
+	// With prefault, the faults should have been taken while the
+	// heap grew rather than when the memory was first written.
+	if onTouch >= offTouch/2 {
+		t.Errorf("prefault did not reduce page faults on first write: %d without prefault, %d with", offTouch, onTouch)
+	}
+}
+
+func TestSysmonNetpollObserver(t *testing.T) {
+	var polls, readied uint32
+	SetSysmonNetpollObserver(func(n int, nanos int64) {
+		atomic.AddUint32(&polls, 1)
+		atomic.AddUint32(&readied, uint32(n))
+	})
+	defer SetSysmonNetpollObserver(nil)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// Keep every P busy with goroutines that the scheduler finds on
+	// the run queues, so that it doesn't poll the network itself and
+	// leaves that to sysmon. The goroutines yield rather than rely on
+	// being preempted, which may be disabled.
+	defer GOMAXPROCS(GOMAXPROCS(2))
+	var stop uint32
+	defer atomic.StoreUint32(&stop, 1)
+	for i := 0; i < 3; i++ {
+		go func() {
+			for atomic.LoadUint32(&stop) == 0 {
+				Gosched()
+			}
+		}()
+	}
+
+	// A thread may still be blocked polling the network from before
+	// the P's were busy, so try a few times.
+	for i := 0; i < 10 && atomic.LoadUint32(&readied) == 0; i++ {
+		done := make(chan bool)
+		go func() {
+			var b [1]byte
+			r.Read(b[:])
+			done <- true
+		}()
+		// Give the reader time to block in the network poller,
+		// without letting this P go idle.
+		for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+		}
+		if _, err := w.Write([]byte{0}); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+	}
+	if atomic.LoadUint32(&polls) == 0 {
+		t.Fatal("sysmon did not poll the network")
+	}
+	if atomic.LoadUint32(&readied) == 0 {
+		t.Error("sysmon's network polls readied no goroutines")
+	}
+}
+
+func TestPTransitionObserver(t *testing.T) {
+	// The observer may not allocate, so record the transitions in a
+	// preallocated log.
+	type transition struct {
+		pid      int32
+		from, to uint8
+	}
+	var (
+		n   uint32
+		log [1 << 16]transition
+	)
+	SetPTransitionObserver(func(pid int32, from, to uint8) {
+		if i := atomic.AddUint32(&n, 1) - 1; i < uint32(len(log)) {
+			log[i] = transition{pid, from, to}
+		}
+	})
+	defer SetPTransitionObserver(nil)
+
+	// Sleep in system calls long enough for sysmon to retake the P's,
+	// and in between leave the P's idle.
+	defer GOMAXPROCS(GOMAXPROCS(2))
+	for i := 0; i < 5; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sysNanosleep(time.Millisecond)
+			}()
+		}
+		wg.Wait()
+		time.Sleep(time.Millisecond)
+	}
+
+	// Stop the world while another goroutine keeps its P running, so
+	// that the P is stopped from gcstopm. The goroutine yields rather
+	// than spins, as it may not be preempted asynchronously.
+	var stop uint32
+	done := make(chan bool)
+	go func() {
+		for atomic.LoadUint32(&stop) == 0 {
+			Gosched()
+		}
+		done <- true
+	}()
+	var ms MemStats
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Millisecond)
+		ReadMemStats(&ms)
+	}
+	atomic.StoreUint32(&stop, 1)
+	<-done
+	SetPTransitionObserver(nil)
+
+	const (
+		pIdle    = 0
+		pRunning = 1
+		pSyscall = 2
+		pStopped = 3
+	)
+	count := int(atomic.LoadUint32(&n))
+	if count > len(log) {
+		count = len(log)
+	}
+	var last [2]int // index+1 of each P's last transition
+	var seen [4][4]bool
+	for i, tr := range log[:count] {
+		if tr.from == tr.to {
+			t.Errorf("P %d reported transition from status %d to itself", tr.pid, tr.from)
+		}
+		if tr.pid < 0 || int(tr.pid) >= len(last) {
+			continue
+		}
+		if j := last[tr.pid]; j != 0 && log[j-1].to != tr.from {
+			t.Errorf("P %d went from status %d to %d, but was last reported going to %d", tr.pid, tr.from, tr.to, log[j-1].to)
+		}
+		last[tr.pid] = i + 1
+		if tr.from <= pStopped && tr.to <= pStopped {
+			seen[tr.from][tr.to] = true
+		}
+	}
+	for _, tr := range []struct{ from, to int }{
+		{pRunning, pSyscall},
+		{pSyscall, pIdle},
+		{pIdle, pRunning},
+		{pRunning, pIdle},
+		{pIdle, pStopped},
+		{pRunning, pStopped},
+	} {
+		if !seen[tr.from][tr.to] {
+			t.Errorf("no P went from status %d to %d", tr.from, tr.to)
+		}
+	}
+}
+
+func TestCPUNUMANode(t *testing.T) {
+	switch GOARCH {
+	case "amd64", "arm64":
+	default:
+		t.Skipf("getcpu not implemented on %s", GOARCH)
+	}
+	if node := CPUNUMANode(); node < 0 {
+		t.Errorf("CPUNUMANode() = %d, want a node", node)
+	}
+	// The thread may move between the calls, but not often to
+	// another node.
+	LockOSThread()
+	defer UnlockOSThread()
+	if got, want := MNUMANode(), CPUNUMANode(); got != want {
+		t.Errorf("MNUMANode() = %d, want %d", got, want)
+	}
+}
+
+func TestParseCPURange(t *testing.T) {
+	for _, tt := range []struct {
+		s      string
+		lo, hi int32
+	}{
+		{"3", 3, 3},
+		{"0-63", 0, 63},
+		{"", -1, -1},
+		{"-3", -1, -1},
+		{"3-", -1, -1},
+		{"4-3", -1, -1},
+		{"x", -1, -1},
+	} {
+		if lo, hi := ParseCPURange([]byte(tt.s)); lo != tt.lo || hi != tt.hi {
+			t.Errorf("ParseCPURange(%q) = %d, %d, want %d, %d", tt.s, lo, hi, tt.lo, tt.hi)
+		}
+	}
+}
+
+func TestCPULimit(t *testing.T) {
+	for _, tt := range []struct {
+		quota, period string
+		want          int32
+	}{
+		{"max", "100000", -1},
+		{"-1", "100000", -1},
+		{"", "", -1},
+		{"100000", "0", -1},
+		{"100000", "100000", 1},
+		{"150000", "100000", 2},
+		{"400000", "100000", 4},
+		{"1000", "100000", 1},
+	} {
+		if got := CPULimit(tt.quota, tt.period); got != tt.want {
+			t.Errorf("CPULimit(%q, %q) = %d, want %d", tt.quota, tt.period, got, tt.want)
+		}
+	}
+}
+
+func TestParseProcCgroup(t *testing.T) {
+	for _, tt := range []struct {
+		line   string
+		path   string
+		v2, ok bool
+	}{
+		{"0::/user.slice/session-1.scope", "/user.slice/session-1.scope", true, true},
+		{"0::/", "/", true, true},
+		{"4:cpu,cpuacct:/docker/abc", "/docker/abc", false, true},
+		{"7:cpu:/", "/", false, true},
+		{"3:cpuset:/docker/abc", "", false, false},
+		{"5:memory:/docker/abc", "", false, false},
+		{"1:name=systemd:/init.scope", "", false, false},
+		{"garbage", "", false, false},
+	} {
+		path, v2, ok := ParseProcCgroup(tt.line)
+		if path != tt.path || v2 != tt.v2 || ok != tt.ok {
+			t.Errorf("ParseProcCgroup(%q) = %q, %v, %v, want %q, %v, %v", tt.line, path, v2, ok, tt.path, tt.v2, tt.ok)
+		}
+	}
+}
+
+func TestParseMountInfo(t *testing.T) {
+	for _, tt := range []struct {
+		line        string
+		root, mount string
+		v2, ok      bool
+	}{
+		{"35 24 0:30 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:9 - cgroup2 cgroup2 rw,nsdelegate", "/", "/sys/fs/cgroup", true, true},
+		{"40 30 0:35 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid shared:15 - cgroup cgroup rw,cpu,cpuacct", "/", "/sys/fs/cgroup/cpu,cpuacct", false, true},
+		{"1100 1090 0:35 /docker/abc /sys/fs/cgroup/cpu ro,nosuid - cgroup cgroup rw,cpu", "/docker/abc", "/sys/fs/cgroup/cpu", false, true},
+		{"41 30 0:36 / /sys/fs/cgroup/cpuset rw,nosuid shared:16 - cgroup cgroup rw,cpuset", "", "", false, false},
+		{"22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw", "", "", false, false},
+		{"22 1 8:1 / / rw,relatime shared:1", "", "", false, false},
+	} {
+		root, mount, v2, ok := ParseMountInfo(tt.line)
+		if root != tt.root || mount != tt.mount || v2 != tt.v2 || ok != tt.ok {
+			t.Errorf("ParseMountInfo(%q) = %q, %q, %v, %v, want %q, %q, %v, %v", tt.line, root, mount, v2, ok, tt.root, tt.mount, tt.v2, tt.ok)
+		}
+	}
+}
+
+func TestJoinCgroupPath(t *testing.T) {
+	for _, tt := range []struct {
+		n                         int
+		mount, root, cgroup, file string
+		want                      string
+	}{
+		{256, "/sys/fs/cgroup", "/", "/user.slice", "cpu.max", "/sys/fs/cgroup/user.slice/cpu.max"},
+		{256, "/sys/fs/cgroup", "/", "/", "cpu.max", "/sys/fs/cgroup/cpu.max"},
+		{256, "/sys/fs/cgroup/cpu", "/docker/abc", "/docker/abc", "cpu.cfs_quota_us", "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"},
+		{256, "/sys/fs/cgroup/cpu", "/docker", "/docker/abc/x", "cpu.cfs_quota_us", "/sys/fs/cgroup/cpu/abc/x/cpu.cfs_quota_us"},
+		{256, "/sys/fs/cgroup/cpu", "/docker/abc", "/", "cpu.cfs_quota_us", "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"},
+		{23, "/sys/fs/cgroup", "/", "/", "cpu.max", "/sys/fs/cgroup/cpu.max"},
+		{22, "/sys/fs/cgroup", "/", "/", "cpu.max", ""},
+	} {
+		if got := JoinCgroupPath(tt.n, tt.mount, tt.root, tt.cgroup, tt.file); got != tt.want {
+			t.Errorf("JoinCgroupPath(%d, %q, %q, %q, %q) = %q, want %q", tt.n, tt.mount, tt.root, tt.cgroup, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestProcLineReader(t *testing.T) {
+	long := strings.Repeat("x", 1500)
+	f, err := os.CreateTemp("", "proclines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	var want []string
+	var data string
+	for i := 0; i < 100; i++ {
+		line := fmt.Sprintf("line %d %s", i, strings.Repeat("y", i*7%300))
+		want = append(want, line)
+		data += line + "\n"
+		if i%10 == 0 {
+			data += long + "\n"
+		}
+	}
+	data += "\nlast"
+	want = append(want, "", "last")
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	got := ReadProcLines(f.Name())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadProcLines read %d lines, want %d:\n%q", len(got), len(want), got)
+	}
+}
+
+func TestAutoGOMAXPROCS(t *testing.T) {
+	want := NumCPU()
+	if n := int(CgroupCPULimit()); n > 0 && n < want {
+		want = n
+	}
+	output := runTestProg(t, "testprog", "AutoGOMAXPROCS", "GODEBUG=autogomaxprocs=1")
+	if expected := fmt.Sprintf("%d\n%d\n", want, NumCPU()+1); output != expected {
+		t.Errorf("with GODEBUG=autogomaxprocs=1: got %q, want %q", output, expected)
+	}
+	output = runTestProg(t, "testprog", "AutoGOMAXPROCS", "GODEBUG=autogomaxprocs=1", "GOMAXPROCS=3")
+	if expected := fmt.Sprintf("3\n%d\n", NumCPU()+1); output != expected {
+		t.Errorf("with GOMAXPROCS=3: got %q, want %q", output, expected)
+	}
+}
+
+func TestHugePagePolicyGODEBUG(t *testing.T) {
+	if PhysHugePageSize == 0 {
+		t.Skip("no transparent huge page support")
+	}
+	for _, tt := range []struct {
+		policy int
+		flags  []string // any of these VmFlags
+	}{
+		{HugePagesNever, []string{"nh"}},
+		{HugePagesTransparent, []string{"hg"}},
+		// Without explicit huge pages to spare, the runtime
+		// asks for transparent ones.
+		{HugePagesExplicit, []string{"ht", "hg"}},
+	} {
+		output := runTestProg(t, "testprog", "HugePageFlags", fmt.Sprintf("GODEBUG=hugepages=%d", tt.policy))
+		flags := strings.Fields(output)
+		found := false
+		for _, f := range flags {
+			for _, want := range tt.flags {
+				found = found || f == want
+			}
+		}
+		if !found {
+			t.Errorf("with hugepages=%d: heap mapping has flags %q, want one of %q", tt.policy, output, tt.flags)
+		}
+	}
+}
+
+func TestHeapHint(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("heap hints need a 64-bit address space")
+	}
+	if race.Enabled {
+		t.Skip("heap hints are ignored in race mode")
+	}
+	// Hint at an address well inside the address space the heap
+	// may use, but above where it normally starts.
+	hint := uint64(1) << (HeapAddrBits - 4)
+	output := runTestProg(t, "testprog", "HeapHint", fmt.Sprintf("GOHEAPHINT=%#x", hint))
+	if want := "OK\n"; output != want {
+		t.Fatalf("want %q, got %q", want, output)
+	}
+}
+
+func TestSetThreadName(t *testing.T) {
+	SetThreadName("gotest-")
+	defer SetThreadName("")
+
+	// Make the runtime start threads for system calls that block,
+	// which get named as they start.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sysNanosleep(20 * time.Millisecond)
+		}()
+	}
+	wg.Wait()
+
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		t.Skip(err)
+	}
+	named := 0
+	for _, task := range tasks {
+		comm, err := os.ReadFile("/proc/self/task/" + task.Name() + "/comm")
+		if err != nil {
+			// The thread exited.
+			continue
+		}
+		name := strings.TrimSuffix(string(comm), "\n")
+		if task.Name() == fmt.Sprint(pid) {
+			if strings.HasPrefix(name, "gotest-") {
+				t.Errorf("main thread renamed to %q", name)
+			}
+			continue
+		}
+		if !strings.HasPrefix(name, "gotest-") {
+			t.Errorf("thread %s named %q, want prefix gotest-", task.Name(), name)
+		}
+		named++
+	}
+	if named == 0 {
+		t.Error("no named threads")
+	}
+}
+
+func TestMbind(t *testing.T) {
+	switch GOARCH {
+	case "amd64", "arm64":
+	default:
+		t.Skipf("mbind not implemented on %s", GOARCH)
+	}
+	b, err := syscall.Mmap(-1, 0, 1<<20, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Munmap(b)
+
+	node := CPUNUMANode()
+	if node < 0 || node >= 64 {
+		t.Skipf("no usable NUMA node, got %d", node)
+	}
+	mask := uint64(1) << uint(node)
+	const mpolPreferred = 1
+	switch errno := -Mbind(unsafe.Pointer(&b[0]), uintptr(len(b)), mpolPreferred, &mask, 64+1, 0); syscall.Errno(errno) {
+	case 0:
+	case syscall.ENOSYS, syscall.EPERM:
+		t.Skipf("mbind: %v", syscall.Errno(errno))
+	default:
+		t.Fatalf("mbind: %v", syscall.Errno(errno))
+	}
+	// The memory must still be usable.
+	for i := range b {
+		b[i] = 1
+	}
+}
+
+func TestNetpollShards(t *testing.T) {
+	for _, tt := range []struct {
+		shards    string
+		instances int
+	}{
+		{"0", 1},
+		{"4", 4},
+		{"1000", 64},
+	} {
+		output := runTestProg(t, "testprog", "NetpollShards", "GODEBUG=netpollshards="+tt.shards)
+		want := fmt.Sprintf("%d epoll instances\nOK\n", tt.instances)
+		if output != want {
+			t.Errorf("netpollshards=%s: want %q, got %q", tt.shards, want, output)
+		}
+	}
+}
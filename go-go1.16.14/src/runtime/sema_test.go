@@ -101,3 +101,35 @@ func testSemaHandoff() bool {
 
 	return res == 1 // did the waiter run first?
 }
+
+func TestGoyieldObserver(t *testing.T) {
+	var yields, last int64
+	SetGoyieldObserver(func(goid int64) {
+		atomic.AddInt64(&yields, 1)
+		atomic.StoreInt64(&last, goid)
+	})
+	defer SetGoyieldObserver(nil)
+
+	// Releasing a semaphore with handoff to a waiter yields the
+	// releasing goroutine's P to it through goyield. The release can
+	// miss a waiter that has not finished queueing, so try a few times.
+	for i := 0; i < 100 && atomic.LoadInt64(&yields) == 0; i++ {
+		var sema uint32
+		done := make(chan bool)
+		go func() {
+			Semacquire(&sema)
+			done <- true
+		}()
+		for SemNwait(&sema) == 0 {
+			Gosched()
+		}
+		Semrelease1(&sema, true, 0)
+		<-done
+	}
+	if atomic.LoadInt64(&yields) == 0 {
+		t.Fatal("observer not called for semaphore handoff")
+	}
+	if got, want := atomic.LoadInt64(&last), Goid(); got != want {
+		t.Errorf("observer reported goroutine %d yielding, want %d", got, want)
+	}
+}
@@ -375,6 +375,13 @@ func preemptM(mp *m) {
 	}
 }
 
+// signalFixupM signals the thread of mp, which may be running C code,
+// to hold in its signal handler and run its mFixup.fn from there. See
+// syscall_runtime_doAllThreadsSyscall.
+func signalFixupM(mp *m) {
+	signalM(mp, sigPreempt)
+}
+
 // sigFetchG fetches the value of G safely when running in a signal handler.
 // On some architectures, the g value may be clobbered when running in a VDSO.
 // See issue #32912.
@@ -420,7 +427,26 @@ func sigtrampgo(sig uint32, info *siginfo, ctx unsafe.Pointer) {
 	c := &sigctxt{info, ctx}
 	g := sigFetchG(c)
 	setg(g)
-	if g == nil {
+	if g != nil && g.m.isExtraInC && sig == sigPreempt && g.m.mFixup.signal {
+		// The thread is running C code, with g still set to the
+		// g0 of the extra m bound to it (see dropm), and
+		// syscall_runtime_doAllThreadsSyscall is waiting for it
+		// to hold here.
+		setg(g.m.gsignal)
+		var gsignalStack gsignalStack
+		setStack := adjustSignalStack(sig, g.m, &gsignalStack)
+		mHoldFixup()
+		setg(g)
+		if setStack {
+			restoreGsignalStack(&gsignalStack)
+		}
+		return
+	}
+	if g == nil || g.m.isExtraInC {
+		// Either this is not a Go thread, or it is a C thread
+		// running C code between calls into Go, still bound to
+		// an extra m. Handle the signal as for a non-Go thread,
+		// and leave g as it was.
 		if sig == _SIGPROF {
 			sigprofNonGoPC(c.sigpc())
 			return
@@ -440,6 +466,7 @@ func sigtrampgo(sig uint32, info *siginfo, ctx unsafe.Pointer) {
 		}
 		c.fixsigcode(sig)
 		badsignal(uintptr(sig), c)
+		setg(g)
 		return
 	}
 
@@ -504,6 +531,7 @@ func adjustSignalStack(sig uint32, mp *m, gsigStack *gsignalStack) bool {
 	// sp is not within gsignal stack, g0 stack, or sigaltstack. Bad.
 	setg(nil)
 	needm()
+	getg().m.isExtraInSig = true
 	if st.ss_flags&_SS_DISABLE != 0 {
 		noSignalStack(sig)
 	} else {
@@ -559,6 +587,16 @@ func sighandler(sig uint32, info *siginfo, ctxt unsafe.Pointer, gp *g) {
 		// still let it through to the application.
 	}
 
+	if sig == sigPreempt && _g_.m.mFixup.signal {
+		// Might be from syscall_runtime_doAllThreadsSyscall,
+		// for a thread that may be running C code.
+		mHoldFixup()
+	}
+
+	if sigPreHandled(sig, c) {
+		return
+	}
+
 	flags := int32(_SigThrow)
 	if sig < uint32(len(sigtable)) {
 		flags = sigtable[sig].flags
@@ -616,6 +654,12 @@ func sighandler(sig uint32, info *siginfo, ctxt unsafe.Pointer, gp *g) {
 	_g_.m.throwing = 1
 	_g_.m.caughtsig.set(gp)
 
+	if sig < uint32(len(sigtable)) {
+		callCrashHandler(gp, sigtable[sig].name, false, sig)
+	} else {
+		callCrashHandler(gp, "", false, sig)
+	}
+
 	if crashing == 0 {
 		startpanic_m()
 	}
@@ -949,7 +993,8 @@ func badsignal(sig uintptr, c *sigctxt) {
 		*(*uintptr)(unsafe.Pointer(uintptr(123))) = 2
 	}
 	needm()
-	if !sigsend(uint32(sig)) {
+	getg().m.isExtraInSig = true
+	if !sigPreHandled(uint32(sig), c) && !sigsend(uint32(sig)) {
 		// A foreign thread received the signal sig, and the
 		// Go code does not want to handle it.
 		raisebadsignal(uint32(sig), c)
@@ -957,6 +1002,28 @@ func badsignal(sig uintptr, c *sigctxt) {
 	dropm()
 }
 
+// sigPreHandled calls the handler installed for sig with
+// SetSignalPreHandler, if any, and reports whether it handled the
+// signal.
+//go:nowritebarrierrec
+func sigPreHandled(sig uint32, c *sigctxt) bool {
+	if sig >= uint32(len(sigPreHandlers)) {
+		return false
+	}
+	fn := sigPreHandlers[sig]
+	if fn == nil {
+		return false
+	}
+	info := SignalInfo{
+		Signal: int(sig),
+		Code:   int(c.sigcode()),
+		Addr:   uintptr(c.sigaddr()),
+		PC:     c.sigpc(),
+		SP:     c.sigsp(),
+	}
+	return fn((*SignalInfo)(noescape(unsafe.Pointer(&info))))
+}
+
 //go:noescape
 func sigfwd(fn uintptr, sig uint32, info *siginfo, ctx unsafe.Pointer)
 
@@ -1014,9 +1081,10 @@ func sigfwdgo(sig uint32, info *siginfo, ctx unsafe.Pointer) bool {
 	// Determine if the signal occurred inside Go code. We test that:
 	//   (1) we weren't in VDSO page,
 	//   (2) we were in a goroutine (i.e., m.curg != nil), and
-	//   (3) we weren't in CGO.
+	//   (3) we weren't in CGO, and
+	//   (4) we weren't on a C thread between calls into Go.
 	g := sigFetchG(c)
-	if g != nil && g.m != nil && g.m.curg != nil && !g.m.incgo {
+	if g != nil && g.m != nil && g.m.curg != nil && !g.m.incgo && !g.m.isExtraInC {
 		return false
 	}
 
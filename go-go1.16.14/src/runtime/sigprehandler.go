@@ -0,0 +1,48 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+// SignalInfo describes a signal passed to a handler installed with
+// SetSignalPreHandler.
+type SignalInfo struct {
+	Signal int     // signal number
+	Code   int     // si_code of the signal
+	Addr   uintptr // si_addr of the signal, the faulting address for SIGSEGV, SIGBUS and the like
+	PC     uintptr // program counter of the interrupted code
+	SP     uintptr // stack pointer of the interrupted code
+}
+
+// sigPreHandlers holds the handlers installed with
+// SetSignalPreHandler, indexed by signal number.
+var sigPreHandlers [_NSIG]func(*SignalInfo) bool
+
+// SetSignalPreHandler arranges for fn to be called each time the
+// runtime's signal handler receives signal sig, before the runtime
+// acts on it: before it turns a fault into a panic or a crash, and
+// before it delivers the signal to channels registered with
+// os/signal.Notify. If fn reports that it handled the signal, the
+// runtime does nothing more with it and the interrupted code resumes,
+// retrying the instruction that faulted, if any. This lets a program
+// that runs machine code it generated itself, or that maps memory in
+// on demand, handle the faults from that code or memory.
+//
+// fn runs in the signal handler, on the signal stack of the thread
+// that received the signal, possibly while the world is stopped. It
+// must not allocate, block, use much stack or otherwise call into the
+// runtime, though it may make raw system calls with syscall.RawSyscall.
+// The *SignalInfo is only valid for the duration of the call.
+//
+// The runtime still handles the signals it uses for profiling and
+// preemption first. fn is not called for signals the runtime's
+// handler does not receive, such as ones in non-Go code that are
+// forwarded to a handler installed by that code, nor on Windows,
+// Plan 9 and js/wasm. Passing nil removes the handler.
+// SetSignalPreHandler panics if sig is not a valid signal number.
+func SetSignalPreHandler(sig int, fn func(info *SignalInfo) bool) {
+	if sig <= 0 || sig >= len(sigPreHandlers) {
+		panic(plainError("runtime: SetSignalPreHandler: invalid signal number"))
+	}
+	sigPreHandlers[sig] = fn
+}
@@ -350,6 +350,8 @@ func stackalloc(n uint32) stack {
 		print("stackalloc ", n, "\n")
 	}
 
+	accountStack(uintptr(n), 1)
+
 	if debug.efence != 0 || stackFromSystem != 0 {
 		n = uint32(alignUp(uintptr(n), physPageSize))
 		v := sysAlloc(uintptr(n), &memstats.stacks_sys)
@@ -450,6 +452,7 @@ func stackfree(stk stack) {
 		println("stackfree", v, n)
 		memclrNoHeapPointers(v, n) // for testing, clobber stack data
 	}
+	accountStack(n, -1)
 	if debug.efence != 0 || stackFromSystem != 0 {
 		if debug.efence != 0 || stackFaultOnFree != 0 {
 			sysFault(v, n)
@@ -507,6 +510,35 @@ func stackfree(stk stack) {
 	}
 }
 
+// numStackSizes is the number of stack sizes the heap stats count
+// stacks in use by: the powers of two from _FixedStack up, the last
+// also counting all larger stacks. Keep it odd so heapStatsDelta stays
+// a multiple of 8 bytes on 32-bit platforms.
+const numStackSizes = 21
+
+// stackSizeIndex returns the index in heapStatsDelta.stacksInUse of a
+// stack of n bytes.
+func stackSizeIndex(n uintptr) int {
+	i := 0
+	for n > _FixedStack && i < numStackSizes-1 {
+		n >>= 1
+		i++
+	}
+	return i
+}
+
+// accountStack adds delta stacks of n bytes to the stacks in use in
+// the heap stats.
+func accountStack(n uintptr, delta int) {
+	stats := memstats.heapStats.acquire()
+	atomic.Xadduintptr(&stats.stacksInUse[stackSizeIndex(n)], uintptr(delta))
+	if n >= _FixedStack<<_NumStackOrders || n >= _StackCacheSize {
+		// Allocated from a dedicated span by stackalloc.
+		atomic.Xadduintptr(&stats.largeStacks, uintptr(delta)*n)
+	}
+	memstats.heapStats.release()
+}
+
 var maxstacksize uintptr = 1 << 20 // enough until runtime.main sets it for real
 
 var maxstackceiling = maxstacksize
@@ -1055,6 +1087,17 @@ func newstack() {
 			preemptPark(gp) // never returns
 		}
 
+		if deadlineExit(gp) {
+			// Make gp call goexitDeadline in place of the
+			// function whose prologue it is in. The return
+			// address, on the stack or in the link register,
+			// is still that of the function's caller.
+			gp.preempt = false
+			gp.stackguard0 = gp.stack.lo + _StackGuard
+			gp.sched.pc = funcPC(goexitDeadline)
+			gogo(&gp.sched) // never return
+		}
+
 		// Act like goroutine called runtime.Gosched.
 		gopreempt_m(gp) // never return
 	}
@@ -1083,10 +1126,18 @@ func newstack() {
 		throw("stack overflow")
 	}
 
+	if debug.stackgrowtrace > 0 {
+		printStackGrow(gp, oldsize, newsize)
+	}
+
 	// The goroutine must be executing in order to call newstack,
 	// so it must be Grunning (or Gscanrunning).
 	casgstatus(gp, _Grunning, _Gcopystack)
 
+	stats := memstats.heapStats.acquire()
+	atomic.Xadduintptr(&stats.stackGrows, 1)
+	memstats.heapStats.release()
+
 	// The concurrent GC will not scan the stack while we are doing the copy since
 	// the gp is in a Gcopystack status.
 	copystack(gp, newsize)
@@ -1097,6 +1148,20 @@ func newstack() {
 	gogo(&gp.sched)
 }
 
+// printStackGrow prints the GODEBUG=stackgrowtrace line for growing
+// gp's stack from oldsize to newsize bytes. gp.sched.pc is in the
+// prologue of the function that called morestack.
+func printStackGrow(gp *g, oldsize, newsize uintptr) {
+	pc := gp.sched.pc
+	print("stackgrow: goroutine ", gp.goid, " ", oldsize, " -> ", newsize, " bytes at ")
+	if f := findfunc(pc); f.valid() {
+		file, line := funcline(f, pc)
+		print(funcname(f), "+", hex(pc-f.entry), " ", file, ":", line, "\n")
+	} else {
+		print(hex(pc), "\n")
+	}
+}
+
 //go:nosplit
 func nilfunc() {
 	*(*uint8)(nil) = 0
@@ -1192,9 +1257,96 @@ func shrinkstack(gp *g) {
 		print("shrinking stack ", oldsize, "->", newsize, "\n")
 	}
 
+	stats := memstats.heapStats.acquire()
+	atomic.Xadduintptr(&stats.stackShrinks, 1)
+	memstats.heapStats.release()
+
 	copystack(gp, newsize)
 }
 
+// shrinkstackFully shrinks gp's stack as far as shrinkstack will, and
+// returns the number of bytes by which it shrank. The caller must own
+// gp's stack, as for shrinkstack.
+func shrinkstackFully(gp *g) uintptr {
+	oldsize := gp.stack.hi - gp.stack.lo
+	for {
+		size := gp.stack.hi - gp.stack.lo
+		shrinkstack(gp)
+		if gp.stack.hi-gp.stack.lo == size {
+			break
+		}
+	}
+	return oldsize - (gp.stack.hi - gp.stack.lo)
+}
+
+// ShrinkStack shrinks the calling goroutine's stack to fit what the
+// goroutine is using now. Stacks grow as needed but otherwise only
+// shrink when the garbage collector finds most of one unused, and
+// then by half at a time, so a goroutine that briefly needed a deep
+// stack keeps most of that memory for several collections.
+// ShrinkStack is useful in long-lived goroutines after such a burst.
+func ShrinkStack() {
+	systemstack(func() {
+		shrinkstackFully(getg().m.curg)
+	})
+}
+
+// shrinkStacksSema serializes calls to shrinkStacks, which passes its
+// result through shrinkStacksFreed.
+var (
+	shrinkStacksSema  uint32 = 1
+	shrinkStacksFreed uintptr
+)
+
+//go:linkname shrinkStacks runtime/debug.shrinkStacks
+func shrinkStacks() uint64 {
+	semacquire(&shrinkStacksSema)
+	shrinkStacksFreed = 0
+	// Run on the system stack, since suspending the goroutines
+	// could shrink our own stack, and use no locals on the user
+	// stack for the same reason.
+	systemstack(shrinkStacksM)
+	freed := uint64(shrinkStacksFreed)
+	semrelease(&shrinkStacksSema)
+	return freed
+}
+
+// shrinkStacksM shrinks the stacks of all goroutines but the calling
+// one, adding the bytes freed to shrinkStacksFreed. It suspends each
+// goroutine, preempting it if it is running. Goroutines whose stacks
+// can't be shrunk now, such as those in system calls or preempted
+// asynchronously, shrink theirs at their next synchronous safe point.
+//
+//go:systemstack
+func shrinkStacksM() {
+	// Put the user G in _Gwaiting so another goroutine suspending
+	// all goroutines, such as the garbage collector, can't deadlock
+	// with us.
+	userG := getg().m.curg
+	casgstatus(userG, _Grunning, _Gwaiting)
+	userG.waitreason = waitReasonShrinkStacks
+
+	ptr, n := atomicAllG()
+	for i := uintptr(0); i < n; i++ {
+		gp := atomicAllGIndex(ptr, i)
+		if gp == userG {
+			continue
+		}
+		stopped := suspendG(gp)
+		if stopped.dead {
+			continue
+		}
+		if isShrinkStackSafe(gp) {
+			shrinkStacksFreed += shrinkstackFully(gp)
+		} else {
+			gp.preemptShrink = true
+		}
+		resumeG(stopped)
+	}
+
+	casgstatus(userG, _Gwaiting, _Grunning)
+}
+
 // freeStackSpans frees unused stack spans at the end of GC.
 func freeStackSpans() {
 
@@ -473,6 +473,54 @@ func TestStackCache(t *testing.T) {
 	}
 }
 
+func TestStackGrowTrace(t *testing.T) {
+	output := runTestProg(t, "testprog", "StackGrowTrace", "GODEBUG=stackgrowtrace=1")
+	if !strings.HasSuffix(output, "OK\n") {
+		t.Fatalf("want output ending in OK, got:\n%s", output)
+	}
+	re := regexp.MustCompile(`(?m)^stackgrow: goroutine [0-9]+ ([0-9]+) -> ([0-9]+) bytes at main\.stackGrowTraceRecurse\+0x[0-9a-f]+ .*stackgrowtrace\.go:[0-9]+$`)
+	matches := re.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		t.Fatalf("no stack growth of main.stackGrowTraceRecurse in output:\n%s", output)
+	}
+	for _, m := range matches {
+		oldsize, _ := strconv.Atoi(m[1])
+		newsize, _ := strconv.Atoi(m[2])
+		if newsize <= oldsize {
+			t.Errorf("stack grew from %d to %d bytes", oldsize, newsize)
+		}
+	}
+}
+
+//go:noinline
+func shrinkStackRecurse(n int) int {
+	var buf [1024]byte
+	if n == 0 {
+		return int(buf[0])
+	}
+	return shrinkStackRecurse(n-1) + int(buf[n%len(buf)])
+}
+
+func TestShrinkStack(t *testing.T) {
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		shrinkStackRecurse(128)
+		before := StackSize()
+		if before < 128<<10 {
+			t.Errorf("stack is %d bytes after deep recursion, want at least %d", before, 128<<10)
+			return
+		}
+		ShrinkStack()
+		if after := StackSize(); after > before/8 {
+			t.Errorf("ShrinkStack shrank stack from %d to %d bytes, want at most %d", before, after, before/8)
+		}
+		// The goroutine keeps working on its smaller stack.
+		shrinkStackRecurse(128)
+	}()
+	<-done
+}
+
 func TestStackOutput(t *testing.T) {
 	b := make([]byte, 1024)
 	stk := string(b[:Stack(b, false)])
@@ -790,6 +838,23 @@ func TestTracebackAncestors(t *testing.T) {
 	}
 }
 
+func TestGoroutineAncestry(t *testing.T) {
+	const chain = "main.ancestryChain\n"
+	for _, tt := range []struct {
+		depth int
+		want  string
+	}{
+		{0, "0\n"},
+		{2, "2\n" + chain + chain},
+		{50, "4\n" + chain + chain + chain + "main.GoroutineAncestry\n"},
+	} {
+		got := runTestProg(t, "testprog", "GoroutineAncestry", fmt.Sprintf("GODEBUG=tracebackancestors=%d", tt.depth))
+		if got != tt.want {
+			t.Errorf("with tracebackancestors=%d, got:\n%s\nwant:\n%s", tt.depth, got, tt.want)
+		}
+	}
+}
+
 // Test that defer closure is correctly scanned when the stack is scanned.
 func TestDeferLiveness(t *testing.T) {
 	output := runTestProg(t, "testprog", "DeferLiveness", "GODEBUG=clobberfree=1")
@@ -6,7 +6,33 @@
 
 package runtime
 
+import "unsafe"
+
 // sbrk0 returns the current process brk, or 0 if not implemented.
 func sbrk0() uintptr {
 	return 0
 }
+
+func cpuNUMANode() int32 {
+	return -1
+}
+
+func sysNUMABind(v unsafe.Pointer, n uintptr, node int32) {
+}
+
+func sysNoHugePage(v unsafe.Pointer, n uintptr) {
+}
+
+func sysUnusedHugeTLB(v unsafe.Pointer, n uintptr) bool {
+	return false
+}
+
+func sysMapHuge(v unsafe.Pointer, n uintptr, sysStat *sysMemStat) bool {
+	return false
+}
+
+func cgroupCPUInit() {}
+
+func cgroupCPULimit() int32 {
+	return -1
+}
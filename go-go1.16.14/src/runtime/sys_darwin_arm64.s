@@ -513,6 +513,11 @@ TEXT runtime·pthread_kill_trampoline(SB),NOSPLIT,$0
 	BL	libc_pthread_kill(SB)
 	RET
 
+TEXT runtime·pthread_setname_np_trampoline(SB),NOSPLIT,$0
+	MOVD	0(R0), R0	// arg 1 name
+	BL	libc_pthread_setname_np(SB)
+	RET
+
 TEXT runtime·pthread_key_create_trampoline(SB),NOSPLIT,$0
 	MOVD	8(R0), R1	// arg 2 destructor
 	MOVD	0(R0), R0	// arg 1 *key
@@ -49,6 +49,8 @@
 #define SYS_epoll_pwait		281
 #define SYS_epoll_create1	291
 #define SYS_pipe2		293
+#define SYS_getcpu		309
+#define SYS_mbind		237
 
 TEXT runtime·exit(SB),NOSPLIT,$0-4
 	MOVL	code+0(FP), DI
@@ -688,6 +690,27 @@ TEXT runtime·sched_getaffinity(SB),NOSPLIT,$0
 	MOVL	AX, ret+24(FP)
 	RET
 
+TEXT runtime·getcpu(SB),NOSPLIT,$0
+	MOVQ	cpu+0(FP), DI
+	MOVQ	node+8(FP), SI
+	MOVQ	$0, DX
+	MOVL	$SYS_getcpu, AX
+	SYSCALL
+	MOVL	AX, ret+16(FP)
+	RET
+
+TEXT runtime·mbind(SB),NOSPLIT,$0
+	MOVQ	addr+0(FP), DI
+	MOVQ	n+8(FP), SI
+	MOVL	mode+16(FP), DX
+	MOVQ	nodemask+24(FP), R10
+	MOVQ	maxnode+32(FP), R8
+	MOVL	flags+40(FP), R9
+	MOVL	$SYS_mbind, AX
+	SYSCALL
+	MOVL	AX, ret+48(FP)
+	RET
+
 // int32 runtime·epollcreate(int32 size);
 TEXT runtime·epollcreate(SB),NOSPLIT,$0
 	MOVL    size+0(FP), DI
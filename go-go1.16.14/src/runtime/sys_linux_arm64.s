@@ -49,6 +49,8 @@
 #define SYS_socket		198
 #define SYS_connect		203
 #define SYS_brk			214
+#define SYS_getcpu		168
+#define SYS_mbind		235
 
 TEXT runtime·exit(SB),NOSPLIT|NOFRAME,$0-4
 	MOVW	code+0(FP), R0
@@ -663,6 +665,27 @@ TEXT runtime·sched_getaffinity(SB),NOSPLIT|NOFRAME,$0
 	MOVW	R0, ret+24(FP)
 	RET
 
+TEXT runtime·getcpu(SB),NOSPLIT|NOFRAME,$0
+	MOVD	cpu+0(FP), R0
+	MOVD	node+8(FP), R1
+	MOVD	$0, R2
+	MOVD	$SYS_getcpu, R8
+	SVC
+	MOVW	R0, ret+16(FP)
+	RET
+
+TEXT runtime·mbind(SB),NOSPLIT|NOFRAME,$0
+	MOVD	addr+0(FP), R0
+	MOVD	n+8(FP), R1
+	MOVW	mode+16(FP), R2
+	MOVD	nodemask+24(FP), R3
+	MOVD	maxnode+32(FP), R4
+	MOVW	flags+40(FP), R5
+	MOVD	$SYS_mbind, R8
+	SVC
+	MOVW	R0, ret+48(FP)
+	RET
+
 // int32 runtime·epollcreate(int32 size);
 TEXT runtime·epollcreate(SB),NOSPLIT|NOFRAME,$0
 	MOVW	$0, R0
@@ -0,0 +1,118 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	register("ChanHandoff", ChanHandoff)
+}
+
+// ChanHandoff runs request/response exchanges between pairs of
+// goroutines, some of them locked to threads, and checks that every
+// message arrives under GODEBUG=chanhandoff. It then checks that a
+// goroutine woken by a send runs before the sender continues.
+func ChanHandoff() {
+	const (
+		pairs = 8
+		n     = 10000
+	)
+	var wg sync.WaitGroup
+	errs := make(chan string, pairs)
+	for i := 0; i < pairs; i++ {
+		req, resp := make(chan int), make(chan int)
+		locked := i%4 == 0
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if locked {
+				runtime.LockOSThread()
+				defer runtime.UnlockOSThread()
+			}
+			for v := range req {
+				resp <- v + 1
+			}
+			close(resp)
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				req <- j
+				if v := <-resp; v != j+1 {
+					errs <- fmt.Sprintf("got %d, want %d", v, j+1)
+					break
+				}
+			}
+			close(req)
+			for range resp {
+			}
+		}()
+	}
+	// Exchange some messages through select too.
+	a, b := make(chan int), make(chan int)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for v := range a {
+			select {
+			case b <- v:
+			}
+		}
+		close(b)
+	}()
+	for j := 0; j < n; j++ {
+		select {
+		case a <- j:
+		}
+		if v := <-b; v != j {
+			errs <- fmt.Sprintf("got %d, want %d", v, j)
+			break
+		}
+	}
+	close(a)
+	for range b {
+	}
+	wg.Wait()
+	close(errs)
+	failed := false
+	for err := range errs {
+		fmt.Println(err)
+		failed = true
+	}
+	if failed {
+		return
+	}
+
+	// With a single P, a receiver woken by a send has the P handed
+	// to it, so it has handled the value by the time the send
+	// returns. Without the handoff the sender would keep running.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	c := make(chan int32)
+	var got int32
+	go func() {
+		for v := range c {
+			atomic.StoreInt32(&got, v)
+		}
+	}()
+	runtime.Gosched() // let the receiver block
+	late := 0
+	for j := int32(1); j <= 1000; j++ {
+		c <- j
+		if atomic.LoadInt32(&got) != j {
+			late++
+		}
+	}
+	close(c)
+	if late > 10 {
+		fmt.Printf("receiver had not run when the send returned in %d of 1000 sends\n", late)
+		return
+	}
+	fmt.Println("OK")
+}
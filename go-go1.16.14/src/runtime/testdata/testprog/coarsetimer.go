@@ -0,0 +1,25 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func init() {
+	register("CoarseTimerOnly", CoarseTimerOnly)
+}
+
+// CoarseTimerOnly waits for nothing but a coarse timer, which must not
+// look like a deadlock.
+func CoarseTimerOnly() {
+	c := make(chan bool)
+	runtime.AfterFuncCoarse(100*1000*1000, func() {
+		c <- true
+	})
+	<-c
+	fmt.Println("OK")
+}
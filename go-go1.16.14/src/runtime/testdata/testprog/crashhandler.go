@@ -0,0 +1,59 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	register("CrashHandlerThrow", CrashHandlerThrow)
+	register("CrashHandlerPanic", CrashHandlerPanic)
+	register("CrashHandlerSignal", CrashHandlerSignal)
+}
+
+// crashHandler writes "crash handler: <message>" to standard error,
+// followed by "(panic)" or the signal number and whether the stack
+// bounds look sane, without allocating.
+func crashHandler(info *runtime.CrashInfo) {
+	writeStderr("crash handler: ")
+	writeStderr(info.Message)
+	if info.Panic {
+		writeStderr(" (panic)")
+	}
+	if info.Signal == int(syscall.SIGQUIT) {
+		writeStderr(" (SIGQUIT)")
+	}
+	if info.StackLo == 0 || info.StackLo >= info.StackHi {
+		writeStderr(" bad stack bounds")
+	}
+	writeStderr("\n")
+}
+
+func writeStderr(s string) {
+	hdr := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	syscall.RawSyscall(syscall.SYS_WRITE, 2, hdr.Data, uintptr(hdr.Len))
+}
+
+func CrashHandlerThrow() {
+	runtime.SetCrashHandler(crashHandler)
+	select {}
+}
+
+func CrashHandlerPanic() {
+	runtime.SetCrashHandler(crashHandler)
+	panic("boom")
+}
+
+func CrashHandlerSignal() {
+	runtime.SetCrashHandler(crashHandler)
+	syscall.Kill(syscall.Getpid(), syscall.SIGQUIT)
+	select {}
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func init() {
+	register("DeadlockSummary", DeadlockSummary)
+}
+
+// DeadlockSummary deadlocks with three goroutines blocked on one
+// channel, one on a mutex and the main goroutine on another channel.
+func DeadlockSummary() {
+	c := make(chan int)
+	fmt.Printf("chan %p\n", c)
+	for i := 0; i < 3; i++ {
+		go func() {
+			<-c
+		}()
+	}
+	deadlockSummaryLock()
+	<-make(chan int)
+}
+
+func deadlockSummaryLock() {
+	var mu sync.Mutex
+	mu.Lock()
+	go func() {
+		mu.Lock()
+	}()
+}
@@ -0,0 +1,28 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+func init() {
+	register("AutoGOMAXPROCS", AutoGOMAXPROCS)
+}
+
+// AutoGOMAXPROCS prints GOMAXPROCS at startup, then sets it and prints
+// it again after sysmon has had time to check the cgroup CPU limit, so
+// that the caller can check that it kept the value the program set.
+func AutoGOMAXPROCS() {
+	println(runtime.GOMAXPROCS(0))
+	n := runtime.NumCPU() + 1
+	runtime.GOMAXPROCS(n)
+	// Keep a P busy so that sysmon doesn't go to sleep.
+	for start := time.Now(); time.Since(start) < 1500*time.Millisecond; {
+		runtime.Gosched()
+	}
+	println(runtime.GOMAXPROCS(0))
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build amd64 arm64 mips64 mips64le ppc64 ppc64le riscv64 s390x
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"unsafe"
+)
+
+func init() {
+	register("HeapHint", HeapHint)
+}
+
+var heapHintSink []byte
+
+// HeapHint is run with GOHEAPHINT set to an address. It checks that
+// the heap starts there, and that SetHeapHint moves later heap growth.
+func HeapHint() {
+	start, err := strconv.ParseUint(os.Getenv("GOHEAPHINT"), 0, 64)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	heapHintSink = make([]byte, 64)
+	if p := uintptr(unsafe.Pointer(&heapHintSink[0])); p < uintptr(start) || p >= uintptr(start)+1<<30 {
+		fmt.Printf("heap object at %#x, want it near GOHEAPHINT\n", p)
+		return
+	}
+
+	// Too large for the space left in the arenas reserved so far.
+	hint := uintptr(start + start/2)
+	debug.SetHeapHint(hint)
+	heapHintSink = make([]byte, 256<<20)
+	if p := uintptr(unsafe.Pointer(&heapHintSink[0])); p < hint || p >= hint+1<<30 {
+		fmt.Printf("large object at %#x, want it near %#x\n", p, hint)
+		return
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+func init() {
+	register("HeapPoison", HeapPoison)
+	register("HeapPoisonWriteAfterFree", HeapPoisonWriteAfterFree)
+}
+
+type poisonNode struct {
+	next *poisonNode
+	buf  [40]byte
+}
+
+// HeapPoison is run with GODEBUG=heappoison=1. It churns through
+// small objects across several GC cycles and checks that nothing
+// reads back poison, since allocation must still hand out zeroed
+// memory.
+func HeapPoison() {
+	var keep []*poisonNode
+	for i := 0; i < 1<<16; i++ {
+		n := &poisonNode{next: new(poisonNode)}
+		if n.buf != ([40]byte{}) || n.next.next != nil {
+			fmt.Println("allocated object not zeroed")
+			return
+		}
+		s := make([]byte, 24)
+		for _, b := range s {
+			if b != 0 {
+				fmt.Println("allocated slice not zeroed")
+				return
+			}
+		}
+		if i%4 == 0 {
+			keep = append(keep, n)
+		}
+		if i%(1<<12) == 0 {
+			runtime.GC()
+			keep = keep[len(keep)/2:]
+		}
+	}
+	runtime.KeepAlive(keep)
+	fmt.Println("OK")
+}
+
+var poisonSink [][]byte
+
+// HeapPoisonWriteAfterFree is run with GODEBUG=heappoison=1. It
+// writes to an object after the GC freed it and expects a later
+// allocation of that slot to throw.
+func HeapPoisonWriteAfterFree() {
+	const size = 1000
+	// Keep every other object, so the span survives the sweep with
+	// the rest of its slots free.
+	objs := make([][]byte, 64)
+	for i := range objs {
+		objs[i] = make([]byte, size)
+	}
+	freed := uintptr(unsafe.Pointer(&objs[1][0]))
+	for i := 1; i < len(objs); i += 2 {
+		objs[i] = nil
+	}
+	runtime.GC()
+
+	*(*byte)(unsafe.Pointer(freed + 8)) = 1
+
+	for i := 0; i < 1<<12; i++ {
+		poisonSink = append(poisonSink, make([]byte, size))
+	}
+	runtime.KeepAlive(objs)
+	fmt.Println("write to freed object not detected")
+}
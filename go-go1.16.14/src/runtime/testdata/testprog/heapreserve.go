@@ -0,0 +1,43 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func init() {
+	register("HeapReserve", HeapReserve)
+}
+
+// HeapReserve is run built with -X=runtime.heapReserveMB=4. It checks
+// that the heap starts out small and still grows past a whole arena.
+func HeapReserve() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapSys >= 32<<20 {
+		fmt.Printf("HeapSys is %d at start, want less than 32 MB\n", ms.HeapSys)
+		return
+	}
+
+	bufs := make([][]byte, 100)
+	for i := range bufs {
+		bufs[i] = make([]byte, 1<<20)
+		for j := range bufs[i] {
+			bufs[i][j] = byte(i + j)
+		}
+	}
+	runtime.GC()
+	for i := range bufs {
+		for j, b := range bufs[i] {
+			if b != byte(i+j) {
+				fmt.Printf("buffer %d byte %d is %d, want %d\n", i, j, b, byte(i+j))
+				return
+			}
+		}
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+func init() {
+	register("HugePageFlags", HugePageFlags)
+}
+
+var hugePageSink []byte
+
+// HugePageFlags prints the VmFlags the kernel reports for the mapping
+// that holds a fresh heap object.
+func HugePageFlags() {
+	hugePageSink = make([]byte, 1<<20)
+	addr := uint64(uintptr(unsafe.Pointer(&hugePageSink[0])))
+
+	f, err := os.Open("/proc/self/smaps")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+	found := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if r := strings.SplitN(fields[0], "-", 2); len(r) == 2 {
+			start, err1 := strconv.ParseUint(r[0], 16, 64)
+			end, err2 := strconv.ParseUint(r[1], 16, 64)
+			if err1 == nil && err2 == nil {
+				found = start <= addr && addr < end
+				continue
+			}
+		}
+		if found && fields[0] == "VmFlags:" {
+			fmt.Println(strings.Join(fields[1:], " "))
+			return
+		}
+	}
+	fmt.Println("no mapping found for", addr)
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+func init() {
+	register("InitTrace", InitTrace)
+
+	// Make the init of package main slow enough to go over
+	// a GODEBUG=initbudget of a few milliseconds.
+	if os.Getenv("TESTPROG_SLOW_INIT") != "" {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func InitTrace() {
+	recs := runtime.ReadInitTrace()
+	if len(recs) == 0 {
+		fmt.Println("no init records")
+		return
+	}
+	last := recs[len(recs)-1]
+	if last.Package != "main" {
+		fmt.Printf("last init record is for %q, want main\n", last.Package)
+		return
+	}
+	for _, r := range recs {
+		if r.Start < 0 || r.Clock < 0 {
+			fmt.Printf("bad init record: %+v\n", r)
+			return
+		}
+	}
+	// ReadInitTrace must return a copy.
+	recs[0].Package = ""
+	if runtime.ReadInitTrace()[0].Package == "" {
+		fmt.Println("ReadInitTrace returned the runtime's table")
+		return
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+func init() {
+	register("MemoryLimit", MemoryLimit)
+}
+
+var memLimitSink []byte
+
+// MemoryLimit is run with GOGC=off. It allocates several times the
+// memory limit in garbage and checks that the runtime keeps its
+// memory near the limit by collecting anyway.
+func MemoryLimit() {
+	const limit = 64 << 20
+	debug.SetMemoryLimit(limit)
+
+	// Keep some memory live, so there's something for the limit
+	// to count besides garbage.
+	live := make([][]byte, 16)
+	for i := range live {
+		live[i] = make([]byte, 1<<20)
+	}
+	var ms runtime.MemStats
+	var peak uint64
+	for i := 0; i < 4096; i++ {
+		memLimitSink = make([]byte, 256<<10)
+		if i%64 == 0 {
+			runtime.ReadMemStats(&ms)
+			if mapped := ms.Sys - ms.HeapReleased; mapped > peak {
+				peak = mapped
+			}
+		}
+	}
+	runtime.KeepAlive(live)
+	if ms.NumGC == 0 {
+		fmt.Println("no GCs with GOGC=off and a memory limit")
+		return
+	}
+	// Allow for the headroom and the memory allocated while
+	// the collector runs.
+	if max := uint64(limit) * 5 / 4; peak > max {
+		fmt.Printf("mapped memory peaked at %d with a limit of %d\n", peak, limit)
+		return
+	}
+	fmt.Println("OK")
+}
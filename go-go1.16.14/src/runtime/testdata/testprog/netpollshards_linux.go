@@ -0,0 +1,73 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+func init() {
+	register("NetpollShards", NetpollShards)
+}
+
+// NetpollShards is run with GODEBUG=netpollshards=4. It prints the
+// number of epoll instances the runtime created, and checks that
+// goroutines blocked on descriptors in every shard are woken.
+func NetpollShards() {
+	runtime.GOMAXPROCS(4)
+
+	const N = 32
+	var rs, ws []*os.File
+	for i := 0; i < N; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		rs = append(rs, r)
+		ws = append(ws, w)
+	}
+
+	// Sleeping goroutines leave threads blocked in the network
+	// poller while the readers wait.
+	var wg sync.WaitGroup
+	for _, r := range rs {
+		wg.Add(1)
+		go func(r *os.File) {
+			defer wg.Done()
+			var b [1]byte
+			if _, err := r.Read(b[:]); err != nil {
+				fmt.Println(err)
+			}
+		}(r)
+	}
+	time.Sleep(10 * time.Millisecond)
+	for _, w := range ws {
+		time.Sleep(time.Millisecond)
+		w.Write([]byte{0})
+	}
+	wg.Wait()
+
+	fmt.Println(epollInstances(), "epoll instances")
+	fmt.Println("OK")
+}
+
+func epollInstances() int {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	n := 0
+	for _, fd := range fds {
+		if link, err := os.Readlink("/proc/self/fd/" + fd.Name()); err == nil && link == "anon_inode:[eventpoll]" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+func init() {
+	register("SchedStall", SchedStall)
+	register("SchedStallObserver", SchedStallObserver)
+}
+
+var (
+	schedStallSink     int
+	schedStallReported uint32
+	schedStallPid      int32
+	schedStallRunnable int32
+	schedStallNanos    int64
+)
+
+// schedStallSpin keeps the only P busy, with a goroutine waiting to
+// run, in a loop that can't be preempted with asyncpreemptoff=1. It
+// stops after n iterations or once a stall has been reported.
+func schedStallSpin(n int) {
+	runtime.GOMAXPROCS(1)
+	done := make(chan bool)
+	go func() {
+		done <- true
+	}()
+	for i := 0; i < n && atomic.LoadUint32(&schedStallReported) == 0; i++ {
+		schedStallSink += i
+	}
+	<-done
+}
+
+func SchedStall() {
+	schedStallSpin(1 << 28)
+	fmt.Println("OK")
+}
+
+func SchedStallObserver() {
+	runtime.SetSchedStallObserver(func(pid int32, runnable int32, nanos int64) {
+		schedStallPid = pid
+		schedStallRunnable = runnable
+		schedStallNanos = nanos
+		atomic.StoreUint32(&schedStallReported, 1)
+	})
+	runtime.SetSchedStallThreshold(20 * 1000 * 1000)
+	schedStallSpin(1<<31 - 1)
+	if atomic.LoadUint32(&schedStallReported) == 0 {
+		fmt.Println("stall not reported")
+		return
+	}
+	if schedStallPid != 0 || schedStallRunnable < 1 || schedStallNanos < 20*1000*1000 {
+		fmt.Printf("stall reported for P %d with %d runnable after %dns\n", schedStallPid, schedStallRunnable, schedStallNanos)
+		return
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,26 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	register("SchedTrace", SchedTrace)
+}
+
+// SchedTrace is run with GODEBUG=schedtrace set. It keeps a goroutine
+// blocked while the scheduler prints a few reports.
+func SchedTrace() {
+	c := make(chan bool)
+	go func() {
+		<-c
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(c)
+	fmt.Println("OK")
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func init() {
+	register("SignalPreHandler", SignalPreHandler)
+}
+
+func SignalPreHandler() {
+	// Map a page in on its first access, from a SIGSEGV handler.
+	pagesize := syscall.Getpagesize()
+	mem, err := syscall.Mmap(-1, 0, pagesize, syscall.PROT_NONE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		fmt.Println("mmap:", err)
+		return
+	}
+	base := uintptr(unsafe.Pointer(&mem[0]))
+	var faults uint32
+	runtime.SetSignalPreHandler(int(syscall.SIGSEGV), func(info *runtime.SignalInfo) bool {
+		if info.Addr < base || info.Addr >= base+uintptr(pagesize) {
+			return false
+		}
+		atomic.AddUint32(&faults, 1)
+		_, _, e := syscall.RawSyscall(syscall.SYS_MPROTECT, base, uintptr(pagesize), syscall.PROT_READ|syscall.PROT_WRITE)
+		return e == 0
+	})
+	mem[10] = 42
+	if mem[10] != 42 || atomic.LoadUint32(&faults) != 1 {
+		fmt.Printf("got %d after %d faults, want 42 after 1\n", mem[10], faults)
+		return
+	}
+
+	// Without the handler, the fault is the runtime's again.
+	runtime.SetSignalPreHandler(int(syscall.SIGSEGV), nil)
+	if err := syscall.Mprotect(mem, syscall.PROT_NONE); err != nil {
+		fmt.Println("mprotect:", err)
+		return
+	}
+	if !faultPanics(mem) {
+		fmt.Println("no panic on fault without the handler")
+		return
+	}
+
+	// A handled signal does not reach os/signal.
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	var handle uint32
+	var usr1 uint32
+	runtime.SetSignalPreHandler(int(syscall.SIGUSR1), func(info *runtime.SignalInfo) bool {
+		atomic.AddUint32(&usr1, 1)
+		return atomic.LoadUint32(&handle) != 0
+	})
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	<-c
+	atomic.StoreUint32(&handle, 1)
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	for atomic.LoadUint32(&usr1) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-c:
+		fmt.Println("handled SIGUSR1 delivered to os/signal")
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+	fmt.Println("OK")
+}
+
+func faultPanics(mem []byte) (panicked bool) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		panicked = recover() != nil
+	}()
+	mem[10] = 43
+	return false
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"unsafe"
+)
+
+func init() {
+	register("SpanTrace", SpanTrace)
+}
+
+type spanTraceObj struct {
+	p *int
+	x [5]int
+}
+
+var spanTraceSink []*spanTraceObj
+
+//go:noinline
+func spanTraceAlloc() *spanTraceObj {
+	return new(spanTraceObj)
+}
+
+// SpanTrace is run with GODEBUG=spantrace=4. It allocates from two
+// goroutines into a fresh size class span and checks the allocations
+// the span recorded.
+func SpanTrace() {
+	// Use up any partly-filled span, so the objects below share a
+	// span that only they have allocated into.
+	for i := 0; i < 1024; i++ {
+		spanTraceSink = append(spanTraceSink, spanTraceAlloc())
+	}
+	first := spanTraceAlloc()
+	done := make(chan *spanTraceObj)
+	go func() {
+		done <- spanTraceAlloc()
+	}()
+	second := <-done
+	spanTraceSink = append(spanTraceSink, first, second)
+
+	allocs := debug.SpanAllocations(uintptr(unsafe.Pointer(second)))
+	if len(allocs) == 0 || len(allocs) > 4 {
+		fmt.Printf("got %d allocations, want between 1 and 4\n", len(allocs))
+		return
+	}
+	goids := make(map[int64]bool)
+	for _, a := range allocs {
+		fn := runtime.FuncForPC(a.PC - 1)
+		if fn == nil || !strings.HasSuffix(fn.Name(), "spanTraceAlloc") {
+			fmt.Printf("allocation at %#x, want in spanTraceAlloc\n", a.PC)
+			return
+		}
+		goids[a.Goroutine] = true
+	}
+	if len(goids) != 2 {
+		fmt.Printf("allocations by %d goroutines, want 2\n", len(goids))
+		return
+	}
+	var x int
+	if allocs := debug.SpanAllocations(uintptr(unsafe.Pointer(&x))); allocs != nil {
+		fmt.Printf("got %d allocations for a stack address\n", len(allocs))
+		return
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "fmt"
+
+func init() {
+	register("StackGrowTrace", StackGrowTrace)
+}
+
+//go:noinline
+func stackGrowTraceRecurse(n int) int {
+	var buf [256]byte
+	if n == 0 {
+		return int(buf[0])
+	}
+	return stackGrowTraceRecurse(n-1) + int(buf[n%len(buf)])
+}
+
+// StackGrowTrace is run with GODEBUG=stackgrowtrace=1. It grows a new
+// goroutine's stack to at least 64 KiB.
+func StackGrowTrace() {
+	done := make(chan int)
+	go func() {
+		done <- stackGrowTraceRecurse(256)
+	}()
+	<-done
+	fmt.Println("OK")
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	register("TimerWheel", TimerWheel)
+}
+
+// TimerWheel is run with GODEBUG=timerwheel=1. It starts timers far
+// enough out to be parked in the timing wheel, including some that
+// are stopped or reset while they are parked, and checks that they
+// fire when they should.
+func TimerWheel() {
+	const N = 100
+	start := time.Now()
+	var wg sync.WaitGroup
+	var early int32
+	wg.Add(N)
+	for i := 0; i < N; i++ {
+		d := 100*time.Millisecond + time.Duration(i)*3*time.Millisecond
+		time.AfterFunc(d, func() {
+			if time.Since(start) < d {
+				atomic.AddInt32(&early, 1)
+			}
+			wg.Done()
+		})
+	}
+
+	var stoppedFired int32
+	stopped := time.AfterFunc(150*time.Millisecond, func() {
+		atomic.StoreInt32(&stoppedFired, 1)
+	})
+	earlier := time.NewTimer(time.Hour)
+	beyond := time.NewTimer(30 * 24 * time.Hour)
+	later := time.NewTimer(150 * time.Millisecond)
+
+	stopped.Stop()
+	earlier.Reset(200 * time.Millisecond)
+	beyond.Reset(250 * time.Millisecond)
+	later.Reset(400 * time.Millisecond)
+
+	wg.Wait()
+	if n := atomic.LoadInt32(&early); n > 0 {
+		fmt.Println(n, "timers fired early")
+		return
+	}
+	timeout := time.After(time.Minute)
+	for _, c := range []struct {
+		name string
+		t    *time.Timer
+		d    time.Duration
+	}{
+		{"moved earlier", earlier, 200 * time.Millisecond},
+		{"moved earlier from beyond the wheel", beyond, 250 * time.Millisecond},
+		{"moved later", later, 400 * time.Millisecond},
+	} {
+		select {
+		case <-c.t.C:
+			if since := time.Since(start); since < c.d {
+				fmt.Println("timer", c.name, "fired after", since, "want", c.d)
+				return
+			}
+		case <-timeout:
+			fmt.Println("timer", c.name, "did not fire")
+			return
+		}
+	}
+	if atomic.LoadInt32(&stoppedFired) != 0 {
+		fmt.Println("stopped timer fired")
+		return
+	}
+	fmt.Println("OK")
+}
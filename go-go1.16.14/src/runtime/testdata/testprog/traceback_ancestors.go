@@ -13,6 +13,7 @@ import (
 
 func init() {
 	register("TracebackAncestors", TracebackAncestors)
+	register("GoroutineAncestry", GoroutineAncestry)
 }
 
 const numGoroutines = 3
@@ -97,3 +98,38 @@ func goroutineID() string {
 	n := bytes.IndexByte(buf, ' ')
 	return string(buf[:n])
 }
+
+// GoroutineAncestry starts a chain of goroutines and prints the
+// number of ancestors that the last one in the chain is told about,
+// followed by the function each ancestor was running when it started
+// its child.
+func GoroutineAncestry() {
+	c := make(chan string)
+	go ancestryChain(c, numGoroutines)
+	fmt.Print(<-c)
+}
+
+func ancestryChain(c chan string, depth int) {
+	if depth > 0 {
+		go ancestryChain(c, depth-1)
+		return
+	}
+	var out strings.Builder
+	buf := make([]runtime.AncestorRecord, 2*numGoroutines)
+	n := runtime.GoroutineAncestry(buf)
+	fmt.Fprintln(&out, n)
+	for i, r := range buf[:n] {
+		if i > 0 && r.Goid >= buf[i-1].Goid {
+			fmt.Fprintf(&out, "ancestor %d has goid %d, want less than %d\n", i, r.Goid, buf[i-1].Goid)
+		}
+		frames := runtime.CallersFrames(r.PCs)
+		for {
+			f, more := frames.Next()
+			if !strings.HasPrefix(f.Function, "runtime.") || !more {
+				fmt.Fprintln(&out, f.Function)
+				break
+			}
+		}
+	}
+	c <- out.String()
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	register("WakepDelay", WakepDelay)
+}
+
+// WakepDelay wakes goroutines in bursts and checks that they all run
+// while the goroutine that woke them keeps its P busy, relying on
+// sysmon to start another P under GODEBUG=wakepdelay. It must run
+// with asyncpreemptoff=1, so that the busy goroutine keeps its P.
+func WakepDelay() {
+	runtime.GOMAXPROCS(4)
+	const n = 100
+	for round := 0; round < 10; round++ {
+		var started sync.WaitGroup
+		var finished int32
+		start := make(chan bool)
+		started.Add(n)
+		for i := 0; i < n; i++ {
+			go func() {
+				started.Done()
+				<-start
+				atomic.AddInt32(&finished, 1)
+			}()
+		}
+		started.Wait()
+		time.Sleep(time.Millisecond)
+		close(start)
+		// Keep this P busy, in a loop that can't be preempted,
+		// until the woken goroutines have run on other Ps.
+		for i := 0; i < 1<<31-1 && atomic.LoadInt32(&finished) < n; i++ {
+		}
+		if f := atomic.LoadInt32(&finished); f != n {
+			fmt.Printf("%d of %d woken goroutines ran while the waking goroutine kept its P busy\n", f, n)
+			return
+		}
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package main
+
+// Test that syscall.AllThreadsSyscall reaches threads created by C
+// that have an extra M: one running C code after a call into Go, and
+// one blocked in a call into Go. Also test that it gives up, without
+// invoking the syscall on any thread, if such a thread blocks signals,
+// rather than hang.
+
+/*
+#include <pthread.h>
+#include <signal.h>
+#include <sys/prctl.h>
+#include <unistd.h>
+
+extern void allThreadsBind(void);
+extern void allThreadsBlock(void);
+
+static pthread_t allThreadsInC, allThreadsInGo;
+static int allThreadsReady, allThreadsProceed;
+static int allThreadsKeepCaps = -1;
+
+static void* allThreadsInCStart(void* arg __attribute__ ((unused))) {
+	allThreadsBind();
+	__atomic_store_n(&allThreadsReady, 1, __ATOMIC_SEQ_CST);
+	while (!__atomic_load_n(&allThreadsProceed, __ATOMIC_SEQ_CST)) {
+		usleep(1000);
+	}
+	allThreadsKeepCaps = prctl(PR_GET_KEEPCAPS, 0, 0, 0, 0);
+	return NULL;
+}
+
+static void* allThreadsInGoStart(void* arg __attribute__ ((unused))) {
+	allThreadsBlock();
+	return NULL;
+}
+
+static void startAllThreads(void) {
+	pthread_create(&allThreadsInC, NULL, allThreadsInCStart, NULL);
+	while (!__atomic_load_n(&allThreadsReady, __ATOMIC_SEQ_CST)) {
+		usleep(1000);
+	}
+	pthread_create(&allThreadsInGo, NULL, allThreadsInGoStart, NULL);
+}
+
+static int finishAllThreads(void) {
+	__atomic_store_n(&allThreadsProceed, 1, __ATOMIC_SEQ_CST);
+	pthread_join(allThreadsInC, NULL);
+	pthread_join(allThreadsInGo, NULL);
+	return allThreadsKeepCaps;
+}
+
+static void* allThreadsSigBlockedStart(void* arg __attribute__ ((unused))) {
+	sigset_t all;
+
+	allThreadsBind();
+	sigfillset(&all);
+	pthread_sigmask(SIG_BLOCK, &all, NULL);
+	__atomic_store_n(&allThreadsReady, 1, __ATOMIC_SEQ_CST);
+	while (!__atomic_load_n(&allThreadsProceed, __ATOMIC_SEQ_CST)) {
+		usleep(1000);
+	}
+	allThreadsKeepCaps = prctl(PR_GET_KEEPCAPS, 0, 0, 0, 0);
+	return NULL;
+}
+
+static void startAllThreadsSigBlocked(void) {
+	pthread_create(&allThreadsInC, NULL, allThreadsSigBlockedStart, NULL);
+	while (!__atomic_load_n(&allThreadsReady, __ATOMIC_SEQ_CST)) {
+		usleep(1000);
+	}
+}
+
+static int finishAllThreadsSigBlocked(void) {
+	__atomic_store_n(&allThreadsProceed, 1, __ATOMIC_SEQ_CST);
+	pthread_join(allThreadsInC, NULL);
+	return allThreadsKeepCaps;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func init() {
+	register("AllThreadsSyscall", AllThreadsSyscall)
+	register("AllThreadsSyscallSigBlocked", AllThreadsSyscallSigBlocked)
+}
+
+// reference uapi/linux/prctl.h
+const (
+	prGetKeepCaps = 7
+	prSetKeepCaps = 8
+)
+
+var (
+	allThreadsBlocked  = make(chan bool)
+	allThreadsRelease  = make(chan bool)
+	allThreadsKeepCaps = make(chan uintptr, 1)
+)
+
+//export allThreadsBind
+func allThreadsBind() {
+}
+
+//export allThreadsBlock
+func allThreadsBlock() {
+	allThreadsBlocked <- true
+	<-allThreadsRelease
+	v, _, _ := syscall.RawSyscall(syscall.SYS_PRCTL, prGetKeepCaps, 0, 0)
+	allThreadsKeepCaps <- v
+}
+
+func AllThreadsSyscall() {
+	C.startAllThreads()
+	<-allThreadsBlocked
+	if _, _, e := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetKeepCaps, 1, 0); e != 0 {
+		fmt.Printf("AllThreadsSyscall: %v\n", e)
+		return
+	}
+	close(allThreadsRelease)
+	inGo := <-allThreadsKeepCaps
+	inC := C.finishAllThreads()
+	if inC != 1 || inGo != 1 {
+		fmt.Printf("PR_GET_KEEPCAPS: got %d in C and %d in Go, want 1\n", inC, inGo)
+		return
+	}
+	fmt.Println("OK")
+}
+
+func AllThreadsSyscallSigBlocked() {
+	C.startAllThreadsSigBlocked()
+	if _, _, e := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetKeepCaps, 1, 0); e != syscall.ETIMEDOUT {
+		fmt.Printf("AllThreadsSyscall: got %v, want %v\n", e, syscall.ETIMEDOUT)
+		return
+	}
+	v, _, _ := syscall.RawSyscall(syscall.SYS_PRCTL, prGetKeepCaps, 0, 0)
+	if inC := C.finishAllThreadsSigBlocked(); inC != 0 || v != 0 {
+		fmt.Printf("PR_GET_KEEPCAPS: got %d in C and %d in Go, want 0 in both\n", inC, v)
+		return
+	}
+	fmt.Println("OK")
+}
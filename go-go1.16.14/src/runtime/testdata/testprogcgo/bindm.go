@@ -0,0 +1,98 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !plan9,!windows
+
+// Test that a C thread keeps the extra M it acquired for its first
+// callback until it exits.
+
+package main
+
+/*
+#include <stddef.h>
+#include <string.h>
+#include <pthread.h>
+
+extern void GoBindMCallback();
+
+// Call back into Go from deeper in the stack each time, so that the
+// callbacks run on different parts of it.
+static void bindMCallbackAt(int depth) {
+	char buf[16*1024];
+
+	memset(buf, depth, sizeof buf);
+	if (depth > 0) {
+		bindMCallbackAt(depth - 1);
+	} else {
+		GoBindMCallback();
+	}
+	__asm__ __volatile__("" : : "r"(buf) : "memory");
+}
+
+static void* bindMThread(void* arg __attribute__ ((unused))) {
+	int i;
+
+	for (i = 0; i < 10; i++) {
+		bindMCallbackAt(i % 5);
+	}
+	return NULL;
+}
+
+static void BindMCallbacks(int n) {
+	int i;
+	pthread_t tid;
+
+	for (i = 0; i < n; i++) {
+		pthread_create(&tid, NULL, bindMThread, NULL);
+		pthread_join(tid, NULL);
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+func init() {
+	register("BindM", BindM)
+}
+
+var bindMCallbacks int32
+
+//export GoBindMCallback
+func GoBindMCallback() {
+	atomic.AddInt32(&bindMCallbacks, 1)
+	// Run on the system stack of the M, which is the C stack.
+	runtime.GC()
+}
+
+func BindM() {
+	var acquired, released int32
+	runtime.SetExtraMObserver(func(acquire bool, extraCount int32) {
+		if acquire {
+			atomic.AddInt32(&acquired, 1)
+		} else {
+			atomic.AddInt32(&released, 1)
+		}
+	})
+	const n = 3
+	C.BindMCallbacks(n)
+	runtime.SetExtraMObserver(nil)
+
+	if c := atomic.LoadInt32(&bindMCallbacks); c != 10*n {
+		fmt.Printf("%d callbacks, want %d\n", c, 10*n)
+		return
+	}
+	// Each thread acquires an M for its first callback and releases
+	// it when it exits.
+	a, r := atomic.LoadInt32(&acquired), atomic.LoadInt32(&released)
+	if a != n || r != n {
+		fmt.Printf("observer reported %d acquires and %d releases, want %d of each\n", a, r, n)
+		return
+	}
+	fmt.Println("OK")
+}
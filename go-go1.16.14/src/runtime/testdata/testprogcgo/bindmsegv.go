@@ -0,0 +1,92 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !plan9,!windows
+
+// Test that a SIGSEGV raised by C code, on a C thread that keeps the
+// extra M it acquired for a callback, is forwarded to the C handler.
+
+package main
+
+/*
+#include <pthread.h>
+#include <setjmp.h>
+#include <signal.h>
+#include <stdlib.h>
+#include <string.h>
+
+extern void GoBindMSegvCallback();
+
+static sigjmp_buf bindMSegvJmp;
+static volatile sig_atomic_t bindMSegvArmed;
+static volatile int bindMSegvCaught;
+
+static void bindMSegvHandler(int sig) {
+	if (!bindMSegvArmed) {
+		signal(sig, SIG_DFL);
+		return;
+	}
+	bindMSegvArmed = 0;
+	bindMSegvCaught = 1;
+	siglongjmp(bindMSegvJmp, 1);
+}
+
+// The handler has to be installed before the Go runtime installs its
+// own for the runtime to forward signals to it.
+static void __attribute__ ((constructor)) bindMSegvSetup(void) {
+	struct sigaction sa;
+
+	if (getenv("BINDM_SEGV_HANDLER") == NULL)
+		return;
+	memset(&sa, 0, sizeof sa);
+	sa.sa_handler = bindMSegvHandler;
+	sigemptyset(&sa.sa_mask);
+	sigaction(SIGSEGV, &sa, NULL);
+}
+
+static void* bindMSegvThread(void* arg __attribute__ ((unused))) {
+	volatile char* volatile p = NULL;
+
+	GoBindMSegvCallback();
+	if (sigsetjmp(bindMSegvJmp, 1) == 0) {
+		bindMSegvArmed = 1;
+		*p = 0;
+	}
+	return NULL;
+}
+
+static int BindMSegv(void) {
+	pthread_t tid;
+
+	pthread_create(&tid, NULL, bindMSegvThread, NULL);
+	pthread_join(tid, NULL);
+	return bindMSegvCaught;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+)
+
+func init() {
+	register("BindMSegv", BindMSegv)
+}
+
+//export GoBindMSegvCallback
+func GoBindMSegvCallback() {
+}
+
+func BindMSegv() {
+	if os.Getenv("BINDM_SEGV_HANDLER") == "" {
+		fmt.Println("BINDM_SEGV_HANDLER not set")
+		return
+	}
+	if C.BindMSegv() == 0 {
+		fmt.Println("C handler did not run")
+		return
+	}
+	fmt.Println("OK")
+}
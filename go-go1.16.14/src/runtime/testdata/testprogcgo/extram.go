@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !plan9,!windows
+
+// Test that callbacks from C threads report the extra M's they
+// acquire and release to the extra M observer.
+
+package main
+
+/*
+#include <stddef.h>
+#include <pthread.h>
+
+extern void GoExtraMCallback();
+
+static void* extraMThread(void* arg __attribute__ ((unused))) {
+	GoExtraMCallback();
+	return NULL;
+}
+
+static void ExtraMCallbacks(int n) {
+	int i;
+	pthread_t tid;
+
+	for (i = 0; i < n; i++) {
+		pthread_create(&tid, NULL, extraMThread, NULL);
+		pthread_join(tid, NULL);
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+func init() {
+	register("ExtraMObserver", ExtraMObserver)
+}
+
+var extraMCallbacks int32
+
+//export GoExtraMCallback
+func GoExtraMCallback() {
+	atomic.AddInt32(&extraMCallbacks, 1)
+}
+
+func ExtraMObserver() {
+	var acquired, released, negative int32
+	runtime.SetExtraMObserver(func(acquire bool, extraCount int32) {
+		if acquire {
+			atomic.AddInt32(&acquired, 1)
+		} else {
+			atomic.AddInt32(&released, 1)
+		}
+		if extraCount < 0 {
+			atomic.AddInt32(&negative, 1)
+		}
+	})
+	const n = 10
+	C.ExtraMCallbacks(n)
+	runtime.SetExtraMObserver(nil)
+
+	a, r := atomic.LoadInt32(&acquired), atomic.LoadInt32(&released)
+	if c := atomic.LoadInt32(&extraMCallbacks); c != n {
+		fmt.Printf("%d callbacks, want %d\n", c, n)
+		return
+	}
+	if a < n || a != r {
+		fmt.Printf("observer reported %d acquires and %d releases, want %d of each\n", a, r, n)
+		return
+	}
+	if atomic.LoadInt32(&negative) != 0 {
+		fmt.Println("observer reported a negative extra M count")
+		return
+	}
+	fmt.Println("OK")
+}
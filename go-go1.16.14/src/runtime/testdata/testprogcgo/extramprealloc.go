@@ -0,0 +1,88 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !plan9,!windows
+
+// Test that callbacks from C threads running at the same time find
+// the extra M's preallocated for them.
+
+package main
+
+/*
+#include <stddef.h>
+#include <pthread.h>
+
+extern void GoExtraMWait();
+
+static void* extraMWaitThread(void* arg __attribute__ ((unused))) {
+	GoExtraMWait();
+	return NULL;
+}
+
+static void ExtraMConcurrentCallbacks(int n) {
+	int i;
+	pthread_t tids[64];
+
+	for (i = 0; i < n; i++) {
+		pthread_create(&tids[i], NULL, extraMWaitThread, NULL);
+	}
+	for (i = 0; i < n; i++) {
+		pthread_join(tids[i], NULL);
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+)
+
+func init() {
+	register("PreallocateExtraMs", PreallocateExtraMs)
+	register("PreallocateExtraMsGODEBUG", PreallocateExtraMsGODEBUG)
+}
+
+const extraMConcurrent = 8
+
+var extraMWaiting sync.WaitGroup
+
+//export GoExtraMWait
+func GoExtraMWait() {
+	// Keep each callback's M until all of them have one.
+	extraMWaiting.Done()
+	extraMWaiting.Wait()
+}
+
+func PreallocateExtraMs() {
+	runtime.PreallocateExtraMs(extraMConcurrent + 1)
+	extraMConcurrentCallbacks()
+}
+
+// PreallocateExtraMsGODEBUG is run with GODEBUG=extram=9.
+func PreallocateExtraMsGODEBUG() {
+	extraMConcurrentCallbacks()
+}
+
+func extraMConcurrentCallbacks() {
+	samples := []metrics.Sample{
+		{Name: "/sched/threads/extra-hits:calls"},
+		{Name: "/sched/threads/extra-misses:calls"},
+	}
+	metrics.Read(samples)
+	hits0, misses0 := samples[0].Value.Uint64(), samples[1].Value.Uint64()
+
+	extraMWaiting.Add(extraMConcurrent)
+	C.ExtraMConcurrentCallbacks(extraMConcurrent)
+
+	metrics.Read(samples)
+	hits, misses := samples[0].Value.Uint64()-hits0, samples[1].Value.Uint64()-misses0
+	if hits != extraMConcurrent || misses != 0 {
+		fmt.Printf("%d extra M hits and %d misses, want %d and 0\n", hits, misses, extraMConcurrent)
+		return
+	}
+	fmt.Println("OK")
+}
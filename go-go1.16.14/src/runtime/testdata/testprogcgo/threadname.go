@@ -0,0 +1,61 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+// Test that runtime.SetThreadName leaves C threads that call into Go
+// with their own names.
+
+package main
+
+/*
+#include <stddef.h>
+#include <string.h>
+#include <pthread.h>
+#include <sys/prctl.h>
+
+extern void GoThreadNameCallback();
+
+static char threadNameAfter[17];
+
+static void* threadNameThread(void* arg __attribute__ ((unused))) {
+	prctl(PR_SET_NAME, "cthread", 0, 0, 0);
+	GoThreadNameCallback();
+	prctl(PR_GET_NAME, threadNameAfter, 0, 0, 0);
+	return NULL;
+}
+
+static const char* ThreadNameCallback(void) {
+	pthread_t tid;
+
+	pthread_create(&tid, NULL, threadNameThread, NULL);
+	pthread_join(tid, NULL);
+	return threadNameAfter;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func init() {
+	register("ThreadNameExtraM", ThreadNameExtraM)
+}
+
+//export GoThreadNameCallback
+func GoThreadNameCallback() {
+	// Rename the threads while this one runs Go code on an extra M.
+	runtime.SetThreadName("gotest-")
+}
+
+func ThreadNameExtraM() {
+	runtime.SetThreadName("gotest-")
+	if name := C.GoString(C.ThreadNameCallback()); name != "cthread" {
+		fmt.Printf("C thread named %q after calling into Go, want %q\n", name, "cthread")
+		return
+	}
+	fmt.Println("OK")
+}
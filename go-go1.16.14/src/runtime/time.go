@@ -279,7 +279,8 @@ func addtimer(t *timer) {
 	releasem(mp)
 }
 
-// doaddtimer adds t to the current P's heap.
+// doaddtimer adds t to the current P's heap, or parks it in the P's
+// timing wheel.
 // The caller must have locked the timers for pp.
 func doaddtimer(pp *p, t *timer) {
 	// Timers rely on the network poller, so make sure the poller
@@ -292,13 +293,22 @@ func doaddtimer(pp *p, t *timer) {
 		throw("doaddtimer: P already set in timer")
 	}
 	t.pp.set(pp)
+	atomic.Xadd(&pp.numTimers, 1)
+	if debug.timerwheel > 0 && parktimer(pp, t) {
+		return
+	}
+	pushtimer(pp, t)
+}
+
+// pushtimer pushes t, which has been added to pp, on pp's heap.
+// The caller must have locked the timers for pp.
+func pushtimer(pp *p, t *timer) {
 	i := len(pp.timers)
 	pp.timers = append(pp.timers, t)
 	siftupTimer(pp.timers, i)
 	if t == pp.timers[0] {
 		atomic.Store64(&pp.timer0When, uint64(t.when))
 	}
-	atomic.Xadd(&pp.numTimers, 1)
 }
 
 // deltimer deletes the timer t. It may be on some other P, so we can't
@@ -317,11 +327,14 @@ func deltimer(t *timer) bool {
 				// as cleantimers in another goroutine
 				// can clear t.pp of a timerDeleted timer.
 				tpp := t.pp.ptr()
+				// Count the timer before marking it deleted,
+				// since whoever removes it, such as moveTimers
+				// for balanceTimers, uncounts it right away.
+				atomic.Xadd(&tpp.deletedTimers, 1)
 				if !atomic.Cas(&t.status, timerModifying, timerDeleted) {
 					badTimer()
 				}
 				releasem(mp)
-				atomic.Xadd(&tpp.deletedTimers, 1)
 				// Timer was not yet run.
 				return true
 			} else {
@@ -335,11 +348,11 @@ func deltimer(t *timer) bool {
 				// Must fetch t.pp before setting status
 				// to timerDeleted.
 				tpp := t.pp.ptr()
+				atomic.Xadd(&tpp.deletedTimers, 1)
 				if !atomic.Cas(&t.status, timerModifying, timerDeleted) {
 					badTimer()
 				}
 				releasem(mp)
-				atomic.Xadd(&tpp.deletedTimers, 1)
 				// Timer was not yet run.
 				return true
 			} else {
@@ -594,10 +607,11 @@ func cleantimers(pp *p) {
 }
 
 // moveTimers moves a slice of timers to pp. The slice has been taken
-// from a different P.
-// This is currently called when the world is stopped, but the caller
-// is expected to have locked the timers for pp.
-func moveTimers(pp *p, timers []*timer) {
+// from a different P. It returns the number of deleted timers that
+// were dropped rather than moved.
+// This is called when the world is stopped, or by balanceTimers,
+// but the caller is expected to have locked the timers for pp.
+func moveTimers(pp *p, timers []*timer) (removed int32) {
 	for _, t := range timers {
 	loop:
 		for {
@@ -628,6 +642,7 @@ func moveTimers(pp *p, timers []*timer) {
 					continue
 				}
 				t.pp = 0
+				removed++
 				// We no longer need this timer in the heap.
 				break loop
 			case timerModifying:
@@ -645,11 +660,185 @@ func moveTimers(pp *p, timers []*timer) {
 			}
 		}
 	}
+	return removed
+}
+
+// balanceMoveTimers is like moveTimers, for balanceTimers. It also
+// returns the earliest time, or 0 if none, that any of timers had been
+// modified to run at, as they were in timerModifiedEarlier state.
+// The caller must have locked the timers for pp.
+func balanceMoveTimers(pp *p, timers []*timer) (removed int32, earliest int64) {
+	for _, t := range timers {
+		if atomic.Load(&t.status) == timerModifiedEarlier {
+			// t may be modified again before moveTimers
+			// moves it, which then uses the new time. This
+			// one only makes adjusttimers look at pp's heap.
+			if w := t.nextwhen; earliest == 0 || w < earliest {
+				earliest = w
+			}
+		}
+	}
+	return moveTimers(pp, timers), earliest
 }
 
-// adjusttimers looks through the timers in the current P's heap for
-// any timers that have been modified to run earlier, and puts them in
-// the correct place in the heap. While looking for those timers,
+// timersStolen is the number of timers run by checkTimers on a P
+// other than the one they were added to. Accessed atomically.
+var timersStolen uint64
+
+// adjustTimersDist is the distribution of the time adjusttimers takes
+// when it has to look through a P's timers.
+var adjustTimersDist timeHistogram
+
+// timerBalance holds the state of timer rebalancing between Ps.
+//
+// When enabled, sysmon periodically compares the sizes of the Ps'
+// timer heaps. If one is much larger than another, it records the
+// pair in src and dst, and the next checkTimers call on the source P
+// moves part of its heap to the destination P. At most one such
+// migration is pending at any time, which is what allows the
+// migration to hold the timersLock of two Ps at once.
+var timerBalance struct {
+	enabled uint32 // accessed atomically
+	src     uint32 // ID+1 of the P to move timers from; 0 if none; accessed atomically
+	dst     uint32 // ID of the P to move timers to; valid if src != 0
+	last    int64  // last time sysmon looked; owned by sysmon
+}
+
+const (
+	// timerBalancePeriod is how often sysmon looks for imbalance.
+	timerBalancePeriod = 10 * 1000 * 1000 // 10ms
+
+	// timerBalanceMinDiff is the smallest difference in timer heap
+	// sizes that is worth moving timers for.
+	timerBalanceMinDiff = 64
+)
+
+// SetTimerRebalancing enables or disables the redistribution of timers
+// between Ps (logical processors). Timers normally stay on the P of the
+// goroutine that started them, so a single goroutine starting many timers
+// can leave one P doing all the work of running them. When rebalancing is
+// enabled, the runtime periodically moves timers from Ps with many
+// pending timers to Ps with few. Moving a timer does not change when it
+// fires. Rebalancing is disabled by default.
+func SetTimerRebalancing(enabled bool) {
+	v := uint32(0)
+	if enabled {
+		v = 1
+	}
+	atomic.Store(&timerBalance.enabled, v)
+}
+
+// sysmonBalanceTimers looks for a pair of Ps whose timer heaps are
+// badly out of balance and, if it finds one, asks the larger to hand
+// timers to the smaller.
+// This is only called by sysmon.
+//go:nowritebarrierrec
+func sysmonBalanceTimers(now int64) {
+	if now-timerBalance.last < timerBalancePeriod {
+		return
+	}
+	timerBalance.last = now
+	if atomic.Load(&timerBalance.src) != 0 {
+		// The previous migration hasn't happened yet.
+		return
+	}
+
+	// Prevent allp slice changes. This is like retake.
+	lock(&allpLock)
+	var src, dst *p
+	var max, min uint32
+	for _, pp := range allp {
+		if pp == nil {
+			continue
+		}
+		n := atomic.Load(&pp.numTimers)
+		if src == nil || n > max {
+			src, max = pp, n
+		}
+		if dst == nil || n < min {
+			dst, min = pp, n
+		}
+	}
+	if src != dst && max-min >= timerBalanceMinDiff && max > 2*min {
+		timerBalance.dst = uint32(dst.id)
+		atomic.Store(&timerBalance.src, uint32(src.id)+1)
+	}
+	unlock(&allpLock)
+}
+
+// balanceTimers moves about half of the difference in the number of
+// timers between pp and the P selected by sysmonBalanceTimers from
+// pp's timer heap, and then its timing wheel, to that P.
+// The caller must have claimed the pending migration by clearing
+// timerBalance.src, and must not have locked the timers for pp.
+func balanceTimers(pp *p) {
+	// timerBalance.dst was written before the migration was posted,
+	// and sysmon won't post another until src is cleared, which
+	// happened before the call.
+	dstid := timerBalance.dst
+	var dst *p
+	if int(dstid) < len(allp) {
+		dst = allp[dstid]
+	}
+	var next int64
+	if dst != nil && dst != pp && dst.status != _Pdead {
+		lock(&pp.timersLock)
+		lock(&dst.timersLock)
+		if n := (int(atomic.Load(&pp.numTimers)) - int(atomic.Load(&dst.numTimers))) / 2; n > 0 {
+			// Removing entries from the end of the heap array
+			// leaves the rest of the heap valid.
+			ts := pp.timers
+			h := n
+			if h > len(ts) {
+				h = len(ts)
+			}
+			moved := ts[len(ts)-h:]
+			pp.timers = ts[:len(ts)-h]
+			removed, earliest := balanceMoveTimers(dst, moved)
+			for i := range moved {
+				moved[i] = nil
+			}
+			if h < n && pp.timerWheel != nil {
+				// Make up the rest from the timing wheel.
+				parked := pp.timerWheel.takeSome(n-h, nil)
+				r, e := balanceMoveTimers(dst, parked)
+				removed += r
+				if e != 0 && (earliest == 0 || e < earliest) {
+					earliest = e
+				}
+				n = h + len(parked)
+			}
+			if earliest != 0 {
+				// Some of the timers had been modified to run
+				// earlier, and pp's timerModifiedEarliest was
+				// set for them. Carry it over to dst, which
+				// now has them, as modtimer would have.
+				updateTimerModifiedEarliest(dst, earliest)
+			}
+			atomic.Xadd(&pp.numTimers, -int32(n))
+			atomic.Xadd(&pp.deletedTimers, -removed)
+			updateTimer0When(pp)
+			if next = int64(atomic.Load64(&dst.timer0When)); next != 0 {
+				// Make sure other Ps look at dst's timers,
+				// even if dst is idle.
+				timerpMask.set(dst.id)
+			}
+			if verifyTimers {
+				verifyTimerHeap(pp)
+				verifyTimerHeap(dst)
+			}
+		}
+		unlock(&dst.timersLock)
+		unlock(&pp.timersLock)
+	}
+	if next != 0 {
+		wakeNetPoller(next)
+	}
+}
+
+// adjusttimers looks through the timers in the current P's heap and
+// timing wheel for any timers that have been modified to run earlier,
+// and puts them in the correct place. While looking for those timers,
 // it also moves timers that have been modified to run later,
 // and removes deleted timers. The caller must have locked the timers for pp.
 func adjusttimers(pp *p, now int64) {
@@ -669,6 +858,7 @@ func adjusttimers(pp *p, now int64) {
 	// We are going to clear all timerModifiedEarlier timers.
 	atomic.Store64(&pp.timerModifiedEarliest, 0)
 
+	start := nanotime()
 	var moved []*timer
 	for i := 0; i < len(pp.timers); i++ {
 		t := pp.timers[i]
@@ -714,9 +904,11 @@ func adjusttimers(pp *p, now int64) {
 		}
 	}
 
+	moved = adjustparkedtimers(pp, moved)
 	if len(moved) > 0 {
 		addAdjustedTimers(pp, moved)
 	}
+	adjustTimersDist.record(nanotime() - start)
 
 	if verifyTimers {
 		verifyTimerHeap(pp)
@@ -799,6 +991,10 @@ func runtimer(pp *p, now int64) int64 {
 			if !atomic.Cas(&t.status, timerMoving, timerWaiting) {
 				badTimer()
 			}
+			if len(pp.timers) == 0 {
+				// t was parked in the timing wheel.
+				return -1
+			}
 
 		case timerModifying:
 			// Wait for modification to complete.
@@ -889,6 +1085,9 @@ func clearDeletedTimers(pp *p) {
 	// Do this now in case new ones show up while we are looping.
 	atomic.Store64(&pp.timerModifiedEarliest, 0)
 
+	// Parked timers are not in the heap, so deal with them first.
+	moved := adjustparkedtimers(pp, nil)
+
 	cdel := int32(0)
 	to := 0
 	changedHeap := false
@@ -953,6 +1152,9 @@ nextTimer:
 
 	timers = timers[:to]
 	pp.timers = timers
+	if len(moved) > 0 {
+		addAdjustedTimers(pp, moved)
+	}
 	updateTimer0When(pp)
 
 	if verifyTimers {
@@ -977,8 +1179,12 @@ func verifyTimerHeap(pp *p) {
 			throw("bad timer heap")
 		}
 	}
-	if numTimers := int(atomic.Load(&pp.numTimers)); len(pp.timers) != numTimers {
-		println("timer heap len", len(pp.timers), "!= numTimers", numTimers)
+	n := len(pp.timers)
+	if pp.timerWheel != nil {
+		n += pp.timerWheel.n
+	}
+	if numTimers := int(atomic.Load(&pp.numTimers)); n != numTimers {
+		println("timer heap len", len(pp.timers), "+ parked", n-len(pp.timers), "!= numTimers", numTimers)
 		throw("bad timer heap len")
 	}
 }
@@ -986,11 +1192,17 @@ func verifyTimerHeap(pp *p) {
 // updateTimer0When sets the P's timer0When field.
 // The caller must have locked the timers for pp.
 func updateTimer0When(pp *p) {
-	if len(pp.timers) == 0 {
-		atomic.Store64(&pp.timer0When, 0)
-	} else {
-		atomic.Store64(&pp.timer0When, uint64(pp.timers[0].when))
+	next := int64(0)
+	if len(pp.timers) > 0 {
+		next = pp.timers[0].when
 	}
+	if w := pp.timerWheel; w != nil && w.n > 0 {
+		// Wake up in time to advance the wheel.
+		if wn := w.next(); next == 0 || wn < next {
+			next = wn
+		}
+	}
+	atomic.Store64(&pp.timer0When, uint64(next))
 }
 
 // updateTimerModifiedEarliest updates the recorded nextwhen field of the
@@ -1009,7 +1221,8 @@ func updateTimerModifiedEarliest(pp *p, nextwhen int64) {
 }
 
 // timeSleepUntil returns the time when the next timer should fire,
-// and the P that holds the timer heap that that timer is on.
+// and the P that holds the timer heap that that timer is on, or nil
+// if it is a coarse timer.
 // This is only called by sysmon and checkdead.
 func timeSleepUntil() (int64, *p) {
 	next := int64(maxWhen)
@@ -1038,6 +1251,13 @@ func timeSleepUntil() (int64, *p) {
 	}
 	unlock(&allpLock)
 
+	// Coarse timers are not on any P, but sysmon has to wake up
+	// for them.
+	if w := int64(atomic.Load64(&coarseTimers.next)); w != 0 && w < next {
+		next = w
+		pret = nil
+	}
+
 	return next, pret
 }
 
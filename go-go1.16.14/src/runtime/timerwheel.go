@@ -0,0 +1,300 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Hierarchical timing wheel.
+//
+// With GODEBUG=timerwheel=1, a timer added to a P that is not due
+// within the current tick of the P's timing wheel is parked in the
+// wheel rather than pushed on the P's heap. Parking a timer and
+// taking it out again take constant time, which helps programs that
+// keep many timers far in the future, such as network deadlines that
+// are pushed back on every read. The heap then holds only the timers
+// that are due soon.
+//
+// The wheel has timerWheelLevels levels of timerWheelSlots slots. A
+// slot at level l covers 1<<timerWheelShift(l) nanoseconds, so the
+// slots of one level together cover one slot of the level above. A
+// timer is parked at the lowest level whose slots reach its when
+// field from the wheel's current time. checkTimers advances the wheel
+// to the current time, emptying the slots it has entered in one batch
+// and parking their timers again at lower levels, or pushing them on
+// the heap once they are due within the current tick. The P's
+// timer0When covers the next slot that has to be emptied as well as
+// the first timer in the heap.
+//
+// Parked timers go through the same status changes as timers in the
+// heap. Deleted and modified timers stay in their slots until
+// adjusttimers or clearDeletedTimers, which look through the wheel as
+// well as the heap, take them out, or until their slot is emptied
+// into the heap, which handles them as usual.
+
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	"runtime/internal/sys"
+)
+
+const (
+	timerWheelTickShift = 26 // a tick is about 67ms
+	timerWheelSlotBits  = 6
+	timerWheelSlots     = 1 << timerWheelSlotBits
+	timerWheelLevels    = 4
+)
+
+// timerWheelShift returns the log2 of the nanoseconds covered by each
+// slot at level.
+func timerWheelShift(level int) uint {
+	return timerWheelTickShift + uint(level)*timerWheelSlotBits
+}
+
+// A timerWheel holds the timers parked on a P.
+// The caller must have locked the timers for the P to access it.
+//
+// At each level l, the timers are in the slots numbered
+// now>>timerWheelShift(l)+1 through now>>timerWheelShift(l)+63,
+// modulo timerWheelSlots, so the slot of the current time is empty.
+type timerWheel struct {
+	now   int64                    // time the wheel has advanced to
+	n     int                      // number of parked timers
+	used  [timerWheelLevels]uint64 // bit i set if slots[l][i] is not empty
+	due   []*timer                 // scratch space for advance
+	slots [timerWheelLevels][timerWheelSlots][]*timer
+}
+
+// slot returns the level and index of the slot for a timer due at
+// when. It returns a level of -1 if the timer is due within the
+// current tick and belongs on the heap.
+func (w *timerWheel) slot(when int64) (level int, i uint) {
+	for l := 0; l < timerWheelLevels; l++ {
+		s := timerWheelShift(l)
+		d := when>>s - w.now>>s
+		if d <= 0 {
+			return -1, 0
+		}
+		if d < timerWheelSlots {
+			return l, uint(when>>s) & (timerWheelSlots - 1)
+		}
+	}
+	// Too far off for the wheel. Use the last slot of the top level,
+	// and place the timer again when that slot is emptied.
+	s := timerWheelShift(timerWheelLevels - 1)
+	return timerWheelLevels - 1, uint(w.now>>s+timerWheelSlots-1) & (timerWheelSlots - 1)
+}
+
+// add parks t in the wheel. It reports false, without parking t, if t
+// is due within the current tick.
+func (w *timerWheel) add(t *timer) bool {
+	l, i := w.slot(t.when)
+	if l < 0 {
+		return false
+	}
+	w.slots[l][i] = append(w.slots[l][i], t)
+	w.used[l] |= 1 << i
+	w.n++
+	return true
+}
+
+// remove takes the j'th timer out of slot i at level l. The last timer
+// in the slot takes its place.
+func (w *timerWheel) remove(l int, i uint, j int) {
+	ts := w.slots[l][i]
+	last := len(ts) - 1
+	ts[j] = ts[last]
+	ts[last] = nil
+	w.slots[l][i] = ts[:last]
+	if last == 0 {
+		w.used[l] &^= 1 << i
+	}
+	w.n--
+}
+
+// take empties slot i at level l, appending its timers to ts.
+func (w *timerWheel) take(l int, i uint, ts []*timer) []*timer {
+	s := w.slots[l][i]
+	ts = append(ts, s...)
+	for j := range s {
+		s[j] = nil
+	}
+	w.slots[l][i] = s[:0]
+	w.used[l] &^= 1 << i
+	w.n -= len(s)
+	return ts
+}
+
+// advance moves the wheel's time forward to now, appending the timers
+// in the slots it enters to due. The caller must place them again.
+func (w *timerWheel) advance(now int64, due []*timer) []*timer {
+	if now>>timerWheelTickShift <= w.now>>timerWheelTickShift {
+		// Still in the same tick, so no slot is entered.
+		if now > w.now {
+			w.now = now
+		}
+		return due
+	}
+	for l := 0; l < timerWheelLevels && w.n > 0; l++ {
+		s := timerWheelShift(l)
+		old, cur := w.now>>s, now>>s
+		if cur-old >= timerWheelSlots {
+			// Every used slot has been entered.
+			cur = old + timerWheelSlots - 1
+		}
+		for k := old + 1; k <= cur && w.used[l] != 0; k++ {
+			i := uint(k) & (timerWheelSlots - 1)
+			if w.used[l]&(1<<i) != 0 {
+				due = w.take(l, i, due)
+			}
+		}
+	}
+	w.now = now
+	return due
+}
+
+// next returns the start of the first slot that is not empty, which is
+// when the wheel must next be advanced, or 0 if the wheel is empty.
+func (w *timerWheel) next() int64 {
+	next := int64(0)
+	for l := 0; l < timerWheelLevels; l++ {
+		used := w.used[l]
+		if used == 0 {
+			continue
+		}
+		s := timerWheelShift(l)
+		k := w.now>>s + 1
+		// Rotate used so that bit 0 is slot k.
+		r := uint(k) & (timerWheelSlots - 1)
+		used = used>>r | used<<(timerWheelSlots-r)
+		when := (k + int64(sys.TrailingZeros64(used))) << s
+		if next == 0 || when < next {
+			next = when
+		}
+	}
+	return next
+}
+
+// takeSome takes up to n timers out of the wheel, starting at the top
+// level, and appends them to ts.
+func (w *timerWheel) takeSome(n int, ts []*timer) []*timer {
+	for l := timerWheelLevels - 1; l >= 0 && n > 0; l-- {
+		for i := uint(0); i < timerWheelSlots && n > 0; i++ {
+			for n > 0 && len(w.slots[l][i]) > 0 {
+				j := len(w.slots[l][i]) - 1
+				ts = append(ts, w.slots[l][i][j])
+				w.remove(l, i, j)
+				n--
+			}
+		}
+	}
+	return ts
+}
+
+// all empties the wheel and returns all its timers.
+func (w *timerWheel) all() []*timer {
+	var ts []*timer
+	for l := range w.slots {
+		for i := range w.slots[l] {
+			if w.used[l]&(1<<uint(i)) != 0 {
+				ts = w.take(l, uint(i), ts)
+			}
+		}
+	}
+	return ts
+}
+
+// parktimer parks t, which is being added to pp, in pp's timing wheel,
+// creating the wheel if needed. It reports false if t is due too soon
+// to park and belongs on the heap.
+// The caller must have locked the timers for pp.
+func parktimer(pp *p, t *timer) bool {
+	w := pp.timerWheel
+	if w == nil {
+		w = new(timerWheel)
+		w.now = nanotime()
+		pp.timerWheel = w
+	}
+	if !w.add(t) {
+		return false
+	}
+	updateTimer0When(pp)
+	return true
+}
+
+// advancetimers advances pp's timing wheel to now, pushing the timers
+// that are now due within the current tick on pp's heap.
+// The caller must have locked the timers for pp.
+func advancetimers(pp *p, now int64) {
+	w := pp.timerWheel
+	if w == nil {
+		return
+	}
+	due := w.advance(now, w.due[:0])
+	if len(due) == 0 {
+		return
+	}
+	for i, t := range due {
+		if !w.add(t) {
+			pushtimer(pp, t)
+		}
+		due[i] = nil
+	}
+	w.due = due[:0]
+	updateTimer0When(pp)
+}
+
+// adjustparkedtimers looks through the timers parked in pp's timing
+// wheel. It removes deleted timers, and takes out timers that have
+// been modified, setting their when fields and appending them to moved
+// for addAdjustedTimers. It returns the new moved slice.
+// The caller must have locked the timers for pp.
+func adjustparkedtimers(pp *p, moved []*timer) []*timer {
+	w := pp.timerWheel
+	if w == nil || w.n == 0 {
+		return moved
+	}
+	for l := range w.slots {
+		for i := uint(0); i < timerWheelSlots; i++ {
+			for j := 0; j < len(w.slots[l][i]); j++ {
+				t := w.slots[l][i][j]
+				if t.pp.ptr() != pp {
+					throw("adjustparkedtimers: bad p")
+				}
+				switch s := atomic.Load(&t.status); s {
+				case timerDeleted:
+					if atomic.Cas(&t.status, s, timerRemoving) {
+						w.remove(l, i, j)
+						t.pp = 0
+						atomic.Xadd(&pp.numTimers, -1)
+						if !atomic.Cas(&t.status, timerRemoving, timerRemoved) {
+							badTimer()
+						}
+						atomic.Xadd(&pp.deletedTimers, -1)
+					}
+					// Look at slot j again.
+					j--
+				case timerModifiedEarlier, timerModifiedLater:
+					if atomic.Cas(&t.status, s, timerMoving) {
+						t.when = t.nextwhen
+						w.remove(l, i, j)
+						t.pp = 0
+						atomic.Xadd(&pp.numTimers, -1)
+						moved = append(moved, t)
+					}
+					j--
+				case timerNoStatus, timerRunning, timerRemoving, timerRemoved, timerMoving:
+					badTimer()
+				case timerWaiting:
+					// OK, nothing to do.
+				case timerModifying:
+					// Check again after modification is complete.
+					osyield()
+					j--
+				default:
+					badTimer()
+				}
+			}
+		}
+	}
+	updateTimer0When(pp)
+	return moved
+}
@@ -918,6 +918,9 @@ func goroutineheader(gp *g) {
 	if gp.lockedm != 0 {
 		print(", locked to thread")
 	}
+	if mp := gp.m; mp != nil && (gpstatus == _Grunning || gpstatus == _Gsyscall) && mp.name[0] != 0 {
+		print(", thread ", gostringnocopy(&mp.name[0]))
+	}
 	print("]:\n")
 }
 
@@ -0,0 +1,132 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "runtime/internal/atomic"
+
+// A WaitReason says why a goroutine is blocked. Its String method
+// returns the text shown for it in tracebacks, such as "chan receive".
+//
+// The reasons for which goroutines block on behalf of user code can be
+// compared with the constants below, whose values stay the same from
+// one release to the next. The values of the runtime's other reasons,
+// and of those added with NewWaitReason, may change, so only their
+// String methods should be relied on.
+type WaitReason uint8
+
+// Reasons for which goroutines block on behalf of user code.
+const (
+	WaitNone               = WaitReason(waitReasonZero)
+	WaitChanReceive        = WaitReason(waitReasonChanReceive)
+	WaitChanReceiveNilChan = WaitReason(waitReasonChanReceiveNilChan)
+	WaitChanSend           = WaitReason(waitReasonChanSend)
+	WaitChanSendNilChan    = WaitReason(waitReasonChanSendNilChan)
+	WaitIO                 = WaitReason(waitReasonIOWait)
+	WaitSelect             = WaitReason(waitReasonSelect)
+	WaitSelectNoCases      = WaitReason(waitReasonSelectNoCases)
+	WaitSemacquire         = WaitReason(waitReasonSemacquire) // such as in sync.Mutex.Lock and sync.WaitGroup.Wait
+	WaitSleep              = WaitReason(waitReasonSleep)
+	WaitSyncCondWait       = WaitReason(waitReasonSyncCondWait)
+)
+
+func (r WaitReason) String() string {
+	return waitReason(r).String()
+}
+
+// isUser reports whether w is one of the reasons that SetWaitReason
+// replaces.
+func (w waitReason) isUser() bool {
+	switch w {
+	case waitReasonChanReceive, waitReasonChanReceiveNilChan,
+		waitReasonChanSend, waitReasonChanSendNilChan,
+		waitReasonIOWait, waitReasonSelect, waitReasonSelectNoCases,
+		waitReasonSemacquire, waitReasonSleep, waitReasonSyncCondWait:
+		return true
+	}
+	return false
+}
+
+// userWaitReasons holds the reasons registered with NewWaitReason.
+var userWaitReasons struct {
+	lock  mutex
+	n     uint32 // number of names in use; accessed atomically
+	names [256 - int(waitReasonFirstUser)]string
+}
+
+// userWaitReasonString returns the name of w, which is at least
+// waitReasonFirstUser. It doesn't lock, since it's used in tracebacks.
+func userWaitReasonString(w waitReason) string {
+	i := uint32(w - waitReasonFirstUser)
+	if i >= atomic.Load(&userWaitReasons.n) {
+		return "unknown wait reason"
+	}
+	return userWaitReasons.names[i]
+}
+
+// NewWaitReason returns a WaitReason whose String method returns name,
+// for use with SetWaitReason. Calling NewWaitReason again with the same
+// name returns the same WaitReason. A program can create around two
+// hundred reasons; NewWaitReason panics if there is no room for more.
+//
+// NewWaitReason is meant to be called during initialization, by
+// packages that block goroutines on behalf of their clients, such as
+// connection pools, so that goroutine dumps can tell these goroutines
+// from others blocked on the same kind of primitive.
+func NewWaitReason(name string) WaitReason {
+	if name == "" {
+		panic(plainError("runtime: NewWaitReason with empty name"))
+	}
+	lock(&userWaitReasons.lock)
+	n := userWaitReasons.n
+	for i := uint32(0); i < n; i++ {
+		if userWaitReasons.names[i] == name {
+			unlock(&userWaitReasons.lock)
+			return WaitReason(waitReasonFirstUser) + WaitReason(i)
+		}
+	}
+	if n == uint32(len(userWaitReasons.names)) {
+		unlock(&userWaitReasons.lock)
+		panic(plainError("runtime: too many wait reasons"))
+	}
+	userWaitReasons.names[n] = name
+	atomic.Store(&userWaitReasons.n, n+1)
+	unlock(&userWaitReasons.lock)
+	return WaitReason(waitReasonFirstUser) + WaitReason(n)
+}
+
+// SetWaitReason sets the reason shown for the calling goroutine, in
+// tracebacks and by ForEachGoroutine, whenever it blocks on a channel
+// operation, a select statement, a sync package primitive, time.Sleep
+// or network I/O, and returns the reason set before. r must have been
+// returned by NewWaitReason, or be WaitNone to show why the goroutine
+// blocks again. For example, a pool could wait for a connection with
+//
+//	prev := runtime.SetWaitReason(waitingOnPool)
+//	c := <-p.conns
+//	runtime.SetWaitReason(prev)
+func SetWaitReason(r WaitReason) WaitReason {
+	w := waitReason(r)
+	if w != waitReasonZero && (w < waitReasonFirstUser || uint32(w-waitReasonFirstUser) >= atomic.Load(&userWaitReasons.n)) {
+		panic(plainError("runtime: SetWaitReason with a reason not from NewWaitReason"))
+	}
+	gp := getg()
+	old := gp.userWaitReason
+	gp.userWaitReason = w
+	return WaitReason(old)
+}
+
+// WaitReasons returns all the reasons a goroutine may be blocked for,
+// including those created by NewWaitReason so far.
+func WaitReasons() []WaitReason {
+	n := atomic.Load(&userWaitReasons.n)
+	rs := make([]WaitReason, 0, len(waitReasonStrings)-1+int(n))
+	for w := waitReason(1); w < waitReason(len(waitReasonStrings)); w++ {
+		rs = append(rs, WaitReason(w))
+	}
+	for i := uint32(0); i < n; i++ {
+		rs = append(rs, WaitReason(waitReasonFirstUser)+WaitReason(i))
+	}
+	return rs
+}
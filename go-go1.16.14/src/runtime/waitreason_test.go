@@ -0,0 +1,118 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime_test
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewWaitReason(t *testing.T) {
+	r := runtime.NewWaitReason("waiting on test pool")
+	if s := r.String(); s != "waiting on test pool" {
+		t.Errorf("String() = %q, want %q", s, "waiting on test pool")
+	}
+	if r2 := runtime.NewWaitReason("waiting on test pool"); r2 != r {
+		t.Errorf("NewWaitReason with the same name returned %d, then %d", r, r2)
+	}
+	if r2 := runtime.NewWaitReason("waiting on other test pool"); r2 == r {
+		t.Errorf("NewWaitReason with different names returned %d both times", r)
+	}
+	if s := runtime.WaitChanReceive.String(); s != "chan receive" {
+		t.Errorf("WaitChanReceive.String() = %q, want %q", s, "chan receive")
+	}
+
+	found := map[runtime.WaitReason]bool{}
+	for _, w := range runtime.WaitReasons() {
+		found[w] = true
+	}
+	for _, w := range []runtime.WaitReason{r, runtime.WaitChanReceive, runtime.WaitSemacquire} {
+		if !found[w] {
+			t.Errorf("WaitReasons() doesn't include %q", w)
+		}
+	}
+	if found[runtime.WaitNone] {
+		t.Errorf("WaitReasons() includes WaitNone")
+	}
+}
+
+func TestSetWaitReason(t *testing.T) {
+	r := runtime.NewWaitReason("waiting on test pool")
+	c := make(chan bool)
+	var mu sync.Mutex
+	mu.Lock()
+	var ids [3]chan int64
+	for i := range ids {
+		ids[i] = make(chan int64, 1)
+	}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		ids[0] <- runtime.Goid()
+		<-c
+	}()
+	go func() {
+		defer wg.Done()
+		prev := runtime.SetWaitReason(r)
+		ids[1] <- runtime.Goid()
+		<-c
+		if runtime.SetWaitReason(prev) != r {
+			t.Errorf("SetWaitReason didn't return the reason set before")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		runtime.SetWaitReason(r)
+		ids[2] <- runtime.Goid()
+		mu.Lock()
+		mu.Unlock()
+	}()
+	plain, custom1, custom2 := <-ids[0], <-ids[1], <-ids[2]
+
+	want := map[int64]runtime.WaitReason{
+		plain:   runtime.WaitChanReceive,
+		custom1: r,
+		custom2: r,
+	}
+	// Wait for all three goroutines to block.
+	var got map[int64]runtime.WaitReason
+	for i := 0; i < 100 && len(got) < len(want); i++ {
+		time.Sleep(10 * time.Millisecond)
+		got = map[int64]runtime.WaitReason{}
+		runtime.ForEachGoroutine(func(info runtime.GInfo) bool {
+			if _, ok := want[info.ID]; ok && info.Status == "waiting" {
+				got[info.ID] = info.WaitReason
+			}
+			return true
+		})
+	}
+	for id, w := range want {
+		if r, ok := got[id]; !ok {
+			t.Errorf("goroutine %d did not block", id)
+		} else if r != w {
+			t.Errorf("goroutine %d: wait reason %q, want %q", id, r, w)
+		}
+	}
+
+	buf := make([]byte, 1<<20)
+	stk := string(buf[:runtime.Stack(buf, true)])
+	if !strings.Contains(stk, "[waiting on test pool]") {
+		t.Errorf("stack dump doesn't show custom wait reason:\n%s", stk)
+	}
+	close(c)
+	mu.Unlock()
+	wg.Wait()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetWaitReason(WaitChanReceive) didn't panic")
+		}
+	}()
+	runtime.SetWaitReason(runtime.WaitChanReceive)
+}
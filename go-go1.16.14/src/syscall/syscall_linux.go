@@ -1032,8 +1032,9 @@ func (pc *allThreadsCaller) doSyscall6(initial bool) bool {
 // Provided by runtime.syscall_runtime_doAllThreadsSyscall which
 // serializes the world and invokes the fn on each OS thread (what the
 // runtime refers to as m's). Once this function returns, all threads
-// are in sync.
-func runtime_doAllThreadsSyscall(fn func(bool) bool)
+// are in sync, unless it returns false: then some threads of a cgo
+// binary did not respond in time, and fn was not invoked on any thread.
+func runtime_doAllThreadsSyscall(fn func(bool) bool) bool
 
 // AllThreadsSyscall performs a syscall on each OS thread of the Go
 // runtime. It first invokes the syscall on one thread. Should that
@@ -1047,24 +1048,29 @@ func runtime_doAllThreadsSyscall(fn func(bool) bool)
 // process-wide state changes that require consistently modifying
 // per-thread state of the Go runtime.
 //
-// AllThreadsSyscall is unaware of any threads that are launched
-// explicitly by cgo linked code, so the function always returns
-// ENOTSUP in binaries that use cgo.
+// In binaries that use cgo, AllThreadsSyscall is only best effort.
+// It is unaware of threads launched explicitly by cgo linked code,
+// except while they run a call into Go and, on systems where the
+// runtime keeps the thread's M from one such call to the next, from
+// then until they exit. The syscall is not invoked on other threads.
+// If such a thread does not respond in time, for instance because it
+// blocks signals, the syscall is not invoked on any thread, and
+// AllThreadsSyscall returns ETIMEDOUT.
 //go:uintptrescapes
 func AllThreadsSyscall(trap, a1, a2, a3 uintptr) (r1, r2 uintptr, err Errno) {
-	if cgo_libc_setegid != nil {
-		return minus1, minus1, ENOTSUP
-	}
 	pc := &allThreadsCaller{
 		trap: trap,
 		a1:   a1,
 		a2:   a2,
 		a3:   a3,
 	}
-	runtime_doAllThreadsSyscall(pc.doSyscall)
+	complete := runtime_doAllThreadsSyscall(pc.doSyscall)
 	r1 = pc.r1
 	r2 = pc.r2
 	err = pc.err
+	if !complete && err == 0 {
+		err = ETIMEDOUT
+	}
 	return
 }
 
@@ -1072,9 +1078,6 @@ func AllThreadsSyscall(trap, a1, a2, a3 uintptr) (r1, r2 uintptr, err Errno) {
 // arguments.
 //go:uintptrescapes
 func AllThreadsSyscall6(trap, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err Errno) {
-	if cgo_libc_setegid != nil {
-		return minus1, minus1, ENOTSUP
-	}
 	pc := &allThreadsCaller{
 		trap: trap,
 		a1:   a1,
@@ -1084,10 +1087,13 @@ func AllThreadsSyscall6(trap, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, e
 		a5:   a5,
 		a6:   a6,
 	}
-	runtime_doAllThreadsSyscall(pc.doSyscall6)
+	complete := runtime_doAllThreadsSyscall(pc.doSyscall6)
 	r1 = pc.r1
 	r2 = pc.r2
 	err = pc.err
+	if !complete && err == 0 {
+		err = ETIMEDOUT
+	}
 	return
 }
 